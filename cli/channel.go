@@ -0,0 +1,173 @@
+package cli
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/controller"
+	"github.com/QuantumNous/new-api/model"
+	"github.com/QuantumNous/new-api/service"
+)
+
+var channelStatusNames = map[int]string{
+	common.ChannelStatusUnknown:          "unknown",
+	common.ChannelStatusEnabled:          "enabled",
+	common.ChannelStatusManuallyDisabled: "disabled",
+	common.ChannelStatusAutoDisabled:     "auto-disabled",
+}
+
+func runChannelList(args []string) error {
+	fs := newFlagSet("channel list")
+	status := fs.String("status", "all", "filter by status: all, enabled, disabled (manually or automatically)")
+	tag := fs.String("tag", "", "filter by tag")
+	asJSON := fs.Bool("json", false, "print JSON instead of a table")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	query := model.DB.Omit("key").Order("id asc")
+	switch *status {
+	case "all":
+	case "enabled":
+		query = query.Where("status = ?", common.ChannelStatusEnabled)
+	case "disabled":
+		query = query.Where("status IN ?", []int{common.ChannelStatusManuallyDisabled, common.ChannelStatusAutoDisabled})
+	default:
+		return fmt.Errorf("invalid status %q", *status)
+	}
+	if *tag != "" {
+		query = query.Where("tag = ?", *tag)
+	}
+	var channels []*model.Channel
+	if err := query.Find(&channels).Error; err != nil {
+		return err
+	}
+
+	if *asJSON {
+		data, err := common.Marshal(channels)
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprintln(stdout, string(data))
+		return err
+	}
+	w := tabwriter.NewWriter(stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "ID\tNAME\tTYPE\tSTATUS\tGROUP\tTAG\tPRIORITY\tWEIGHT\tMODELS")
+	for _, channel := range channels {
+		models := channel.Models
+		if len(models) > 60 {
+			models = models[:57] + "..."
+		}
+		fmt.Fprintf(w, "%d\t%s\t%d\t%s\t%s\t%s\t%d\t%d\t%s\n", channel.Id, channel.Name, channel.Type,
+			channelStatusNames[channel.Status], channel.Group, channel.GetTag(), channel.GetPriority(), channel.GetWeight(), models)
+	}
+	return w.Flush()
+}
+
+func runChannelEnable(args []string) error {
+	return setChannelStatus("channel enable", args, common.ChannelStatusEnabled)
+}
+
+func runChannelDisable(args []string) error {
+	return setChannelStatus("channel disable", args, common.ChannelStatusManuallyDisabled)
+}
+
+func setChannelStatus(path string, args []string, status int) error {
+	fs := newFlagSet(path)
+	id := fs.Int("id", 0, "channel id")
+	tag := fs.String("tag", "", "apply to all channels with this tag")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if (*id > 0) == (*tag != "") {
+		return errors.New("exactly one of --id or --tag is required")
+	}
+	if *tag != "" {
+		var err error
+		if status == common.ChannelStatusEnabled {
+			err = model.EnableChannelByTag(*tag)
+		} else {
+			err = model.DisableChannelByTag(*tag)
+		}
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(stdout, "channels with tag %s are now %s\n", *tag, channelStatusNames[status])
+		return nil
+	}
+	channel, err := model.GetChannelById(*id, false)
+	if err != nil {
+		return fmt.Errorf("channel not found: %w", err)
+	}
+	if !model.UpdateChannelStatus(channel.Id, "", status, "changed from command line") {
+		return errors.New("failed to update channel status")
+	}
+	fmt.Fprintf(stdout, "channel %s (ID: %d) is now %s\n", channel.Name, channel.Id, channelStatusNames[status])
+	return nil
+}
+
+func runChannelSetKey(args []string) error {
+	fs := newFlagSet("channel set-key")
+	id := fs.Int("id", 0, "channel id")
+	key := fs.String("key", "", "new key; use - to read it from stdin so it does not appear in the shell history")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *id <= 0 || *key == "" {
+		return errors.New("--id and --key are required")
+	}
+	newKey := *key
+	if newKey == "-" {
+		data, err := io.ReadAll(bufio.NewReader(os.Stdin))
+		if err != nil {
+			return err
+		}
+		newKey = strings.TrimSpace(string(data))
+	}
+	if newKey == "" {
+		return errors.New("key must not be empty")
+	}
+	channel, err := model.GetChannelById(*id, true)
+	if err != nil {
+		return fmt.Errorf("channel not found: %w", err)
+	}
+	channel.Key = newKey
+	if err := channel.Update(); err != nil {
+		return err
+	}
+	fmt.Fprintf(stdout, "key of channel %s (ID: %d) has been replaced\n", channel.Name, channel.Id)
+	return nil
+}
+
+func runChannelTest(args []string) error {
+	fs := newFlagSet("channel test")
+	id := fs.Int("id", 0, "channel id")
+	testModel := fs.String("model", "", "model to test, defaults to the channel's test model")
+	timeout := fs.Duration("timeout", 60*time.Second, "request timeout")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *id <= 0 {
+		return errors.New("--id is required")
+	}
+	channel, err := model.GetChannelById(*id, true)
+	if err != nil {
+		return fmt.Errorf("channel not found: %w", err)
+	}
+	service.InitTokenEncoders()
+	ctx, cancel := context.WithTimeout(context.Background(), *timeout)
+	defer cancel()
+	elapsed, err := controller.RunChannelTest(ctx, channel, *testModel)
+	if err != nil {
+		return fmt.Errorf("channel %s (ID: %d) failed: %w", channel.Name, channel.Id, err)
+	}
+	fmt.Fprintf(stdout, "channel %s (ID: %d) ok in %.2fs\n", channel.Name, channel.Id, elapsed.Seconds())
+	return nil
+}
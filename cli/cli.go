@@ -0,0 +1,221 @@
+// Package cli 实现主程序的运维子命令，例如 `new-api user reset-password`。
+// 子命令直接复用 model 包操作 SQL_DSN 指向的数据库，不启动 HTTP 服务
+package cli
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/model"
+	"github.com/QuantumNous/new-api/service"
+	"github.com/QuantumNous/new-api/setting/ratio_setting"
+
+	"github.com/gin-gonic/gin"
+	"github.com/joho/godotenv"
+)
+
+// command 一个子命令。migrate 之外的子命令不会执行数据库迁移
+type command struct {
+	group   string
+	name    string
+	summary string
+	migrate bool
+	run     func(args []string) error
+}
+
+func (c command) path() string {
+	if c.name == "" {
+		return c.group
+	}
+	return c.group + " " + c.name
+}
+
+var commands = []command{
+	{group: "user", name: "reset-password", summary: "reset a user's password, optionally re-enable the user and disable 2FA", run: runUserResetPassword},
+	{group: "token", name: "create", summary: "create an API token for a user", run: runTokenCreate},
+	{group: "token", name: "revoke", summary: "delete an API token by id or key", run: runTokenRevoke},
+	{group: "channel", name: "list", summary: "list channels", run: runChannelList},
+	{group: "channel", name: "enable", summary: "enable a channel by id or tag", run: runChannelEnable},
+	{group: "channel", name: "disable", summary: "disable a channel by id or tag", run: runChannelDisable},
+	{group: "channel", name: "set-key", summary: "replace the key of a channel", run: runChannelSetKey},
+	{group: "channel", name: "test", summary: "send a test request through a channel", run: runChannelTest},
+	{group: "secrets", name: "encrypt", summary: "encrypt plaintext secrets and re-encrypt values under previous master keys", run: runSecretsEncrypt},
+	{group: "logs", name: "purge", summary: "delete usage logs created before a point in time", run: runLogsPurge},
+	{group: "config", name: "export", summary: "export the instance configuration as YAML or JSON", run: runConfigExport},
+	{group: "config", name: "import", summary: "diff or apply a configuration document", run: runConfigImport},
+	{group: "migrate", summary: "run database migrations and exit", migrate: true, run: runMigrate},
+}
+
+// stdout 命令输出，测试时可替换。日志统一写到 stderr，保证 stdout 可以直接用于脚本
+var stdout io.Writer = os.Stdout
+
+// IsCommand 判断命令行参数是否为子命令，不是时按原逻辑启动服务
+func IsCommand(args []string) bool {
+	if len(args) == 0 {
+		return false
+	}
+	for _, cmd := range commands {
+		if cmd.group == args[0] {
+			return true
+		}
+	}
+	return args[0] == "help"
+}
+
+// Run 执行子命令并返回进程退出码
+func Run(args []string) int {
+	cmd, rest, err := findCommand(args)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		printUsage(os.Stderr)
+		return 2
+	}
+	if cmd == nil {
+		printUsage(stdout)
+		return 0
+	}
+	// 只查看帮助时不需要连接数据库，子命令在解析参数后即返回 flag.ErrHelp
+	if !wantsHelp(rest) {
+		if err := bootstrap(cmd.migrate); err != nil {
+			fmt.Fprintln(os.Stderr, "error: "+err.Error())
+			return 1
+		}
+		defer func() {
+			_ = model.CloseDB()
+		}()
+	}
+	if err := cmd.run(rest); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return 0
+		}
+		fmt.Fprintf(os.Stderr, "%s: %v\n", cmd.path(), err)
+		return 1
+	}
+	return 0
+}
+
+// findCommand 返回匹配的子命令及其余参数，help 返回 nil
+func findCommand(args []string) (*command, []string, error) {
+	if len(args) == 0 || args[0] == "help" {
+		return nil, nil, nil
+	}
+	for i := range commands {
+		cmd := &commands[i]
+		if cmd.group != args[0] {
+			continue
+		}
+		if cmd.name == "" {
+			return cmd, args[1:], nil
+		}
+		if len(args) > 1 && cmd.name == args[1] {
+			return cmd, args[2:], nil
+		}
+	}
+	return nil, nil, fmt.Errorf("unknown command: %s", strings.Join(args[:min(len(args), 2)], " "))
+}
+
+func wantsHelp(args []string) bool {
+	for _, arg := range args {
+		switch arg {
+		case "-h", "-help", "--help":
+			return true
+		}
+	}
+	return false
+}
+
+func printUsage(w io.Writer) {
+	fmt.Fprintln(w, "Usage: new-api <command> [flags]")
+	fmt.Fprintln(w, "Run without a command to start the server. Commands use the database configured by SQL_DSN / LOG_SQL_DSN.")
+	fmt.Fprintln(w)
+	sorted := make([]command, len(commands))
+	copy(sorted, commands)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].group < sorted[j].group
+	})
+	for _, cmd := range sorted {
+		fmt.Fprintf(w, "  %-24s %s\n", cmd.path(), cmd.summary)
+	}
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "Run 'new-api <command> -h' for the flags of a command.")
+}
+
+// newFlagSet 创建子命令参数解析器，错误信息输出到 stderr
+func newFlagSet(path string) *flag.FlagSet {
+	fs := flag.NewFlagSet("new-api "+path, flag.ContinueOnError)
+	fs.SetOutput(os.Stderr)
+	return fs
+}
+
+// bootstrap 加载环境变量并连接数据库。普通子命令以从节点身份连接，不修改表结构；
+// 渠道缓存统一关闭，状态变更直接写库，由运行中的服务按 SYNC_FREQUENCY 同步
+func bootstrap(migrate bool) error {
+	gin.DefaultWriter = os.Stderr
+	_ = godotenv.Load(".env")
+	common.InitEnv()
+	common.IsMasterNode = migrate
+	common.MemoryCacheEnabled = false
+
+	ratio_setting.InitRatioSettings()
+	service.InitHttpClient()
+	if err := model.InitDB(); err != nil {
+		return err
+	}
+	if err := model.InitLogDB(); err != nil {
+		return err
+	}
+	if err := common.InitRedisClient(); err != nil {
+		return err
+	}
+	model.InitOptionMap()
+	return nil
+}
+
+func runMigrate(args []string) error {
+	fs := newFlagSet("migrate")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	// 迁移已在 bootstrap 中以主节点身份完成
+	fmt.Fprintln(stdout, "database migration finished")
+	return nil
+}
+
+// parseTimestamp 解析时间参数：Unix 秒级时间戳、YYYY-MM-DD、RFC3339，或 30d / 12h 这类相对当前的时长。
+// future 为 true 时时长表示之后的时间（如令牌有效期），否则表示之前的时间（如清理日志）
+func parseTimestamp(value string, now time.Time, future bool) (int64, error) {
+	sign := -1
+	if future {
+		sign = 1
+	}
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return 0, errors.New("empty time")
+	}
+	if ts, err := strconv.ParseInt(value, 10, 64); err == nil {
+		return ts, nil
+	}
+	if strings.HasSuffix(value, "d") {
+		if days, err := strconv.Atoi(strings.TrimSuffix(value, "d")); err == nil && days >= 0 {
+			return now.AddDate(0, 0, sign*days).Unix(), nil
+		}
+	}
+	if d, err := time.ParseDuration(value); err == nil && d >= 0 {
+		return now.Add(time.Duration(sign) * d).Unix(), nil
+	}
+	if t, err := time.ParseInLocation("2006-01-02", value, time.Local); err == nil {
+		return t.Unix(), nil
+	}
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t.Unix(), nil
+	}
+	return 0, fmt.Errorf("invalid time %q, expected unix seconds, YYYY-MM-DD, RFC3339 or a duration such as 30d", value)
+}
@@ -0,0 +1,57 @@
+package cli
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestFindCommand(t *testing.T) {
+	require.True(t, IsCommand([]string{"user", "reset-password"}))
+	require.True(t, IsCommand([]string{"migrate"}))
+	require.False(t, IsCommand([]string{"--port", "3000"}))
+	require.False(t, IsCommand(nil))
+
+	cmd, rest, err := findCommand([]string{"logs", "purge", "--before", "30d"})
+	require.NoError(t, err)
+	require.Equal(t, "logs purge", cmd.path())
+	require.Equal(t, []string{"--before", "30d"}, rest)
+
+	cmd, rest, err = findCommand([]string{"migrate"})
+	require.NoError(t, err)
+	require.True(t, cmd.migrate)
+	require.Empty(t, rest)
+
+	_, _, err = findCommand([]string{"channel", "explode"})
+	require.Error(t, err)
+
+	require.True(t, wantsHelp([]string{"--id", "1", "-h"}))
+	require.False(t, wantsHelp([]string{"--id", "1"}))
+}
+
+func TestParseTimestamp(t *testing.T) {
+	now := time.Date(2026, 3, 10, 12, 0, 0, 0, time.UTC)
+
+	ts, err := parseTimestamp("1700000000", now, false)
+	require.NoError(t, err)
+	require.EqualValues(t, 1700000000, ts)
+
+	ts, err = parseTimestamp("30d", now, false)
+	require.NoError(t, err)
+	require.Equal(t, now.AddDate(0, 0, -30).Unix(), ts)
+
+	ts, err = parseTimestamp("12h", now, true)
+	require.NoError(t, err)
+	require.Equal(t, now.Add(12*time.Hour).Unix(), ts)
+
+	ts, err = parseTimestamp("2026-01-02T03:04:05Z", now, false)
+	require.NoError(t, err)
+	require.Equal(t, time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC).Unix(), ts)
+
+	_, err = parseTimestamp("2026-01-02", now, false)
+	require.NoError(t, err)
+
+	_, err = parseTimestamp("last tuesday", now, false)
+	require.Error(t, err)
+}
@@ -0,0 +1,86 @@
+package cli
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/service/configdoc"
+)
+
+// configPassphraseEnv 加密导出 / 导入密钥使用的口令，通过环境变量传递以免出现在命令历史中
+const configPassphraseEnv = "CONFIG_PASSPHRASE"
+
+func runConfigExport(args []string) error {
+	fs := newFlagSet("config export")
+	format := fs.String("format", configdoc.FormatYAML, "output format: yaml or json")
+	keys := fs.String("keys", string(configdoc.SecretOmit), "channel keys and secret options: omit, plain or encrypt (passphrase from "+configPassphraseEnv+")")
+	output := fs.String("output", "", "write to this file instead of stdout")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	mode, err := configdoc.ParseSecretMode(*keys)
+	if err != nil {
+		return err
+	}
+	doc, err := configdoc.Export(configdoc.ExportOptions{Secrets: mode, Passphrase: os.Getenv(configPassphraseEnv)})
+	if err != nil {
+		return err
+	}
+	data, err := configdoc.Marshal(doc, *format)
+	if err != nil {
+		return err
+	}
+	if *output == "" {
+		_, err = stdout.Write(data)
+		return err
+	}
+	// 文档可能包含明文密钥，仅允许当前用户读取
+	return os.WriteFile(*output, data, 0600)
+}
+
+func runConfigImport(args []string) error {
+	fs := newFlagSet("config import")
+	file := fs.String("file", "", "configuration document (YAML or JSON); - reads from stdin")
+	dryRun := fs.Bool("dry-run", false, "only print the changes that would be made")
+	prune := fs.Bool("prune", false, "delete channels and disable subscription plans missing from the document")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *file == "" {
+		return errors.New("--file is required")
+	}
+	var data []byte
+	var err error
+	if *file == "-" {
+		data, err = io.ReadAll(os.Stdin)
+	} else {
+		data, err = os.ReadFile(*file)
+	}
+	if err != nil {
+		return err
+	}
+	doc, err := configdoc.Parse(data)
+	if err != nil {
+		return err
+	}
+	report, err := configdoc.Apply(doc, configdoc.ApplyOptions{
+		DryRun:     *dryRun,
+		Prune:      *prune,
+		Passphrase: os.Getenv(configPassphraseEnv),
+	})
+	if err != nil {
+		return err
+	}
+	out, err := common.Marshal(report)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintln(stdout, string(out))
+	if report.HasErrors() {
+		return fmt.Errorf("document rejected with %d errors, nothing was applied", len(report.Errors))
+	}
+	return nil
+}
@@ -0,0 +1,43 @@
+package cli
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/QuantumNous/new-api/model"
+)
+
+func runLogsPurge(args []string) error {
+	fs := newFlagSet("logs purge")
+	before := fs.String("before", "", "delete logs created before this time: unix seconds, YYYY-MM-DD, RFC3339 or a duration such as 30d")
+	batch := fs.Int("batch", 1000, "rows deleted per batch")
+	dryRun := fs.Bool("dry-run", false, "only count the logs that would be deleted")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *before == "" {
+		return errors.New("--before is required")
+	}
+	targetTimestamp, err := parseTimestamp(*before, time.Now(), false)
+	if err != nil {
+		return err
+	}
+	cutoff := time.Unix(targetTimestamp, 0).Format(time.RFC3339)
+	ctx := context.Background()
+	if *dryRun {
+		count, err := model.CountOldLog(ctx, targetTimestamp)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(stdout, "%d logs created before %s would be deleted\n", count, cutoff)
+		return nil
+	}
+	count, err := model.DeleteOldLog(ctx, targetTimestamp, *batch)
+	if err != nil {
+		return fmt.Errorf("deleted %d logs before failing: %w", count, err)
+	}
+	fmt.Fprintf(stdout, "deleted %d logs created before %s\n", count, cutoff)
+	return nil
+}
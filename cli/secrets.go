@@ -0,0 +1,33 @@
+package cli
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/model"
+)
+
+// runSecretsEncrypt 用当前主密钥加密已有的明文敏感字段，并重新加密旧主密钥写入的值。
+// 可以重复执行，已用当前主密钥加密的值会跳过
+func runSecretsEncrypt(args []string) error {
+	fs := newFlagSet("secrets encrypt")
+	batch := fs.Int("batch", 100, "rows re-encrypted per batch")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if !common.SecretEncryptionEnabled() {
+		return errors.New("SECRET_ENCRYPTION_KEY or SECRET_ENCRYPTION_KEY_FILE must be set")
+	}
+	result, err := model.ReencryptSecrets(context.Background(), *batch, true)
+	if err != nil {
+		return fmt.Errorf("encrypted %d secrets before failing: %w", result.Total(), err)
+	}
+	fmt.Fprintf(stdout, "encrypted with master key %s: %d channels, %d oauth providers, %d options, %d users\n",
+		common.SecretPrimaryKeyID(), result.Channels, result.OAuthProviders, result.Options, result.Users)
+	if result.Failed > 0 {
+		return fmt.Errorf("%d secrets could not be decrypted with the configured master keys, see the log for details", result.Failed)
+	}
+	return nil
+}
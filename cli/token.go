@@ -0,0 +1,97 @@
+package cli
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/model"
+)
+
+func runTokenCreate(args []string) error {
+	fs := newFlagSet("token create")
+	userID := fs.Int("user-id", 0, "owner user id")
+	username := fs.String("username", "", "owner username")
+	name := fs.String("name", "cli", "token name")
+	quota := fs.Int("quota", 0, "remaining quota in quota units")
+	unlimited := fs.Bool("unlimited", false, "unlimited quota")
+	expires := fs.String("expires", "", "expiry time: unix seconds, YYYY-MM-DD, RFC3339 or a duration such as 30d; never expires when empty")
+	group := fs.String("group", "", "token group, empty uses the user's group")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if len(*name) > 50 {
+		return errors.New("token name must not exceed 50 characters")
+	}
+	if !*unlimited && *quota < 0 {
+		return errors.New("quota must not be negative")
+	}
+	user, err := findUser(*userID, *username)
+	if err != nil {
+		return err
+	}
+	expiredTime := int64(-1)
+	if *expires != "" {
+		if expiredTime, err = parseTimestamp(*expires, time.Now(), true); err != nil {
+			return err
+		}
+	}
+
+	key, err := common.GenerateKey()
+	if err != nil {
+		return err
+	}
+	now := common.GetTimestamp()
+	token := model.Token{
+		UserId:         user.Id,
+		Name:           *name,
+		Key:            key,
+		CreatedTime:    now,
+		AccessedTime:   now,
+		ExpiredTime:    expiredTime,
+		RemainQuota:    *quota,
+		UnlimitedQuota: *unlimited,
+		Group:          *group,
+	}
+	if err := token.Insert(); err != nil {
+		return err
+	}
+	fmt.Fprintf(stdout, "token %s (ID: %d) created for user %s\n", token.Name, token.Id, user.Username)
+	fmt.Fprintf(stdout, "key: sk-%s\n", key)
+	return nil
+}
+
+func runTokenRevoke(args []string) error {
+	fs := newFlagSet("token revoke")
+	id := fs.Int("id", 0, "token id")
+	key := fs.String("key", "", "token key, with or without the sk- prefix")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *id <= 0 && *key == "" {
+		return errors.New("--id or --key is required")
+	}
+	var token model.Token
+	query := model.DB
+	if *id > 0 {
+		query = query.Where("id = ?", *id)
+	} else {
+		// 令牌保存为哈希，尚未使用过的旧令牌仍为明文
+		plain := strings.TrimPrefix(*key, "sk-")
+		query = query.Where(map[string]interface{}{"key": []string{model.HashTokenKey(plain), plain}})
+	}
+	if err := query.First(&token).Error; err != nil {
+		return fmt.Errorf("token not found: %w", err)
+	}
+	if err := model.DB.Delete(&token).Error; err != nil {
+		return err
+	}
+	// 进程随即退出，同步清理缓存，避免已吊销的令牌在缓存过期前仍然可用
+	if err := model.InvalidateTokenCache(token.Key); err != nil {
+		return fmt.Errorf("token deleted but cache invalidation failed: %w", err)
+	}
+	fmt.Fprintf(stdout, "token %s (ID: %d) revoked\n", token.Name, token.Id)
+	return nil
+}
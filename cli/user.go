@@ -0,0 +1,70 @@
+package cli
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/model"
+)
+
+// findUser 按 id 或用户名查找用户
+func findUser(id int, username string) (*model.User, error) {
+	if id <= 0 && username == "" {
+		return nil, errors.New("--id or --username is required")
+	}
+	var user model.User
+	query := model.DB
+	if id > 0 {
+		query = query.Where("id = ?", id)
+	} else {
+		query = query.Where("username = ?", username)
+	}
+	if err := query.First(&user).Error; err != nil {
+		return nil, fmt.Errorf("user not found: %w", err)
+	}
+	return &user, nil
+}
+
+func runUserResetPassword(args []string) error {
+	fs := newFlagSet("user reset-password")
+	id := fs.Int("id", 0, "user id")
+	username := fs.String("username", "", "username")
+	password := fs.String("password", "", "new password (8-20 characters); a random one is generated and printed when empty")
+	enable := fs.Bool("enable", false, "also re-enable the user if it is disabled")
+	disable2FA := fs.Bool("disable-2fa", false, "also remove the user's two-factor authentication")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	user, err := findUser(*id, *username)
+	if err != nil {
+		return err
+	}
+
+	newPassword := *password
+	generated := newPassword == ""
+	if generated {
+		newPassword = common.GetRandomString(16)
+	}
+	if len(newPassword) < 8 || len(newPassword) > 20 {
+		return errors.New("password must be 8-20 characters")
+	}
+	user.Password = newPassword
+	if *enable {
+		user.Status = common.UserStatusEnabled
+	}
+	if err := user.Update(true); err != nil {
+		return err
+	}
+	if *disable2FA {
+		if err := model.DisableTwoFA(user.Id); err != nil && !errors.Is(err, model.ErrTwoFANotEnabled) {
+			return fmt.Errorf("password was reset but disabling 2FA failed: %w", err)
+		}
+	}
+
+	fmt.Fprintf(stdout, "password of user %s (ID: %d) has been reset\n", user.Username, user.Id)
+	if generated {
+		fmt.Fprintf(stdout, "new password: %s\n", newPassword)
+	}
+	return nil
+}
@@ -187,6 +187,13 @@ var RelayIdleConnTimeout int // unit is second
 var RelayMaxIdleConns int
 var RelayMaxIdleConnsPerHost int
 
+// MetricsEnabled 是否开启 Prometheus /metrics 端点，抓取时需携带 Authorization: Bearer MetricsToken
+var MetricsEnabled bool
+var MetricsToken string
+
+// TracingEnabled 是否开启 OpenTelemetry 链路追踪，导出目标等通过标准 OTEL_EXPORTER_OTLP_* 环境变量配置
+var TracingEnabled bool
+
 var GeminiSafetySetting string
 
 // https://docs.cohere.com/docs/safety-modes Type; NONE/CONTEXTUAL/STRICT
@@ -240,6 +247,11 @@ var (
 	SearchRateLimitEnable         = true
 	SearchRateLimitNum            = 10
 	SearchRateLimitDuration int64 = 60
+
+	// Per-user rate limit for count_tokens endpoints, separate from the model request rate limit
+	CountTokensRateLimitEnable         = true
+	CountTokensRateLimitNum            = 120
+	CountTokensRateLimitDuration int64 = 60
 )
 
 var RateLimitKeyExpirationDuration = 20 * time.Minute
@@ -0,0 +1,154 @@
+package common
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// FileStorage 持久化文件存储后端接口
+// 与 BodyStorage 不同，这里保存的文件在请求结束后仍然保留（例如 /v1/files 上传的文件），
+// 由调用方在文件记录删除或过期时显式调用 Delete 释放。
+type FileStorage interface {
+	// Name 后端名称，会写入文件记录，用于后续定位存储后端
+	Name() string
+	// Put 从 reader 流式写入，超过 maxBytes 时返回 ErrRequestBodyTooLarge
+	Put(reader io.Reader, maxBytes int64) (key string, size int64, err error)
+	// Open 打开已保存的文件
+	Open(key string) (io.ReadSeekCloser, error)
+	// Delete 删除已保存的文件，文件不存在时不返回错误
+	Delete(key string) error
+}
+
+const FileStorageBackendLocal = "local"
+
+var ErrFileStorageNotFound = errors.New("file storage backend not found")
+
+var (
+	fileStoragesMu  sync.RWMutex
+	fileStorages    = map[string]FileStorage{}
+	fileStorageOnce sync.Once
+)
+
+// RegisterFileStorage 注册一个文件存储后端，同名后端会被覆盖
+func RegisterFileStorage(storage FileStorage) {
+	if storage == nil {
+		return
+	}
+	fileStoragesMu.Lock()
+	defer fileStoragesMu.Unlock()
+	fileStorages[storage.Name()] = storage
+}
+
+// GetFileStorage 按名称获取文件存储后端
+func GetFileStorage(name string) (FileStorage, error) {
+	initDefaultFileStorages()
+	fileStoragesMu.RLock()
+	defer fileStoragesMu.RUnlock()
+	storage, ok := fileStorages[name]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrFileStorageNotFound, name)
+	}
+	return storage, nil
+}
+
+// GetDefaultFileStorage 获取新文件写入使用的存储后端（FILE_STORAGE_BACKEND，默认 local）
+func GetDefaultFileStorage() (FileStorage, error) {
+	return GetFileStorage(GetEnvOrDefaultString("FILE_STORAGE_BACKEND", FileStorageBackendLocal))
+}
+
+func initDefaultFileStorages() {
+	fileStorageOnce.Do(func() {
+		root := GetEnvOrDefaultString("FILE_STORAGE_PATH", "files")
+		if abs, err := filepath.Abs(root); err == nil {
+			root = abs
+		}
+		fileStoragesMu.Lock()
+		defer fileStoragesMu.Unlock()
+		if _, ok := fileStorages[FileStorageBackendLocal]; !ok {
+			fileStorages[FileStorageBackendLocal] = &localFileStorage{root: root}
+		}
+	})
+}
+
+// localFileStorage 本地磁盘存储实现，按月份分目录保存
+type localFileStorage struct {
+	root string
+}
+
+func (l *localFileStorage) Name() string {
+	return FileStorageBackendLocal
+}
+
+func (l *localFileStorage) resolve(key string) (string, error) {
+	cleaned := filepath.Clean(filepath.FromSlash(key))
+	if key == "" || filepath.IsAbs(cleaned) || cleaned == "." || strings.HasPrefix(cleaned, "..") {
+		return "", fmt.Errorf("invalid file storage key: %q", key)
+	}
+	return filepath.Join(l.root, cleaned), nil
+}
+
+func (l *localFileStorage) Put(reader io.Reader, maxBytes int64) (string, int64, error) {
+	key := fmt.Sprintf("%s/%s", time.Now().Format("200601"), uuid.New().String())
+	filePath, err := l.resolve(key)
+	if err != nil {
+		return "", 0, err
+	}
+	if err := os.MkdirAll(filepath.Dir(filePath), 0755); err != nil {
+		return "", 0, fmt.Errorf("failed to create file storage directory: %w", err)
+	}
+
+	// 先写入临时文件，完整写入后再重命名，避免中途失败留下残缺文件
+	tmpPath := filePath + ".tmp"
+	file, err := os.OpenFile(tmpPath, os.O_CREATE|os.O_WRONLY|os.O_EXCL, 0600)
+	if err != nil {
+		return "", 0, fmt.Errorf("failed to create file: %w", err)
+	}
+
+	written, err := io.Copy(file, io.LimitReader(reader, maxBytes+1))
+	if err != nil {
+		file.Close()
+		os.Remove(tmpPath)
+		return "", 0, fmt.Errorf("failed to write file: %w", err)
+	}
+	if written > maxBytes {
+		file.Close()
+		os.Remove(tmpPath)
+		return "", 0, ErrRequestBodyTooLarge
+	}
+	if err := file.Close(); err != nil {
+		os.Remove(tmpPath)
+		return "", 0, fmt.Errorf("failed to close file: %w", err)
+	}
+	if err := os.Rename(tmpPath, filePath); err != nil {
+		os.Remove(tmpPath)
+		return "", 0, fmt.Errorf("failed to persist file: %w", err)
+	}
+	return key, written, nil
+}
+
+func (l *localFileStorage) Open(key string) (io.ReadSeekCloser, error) {
+	filePath, err := l.resolve(key)
+	if err != nil {
+		return nil, err
+	}
+	return os.Open(filePath)
+}
+
+func (l *localFileStorage) Delete(key string) error {
+	filePath, err := l.resolve(key)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(filePath); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,54 @@
+package common
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestLocalFileStoragePutOpenDelete(t *testing.T) {
+	storage := &localFileStorage{root: t.TempDir()}
+
+	key, size, err := storage.Put(strings.NewReader(`{"custom_id":"1"}`), 1024)
+	require.NoError(t, err)
+	require.Equal(t, int64(17), size)
+
+	reader, err := storage.Open(key)
+	require.NoError(t, err)
+	data, err := io.ReadAll(reader)
+	require.NoError(t, err)
+	require.NoError(t, reader.Close())
+	require.Equal(t, `{"custom_id":"1"}`, string(data))
+
+	require.NoError(t, storage.Delete(key))
+	_, err = storage.Open(key)
+	require.True(t, os.IsNotExist(err))
+	// 重复删除不报错
+	require.NoError(t, storage.Delete(key))
+}
+
+func TestLocalFileStoragePutTooLarge(t *testing.T) {
+	root := t.TempDir()
+	storage := &localFileStorage{root: root}
+
+	_, _, err := storage.Put(strings.NewReader("0123456789"), 5)
+	require.ErrorIs(t, err, ErrRequestBodyTooLarge)
+
+	// 不应残留临时文件
+	matches, err := filepath.Glob(filepath.Join(root, "*", "*"))
+	require.NoError(t, err)
+	require.Empty(t, matches)
+}
+
+func TestLocalFileStorageRejectsTraversal(t *testing.T) {
+	storage := &localFileStorage{root: t.TempDir()}
+
+	for _, key := range []string{"", "../secret", "/etc/passwd", "a/../../b"} {
+		_, err := storage.Open(key)
+		require.Error(t, err, key)
+	}
+}
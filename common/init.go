@@ -25,7 +25,8 @@ func printHelp() {
 	fmt.Println("NewAPI(Based OneAPI) " + Version + " - The next-generation LLM gateway and AI asset management system supports multiple languages.")
 	fmt.Println("Original Project: OneAPI by JustSong - https://github.com/songquanpeng/one-api")
 	fmt.Println("Maintainer: QuantumNous - https://github.com/QuantumNous/new-api")
-	fmt.Println("Usage: newapi [--port <port>] [--log-dir <log directory>] [--version] [--help]")
+	fmt.Println("Usage: new-api [--port <port>] [--log-dir <log directory>] [--version] [--help]")
+	fmt.Println("       new-api <command> [flags]  (run 'new-api help' to list maintenance commands)")
 }
 
 func InitEnv() {
@@ -61,6 +62,9 @@ func InitEnv() {
 	} else {
 		CryptoSecret = SessionSecret
 	}
+	if err := InitSecretEncryption(); err != nil {
+		log.Fatal(err)
+	}
 	if os.Getenv("SQLITE_PATH") != "" {
 		SQLitePath = os.Getenv("SQLITE_PATH")
 	}
@@ -108,6 +112,10 @@ func InitEnv() {
 	RelayMaxIdleConns = GetEnvOrDefault("RELAY_MAX_IDLE_CONNS", 500)
 	RelayMaxIdleConnsPerHost = GetEnvOrDefault("RELAY_MAX_IDLE_CONNS_PER_HOST", 100)
 
+	MetricsEnabled = GetEnvOrDefaultBool("METRICS_ENABLED", false)
+	MetricsToken = GetEnvOrDefaultString("METRICS_TOKEN", "")
+	TracingEnabled = GetEnvOrDefaultBool("OTEL_TRACING_ENABLED", false)
+
 	// Initialize string variables with GetEnvOrDefaultString
 	GeminiSafetySetting = GetEnvOrDefaultString("GEMINI_SAFETY_SETTING", "BLOCK_NONE")
 	CohereSafetySetting = GetEnvOrDefaultString("COHERE_SAFETY_SETTING", "NONE")
@@ -128,6 +136,10 @@ func InitEnv() {
 	SearchRateLimitEnable = GetEnvOrDefaultBool("SEARCH_RATE_LIMIT_ENABLE", true)
 	SearchRateLimitNum = GetEnvOrDefault("SEARCH_RATE_LIMIT", 10)
 	SearchRateLimitDuration = int64(GetEnvOrDefault("SEARCH_RATE_LIMIT_DURATION", 60))
+
+	CountTokensRateLimitEnable = GetEnvOrDefaultBool("COUNT_TOKENS_RATE_LIMIT_ENABLE", true)
+	CountTokensRateLimitNum = GetEnvOrDefault("COUNT_TOKENS_RATE_LIMIT", 120)
+	CountTokensRateLimitDuration = int64(GetEnvOrDefault("COUNT_TOKENS_RATE_LIMIT_DURATION", 60))
 	initConstantEnv()
 }
 
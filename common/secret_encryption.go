@@ -0,0 +1,157 @@
+package common
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync/atomic"
+
+	"github.com/QuantumNous/new-api/pkg/envelope"
+)
+
+// secretKeyring 敏感字段的加密密钥环，未配置主密钥时为 nil，敏感字段以明文保存
+var secretKeyring atomic.Pointer[envelope.Keyring]
+
+var errSecretKeyMissing = errors.New("value is encrypted but SECRET_ENCRYPTION_KEY is not configured")
+
+// InitSecretEncryption 从环境变量加载敏感字段的主密钥：
+// SECRET_ENCRYPTION_KEY 或 SECRET_ENCRYPTION_KEY_FILE 为当前主密钥（32 字节，base64 或十六进制）；
+// 轮换时把旧主密钥放在 SECRET_ENCRYPTION_PREVIOUS_KEYS（逗号分隔）或 SECRET_ENCRYPTION_PREVIOUS_KEYS_FILE（每行一个）中，
+// 旧主密钥只用于解密
+func InitSecretEncryption() error {
+	primary, err := readSecretKeyEnv("SECRET_ENCRYPTION_KEY")
+	if err != nil {
+		return err
+	}
+	if primary == "" {
+		secretKeyring.Store(nil)
+		return nil
+	}
+	primaryKey, err := envelope.ParseKey(primary)
+	if err != nil {
+		return fmt.Errorf("SECRET_ENCRYPTION_KEY: %w", err)
+	}
+	previous, err := readSecretKeyEnv("SECRET_ENCRYPTION_PREVIOUS_KEYS")
+	if err != nil {
+		return err
+	}
+	var previousKeys [][]byte
+	for _, item := range strings.FieldsFunc(previous, func(r rune) bool { return r == ',' || r == '\n' }) {
+		if strings.TrimSpace(item) == "" {
+			continue
+		}
+		key, err := envelope.ParseKey(item)
+		if err != nil {
+			return fmt.Errorf("SECRET_ENCRYPTION_PREVIOUS_KEYS: %w", err)
+		}
+		previousKeys = append(previousKeys, key)
+	}
+	keyring, err := envelope.NewKeyring(primaryKey, previousKeys...)
+	if err != nil {
+		return err
+	}
+	secretKeyring.Store(keyring)
+	SysLog(fmt.Sprintf("secret encryption enabled, master key id %s, %d previous keys", keyring.PrimaryID(), len(previousKeys)))
+	return nil
+}
+
+// readSecretKeyEnv 读取环境变量，未设置时读取 <name>_FILE 指向的文件
+func readSecretKeyEnv(name string) (string, error) {
+	if value := strings.TrimSpace(os.Getenv(name)); value != "" {
+		return value, nil
+	}
+	path := strings.TrimSpace(os.Getenv(name + "_FILE"))
+	if path == "" {
+		return "", nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to read %s_FILE: %w", name, err)
+	}
+	return strings.TrimSpace(string(data)), nil
+}
+
+// SetSecretKeyring 替换密钥环，nil 表示关闭加密，用于测试
+func SetSecretKeyring(keyring *envelope.Keyring) {
+	secretKeyring.Store(keyring)
+}
+
+// SecretEncryptionEnabled 判断是否配置了主密钥
+func SecretEncryptionEnabled() bool {
+	return secretKeyring.Load() != nil
+}
+
+// SecretPrimaryKeyID 返回当前主密钥的标识，未开启加密时返回空字符串
+func SecretPrimaryKeyID() string {
+	if keyring := secretKeyring.Load(); keyring != nil {
+		return keyring.PrimaryID()
+	}
+	return ""
+}
+
+// EncryptSecret 加密敏感字段，未开启加密或值为空时原样返回
+func EncryptSecret(value string) (string, error) {
+	keyring := secretKeyring.Load()
+	if keyring == nil || value == "" || envelope.IsEncrypted(value) {
+		return value, nil
+	}
+	return keyring.Encrypt(value)
+}
+
+// DecryptSecret 解密敏感字段，明文原样返回
+func DecryptSecret(value string) (string, error) {
+	if !envelope.IsEncrypted(value) {
+		return value, nil
+	}
+	keyring := secretKeyring.Load()
+	if keyring == nil {
+		return "", errSecretKeyMissing
+	}
+	return keyring.Decrypt(value)
+}
+
+// SecretNeedsReencrypt 判断保存的值是否需要用当前主密钥重新加密：
+// 旧主密钥加密的值总是需要，includePlaintext 为 true 时明文也需要
+func SecretNeedsReencrypt(value string, includePlaintext bool) bool {
+	keyring := secretKeyring.Load()
+	if keyring == nil || value == "" {
+		return false
+	}
+	if !envelope.IsEncrypted(value) {
+		return includePlaintext
+	}
+	return envelope.KeyID(value) != keyring.PrimaryID()
+}
+
+// SecretLookupHash 用当前主密钥计算敏感字段的确定性摘要，保存在单独的列中用于按值检索；
+// 未开启加密或值为空时返回空字符串
+func SecretLookupHash(value string) string {
+	keyring := secretKeyring.Load()
+	if keyring == nil {
+		return ""
+	}
+	return keyring.LookupHash(value)
+}
+
+// SecretLookupHashes 返回值在所有主密钥下的摘要，检索时用于匹配轮换前写入的摘要
+func SecretLookupHashes(value string) []string {
+	keyring := secretKeyring.Load()
+	if keyring == nil {
+		return nil
+	}
+	return keyring.LookupHashes(value)
+}
+
+// ReencryptSecret 用当前主密钥重新加密保存的值
+func ReencryptSecret(value string) (string, error) {
+	plain, err := DecryptSecret(value)
+	if err != nil {
+		return "", err
+	}
+	keyring := secretKeyring.Load()
+	if keyring == nil {
+		return plain, nil
+	}
+	return keyring.Encrypt(plain)
+}
@@ -19,6 +19,10 @@ const (
 	ContextKeyTokenModelLimitEnabled ContextKey = "token_model_limit_enabled"
 	ContextKeyTokenModelLimit        ContextKey = "token_model_limit"
 	ContextKeyTokenCrossGroupRetry   ContextKey = "token_cross_group_retry"
+	ContextKeyTokenResponseCache     ContextKey = "token_response_cache"
+	ContextKeyTokenLimits            ContextKey = "token_limits"
+	ContextKeyTokenSpendReservation  ContextKey = "token_spend_reservation"
+	ContextKeyTokenRpmCounted        ContextKey = "token_rpm_counted"
 
 	/* channel related keys */
 	ContextKeyChannelId                ContextKey = "channel_id"
@@ -37,6 +41,8 @@ const (
 	ContextKeyChannelIsMultiKey        ContextKey = "channel_is_multi_key"
 	ContextKeyChannelMultiKeyIndex     ContextKey = "channel_multi_key_index"
 	ContextKeyChannelKey               ContextKey = "channel_key"
+	// ContextKeyFilePinnedChannelId 请求引用的上游文件所在渠道，重试、对冲与模型回退都不能离开该渠道
+	ContextKeyFilePinnedChannelId ContextKey = "file_pinned_channel_id"
 
 	ContextKeyAutoGroup           ContextKey = "auto_group"
 	ContextKeyAutoGroupIndex      ContextKey = "auto_group_index"
@@ -53,6 +59,8 @@ const (
 	ContextKeyUserName    ContextKey = "username"
 
 	ContextKeyLocalCountTokens ContextKey = "local_count_tokens"
+	// ContextKeyTokenizer 本地计数使用的分词器名称，记录到日志
+	ContextKeyTokenizer ContextKey = "tokenizer"
 
 	ContextKeySystemPromptOverride ContextKey = "system_prompt_override"
 
@@ -67,6 +75,28 @@ const (
 	ContextKeyLanguage ContextKey = "language"
 	ContextKeyIsStream ContextKey = "is_stream"
 
+	// ContextKeyBatchId / ContextKeyBatchDiscountRatio are set when a request is
+	// executed locally on behalf of a /v1/batches job, so billing can apply the
+	// batch discount and the consume log can reference the batch.
+	ContextKeyBatchId            ContextKey = "batch_id"
+	ContextKeyBatchDiscountRatio ContextKey = "batch_discount_ratio"
+
+	// ContextKeyResponseCacheKey is set when the chat completion is eligible for
+	// the response cache; ContextKeyResponseCacheHitRatio is set on a cache hit so
+	// billing applies the hit ratio, and ContextKeyResponseCacheUsage carries the
+	// upstream usage of a miss so it can be stored with the cached response.
+	ContextKeyResponseCacheKey      ContextKey = "response_cache_key"
+	ContextKeyResponseCacheHitRatio ContextKey = "response_cache_hit_ratio"
+	ContextKeyResponseCacheUsage    ContextKey = "response_cache_usage"
+
+	// ContextKeyShadowPrimaryUsage holds a *dto.Usage that receives the upstream
+	// usage of a request sampled for shadow traffic, for the shadow comparison log.
+	ContextKeyShadowPrimaryUsage ContextKey = "shadow_primary_usage"
+
+	// ContextKeyPayloadCapture holds the *service.PayloadCapture of a request
+	// whose request/response bodies may be retained for later inspection.
+	ContextKeyPayloadCapture ContextKey = "payload_capture"
+
 	// ContextKeyAuditLogged marks that the current request has already recorded
 	// a manage/operation audit log inside the handler. When set, the admin-audit
 	// fallback in authHelper (finishAdminAudit) skips its record to avoid
@@ -29,6 +29,8 @@ var auditContentTemplates = map[string]string{
 	"user.passkey_delete":   "Deleted a passkey",
 	"user.reset_passkey":    "Reset the user passkey",
 	"option.update":         "Updated system setting ${key}",
+	"config.export":         "Exported instance configuration (${format}, keys: ${keys})",
+	"config.apply":          "Applied configuration document (created ${created}, updated ${updated}, deleted ${deleted})",
 
 	"channel.create":             "Created channel ${name} (type ${type}, count ${count})",
 	"channel.update":             "Updated channel ${name} (ID: ${id})",
@@ -44,8 +46,16 @@ var auditContentTemplates = map[string]string{
 	"channel.multi_key_manage":   "Multi-key management ${action} on channel (ID: ${id})",
 	"channel.upstream_apply":     "Applied upstream model changes to channel (ID: ${id})",
 	"channel.upstream_apply_all": "Applied upstream model changes to ${count} channels",
+	"channel.breaker_reset":      "Reset ${count} circuit breakers on channel (ID: ${id})",
+
+	"authz.role_create":       "Created authorization role ${name} (${key})",
+	"authz.role_update":       "Updated authorization role ${name} (${key})",
+	"authz.role_delete":       "Deleted authorization role ${key}",
+	"authz.user_roles_update": "Set authorization roles of user ${username} (ID: ${id}) to ${roles}",
 
 	"redemption.create": "Created ${count} redemption codes named ${name} (${quota} each)",
+
+	"organization.quota_adjust": "Adjusted organization quota by ${quota} (ID: ${id})",
 }
 
 // auditContentEN 按 action 模板渲染英文兜底文本；未登记的 action 退回 action 本身。
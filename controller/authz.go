@@ -2,7 +2,12 @@ package controller
 
 import (
 	"net/http"
+	"strconv"
+	"strings"
 
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/i18n"
+	"github.com/QuantumNous/new-api/model"
 	"github.com/QuantumNous/new-api/service/authz"
 
 	"github.com/gin-gonic/gin"
@@ -22,3 +27,140 @@ func GetPermissionCatalog(c *gin.Context) {
 		},
 	})
 }
+
+// ListAuthzRoles returns the built-in and custom roles with their grants.
+func ListAuthzRoles(c *gin.Context) {
+	common.ApiSuccess(c, authz.Roles())
+}
+
+// CreateAuthzRole defines a custom role that can then be assigned to admins.
+func CreateAuthzRole(c *gin.Context) {
+	var input authz.RoleInput
+	if err := common.DecodeJson(c.Request.Body, &input); err != nil {
+		common.ApiErrorI18n(c, i18n.MsgInvalidParams)
+		return
+	}
+	role, err := authz.CreateRole(input)
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	recordManageAudit(c, "authz.role_create", map[string]interface{}{
+		"key":  role.Key,
+		"name": role.Name,
+	})
+	common.ApiSuccess(c, role)
+}
+
+// UpdateAuthzRole replaces the metadata and grants of a custom role.
+func UpdateAuthzRole(c *gin.Context) {
+	var input authz.RoleInput
+	if err := common.DecodeJson(c.Request.Body, &input); err != nil {
+		common.ApiErrorI18n(c, i18n.MsgInvalidParams)
+		return
+	}
+	role, err := authz.UpdateRole(c.Param("key"), input)
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	recordManageAudit(c, "authz.role_update", map[string]interface{}{
+		"key":  role.Key,
+		"name": role.Name,
+	})
+	common.ApiSuccess(c, role)
+}
+
+// DeleteAuthzRole removes a custom role and unassigns it from every user.
+func DeleteAuthzRole(c *gin.Context) {
+	key := c.Param("key")
+	if err := authz.DeleteRole(key); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	recordManageAudit(c, "authz.role_delete", map[string]interface{}{
+		"key": key,
+	})
+	common.ApiSuccess(c, nil)
+}
+
+// GetUserAuthzRoles returns the custom roles assigned to a user.
+func GetUserAuthzRoles(c *gin.Context) {
+	userID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		common.ApiErrorI18n(c, i18n.MsgInvalidParams)
+		return
+	}
+	common.ApiSuccess(c, authz.UserRoles(userID))
+}
+
+// SetUserAuthzRoles replaces the custom roles assigned to an admin. Assigned
+// roles replace the built-in admin baseline for that user.
+func SetUserAuthzRoles(c *gin.Context) {
+	userID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		common.ApiErrorI18n(c, i18n.MsgInvalidParams)
+		return
+	}
+	var req struct {
+		Roles []string `json:"roles"`
+	}
+	if err := common.DecodeJson(c.Request.Body, &req); err != nil {
+		common.ApiErrorI18n(c, i18n.MsgInvalidParams)
+		return
+	}
+	user, err := model.GetUserById(userID, false)
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	if len(req.Roles) > 0 && (user.Role < common.RoleAdminUser || user.Role >= common.RoleRootUser) {
+		common.ApiErrorMsg(c, "custom roles can only be assigned to admin users")
+		return
+	}
+	if err := authz.SetUserRoles(userID, req.Roles); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	recordManageAuditFor(c, userID, "authz.user_roles_update", map[string]interface{}{
+		"username": user.Username,
+		"id":       userID,
+		"roles":    strings.Join(req.Roles, ","),
+	})
+	common.ApiSuccess(c, authz.UserRoles(userID))
+}
+
+// ExplainPermission reports whether a user holds a permission and which rule
+// decided it. Query: user_id (defaults to the caller; only root may inspect
+// other users), resource, action and an optional scope such as "tag:team-a".
+func ExplainPermission(c *gin.Context) {
+	userID := c.GetInt("id")
+	if raw := c.Query("user_id"); raw != "" {
+		id, err := strconv.Atoi(raw)
+		if err != nil {
+			common.ApiErrorI18n(c, i18n.MsgInvalidParams)
+			return
+		}
+		if id != userID && c.GetInt("role") < common.RoleRootUser {
+			common.ApiErrorI18n(c, i18n.MsgAuthInsufficientPrivilege)
+			return
+		}
+		userID = id
+	}
+	user, err := model.GetUserById(userID, false)
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	permission := authz.Permission{Resource: c.Query("resource"), Action: c.Query("action")}
+	var scopes []authz.Scope
+	if raw := c.Query("scope"); raw != "" {
+		scope, ok := authz.ParseScope(raw)
+		if !ok {
+			common.ApiErrorI18n(c, i18n.MsgInvalidParams)
+			return
+		}
+		scopes = append(scopes, scope)
+	}
+	common.ApiSuccess(c, authz.Explain(user.Id, user.Role, permission, scopes...))
+}
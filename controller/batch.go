@@ -0,0 +1,203 @@
+package controller
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/constant"
+	"github.com/QuantumNous/new-api/dto"
+	"github.com/QuantumNous/new-api/logger"
+	"github.com/QuantumNous/new-api/model"
+	"github.com/QuantumNous/new-api/service"
+	"github.com/QuantumNous/new-api/setting/operation_setting"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+const (
+	batchListDefaultLimit = 20
+	batchListMaxLimit     = 100
+	// OpenAI 目前只支持 24h 的完成窗口
+	batchCompletionWindow        = "24h"
+	batchCompletionWindowSeconds = 24 * 60 * 60
+	batchMetadataMaxKeys         = 16
+	batchInputFilePurpose        = "batch"
+)
+
+func checkBatchApiEnabled(c *gin.Context) bool {
+	if !operation_setting.GetBatchSetting().Enabled {
+		openAIApiError(c, http.StatusNotImplemented, "new_api_error", "api_not_implemented", "Batch API is disabled")
+		return false
+	}
+	return true
+}
+
+func getUserBatchOrAbort(c *gin.Context) *model.Batch {
+	batchId := c.Param("id")
+	batch, err := model.GetUserBatchById(c.GetInt("id"), batchId)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			openAIApiError(c, http.StatusNotFound, "invalid_request_error", "batch_not_found", fmt.Sprintf("No such Batch object: %s", batchId))
+			return nil
+		}
+		logger.LogError(c.Request.Context(), fmt.Sprintf("failed to query batch %s: %s", batchId, err.Error()))
+		openAIApiError(c, http.StatusInternalServerError, "server_error", "", "Failed to query batch")
+		return nil
+	}
+	return batch
+}
+
+// CreateBatch POST /v1/batches
+// 仅做参数校验并入库，输入文件的逐行校验与执行由后台 batch_run 系统任务完成
+func CreateBatch(c *gin.Context) {
+	if !checkBatchApiEnabled(c) {
+		return
+	}
+	var req dto.OpenAIBatchRequest
+	if err := common.UnmarshalBodyReusable(c, &req); err != nil {
+		openAIApiError(c, http.StatusBadRequest, "invalid_request_error", "invalid_request", "Invalid request body: "+err.Error())
+		return
+	}
+	if req.InputFileId == "" {
+		openAIApiError(c, http.StatusBadRequest, "invalid_request_error", "invalid_request", "Missing required parameter: 'input_file_id'")
+		return
+	}
+	if _, ok := service.BatchEndpointRelayFormats[req.Endpoint]; !ok {
+		openAIApiError(c, http.StatusBadRequest, "invalid_request_error", "invalid_request", fmt.Sprintf("Invalid value for 'endpoint': '%s'", req.Endpoint))
+		return
+	}
+	if req.CompletionWindow != batchCompletionWindow {
+		openAIApiError(c, http.StatusBadRequest, "invalid_request_error", "invalid_request", fmt.Sprintf("Invalid value for 'completion_window': '%s'", req.CompletionWindow))
+		return
+	}
+	if len(req.Metadata) > batchMetadataMaxKeys {
+		openAIApiError(c, http.StatusBadRequest, "invalid_request_error", "invalid_request", fmt.Sprintf("Invalid 'metadata': at most %d keys are allowed", batchMetadataMaxKeys))
+		return
+	}
+
+	userId := c.GetInt("id")
+	file, err := model.GetUserFileById(userId, req.InputFileId)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			openAIApiError(c, http.StatusBadRequest, "invalid_request_error", "invalid_request", fmt.Sprintf("No such File object: %s", req.InputFileId))
+			return
+		}
+		logger.LogError(c.Request.Context(), fmt.Sprintf("failed to query file %s: %s", req.InputFileId, err.Error()))
+		openAIApiError(c, http.StatusInternalServerError, "server_error", "", "Failed to query input file")
+		return
+	}
+	if file.Purpose != batchInputFilePurpose {
+		openAIApiError(c, http.StatusBadRequest, "invalid_request_error", "invalid_request", fmt.Sprintf("File %s must have purpose 'batch'", req.InputFileId))
+		return
+	}
+
+	now := common.GetTimestamp()
+	batch := &model.Batch{
+		BatchId:          model.GenerateBatchID(),
+		UserId:           userId,
+		TokenId:          c.GetInt("token_id"),
+		Group:            common.GetContextKeyString(c, constant.ContextKeyUsingGroup),
+		Endpoint:         req.Endpoint,
+		CompletionWindow: req.CompletionWindow,
+		Mode:             model.BatchModeLocal,
+		InputFileId:      file.FileId,
+		Status:           model.BatchStatusValidating,
+		CreatedAt:        now,
+		ExpiresAt:        now + batchCompletionWindowSeconds,
+	}
+	if len(req.Metadata) > 0 {
+		metadata, err := common.Marshal(req.Metadata)
+		if err != nil {
+			openAIApiError(c, http.StatusBadRequest, "invalid_request_error", "invalid_request", "Invalid 'metadata'")
+			return
+		}
+		batch.Metadata = string(metadata)
+	}
+	if err := batch.Insert(); err != nil {
+		logger.LogError(c.Request.Context(), "failed to save batch: "+err.Error())
+		openAIApiError(c, http.StatusInternalServerError, "server_error", "", "Failed to create batch")
+		return
+	}
+	c.JSON(http.StatusOK, service.ToOpenAIBatch(batch))
+}
+
+// RetrieveBatch GET /v1/batches/:id
+func RetrieveBatch(c *gin.Context) {
+	if !checkBatchApiEnabled(c) {
+		return
+	}
+	batch := getUserBatchOrAbort(c)
+	if batch == nil {
+		return
+	}
+	c.JSON(http.StatusOK, service.ToOpenAIBatch(batch))
+}
+
+// CancelBatch POST /v1/batches/:id/cancel
+// 只标记为 cancelling，正在执行的请求完成后由后台任务置为 cancelled
+func CancelBatch(c *gin.Context) {
+	if !checkBatchApiEnabled(c) {
+		return
+	}
+	batch := getUserBatchOrAbort(c)
+	if batch == nil {
+		return
+	}
+	if batch.Status == model.BatchStatusCancelling || batch.Status == model.BatchStatusCancelled {
+		c.JSON(http.StatusOK, service.ToOpenAIBatch(batch))
+		return
+	}
+	ok, err := batch.RequestCancel()
+	if err != nil {
+		logger.LogError(c.Request.Context(), fmt.Sprintf("failed to cancel batch %s: %s", batch.BatchId, err.Error()))
+		openAIApiError(c, http.StatusInternalServerError, "server_error", "", "Failed to cancel batch")
+		return
+	}
+	if !ok {
+		openAIApiError(c, http.StatusConflict, "invalid_request_error", "invalid_request",
+			fmt.Sprintf("Cannot cancel a batch with status '%s'", batch.Status))
+		return
+	}
+	c.JSON(http.StatusOK, service.ToOpenAIBatch(batch))
+}
+
+// ListBatches GET /v1/batches
+func ListBatches(c *gin.Context) {
+	if !checkBatchApiEnabled(c) {
+		return
+	}
+	limit, _ := strconv.Atoi(c.Query("limit"))
+	if limit <= 0 {
+		limit = batchListDefaultLimit
+	}
+	if limit > batchListMaxLimit {
+		limit = batchListMaxLimit
+	}
+	// 多查询一条用于判断 has_more
+	batches, err := model.GetUserBatches(c.GetInt("id"), c.Query("after"), limit+1)
+	if err != nil {
+		logger.LogError(c.Request.Context(), "failed to list batches: "+err.Error())
+		openAIApiError(c, http.StatusInternalServerError, "server_error", "", "Failed to list batches")
+		return
+	}
+	resp := dto.OpenAIBatchList{
+		Object: "list",
+		Data:   make([]*dto.OpenAIBatch, 0, len(batches)),
+	}
+	if len(batches) > limit {
+		batches = batches[:limit]
+		resp.HasMore = true
+	}
+	for _, batch := range batches {
+		resp.Data = append(resp.Data, service.ToOpenAIBatch(batch))
+	}
+	if len(resp.Data) > 0 {
+		resp.FirstId = resp.Data[0].Id
+		resp.LastId = resp.Data[len(resp.Data)-1].Id
+	}
+	c.JSON(http.StatusOK, resp)
+}
@@ -0,0 +1,1081 @@
+package controller
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/constant"
+	"github.com/QuantumNous/new-api/dto"
+	"github.com/QuantumNous/new-api/logger"
+	"github.com/QuantumNous/new-api/middleware"
+	"github.com/QuantumNous/new-api/model"
+	relaycommon "github.com/QuantumNous/new-api/relay/common"
+	"github.com/QuantumNous/new-api/relay/helper"
+	"github.com/QuantumNous/new-api/service"
+	"github.com/QuantumNous/new-api/setting/operation_setting"
+	"github.com/QuantumNous/new-api/types"
+
+	"github.com/gin-gonic/gin"
+	"github.com/tidwall/gjson"
+)
+
+const (
+	// 每轮系统任务中单个批处理的最长执行时间，超时后保存进度，下一轮继续
+	batchRunBudget        = 2 * time.Minute
+	batchActiveFetchLimit = 20
+	// 本地执行时每累计多少行保存一次结果分段
+	batchCheckpointLines = 200
+	// 系统负载过高时暂缓执行的等待间隔
+	batchOverloadWait = 5 * time.Second
+)
+
+// errBatchPause 用于中断输入文件的读取，本轮执行到此为止
+var errBatchPause = errors.New("batch paused")
+
+// runBatchTasksOnce 推进所有未结束的批处理：校验输入文件、本地执行或轮询上游、汇总结果
+func runBatchTasksOnce(ctx context.Context, report func(processed, total int)) map[string]any {
+	batches, err := model.GetActiveBatches(batchActiveFetchLimit)
+	if err != nil {
+		common.SysLog("failed to get active batches: " + err.Error())
+		return map[string]any{"error": err.Error()}
+	}
+	failed := 0
+	for i, batch := range batches {
+		if ctx.Err() != nil {
+			break
+		}
+		if err := advanceBatch(ctx, batch); err != nil {
+			failed++
+			logger.LogError(ctx, fmt.Sprintf("failed to advance batch %s: %s", batch.BatchId, err.Error()))
+		}
+		report(i+1, len(batches))
+	}
+	return map[string]any{"batches": len(batches), "failed": failed}
+}
+
+func advanceBatch(ctx context.Context, batch *model.Batch) error {
+	if batch.Status == model.BatchStatusValidating {
+		return validateBatch(ctx, batch)
+	}
+	if batch.Mode == model.BatchModeUpstream {
+		return pollUpstreamBatch(ctx, batch)
+	}
+	if batch.Status == model.BatchStatusFinalizing {
+		return finalizeLocalBatch(ctx, batch)
+	}
+	return runLocalBatch(ctx, batch)
+}
+
+func failBatch(batch *model.Batch, fromStatus string, errs []dto.OpenAIBatchError) error {
+	batch.Status = model.BatchStatusFailed
+	batch.FailedAt = common.GetTimestamp()
+	service.SetBatchErrors(batch, errs)
+	_, err := batch.UpdateWithStatus(fromStatus)
+	return err
+}
+
+func validateBatch(ctx context.Context, batch *model.Batch) error {
+	file, err := model.GetUserFileById(batch.UserId, batch.InputFileId)
+	if err != nil {
+		return failBatch(batch, model.BatchStatusValidating, []dto.OpenAIBatchError{{
+			Code:    "invalid_request",
+			Message: fmt.Sprintf("Input file %s is not available", batch.InputFileId),
+		}})
+	}
+	batchSetting := operation_setting.GetBatchSetting()
+	total, lineErrors, err := service.ValidateBatchInputFile(ctx, file, batch.Endpoint, batchSetting.MaxRequestsPerBatch)
+	if err != nil {
+		return err
+	}
+	batch.TotalCount = total
+	if len(lineErrors) > 0 {
+		return failBatch(batch, model.BatchStatusValidating, lineErrors)
+	}
+
+	forwarded := batchSetting.ForwardUpstream && forwardBatchUpstream(ctx, batch, file)
+	batch.Status = model.BatchStatusInProgress
+	batch.InProgressAt = common.GetTimestamp()
+	ok, err := batch.UpdateWithStatus(model.BatchStatusValidating)
+	if err != nil {
+		return err
+	}
+	if !ok && forwarded {
+		// 校验期间已被取消，撤销刚创建的上游批处理
+		if channel, err := model.CacheGetChannel(batch.ChannelId); err == nil {
+			_, _ = service.CancelUpstreamBatch(ctx, channel, batch.UpstreamBatchId)
+		}
+	}
+	return nil
+}
+
+// forwardBatchUpstream 尝试将批处理整体转发到支持 batch 的上游渠道，失败或余额不足以覆盖预估费用时回退为本地执行
+func forwardBatchUpstream(ctx context.Context, batch *model.Batch, file *model.File) bool {
+	c, _ := newBatchGinContext(ctx, http.MethodPost, "/v1/batches", nil)
+	c.Set("id", batch.UserId)
+	channel, err := service.PinFileToChannel(c, file, batch.Group)
+	if err != nil || !service.IsBatchCapableChannel(channel) {
+		if err != nil {
+			logger.LogWarn(ctx, fmt.Sprintf("batch %s falls back to local execution: %s", batch.BatchId, err.Error()))
+		}
+		return false
+	}
+	if err := checkUpstreamBatchBudget(ctx, batch, file, channel); err != nil {
+		logger.LogWarn(ctx, fmt.Sprintf("batch %s falls back to local execution: %s", batch.BatchId, err.Error()))
+		return false
+	}
+	upstream, err := service.CreateUpstreamBatch(ctx, channel, file.UpstreamFileId, batch)
+	if err != nil {
+		logger.LogWarn(ctx, fmt.Sprintf("batch %s falls back to local execution: %s", batch.BatchId, err.Error()))
+		return false
+	}
+	batch.Mode = model.BatchModeUpstream
+	batch.ChannelId = channel.Id
+	batch.UpstreamBatchId = upstream.Id
+	return true
+}
+
+func newBatchGinContext(ctx context.Context, method string, path string, body []byte) (*gin.Context, *httptest.ResponseRecorder) {
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	requestId := common.NewRequestId()
+	ctx = context.WithValue(ctx, common.RequestIdKey, requestId)
+	c.Request = httptest.NewRequestWithContext(ctx, method, path, bytes.NewReader(body))
+	c.Request.Header.Set("Content-Type", "application/json")
+	c.Set(common.RequestIdKey, requestId)
+	return c, w
+}
+
+// batchAuth 以创建批处理时使用的令牌身份执行请求，令牌状态与 TokenAuth 的校验保持一致
+type batchAuth struct {
+	token *model.Token
+	user  *model.UserBase
+}
+
+func loadBatchAuth(batch *model.Batch) (*batchAuth, error) {
+	token, err := model.GetTokenById(batch.TokenId)
+	if err != nil || token.UserId != batch.UserId {
+		return nil, errors.New("the API key used to create this batch is no longer available")
+	}
+	if token.Status != common.TokenStatusEnabled {
+		return nil, errors.New("the API key used to create this batch is disabled")
+	}
+	if token.ExpiredTime != -1 && token.ExpiredTime < common.GetTimestamp() {
+		return nil, errors.New("the API key used to create this batch has expired")
+	}
+	if !token.UnlimitedQuota && token.RemainQuota <= 0 {
+		return nil, errors.New("the API key used to create this batch has no remaining quota")
+	}
+	userCache, err := model.GetUserCache(batch.UserId)
+	if err != nil {
+		return nil, err
+	}
+	if userCache.Status != common.UserStatusEnabled {
+		return nil, errors.New("user is disabled")
+	}
+	return &batchAuth{token: token, user: userCache}, nil
+}
+
+func (auth *batchAuth) setup(c *gin.Context, batch *model.Batch) error {
+	auth.user.WriteContext(c)
+	common.SetContextKey(c, constant.ContextKeyUsingGroup, batch.Group)
+	if err := middleware.SetupContextForToken(c, auth.token); err != nil {
+		return err
+	}
+	common.SetContextKey(c, constant.ContextKeyBatchId, batch.BatchId)
+	common.SetContextKey(c, constant.ContextKeyBatchDiscountRatio, operation_setting.GetBatchDiscountRatio())
+	return nil
+}
+
+func newBatchRequestId() string {
+	key, _ := common.GenerateRandomCharsKey(24)
+	return "batch_req_" + key
+}
+
+func newBatchErrorLine(customId string, code string, message string) *dto.OpenAIBatchOutputLine {
+	return &dto.OpenAIBatchOutputLine{
+		Id:       newBatchRequestId(),
+		CustomId: customId,
+		Error:    &dto.OpenAIBatchError{Code: code, Message: message},
+	}
+}
+
+// batchLineExecutor 执行单行请求，测试中替换
+var batchLineExecutor = executeBatchLine
+
+// executeBatchLine 以内部请求的方式走完整的 Distribute + Relay 流程执行一行，
+// 计费、日志、重试与普通请求一致，仅额外叠加 batch 折扣
+func executeBatchLine(ctx context.Context, batch *model.Batch, auth *batchAuth, format types.RelayFormat, input *dto.OpenAIBatchInputLine) *dto.OpenAIBatchOutputLine {
+	c, w := newBatchGinContext(ctx, http.MethodPost, input.Url, input.Body)
+	defer func() {
+		common.CleanupBodyStorage(c)
+		service.CleanupFileSources(c)
+	}()
+	if err := auth.setup(c, batch); err != nil {
+		return newBatchErrorLine(input.CustomId, "invalid_api_key", err.Error())
+	}
+	middleware.Distribute()(c)
+	if !c.IsAborted() {
+		Relay(c, format)
+	}
+
+	body := w.Body.Bytes()
+	if !json.Valid(body) {
+		body, _ = common.Marshal(string(body))
+	}
+	return &dto.OpenAIBatchOutputLine{
+		Id:       newBatchRequestId(),
+		CustomId: input.CustomId,
+		Response: &dto.OpenAIBatchOutputResponse{
+			StatusCode: w.Code,
+			RequestId:  c.GetString(common.RequestIdKey),
+			Body:       body,
+		},
+	}
+}
+
+// batchSegmentWriter 将结果行写入临时文件，checkpoint 时保存为存储中的一个分段
+type batchSegmentWriter struct {
+	file  *os.File
+	lines int
+}
+
+func (w *batchSegmentWriter) write(line *dto.OpenAIBatchOutputLine) error {
+	if w.file == nil {
+		file, err := os.CreateTemp("", "batch-*.jsonl")
+		if err != nil {
+			return err
+		}
+		w.file = file
+	}
+	data, err := common.Marshal(line)
+	if err != nil {
+		return err
+	}
+	if _, err := w.file.Write(append(data, '\n')); err != nil {
+		return err
+	}
+	w.lines++
+	return nil
+}
+
+// flush 保存已写入的行并返回分段的存储 key，没有内容时返回空字符串
+func (w *batchSegmentWriter) flush() (string, error) {
+	if w.file == nil || w.lines == 0 {
+		return "", nil
+	}
+	defer w.close()
+	storage, err := common.GetDefaultFileStorage()
+	if err != nil {
+		return "", err
+	}
+	if _, err := w.file.Seek(0, io.SeekStart); err != nil {
+		return "", err
+	}
+	key, _, err := storage.Put(w.file, 1<<40)
+	return key, err
+}
+
+// reader 返回已写入内容的读取器，没有写入时返回 nil
+func (w *batchSegmentWriter) reader() (io.Reader, error) {
+	if w.file == nil {
+		return nil, nil
+	}
+	if _, err := w.file.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+	return w.file, nil
+}
+
+func (w *batchSegmentWriter) close() {
+	if w.file == nil {
+		return
+	}
+	name := w.file.Name()
+	_ = w.file.Close()
+	_ = os.Remove(name)
+	w.file = nil
+	w.lines = 0
+}
+
+// localBatchRun 记录一轮本地执行中尚未保存的结果
+type localBatchRun struct {
+	batch     *model.Batch
+	output    batchSegmentWriter
+	errors    batchSegmentWriter
+	processed int
+	completed int
+	failed    int
+}
+
+func (run *localBatchRun) record(line *dto.OpenAIBatchOutputLine) error {
+	run.processed++
+	if line.Response != nil && line.Response.StatusCode == http.StatusOK {
+		run.completed++
+		return run.output.write(line)
+	}
+	run.failed++
+	return run.errors.write(line)
+}
+
+// checkpoint 保存结果分段并持久化进度，进度之前的单行结果随后删除
+func (run *localBatchRun) checkpoint() error {
+	if run.processed == 0 {
+		return nil
+	}
+	outputKey, err := run.output.flush()
+	if err != nil {
+		return err
+	}
+	errorKey, err := run.errors.flush()
+	if err != nil {
+		return err
+	}
+	batch := run.batch
+	if outputKey != "" {
+		batch.OutputSegments = service.AppendBatchSegment(batch.OutputSegments, outputKey)
+	}
+	if errorKey != "" {
+		batch.ErrorSegments = service.AppendBatchSegment(batch.ErrorSegments, errorKey)
+	}
+	batch.ProcessedCount += run.processed
+	batch.CompletedCount += run.completed
+	batch.FailedCount += run.failed
+	run.processed, run.completed, run.failed = 0, 0, 0
+	if err := batch.SaveProgress(); err != nil {
+		return err
+	}
+	if err := model.DeleteBatchLineResults(batch.Id, batch.ProcessedCount); err != nil {
+		common.SysError(fmt.Sprintf("failed to delete line results of batch %s: %s", batch.BatchId, err.Error()))
+	}
+	return nil
+}
+
+// batchWindowLine 执行窗口中的一行，result 不为空时为中断前已经执行过的结果，不再重新执行
+type batchWindowLine struct {
+	line   int
+	input  *dto.OpenAIBatchInputLine
+	result *dto.OpenAIBatchOutputLine
+}
+
+// saveBatchLineResult 一行执行完（已经计费）立即保存结果，中断后不会重新执行这一行
+func saveBatchLineResult(ctx context.Context, batch *model.Batch, line int, result *dto.OpenAIBatchOutputLine) {
+	data, err := common.Marshal(result)
+	if err == nil {
+		err = model.SaveBatchLineResult(batch.Id, line, string(data))
+	}
+	if err != nil {
+		logger.LogError(ctx, fmt.Sprintf("failed to save result of batch %s line %d: %s", batch.BatchId, line, err.Error()))
+	}
+}
+
+// loadBatchLineResults 读取进度之后已经执行过的行的结果
+func loadBatchLineResults(batch *model.Batch) (map[int]*dto.OpenAIBatchOutputLine, error) {
+	stored, err := model.GetBatchLineResults(batch.Id, batch.ProcessedCount)
+	if err != nil {
+		return nil, err
+	}
+	results := make(map[int]*dto.OpenAIBatchOutputLine, len(stored))
+	for line, data := range stored {
+		var result dto.OpenAIBatchOutputLine
+		if err := common.UnmarshalJsonStr(data, &result); err != nil {
+			common.SysError(fmt.Sprintf("invalid stored result of batch %s line %d: %s", batch.BatchId, line, err.Error()))
+			continue
+		}
+		results[line] = &result
+	}
+	return results, nil
+}
+
+func (run *localBatchRun) close() {
+	run.output.close()
+	run.errors.close()
+}
+
+// waitBatchRunnable 在每个执行窗口前检查是否应继续：任务取消、本轮时间用尽、批处理被取消或过期时返回 false；
+// 系统负载过高时等待，把资源让给实时请求
+func waitBatchRunnable(ctx context.Context, batch *model.Batch, deadline time.Time) bool {
+	for {
+		if ctx.Err() != nil || time.Now().After(deadline) {
+			return false
+		}
+		if common.GetTimestamp() > batch.ExpiresAt {
+			return false
+		}
+		status, err := model.GetBatchStatus(batch.Id)
+		if err != nil || status != model.BatchStatusInProgress {
+			if status == model.BatchStatusCancelling {
+				batch.Status = status
+			}
+			return false
+		}
+		if !middleware.IsSystemOverloaded() {
+			return true
+		}
+		select {
+		case <-ctx.Done():
+			return false
+		case <-time.After(batchOverloadWait):
+		}
+	}
+}
+
+// runLocalBatch 从上次的进度继续，按配置的并发数逐窗口执行输入文件中的请求
+func runLocalBatch(ctx context.Context, batch *model.Batch) error {
+	if batch.Status == model.BatchStatusCancelling || common.GetTimestamp() > batch.ExpiresAt || batch.ProcessedCount >= batch.TotalCount {
+		return finalizeLocalBatch(ctx, batch)
+	}
+	file, err := model.GetUserFileById(batch.UserId, batch.InputFileId)
+	if err != nil {
+		return err
+	}
+	content, err := service.OpenFileContent(ctx, file)
+	if err != nil {
+		return err
+	}
+	defer content.Close()
+
+	auth, authErr := loadBatchAuth(batch)
+	format := service.BatchEndpointRelayFormats[batch.Endpoint]
+	concurrency := operation_setting.GetBatchSetting().Concurrency
+	if concurrency <= 0 {
+		concurrency = 1
+	}
+	deadline := time.Now().Add(batchRunBudget)
+
+	executed, err := loadBatchLineResults(batch)
+	if err != nil {
+		return err
+	}
+
+	run := &localBatchRun{batch: batch}
+	defer run.close()
+
+	var window []batchWindowLine
+	executeWindow := func() error {
+		if ctx.Err() != nil {
+			// 尚未开始执行，下一轮重新执行本窗口
+			window = window[:0]
+			return ctx.Err()
+		}
+		results := make([]*dto.OpenAIBatchOutputLine, len(window))
+		var wg sync.WaitGroup
+		for i, item := range window {
+			if item.result != nil {
+				results[i] = item.result
+				continue
+			}
+			if authErr != nil {
+				results[i] = newBatchErrorLine(item.input.CustomId, "invalid_api_key", authErr.Error())
+				continue
+			}
+			wg.Add(1)
+			go func(i int, item batchWindowLine) {
+				defer wg.Done()
+				results[i] = batchLineExecutor(ctx, batch, auth, format, item.input)
+				saveBatchLineResult(ctx, batch, item.line, results[i])
+			}(i, item)
+		}
+		wg.Wait()
+		window = window[:0]
+		// 已经发出的请求都已结算，即使任务在执行中被中断也要记录结果，不能在下一轮重新执行
+		for _, result := range results {
+			if err := run.record(result); err != nil {
+				return err
+			}
+		}
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if run.processed >= batchCheckpointLines {
+			return run.checkpoint()
+		}
+		return nil
+	}
+
+	index := 0
+	err = service.ReadBatchInputLines(content, func(line int, data []byte) error {
+		index++
+		if index <= batch.ProcessedCount {
+			return nil
+		}
+		if len(window) == 0 && !waitBatchRunnable(ctx, batch, deadline) {
+			return errBatchPause
+		}
+		if result, ok := executed[index]; ok {
+			window = append(window, batchWindowLine{line: index, result: result})
+			if len(window) >= concurrency {
+				return executeWindow()
+			}
+			return nil
+		}
+		input, err := service.ParseBatchInputLine(data, batch.Endpoint)
+		if err != nil {
+			// 创建时已校验，正常不会出现
+			input = &dto.OpenAIBatchInputLine{CustomId: gjson.GetBytes(data, "custom_id").String()}
+			if err := run.record(newBatchErrorLine(input.CustomId, "invalid_request", err.Error())); err != nil {
+				return err
+			}
+			return nil
+		}
+		window = append(window, batchWindowLine{line: index, input: input})
+		if len(window) >= concurrency {
+			return executeWindow()
+		}
+		return nil
+	})
+	if err == nil && len(window) > 0 {
+		err = executeWindow()
+	}
+	if err != nil && !errors.Is(err, errBatchPause) {
+		_ = run.checkpoint()
+		return err
+	}
+	if err := run.checkpoint(); err != nil {
+		return err
+	}
+	if batch.Status == model.BatchStatusCancelling || common.GetTimestamp() > batch.ExpiresAt || batch.ProcessedCount >= batch.TotalCount {
+		return finalizeLocalBatch(ctx, batch)
+	}
+	return nil
+}
+
+// writeExpiredBatchLines 将过期时尚未执行的请求写入错误分段，返回写入的行数，executed 中已执行过的行跳过
+func writeExpiredBatchLines(ctx context.Context, batch *model.Batch, executed map[int]*dto.OpenAIBatchOutputLine, writer *batchSegmentWriter) (int, error) {
+	file, err := model.GetUserFileById(batch.UserId, batch.InputFileId)
+	if err != nil {
+		return 0, err
+	}
+	content, err := service.OpenFileContent(ctx, file)
+	if err != nil {
+		return 0, err
+	}
+	defer content.Close()
+	index := 0
+	count := 0
+	err = service.ReadBatchInputLines(content, func(line int, data []byte) error {
+		index++
+		if index <= batch.ProcessedCount || executed[index] != nil {
+			return nil
+		}
+		count++
+		return writer.write(newBatchErrorLine(gjson.GetBytes(data, "custom_id").String(), "batch_expired",
+			"This request could not be executed before the completion window expired."))
+	})
+	return count, err
+}
+
+func saveBatchSegmentsAsFile(batch *model.Batch, segments string, extra io.Reader, filename string) (string, error) {
+	reader, closeAll, err := service.OpenBatchSegments(segments)
+	if err != nil {
+		return "", err
+	}
+	defer closeAll()
+	if extra != nil {
+		reader = io.MultiReader(reader, extra)
+	}
+	file, err := service.SaveBatchResultFile(batch, reader, filename)
+	if err != nil {
+		return "", err
+	}
+	return file.FileId, nil
+}
+
+// finalizeLocalBatch 合并结果分段生成输出/错误文件，并根据取消/过期/完成情况设置终态。
+// 终态由持久化字段推导，中途失败时下一轮可重新进入
+func finalizeLocalBatch(ctx context.Context, batch *model.Batch) error {
+	if batch.Status != model.BatchStatusFinalizing {
+		fromStatus := batch.Status
+		batch.Status = model.BatchStatusFinalizing
+		batch.FinalizingAt = common.GetTimestamp()
+		ok, err := batch.UpdateWithStatus(fromStatus)
+		if err != nil || !ok {
+			// 状态已被并发修改（例如执行中被取消），下一轮重新处理
+			return err
+		}
+	}
+
+	// 已经执行过但进度还没保存的行（例如保存进度前进程退出）照常输出，不再重新执行
+	executed, err := loadBatchLineResults(batch)
+	if err != nil {
+		return err
+	}
+	lines := make([]int, 0, len(executed))
+	for line := range executed {
+		lines = append(lines, line)
+	}
+	sort.Ints(lines)
+
+	now := common.GetTimestamp()
+	finalStatus := model.BatchStatusCompleted
+	if batch.CancellingAt > 0 {
+		finalStatus = model.BatchStatusCancelled
+	} else if batch.ProcessedCount+len(executed) < batch.TotalCount {
+		finalStatus = model.BatchStatusExpired
+	}
+
+	var extraOutput, extraError batchSegmentWriter
+	defer extraOutput.close()
+	defer extraError.close()
+	executedCompleted, executedFailed := 0, 0
+	for _, line := range lines {
+		result := executed[line]
+		writer := &extraError
+		if result.Response != nil && result.Response.StatusCode == http.StatusOK {
+			writer = &extraOutput
+			executedCompleted++
+		} else {
+			executedFailed++
+		}
+		if err := writer.write(result); err != nil {
+			return err
+		}
+	}
+	expiredCount := 0
+	if finalStatus == model.BatchStatusExpired {
+		count, err := writeExpiredBatchLines(ctx, batch, executed, &extraError)
+		if err != nil {
+			return err
+		}
+		expiredCount = count
+	}
+	extraOutputs, err := extraOutput.reader()
+	if err != nil {
+		return err
+	}
+	extraErrors, err := extraError.reader()
+	if err != nil {
+		return err
+	}
+
+	if batch.OutputSegments != "" || extraOutputs != nil {
+		batch.OutputFileId, err = saveBatchSegmentsAsFile(batch, batch.OutputSegments, extraOutputs, batch.BatchId+"_output.jsonl")
+		if err != nil {
+			return err
+		}
+	}
+	if batch.ErrorSegments != "" || extraErrors != nil {
+		batch.ErrorFileId, err = saveBatchSegmentsAsFile(batch, batch.ErrorSegments, extraErrors, batch.BatchId+"_error.jsonl")
+		if err != nil {
+			return err
+		}
+	}
+
+	outputSegments, errorSegments := batch.OutputSegments, batch.ErrorSegments
+	batch.OutputSegments, batch.ErrorSegments = "", ""
+	batch.ProcessedCount += len(executed)
+	batch.CompletedCount += executedCompleted
+	batch.FailedCount += executedFailed + expiredCount
+	batch.Status = finalStatus
+	switch finalStatus {
+	case model.BatchStatusCancelled:
+		batch.CancelledAt = now
+	case model.BatchStatusExpired:
+		batch.ExpiredAt = now
+	default:
+		batch.CompletedAt = now
+	}
+	if _, err := batch.UpdateWithStatus(model.BatchStatusFinalizing); err != nil {
+		return err
+	}
+	service.DeleteBatchSegments(ctx, outputSegments)
+	service.DeleteBatchSegments(ctx, errorSegments)
+	if err := model.DeleteAllBatchLineResults(batch.Id); err != nil {
+		logger.LogError(ctx, fmt.Sprintf("failed to delete line results of batch %s: %s", batch.BatchId, err.Error()))
+	}
+	return nil
+}
+
+func isUpstreamBatchActive(status string) bool {
+	switch status {
+	case model.BatchStatusValidating, model.BatchStatusInProgress, model.BatchStatusFinalizing:
+		return true
+	}
+	return false
+}
+
+// pollUpstreamBatch 同步上游批处理的状态，上游结束后下载结果并按行计费
+func pollUpstreamBatch(ctx context.Context, batch *model.Batch) error {
+	channel, err := model.CacheGetChannel(batch.ChannelId)
+	if err != nil {
+		return err
+	}
+	upstream, err := service.GetUpstreamBatch(ctx, channel, batch.UpstreamBatchId)
+	if err != nil {
+		return err
+	}
+	if batch.Status == model.BatchStatusCancelling && isUpstreamBatchActive(upstream.Status) {
+		if cancelled, err := service.CancelUpstreamBatch(ctx, channel, batch.UpstreamBatchId); err == nil {
+			upstream = cancelled
+		}
+	}
+	if upstream.RequestCounts.Total > 0 {
+		batch.TotalCount = upstream.RequestCounts.Total
+	}
+	// 上游结束前只同步计数，CompletedCount/FailedCount 在结算时以上游为准
+	if isUpstreamBatchActive(upstream.Status) || upstream.Status == model.BatchStatusCancelling {
+		batch.CompletedCount = upstream.RequestCounts.Completed
+		batch.FailedCount = upstream.RequestCounts.Failed
+		return batch.SaveProgress()
+	}
+	return finalizeUpstreamBatch(ctx, batch, channel, upstream)
+}
+
+// downloadUpstreamBatchFile 将上游结果文件下载到临时文件，调用方负责关闭并删除
+func downloadUpstreamBatchFile(ctx context.Context, channel *model.Channel, upstreamFileId string) (*os.File, error) {
+	content, err := service.OpenUpstreamFileContent(ctx, channel, upstreamFileId)
+	if err != nil {
+		return nil, err
+	}
+	defer content.Close()
+	file, err := os.CreateTemp("", "batch-upstream-*.jsonl")
+	if err != nil {
+		return nil, err
+	}
+	if _, err := io.Copy(file, content); err == nil {
+		_, err = file.Seek(0, io.SeekStart)
+		if err == nil {
+			return file, nil
+		}
+	}
+	removeTempFile(file)
+	return nil, err
+}
+
+func removeTempFile(file *os.File) {
+	if file == nil {
+		return
+	}
+	name := file.Name()
+	_ = file.Close()
+	_ = os.Remove(name)
+}
+
+func finalizeUpstreamBatch(ctx context.Context, batch *model.Batch, channel *model.Channel, upstream *dto.OpenAIBatch) error {
+	if batch.Status != model.BatchStatusFinalizing {
+		fromStatus := batch.Status
+		batch.Status = model.BatchStatusFinalizing
+		batch.FinalizingAt = common.GetTimestamp()
+		ok, err := batch.UpdateWithStatus(fromStatus)
+		if err != nil || !ok {
+			return err
+		}
+	}
+
+	var outputFile, errorFile *os.File
+	defer func() {
+		removeTempFile(outputFile)
+		removeTempFile(errorFile)
+	}()
+	var err error
+	if upstream.OutputFileId != nil && *upstream.OutputFileId != "" {
+		if outputFile, err = downloadUpstreamBatchFile(ctx, channel, *upstream.OutputFileId); err != nil {
+			return err
+		}
+		if err := billUpstreamBatchOutput(ctx, batch, channel, outputFile); err != nil {
+			return err
+		}
+		if _, err := outputFile.Seek(0, io.SeekStart); err != nil {
+			return err
+		}
+		file, err := service.SaveBatchResultFile(batch, outputFile, batch.BatchId+"_output.jsonl")
+		if err != nil {
+			return err
+		}
+		batch.OutputFileId = file.FileId
+	}
+	if upstream.ErrorFileId != nil && *upstream.ErrorFileId != "" {
+		if errorFile, err = downloadUpstreamBatchFile(ctx, channel, *upstream.ErrorFileId); err != nil {
+			return err
+		}
+		file, err := service.SaveBatchResultFile(batch, errorFile, batch.BatchId+"_error.jsonl")
+		if err != nil {
+			return err
+		}
+		batch.ErrorFileId = file.FileId
+	}
+
+	now := common.GetTimestamp()
+	batch.Status = upstream.Status
+	batch.CompletedCount = upstream.RequestCounts.Completed
+	batch.FailedCount = upstream.RequestCounts.Failed
+	if upstream.Errors != nil {
+		service.SetBatchErrors(batch, upstream.Errors.Data)
+	}
+	switch upstream.Status {
+	case model.BatchStatusFailed:
+		batch.FailedAt = now
+	case model.BatchStatusExpired:
+		batch.ExpiredAt = now
+	case model.BatchStatusCancelled:
+		batch.CancelledAt = now
+	default:
+		batch.CompletedAt = now
+	}
+	_, err = batch.UpdateWithStatus(model.BatchStatusFinalizing)
+	return err
+}
+
+// loadBatchInputModels 读取输入文件中 custom_id 对应的模型名，用于上游结果计费
+func loadBatchInputModels(ctx context.Context, batch *model.Batch) (map[string]string, error) {
+	file, err := model.GetUserFileById(batch.UserId, batch.InputFileId)
+	if err != nil {
+		return nil, err
+	}
+	content, err := service.OpenFileContent(ctx, file)
+	if err != nil {
+		return nil, err
+	}
+	defer content.Close()
+	models := make(map[string]string)
+	err = service.ReadBatchInputLines(content, func(line int, data []byte) error {
+		models[gjson.GetBytes(data, "custom_id").String()] = gjson.GetBytes(data, "body.model").String()
+		return nil
+	})
+	return models, err
+}
+
+// billUpstreamBatchOutput 按上游输出文件中每个成功响应的 usage 计费，
+// 每结算一行立即保存 ProcessedCount，重复进入时跳过已结算的行；
+// 某一行计费失败时停止推进进度并返回错误，下一轮从该行重试；
+// 只有在扣费完成、进度保存之前进程退出时，这一行会再结算一次
+func billUpstreamBatchOutput(ctx context.Context, batch *model.Batch, channel *model.Channel, output io.Reader) error {
+	models, err := loadBatchInputModels(ctx, batch)
+	if err != nil {
+		return err
+	}
+	auth, err := loadBatchAuth(batch)
+	if err != nil {
+		// 令牌失效时仍按用户扣费，不能因此跳过结算
+		auth = nil
+		logger.LogWarn(ctx, fmt.Sprintf("batch %s bills without token: %s", batch.BatchId, err.Error()))
+	}
+	index := 0
+	err = service.ReadBatchInputLines(output, func(line int, data []byte) error {
+		index++
+		if index <= batch.ProcessedCount {
+			return nil
+		}
+		var outputLine dto.OpenAIBatchOutputLine
+		if err := common.Unmarshal(data, &outputLine); err == nil && outputLine.Response != nil &&
+			outputLine.Response.StatusCode == http.StatusOK {
+			// 按输入行中用户请求的模型计价，上游响应中的模型名通常是带日期的快照名，没有对应的倍率配置
+			modelName := models[outputLine.CustomId]
+			if modelName == "" {
+				modelName = gjson.GetBytes(outputLine.Response.Body, "model").String()
+			}
+			billed, err := billUpstreamBatchLine(ctx, batch, auth, channel, modelName, outputLine.Response.Body)
+			if err != nil {
+				return fmt.Errorf("failed to bill line %d: %w", line, err)
+			}
+			if billed {
+				batch.ProcessedCount = index
+				return batch.SaveProgress()
+			}
+			logger.LogWarn(ctx, fmt.Sprintf("batch %s line %d has no usage to bill", batch.BatchId, line))
+		}
+		batch.ProcessedCount = index
+		if index%batchCheckpointLines == 0 {
+			return batch.SaveProgress()
+		}
+		return nil
+	})
+	if err != nil {
+		// 保存失败行之前已结算的进度，下一轮从失败的行继续
+		if saveErr := batch.SaveProgress(); saveErr != nil {
+			logger.LogError(ctx, fmt.Sprintf("failed to save progress of batch %s: %s", batch.BatchId, saveErr.Error()))
+		}
+		return err
+	}
+	return batch.SaveProgress()
+}
+
+// newUpstreamBatchPriceContext 构造按批处理身份与上游渠道计价的上下文，令牌失效（auth 为 nil）时按用户计价
+func newUpstreamBatchPriceContext(ctx context.Context, batch *model.Batch, auth *batchAuth, channel *model.Channel, modelName string) (*gin.Context, *relaycommon.RelayInfo, error) {
+	c, _ := newBatchGinContext(ctx, http.MethodPost, batch.Endpoint, nil)
+	if auth != nil {
+		if err := auth.setup(c, batch); err != nil {
+			return nil, nil, err
+		}
+	} else {
+		userCache, err := model.GetUserCache(batch.UserId)
+		if err != nil {
+			return nil, nil, err
+		}
+		userCache.WriteContext(c)
+		common.SetContextKey(c, constant.ContextKeyUsingGroup, batch.Group)
+		c.Set("token_id", batch.TokenId)
+		common.SetContextKey(c, constant.ContextKeyBatchId, batch.BatchId)
+		common.SetContextKey(c, constant.ContextKeyBatchDiscountRatio, operation_setting.GetBatchDiscountRatio())
+	}
+	if apiErr := middleware.SetupContextForSelectedChannel(c, channel, modelName); apiErr != nil {
+		return nil, nil, apiErr
+	}
+	info, err := relaycommon.GenRelayInfo(c, types.RelayFormatOpenAI, nil, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	info.InitChannelMeta(c)
+	info.OriginModelName = modelName
+	info.UpstreamModelName = modelName
+	return c, info, nil
+}
+
+// billUpstreamBatchLine 按响应中的 usage 结算一行，响应没有 usage 时返回 false
+func billUpstreamBatchLine(ctx context.Context, batch *model.Batch, auth *batchAuth, channel *model.Channel, modelName string, body []byte) (bool, error) {
+	usageResult := gjson.GetBytes(body, "usage")
+	if !usageResult.Exists() {
+		return false, nil
+	}
+	var usage dto.Usage
+	if err := common.UnmarshalJsonStr(usageResult.Raw, &usage); err != nil {
+		return false, err
+	}
+	// Responses API 使用 input_tokens/output_tokens
+	if usage.PromptTokens == 0 && usage.InputTokens > 0 {
+		usage.PromptTokens = usage.InputTokens
+	}
+	if usage.CompletionTokens == 0 && usage.OutputTokens > 0 {
+		usage.CompletionTokens = usage.OutputTokens
+	}
+	if usage.TotalTokens == 0 {
+		usage.TotalTokens = usage.PromptTokens + usage.CompletionTokens
+	}
+
+	c, info, err := newUpstreamBatchPriceContext(ctx, batch, auth, channel, modelName)
+	if err != nil {
+		return false, err
+	}
+	if upstreamModel := gjson.GetBytes(body, "model").String(); upstreamModel != "" {
+		info.UpstreamModelName = upstreamModel
+	}
+	if _, err := helper.ModelPriceHelper(c, info, usage.PromptTokens, &types.TokenCountMeta{}); err != nil {
+		return false, err
+	}
+	// 与转发前的额度校验使用同一资金来源（组织钱包与成员额度上限、订阅或个人钱包），不预扣，按实际用量结算
+	session, apiErr := service.NewBillingSession(c, info, 0)
+	if apiErr != nil {
+		return false, apiErr
+	}
+	info.Billing = session
+	service.PostTextConsumeQuota(c, info, &usage, []string{"batch"})
+	return true, nil
+}
+
+// batchModelEstimate 输入文件中同一模型的请求数与预估 token 数
+type batchModelEstimate struct {
+	lines        int
+	promptTokens int
+	maxTokens    int
+}
+
+// checkUpstreamBatchBudget 上游批处理不经过逐行的预扣费与令牌消费限制校验，因此只有在令牌未设置消费限制、
+// 且令牌与用户（组织成员为组织钱包与成员额度上限）的余额足以覆盖整批的预估费用时才允许转发；
+// 否则回退为本地执行，由每一行请求正常预扣费与校验
+func checkUpstreamBatchBudget(ctx context.Context, batch *model.Batch, file *model.File, channel *model.Channel) error {
+	auth, err := loadBatchAuth(batch)
+	if err != nil {
+		return err
+	}
+	if !auth.token.GetLimits().IsEmpty() {
+		return errors.New("token spend limits are enforced per request")
+	}
+	estimate, err := estimateUpstreamBatchQuota(ctx, batch, file, channel, auth)
+	if err != nil {
+		return err
+	}
+	available, err := batchAvailableQuota(auth)
+	if err != nil {
+		return err
+	}
+	if estimate > available {
+		return fmt.Errorf("estimated cost %s exceeds available quota %s", logger.FormatQuota(estimate), logger.FormatQuota(available))
+	}
+	return nil
+}
+
+// estimateUpstreamBatchQuota 按普通请求预扣费的方式估算整批费用：按模型汇总输入的预估 token 与 max_tokens 后计价，
+// 按次计费的模型乘以请求数
+func estimateUpstreamBatchQuota(ctx context.Context, batch *model.Batch, file *model.File, channel *model.Channel, auth *batchAuth) (int, error) {
+	content, err := service.OpenFileContent(ctx, file)
+	if err != nil {
+		return 0, err
+	}
+	defer content.Close()
+	estimates := make(map[string]*batchModelEstimate)
+	err = service.ReadBatchInputLines(content, func(line int, data []byte) error {
+		body := gjson.GetBytes(data, "body")
+		modelName := body.Get("model").String()
+		estimate, ok := estimates[modelName]
+		if !ok {
+			estimate = &batchModelEstimate{}
+			estimates[modelName] = estimate
+		}
+		estimate.lines++
+		estimate.promptTokens += service.EstimateTokenByModel(modelName, body.Raw)
+		for _, field := range []string{"max_tokens", "max_completion_tokens", "max_output_tokens"} {
+			if maxTokens := body.Get(field).Int(); maxTokens > 0 {
+				estimate.maxTokens += int(maxTokens)
+				break
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	total := 0
+	for modelName, estimate := range estimates {
+		c, info, err := newUpstreamBatchPriceContext(ctx, batch, auth, channel, modelName)
+		if err != nil {
+			return 0, err
+		}
+		priceData, err := helper.ModelPriceHelper(c, info, estimate.promptTokens, &types.TokenCountMeta{MaxTokens: estimate.maxTokens})
+		if err != nil {
+			return 0, err
+		}
+		if priceData.UsePrice {
+			total += priceData.QuotaToPreConsume * estimate.lines
+		} else {
+			total += priceData.QuotaToPreConsume
+		}
+	}
+	return total, nil
+}
+
+// batchAvailableQuota 返回批处理可用的额度：组织成员为组织钱包余额与成员剩余额度上限中的较小值，
+// 其他用户为个人钱包余额；令牌有额度限制时不超过令牌剩余额度
+func batchAvailableQuota(auth *batchAuth) (int, error) {
+	userId := auth.token.UserId
+	member, err := model.GetActiveOrganizationMemberByUserId(userId)
+	if err != nil {
+		return 0, err
+	}
+	var available int
+	if member != nil {
+		organization, err := model.GetOrganizationById(member.OrganizationId)
+		if err != nil {
+			return 0, err
+		}
+		available = organization.Quota
+		if member.QuotaLimit > 0 {
+			available = min(available, member.QuotaLimit-member.UsedQuota)
+		}
+	} else if available, err = model.GetUserQuota(userId, true); err != nil {
+		return 0, err
+	}
+	if !auth.token.UnlimitedQuota {
+		available = min(available, auth.token.RemainQuota)
+	}
+	return available, nil
+}
@@ -0,0 +1,384 @@
+package controller
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/constant"
+	"github.com/QuantumNous/new-api/dto"
+	"github.com/QuantumNous/new-api/i18n"
+	"github.com/QuantumNous/new-api/model"
+	"github.com/QuantumNous/new-api/setting/operation_setting"
+	"github.com/QuantumNous/new-api/setting/ratio_setting"
+	"github.com/QuantumNous/new-api/types"
+)
+
+type memoryFileStorage struct {
+	mu    sync.Mutex
+	files map[string][]byte
+}
+
+type memoryFileReader struct {
+	*bytes.Reader
+}
+
+func (memoryFileReader) Close() error { return nil }
+
+func (s *memoryFileStorage) Name() string { return "batch-test" }
+
+func (s *memoryFileStorage) Put(reader io.Reader, maxBytes int64) (string, int64, error) {
+	data, err := io.ReadAll(reader)
+	if err != nil {
+		return "", 0, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	key := fmt.Sprintf("file-%d", len(s.files)+1)
+	s.files[key] = data
+	return key, int64(len(data)), nil
+}
+
+func (s *memoryFileStorage) Open(key string) (io.ReadSeekCloser, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	data, ok := s.files[key]
+	if !ok {
+		return nil, errors.New("file not found")
+	}
+	return memoryFileReader{bytes.NewReader(data)}, nil
+}
+
+func (s *memoryFileStorage) Delete(key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.files, key)
+	return nil
+}
+
+func setupLocalBatchTest(t *testing.T, lines int) *model.Batch {
+	t.Helper()
+
+	db := openTokenControllerTestDB(t)
+	if err := db.AutoMigrate(&model.User{}, &model.Token{}, &model.File{}, &model.Batch{}, &model.BatchLineResult{}); err != nil {
+		t.Fatalf("failed to migrate: %v", err)
+	}
+
+	storage := &memoryFileStorage{files: map[string][]byte{}}
+	common.RegisterFileStorage(storage)
+	t.Setenv("FILE_STORAGE_BACKEND", storage.Name())
+
+	batchSetting := operation_setting.GetBatchSetting()
+	concurrency := batchSetting.Concurrency
+	batchSetting.Concurrency = 3
+	executor := batchLineExecutor
+	t.Cleanup(func() {
+		batchSetting.Concurrency = concurrency
+		batchLineExecutor = executor
+	})
+
+	user := &model.User{Username: "batch-user", Password: "password123", Status: common.UserStatusEnabled, Group: "default"}
+	if err := db.Create(user).Error; err != nil {
+		t.Fatalf("failed to create user: %v", err)
+	}
+	token := &model.Token{UserId: user.Id, Key: "batch-test-key", Status: common.TokenStatusEnabled, ExpiredTime: -1, UnlimitedQuota: true}
+	if err := db.Create(token).Error; err != nil {
+		t.Fatalf("failed to create token: %v", err)
+	}
+
+	var input strings.Builder
+	for i := 1; i <= lines; i++ {
+		fmt.Fprintf(&input, `{"custom_id":"req-%d","method":"POST","url":"/v1/chat/completions","body":{"model":"gpt-4o-mini","messages":[]}}`+"\n", i)
+	}
+	key, size, err := storage.Put(strings.NewReader(input.String()), 1<<20)
+	if err != nil {
+		t.Fatalf("failed to store input: %v", err)
+	}
+	file := &model.File{FileId: model.GenerateFileID(), UserId: user.Id, TokenId: token.Id, Purpose: "batch", Bytes: size, Storage: storage.Name(), StorageKey: key}
+	if err := db.Create(file).Error; err != nil {
+		t.Fatalf("failed to create file: %v", err)
+	}
+
+	now := common.GetTimestamp()
+	batch := &model.Batch{
+		BatchId:     model.GenerateBatchID(),
+		UserId:      user.Id,
+		TokenId:     token.Id,
+		Group:       "default",
+		Endpoint:    "/v1/chat/completions",
+		Mode:        model.BatchModeLocal,
+		InputFileId: file.FileId,
+		Status:      model.BatchStatusInProgress,
+		TotalCount:  lines,
+		CreatedAt:   now,
+		ExpiresAt:   now + 3600,
+	}
+	if err := db.Create(batch).Error; err != nil {
+		t.Fatalf("failed to create batch: %v", err)
+	}
+	return batch
+}
+
+func newBatchOKLine(customId string) *dto.OpenAIBatchOutputLine {
+	return &dto.OpenAIBatchOutputLine{
+		Id:       newBatchRequestId(),
+		CustomId: customId,
+		Response: &dto.OpenAIBatchOutputResponse{StatusCode: http.StatusOK, Body: []byte(`{"id":"chatcmpl-test"}`)},
+	}
+}
+
+func TestRunLocalBatchBillsEachLineOnceAcrossInterruptions(t *testing.T) {
+	batch := setupLocalBatchTest(t, 7)
+
+	var mu sync.Mutex
+	calls := map[string]int{}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	batchLineExecutor = func(ctx context.Context, batch *model.Batch, auth *batchAuth, format types.RelayFormat, input *dto.OpenAIBatchInputLine) *dto.OpenAIBatchOutputLine {
+		mu.Lock()
+		calls[input.CustomId]++
+		mu.Unlock()
+		if input.CustomId == "req-2" {
+			// 窗口执行到一半时任务被中断
+			cancel()
+		}
+		return newBatchOKLine(input.CustomId)
+	}
+
+	if err := runLocalBatch(ctx, batch); !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected context.Canceled, got %v", err)
+	}
+	if batch.ProcessedCount != 3 {
+		t.Fatalf("lines executed before the interruption must be recorded, processed = %d", batch.ProcessedCount)
+	}
+
+	// 模拟第 4 行已经转发并计费、但进度保存前进程退出
+	saveBatchLineResult(context.Background(), batch, 4, newBatchOKLine("req-4"))
+
+	if err := runLocalBatch(context.Background(), batch); err != nil {
+		t.Fatalf("failed to resume batch: %v", err)
+	}
+	if batch.Status != model.BatchStatusCompleted {
+		t.Fatalf("expected completed batch, got %s", batch.Status)
+	}
+	if batch.ProcessedCount != 7 || batch.CompletedCount != 7 || batch.FailedCount != 0 {
+		t.Fatalf("unexpected counts: processed=%d completed=%d failed=%d", batch.ProcessedCount, batch.CompletedCount, batch.FailedCount)
+	}
+	for i := 1; i <= 7; i++ {
+		customId := fmt.Sprintf("req-%d", i)
+		expected := 1
+		if i == 4 {
+			expected = 0
+		}
+		if calls[customId] != expected {
+			t.Fatalf("%s executed %d times, want %d", customId, calls[customId], expected)
+		}
+	}
+
+	file, err := model.GetUserFileById(batch.UserId, batch.OutputFileId)
+	if err != nil {
+		t.Fatalf("failed to load output file: %v", err)
+	}
+	storage, err := common.GetFileStorage(file.Storage)
+	if err != nil {
+		t.Fatalf("failed to get storage: %v", err)
+	}
+	reader, err := storage.Open(file.StorageKey)
+	if err != nil {
+		t.Fatalf("failed to open output file: %v", err)
+	}
+	output, _ := io.ReadAll(reader)
+	if lines := strings.Count(string(output), "\n"); lines != 7 {
+		t.Fatalf("expected 7 output lines, got %d", lines)
+	}
+
+	var remaining int64
+	model.DB.Model(&model.BatchLineResult{}).Where("batch_id = ?", batch.Id).Count(&remaining)
+	if remaining != 0 {
+		t.Fatalf("expected line results to be deleted after finalizing, %d left", remaining)
+	}
+}
+
+func TestFinalizeLocalBatchIncludesExecutedLines(t *testing.T) {
+	batch := setupLocalBatchTest(t, 3)
+	batchLineExecutor = func(ctx context.Context, batch *model.Batch, auth *batchAuth, format types.RelayFormat, input *dto.OpenAIBatchInputLine) *dto.OpenAIBatchOutputLine {
+		t.Fatalf("line %s must not be executed after cancellation", input.CustomId)
+		return nil
+	}
+
+	// 第 1 行执行后批处理被取消，进度尚未保存
+	saveBatchLineResult(context.Background(), batch, 1, newBatchOKLine("req-1"))
+	batch.Status = model.BatchStatusCancelling
+	batch.CancellingAt = common.GetTimestamp()
+	if err := model.DB.Save(batch).Error; err != nil {
+		t.Fatalf("failed to cancel batch: %v", err)
+	}
+
+	if err := runLocalBatch(context.Background(), batch); err != nil {
+		t.Fatalf("failed to finalize batch: %v", err)
+	}
+	if batch.Status != model.BatchStatusCancelled {
+		t.Fatalf("expected cancelled batch, got %s", batch.Status)
+	}
+	if batch.ProcessedCount != 1 || batch.CompletedCount != 1 || batch.OutputFileId == "" {
+		t.Fatalf("executed line must be kept in the output: processed=%d completed=%d output=%q",
+			batch.ProcessedCount, batch.CompletedCount, batch.OutputFileId)
+	}
+}
+
+func TestBillUpstreamBatchOutputPricesRequestedModel(t *testing.T) {
+	batch := setupLocalBatchTest(t, 3)
+	if err := model.DB.AutoMigrate(&model.Channel{}, &model.Log{}, &model.Organization{}, &model.OrganizationMember{}, &model.UserSubscription{}); err != nil {
+		t.Fatalf("failed to migrate: %v", err)
+	}
+	if err := i18n.Init(); err != nil {
+		t.Fatalf("failed to init i18n: %v", err)
+	}
+	modelRatio := ratio_setting.ModelRatio2JSONString()
+	t.Cleanup(func() {
+		_ = ratio_setting.UpdateModelRatioByJSONString(modelRatio)
+	})
+	if err := ratio_setting.UpdateModelRatioByJSONString(`{"gpt-4o-mini":1}`); err != nil {
+		t.Fatalf("failed to set model ratio: %v", err)
+	}
+	channel := &model.Channel{Type: constant.ChannelTypeOpenAI, Key: "sk-upstream", Name: "upstream", Status: common.ChannelStatusEnabled, Models: "gpt-4o-mini", Group: "default"}
+	if err := model.DB.Create(channel).Error; err != nil {
+		t.Fatalf("failed to create channel: %v", err)
+	}
+	batch.Mode = model.BatchModeUpstream
+	batch.ChannelId = channel.Id
+	model.DB.Model(&model.User{}).Where("id = ?", batch.UserId).Update("quota", 10_000)
+
+	// 上游返回带日期的快照模型名，没有对应的倍率配置
+	usageBody := `{"id":"chatcmpl-1","model":"gpt-4o-mini-2024-07-18","usage":{"prompt_tokens":1000,"completion_tokens":0,"total_tokens":1000}}`
+	output := `{"id":"r1","custom_id":"req-1","response":{"status_code":200,"body":` + usageBody + `}}` + "\n" +
+		`{"id":"r2","custom_id":"req-2","response":{"status_code":400,"body":{"error":{"message":"bad"}}}}` + "\n" +
+		`{"id":"r3","custom_id":"req-3","response":{"status_code":200,"body":` + usageBody + `}}` + "\n"
+
+	if err := billUpstreamBatchOutput(context.Background(), batch, channel, strings.NewReader(output)); err != nil {
+		t.Fatalf("failed to bill upstream output: %v", err)
+	}
+	if batch.ProcessedCount != 3 {
+		t.Fatalf("expected all lines processed, got %d", batch.ProcessedCount)
+	}
+	var user model.User
+	model.DB.Select("quota", "used_quota").Where("id = ?", batch.UserId).First(&user)
+	if user.UsedQuota != 1000 || user.Quota != 9000 {
+		t.Fatalf("expected two lines billed at the requested model's ratio, quota = %d, used quota = %d", user.Quota, user.UsedQuota)
+	}
+
+	// 计费失败时不推进进度，下一轮从失败的行重试
+	if err := ratio_setting.UpdateModelRatioByJSONString(`{}`); err != nil {
+		t.Fatalf("failed to clear model ratio: %v", err)
+	}
+	batch.ProcessedCount = 0
+	if err := billUpstreamBatchOutput(context.Background(), batch, channel, strings.NewReader(output)); err == nil {
+		t.Fatalf("expected a billing error")
+	}
+	if batch.ProcessedCount != 0 {
+		t.Fatalf("progress must stop at the unbilled line, got %d", batch.ProcessedCount)
+	}
+}
+
+func TestBillUpstreamBatchOutputChargesOrganizationWallet(t *testing.T) {
+	batch := setupLocalBatchTest(t, 1)
+	if err := model.DB.AutoMigrate(&model.Channel{}, &model.Log{}, &model.Organization{}, &model.OrganizationMember{}, &model.UserSubscription{}); err != nil {
+		t.Fatalf("failed to migrate: %v", err)
+	}
+	if err := i18n.Init(); err != nil {
+		t.Fatalf("failed to init i18n: %v", err)
+	}
+	modelRatio := ratio_setting.ModelRatio2JSONString()
+	t.Cleanup(func() {
+		_ = ratio_setting.UpdateModelRatioByJSONString(modelRatio)
+	})
+	if err := ratio_setting.UpdateModelRatioByJSONString(`{"gpt-4o-mini":1}`); err != nil {
+		t.Fatalf("failed to set model ratio: %v", err)
+	}
+	channel := &model.Channel{Type: constant.ChannelTypeOpenAI, Key: "sk-upstream", Name: "upstream", Status: common.ChannelStatusEnabled, Models: "gpt-4o-mini", Group: "default"}
+	if err := model.DB.Create(channel).Error; err != nil {
+		t.Fatalf("failed to create channel: %v", err)
+	}
+	batch.Mode = model.BatchModeUpstream
+	batch.ChannelId = channel.Id
+	model.DB.Model(&model.User{}).Where("id = ?", batch.UserId).Update("quota", 10_000)
+
+	organization := &model.Organization{Name: "batch-org", Status: common.UserStatusEnabled, Quota: 10_000}
+	if err := model.DB.Create(organization).Error; err != nil {
+		t.Fatalf("failed to create organization: %v", err)
+	}
+	member := &model.OrganizationMember{OrganizationId: organization.Id, UserId: batch.UserId, Role: model.OrganizationRoleMember, QuotaLimit: 5_000}
+	if err := model.AddOrganizationMember(member); err != nil {
+		t.Fatalf("failed to add member: %v", err)
+	}
+	t.Cleanup(func() {
+		model.InvalidateOrganizationMemberCache(batch.UserId)
+	})
+
+	usageBody := `{"id":"chatcmpl-1","model":"gpt-4o-mini","usage":{"prompt_tokens":1000,"completion_tokens":0,"total_tokens":1000}}`
+	output := `{"id":"r1","custom_id":"req-1","response":{"status_code":200,"body":` + usageBody + `}}` + "\n"
+	if err := billUpstreamBatchOutput(context.Background(), batch, channel, strings.NewReader(output)); err != nil {
+		t.Fatalf("failed to bill upstream output: %v", err)
+	}
+
+	// 组织成员的批处理与转发前的额度校验一致，由组织钱包付费并计入成员已用额度
+	var userQuota int
+	model.DB.Model(&model.User{}).Where("id = ?", batch.UserId).Pluck("quota", &userQuota)
+	if userQuota != 10_000 {
+		t.Fatalf("personal wallet must not be charged, quota = %d", userQuota)
+	}
+	var orgQuota int
+	model.DB.Model(&model.Organization{}).Where("id = ?", organization.Id).Pluck("quota", &orgQuota)
+	if orgQuota != 9_500 {
+		t.Fatalf("expected the organization wallet to be charged, quota = %d", orgQuota)
+	}
+	var memberUsed int
+	model.DB.Model(&model.OrganizationMember{}).Where("id = ?", member.Id).Pluck("used_quota", &memberUsed)
+	if memberUsed != 500 {
+		t.Fatalf("expected the member used quota to be updated, used quota = %d", memberUsed)
+	}
+}
+
+func TestCheckUpstreamBatchBudget(t *testing.T) {
+	batch := setupLocalBatchTest(t, 3)
+	if err := model.DB.AutoMigrate(&model.Channel{}, &model.Organization{}, &model.OrganizationMember{}); err != nil {
+		t.Fatalf("failed to migrate: %v", err)
+	}
+	modelRatio := ratio_setting.ModelRatio2JSONString()
+	t.Cleanup(func() {
+		_ = ratio_setting.UpdateModelRatioByJSONString(modelRatio)
+	})
+	if err := ratio_setting.UpdateModelRatioByJSONString(`{"gpt-4o-mini":1}`); err != nil {
+		t.Fatalf("failed to set model ratio: %v", err)
+	}
+	channel := &model.Channel{Type: constant.ChannelTypeOpenAI, Key: "sk-upstream", Name: "upstream", Status: common.ChannelStatusEnabled, Models: "gpt-4o-mini", Group: "default"}
+	if err := model.DB.Create(channel).Error; err != nil {
+		t.Fatalf("failed to create channel: %v", err)
+	}
+	file, err := model.GetUserFileById(batch.UserId, batch.InputFileId)
+	if err != nil {
+		t.Fatalf("failed to load input file: %v", err)
+	}
+
+	// 余额不足以覆盖预估费用时不转发
+	if err := checkUpstreamBatchBudget(context.Background(), batch, file, channel); err == nil {
+		t.Fatalf("expected the batch to be kept local without balance")
+	}
+	model.DB.Model(&model.User{}).Where("id = ?", batch.UserId).Update("quota", 1_000_000)
+	if err := checkUpstreamBatchBudget(context.Background(), batch, file, channel); err != nil {
+		t.Fatalf("expected the batch to be forwarded: %v", err)
+	}
+
+	// 令牌设置了消费限制时只能逐行执行
+	model.DB.Model(&model.Token{}).Where("id = ?", batch.TokenId).Update("daily_quota_limit", 1_000_000)
+	if err := checkUpstreamBatchBudget(context.Background(), batch, file, channel); err == nil {
+		t.Fatalf("expected the batch to be kept local for a token with spend limits")
+	}
+}
@@ -890,6 +890,26 @@ func TestChannel(c *gin.Context) {
 	})
 }
 
+// RunChannelTest tests a single channel outside of an HTTP request (e.g. from
+// the admin CLI) and records the response time like the manual test endpoint.
+func RunChannelTest(ctx context.Context, channel *model.Channel, testModel string) (time.Duration, error) {
+	testUserID, err := resolveChannelTestUserID(nil)
+	if err != nil {
+		return 0, err
+	}
+	tik := time.Now()
+	result := testChannel(ctx, channel, testUserID, testModel, "", false)
+	if result.localErr != nil {
+		return 0, result.localErr
+	}
+	elapsed := time.Since(tik)
+	channel.UpdateResponseTime(elapsed.Milliseconds())
+	if result.newAPIError != nil {
+		return elapsed, result.newAPIError
+	}
+	return elapsed, nil
+}
+
 // channelTestSummary records the outcome of one channel test cycle so the
 // system task can persist a per-run result for history.
 type channelTestSummary struct {
@@ -823,7 +823,7 @@ func EditTagChannels(c *gin.Context) {
 		return
 	}
 	if (channelTag.ParamOverride != nil || channelTag.HeaderOverride != nil) &&
-		!authz.Can(c.GetInt("id"), c.GetInt("role"), authz.ChannelSensitiveWrite) {
+		!authz.CanOnChannel(c.GetInt("id"), c.GetInt("role"), authz.ChannelSensitiveWrite, channelTag.Tag) {
 		common.ApiErrorI18n(c, i18n.MsgAuthInsufficientPrivilege)
 		return
 	}
@@ -955,8 +955,12 @@ func UpdateChannel(c *gin.Context) {
 	// Always copy the original ChannelInfo so that fields like IsMultiKey and MultiKeySize are retained.
 	channel.ChannelInfo = originChannel.ChannelInfo
 
+	channelTags := []string{originChannel.GetTag()}
+	if _, ok := requestData["tag"]; ok {
+		channelTags = append(channelTags, channel.GetTag())
+	}
 	if channelHasSensitiveChanges(&channel, originChannel, requestData) &&
-		!authz.Can(c.GetInt("id"), c.GetInt("role"), authz.ChannelSensitiveWrite) {
+		!authz.CanOnChannel(c.GetInt("id"), c.GetInt("role"), authz.ChannelSensitiveWrite, channelTags...) {
 		common.ApiErrorI18n(c, i18n.MsgAuthInsufficientPrivilege)
 		return
 	}
@@ -1458,7 +1462,7 @@ func ManageMultiKeys(c *gin.Context) {
 		return
 	}
 	if multiKeyActionRequiresSensitiveWrite(request.Action) &&
-		!authz.Can(c.GetInt("id"), c.GetInt("role"), authz.ChannelSensitiveWrite) {
+		!authz.CanOnChannel(c.GetInt("id"), c.GetInt("role"), authz.ChannelSensitiveWrite, channel.GetTag()) {
 		common.ApiErrorI18n(c, i18n.MsgAuthInsufficientPrivilege)
 		return
 	}
@@ -0,0 +1,39 @@
+package controller
+
+import (
+	"strconv"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/i18n"
+	channelbreaker "github.com/QuantumNous/new-api/pkg/channel_breaker"
+
+	"github.com/gin-gonic/gin"
+)
+
+// GetChannelBreakers 返回渠道在本节点上各模型 / Key 的熔断器状态
+func GetChannelBreakers(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		common.ApiErrorI18n(c, i18n.MsgChannelIdFormatError)
+		return
+	}
+	common.ApiSuccess(c, gin.H{
+		"enabled":  channelbreaker.Enabled(),
+		"breakers": channelbreaker.States(id),
+	})
+}
+
+// ResetChannelBreakers 手动关闭渠道的所有熔断器，立即恢复全部流量
+func ResetChannelBreakers(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		common.ApiErrorI18n(c, i18n.MsgChannelIdFormatError)
+		return
+	}
+	count := channelbreaker.Reset(id)
+	recordManageAudit(c, "channel.breaker_reset", map[string]interface{}{
+		"id":    id,
+		"count": count,
+	})
+	common.ApiSuccess(c, count)
+}
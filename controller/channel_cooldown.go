@@ -0,0 +1,39 @@
+package controller
+
+import (
+	"strconv"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/i18n"
+	channelcooldown "github.com/QuantumNous/new-api/pkg/channel_cooldown"
+
+	"github.com/gin-gonic/gin"
+)
+
+// GetChannelCooldowns 返回渠道在本节点上因上游限流而冷却中的 Key
+func GetChannelCooldowns(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		common.ApiErrorI18n(c, i18n.MsgChannelIdFormatError)
+		return
+	}
+	common.ApiSuccess(c, gin.H{
+		"enabled":   channelcooldown.Enabled(),
+		"cooldowns": channelcooldown.States(id),
+	})
+}
+
+// ClearChannelCooldowns 手动结束渠道的所有冷却，立即恢复全部流量
+func ClearChannelCooldowns(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		common.ApiErrorI18n(c, i18n.MsgChannelIdFormatError)
+		return
+	}
+	count := channelcooldown.Clear(id)
+	recordManageAudit(c, "channel.cooldown_clear", map[string]interface{}{
+		"id":    id,
+		"count": count,
+	})
+	common.ApiSuccess(c, count)
+}
@@ -131,7 +131,7 @@ func fetchCodexChannelWhamData(
 
 			encoded, encErr := common.Marshal(oauthKey)
 			if encErr == nil {
-				_ = model.DB.Model(&model.Channel{}).Where("id = ?", ch.Id).Update("key", string(encoded)).Error
+				_ = model.UpdateChannelKey(ch.Id, string(encoded))
 				model.InitChannelCache()
 				service.ResetProxyClientCache()
 			}
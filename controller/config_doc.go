@@ -0,0 +1,99 @@
+package controller
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/service/configdoc"
+
+	"github.com/gin-gonic/gin"
+)
+
+// configPassphraseHeader 加密导出 / 导入密钥使用的口令，通过请求头传递以免出现在访问日志中
+const configPassphraseHeader = "X-Config-Passphrase"
+
+// ExportConfigDocument 导出实例配置，format=yaml|json，keys=omit|plain|encrypt
+func ExportConfigDocument(c *gin.Context) {
+	format := c.DefaultQuery("format", configdoc.FormatYAML)
+	mode, err := configdoc.ParseSecretMode(c.Query("keys"))
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	doc, err := configdoc.Export(configdoc.ExportOptions{
+		Secrets:    mode,
+		Passphrase: c.GetHeader(configPassphraseHeader),
+	})
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	data, err := configdoc.Marshal(doc, format)
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	recordManageAudit(c, "config.export", map[string]interface{}{
+		"format": format,
+		"keys":   string(mode),
+	})
+	contentType := "application/json"
+	if format == configdoc.FormatYAML {
+		contentType = "application/yaml"
+	}
+	fileName := fmt.Sprintf("new-api-config-%s.%s", time.Now().Format("20060102-150405"), format)
+	c.Header("Content-Disposition", "attachment; filename="+fileName)
+	c.Data(http.StatusOK, contentType, data)
+}
+
+// DiffConfigDocument 比较配置文档与当前实例，不写入任何内容
+func DiffConfigDocument(c *gin.Context) {
+	applyConfigDocument(c, true)
+}
+
+// ApplyConfigDocument 导入配置文档，prune=true 时清理文档中不存在的渠道与套餐
+func ApplyConfigDocument(c *gin.Context) {
+	applyConfigDocument(c, false)
+}
+
+func applyConfigDocument(c *gin.Context, dryRun bool) {
+	data, err := io.ReadAll(c.Request.Body)
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	doc, err := configdoc.Parse(data)
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	report, err := configdoc.Apply(doc, configdoc.ApplyOptions{
+		DryRun:     dryRun,
+		Prune:      c.Query("prune") == "true",
+		Passphrase: c.GetHeader(configPassphraseHeader),
+	})
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	if report.HasErrors() {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": strings.Join(report.Errors, "; "),
+			"data":    report,
+		})
+		return
+	}
+	if !dryRun && len(report.Changes) > 0 {
+		recordManageAudit(c, "config.apply", map[string]interface{}{
+			"created": report.Created,
+			"updated": report.Updated,
+			"deleted": report.Deleted,
+		})
+	}
+	common.ApiSuccess(c, report)
+}
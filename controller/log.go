@@ -44,7 +44,19 @@ func GetUserLogs(c *gin.Context) {
 	group := c.Query("group")
 	requestId := c.Query("request_id")
 	upstreamRequestId := c.Query("upstream_request_id")
-	logs, total, err := model.GetUserLogs(userId, logType, startTimestamp, endTimestamp, modelName, tokenName, pageInfo.GetStartIdx(), pageInfo.GetPageSize(), group, requestId, upstreamRequestId)
+	// scope=organization：组织管理员查看全部成员的日志
+	orgMembers, ok := organizationScopeMembers(c)
+	if !ok {
+		return
+	}
+	var logs []*model.Log
+	var total int64
+	var err error
+	if orgMembers != nil {
+		logs, total, err = model.GetUsersLogs(orgMembers, logType, startTimestamp, endTimestamp, modelName, tokenName, pageInfo.GetStartIdx(), pageInfo.GetPageSize(), group, requestId, upstreamRequestId)
+	} else {
+		logs, total, err = model.GetUserLogs(userId, logType, startTimestamp, endTimestamp, modelName, tokenName, pageInfo.GetStartIdx(), pageInfo.GetPageSize(), group, requestId, upstreamRequestId)
+	}
 	if err != nil {
 		common.ApiError(c, err)
 		return
@@ -131,7 +143,17 @@ func GetLogsSelfStat(c *gin.Context) {
 	modelName := c.Query("model_name")
 	channel, _ := strconv.Atoi(c.Query("channel"))
 	group := c.Query("group")
-	quotaNum, err := model.SumUsedQuota(logType, startTimestamp, endTimestamp, modelName, username, tokenName, channel, group)
+	orgMembers, ok := organizationScopeMembers(c)
+	if !ok {
+		return
+	}
+	var quotaNum model.Stat
+	var err error
+	if orgMembers != nil {
+		quotaNum, err = model.SumUsersUsedQuota(orgMembers, startTimestamp, endTimestamp, modelName, tokenName, group)
+	} else {
+		quotaNum, err = model.SumUsedQuota(logType, startTimestamp, endTimestamp, modelName, username, tokenName, channel, group)
+	}
 	if err != nil {
 		common.ApiError(c, err)
 		return
@@ -0,0 +1,319 @@
+package controller
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/constant"
+	"github.com/QuantumNous/new-api/dto"
+	"github.com/QuantumNous/new-api/logger"
+	"github.com/QuantumNous/new-api/model"
+	"github.com/QuantumNous/new-api/service"
+	"github.com/QuantumNous/new-api/setting/operation_setting"
+	"github.com/QuantumNous/new-api/types"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+const (
+	fileListDefaultLimit = 10000
+	fileListMaxLimit     = 10000
+	// OpenAI 要求 expires_after[seconds] 介于 1 小时与 30 天之间
+	fileExpiresMinSeconds = 3600
+	fileExpiresMaxSeconds = 2592000
+)
+
+func openAIApiError(c *gin.Context, status int, errType string, code string, message string) {
+	c.JSON(status, gin.H{
+		"error": types.OpenAIError{
+			Message: message,
+			Type:    errType,
+			Code:    code,
+		},
+	})
+}
+
+func checkFileApiEnabled(c *gin.Context) bool {
+	if !operation_setting.GetFileSetting().Enabled {
+		openAIApiError(c, http.StatusNotImplemented, "new_api_error", "api_not_implemented", "Files API is disabled")
+		return false
+	}
+	return true
+}
+
+func fileLimitExceeded(c *gin.Context, maxFiles int) {
+	openAIApiError(c, http.StatusBadRequest, "invalid_request_error", "file_limit_exceeded",
+		fmt.Sprintf("Maximum number of files (%d) reached, please delete some files first", maxFiles))
+}
+
+func getUserFileOrAbort(c *gin.Context) *model.File {
+	fileId := c.Param("id")
+	file, err := model.GetUserFileById(c.GetInt("id"), fileId)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			openAIApiError(c, http.StatusNotFound, "invalid_request_error", "file_not_found", fmt.Sprintf("No such File object: %s", fileId))
+			return nil
+		}
+		logger.LogError(c.Request.Context(), fmt.Sprintf("failed to query file %s: %s", fileId, err.Error()))
+		openAIApiError(c, http.StatusInternalServerError, "server_error", "", "Failed to query file")
+		return nil
+	}
+	return file
+}
+
+// UploadFile POST /v1/files
+// 以流式方式读取 multipart 请求，文件内容直接写入存储后端，不会整体载入内存
+func UploadFile(c *gin.Context) {
+	if !checkFileApiEnabled(c) {
+		return
+	}
+	fileSetting := operation_setting.GetFileSetting()
+	userId := c.GetInt("id")
+	if fileSetting.MaxFilesPerUser > 0 {
+		count, err := model.CountUserFiles(userId)
+		if err != nil {
+			openAIApiError(c, http.StatusInternalServerError, "server_error", "", "Failed to count files")
+			return
+		}
+		if count >= int64(fileSetting.MaxFilesPerUser) {
+			fileLimitExceeded(c, fileSetting.MaxFilesPerUser)
+			return
+		}
+	}
+
+	reader, err := c.Request.MultipartReader()
+	if err != nil {
+		openAIApiError(c, http.StatusBadRequest, "invalid_request_error", "invalid_request", "Request must be multipart/form-data")
+		return
+	}
+	storage, err := common.GetDefaultFileStorage()
+	if err != nil {
+		logger.LogError(c.Request.Context(), "failed to get file storage: "+err.Error())
+		openAIApiError(c, http.StatusInternalServerError, "server_error", "", "File storage is not available")
+		return
+	}
+
+	file := &model.File{
+		UserId:  userId,
+		TokenId: c.GetInt("token_id"),
+		Storage: storage.Name(),
+	}
+	var expiresAnchor, expiresSeconds string
+	// 出错时清理已写入的文件
+	cleanup := func() {
+		if file.StorageKey != "" {
+			_ = storage.Delete(file.StorageKey)
+		}
+	}
+	for {
+		part, err := reader.NextPart()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			cleanup()
+			openAIApiError(c, http.StatusBadRequest, "invalid_request_error", "invalid_request", "Failed to parse multipart body: "+err.Error())
+			return
+		}
+		switch part.FormName() {
+		case "file":
+			if file.StorageKey != "" {
+				part.Close()
+				continue
+			}
+			key, size, err := storage.Put(part, fileSetting.GetMaxFileSizeBytes())
+			part.Close()
+			if err != nil {
+				if common.IsRequestBodyTooLargeError(err) {
+					openAIApiError(c, http.StatusRequestEntityTooLarge, "invalid_request_error", "file_too_large",
+						fmt.Sprintf("File exceeds the maximum allowed size of %d MB", fileSetting.MaxFileSizeMB))
+					return
+				}
+				logger.LogError(c.Request.Context(), "failed to store file: "+err.Error())
+				openAIApiError(c, http.StatusInternalServerError, "server_error", "", "Failed to store file")
+				return
+			}
+			file.StorageKey = key
+			file.Bytes = size
+			file.Filename = part.FileName()
+		case "purpose", "expires_after[anchor]", "expires_after[seconds]":
+			value, err := io.ReadAll(io.LimitReader(part, 1024))
+			part.Close()
+			if err != nil {
+				cleanup()
+				openAIApiError(c, http.StatusBadRequest, "invalid_request_error", "invalid_request", "Failed to parse multipart body: "+err.Error())
+				return
+			}
+			switch part.FormName() {
+			case "purpose":
+				file.Purpose = string(value)
+			case "expires_after[anchor]":
+				expiresAnchor = string(value)
+			default:
+				expiresSeconds = string(value)
+			}
+		default:
+			part.Close()
+		}
+	}
+
+	if file.StorageKey == "" {
+		openAIApiError(c, http.StatusBadRequest, "invalid_request_error", "invalid_request", "Missing required parameter: 'file'")
+		return
+	}
+	if !fileSetting.IsPurposeAllowed(file.Purpose) {
+		cleanup()
+		openAIApiError(c, http.StatusBadRequest, "invalid_request_error", "invalid_request", fmt.Sprintf("Invalid value for 'purpose': '%s'", file.Purpose))
+		return
+	}
+	if file.Filename == "" {
+		file.Filename = "file"
+	}
+	file.CreatedAt = common.GetTimestamp()
+	if expiresSeconds != "" {
+		seconds, err := strconv.ParseInt(expiresSeconds, 10, 64)
+		if err != nil || seconds < fileExpiresMinSeconds || seconds > fileExpiresMaxSeconds || (expiresAnchor != "" && expiresAnchor != "created_at") {
+			cleanup()
+			openAIApiError(c, http.StatusBadRequest, "invalid_request_error", "invalid_request", "Invalid value for 'expires_after'")
+			return
+		}
+		file.ExpiresAt = file.CreatedAt + seconds
+	}
+
+	file.FileId = model.GenerateFileID()
+	if fileSetting.ForwardUpstream {
+		group := common.GetContextKeyString(c, constant.ContextKeyUsingGroup)
+		if err := service.ForwardNewFile(c, file, group); err != nil {
+			if !errors.Is(err, service.ErrNoFileCapableChannel) {
+				cleanup()
+				logger.LogError(c.Request.Context(), "failed to forward file to upstream: "+err.Error())
+				openAIApiError(c, http.StatusBadGateway, "upstream_error", "", "Failed to upload file to upstream")
+				return
+			}
+			// 分组内没有支持文件接口的渠道，文件只保存在本站，仍可用于批处理
+			logger.LogInfo(c.Request.Context(), fmt.Sprintf("no file capable channel in group %s, file %s is kept locally", group, file.FileId))
+		}
+	}
+	// 上面的计数只是快速拒绝，并发上传时以插入后的计数为准
+	if err := file.InsertWithLimit(fileSetting.MaxFilesPerUser); err != nil {
+		if errors.Is(err, model.ErrFileLimitExceeded) {
+			_ = service.DeleteFile(c.Request.Context(), file)
+			fileLimitExceeded(c, fileSetting.MaxFilesPerUser)
+			return
+		}
+		cleanup()
+		logger.LogError(c.Request.Context(), "failed to save file record: "+err.Error())
+		openAIApiError(c, http.StatusInternalServerError, "server_error", "", "Failed to save file")
+		return
+	}
+	c.JSON(http.StatusOK, service.ToOpenAIFile(file))
+}
+
+// ListFiles GET /v1/files
+func ListFiles(c *gin.Context) {
+	if !checkFileApiEnabled(c) {
+		return
+	}
+	limit, _ := strconv.Atoi(c.Query("limit"))
+	if limit <= 0 {
+		limit = fileListDefaultLimit
+	}
+	if limit > fileListMaxLimit {
+		limit = fileListMaxLimit
+	}
+	order := c.DefaultQuery("order", "desc")
+	if order != "asc" && order != "desc" {
+		openAIApiError(c, http.StatusBadRequest, "invalid_request_error", "invalid_request", "Invalid value for 'order'")
+		return
+	}
+	// 多查询一条用于判断 has_more
+	files, err := model.GetUserFiles(c.GetInt("id"), c.Query("purpose"), c.Query("after"), limit+1, order)
+	if err != nil {
+		logger.LogError(c.Request.Context(), "failed to list files: "+err.Error())
+		openAIApiError(c, http.StatusInternalServerError, "server_error", "", "Failed to list files")
+		return
+	}
+	resp := dto.OpenAIFileList{
+		Object: "list",
+		Data:   make([]*dto.OpenAIFile, 0, len(files)),
+	}
+	if len(files) > limit {
+		files = files[:limit]
+		resp.HasMore = true
+	}
+	for _, file := range files {
+		resp.Data = append(resp.Data, service.ToOpenAIFile(file))
+	}
+	if len(resp.Data) > 0 {
+		resp.FirstId = resp.Data[0].Id
+		resp.LastId = resp.Data[len(resp.Data)-1].Id
+	}
+	c.JSON(http.StatusOK, resp)
+}
+
+// RetrieveFile GET /v1/files/:id
+func RetrieveFile(c *gin.Context) {
+	if !checkFileApiEnabled(c) {
+		return
+	}
+	file := getUserFileOrAbort(c)
+	if file == nil {
+		return
+	}
+	c.JSON(http.StatusOK, service.ToOpenAIFile(file))
+}
+
+// DeleteFile DELETE /v1/files/:id
+func DeleteFile(c *gin.Context) {
+	if !checkFileApiEnabled(c) {
+		return
+	}
+	file := getUserFileOrAbort(c)
+	if file == nil {
+		return
+	}
+	if err := service.DeleteFile(c.Request.Context(), file); err != nil {
+		logger.LogError(c.Request.Context(), fmt.Sprintf("failed to delete file %s: %s", file.FileId, err.Error()))
+		openAIApiError(c, http.StatusInternalServerError, "server_error", "", "Failed to delete file")
+		return
+	}
+	c.JSON(http.StatusOK, dto.OpenAIFileDeleteResponse{
+		Id:      file.FileId,
+		Object:  "file",
+		Deleted: true,
+	})
+}
+
+// RetrieveFileContent GET /v1/files/:id/content
+func RetrieveFileContent(c *gin.Context) {
+	if !checkFileApiEnabled(c) {
+		return
+	}
+	file := getUserFileOrAbort(c)
+	if file == nil {
+		return
+	}
+	content, err := service.OpenFileContent(c.Request.Context(), file)
+	if err != nil {
+		logger.LogError(c.Request.Context(), fmt.Sprintf("failed to open file %s: %s", file.FileId, err.Error()))
+		openAIApiError(c, http.StatusBadGateway, "server_error", "", "Failed to retrieve file content")
+		return
+	}
+	defer content.Close()
+
+	c.Header("Content-Type", "application/octet-stream")
+	c.Header("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": file.Filename}))
+	if file.Bytes > 0 && file.StorageKey != "" {
+		c.Header("Content-Length", strconv.FormatInt(file.Bytes, 10))
+	}
+	c.Status(http.StatusOK)
+	if _, err := io.Copy(c.Writer, content); err != nil {
+		logger.LogError(c.Request.Context(), fmt.Sprintf("failed to stream file %s: %s", file.FileId, err.Error()))
+	}
+}
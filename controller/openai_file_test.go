@@ -0,0 +1,325 @@
+package controller
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/constant"
+	"github.com/QuantumNous/new-api/i18n"
+	"github.com/QuantumNous/new-api/middleware"
+	"github.com/QuantumNous/new-api/model"
+	"github.com/QuantumNous/new-api/service"
+	"github.com/QuantumNous/new-api/setting/operation_setting"
+	"github.com/QuantumNous/new-api/types"
+
+	"github.com/gin-gonic/gin"
+)
+
+const fileTestUserId = 1
+
+// setupFileRoutingTest 准备两个渠道：优先级更高的 Claude 渠道，以及指向模拟上游、
+// 提供文件路由模型的 OpenAI 渠道，上传的文件固定到后者
+func setupFileRoutingTest(t *testing.T, forwardUpstream bool) (openaiChannel *model.Channel, claudeChannel *model.Channel) {
+	t.Helper()
+
+	initModelListColumnNames(t)
+	db := openTokenControllerTestDB(t)
+	if err := db.AutoMigrate(&model.User{}, &model.File{}, &model.Channel{}, &model.Ability{}); err != nil {
+		t.Fatalf("failed to migrate: %v", err)
+	}
+
+	storage := &memoryFileStorage{files: map[string][]byte{}}
+	common.RegisterFileStorage(storage)
+	t.Setenv("FILE_STORAGE_BACKEND", storage.Name())
+
+	memoryCacheEnabled := common.MemoryCacheEnabled
+	common.MemoryCacheEnabled = false
+	fileSetting := operation_setting.GetFileSetting()
+	previous := *fileSetting
+	fileSetting.Enabled = true
+	fileSetting.ForwardUpstream = forwardUpstream
+	fileSetting.RouteModel = "gpt-4o-files"
+	t.Cleanup(func() {
+		common.MemoryCacheEnabled = memoryCacheEnabled
+		*fileSetting = previous
+	})
+	service.InitHttpClient()
+	if err := i18n.Init(); err != nil {
+		t.Fatalf("failed to init i18n: %v", err)
+	}
+
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || r.URL.Path != "/v1/files" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"id":"file-upstream-1","object":"file","bytes":5,"filename":"input.jsonl","purpose":"user_data"}`))
+	}))
+	t.Cleanup(upstream.Close)
+
+	baseURL := upstream.URL
+	highPriority := int64(10)
+	openaiChannel = &model.Channel{Type: constant.ChannelTypeOpenAI, Key: "sk-openai", Name: "openai", Status: common.ChannelStatusEnabled, BaseURL: &baseURL, Models: "gpt-4o-mini,gpt-4o-files", Group: "default"}
+	claudeChannel = &model.Channel{Type: constant.ChannelTypeAnthropic, Key: "sk-claude", Name: "claude", Status: common.ChannelStatusEnabled, Models: "gpt-4o-mini,gpt-4o", Group: "default", Priority: &highPriority}
+	for _, channel := range []*model.Channel{openaiChannel, claudeChannel} {
+		if err := channel.Insert(); err != nil {
+			t.Fatalf("failed to create channel: %v", err)
+		}
+	}
+	return openaiChannel, claudeChannel
+}
+
+func newFileTestContext(method string, path string, body *bytes.Buffer, contentType string) (*gin.Context, *httptest.ResponseRecorder) {
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest(method, path, body)
+	c.Request.Header.Set("Content-Type", contentType)
+	c.Set("id", fileTestUserId)
+	common.SetContextKey(c, constant.ContextKeyUsingGroup, "default")
+	common.SetContextKey(c, constant.ContextKeyUserGroup, "default")
+	return c, w
+}
+
+func postTestFile() *httptest.ResponseRecorder {
+	var body bytes.Buffer
+	writer := multipart.NewWriter(&body)
+	_ = writer.WriteField("purpose", "user_data")
+	part, _ := writer.CreateFormFile("file", "input.jsonl")
+	_, _ = part.Write([]byte("hello"))
+	_ = writer.Close()
+
+	c, w := newFileTestContext(http.MethodPost, "/v1/files", &body, writer.FormDataContentType())
+	UploadFile(c)
+	return w
+}
+
+func uploadTestFile(t *testing.T) string {
+	t.Helper()
+
+	w := postTestFile()
+	if w.Code != http.StatusOK {
+		t.Fatalf("upload failed with status %d: %s", w.Code, w.Body.String())
+	}
+	var file struct {
+		Id string `json:"id"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &file); err != nil {
+		t.Fatalf("failed to decode upload response: %v", err)
+	}
+	return file.Id
+}
+
+// distributeTestRequest 让请求经过 Distribute 选择渠道，返回响应与选中的渠道 ID
+func distributeTestRequest(t *testing.T, modelName string, fileId string) (*httptest.ResponseRecorder, int) {
+	t.Helper()
+
+	body := `{"model":"` + modelName + `","input":[{"role":"user","content":[{"type":"input_text","text":"hi"}]}]}`
+	if fileId != "" {
+		body = `{"model":"` + modelName + `","input":[{"role":"user","content":[{"type":"input_file","file_id":"` + fileId + `"}]}]}`
+	}
+	c, w := newFileTestContext(http.MethodPost, "/v1/responses", bytes.NewBufferString(body), "application/json")
+	c.Request = c.Request.WithContext(context.Background())
+	defer common.CleanupBodyStorage(c)
+	middleware.Distribute()(c)
+	if c.IsAborted() {
+		return w, 0
+	}
+	return w, common.GetContextKeyInt(c, constant.ContextKeyChannelId)
+}
+
+func TestUploadFileForwardsAndRoutesBackToPinnedChannel(t *testing.T) {
+	openaiChannel, claudeChannel := setupFileRoutingTest(t, true)
+
+	fileId := uploadTestFile(t)
+	if fileId != "file-upstream-1" {
+		t.Fatalf("expected the upstream file id, got %s", fileId)
+	}
+	file, err := model.GetUserFileById(fileTestUserId, fileId)
+	if err != nil {
+		t.Fatalf("failed to load file: %v", err)
+	}
+	if file.ChannelId != openaiChannel.Id {
+		t.Fatalf("expected file pinned to channel %d, got %d", openaiChannel.Id, file.ChannelId)
+	}
+
+	// 不引用文件时按优先级选择渠道
+	if _, channelId := distributeTestRequest(t, "gpt-4o-mini", ""); channelId != claudeChannel.Id {
+		t.Fatalf("expected channel %d without file reference, got %d", claudeChannel.Id, channelId)
+	}
+	if _, channelId := distributeTestRequest(t, "gpt-4o-mini", fileId); channelId != openaiChannel.Id {
+		t.Fatalf("expected pinned channel %d, got %d", openaiChannel.Id, channelId)
+	}
+
+	// 固定的渠道不提供该模型时报错，而不是转发到无法识别文件的渠道
+	w, channelId := distributeTestRequest(t, "gpt-4o", fileId)
+	if channelId != 0 || w.Code != http.StatusBadRequest || !strings.Contains(w.Body.String(), fileId) {
+		t.Fatalf("expected a pinned channel error, got channel %d status %d: %s", channelId, w.Code, w.Body.String())
+	}
+
+	if err := model.UpdateChannelStatus(openaiChannel.Id, "", common.ChannelStatusManuallyDisabled, "test"); !err {
+		t.Fatalf("failed to disable channel")
+	}
+	w, channelId = distributeTestRequest(t, "gpt-4o-mini", fileId)
+	if channelId != 0 || w.Code != http.StatusBadRequest {
+		t.Fatalf("expected a pinned channel error after disabling, got channel %d status %d: %s", channelId, w.Code, w.Body.String())
+	}
+}
+
+func TestFilePinnedRequestDoesNotRetryOnOtherChannels(t *testing.T) {
+	openaiChannel, _ := setupFileRoutingTest(t, true)
+	fileId := uploadTestFile(t)
+
+	upstreamErr := types.NewErrorWithStatusCode(http.ErrHandlerTimeout, types.ErrorCodeBadResponseStatusCode, http.StatusInternalServerError)
+	distribute := func(fileId string) *gin.Context {
+		body := `{"model":"gpt-4o-mini","input":[{"role":"user","content":[{"type":"input_file","file_id":"` + fileId + `"}]}]}`
+		c, _ := newFileTestContext(http.MethodPost, "/v1/responses", bytes.NewBufferString(body), "application/json")
+		t.Cleanup(func() { common.CleanupBodyStorage(c) })
+		middleware.Distribute()(c)
+		return c
+	}
+
+	// 未引用文件的请求在 5xx 后照常重试
+	if c := distribute("file-unknown"); !shouldRetry(c, upstreamErr, 3) {
+		t.Fatalf("expected a retry without file reference")
+	}
+
+	c := distribute(fileId)
+	if channelId := common.GetContextKeyInt(c, constant.ContextKeyChannelId); channelId != openaiChannel.Id {
+		t.Fatalf("expected pinned channel %d, got %d", openaiChannel.Id, channelId)
+	}
+	if shouldRetry(c, upstreamErr, 3) {
+		t.Fatalf("expected no retry away from the pinned channel after a 5xx")
+	}
+	if shouldRetry(c, types.NewError(http.ErrHandlerTimeout, types.ErrorCodeChannelInvalidKey), 3) {
+		t.Fatalf("expected no retry away from the pinned channel after a channel error")
+	}
+	if shouldFallbackModel(c, upstreamErr) {
+		t.Fatalf("expected no model fallback away from the pinned channel")
+	}
+}
+
+func TestDistributeRejectsFilesPinnedToDifferentChannels(t *testing.T) {
+	_, claudeChannel := setupFileRoutingTest(t, true)
+	fileId := uploadTestFile(t)
+	other := &model.File{FileId: "file-upstream-2", UserId: fileTestUserId, ChannelId: claudeChannel.Id, UpstreamFileId: "file-upstream-2", Purpose: "user_data"}
+	if err := other.Insert(); err != nil {
+		t.Fatalf("failed to create file: %v", err)
+	}
+
+	body := `{"model":"gpt-4o-mini","input":[{"role":"user","content":[{"type":"input_file","file_id":"` + fileId + `"},{"type":"input_file","file_id":"` + other.FileId + `"}]}]}`
+	c, w := newFileTestContext(http.MethodPost, "/v1/responses", bytes.NewBufferString(body), "application/json")
+	defer common.CleanupBodyStorage(c)
+	middleware.Distribute()(c)
+	if !c.IsAborted() || w.Code != http.StatusBadRequest || !strings.Contains(w.Body.String(), other.FileId) {
+		t.Fatalf("expected a file channel conflict error, got status %d: %s", w.Code, w.Body.String())
+	}
+}
+
+func TestDistributeRejectsLocalFileReference(t *testing.T) {
+	_, claudeChannel := setupFileRoutingTest(t, false)
+
+	fileId := uploadTestFile(t)
+	if !strings.HasPrefix(fileId, "file-") || fileId == "file-upstream-1" {
+		t.Fatalf("expected a local file id, got %s", fileId)
+	}
+
+	w, channelId := distributeTestRequest(t, "gpt-4o-mini", fileId)
+	if channelId != 0 || w.Code != http.StatusBadRequest || !strings.Contains(w.Body.String(), fileId) {
+		t.Fatalf("expected a local file error, got channel %d status %d: %s", channelId, w.Code, w.Body.String())
+	}
+
+	// 其他用户的文件 ID 与未知 ID 不影响路由
+	if _, channelId := distributeTestRequest(t, "gpt-4o-mini", "file-unknown"); channelId != claudeChannel.Id {
+		t.Fatalf("expected channel %d for unknown file, got %d", claudeChannel.Id, channelId)
+	}
+
+	// 关闭文件接口后不再解析请求中的文件引用
+	operation_setting.GetFileSetting().Enabled = false
+	if _, channelId := distributeTestRequest(t, "gpt-4o-mini", fileId); channelId != claudeChannel.Id {
+		t.Fatalf("expected channel %d with files api disabled, got %d", claudeChannel.Id, channelId)
+	}
+}
+
+func TestUploadFileKeepsLocalCopyWithoutFileCapableChannel(t *testing.T) {
+	_, claudeChannel := setupFileRoutingTest(t, true)
+	// 只有 Claude 渠道提供该模型，分组内没有可以转发文件的渠道
+	operation_setting.GetFileSetting().RouteModel = "gpt-4o"
+
+	fileId := uploadTestFile(t)
+	if !strings.HasPrefix(fileId, "file-") || fileId == "file-upstream-1" {
+		t.Fatalf("expected a local file id, got %s", fileId)
+	}
+	file, err := model.GetUserFileById(fileTestUserId, fileId)
+	if err != nil {
+		t.Fatalf("failed to load file: %v", err)
+	}
+	if file.IsPinned() {
+		t.Fatalf("expected an unpinned file, got channel %d", file.ChannelId)
+	}
+	if _, channelId := distributeTestRequest(t, "gpt-4o-mini", ""); channelId != claudeChannel.Id {
+		t.Fatalf("expected channel %d, got %d", claudeChannel.Id, channelId)
+	}
+}
+
+// barrierFileStorage 等所有上传都写入文件后才返回，使它们都通过上传前的数量检查
+type barrierFileStorage struct {
+	*memoryFileStorage
+	arrived *sync.WaitGroup
+}
+
+func (s *barrierFileStorage) Name() string { return "file-limit-test" }
+
+func (s *barrierFileStorage) Put(reader io.Reader, maxBytes int64) (string, int64, error) {
+	key, size, err := s.memoryFileStorage.Put(reader, maxBytes)
+	s.arrived.Done()
+	s.arrived.Wait()
+	return key, size, err
+}
+
+func TestUploadFileLimitHoldsUnderConcurrentUploads(t *testing.T) {
+	setupFileRoutingTest(t, false)
+	const maxFiles, uploads = 3, 10
+	operation_setting.GetFileSetting().MaxFilesPerUser = maxFiles
+
+	var arrived sync.WaitGroup
+	arrived.Add(uploads)
+	storage := &barrierFileStorage{memoryFileStorage: &memoryFileStorage{files: map[string][]byte{}}, arrived: &arrived}
+	common.RegisterFileStorage(storage)
+	t.Setenv("FILE_STORAGE_BACKEND", storage.Name())
+
+	var wg sync.WaitGroup
+	var accepted atomic.Int32
+	for i := 0; i < uploads; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if postTestFile().Code == http.StatusOK {
+				accepted.Add(1)
+			}
+		}()
+	}
+	wg.Wait()
+
+	count, err := model.CountUserFiles(fileTestUserId)
+	if err != nil {
+		t.Fatalf("failed to count files: %v", err)
+	}
+	if count > maxFiles || count != int64(accepted.Load()) {
+		t.Fatalf("expected at most %d files matching %d accepted uploads, got %d", maxFiles, accepted.Load(), count)
+	}
+	w := postTestFile()
+	if count == maxFiles && (w.Code != http.StatusBadRequest || !strings.Contains(w.Body.String(), "file_limit_exceeded")) {
+		t.Fatalf("expected the limit error, got status %d: %s", w.Code, w.Body.String())
+	}
+}
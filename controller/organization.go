@@ -0,0 +1,580 @@
+package controller
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/i18n"
+	"github.com/QuantumNous/new-api/logger"
+	"github.com/QuantumNous/new-api/model"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+type OrganizationRequest struct {
+	Id          int    `json:"id"`
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	Status      int    `json:"status"`
+	OwnerId     int    `json:"owner_id"`
+}
+
+type OrganizationQuotaRequest struct {
+	Quota int `json:"quota"`
+}
+
+type OrganizationMemberRequest struct {
+	UserId         int    `json:"user_id"`
+	Username       string `json:"username"`
+	Role           string `json:"role"`
+	QuotaLimit     int    `json:"quota_limit"`
+	ResetUsedQuota bool   `json:"reset_used_quota"`
+}
+
+// ---- Admin APIs ----
+
+func GetAllOrganizations(c *gin.Context) {
+	pageInfo := common.GetPageQuery(c)
+	organizations, total, err := model.GetAllOrganizations(c.Query("keyword"), pageInfo.GetStartIdx(), pageInfo.GetPageSize())
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	pageInfo.SetTotal(int(total))
+	pageInfo.SetItems(organizations)
+	common.ApiSuccess(c, pageInfo)
+}
+
+func GetOrganization(c *gin.Context) {
+	organizationId, ok := parseOrganizationId(c)
+	if !ok {
+		return
+	}
+	organization, err := model.GetOrganizationById(organizationId)
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	subscriptions, err := model.GetAllOrganizationSubscriptions(organizationId)
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	common.ApiSuccess(c, gin.H{
+		"organization":  organization,
+		"subscriptions": subscriptions,
+	})
+}
+
+func CreateOrganization(c *gin.Context) {
+	var req OrganizationRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		common.ApiErrorI18n(c, i18n.MsgInvalidParams)
+		return
+	}
+	req.Name = strings.TrimSpace(req.Name)
+	if req.Name == "" {
+		common.ApiErrorI18n(c, i18n.MsgOrganizationNameEmpty)
+		return
+	}
+	organization := &model.Organization{
+		Name:        req.Name,
+		Description: req.Description,
+		Status:      model.OrganizationStatusEnabled,
+	}
+	if err := model.CreateOrganization(organization, req.OwnerId); err != nil {
+		if errors.Is(err, model.ErrUserAlreadyInOrganization) {
+			common.ApiErrorI18n(c, i18n.MsgOrganizationUserAlreadyMember)
+			return
+		}
+		common.ApiError(c, err)
+		return
+	}
+	common.ApiSuccess(c, organization)
+}
+
+func UpdateOrganization(c *gin.Context) {
+	var req OrganizationRequest
+	if err := c.ShouldBindJSON(&req); err != nil || req.Id <= 0 {
+		common.ApiErrorI18n(c, i18n.MsgInvalidParams)
+		return
+	}
+	organization, err := model.GetOrganizationById(req.Id)
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	if name := strings.TrimSpace(req.Name); name != "" {
+		organization.Name = name
+	}
+	organization.Description = req.Description
+	if req.Status == model.OrganizationStatusEnabled || req.Status == model.OrganizationStatusDisabled {
+		organization.Status = req.Status
+	}
+	if err := organization.Update(); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	common.ApiSuccess(c, organization)
+}
+
+func DeleteOrganization(c *gin.Context) {
+	organizationId, ok := parseOrganizationId(c)
+	if !ok {
+		return
+	}
+	if err := model.DeleteOrganization(organizationId); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	common.ApiSuccess(c, nil)
+}
+
+// AdjustOrganizationQuota 调整组织钱包余额，quota 为负数时扣减
+func AdjustOrganizationQuota(c *gin.Context) {
+	organizationId, ok := parseOrganizationId(c)
+	if !ok {
+		return
+	}
+	var req OrganizationQuotaRequest
+	if err := c.ShouldBindJSON(&req); err != nil || req.Quota == 0 {
+		common.ApiErrorI18n(c, i18n.MsgInvalidParams)
+		return
+	}
+	if err := model.IncreaseOrganizationQuota(organizationId, req.Quota); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	recordManageAudit(c, "organization.quota_adjust", map[string]interface{}{
+		"id":    organizationId,
+		"quota": logger.LogQuota(req.Quota),
+	})
+	common.ApiSuccess(c, nil)
+}
+
+func AdminBindOrganizationSubscription(c *gin.Context) {
+	if !requirePaymentCompliance(c) {
+		return
+	}
+	organizationId, ok := parseOrganizationId(c)
+	if !ok {
+		return
+	}
+	var req AdminCreateUserSubscriptionRequest
+	if err := c.ShouldBindJSON(&req); err != nil || req.PlanId <= 0 {
+		common.ApiErrorI18n(c, i18n.MsgInvalidParams)
+		return
+	}
+	if _, err := model.GetOrganizationById(organizationId); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	if err := model.AdminBindOrganizationSubscription(organizationId, req.PlanId); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	common.ApiSuccess(c, nil)
+}
+
+func GetOrganizationMembers(c *gin.Context) {
+	organizationId, ok := parseOrganizationId(c)
+	if !ok {
+		return
+	}
+	listOrganizationMembers(c, organizationId)
+}
+
+func AddOrganizationMember(c *gin.Context) {
+	organizationId, ok := parseOrganizationId(c)
+	if !ok {
+		return
+	}
+	addOrganizationMember(c, organizationId, nil)
+}
+
+func UpdateOrganizationMember(c *gin.Context) {
+	organizationId, ok := parseOrganizationId(c)
+	if !ok {
+		return
+	}
+	updateOrganizationMember(c, organizationId, nil)
+}
+
+func RemoveOrganizationMember(c *gin.Context) {
+	organizationId, ok := parseOrganizationId(c)
+	if !ok {
+		return
+	}
+	removeOrganizationMember(c, organizationId, nil)
+}
+
+// ---- Member APIs ----
+
+// GetOrganizationSelf 返回当前用户所属组织、成员信息与组织订阅，不属于任何组织时 organization 为 null
+func GetOrganizationSelf(c *gin.Context) {
+	member, err := model.GetOrganizationMemberByUserId(c.GetInt("id"))
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	if member == nil {
+		common.ApiSuccess(c, gin.H{"organization": nil})
+		return
+	}
+	organization, err := model.GetOrganizationById(member.OrganizationId)
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	subscriptions, err := model.GetAllOrganizationSubscriptions(member.OrganizationId)
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	common.ApiSuccess(c, gin.H{
+		"organization":  organization,
+		"member":        member,
+		"subscriptions": subscriptions,
+	})
+}
+
+func GetOrganizationSelfMembers(c *gin.Context) {
+	manager, ok := requireOrganizationManager(c)
+	if !ok {
+		return
+	}
+	listOrganizationMembers(c, manager.OrganizationId)
+}
+
+// AddOrganizationSelfMember 组织 owner / admin 邀请用户加入组织，返回待用户接受的邀请
+func AddOrganizationSelfMember(c *gin.Context) {
+	manager, ok := requireOrganizationManager(c)
+	if !ok {
+		return
+	}
+	addOrganizationMember(c, manager.OrganizationId, manager)
+}
+
+func UpdateOrganizationSelfMember(c *gin.Context) {
+	manager, ok := requireOrganizationManager(c)
+	if !ok {
+		return
+	}
+	updateOrganizationMember(c, manager.OrganizationId, manager)
+}
+
+func RemoveOrganizationSelfMember(c *gin.Context) {
+	manager, ok := requireOrganizationManager(c)
+	if !ok {
+		return
+	}
+	removeOrganizationMember(c, manager.OrganizationId, manager)
+}
+
+// GetOrganizationSelfMemberInvitations 组织 owner / admin 查看组织发出的待处理邀请
+func GetOrganizationSelfMemberInvitations(c *gin.Context) {
+	manager, ok := requireOrganizationManager(c)
+	if !ok {
+		return
+	}
+	invitations, err := model.GetOrganizationInvitations(manager.OrganizationId)
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	common.ApiSuccess(c, invitations)
+}
+
+// RevokeOrganizationSelfMemberInvitation 组织 owner / admin 撤销发给用户的邀请
+func RevokeOrganizationSelfMemberInvitation(c *gin.Context) {
+	manager, ok := requireOrganizationManager(c)
+	if !ok {
+		return
+	}
+	userId, _ := strconv.Atoi(c.Param("user_id"))
+	if err := model.DeleteOrganizationInvitation(manager.OrganizationId, userId); err != nil {
+		respondOrganizationInvitationError(c, err)
+		return
+	}
+	common.ApiSuccess(c, nil)
+}
+
+// GetOrganizationSelfInvitations 返回当前用户收到的组织邀请
+func GetOrganizationSelfInvitations(c *gin.Context) {
+	invitations, err := model.GetUserOrganizationInvitations(c.GetInt("id"))
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	common.ApiSuccess(c, invitations)
+}
+
+// AcceptOrganizationSelfInvitation 当前用户接受邀请加入组织
+func AcceptOrganizationSelfInvitation(c *gin.Context) {
+	invitationId, _ := strconv.Atoi(c.Param("id"))
+	member, err := model.AcceptOrganizationInvitation(invitationId, c.GetInt("id"))
+	if err != nil {
+		if errors.Is(err, model.ErrUserAlreadyInOrganization) {
+			common.ApiErrorI18n(c, i18n.MsgOrganizationUserAlreadyMember)
+			return
+		}
+		respondOrganizationInvitationError(c, err)
+		return
+	}
+	common.ApiSuccess(c, member)
+}
+
+// DeclineOrganizationSelfInvitation 当前用户拒绝组织邀请
+func DeclineOrganizationSelfInvitation(c *gin.Context) {
+	invitationId, _ := strconv.Atoi(c.Param("id"))
+	if err := model.DeleteUserOrganizationInvitation(invitationId, c.GetInt("id")); err != nil {
+		respondOrganizationInvitationError(c, err)
+		return
+	}
+	common.ApiSuccess(c, nil)
+}
+
+// LeaveOrganizationSelf 当前用户退出所属组织
+func LeaveOrganizationSelf(c *gin.Context) {
+	if err := model.LeaveOrganization(c.GetInt("id")); err != nil {
+		switch {
+		case errors.Is(err, gorm.ErrRecordNotFound):
+			common.ApiErrorI18n(c, i18n.MsgOrganizationNotMember)
+		case errors.Is(err, model.ErrOrganizationLastOwner):
+			common.ApiErrorI18n(c, i18n.MsgOrganizationLastOwner)
+		default:
+			common.ApiError(c, err)
+		}
+		return
+	}
+	common.ApiSuccess(c, nil)
+}
+
+// organizationScopeMembers 处理日志与用量接口的 scope=organization 参数：
+// 组织 owner / admin 可以查看全部成员加入组织之后的数据，并可通过 username 筛选单个成员。
+// 未指定 scope 时返回 nil，调用方按当前用户查询；返回 false 时已写入错误响应
+func organizationScopeMembers(c *gin.Context) ([]model.OrganizationMemberScope, bool) {
+	if c.Query("scope") != "organization" {
+		return nil, true
+	}
+	manager, ok := requireOrganizationManager(c)
+	if !ok {
+		return nil, false
+	}
+	members, err := model.GetOrganizationMembers(manager.OrganizationId)
+	if err != nil {
+		common.ApiError(c, err)
+		return nil, false
+	}
+	username := strings.TrimSpace(c.Query("username"))
+	scopes := make([]model.OrganizationMemberScope, 0, len(members))
+	for _, member := range members {
+		if username == "" || member.Username == username {
+			scopes = append(scopes, model.OrganizationMemberScope{UserId: member.UserId, JoinedAt: member.CreatedAt})
+		}
+	}
+	return scopes, true
+}
+
+// ---- helpers ----
+
+func parseOrganizationId(c *gin.Context) (int, bool) {
+	organizationId, _ := strconv.Atoi(c.Param("id"))
+	if organizationId <= 0 {
+		common.ApiErrorI18n(c, i18n.MsgOrganizationInvalidId)
+		return 0, false
+	}
+	return organizationId, true
+}
+
+// requireOrganizationManager 返回当前用户的组织成员关系，要求为组织 owner 或 admin
+func requireOrganizationManager(c *gin.Context) (*model.OrganizationMember, bool) {
+	member, err := model.GetOrganizationMemberByUserId(c.GetInt("id"))
+	if err != nil {
+		common.ApiError(c, err)
+		return nil, false
+	}
+	if member == nil {
+		common.ApiErrorI18n(c, i18n.MsgOrganizationNotMember)
+		return nil, false
+	}
+	if !member.IsManager() {
+		common.ApiErrorI18n(c, i18n.MsgOrganizationPermissionDenied)
+		return nil, false
+	}
+	return member, true
+}
+
+// checkOrganizationRoleChange 组织 admin 只能管理普通成员，owner / admin 角色的授予与撤销仅限组织 owner；
+// actor 为 nil 表示系统管理员操作，不受限制
+func checkOrganizationRoleChange(c *gin.Context, actor *model.OrganizationMember, roles ...string) bool {
+	if actor == nil || actor.Role == model.OrganizationRoleOwner {
+		return true
+	}
+	for _, role := range roles {
+		if role == model.OrganizationRoleOwner || role == model.OrganizationRoleAdmin {
+			common.ApiErrorI18n(c, i18n.MsgOrganizationOwnerRequired)
+			return false
+		}
+	}
+	return true
+}
+
+func listOrganizationMembers(c *gin.Context, organizationId int) {
+	members, err := model.GetOrganizationMembers(organizationId)
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	common.ApiSuccess(c, members)
+}
+
+func addOrganizationMember(c *gin.Context, organizationId int, actor *model.OrganizationMember) {
+	var req OrganizationMemberRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		common.ApiErrorI18n(c, i18n.MsgInvalidParams)
+		return
+	}
+	if req.Role == "" {
+		req.Role = model.OrganizationRoleMember
+	}
+	if !model.IsValidOrganizationRole(req.Role) {
+		common.ApiErrorI18n(c, i18n.MsgOrganizationInvalidRole)
+		return
+	}
+	if req.QuotaLimit < 0 {
+		common.ApiErrorI18n(c, i18n.MsgOrganizationQuotaLimitNegative)
+		return
+	}
+	if !checkOrganizationRoleChange(c, actor, req.Role) {
+		return
+	}
+	userId := req.UserId
+	if userId <= 0 && strings.TrimSpace(req.Username) != "" {
+		id, err := model.GetUserIdByUsername(strings.TrimSpace(req.Username))
+		if err != nil {
+			common.ApiError(c, err)
+			return
+		}
+		userId = id
+	}
+	if userId <= 0 {
+		common.ApiErrorI18n(c, i18n.MsgUserNotExists)
+		return
+	}
+	if actor != nil {
+		// 组织管理者只能发出邀请，用户接受后才加入组织并改由组织付费
+		invitation := &model.OrganizationInvitation{
+			OrganizationId: organizationId,
+			UserId:         userId,
+			Role:           req.Role,
+			QuotaLimit:     req.QuotaLimit,
+			InviterId:      actor.UserId,
+		}
+		if err := model.CreateOrganizationInvitation(invitation); err != nil {
+			switch {
+			case errors.Is(err, model.ErrUserAlreadyInOrganization):
+				common.ApiErrorI18n(c, i18n.MsgOrganizationUserAlreadyMember)
+			case errors.Is(err, model.ErrOrganizationInvitationExists):
+				common.ApiErrorI18n(c, i18n.MsgOrganizationInvitationExists)
+			default:
+				common.ApiError(c, err)
+			}
+			return
+		}
+		common.ApiSuccess(c, invitation)
+		return
+	}
+	member := &model.OrganizationMember{
+		OrganizationId: organizationId,
+		UserId:         userId,
+		Role:           req.Role,
+		QuotaLimit:     req.QuotaLimit,
+	}
+	if err := model.AddOrganizationMember(member); err != nil {
+		if errors.Is(err, model.ErrUserAlreadyInOrganization) {
+			common.ApiErrorI18n(c, i18n.MsgOrganizationUserAlreadyMember)
+			return
+		}
+		common.ApiError(c, err)
+		return
+	}
+	common.ApiSuccess(c, member)
+}
+
+func updateOrganizationMember(c *gin.Context, organizationId int, actor *model.OrganizationMember) {
+	var req OrganizationMemberRequest
+	if err := c.ShouldBindJSON(&req); err != nil || req.UserId <= 0 {
+		common.ApiErrorI18n(c, i18n.MsgInvalidParams)
+		return
+	}
+	if req.QuotaLimit < 0 {
+		common.ApiErrorI18n(c, i18n.MsgOrganizationQuotaLimitNegative)
+		return
+	}
+	member, ok := getOrganizationMemberOrError(c, organizationId, req.UserId)
+	if !ok {
+		return
+	}
+	if req.Role != "" && req.Role != member.Role {
+		if !model.IsValidOrganizationRole(req.Role) {
+			common.ApiErrorI18n(c, i18n.MsgOrganizationInvalidRole)
+			return
+		}
+		if !checkOrganizationRoleChange(c, actor, req.Role, member.Role) {
+			return
+		}
+		member.Role = req.Role
+	} else if !checkOrganizationRoleChange(c, actor, member.Role) {
+		return
+	}
+	member.QuotaLimit = req.QuotaLimit
+	if req.ResetUsedQuota {
+		member.UsedQuota = 0
+	}
+	if err := member.Update(); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	common.ApiSuccess(c, member)
+}
+
+func removeOrganizationMember(c *gin.Context, organizationId int, actor *model.OrganizationMember) {
+	userId, _ := strconv.Atoi(c.Param("user_id"))
+	member, ok := getOrganizationMemberOrError(c, organizationId, userId)
+	if !ok {
+		return
+	}
+	if !checkOrganizationRoleChange(c, actor, member.Role) {
+		return
+	}
+	if err := model.RemoveOrganizationMember(organizationId, userId); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	common.ApiSuccess(c, nil)
+}
+
+func respondOrganizationInvitationError(c *gin.Context, err error) {
+	if errors.Is(err, model.ErrOrganizationInvitationNotFound) {
+		common.ApiErrorI18n(c, i18n.MsgOrganizationInvitationNotFound)
+		return
+	}
+	common.ApiError(c, err)
+}
+
+func getOrganizationMemberOrError(c *gin.Context, organizationId int, userId int) (*model.OrganizationMember, bool) {
+	member, err := model.GetOrganizationMember(organizationId, userId)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			common.ApiErrorI18n(c, i18n.MsgOrganizationMemberNotFound)
+			return nil, false
+		}
+		common.ApiError(c, err)
+		return nil, false
+	}
+	return member, true
+}
@@ -0,0 +1,23 @@
+package controller
+
+import (
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/model"
+
+	"github.com/gin-gonic/gin"
+)
+
+// GetPayloadLogs 按 request_id 查看留存的请求/响应体（已脱敏），request_id 与消费日志中的一致
+func GetPayloadLogs(c *gin.Context) {
+	requestId := c.Query("request_id")
+	if requestId == "" {
+		common.ApiErrorMsg(c, "request_id 不能为空")
+		return
+	}
+	logs, err := model.GetPayloadLogsByRequestId(requestId)
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	common.ApiSuccess(c, logs)
+}
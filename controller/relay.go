@@ -15,13 +15,18 @@ import (
 	"github.com/QuantumNous/new-api/logger"
 	"github.com/QuantumNous/new-api/middleware"
 	"github.com/QuantumNous/new-api/model"
+	channelbreaker "github.com/QuantumNous/new-api/pkg/channel_breaker"
+	channelperf "github.com/QuantumNous/new-api/pkg/channel_perf"
 	perfmetrics "github.com/QuantumNous/new-api/pkg/perf_metrics"
+	prommetrics "github.com/QuantumNous/new-api/pkg/prom_metrics"
+	"github.com/QuantumNous/new-api/pkg/tracing"
 	"github.com/QuantumNous/new-api/relay"
 	relaycommon "github.com/QuantumNous/new-api/relay/common"
 	relayconstant "github.com/QuantumNous/new-api/relay/constant"
 	"github.com/QuantumNous/new-api/relay/helper"
 	"github.com/QuantumNous/new-api/service"
 	"github.com/QuantumNous/new-api/setting"
+	"github.com/QuantumNous/new-api/setting/model_setting"
 	"github.com/QuantumNous/new-api/setting/operation_setting"
 	"github.com/QuantumNous/new-api/types"
 
@@ -123,11 +128,26 @@ func Relay(c *gin.Context, relayFormat types.RelayFormat) {
 		return
 	}
 
+	defer func() {
+		recordRelayMetrics(c, relayInfo, newAPIError)
+	}()
+
+	// 开启了留存的请求在错误响应写出之前结束捕获，错误内容由 newAPIError 记录
+	if capture := service.StartPayloadCapture(c, relayInfo); capture != nil {
+		defer func() {
+			capture.Finish(c, relayInfo, newAPIError)
+		}()
+	}
+
+	// 命中响应缓存时在计价前记录命中倍率，预扣费后直接回放，不再请求上游
+	cacheEntry := service.LookupResponseCache(c, relayInfo)
+
 	needSensitiveCheck := setting.ShouldCheckPromptSensitive()
 	needCountToken := constant.CountToken
+	needModeration := service.ShouldModeratePrompt(relayInfo)
 	// Avoid building huge CombineText (strings.Join) when token counting and sensitive check are both disabled.
 	var meta *types.TokenCountMeta
-	if needSensitiveCheck || needCountToken {
+	if needSensitiveCheck || needCountToken || needModeration {
 		meta = request.GetTokenCountMeta()
 	} else {
 		meta = fastTokenCountMetaForPricing(request)
@@ -160,8 +180,14 @@ func Relay(c *gin.Context, relayFormat types.RelayFormat) {
 
 	if priceData.FreeModel {
 		logger.LogInfo(c, fmt.Sprintf("模型 %s 免费，跳过预扣费", relayInfo.OriginModelName))
+		newAPIError = service.CheckTokenLimits(c, relayInfo.TokenId, relayInfo.OriginModelName, 0)
+		if newAPIError != nil {
+			return
+		}
 	} else {
+		_, endSpan := tracing.StartGin(c, "relay.pre_consume", relayInfo.TraceAttributes()...)
 		newAPIError = service.PreConsumeBilling(c, priceData.QuotaToPreConsume, relayInfo)
+		endSpan(tracingError(newAPIError))
 		if newAPIError != nil {
 			return
 		}
@@ -171,13 +197,42 @@ func Relay(c *gin.Context, relayFormat types.RelayFormat) {
 		// Only return quota if downstream failed and quota was actually pre-consumed
 		if newAPIError != nil {
 			newAPIError = service.NormalizeViolationFeeError(newAPIError)
-			if relayInfo.Billing != nil {
+			if relayInfo.ModerationQuota > 0 {
+				// 已经发生的审核调用不退还，只结算审核费用，其余预扣额度随结算退回
+				if err := service.SettleBilling(c, relayInfo, 0); err != nil {
+					logger.LogError(c, "error settling moderation billing: "+err.Error())
+				}
+			} else if relayInfo.Billing != nil {
 				relayInfo.Billing.Refund(c)
 			}
 			service.ChargeViolationFeeIfNeeded(c, relayInfo, newAPIError)
 		}
 	}()
 
+	// 外部审核放在预扣费之后，审核调用可以按用户计费，拒绝时预扣的额度随上面的 defer 退回
+	if needModeration && meta != nil {
+		newAPIError = service.ModeratePrompt(c, relayInfo, helper.RedactModerationInput(relayInfo, meta.CombineText))
+		if newAPIError != nil {
+			return
+		}
+	}
+
+	if cacheEntry != nil {
+		service.ReplayResponseCache(c, relayInfo, cacheEntry)
+		return
+	}
+	// 影子流量在主请求修改上下文之前复制，主请求结束后把对比数据交给影子请求
+	if shadow := startShadowRelay(c, relayInfo, relayFormat, requestId); shadow != nil {
+		defer func() {
+			shadow.finishPrimary(c, relayInfo, newAPIError)
+		}()
+	}
+	if capture := service.StartResponseCapture(c); capture != nil {
+		defer func() {
+			capture.Finish(c, relayInfo, newAPIError == nil)
+		}()
+	}
+
 	retryParam := &service.RetryParam{
 		Ctx:         c,
 		TokenGroup:  relayInfo.TokenGroup,
@@ -188,52 +243,58 @@ func Relay(c *gin.Context, relayFormat types.RelayFormat) {
 	relayInfo.RetryIndex = 0
 	relayInfo.LastError = nil
 
-	for ; retryParam.GetRetry() <= common.RetryTimes; retryParam.IncreaseRetry() {
-		relayInfo.RetryIndex = retryParam.GetRetry()
-		channel, channelErr := getChannel(c, relayInfo, retryParam)
-		if channelErr != nil {
-			logger.LogError(c, channelErr.Error())
-			newAPIError = channelErr
-			break
-		}
-
-		addUsedChannel(c, channel.Id)
-		bodyStorage, bodyErr := common.GetBodyStorage(c)
-		if bodyErr != nil {
-			// Ensure consistent 413 for oversized bodies even when error occurs later (e.g., retry path)
-			if common.IsRequestBodyTooLargeError(bodyErr) || errors.Is(bodyErr, common.ErrRequestBodyTooLarge) {
-				newAPIError = types.NewErrorWithStatusCode(bodyErr, types.ErrorCodeReadRequestBodyFailed, http.StatusRequestEntityTooLarge, types.ErrOptionWithSkipRetry())
-			} else {
-				newAPIError = types.NewErrorWithStatusCode(bodyErr, types.ErrorCodeReadRequestBodyFailed, http.StatusBadRequest, types.ErrOptionWithSkipRetry())
+	fallbackModels := model_setting.GetModelFallbackChain(relayInfo.OriginModelName)
+	for {
+		for ; retryParam.GetRetry() <= common.RetryTimes; retryParam.IncreaseRetry() {
+			relayInfo.RetryIndex = retryParam.GetRetry()
+			_, endSpan := tracing.StartGin(c, "relay.select_channel", tracing.AttrRetry.Int(relayInfo.RetryIndex))
+			channel, channelErr := getChannel(c, relayInfo, retryParam)
+			endSpan(tracingError(channelErr))
+			if channelErr != nil {
+				logger.LogError(c, channelErr.Error())
+				newAPIError = channelErr
+				break
 			}
-			break
-		}
-		c.Request.Body = io.NopCloser(bodyStorage)
 
-		switch relayFormat {
-		case types.RelayFormatOpenAIRealtime:
-			newAPIError = relay.WssHelper(c, relayInfo)
-		case types.RelayFormatClaude:
-			newAPIError = relay.ClaudeHelper(c, relayInfo)
-		case types.RelayFormatGemini:
-			newAPIError = geminiRelayHandler(c, relayInfo)
-		default:
-			newAPIError = relayHandler(c, relayInfo)
-		}
+			addUsedChannel(c, channel.Id)
+			bodyStorage, bodyErr := common.GetBodyStorage(c)
+			if bodyErr != nil {
+				// Ensure consistent 413 for oversized bodies even when error occurs later (e.g., retry path)
+				if common.IsRequestBodyTooLargeError(bodyErr) || errors.Is(bodyErr, common.ErrRequestBodyTooLarge) {
+					newAPIError = types.NewErrorWithStatusCode(bodyErr, types.ErrorCodeReadRequestBodyFailed, http.StatusRequestEntityTooLarge, types.ErrOptionWithSkipRetry())
+				} else {
+					newAPIError = types.NewErrorWithStatusCode(bodyErr, types.ErrorCodeReadRequestBodyFailed, http.StatusBadRequest, types.ErrOptionWithSkipRetry())
+				}
+				break
+			}
+			c.Request.Body = io.NopCloser(bodyStorage)
 
-		if newAPIError == nil {
-			relayInfo.LastError = nil
-			return
-		}
+			if relayInfo.RetryIndex == 0 && shouldHedgeRelay(c, relayInfo, relayFormat) {
+				channel, newAPIError = relayHedged(c, relayInfo, relayFormat, channel, requestId)
+			} else {
+				newAPIError = relayAttempt(c, relayInfo, relayFormat, channel, requestId)
+			}
+			if newAPIError == nil {
+				relayInfo.LastError = nil
+				return
+			}
 
-		newAPIError = service.NormalizeViolationFeeError(newAPIError)
-		relayInfo.LastError = newAPIError
+			newAPIError = service.NormalizeViolationFeeError(newAPIError)
+			relayInfo.LastError = newAPIError
 
-		processChannelError(c, *types.NewChannelError(channel.Id, channel.Type, channel.Name, channel.ChannelInfo.IsMultiKey, common.GetContextKeyString(c, constant.ContextKeyChannelKey), channel.GetAutoBan()), newAPIError)
+			processChannelError(c, *types.NewChannelError(channel.Id, channel.Type, channel.Name, channel.ChannelInfo.IsMultiKey, common.GetContextKeyString(c, constant.ContextKeyChannelKey), channel.GetAutoBan()), newAPIError)
 
-		if !shouldRetry(c, newAPIError, common.RetryTimes-retryParam.GetRetry()) {
+			if !shouldRetry(c, newAPIError, common.RetryTimes-retryParam.GetRetry()) {
+				break
+			}
+		}
+		// 原模型的渠道全部失败后改用备选模型，重新从第一次尝试开始选择渠道
+		if len(fallbackModels) == 0 || relayFormat == types.RelayFormatOpenAIRealtime ||
+			!shouldFallbackModel(c, newAPIError) || !switchToFallbackModel(c, relayInfo, meta, &fallbackModels) {
 			break
 		}
+		retryParam.ModelName = relayInfo.OriginModelName
+		retryParam.SetRetry(0)
 	}
 
 	useChannel := c.GetStringSlice("use_channel")
@@ -248,6 +309,111 @@ func Relay(c *gin.Context, relayFormat types.RelayFormat) {
 	}
 }
 
+// relayAttempt 在已选定渠道的上下文上执行一次转发，并记录渠道的熔断、延迟与首字时间数据
+func relayAttempt(c *gin.Context, relayInfo *relaycommon.RelayInfo, relayFormat types.RelayFormat, channel *model.Channel, requestId string) (newAPIError *types.NewAPIError) {
+	// 每次尝试一个 span，DoRequest/DoResponse/结算等子阶段挂在其下
+	_, endAttemptSpan := tracing.StartGin(c, "relay.attempt", append(
+		tracing.RelayAttributes(requestId, channel.Id, relayInfo.OriginModelName, relayInfo.UsingGroup),
+		tracing.AttrRetry.Int(relayInfo.RetryIndex))...)
+	attemptStart := time.Now()
+	keyIndex := 0
+	if common.GetContextKeyBool(c, constant.ContextKeyChannelIsMultiKey) {
+		keyIndex = common.GetContextKeyInt(c, constant.ContextKeyChannelMultiKeyIndex)
+	}
+	channelbreaker.Begin(channel.Id, relayInfo.OriginModelName, keyIndex)
+	releaseInFlight := channelperf.Acquire(channel.Id)
+	// handler panic 时也要释放并发计数，正常路径下在本次尝试结束后立即释放
+	defer releaseInFlight()
+	switch relayFormat {
+	case types.RelayFormatOpenAIRealtime:
+		newAPIError = relay.WssHelper(c, relayInfo)
+	case types.RelayFormatClaude:
+		newAPIError = relay.ClaudeHelper(c, relayInfo)
+	case types.RelayFormatGemini:
+		newAPIError = geminiRelayHandler(c, relayInfo)
+	default:
+		newAPIError = relayHandler(c, relayInfo)
+	}
+	endAttemptSpan(tracingError(newAPIError))
+	releaseInFlight()
+	// 对冲请求中被放弃的一方是主动取消的，不计入渠道健康数据
+	if relayInfo.Hedge.Abandoned() {
+		channelbreaker.Cancel(channel.Id, relayInfo.OriginModelName, keyIndex)
+		return newAPIError
+	}
+	attemptFailed := isChannelAttemptFailure(newAPIError)
+	channelperf.Record(channel.Id, relayInfo.OriginModelName, time.Since(attemptStart), !attemptFailed)
+	if relayInfo.IsStream && relayInfo.HasSendResponse() && relayInfo.FirstResponseTime.After(attemptStart) {
+		channelperf.RecordFirstToken(channel.Id, relayInfo.OriginModelName, relayInfo.FirstResponseTime.Sub(attemptStart))
+	}
+	channelbreaker.Record(channel.Id, relayInfo.OriginModelName, keyIndex, !attemptFailed)
+
+	recordUpstreamMetrics(channel.Id, relayInfo.OriginModelName, newAPIError)
+	return newAPIError
+}
+
+func recordRelayMetrics(c *gin.Context, info *relaycommon.RelayInfo, apiErr *types.NewAPIError) {
+	if !common.MetricsEnabled {
+		return
+	}
+	statusCode := http.StatusOK
+	if apiErr != nil {
+		statusCode = apiErr.StatusCode
+	}
+	var firstToken time.Duration
+	if info.IsStream && info.HasSendResponse() {
+		firstToken = info.FirstResponseTime.Sub(info.StartTime)
+	}
+	prommetrics.RecordRelayRequest(info.OriginModelName, info.UsingGroup, common.GetContextKeyInt(c, constant.ContextKeyChannelId),
+		statusCode, time.Since(info.StartTime), firstToken, info.RetryIndex)
+}
+
+func recordUpstreamMetrics(channelId int, modelName string, apiErr *types.NewAPIError) {
+	if !common.MetricsEnabled {
+		return
+	}
+	statusCode := http.StatusOK
+	if apiErr != nil {
+		statusCode = apiErr.StatusCode
+	}
+	prommetrics.RecordUpstreamResponse(channelId, modelName, statusCode)
+}
+
+// shouldAutoBanChannel 开启熔断后，按状态码、关键词判定的错误交给（渠道, 模型）熔断器处理，
+// 只有明确的渠道级错误才禁用整个渠道，除非配置了保留原有的自动禁用
+func shouldAutoBanChannel(err *types.NewAPIError) bool {
+	if !service.ShouldDisableChannel(err) {
+		return false
+	}
+	// 开启上游限流冷却后，429 交给冷却处理，渠道到期后自动恢复
+	if err.StatusCode == http.StatusTooManyRequests {
+		if cooldown := operation_setting.GetChannelCooldownSetting(); cooldown.Enabled && !cooldown.KeepAutoBan {
+			return false
+		}
+	}
+	setting := operation_setting.GetChannelBreakerSetting()
+	if !setting.Enabled || setting.KeepAutoBan {
+		return true
+	}
+	return types.IsChannelError(err)
+}
+
+// isChannelAttemptFailure 判断一次转发尝试是否应计为渠道失败：请求本身不合法等不重试的错误与渠道健康状况无关
+func isChannelAttemptFailure(apiErr *types.NewAPIError) bool {
+	if apiErr == nil {
+		return false
+	}
+	return types.IsChannelError(apiErr) || !types.IsSkipRetryError(apiErr)
+}
+
+// tracingError 避免 nil 的 *types.NewAPIError 被包装成非 nil 的 error 接口
+func tracingError(apiErr *types.NewAPIError) error {
+	if apiErr == nil {
+		return nil
+	}
+	return apiErr
+}
+
 var upgrader = websocket.Upgrader{
 	Subprotocols: []string{"realtime"}, // WS 握手支持的协议，如果有使用 Sec-WebSocket-Protocol，则必须在此声明对应的 Protocol TODO add other protocol
 	CheckOrigin: func(r *http.Request) bool {
@@ -322,6 +488,12 @@ func getChannel(c *gin.Context, info *relaycommon.RelayInfo, retryParam *service
 	return channel, nil
 }
 
+// isFilePinnedRequest 请求引用了固定到上游渠道的文件时为 true
+func isFilePinnedRequest(c *gin.Context) bool {
+	_, ok := common.GetContextKey(c, constant.ContextKeyFilePinnedChannelId)
+	return ok
+}
+
 func shouldRetry(c *gin.Context, openaiErr *types.NewAPIError, retryTimes int) bool {
 	if openaiErr == nil {
 		return false
@@ -329,6 +501,10 @@ func shouldRetry(c *gin.Context, openaiErr *types.NewAPIError, retryTimes int) b
 	if service.ShouldSkipRetryAfterChannelAffinityFailure(c) {
 		return false
 	}
+	// 请求引用的文件只能由固定的渠道识别，换用其他渠道必然失败
+	if isFilePinnedRequest(c) {
+		return false
+	}
 	if types.IsChannelError(openaiErr) {
 		return true
 	}
@@ -358,7 +534,7 @@ func processChannelError(c *gin.Context, channelError types.ChannelError, err *t
 	logger.LogError(c, fmt.Sprintf("channel error (channel #%d, status code: %d): %s", channelError.ChannelId, err.StatusCode, common.LocalLogPreview(err.Error())))
 	// 不要使用context获取渠道信息，异步处理时可能会出现渠道信息不一致的情况
 	// do not use context to get channel info, there may be inconsistent channel info when processing asynchronously
-	if service.ShouldDisableChannel(err) && channelError.AutoBan {
+	if shouldAutoBanChannel(err) && channelError.AutoBan {
 		gopool.Go(func() {
 			service.DisableChannel(channelError, err.ErrorWithStatusCode())
 		})
@@ -582,6 +758,7 @@ func RelayTask(c *gin.Context) {
 		task.PrivateData.UpstreamTaskID = result.UpstreamTaskID
 		task.PrivateData.BillingSource = relayInfo.BillingSource
 		task.PrivateData.SubscriptionId = relayInfo.SubscriptionId
+		task.PrivateData.OrganizationId = relayInfo.OrganizationId
 		task.PrivateData.TokenId = relayInfo.TokenId
 		task.PrivateData.NodeName = common.NodeName
 		task.PrivateData.BillingContext = &model.TaskBillingContext{
@@ -0,0 +1,124 @@
+package controller
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/constant"
+	"github.com/QuantumNous/new-api/logger"
+	relaycommon "github.com/QuantumNous/new-api/relay/common"
+	"github.com/QuantumNous/new-api/relay/helper"
+	"github.com/QuantumNous/new-api/service"
+	"github.com/QuantumNous/new-api/setting/ratio_setting"
+	"github.com/QuantumNous/new-api/types"
+
+	"github.com/gin-gonic/gin"
+)
+
+// servedModelHeader 跨模型回退后在响应头中返回实际提供服务的模型
+const servedModelHeader = "X-New-Api-Served-Model"
+
+// shouldFallbackModel 判断原模型的失败是否可以改用备选模型：已经向客户端写出响应、指定了渠道、
+// 引用了固定到渠道的文件，或者是请求本身的问题时不回退
+func shouldFallbackModel(c *gin.Context, apiErr *types.NewAPIError) bool {
+	if apiErr == nil || c.Writer.Written() {
+		return false
+	}
+	if _, ok := c.Get("specific_channel_id"); ok || isFilePinnedRequest(c) {
+		return false
+	}
+	if apiErr.GetErrorCode() == types.ErrorCodeGetChannelFailed {
+		return true
+	}
+	return shouldRetry(c, apiErr, 1)
+}
+
+// isTokenModelAllowed 令牌启用了模型限制时，备选模型同样需要在允许范围内
+func isTokenModelAllowed(c *gin.Context, modelName string) bool {
+	if !common.GetContextKeyBool(c, constant.ContextKeyTokenModelLimitEnabled) {
+		return true
+	}
+	limits, ok := common.GetContextKeyType[map[string]bool](c, constant.ContextKeyTokenModelLimit)
+	if !ok {
+		return false
+	}
+	_, ok = limits[ratio_setting.FormatMatchingModelName(modelName)]
+	return ok
+}
+
+// switchToFallbackModel 依次尝试 fallbackModels 中的模型，切换成功时返回 true：重新计价并补足预扣额度，
+// 之后的渠道选择、格式转换与结算都按备选模型进行。无法切换的模型（令牌无权限、未配置价格、余额不足）会被跳过
+func switchToFallbackModel(c *gin.Context, relayInfo *relaycommon.RelayInfo, meta *types.TokenCountMeta, fallbackModels *[]string) bool {
+	for len(*fallbackModels) > 0 {
+		modelName := (*fallbackModels)[0]
+		*fallbackModels = (*fallbackModels)[1:]
+		fromModel := relayInfo.OriginModelName
+		if err := applyFallbackModel(c, relayInfo, meta, modelName); err != nil {
+			logger.LogWarn(c, fmt.Sprintf("跳过备选模型 %s：%s", modelName, err.Error()))
+			continue
+		}
+		logger.LogInfo(c, fmt.Sprintf("模型 %s 的渠道均失败，回退到模型 %s", fromModel, modelName))
+		return true
+	}
+	return false
+}
+
+func applyFallbackModel(c *gin.Context, relayInfo *relaycommon.RelayInfo, meta *types.TokenCountMeta, modelName string) error {
+	if !isTokenModelAllowed(c, modelName) {
+		return errors.New("令牌无权使用该模型")
+	}
+	// 计价失败时恢复原模型的计价信息，保证最终错误与日志仍对应原模型
+	prevModel, prevPrice := relayInfo.OriginModelName, relayInfo.PriceData
+	prevSnapshot, prevInput := relayInfo.TieredBillingSnapshot, relayInfo.BillingRequestInput
+	restore := func() {
+		relayInfo.OriginModelName, relayInfo.PriceData = prevModel, prevPrice
+		relayInfo.TieredBillingSnapshot, relayInfo.BillingRequestInput = prevSnapshot, prevInput
+	}
+
+	relayInfo.OriginModelName = modelName
+	relayInfo.TieredBillingSnapshot, relayInfo.BillingRequestInput = nil, nil
+	priceData, err := helper.ModelPriceHelper(c, relayInfo, relayInfo.GetEstimatePromptTokens(), meta)
+	if err != nil {
+		restore()
+		return err
+	}
+	if !priceData.FreeModel {
+		if relayInfo.Billing == nil {
+			if apiErr := service.PreConsumeBilling(c, priceData.QuotaToPreConsume, relayInfo); apiErr != nil {
+				restore()
+				return apiErr
+			}
+		} else {
+			// 原模型在令牌消费窗口中的预留按原模型的价格与子预算计算，切换前先释放，
+			// 再按备选模型重新校验令牌限额并预留，备选模型同样受单次费用上限与按模型子预算约束
+			service.ReleaseTokenSpendReservation(c)
+			// 本次请求已预留的输入审核费用一并计入
+			quota := priceData.QuotaToPreConsume + relayInfo.ModerationQuota
+			if apiErr := service.CheckTokenLimits(c, relayInfo.TokenId, modelName, quota); apiErr != nil {
+				restore()
+				return apiErr
+			}
+			if err := relayInfo.Billing.Reserve(quota); err != nil {
+				service.ReleaseTokenSpendReservation(c)
+				restore()
+				return err
+			}
+		}
+	}
+
+	if relayInfo.FallbackFromModel == "" {
+		relayInfo.FallbackFromModel = prevModel
+	}
+	if relayInfo.ChannelMeta == nil {
+		// 确保后续的渠道选择按备选模型重新进行，而不是沿用分发阶段为原模型选定的渠道
+		relayInfo.InitChannelMeta(c)
+	}
+	if relayInfo.Request != nil {
+		relayInfo.Request.SetModelName(modelName)
+	}
+	common.SetContextKey(c, constant.ContextKeyAutoGroupIndex, 0)
+	common.SetContextKey(c, constant.ContextKeyAutoGroupRetryIndex, 0)
+	c.Header(servedModelHeader, modelName)
+	return nil
+}
@@ -0,0 +1,113 @@
+package controller
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/constant"
+	"github.com/QuantumNous/new-api/model"
+	relaycommon "github.com/QuantumNous/new-api/relay/common"
+	"github.com/QuantumNous/new-api/service"
+	"github.com/QuantumNous/new-api/setting/ratio_setting"
+	"github.com/QuantumNous/new-api/types"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/require"
+)
+
+func TestApplyFallbackModelKeepsOriginalOnFailure(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	c.Request = httptest.NewRequest(http.MethodPost, "/v1/chat/completions", nil)
+	c.Set(string(constant.ContextKeyTokenModelLimitEnabled), true)
+	c.Set(string(constant.ContextKeyTokenModelLimit), map[string]bool{"gpt-4o": true, "unpriced-model-for-test": true})
+
+	info := &relaycommon.RelayInfo{OriginModelName: "claude-sonnet-4"}
+	info.PriceData.ModelRatio = 1.5
+
+	err := applyFallbackModel(c, info, &types.TokenCountMeta{}, "gemini-2.5-pro")
+	require.Error(t, err)
+
+	err = applyFallbackModel(c, info, &types.TokenCountMeta{}, "unpriced-model-for-test")
+	require.Error(t, err)
+	require.Equal(t, "claude-sonnet-4", info.OriginModelName)
+	require.Equal(t, 1.5, info.PriceData.ModelRatio)
+	require.Empty(t, info.FallbackFromModel)
+	require.Empty(t, c.Writer.Header().Get(servedModelHeader))
+
+	fallbackModels := []string{"gemini-2.5-pro", "unpriced-model-for-test"}
+	require.False(t, switchToFallbackModel(c, info, &types.TokenCountMeta{}, &fallbackModels))
+	require.Empty(t, fallbackModels)
+}
+
+func TestShouldFallbackModel(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	c.Request = httptest.NewRequest(http.MethodPost, "/v1/chat/completions", nil)
+
+	require.False(t, shouldFallbackModel(c, nil))
+	require.True(t, shouldFallbackModel(c, types.NewError(http.ErrHandlerTimeout, types.ErrorCodeGetChannelFailed, types.ErrOptionWithSkipRetry())))
+	require.False(t, shouldFallbackModel(c, types.NewErrorWithStatusCode(http.ErrBodyNotAllowed, types.ErrorCodeInvalidRequest, http.StatusBadRequest, types.ErrOptionWithSkipRetry())))
+
+	c.Set("specific_channel_id", 3)
+	require.False(t, shouldFallbackModel(c, types.NewError(http.ErrHandlerTimeout, types.ErrorCodeGetChannelFailed, types.ErrOptionWithSkipRetry())))
+}
+
+// fallbackTestBilling 只记录 Reserve 调用的计费会话
+type fallbackTestBilling struct {
+	reserved []int
+}
+
+func (b *fallbackTestBilling) Settle(int) error         { return nil }
+func (b *fallbackTestBilling) Refund(*gin.Context)      {}
+func (b *fallbackTestBilling) NeedsRefund() bool        { return true }
+func (b *fallbackTestBilling) GetPreConsumedQuota() int { return 0 }
+func (b *fallbackTestBilling) Reserve(targetQuota int) error {
+	b.reserved = append(b.reserved, targetQuota)
+	return nil
+}
+
+func TestApplyFallbackModelChecksTokenLimits(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	modelRatio := ratio_setting.ModelRatio2JSONString()
+	t.Cleanup(func() {
+		_ = ratio_setting.UpdateModelRatioByJSONString(modelRatio)
+	})
+	require.NoError(t, ratio_setting.UpdateModelRatioByJSONString(`{"gpt-4o":1,"gpt-4o-mini":0.1}`))
+	db := openTokenControllerTestDB(t)
+	require.NoError(t, db.AutoMigrate(&model.TokenSpendCounter{}))
+	const tokenId = 910001
+	limits := model.TokenLimits{
+		ModelQuotas: map[string]model.TokenQuotaWindows{
+			"claude-sonnet*": {DailyQuota: 100000},
+			"gpt-4o":         {DailyQuota: 1000},
+		},
+	}
+	newContext := func() *gin.Context {
+		c, _ := gin.CreateTestContext(httptest.NewRecorder())
+		c.Request = httptest.NewRequest(http.MethodPost, "/v1/chat/completions", nil)
+		common.SetContextKey(c, constant.ContextKeyTokenLimits, limits)
+		return c
+	}
+
+	c := newContext()
+	require.Nil(t, service.CheckTokenLimits(c, tokenId, "claude-sonnet-4", 80000))
+	billing := &fallbackTestBilling{}
+	info := &relaycommon.RelayInfo{OriginModelName: "claude-sonnet-4", TokenId: tokenId, Billing: billing}
+	info.SetEstimatePromptTokens(10000)
+
+	// 备选模型超出其子预算时跳过，不补足预扣额度
+	err := applyFallbackModel(c, info, &types.TokenCountMeta{}, "gpt-4o")
+	require.Error(t, err)
+	require.Empty(t, billing.reserved)
+	require.Equal(t, "claude-sonnet-4", info.OriginModelName)
+
+	// 原模型的预留已释放，不再占用原模型的子预算
+	require.Nil(t, service.CheckTokenLimits(newContext(), tokenId, "claude-sonnet-4", 90000))
+
+	require.NoError(t, applyFallbackModel(c, info, &types.TokenCountMeta{}, "gpt-4o-mini"))
+	require.Len(t, billing.reserved, 1)
+	require.Equal(t, "gpt-4o-mini", info.OriginModelName)
+}
@@ -0,0 +1,391 @@
+package controller
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"runtime/debug"
+	"strings"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/constant"
+	"github.com/QuantumNous/new-api/logger"
+	"github.com/QuantumNous/new-api/middleware"
+	"github.com/QuantumNous/new-api/model"
+	channelperf "github.com/QuantumNous/new-api/pkg/channel_perf"
+	relaycommon "github.com/QuantumNous/new-api/relay/common"
+	relayconstant "github.com/QuantumNous/new-api/relay/constant"
+	"github.com/QuantumNous/new-api/relay/helper"
+	"github.com/QuantumNous/new-api/service"
+	"github.com/QuantumNous/new-api/setting/operation_setting"
+	"github.com/QuantumNous/new-api/types"
+
+	"github.com/gin-gonic/gin"
+)
+
+// hedgeChannelPicks 备用渠道的选取次数：同一优先级内随机可能再次选中主渠道，依次放宽到更低优先级
+const hedgeChannelPicks = 3
+
+var errHedgeAbandoned = errors.New("hedged request abandoned")
+
+// hedgeWriter 对冲请求中单次尝试使用的 ResponseWriter：首次写出响应体时参与竞速，
+// 胜出后透传到真实的 Writer，落败后写入返回错误，促使该尝试尽快结束
+type hedgeWriter struct {
+	gin.ResponseWriter
+	race      *relaycommon.HedgeRace
+	role      int32
+	header    http.Header
+	status    int
+	committed bool
+}
+
+func newHedgeWriter(w gin.ResponseWriter, race *relaycommon.HedgeRace, role int32) *hedgeWriter {
+	return &hedgeWriter{
+		ResponseWriter: w,
+		race:           race,
+		role:           role,
+		header:         http.Header{},
+	}
+}
+
+// commit 参与竞速，胜出时把暂存的响应头写入真实的 Writer
+func (w *hedgeWriter) commit() bool {
+	if w.committed {
+		return true
+	}
+	if !w.race.Claim(w.role) {
+		return false
+	}
+	w.committed = true
+	header := w.ResponseWriter.Header()
+	for key, values := range w.header {
+		header[key] = values
+	}
+	if w.status != 0 {
+		w.ResponseWriter.WriteHeader(w.status)
+	}
+	return true
+}
+
+func (w *hedgeWriter) Header() http.Header {
+	if w.committed {
+		return w.ResponseWriter.Header()
+	}
+	return w.header
+}
+
+func (w *hedgeWriter) WriteHeader(code int) {
+	if w.committed {
+		w.ResponseWriter.WriteHeader(code)
+		return
+	}
+	w.status = code
+}
+
+func (w *hedgeWriter) WriteHeaderNow() {
+	if w.committed {
+		w.ResponseWriter.WriteHeaderNow()
+	}
+}
+
+func (w *hedgeWriter) Write(data []byte) (int, error) {
+	// 决出胜者前的 SSE 注释（保活 ping）不算首字节，直接丢弃
+	if !w.committed && bytes.HasPrefix(data, []byte(":")) && w.race.Winner() == 0 {
+		return len(data), nil
+	}
+	if !w.commit() {
+		return 0, errHedgeAbandoned
+	}
+	return w.ResponseWriter.Write(data)
+}
+
+func (w *hedgeWriter) WriteString(s string) (int, error) {
+	if !w.committed && strings.HasPrefix(s, ":") && w.race.Winner() == 0 {
+		return len(s), nil
+	}
+	if !w.commit() {
+		return 0, errHedgeAbandoned
+	}
+	return w.ResponseWriter.WriteString(s)
+}
+
+func (w *hedgeWriter) Flush() {
+	if w.committed {
+		w.ResponseWriter.Flush()
+	}
+}
+
+func (w *hedgeWriter) Status() int {
+	if w.committed {
+		return w.ResponseWriter.Status()
+	}
+	if w.status != 0 {
+		return w.status
+	}
+	return http.StatusOK
+}
+
+func (w *hedgeWriter) Size() int {
+	if w.committed {
+		return w.ResponseWriter.Size()
+	}
+	return -1
+}
+
+func (w *hedgeWriter) Written() bool {
+	return w.committed && w.ResponseWriter.Written()
+}
+
+func (w *hedgeWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	return nil, nil, errors.New("hijack is not supported for hedged requests")
+}
+
+func (w *hedgeWriter) Pusher() http.Pusher {
+	return nil
+}
+
+// shouldHedgeRelay 判断请求是否启用对冲：需要按分组或模型开启，且只对文本生成类请求生效
+func shouldHedgeRelay(c *gin.Context, info *relaycommon.RelayInfo, relayFormat types.RelayFormat) bool {
+	if !operation_setting.IsHedgeEnabled(info.UsingGroup, info.OriginModelName) {
+		return false
+	}
+	if operation_setting.GetHedgeSetting().StreamOnly && !info.IsStream {
+		return false
+	}
+	if _, ok := c.Get("specific_channel_id"); ok || isFilePinnedRequest(c) {
+		return false
+	}
+	switch relayFormat {
+	case types.RelayFormatClaude:
+		return true
+	case types.RelayFormatGemini:
+		path := c.Request.URL.Path
+		return !strings.Contains(path, "embed") && !strings.HasSuffix(path, ":countTokens")
+	case types.RelayFormatOpenAI, types.RelayFormatOpenAIResponses:
+		switch info.RelayMode {
+		case relayconstant.RelayModeChatCompletions, relayconstant.RelayModeCompletions, relayconstant.RelayModeResponses:
+			return true
+		}
+	}
+	return false
+}
+
+// hedgeThreshold 返回主渠道的首字节等待阈值，配置了倍数且样本充足时按主渠道最近的平均首字时间计算
+func hedgeThreshold(channelId int, modelName string) time.Duration {
+	setting := operation_setting.GetHedgeSetting()
+	threshold := time.Duration(setting.ThresholdMs) * time.Millisecond
+	if setting.TtftMultiplier > 0 {
+		stats := channelperf.Query(channelId, modelName, operation_setting.GetHedgeWindow())
+		if stats.TtftSamples > 0 && stats.TtftSamples >= int64(setting.MinSamples) {
+			threshold = time.Duration(float64(stats.AvgTtftMs)*setting.TtftMultiplier) * time.Millisecond
+			if setting.MinThresholdMs > 0 {
+				threshold = max(threshold, time.Duration(setting.MinThresholdMs)*time.Millisecond)
+			}
+			if setting.MaxThresholdMs > 0 {
+				threshold = min(threshold, time.Duration(setting.MaxThresholdMs)*time.Millisecond)
+			}
+		}
+	}
+	return max(threshold, 0)
+}
+
+// selectHedgeChannel 为备用请求选择一个不同于主渠道的渠道，并写入备用请求的上下文
+func selectHedgeChannel(c *gin.Context, info *relaycommon.RelayInfo, primaryId int) *model.Channel {
+	param := &service.RetryParam{
+		Ctx:         c,
+		TokenGroup:  info.TokenGroup,
+		ModelName:   info.OriginModelName,
+		RequestPath: c.Request.URL.Path,
+	}
+	for retry := 0; retry < hedgeChannelPicks; retry++ {
+		param.SetRetry(retry)
+		channel, _, err := service.CacheGetRandomSatisfiedChannel(param)
+		if err != nil || channel == nil {
+			return nil
+		}
+		if channel.Id == primaryId {
+			continue
+		}
+		info.PriceData.GroupRatioInfo = helper.HandleGroupRatio(c, info)
+		if apiErr := middleware.SetupContextForSelectedChannel(c, channel, info.OriginModelName); apiErr != nil {
+			return nil
+		}
+		return channel
+	}
+	return nil
+}
+
+type hedgeResult struct {
+	role      int32
+	err       *types.NewAPIError
+	abandoned bool
+}
+
+// hedgeAttempt 对冲请求中的一方，持有独立的 gin 上下文与 RelayInfo
+type hedgeAttempt struct {
+	ctx     *gin.Context
+	info    *relaycommon.RelayInfo
+	channel *model.Channel
+	cancel  context.CancelFunc
+}
+
+// run 在新的 goroutine 中执行转发，结果写入 results
+func (a *hedgeAttempt) run(results chan<- hedgeResult, relayFormat types.RelayFormat, requestId string) {
+	role := a.info.Hedge.Role
+	go func() {
+		defer func() {
+			if r := recover(); r != nil {
+				common.SysError(fmt.Sprintf("hedged relay attempt panic: %v\n%s", r, debug.Stack()))
+				results <- hedgeResult{role: role, err: types.NewError(fmt.Errorf("hedged relay attempt panic: %v", r), types.ErrorCodeDoRequestFailed)}
+			}
+		}()
+		err := relayAttempt(a.ctx, a.info, relayFormat, a.channel, requestId)
+		results <- hedgeResult{role: role, err: err, abandoned: a.info.Hedge.Abandoned()}
+	}()
+}
+
+func (a *hedgeAttempt) processError(err *types.NewAPIError) {
+	processChannelError(a.ctx, *types.NewChannelError(a.channel.Id, a.channel.Type, a.channel.Name, a.channel.ChannelInfo.IsMultiKey,
+		common.GetContextKeyString(a.ctx, constant.ContextKeyChannelKey), a.channel.GetAutoBan()), service.NormalizeViolationFeeError(err))
+}
+
+// relayHedged 执行一次可对冲的转发：主渠道在阈值内没有写出首字节时，选择另一个渠道并发发出相同请求，
+// 先写出首字节的一方继续向客户端输出，另一方被取消。返回胜出一方的渠道与结果，都失败时返回主渠道的结果
+func relayHedged(c *gin.Context, relayInfo *relaycommon.RelayInfo, relayFormat types.RelayFormat, primaryChannel *model.Channel, requestId string) (*model.Channel, *types.NewAPIError) {
+	bodyStorage, err := common.GetBodyStorage(c)
+	if err != nil {
+		return primaryChannel, relayAttempt(c, relayInfo, relayFormat, primaryChannel, requestId)
+	}
+	threshold := hedgeThreshold(primaryChannel.Id, relayInfo.OriginModelName)
+	race := relaycommon.NewHedgeRace(primaryChannel.Id, threshold)
+
+	// 备用请求的上下文与 RelayInfo 需要在主请求开始修改它们之前复制
+	backup := &hedgeAttempt{ctx: c.Copy(), info: relayInfo.CloneForAttempt()}
+	realWriter, realRequest := c.Writer, c.Request
+	primaryCtx, cancelPrimary := context.WithCancel(realRequest.Context())
+	primary := &hedgeAttempt{ctx: c, info: relayInfo, channel: primaryChannel, cancel: cancelPrimary}
+	c.Writer = newHedgeWriter(realWriter, race, relaycommon.HedgeRolePrimary)
+	c.Request = realRequest.WithContext(primaryCtx)
+	relayInfo.Hedge = &relaycommon.HedgeAttempt{Race: race, Role: relaycommon.HedgeRolePrimary}
+	defer func() {
+		cancelPrimary()
+		c.Writer, c.Request = realWriter, realRequest
+		relayInfo.Hedge = nil
+	}()
+
+	startBackup := func() bool {
+		body, err := bodyStorage.Bytes()
+		if err != nil {
+			return false
+		}
+		storage, err := common.CreateBodyStorage(body)
+		if err != nil {
+			return false
+		}
+		backupCtx, cancel := context.WithCancel(realRequest.Context())
+		backup.cancel = func() {
+			cancel()
+			storage.Close()
+		}
+		backup.ctx.Request = realRequest.Clone(backupCtx)
+		backup.ctx.Request.Body = io.NopCloser(storage)
+		backup.ctx.Set(common.KeyBodyStorage, storage)
+		channel := selectHedgeChannel(backup.ctx, backup.info, primaryChannel.Id)
+		if channel == nil {
+			return false
+		}
+		// 重新解析请求体，避免两个请求并发修改同一个请求对象
+		request, err := helper.GetAndValidateRequest(backup.ctx, relayFormat)
+		if err == nil {
+			_, err = storage.Seek(0, io.SeekStart)
+		}
+		if err != nil {
+			logger.LogWarn(c, fmt.Sprintf("对冲请求：解析备用请求失败：%s", err.Error()))
+			return false
+		}
+		backup.channel = channel
+		backup.info.Request = request
+		backup.info.Hedge = &relaycommon.HedgeAttempt{Race: race, Role: relaycommon.HedgeRoleBackup}
+		backup.ctx.Writer = newHedgeWriter(realWriter, race, relaycommon.HedgeRoleBackup)
+		addUsedChannel(backup.ctx, channel.Id)
+		race.SetBackupChannelId(channel.Id)
+		return true
+	}
+
+	results := make(chan hedgeResult, 2)
+	primary.run(results, relayFormat, requestId)
+	timer := time.NewTimer(threshold)
+	defer timer.Stop()
+	claimed := race.Claimed()
+	outcomes := make(map[int32]hedgeResult, 2)
+	for running := 1; running > 0; {
+		select {
+		case <-timer.C:
+			if race.Winner() == 0 && startBackup() {
+				running++
+				backup.run(results, relayFormat, requestId)
+			}
+		case <-claimed:
+			// 决出胜者后取消另一方，不再发出备用请求
+			claimed = nil
+			timer.Stop()
+			if race.Winner() == relaycommon.HedgeRolePrimary {
+				if backup.cancel != nil {
+					backup.cancel()
+				}
+			} else {
+				primary.cancel()
+			}
+		case result := <-results:
+			running--
+			outcomes[result.role] = result
+			// 没有写出响应体就成功结束的一方同样视为胜出
+			if result.err == nil {
+				race.Claim(result.role)
+			}
+			if running == 0 {
+				timer.Stop()
+			}
+		}
+	}
+	if backup.cancel != nil {
+		backup.cancel()
+	}
+
+	winner := race.Winner()
+	if backup.channel != nil {
+		winnerName := "无"
+		switch winner {
+		case relaycommon.HedgeRolePrimary:
+			winnerName = fmt.Sprintf("渠道 #%d", primaryChannel.Id)
+		case relaycommon.HedgeRoleBackup:
+			winnerName = fmt.Sprintf("渠道 #%d", backup.channel.Id)
+		}
+		logger.LogInfo(c, fmt.Sprintf("对冲请求：渠道 #%d 超过 %dms 未返回首字节，已向渠道 #%d 发出备用请求，胜出：%s",
+			primaryChannel.Id, threshold.Milliseconds(), backup.channel.Id, winnerName))
+	}
+
+	// 未作为结果返回的一方如果是自身失败（而不是被取消），照常处理渠道错误
+	if winner == relaycommon.HedgeRoleBackup {
+		if outcome := outcomes[relaycommon.HedgeRolePrimary]; outcome.err != nil && !outcome.abandoned {
+			primary.processError(outcome.err)
+		}
+		for key, value := range backup.ctx.Keys {
+			c.Set(key, value)
+		}
+		*relayInfo = *backup.info
+		return backup.channel, outcomes[relaycommon.HedgeRoleBackup].err
+	}
+	if backup.channel != nil {
+		if outcome := outcomes[relaycommon.HedgeRoleBackup]; outcome.err != nil && !outcome.abandoned {
+			backup.processError(outcome.err)
+		}
+	}
+	return primaryChannel, outcomes[relaycommon.HedgeRolePrimary].err
+}
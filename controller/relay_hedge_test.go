@@ -0,0 +1,98 @@
+package controller
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	channelperf "github.com/QuantumNous/new-api/pkg/channel_perf"
+	relaycommon "github.com/QuantumNous/new-api/relay/common"
+	"github.com/QuantumNous/new-api/setting/operation_setting"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHedgeWriterFirstByteWins(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	recorder := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(recorder)
+	race := relaycommon.NewHedgeRace(1, time.Second)
+	primary := newHedgeWriter(c.Writer, race, relaycommon.HedgeRolePrimary)
+	backup := newHedgeWriter(c.Writer, race, relaycommon.HedgeRoleBackup)
+
+	primary.Header().Set("Content-Type", "text/event-stream")
+	primary.WriteHeader(http.StatusAccepted)
+	require.False(t, primary.Written())
+	require.Empty(t, recorder.Header().Get("Content-Type"))
+
+	// 保活 ping 不参与竞速
+	_, err := primary.Write([]byte(": PING\n\n"))
+	require.NoError(t, err)
+	require.Zero(t, race.Winner())
+
+	backup.Header().Set("Content-Type", "application/json")
+	_, err = backup.WriteString("data: backup\n\n")
+	require.NoError(t, err)
+	require.Equal(t, relaycommon.HedgeRoleBackup, race.Winner())
+
+	_, err = primary.Write([]byte("data: primary\n\n"))
+	require.ErrorIs(t, err, errHedgeAbandoned)
+	primary.Flush()
+
+	require.Equal(t, http.StatusOK, recorder.Code)
+	require.Equal(t, "application/json", recorder.Header().Get("Content-Type"))
+	require.Equal(t, "data: backup\n\n", recorder.Body.String())
+
+	require.True(t, (&relaycommon.HedgeAttempt{Race: race, Role: relaycommon.HedgeRolePrimary}).Abandoned())
+	require.False(t, (&relaycommon.HedgeAttempt{Race: race, Role: relaycommon.HedgeRoleBackup}).Abandoned())
+	require.False(t, (*relaycommon.HedgeAttempt)(nil).Abandoned())
+}
+
+func TestHedgeThreshold(t *testing.T) {
+	setting := operation_setting.GetHedgeSetting()
+	saved := *setting
+	channelperf.Reset()
+	t.Cleanup(func() {
+		*setting = saved
+		channelperf.Reset()
+	})
+
+	setting.ThresholdMs = 2000
+	setting.TtftMultiplier = 2
+	setting.MinSamples = 3
+	setting.MinThresholdMs = 500
+	setting.MaxThresholdMs = 5000
+
+	// 样本不足时使用固定阈值
+	channelperf.RecordFirstToken(7, "gpt-test", 400*time.Millisecond)
+	require.Equal(t, 2*time.Second, hedgeThreshold(7, "gpt-test"))
+
+	channelperf.RecordFirstToken(7, "gpt-test", 600*time.Millisecond)
+	channelperf.RecordFirstToken(7, "gpt-test", 800*time.Millisecond)
+	require.Equal(t, 1200*time.Millisecond, hedgeThreshold(7, "gpt-test"))
+
+	setting.MaxThresholdMs = 1000
+	require.Equal(t, time.Second, hedgeThreshold(7, "gpt-test"))
+
+	setting.TtftMultiplier = 0.1
+	require.Equal(t, 500*time.Millisecond, hedgeThreshold(7, "gpt-test"))
+}
+
+func TestIsHedgeEnabled(t *testing.T) {
+	setting := operation_setting.GetHedgeSetting()
+	saved := *setting
+	t.Cleanup(func() { *setting = saved })
+
+	setting.Enabled = true
+	setting.EnabledGroups = []string{"vip"}
+	setting.EnabledModels = []string{"claude-*", "gpt-4o"}
+	require.True(t, operation_setting.IsHedgeEnabled("vip", "any-model"))
+	require.True(t, operation_setting.IsHedgeEnabled("default", "claude-sonnet-4"))
+	require.True(t, operation_setting.IsHedgeEnabled("default", "gpt-4o"))
+	require.False(t, operation_setting.IsHedgeEnabled("default", "gpt-4o-mini"))
+
+	setting.Enabled = false
+	require.False(t, operation_setting.IsHedgeEnabled("vip", "gpt-4o"))
+}
@@ -0,0 +1,339 @@
+package controller
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"net"
+	"net/http"
+	"runtime/debug"
+	"sync/atomic"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/constant"
+	"github.com/QuantumNous/new-api/dto"
+	"github.com/QuantumNous/new-api/middleware"
+	"github.com/QuantumNous/new-api/model"
+	relaycommon "github.com/QuantumNous/new-api/relay/common"
+	relayconstant "github.com/QuantumNous/new-api/relay/constant"
+	"github.com/QuantumNous/new-api/relay/helper"
+	"github.com/QuantumNous/new-api/service"
+	"github.com/QuantumNous/new-api/setting/operation_setting"
+	"github.com/QuantumNous/new-api/types"
+
+	"github.com/bytedance/gopkg/util/gopool"
+	"github.com/gin-gonic/gin"
+)
+
+var (
+	shadowInFlight  atomic.Int64
+	errShadowHijack = errors.New("shadow response writer does not support hijack")
+)
+
+// shadowRelay 一次被抽中的影子流量：影子请求在独立的 goroutine 中执行，主请求结束后把主请求的数据交给它，
+// 两侧数据合并写入影子日志
+type shadowRelay struct {
+	start        time.Time
+	origin       gin.ResponseWriter
+	capture      *shadowCaptureWriter
+	primaryUsage *dto.Usage
+	primaryDone  chan shadowPrimaryResult
+}
+
+type shadowPrimaryResult struct {
+	channelId int
+	latency   time.Duration
+	ttft      time.Duration
+	body      []byte
+	usage     dto.Usage
+	err       string
+}
+
+// shouldShadowRelay 影子流量只对 OpenAI Chat Completions 与 Claude Messages 请求生效
+func shouldShadowRelay(info *relaycommon.RelayInfo, relayFormat types.RelayFormat) bool {
+	switch relayFormat {
+	case types.RelayFormatClaude:
+		return true
+	case types.RelayFormatOpenAI:
+		return info.RelayMode == relayconstant.RelayModeChatCompletions
+	}
+	return false
+}
+
+// startShadowRelay 按影子流量规则抽样，抽中时复制请求并异步发往影子渠道，未抽中时返回 nil。
+// 需要在主请求开始修改上下文与 RelayInfo 之前调用
+func startShadowRelay(c *gin.Context, relayInfo *relaycommon.RelayInfo, relayFormat types.RelayFormat, requestId string) *shadowRelay {
+	if !shouldShadowRelay(relayInfo, relayFormat) {
+		return nil
+	}
+	rule := operation_setting.MatchShadowTrafficRule(relayInfo.UsingGroup, relayInfo.OriginModelName)
+	if rule == nil || rand.Float64()*100 >= rule.Percent {
+		return nil
+	}
+	setting := operation_setting.GetShadowTrafficSetting()
+	if inFlight := shadowInFlight.Add(1); setting.MaxConcurrent > 0 && inFlight > int64(setting.MaxConcurrent) {
+		shadowInFlight.Add(-1)
+		return nil
+	}
+	bodyStorage, err := common.GetBodyStorage(c)
+	var body []byte
+	if err == nil {
+		body, err = bodyStorage.Bytes()
+	}
+	if err != nil {
+		shadowInFlight.Add(-1)
+		return nil
+	}
+	body = bytes.Clone(body)
+
+	// 影子请求不能使用客户端请求的 context：主请求结束后它会被取消
+	shadowCtx := c.Copy()
+	shadowInfo := relayInfo.CloneForAttempt()
+	shadowRequest := c.Request.Clone(context.Background())
+	channelId := rule.ChannelId
+
+	s := &shadowRelay{
+		start:        time.Now(),
+		origin:       c.Writer,
+		capture:      &shadowCaptureWriter{ResponseWriter: c.Writer, limit: setting.MaxCaptureBytes},
+		primaryUsage: &dto.Usage{},
+		primaryDone:  make(chan shadowPrimaryResult, 1),
+	}
+	c.Writer = s.capture
+	common.SetContextKey(c, constant.ContextKeyShadowPrimaryUsage, s.primaryUsage)
+
+	gopool.Go(func() {
+		defer shadowInFlight.Add(-1)
+		s.run(shadowCtx, shadowInfo, shadowRequest, body, channelId, relayFormat, requestId)
+	})
+	return s
+}
+
+// finishPrimary 主请求结束时调用，恢复响应写入器并把主请求的数据交给影子请求
+func (s *shadowRelay) finishPrimary(c *gin.Context, relayInfo *relaycommon.RelayInfo, apiErr *types.NewAPIError) {
+	c.Writer = s.origin
+	result := shadowPrimaryResult{
+		channelId: common.GetContextKeyInt(c, constant.ContextKeyChannelId),
+		latency:   time.Since(s.start),
+		body:      s.capture.body.Bytes(),
+		usage:     *s.primaryUsage,
+	}
+	if relayInfo.HasSendResponse() && relayInfo.FirstResponseTime.After(s.start) {
+		result.ttft = relayInfo.FirstResponseTime.Sub(s.start)
+	}
+	if apiErr != nil {
+		result.err = apiErr.Error()
+	}
+	s.primaryDone <- result
+}
+
+// run 执行影子请求，等待主请求结束后写入影子日志
+func (s *shadowRelay) run(c *gin.Context, info *relaycommon.RelayInfo, request *http.Request, body []byte, channelId int, relayFormat types.RelayFormat, requestId string) {
+	setting := operation_setting.GetShadowTrafficSetting()
+	recorder := newShadowRecorder(setting.MaxCaptureBytes)
+	shadowStart := time.Now()
+	apiErr := s.execute(c, info, request, body, channelId, relayFormat, requestId, recorder)
+	shadowLatency := time.Since(shadowStart)
+
+	var primary shadowPrimaryResult
+	select {
+	case primary = <-s.primaryDone:
+	case <-time.After(operation_setting.GetShadowTrafficTimeout()):
+		primary.err = "timed out waiting for the primary request"
+	}
+
+	shadowLog := &model.ShadowLog{
+		RequestId:        requestId,
+		UserId:           info.UserId,
+		ModelName:        info.OriginModelName,
+		Group:            info.UsingGroup,
+		IsStream:         info.IsStream,
+		PrimaryChannelId: primary.channelId,
+		ShadowChannelId:  channelId,
+		PrimaryLatencyMs: primary.latency.Milliseconds(),
+		ShadowLatencyMs:  shadowLatency.Milliseconds(),
+		PrimaryTtftMs:    primary.ttft.Milliseconds(),
+		PrimaryError:     primary.err,
+		ShadowStatusCode: recorder.Status(),
+	}
+	if info.HasSendResponse() && info.FirstResponseTime.After(shadowStart) {
+		shadowLog.ShadowTtftMs = info.FirstResponseTime.Sub(shadowStart).Milliseconds()
+	}
+	if apiErr != nil {
+		shadowLog.ShadowError = apiErr.Error()
+		shadowLog.ShadowStatusCode = apiErr.StatusCode
+	}
+
+	primaryResp := service.ParseResponseDigest(primary.body)
+	shadowResp := service.ParseResponseDigest(recorder.body.Bytes())
+	shadowLog.PrimaryFinishReason = primaryResp.FinishReason
+	shadowLog.ShadowFinishReason = shadowResp.FinishReason
+	shadowLog.PrimaryPromptTokens, shadowLog.PrimaryCompletionTokens = primaryResp.PromptTokens, primaryResp.CompletionTokens
+	if primary.usage.TotalTokens > 0 {
+		shadowLog.PrimaryPromptTokens, shadowLog.PrimaryCompletionTokens = primary.usage.PromptTokens, primary.usage.CompletionTokens
+	}
+	shadowLog.ShadowPromptTokens, shadowLog.ShadowCompletionTokens = shadowResp.PromptTokens, shadowResp.CompletionTokens
+	if info.Shadow != nil && info.Shadow.Usage != nil {
+		shadowLog.ShadowPromptTokens, shadowLog.ShadowCompletionTokens = info.Shadow.Usage.PromptTokens, info.Shadow.Usage.CompletionTokens
+		shadowLog.ShadowQuota = info.Shadow.Quota
+	}
+	if setting.CompareResponses && primaryResp.Text != "" && shadowResp.Text != "" {
+		similarity := service.TextSimilarity(primaryResp.Text, shadowResp.Text)
+		shadowLog.Similarity = &similarity
+	}
+	if err := model.InsertShadowLog(shadowLog); err != nil {
+		common.SysError(fmt.Sprintf("failed to record shadow log: %s", err.Error()))
+	}
+}
+
+// execute 在影子渠道上执行一次转发，响应写入 recorder，用户不计费
+func (s *shadowRelay) execute(c *gin.Context, info *relaycommon.RelayInfo, request *http.Request, body []byte, channelId int, relayFormat types.RelayFormat, requestId string, recorder *shadowRecorder) (apiErr *types.NewAPIError) {
+	defer func() {
+		if r := recover(); r != nil {
+			common.SysError(fmt.Sprintf("shadow relay panic: %v\n%s", r, debug.Stack()))
+			apiErr = types.NewError(fmt.Errorf("shadow relay panic: %v", r), types.ErrorCodeDoRequestFailed)
+		}
+	}()
+	ctx, cancel := context.WithTimeout(context.Background(), operation_setting.GetShadowTrafficTimeout())
+	defer cancel()
+	storage, err := common.CreateBodyStorage(body)
+	if err != nil {
+		return types.NewError(err, types.ErrorCodeReadRequestBodyFailed)
+	}
+	defer storage.Close()
+	c.Request = request.WithContext(ctx)
+	c.Request.Body = io.NopCloser(storage)
+	c.Set(common.KeyBodyStorage, storage)
+	c.Writer = recorder
+
+	channel, err := model.CacheGetChannel(channelId)
+	if err != nil {
+		return types.NewError(err, types.ErrorCodeGetChannelFailed)
+	}
+	if apiErr := middleware.SetupContextForSelectedChannel(c, channel, info.OriginModelName); apiErr != nil {
+		return apiErr
+	}
+	// 重新解析请求体，避免与主请求并发修改同一个请求对象
+	relayRequest, err := helper.GetAndValidateRequest(c, relayFormat)
+	if err == nil {
+		_, err = storage.Seek(0, io.SeekStart)
+	}
+	if err != nil {
+		return types.NewError(err, types.ErrorCodeInvalidRequest)
+	}
+	info.Request = relayRequest
+	info.Shadow = &relaycommon.ShadowAttempt{}
+	info.Hedge = nil
+	info.Billing = shadowBilling{}
+	info.FinalPreConsumedQuota = 0
+	return relayAttempt(c, info, relayFormat, channel, requestId)
+}
+
+// cleanupExpiredShadowLogs 按保留天数分批清理影子日志，由 shadowLogCleanupHandler 定期执行
+func cleanupExpiredShadowLogs(ctx context.Context, retentionDays int, batchSize int) (int64, error) {
+	if retentionDays <= 0 {
+		return 0, nil
+	}
+	target := common.GetTimestamp() - int64(retentionDays)*86400
+	var deleted int64
+	for {
+		rows, err := model.DeleteOldShadowLogBatch(ctx, target, batchSize)
+		deleted += rows
+		if err != nil || rows < int64(batchSize) {
+			return deleted, err
+		}
+	}
+}
+
+// shadowBilling 影子请求的计费会话：不预扣、不结算，任何结算路径都不会向用户收费
+type shadowBilling struct{}
+
+func (shadowBilling) Settle(int) error              { return nil }
+func (shadowBilling) Refund(*gin.Context)           {}
+func (shadowBilling) NeedsRefund() bool             { return false }
+func (shadowBilling) GetPreConsumedQuota() int      { return 0 }
+func (shadowBilling) Reserve(targetQuota int) error { return nil }
+
+// shadowCaptureWriter 主请求正常写出响应的同时保留一份响应体用于对比，超过上限的部分不再保留
+type shadowCaptureWriter struct {
+	gin.ResponseWriter
+	body  bytes.Buffer
+	limit int
+}
+
+func (w *shadowCaptureWriter) Write(data []byte) (int, error) {
+	n, err := w.ResponseWriter.Write(data)
+	w.keep(data[:n])
+	return n, err
+}
+
+func (w *shadowCaptureWriter) WriteString(s string) (int, error) {
+	n, err := w.ResponseWriter.WriteString(s)
+	w.keep([]byte(s[:n]))
+	return n, err
+}
+
+func (w *shadowCaptureWriter) keep(data []byte) {
+	if remaining := w.limit - w.body.Len(); remaining > 0 {
+		w.body.Write(data[:min(len(data), remaining)])
+	}
+}
+
+// shadowRecorder 影子请求的响应写入器，响应不会发给客户端，只保留不超过上限的响应体用于对比
+type shadowRecorder struct {
+	header http.Header
+	status int
+	size   int
+	body   bytes.Buffer
+	limit  int
+}
+
+func newShadowRecorder(limit int) *shadowRecorder {
+	return &shadowRecorder{header: http.Header{}, status: http.StatusOK, size: -1, limit: limit}
+}
+
+func (r *shadowRecorder) Header() http.Header { return r.header }
+
+func (r *shadowRecorder) WriteHeader(code int) {
+	if code > 0 && !r.Written() {
+		r.status = code
+	}
+}
+
+func (r *shadowRecorder) WriteHeaderNow() {
+	if !r.Written() {
+		r.size = 0
+	}
+}
+
+func (r *shadowRecorder) Write(data []byte) (int, error) {
+	r.WriteHeaderNow()
+	if remaining := r.limit - r.body.Len(); remaining > 0 {
+		r.body.Write(data[:min(len(data), remaining)])
+	}
+	r.size += len(data)
+	return len(data), nil
+}
+
+func (r *shadowRecorder) WriteString(s string) (int, error) { return r.Write([]byte(s)) }
+
+func (r *shadowRecorder) Status() int { return r.status }
+
+func (r *shadowRecorder) Size() int { return r.size }
+
+func (r *shadowRecorder) Written() bool { return r.size != -1 }
+
+func (r *shadowRecorder) Flush() {}
+
+func (r *shadowRecorder) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	return nil, nil, errShadowHijack
+}
+
+func (r *shadowRecorder) CloseNotify() <-chan bool { return make(chan bool) }
+
+func (r *shadowRecorder) Pusher() http.Pusher { return nil }
@@ -0,0 +1,66 @@
+package controller
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/model"
+	"github.com/QuantumNous/new-api/setting/operation_setting"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestShadowRecorderKeepsBoundedBody(t *testing.T) {
+	recorder := newShadowRecorder(8)
+	require.False(t, recorder.Written())
+	recorder.WriteHeader(http.StatusTooManyRequests)
+	_, err := recorder.WriteString("data: hello\n\n")
+	require.NoError(t, err)
+	recorder.WriteHeader(http.StatusOK)
+
+	require.True(t, recorder.Written())
+	require.Equal(t, http.StatusTooManyRequests, recorder.Status())
+	require.Equal(t, 13, recorder.Size())
+	require.Equal(t, "data: he", recorder.body.String())
+}
+
+func TestMatchShadowTrafficRule(t *testing.T) {
+	setting := operation_setting.GetShadowTrafficSetting()
+	saved := *setting
+	t.Cleanup(func() { *setting = saved })
+
+	setting.Enabled = true
+	setting.Rules = []operation_setting.ShadowTrafficRule{
+		{ChannelId: 0, Percent: 100},
+		{ChannelId: 3, Models: []string{"claude-*"}, Groups: []string{"vip"}, Percent: 10},
+		{ChannelId: 4, Models: []string{"gpt-4o"}, Percent: 50},
+	}
+	require.Equal(t, 3, operation_setting.MatchShadowTrafficRule("vip", "claude-sonnet-4").ChannelId)
+	require.Nil(t, operation_setting.MatchShadowTrafficRule("default", "claude-sonnet-4"))
+	require.Equal(t, 4, operation_setting.MatchShadowTrafficRule("default", "gpt-4o").ChannelId)
+	require.Nil(t, operation_setting.MatchShadowTrafficRule("default", "gpt-4o-mini"))
+
+	setting.Enabled = false
+	require.Nil(t, operation_setting.MatchShadowTrafficRule("default", "gpt-4o"))
+}
+
+func TestCleanupExpiredShadowLogsInBatches(t *testing.T) {
+	db := openTokenControllerTestDB(t)
+	require.NoError(t, db.AutoMigrate(&model.ShadowLog{}))
+	now := common.GetTimestamp()
+	for i := 0; i < 5; i++ {
+		require.NoError(t, db.Create(&model.ShadowLog{CreatedAt: now - 40*86400}).Error)
+	}
+	require.NoError(t, db.Create(&model.ShadowLog{CreatedAt: now}).Error)
+	require.True(t, model.HasOldShadowLog(now-30*86400))
+
+	deleted, err := cleanupExpiredShadowLogs(context.Background(), 30, 2)
+	require.NoError(t, err)
+	require.EqualValues(t, 5, deleted)
+	require.False(t, model.HasOldShadowLog(now-30*86400))
+	var remaining int64
+	require.NoError(t, db.Model(&model.ShadowLog{}).Count(&remaining).Error)
+	require.EqualValues(t, 1, remaining)
+}
@@ -0,0 +1,40 @@
+package controller
+
+import (
+	"strconv"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/model"
+
+	"github.com/gin-gonic/gin"
+)
+
+// GetShadowLogs 分页查询影子流量的对比记录，channel_id 同时匹配主渠道与影子渠道
+func GetShadowLogs(c *gin.Context) {
+	pageInfo := common.GetPageQuery(c)
+	channelId, _ := strconv.Atoi(c.Query("channel_id"))
+	modelName := c.Query("model_name")
+	startTimestamp, _ := strconv.ParseInt(c.Query("start_timestamp"), 10, 64)
+	endTimestamp, _ := strconv.ParseInt(c.Query("end_timestamp"), 10, 64)
+	logs, total, err := model.GetShadowLogs(channelId, modelName, startTimestamp, endTimestamp, pageInfo.GetStartIdx(), pageInfo.GetPageSize())
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	pageInfo.SetTotal(int(total))
+	pageInfo.SetItems(logs)
+	common.ApiSuccess(c, pageInfo)
+}
+
+// GetShadowLogSummary 按影子渠道与模型汇总对比数据：错误数、平均延迟、输出 tokens、渠道成本与平均相似度
+func GetShadowLogSummary(c *gin.Context) {
+	channelId, _ := strconv.Atoi(c.Query("channel_id"))
+	startTimestamp, _ := strconv.ParseInt(c.Query("start_timestamp"), 10, 64)
+	endTimestamp, _ := strconv.ParseInt(c.Query("end_timestamp"), 10, 64)
+	summaries, err := model.GetShadowLogSummary(channelId, startTimestamp, endTimestamp)
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	common.ApiSuccess(c, summaries)
+}
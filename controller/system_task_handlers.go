@@ -22,6 +22,12 @@ func RegisterScheduledSystemTasks() {
 	service.RegisterSystemTaskHandler(modelUpdateHandler{})
 	service.RegisterSystemTaskHandler(midjourneyPollHandler{})
 	service.RegisterSystemTaskHandler(asyncTaskPollHandler{})
+	service.RegisterSystemTaskHandler(fileCleanupHandler{})
+	service.RegisterSystemTaskHandler(batchRunHandler{})
+	service.RegisterSystemTaskHandler(payloadCleanupHandler{})
+	service.RegisterSystemTaskHandler(secretRotationHandler{})
+	service.RegisterSystemTaskHandler(tokenKeyMigrationHandler{})
+	service.RegisterSystemTaskHandler(shadowLogCleanupHandler{})
 }
 
 // channelTestHandler runs the scheduled "test all channels" job. Enablement and
@@ -152,6 +158,153 @@ func (asyncTaskPollHandler) Run(ctx context.Context, task *model.SystemTask, run
 	finishSystemTaskHandler(task, runnerID, model.SystemTaskStatusSucceeded, summary, nil)
 }
 
+// fileCleanupHandler deletes expired /v1/files uploads (local storage and the
+// pinned upstream copy). Like the polling handlers, Enabled() only schedules a
+// row when at least one file has expired.
+type fileCleanupHandler struct{}
+
+func (fileCleanupHandler) Type() string { return model.SystemTaskTypeFileCleanup }
+
+func (fileCleanupHandler) Enabled() bool {
+	return model.HasExpiredFiles(common.GetTimestamp())
+}
+
+func (fileCleanupHandler) Interval() time.Duration { return 10 * time.Minute }
+
+func (fileCleanupHandler) NewPayload() any { return nil }
+
+func (fileCleanupHandler) Run(ctx context.Context, task *model.SystemTask, runnerID string) {
+	deleted, err := service.CleanupExpiredFiles(ctx, 100)
+	if err != nil {
+		finishSystemTaskHandler(task, runnerID, model.SystemTaskStatusFailed, map[string]any{"deleted": deleted}, err)
+		return
+	}
+	finishSystemTaskHandler(task, runnerID, model.SystemTaskStatusSucceeded, map[string]any{"deleted": deleted}, nil)
+}
+
+// batchRunHandler advances /v1/batches jobs: validation, local execution in
+// bounded slices (progress is checkpointed so the next run resumes), upstream
+// polling and result finalization. Enabled() only schedules a row while at
+// least one batch is unfinished.
+type batchRunHandler struct{}
+
+func (batchRunHandler) Type() string { return model.SystemTaskTypeBatchRun }
+
+func (batchRunHandler) Enabled() bool {
+	return operation_setting.GetBatchSetting().Enabled && model.HasActiveBatches()
+}
+
+func (batchRunHandler) Interval() time.Duration { return 15 * time.Second }
+
+func (batchRunHandler) NewPayload() any { return nil }
+
+func (batchRunHandler) Run(ctx context.Context, task *model.SystemTask, runnerID string) {
+	summary := runBatchTasksOnce(ctx, service.NewSystemTaskProgressReporter(task, runnerID))
+	finishSystemTaskHandler(task, runnerID, model.SystemTaskStatusSucceeded, summary, nil)
+}
+
+// payloadCleanupHandler deletes retained request/response bodies older than
+// the configured payload capture retention. Enabled() only schedules a row when
+// at least one retained payload has expired.
+type payloadCleanupHandler struct{}
+
+func (payloadCleanupHandler) Type() string { return model.SystemTaskTypePayloadCleanup }
+
+func (payloadCleanupHandler) Enabled() bool {
+	retentionDays := operation_setting.GetPayloadCaptureSetting().RetentionDays
+	return retentionDays > 0 && model.HasOldPayloadLog(common.GetTimestamp()-int64(retentionDays)*86400)
+}
+
+func (payloadCleanupHandler) Interval() time.Duration { return time.Hour }
+
+func (payloadCleanupHandler) NewPayload() any { return nil }
+
+func (payloadCleanupHandler) Run(ctx context.Context, task *model.SystemTask, runnerID string) {
+	deleted, err := service.CleanupExpiredPayloadLogs(ctx, operation_setting.GetPayloadCaptureSetting().RetentionDays, 100)
+	if err != nil {
+		finishSystemTaskHandler(task, runnerID, model.SystemTaskStatusFailed, map[string]any{"deleted": deleted}, err)
+		return
+	}
+	finishSystemTaskHandler(task, runnerID, model.SystemTaskStatusSucceeded, map[string]any{"deleted": deleted}, nil)
+}
+
+// secretRotationHandler re-encrypts secrets still sealed under a previous
+// master key after SECRET_ENCRYPTION_KEY was rotated. It works in batches and
+// only touches rows that need it, so Enabled() schedules a row only while some
+// ciphertext still carries an old key id or an encrypted channel key has no
+// search hash yet. Plaintext rows are left to the "secrets encrypt" command.
+type secretRotationHandler struct{}
+
+func (secretRotationHandler) Type() string { return model.SystemTaskTypeSecretRotation }
+
+func (secretRotationHandler) Enabled() bool {
+	return common.SecretEncryptionEnabled() && model.HasSecretsToRotate()
+}
+
+func (secretRotationHandler) Interval() time.Duration { return 10 * time.Minute }
+
+func (secretRotationHandler) NewPayload() any { return nil }
+
+func (secretRotationHandler) Run(ctx context.Context, task *model.SystemTask, runnerID string) {
+	result, err := model.ReencryptSecrets(ctx, 100, false)
+	if err == nil && result.Failed > 0 {
+		err = fmt.Errorf("%d secrets could not be decrypted with the configured master keys", result.Failed)
+	}
+	if err != nil {
+		finishSystemTaskHandler(task, runnerID, model.SystemTaskStatusFailed, result, err)
+		return
+	}
+	finishSystemTaskHandler(task, runnerID, model.SystemTaskStatusSucceeded, result, nil)
+}
+
+// tokenKeyMigrationHandler hashes API keys that older versions stored in
+// plaintext. Until it finishes, an unknown key costs a second lookup for the
+// plaintext row; once no plaintext key remains, Enabled() turns false and
+// GetTokenByKey stops falling back.
+type tokenKeyMigrationHandler struct{}
+
+func (tokenKeyMigrationHandler) Type() string { return model.SystemTaskTypeTokenKeyMigration }
+
+func (tokenKeyMigrationHandler) Enabled() bool { return model.HasLegacyTokenKeys() }
+
+func (tokenKeyMigrationHandler) Interval() time.Duration { return 10 * time.Minute }
+
+func (tokenKeyMigrationHandler) NewPayload() any { return nil }
+
+func (tokenKeyMigrationHandler) Run(ctx context.Context, task *model.SystemTask, runnerID string) {
+	migrated, err := model.MigrateLegacyTokenKeys(ctx, 500)
+	if err != nil {
+		finishSystemTaskHandler(task, runnerID, model.SystemTaskStatusFailed, map[string]any{"migrated": migrated}, err)
+		return
+	}
+	finishSystemTaskHandler(task, runnerID, model.SystemTaskStatusSucceeded, map[string]any{"migrated": migrated}, nil)
+}
+
+// shadowLogCleanupHandler deletes shadow traffic logs older than the configured
+// retention in batches. Enabled() only schedules a row when at least one shadow
+// log has expired.
+type shadowLogCleanupHandler struct{}
+
+func (shadowLogCleanupHandler) Type() string { return model.SystemTaskTypeShadowLogCleanup }
+
+func (shadowLogCleanupHandler) Enabled() bool {
+	retentionDays := operation_setting.GetShadowTrafficSetting().RetentionDays
+	return retentionDays > 0 && model.HasOldShadowLog(common.GetTimestamp()-int64(retentionDays)*86400)
+}
+
+func (shadowLogCleanupHandler) Interval() time.Duration { return time.Hour }
+
+func (shadowLogCleanupHandler) NewPayload() any { return nil }
+
+func (shadowLogCleanupHandler) Run(ctx context.Context, task *model.SystemTask, runnerID string) {
+	deleted, err := cleanupExpiredShadowLogs(ctx, operation_setting.GetShadowTrafficSetting().RetentionDays, 100)
+	if err != nil {
+		finishSystemTaskHandler(task, runnerID, model.SystemTaskStatusFailed, map[string]any{"deleted": deleted}, err)
+		return
+	}
+	finishSystemTaskHandler(task, runnerID, model.SystemTaskStatusSucceeded, map[string]any{"deleted": deleted}, nil)
+}
+
 func finishSystemTaskHandler(task *model.SystemTask, runnerID string, status model.SystemTaskStatus, result any, runErr error) {
 	errorMessage := ""
 	if runErr != nil {
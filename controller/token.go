@@ -77,23 +77,6 @@ func GetToken(c *gin.Context) {
 	common.ApiSuccess(c, buildMaskedTokenResponse(token))
 }
 
-func GetTokenKey(c *gin.Context) {
-	id, err := strconv.Atoi(c.Param("id"))
-	userId := c.GetInt("id")
-	if err != nil {
-		common.ApiError(c, err)
-		return
-	}
-	token, err := model.GetTokenByIds(id, userId)
-	if err != nil {
-		common.ApiError(c, err)
-		return
-	}
-	common.ApiSuccess(c, gin.H{
-		"key": token.GetFullKey(),
-	})
-}
-
 func GetTokenStatus(c *gin.Context) {
 	tokenId := c.GetInt("token_id")
 	userId := c.GetInt("id")
@@ -187,6 +170,14 @@ func AddToken(c *gin.Context) {
 			return
 		}
 	}
+	if token.DailyQuotaLimit < 0 || token.WeeklyQuotaLimit < 0 || token.MonthlyQuotaLimit < 0 || token.RpmLimit < 0 || token.MaxRequestQuota < 0 {
+		common.ApiErrorI18n(c, i18n.MsgTokenLimitNegative)
+		return
+	}
+	if _, err := token.GetModelQuotaLimits(); err != nil {
+		common.ApiErrorI18n(c, i18n.MsgTokenModelQuotaInvalid, map[string]any{"Error": err.Error()})
+		return
+	}
 	// 检查用户令牌数量是否已达上限
 	maxTokens := operation_setting.GetMaxUserTokens()
 	count, err := model.CountUserTokens(c.GetInt("id"))
@@ -221,15 +212,26 @@ func AddToken(c *gin.Context) {
 		AllowIps:           token.AllowIps,
 		Group:              token.Group,
 		CrossGroupRetry:    token.CrossGroupRetry,
+		ResponseCache:      token.ResponseCache,
+		DailyQuotaLimit:    token.DailyQuotaLimit,
+		WeeklyQuotaLimit:   token.WeeklyQuotaLimit,
+		MonthlyQuotaLimit:  token.MonthlyQuotaLimit,
+		RpmLimit:           token.RpmLimit,
+		MaxRequestQuota:    token.MaxRequestQuota,
+		ModelQuotaLimits:   token.ModelQuotaLimits,
 	}
 	err = cleanToken.Insert()
 	if err != nil {
 		common.ApiError(c, err)
 		return
 	}
+	// 数据库中只保存哈希，完整密钥只在这里返回一次
+	createdToken := buildMaskedTokenResponse(&cleanToken)
+	createdToken.Key = key
 	c.JSON(http.StatusOK, gin.H{
 		"success": true,
 		"message": "",
+		"data":    createdToken,
 	})
 }
 
@@ -271,6 +273,14 @@ func UpdateToken(c *gin.Context) {
 			return
 		}
 	}
+	if token.DailyQuotaLimit < 0 || token.WeeklyQuotaLimit < 0 || token.MonthlyQuotaLimit < 0 || token.RpmLimit < 0 || token.MaxRequestQuota < 0 {
+		common.ApiErrorI18n(c, i18n.MsgTokenLimitNegative)
+		return
+	}
+	if _, err := token.GetModelQuotaLimits(); err != nil {
+		common.ApiErrorI18n(c, i18n.MsgTokenModelQuotaInvalid, map[string]any{"Error": err.Error()})
+		return
+	}
 	cleanToken, err := model.GetTokenByIds(token.Id, userId)
 	if err != nil {
 		common.ApiError(c, err)
@@ -299,6 +309,13 @@ func UpdateToken(c *gin.Context) {
 		cleanToken.AllowIps = token.AllowIps
 		cleanToken.Group = token.Group
 		cleanToken.CrossGroupRetry = token.CrossGroupRetry
+		cleanToken.ResponseCache = token.ResponseCache
+		cleanToken.DailyQuotaLimit = token.DailyQuotaLimit
+		cleanToken.WeeklyQuotaLimit = token.WeeklyQuotaLimit
+		cleanToken.MonthlyQuotaLimit = token.MonthlyQuotaLimit
+		cleanToken.RpmLimit = token.RpmLimit
+		cleanToken.MaxRequestQuota = token.MaxRequestQuota
+		cleanToken.ModelQuotaLimits = token.ModelQuotaLimits
 	}
 	err = cleanToken.Update()
 	if err != nil {
@@ -334,26 +351,3 @@ func DeleteTokenBatch(c *gin.Context) {
 		"data":    count,
 	})
 }
-
-func GetTokenKeysBatch(c *gin.Context) {
-	tokenBatch := TokenBatch{}
-	if err := c.ShouldBindJSON(&tokenBatch); err != nil || len(tokenBatch.Ids) == 0 {
-		common.ApiErrorI18n(c, i18n.MsgInvalidParams)
-		return
-	}
-	if len(tokenBatch.Ids) > 100 {
-		common.ApiErrorI18n(c, i18n.MsgBatchTooMany, map[string]any{"Max": 100})
-		return
-	}
-	userId := c.GetInt("id")
-	tokens, err := model.GetTokenKeysByIds(tokenBatch.Ids, userId)
-	if err != nil {
-		common.ApiError(c, err)
-		return
-	}
-	keysMap := make(map[int]string)
-	for _, t := range tokens {
-		keysMap[t.Id] = t.GetFullKey()
-	}
-	common.ApiSuccess(c, gin.H{"keys": keysMap})
-}
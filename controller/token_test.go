@@ -505,36 +505,37 @@ func TestUpdateTokenMasksKeyInResponse(t *testing.T) {
 	}
 }
 
-func TestGetTokenKeyRequiresOwnershipAndReturnsFullKey(t *testing.T) {
+func TestAddTokenRevealsKeyOnceAndStoresHash(t *testing.T) {
 	db := setupTokenControllerTestDB(t)
-	token := seedToken(t, db, 1, "owned-token", "owner1234token5678")
 
-	authorizedCtx, authorizedRecorder := newAuthenticatedContext(t, http.MethodPost, "/api/token/"+strconv.Itoa(token.Id)+"/key", nil, 1)
-	authorizedCtx.Params = gin.Params{{Key: "id", Value: strconv.Itoa(token.Id)}}
-	GetTokenKey(authorizedCtx)
+	ctx, recorder := newAuthenticatedContext(t, http.MethodPost, "/api/token/", map[string]any{"name": "created-token", "unlimited_quota": true, "expired_time": -1}, 1)
+	AddToken(ctx)
 
-	authorizedResponse := decodeAPIResponse(t, authorizedRecorder)
-	if !authorizedResponse.Success {
-		t.Fatalf("expected authorized key fetch to succeed, got message: %s", authorizedResponse.Message)
+	response := decodeAPIResponse(t, recorder)
+	if !response.Success {
+		t.Fatalf("expected token creation to succeed, got message: %s", response.Message)
 	}
-
-	var keyData tokenKeyResponse
-	if err := common.Unmarshal(authorizedResponse.Data, &keyData); err != nil {
-		t.Fatalf("failed to decode token key response: %v", err)
+	var created tokenKeyResponse
+	if err := common.Unmarshal(response.Data, &created); err != nil {
+		t.Fatalf("failed to decode created token: %v", err)
 	}
-	if keyData.Key != token.GetFullKey() {
-		t.Fatalf("expected full key %q, got %q", token.GetFullKey(), keyData.Key)
+	if len(created.Key) != 48 {
+		t.Fatalf("expected the full 48-character key at creation, got %q", created.Key)
 	}
 
-	unauthorizedCtx, unauthorizedRecorder := newAuthenticatedContext(t, http.MethodPost, "/api/token/"+strconv.Itoa(token.Id)+"/key", nil, 2)
-	unauthorizedCtx.Params = gin.Params{{Key: "id", Value: strconv.Itoa(token.Id)}}
-	GetTokenKey(unauthorizedCtx)
-
-	unauthorizedResponse := decodeAPIResponse(t, unauthorizedRecorder)
-	if unauthorizedResponse.Success {
-		t.Fatalf("expected unauthorized key fetch to fail")
+	var stored model.Token
+	if err := db.First(&stored, "name = ?", "created-token").Error; err != nil {
+		t.Fatalf("failed to load created token: %v", err)
 	}
-	if strings.Contains(unauthorizedRecorder.Body.String(), token.Key) {
-		t.Fatalf("unauthorized key response leaked raw token key: %s", unauthorizedRecorder.Body.String())
+	if stored.Key != model.HashTokenKey(created.Key) {
+		t.Fatalf("expected stored key to be the hash of the revealed key, got %q", stored.Key)
+	}
+	if stored.GetMaskedKey() != created.Key[:8]+"**********" {
+		t.Fatalf("expected masked key to show the stored prefix, got %q", stored.GetMaskedKey())
+	}
+
+	found, err := model.GetTokenByKey(created.Key, true)
+	if err != nil || found.Id != stored.Id {
+		t.Fatalf("expected the revealed key to authenticate, got err %v", err)
 	}
 }
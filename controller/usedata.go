@@ -72,7 +72,18 @@ func GetUserQuotaDates(c *gin.Context) {
 		})
 		return
 	}
-	dates, err := model.GetQuotaDataByUserId(userId, startTimestamp, endTimestamp)
+	// scope=organization：组织管理员查看全部成员的用量
+	orgMembers, ok := organizationScopeMembers(c)
+	if !ok {
+		return
+	}
+	var dates []*model.QuotaData
+	var err error
+	if orgMembers != nil {
+		dates, err = model.GetQuotaDataByMembers(orgMembers, startTimestamp, endTimestamp)
+	} else {
+		dates, err = model.GetQuotaDataByUserId(userId, startTimestamp, endTimestamp)
+	}
 	if err != nil {
 		common.ApiError(c, err)
 		return
@@ -238,6 +238,7 @@ func Register(c *gin.Context) {
 		return
 	}
 	// 生成默认令牌
+	defaultTokenKey := ""
 	if constant.GenerateDefaultToken {
 		key, err := common.GenerateKey()
 		if err != nil {
@@ -264,11 +265,18 @@ func Register(c *gin.Context) {
 			common.ApiErrorI18n(c, i18n.MsgCreateDefaultTokenErr)
 			return
 		}
+		defaultTokenKey = key
 	}
 
+	// 令牌只保存哈希，默认令牌的完整密钥只在注册时返回一次
+	data := gin.H{}
+	if defaultTokenKey != "" {
+		data["token_key"] = defaultTokenKey
+	}
 	c.JSON(http.StatusOK, gin.H{
 		"success": true,
 		"message": "",
+		"data":    data,
 	})
 	return
 }
@@ -450,6 +458,13 @@ func GetSelf(c *gin.Context) {
 
 	// 获取用户设置并提取sidebar_modules
 	userSetting := user.GetSetting()
+	// 保存的设置中 webhook 密钥是密文，返回解密后的设置
+	settingValue := user.Setting
+	if settingValue != "" {
+		if settingBytes, err := common.Marshal(userSetting); err == nil {
+			settingValue = string(settingBytes)
+		}
+	}
 
 	// 构建响应数据，包含用户信息和权限
 	responseData := map[string]interface{}{
@@ -474,7 +489,7 @@ func GetSelf(c *gin.Context) {
 		"aff_history_quota": user.AffHistoryQuota,
 		"inviter_id":        user.InviterId,
 		"linux_do_id":       user.LinuxDOId,
-		"setting":           user.Setting,
+		"setting":           settingValue,
 		"stripe_customer":   user.StripeCustomer,
 		"sidebar_modules":   userSetting.SidebarModules, // 正确提取sidebar_modules字段
 		"permissions":       permissions,                // 新增权限字段
@@ -13,6 +13,10 @@ type ChannelSettings struct {
 	PassThroughBodyEnabled bool   `json:"pass_through_body_enabled,omitempty"`
 	SystemPrompt           string `json:"system_prompt,omitempty"`
 	SystemPromptOverride   bool   `json:"system_prompt_override,omitempty"`
+	// PropagateTraceContext 开启后向上游透传 W3C traceparent/tracestate 请求头
+	PropagateTraceContext bool `json:"propagate_trace_context,omitempty"`
+	// PriceMultiplier 渠道的上游成本倍率（相对官方价格），仅用于 lowest_cost 路由策略，不影响计费；未设置时按 1 处理
+	PriceMultiplier float64 `json:"price_multiplier,omitempty"`
 }
 
 type VertexKeyType string
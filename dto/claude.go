@@ -203,6 +203,11 @@ type ClaudeToolChoice struct {
 	DisableParallelToolUse bool   `json:"disable_parallel_tool_use,omitempty"`
 }
 
+// ClaudeCountTokensResponse /v1/messages/count_tokens 的响应
+type ClaudeCountTokensResponse struct {
+	InputTokens int `json:"input_tokens"`
+}
+
 type ClaudeRequest struct {
 	Model        string          `json:"model"`
 	Prompt       string          `json:"prompt,omitempty"`
@@ -45,6 +45,8 @@ const (
 	MsgTokenNameTooLong          = "token.name_too_long"
 	MsgTokenQuotaNegative        = "token.quota_negative"
 	MsgTokenQuotaExceedMax       = "token.quota_exceed_max"
+	MsgTokenLimitNegative        = "token.limit_negative"
+	MsgTokenModelQuotaInvalid    = "token.model_quota_invalid"
 	MsgTokenGenerateFailed       = "token.generate_failed"
 	MsgTokenGetInfoFailed        = "token.get_info_failed"
 	MsgTokenExpiredCannotEnable  = "token.expired_cannot_enable"
@@ -140,6 +142,22 @@ const (
 	MsgSubscriptionInvalidUserId    = "subscription.invalid_user_id"
 )
 
+// Organization related messages
+const (
+	MsgOrganizationInvalidId          = "organization.invalid_id"
+	MsgOrganizationNameEmpty          = "organization.name_empty"
+	MsgOrganizationNotMember          = "organization.not_member"
+	MsgOrganizationPermissionDenied   = "organization.permission_denied"
+	MsgOrganizationInvalidRole        = "organization.invalid_role"
+	MsgOrganizationQuotaLimitNegative = "organization.quota_limit_negative"
+	MsgOrganizationUserAlreadyMember  = "organization.user_already_member"
+	MsgOrganizationMemberNotFound     = "organization.member_not_found"
+	MsgOrganizationOwnerRequired      = "organization.owner_required"
+	MsgOrganizationInvitationExists   = "organization.invitation_exists"
+	MsgOrganizationInvitationNotFound = "organization.invitation_not_found"
+	MsgOrganizationLastOwner          = "organization.last_owner"
+)
+
 // Payment related messages
 const (
 	MsgPaymentNotConfigured      = "payment.not_configured"
@@ -318,6 +336,9 @@ const (
 	MsgDistributorNoAvailableChannel      = "distributor.no_available_channel"
 	MsgDistributorInvalidMidjourney       = "distributor.invalid_midjourney_request"
 	MsgDistributorInvalidParseModel       = "distributor.invalid_request_parse_model"
+	MsgDistributorFileNotForwarded        = "distributor.file_not_forwarded"
+	MsgDistributorFileChannelUnavailable  = "distributor.file_channel_unavailable"
+	MsgDistributorFileChannelConflict     = "distributor.file_channel_conflict"
 )
 
 // Custom OAuth provider related messages
@@ -15,6 +15,7 @@ import (
 	"syscall"
 	"time"
 
+	"github.com/QuantumNous/new-api/cli"
 	"github.com/QuantumNous/new-api/common"
 	"github.com/QuantumNous/new-api/constant"
 	"github.com/QuantumNous/new-api/controller"
@@ -23,7 +24,10 @@ import (
 	"github.com/QuantumNous/new-api/middleware"
 	"github.com/QuantumNous/new-api/model"
 	"github.com/QuantumNous/new-api/oauth"
+	channelbreaker "github.com/QuantumNous/new-api/pkg/channel_breaker"
+	channelcooldown "github.com/QuantumNous/new-api/pkg/channel_cooldown"
 	perfmetrics "github.com/QuantumNous/new-api/pkg/perf_metrics"
+	"github.com/QuantumNous/new-api/pkg/tracing"
 	"github.com/QuantumNous/new-api/relay"
 	"github.com/QuantumNous/new-api/router"
 	"github.com/QuantumNous/new-api/service"
@@ -53,6 +57,11 @@ var classicBuildFS embed.FS
 var classicIndexPage []byte
 
 func main() {
+	// 运维子命令（new-api user reset-password 等）直接操作数据库后退出，不启动服务
+	if cli.IsCommand(os.Args[1:]) {
+		os.Exit(cli.Run(os.Args[1:]))
+	}
+
 	startTime := time.Now()
 
 	err := InitResources()
@@ -69,6 +78,14 @@ func main() {
 		common.SysLog("running in debug mode")
 	}
 
+	shutdownTracing, err := tracing.Init(context.Background())
+	if err != nil {
+		common.FatalLog("failed to initialize tracing: " + err.Error())
+	}
+	if common.TracingEnabled {
+		common.SysLog("opentelemetry tracing enabled")
+	}
+
 	defer func() {
 		err := model.CloseDB()
 		if err != nil {
@@ -181,6 +198,7 @@ func main() {
 	// This will cause SSE not to work!!!
 	//server.Use(gzip.Gzip(gzip.DefaultCompression))
 	server.Use(middleware.RequestId())
+	server.Use(middleware.Tracing())
 	server.Use(middleware.PoweredBy())
 	server.Use(middleware.I18n())
 	middleware.SetUpLogger(server)
@@ -239,6 +257,9 @@ func main() {
 	if common.DataExportEnabled {
 		model.SaveQuotaDataCache()
 	}
+	if err := shutdownTracing(ctx); err != nil {
+		common.SysError(fmt.Sprintf("failed to flush traces: %v", err))
+	}
 	common.SysLog("server exited")
 }
 
@@ -344,6 +365,8 @@ func InitResources() error {
 	}
 
 	perfmetrics.Init()
+	channelbreaker.Init()
+	channelcooldown.Init()
 
 	// 启动系统监控
 	common.StartSystemMonitor()
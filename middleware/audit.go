@@ -50,6 +50,7 @@ var auditRouteActions = map[string]string{
 	"POST /api/option/payment_compliance":       "option.payment_compliance",
 	"POST /api/option/rest_model_ratio":         "option.reset_ratio",
 	"DELETE /api/option/channel_affinity_cache": "option.clear_affinity_cache",
+	"DELETE /api/option/response_cache":         "option.clear_response_cache",
 
 	// 自定义 OAuth（root）
 	"POST /api/custom-oauth-provider/":      "custom_oauth.create",
@@ -92,6 +93,15 @@ var auditRouteActions = map[string]string{
 	"PUT /api/subscription/admin/plans/:id": "subscription.plan_update",
 	"POST /api/subscription/admin/bind":     "subscription.bind",
 
+	// 组织（管理员）
+	"POST /api/organization/admin/":                       "organization.create",
+	"PUT /api/organization/admin/":                        "organization.update",
+	"DELETE /api/organization/admin/:id":                  "organization.delete",
+	"POST /api/organization/admin/:id/members":            "organization.member_add",
+	"PUT /api/organization/admin/:id/members":             "organization.member_update",
+	"DELETE /api/organization/admin/:id/members/:user_id": "organization.member_remove",
+	"POST /api/organization/admin/:id/subscriptions":      "organization.subscription_bind",
+
 	// 日志
 	"DELETE /api/log/": "log.clear",
 }
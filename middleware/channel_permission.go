@@ -0,0 +1,127 @@
+package middleware
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/i18n"
+	"github.com/QuantumNous/new-api/model"
+	"github.com/QuantumNous/new-api/service/authz"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ChannelTarget 描述渠道管理接口的请求定位目标渠道的方式，决定标签范围授权如何生效
+type ChannelTarget int
+
+const (
+	// ChannelTargetNone 接口不针对具体渠道（列表、全量操作等），只接受全局授权
+	ChannelTargetNone ChannelTarget = iota
+	// ChannelTargetPath 目标为路径参数 :id 对应的渠道
+	ChannelTargetPath
+	// ChannelTargetQuery 目标为查询参数 tag 指定的标签
+	ChannelTargetQuery
+	// ChannelTargetBody 目标为请求体顶层 id / channel_id / ids 对应的渠道，以及 tag / new_tag 指定的标签
+	ChannelTargetBody
+	// ChannelTargetNewChannel 目标为新建渠道请求体中 channel.tag 指定的标签，未设置标签时只接受全局授权
+	ChannelTargetNewChannel
+)
+
+// channelTargetRequest 渠道管理接口请求体中用于定位目标渠道的字段
+type channelTargetRequest struct {
+	Id        int     `json:"id"`
+	ChannelId int     `json:"channel_id"`
+	Ids       []int   `json:"ids"`
+	Tag       *string `json:"tag"`
+	NewTag    *string `json:"new_tag"`
+}
+
+// newChannelTargetRequest 新建渠道接口（AddChannelRequest）请求体中的标签
+type newChannelTargetRequest struct {
+	Channel *struct {
+		Tag *string `json:"tag"`
+	} `json:"channel"`
+}
+
+// RequireChannelPermission 与 RequirePermission 相同，但额外支持按渠道标签授权：
+// 用户没有全局授权、只拥有标签范围授权时，按 target 解析请求涉及的渠道与标签，全部命中授权范围才放行。
+// target 必须与接口实际绑定的请求结构一致；无法确定目标渠道的接口使用 ChannelTargetNone，仍需要全局授权
+func RequireChannelPermission(permission authz.Permission, target ChannelTarget) func(c *gin.Context) {
+	return func(c *gin.Context) {
+		role := c.GetInt("role")
+		userID := c.GetInt("id")
+		if authz.Can(userID, role, permission) {
+			c.Next()
+			return
+		}
+		if authz.HasScopedGrant(userID, role, permission) {
+			if tags, ok := channelRequestTags(c, target); ok && authz.CanOnChannel(userID, role, permission, tags...) {
+				c.Next()
+				return
+			}
+		}
+		c.JSON(http.StatusForbidden, gin.H{
+			"success": false,
+			"message": common.TranslateMessage(c, i18n.MsgAuthInsufficientPrivilege),
+		})
+		c.Abort()
+	}
+}
+
+// channelRequestTags 按 target 返回请求涉及的渠道标签，渠道 id 解析为渠道的当前标签。无法定位目标时返回 false
+func channelRequestTags(c *gin.Context, target ChannelTarget) ([]string, bool) {
+	var ids []int
+	var tags []string
+	switch target {
+	case ChannelTargetPath:
+		id, err := strconv.Atoi(c.Param("id"))
+		if err != nil {
+			return nil, false
+		}
+		ids = append(ids, id)
+	case ChannelTargetQuery:
+		tag, ok := c.GetQuery("tag")
+		if !ok {
+			return nil, false
+		}
+		tags = append(tags, tag)
+	case ChannelTargetBody:
+		var req channelTargetRequest
+		if err := common.UnmarshalBodyReusable(c, &req); err != nil {
+			return nil, false
+		}
+		if req.Id > 0 {
+			ids = append(ids, req.Id)
+		}
+		if req.ChannelId > 0 {
+			ids = append(ids, req.ChannelId)
+		}
+		ids = append(ids, req.Ids...)
+		if req.Tag != nil {
+			tags = append(tags, *req.Tag)
+		}
+		if req.NewTag != nil {
+			tags = append(tags, *req.NewTag)
+		}
+	case ChannelTargetNewChannel:
+		var req newChannelTargetRequest
+		if err := common.UnmarshalBodyReusable(c, &req); err != nil || req.Channel == nil || req.Channel.Tag == nil {
+			return nil, false
+		}
+		tags = append(tags, *req.Channel.Tag)
+	default:
+		return nil, false
+	}
+	if len(ids) == 0 && len(tags) == 0 {
+		return nil, false
+	}
+	for _, id := range ids {
+		channel, err := model.GetChannelById(id, false)
+		if err != nil {
+			return nil, false
+		}
+		tags = append(tags, channel.GetTag())
+	}
+	return tags, true
+}
@@ -0,0 +1,112 @@
+package middleware
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/model"
+	"github.com/QuantumNous/new-api/service/authz"
+	"github.com/gin-gonic/gin"
+	"github.com/glebarez/sqlite"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+)
+
+const channelPermissionTestUserId = 21
+
+// setupChannelPermissionTest 授予测试用户 channel@tag:team-a 范围内的渠道权限，并创建 team-a 与 prod 标签下各一个渠道
+func setupChannelPermissionTest(t *testing.T) (teamChannel *model.Channel, prodChannel *model.Channel) {
+	t.Helper()
+
+	wasMaster := common.IsMasterNode
+	common.IsMasterNode = true
+	previousDB := model.DB
+	t.Cleanup(func() {
+		common.IsMasterNode = wasMaster
+		model.DB = previousDB
+	})
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	require.NoError(t, err)
+	sqlDB, err := db.DB()
+	require.NoError(t, err)
+	sqlDB.SetMaxOpenConns(1)
+	require.NoError(t, db.AutoMigrate(&model.CasbinRule{}, &model.AuthzRole{}, &model.Channel{}))
+	model.DB = db
+	require.NoError(t, authz.Init(db))
+
+	_, err = authz.CreateRole(authz.RoleInput{
+		Key:     "team-a-channels",
+		Name:    "Team A Channels",
+		Enabled: true,
+		ScopedGrants: []authz.ScopedGrant{
+			{Resource: authz.ResourceChannel, Action: authz.ActionWrite, Scope: "tag:team-a"},
+			{Resource: authz.ResourceChannel, Action: authz.ActionSensitiveWrite, Scope: "tag:team-a"},
+		},
+	})
+	require.NoError(t, err)
+	require.NoError(t, authz.SetUserRoles(channelPermissionTestUserId, []string{"team-a-channels"}))
+
+	teamTag, prodTag := "team-a", "prod"
+	teamChannel = &model.Channel{Name: "team", Key: "sk-team", Tag: &teamTag}
+	prodChannel = &model.Channel{Name: "prod", Key: "sk-prod", Tag: &prodTag}
+	require.NoError(t, db.Create(teamChannel).Error)
+	require.NoError(t, db.Create(prodChannel).Error)
+	return teamChannel, prodChannel
+}
+
+func performChannelPermissionRequest(permission authz.Permission, target ChannelTarget, method string, routePath string, requestPath string, body string) *httptest.ResponseRecorder {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Handle(method, routePath, func(c *gin.Context) {
+		c.Set("id", channelPermissionTestUserId)
+		c.Set("role", common.RoleAdminUser)
+		c.Next()
+	}, RequireChannelPermission(permission, target), func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{"success": true})
+	})
+
+	recorder := httptest.NewRecorder()
+	request := httptest.NewRequest(method, requestPath, bytes.NewBufferString(body))
+	request.Header.Set("Content-Type", "application/json")
+	router.ServeHTTP(recorder, request)
+	return recorder
+}
+
+func TestRequireChannelPermissionAddChannelUsesNestedTag(t *testing.T) {
+	setupChannelPermissionTest(t)
+
+	allowed := performChannelPermissionRequest(authz.ChannelSensitiveWrite, ChannelTargetNewChannel, http.MethodPost, "/channel", "/channel",
+		`{"mode":"single","channel":{"name":"new","tag":"team-a"}}`)
+	require.Equal(t, http.StatusOK, allowed.Code)
+
+	// 顶层 tag 不是 AddChannel 实际使用的字段，不能借此在其他标签下创建渠道
+	forged := performChannelPermissionRequest(authz.ChannelSensitiveWrite, ChannelTargetNewChannel, http.MethodPost, "/channel", "/channel",
+		`{"tag":"team-a","mode":"single","channel":{"name":"new","tag":"prod"}}`)
+	require.Equal(t, http.StatusForbidden, forged.Code)
+
+	untagged := performChannelPermissionRequest(authz.ChannelSensitiveWrite, ChannelTargetNewChannel, http.MethodPost, "/channel", "/channel",
+		`{"tag":"team-a","mode":"single","channel":{"name":"new"}}`)
+	require.Equal(t, http.StatusForbidden, untagged.Code)
+}
+
+func TestRequireChannelPermissionResolvesRouteTarget(t *testing.T) {
+	teamChannel, prodChannel := setupChannelPermissionTest(t)
+
+	require.Equal(t, http.StatusOK, performChannelPermissionRequest(authz.ChannelWrite, ChannelTargetBody, http.MethodPut, "/channel", "/channel",
+		`{"id":`+strconv.Itoa(teamChannel.Id)+`,"tag":"team-a"}`).Code)
+	require.Equal(t, http.StatusForbidden, performChannelPermissionRequest(authz.ChannelWrite, ChannelTargetBody, http.MethodPut, "/channel", "/channel",
+		`{"id":`+strconv.Itoa(prodChannel.Id)+`,"tag":"team-a"}`).Code)
+
+	require.Equal(t, http.StatusOK, performChannelPermissionRequest(authz.ChannelSensitiveWrite, ChannelTargetPath, http.MethodDelete, "/channel/:id",
+		"/channel/"+strconv.Itoa(teamChannel.Id), "").Code)
+	require.Equal(t, http.StatusForbidden, performChannelPermissionRequest(authz.ChannelSensitiveWrite, ChannelTargetPath, http.MethodDelete, "/channel/:id",
+		"/channel/"+strconv.Itoa(prodChannel.Id), "").Code)
+
+	// 不针对具体渠道的接口忽略请求中的标签，只接受全局授权
+	require.Equal(t, http.StatusForbidden, performChannelPermissionRequest(authz.ChannelWrite, ChannelTargetNone, http.MethodPost, "/channel", "/channel",
+		`{"tag":"team-a"}`).Code)
+}
@@ -0,0 +1,41 @@
+package middleware
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/require"
+)
+
+func newDistributorTestContext(path string, body string) *gin.Context {
+	gin.SetMode(gin.TestMode)
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	c.Request = httptest.NewRequest(http.MethodPost, path, bytes.NewBufferString(body))
+	c.Request.Header.Set("Content-Type", "application/json")
+	return c
+}
+
+func TestGetModelRequestParsesStream(t *testing.T) {
+	cases := []struct {
+		path   string
+		body   string
+		stream bool
+	}{
+		{"/v1/chat/completions", `{"model":"gpt-4o","stream":true}`, true},
+		{"/v1/chat/completions", `{"model":"gpt-4o","stream":false}`, false},
+		{"/v1/responses", `{"model":"gpt-4o"}`, false},
+		{"/v1beta/models/gemini-2.0-flash:streamGenerateContent", `{}`, true},
+		{"/v1beta/models/gemini-2.0-flash:generateContent", `{}`, false},
+	}
+	for _, tc := range cases {
+		c := newDistributorTestContext(tc.path, tc.body)
+		modelRequest, _, err := getModelRequest(c)
+		common.CleanupBodyStorage(c)
+		require.NoError(t, err, tc.path)
+		require.Equal(t, tc.stream, modelRequest.Stream, tc.path+" "+tc.body)
+	}
+}
@@ -10,6 +10,7 @@ import (
 	"github.com/QuantumNous/new-api/common"
 	"github.com/QuantumNous/new-api/common/limiter"
 	"github.com/QuantumNous/new-api/constant"
+	relayconstant "github.com/QuantumNous/new-api/relay/constant"
 	"github.com/QuantumNous/new-api/setting"
 
 	"github.com/gin-gonic/gin"
@@ -166,8 +167,8 @@ func memoryRateLimitHandler(duration int64, totalMaxCount, successMaxCount int)
 // ModelRequestRateLimit 模型请求限流中间件
 func ModelRequestRateLimit() func(c *gin.Context) {
 	return func(c *gin.Context) {
-		// 在每个请求时检查是否启用限流
-		if !setting.ModelRequestRateLimitEnabled {
+		// 在每个请求时检查是否启用限流；count_tokens 接口由 CountTokensRateLimit 单独限流
+		if !setting.ModelRequestRateLimitEnabled || relayconstant.IsCountTokensPath(c.Request.URL.Path) {
 			c.Next()
 			return
 		}
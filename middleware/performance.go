@@ -69,3 +69,8 @@ func checkSystemPerformance() *types.NewAPIError {
 
 	return nil
 }
+
+// IsSystemOverloaded 供后台低优先级任务（如本地执行的 batch）判断是否需要暂缓执行
+func IsSystemOverloaded() bool {
+	return checkSystemPerformance() != nil
+}
@@ -7,6 +7,7 @@ import (
 	"time"
 
 	"github.com/QuantumNous/new-api/common"
+	relayconstant "github.com/QuantumNous/new-api/relay/constant"
 	"github.com/gin-gonic/gin"
 )
 
@@ -203,3 +204,18 @@ func SearchRateLimit() func(c *gin.Context) {
 	}
 	return userRateLimitFactory(common.SearchRateLimitNum, common.SearchRateLimitDuration, "SR")
 }
+
+// CountTokensRateLimit returns a per-user rate limiter for the count_tokens
+// endpoints; other requests pass through untouched. Must be used after TokenAuth.
+// Configurable via COUNT_TOKENS_RATE_LIMIT_ENABLE / COUNT_TOKENS_RATE_LIMIT / COUNT_TOKENS_RATE_LIMIT_DURATION.
+func CountTokensRateLimit() func(c *gin.Context) {
+	if !common.CountTokensRateLimitEnable {
+		return defNext
+	}
+	limiter := userRateLimitFactory(common.CountTokensRateLimitNum, common.CountTokensRateLimitDuration, "CTK")
+	return func(c *gin.Context) {
+		if relayconstant.IsCountTokensPath(c.Request.URL.Path) {
+			limiter(c)
+		}
+	}
+}
@@ -0,0 +1,57 @@
+package middleware
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/constant"
+	"github.com/QuantumNous/new-api/pkg/tracing"
+
+	"github.com/gin-gonic/gin"
+	"go.opentelemetry.io/otel/codes"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+)
+
+// Tracing 为每个 API 请求创建 server span，并在请求结束后补充渠道、模型、分组等属性。
+// 需放在 RequestId 之后；未命中路由的请求（前端静态资源等）不追踪
+func Tracing() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		route := c.FullPath()
+		if !common.TracingEnabled || route == "" {
+			c.Next()
+			return
+		}
+		parent := c.Request.Context()
+		ctx, span := tracing.StartServer(parent, c.Request.Header, c.Request.Method+" "+route,
+			semconv.HTTPRequestMethodKey.String(c.Request.Method),
+			semconv.HTTPRoute(route),
+			tracing.AttrRequestId.String(c.GetString(common.RequestIdKey)),
+		)
+		c.Request = c.Request.WithContext(ctx)
+		defer func() {
+			c.Request = c.Request.WithContext(parent)
+		}()
+
+		c.Next()
+
+		status := c.Writer.Status()
+		span.SetAttributes(
+			semconv.HTTPResponseStatusCode(status),
+			tracing.AttrUserId.Int(common.GetContextKeyInt(c, constant.ContextKeyUserId)),
+		)
+		if channelId := common.GetContextKeyInt(c, constant.ContextKeyChannelId); channelId > 0 {
+			span.SetAttributes(tracing.AttrChannelId.Int(channelId))
+		}
+		if model := common.GetContextKeyString(c, constant.ContextKeyOriginalModel); model != "" {
+			span.SetAttributes(tracing.AttrModel.String(model))
+		}
+		if group := common.GetContextKeyString(c, constant.ContextKeyUsingGroup); group != "" {
+			span.SetAttributes(tracing.AttrGroup.String(group))
+		}
+		if status >= http.StatusInternalServerError {
+			span.SetStatus(codes.Error, fmt.Sprintf("status code %d", status))
+		}
+		span.End()
+	}
+}
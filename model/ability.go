@@ -122,6 +122,8 @@ func GetChannel(group string, model string, retry int, requestPath string) (*Cha
 		return nil, err
 	}
 	abilities = filterAbilitiesByRequestPath(abilities, requestPath)
+	abilities = filterAbilitiesByBreaker(abilities, model)
+	abilities = filterAbilitiesByCooldown(abilities)
 	channel := Channel{}
 	if len(abilities) > 0 {
 		// Randomly choose one
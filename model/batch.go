@@ -0,0 +1,222 @@
+package model
+
+import (
+	"github.com/QuantumNous/new-api/common"
+
+	"gorm.io/gorm"
+)
+
+// 状态与 OpenAI Batch 对象保持一致
+const (
+	BatchStatusValidating = "validating"
+	BatchStatusFailed     = "failed"
+	BatchStatusInProgress = "in_progress"
+	BatchStatusFinalizing = "finalizing"
+	BatchStatusCompleted  = "completed"
+	BatchStatusExpired    = "expired"
+	BatchStatusCancelling = "cancelling"
+	BatchStatusCancelled  = "cancelled"
+)
+
+const (
+	// BatchModeLocal 在本地逐条通过 Relay 流程执行
+	BatchModeLocal = "local"
+	// BatchModeUpstream 整体转发到支持 batch 的上游渠道
+	BatchModeUpstream = "upstream"
+)
+
+var batchActiveStatuses = []string{
+	BatchStatusValidating,
+	BatchStatusInProgress,
+	BatchStatusFinalizing,
+	BatchStatusCancelling,
+}
+
+// Batch 记录 /v1/batches 创建的批处理任务，字段与 OpenAI Batch 对象对应。
+// 与 Task 类似，由后台系统任务推进状态，并按行计费。
+type Batch struct {
+	Id               int64  `json:"-" gorm:"primary_key;AUTO_INCREMENT"`
+	BatchId          string `json:"id" gorm:"type:varchar(64);uniqueIndex"`
+	UserId           int    `json:"-" gorm:"index"`
+	TokenId          int    `json:"-" gorm:"index"`
+	Group            string `json:"-" gorm:"type:varchar(50)"`
+	Endpoint         string `json:"endpoint" gorm:"type:varchar(64)"`
+	CompletionWindow string `json:"completion_window" gorm:"type:varchar(16)"`
+	Mode             string `json:"-" gorm:"type:varchar(16)"`
+	ChannelId        int    `json:"-" gorm:"index;default:0"`
+	UpstreamBatchId  string `json:"-" gorm:"type:varchar(191);default:''"`
+	InputFileId      string `json:"input_file_id" gorm:"type:varchar(191)"`
+	OutputFileId     string `json:"output_file_id" gorm:"type:varchar(191);default:''"`
+	ErrorFileId      string `json:"error_file_id" gorm:"type:varchar(191);default:''"`
+	Status           string `json:"status" gorm:"type:varchar(20);index"`
+	TotalCount       int    `json:"-" gorm:"default:0"`
+	CompletedCount   int    `json:"-" gorm:"default:0"`
+	FailedCount      int    `json:"-" gorm:"default:0"`
+	// ProcessedCount 已处理（本地执行）或已结算（上游转发）的行数，
+	// 后台任务每轮从此处继续，避免重复执行和重复计费
+	ProcessedCount int `json:"-" gorm:"default:0"`
+	// OutputSegments/ErrorSegments 每轮本地执行产生的结果分段（存储 key 列表，JSON），完成时合并为输出文件
+	OutputSegments string `json:"-" gorm:"type:text"`
+	ErrorSegments  string `json:"-" gorm:"type:text"`
+	Errors         string `json:"-" gorm:"type:text"`
+	Metadata       string `json:"-" gorm:"type:text"`
+	CreatedAt      int64  `json:"created_at" gorm:"bigint;index"`
+	InProgressAt   int64  `json:"in_progress_at" gorm:"bigint;default:0"`
+	FinalizingAt   int64  `json:"finalizing_at" gorm:"bigint;default:0"`
+	CompletedAt    int64  `json:"completed_at" gorm:"bigint;default:0"`
+	FailedAt       int64  `json:"failed_at" gorm:"bigint;default:0"`
+	ExpiredAt      int64  `json:"expired_at" gorm:"bigint;default:0"`
+	ExpiresAt      int64  `json:"expires_at" gorm:"bigint;default:0"`
+	CancellingAt   int64  `json:"cancelling_at" gorm:"bigint;default:0"`
+	CancelledAt    int64  `json:"cancelled_at" gorm:"bigint;default:0"`
+}
+
+// GenerateBatchID 生成对外暴露的 batch_xxxx 格式 ID
+func GenerateBatchID() string {
+	key, _ := common.GenerateRandomCharsKey(24)
+	return "batch_" + key
+}
+
+func (b *Batch) Insert() error {
+	if b.CreatedAt == 0 {
+		b.CreatedAt = common.GetTimestamp()
+	}
+	return DB.Create(b).Error
+}
+
+// IsFinished 批处理是否已处于终态
+func (b *Batch) IsFinished() bool {
+	switch b.Status {
+	case BatchStatusCompleted, BatchStatusFailed, BatchStatusExpired, BatchStatusCancelled:
+		return true
+	}
+	return false
+}
+
+// UpdateWithStatus 以 fromStatus 作为条件更新（CAS），返回是否更新成功
+func (b *Batch) UpdateWithStatus(fromStatus string) (bool, error) {
+	result := DB.Model(b).Where("status = ?", fromStatus).Select("*").Updates(b)
+	if result.Error != nil {
+		return false, result.Error
+	}
+	return result.RowsAffected > 0, nil
+}
+
+// SaveProgress 仅更新执行进度相关字段，不覆盖状态（状态可能已被取消请求修改）
+func (b *Batch) SaveProgress() error {
+	return DB.Model(&Batch{}).Where("id = ?", b.Id).Updates(map[string]any{
+		"total_count":     b.TotalCount,
+		"processed_count": b.ProcessedCount,
+		"completed_count": b.CompletedCount,
+		"failed_count":    b.FailedCount,
+		"output_segments": b.OutputSegments,
+		"error_segments":  b.ErrorSegments,
+	}).Error
+}
+
+// RequestCancel 将未结束的批处理标记为 cancelling，由后台任务完成实际取消
+func (b *Batch) RequestCancel() (bool, error) {
+	now := common.GetTimestamp()
+	result := DB.Model(&Batch{}).
+		Where("id = ? AND status IN ?", b.Id, []string{BatchStatusValidating, BatchStatusInProgress}).
+		Updates(map[string]any{
+			"status":        BatchStatusCancelling,
+			"cancelling_at": now,
+		})
+	if result.Error != nil {
+		return false, result.Error
+	}
+	if result.RowsAffected > 0 {
+		b.Status = BatchStatusCancelling
+		b.CancellingAt = now
+	}
+	return result.RowsAffected > 0, nil
+}
+
+// GetBatchStatus 读取最新状态，用于执行过程中检查是否被取消
+func GetBatchStatus(id int64) (string, error) {
+	var status string
+	err := DB.Model(&Batch{}).Where("id = ?", id).Pluck("status", &status).Error
+	return status, err
+}
+
+func GetUserBatchById(userId int, batchId string) (*Batch, error) {
+	if batchId == "" {
+		return nil, gorm.ErrRecordNotFound
+	}
+	var batch Batch
+	err := DB.Where("user_id = ? AND batch_id = ?", userId, batchId).First(&batch).Error
+	if err != nil {
+		return nil, err
+	}
+	return &batch, nil
+}
+
+// GetUserBatches 按创建时间倒序分页，after 为上一页最后一个批处理 ID
+func GetUserBatches(userId int, after string, limit int) ([]*Batch, error) {
+	var batches []*Batch
+	query := DB.Where("user_id = ?", userId)
+	if after != "" {
+		var cursor Batch
+		if err := DB.Select("id").Where("user_id = ? AND batch_id = ?", userId, after).First(&cursor).Error; err == nil {
+			query = query.Where("id < ?", cursor.Id)
+		}
+	}
+	err := query.Order("id desc").Limit(limit).Find(&batches).Error
+	return batches, err
+}
+
+// GetActiveBatches 获取需要后台推进的批处理，按创建顺序处理
+func GetActiveBatches(limit int) ([]*Batch, error) {
+	var batches []*Batch
+	err := DB.Where("status IN ?", batchActiveStatuses).Order("id asc").Limit(limit).Find(&batches).Error
+	return batches, err
+}
+
+// HasActiveBatches 是否存在未结束的批处理，用于决定是否调度 batch_run 系统任务
+func HasActiveBatches() bool {
+	var id int64
+	err := DB.Model(&Batch{}).
+		Where("status IN ?", batchActiveStatuses).
+		Limit(1).
+		Pluck("id", &id).Error
+	return err == nil && id != 0
+}
+
+// BatchLineResult 本地执行中已经走完转发与计费、但还没有写入结果分段的行。
+// 每行执行完立即保存，中断后继续执行或结束批处理时直接使用保存的结果，不再重新转发和计费；
+// 结果写入分段并保存进度后删除
+type BatchLineResult struct {
+	Id      int64  `json:"id"`
+	BatchId int64  `json:"batch_id" gorm:"uniqueIndex:idx_batch_line_result"`
+	Line    int    `json:"line" gorm:"uniqueIndex:idx_batch_line_result"`
+	Result  string `json:"result" gorm:"type:text"`
+}
+
+// SaveBatchLineResult 保存一行的执行结果，line 为输入文件中的行序号（从 1 开始）
+func SaveBatchLineResult(batchId int64, line int, result string) error {
+	return DB.Create(&BatchLineResult{BatchId: batchId, Line: line, Result: result}).Error
+}
+
+// GetBatchLineResults 读取进度之后已保存的执行结果，按行序号索引
+func GetBatchLineResults(batchId int64, afterLine int) (map[int]string, error) {
+	var rows []BatchLineResult
+	if err := DB.Where("batch_id = ? AND line > ?", batchId, afterLine).Find(&rows).Error; err != nil {
+		return nil, err
+	}
+	results := make(map[int]string, len(rows))
+	for _, row := range rows {
+		results[row.Line] = row.Result
+	}
+	return results, nil
+}
+
+// DeleteBatchLineResults 删除已写入分段的行，throughLine 为已保存进度的行数
+func DeleteBatchLineResults(batchId int64, throughLine int) error {
+	return DB.Where("batch_id = ? AND line <= ?", batchId, throughLine).Delete(&BatchLineResult{}).Error
+}
+
+// DeleteAllBatchLineResults 批处理结束后删除剩余的执行结果
+func DeleteAllBatchLineResults(batchId int64) error {
+	return DB.Where("batch_id = ?", batchId).Delete(&BatchLineResult{}).Error
+}
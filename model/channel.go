@@ -13,6 +13,8 @@ import (
 	"github.com/QuantumNous/new-api/constant"
 	"github.com/QuantumNous/new-api/dto"
 	"github.com/QuantumNous/new-api/logger"
+	channelbreaker "github.com/QuantumNous/new-api/pkg/channel_breaker"
+	channelcooldown "github.com/QuantumNous/new-api/pkg/channel_cooldown"
 	"github.com/QuantumNous/new-api/types"
 
 	"github.com/samber/lo"
@@ -23,7 +25,8 @@ import (
 type Channel struct {
 	Id                 int     `json:"id"`
 	Type               int     `json:"type" gorm:"default:0"`
-	Key                string  `json:"key" gorm:"not null"`
+	Key                string  `json:"key" gorm:"not null;serializer:secret"` // 配置主密钥后加密保存，读出时自动解密
+	KeyHash            string  `json:"-" gorm:"type:varchar(64);index"`       // 加密保存时密钥的确定性摘要，用于按密钥搜索渠道
 	OpenAIOrganization *string `json:"openai_organization"`
 	TestModel          *string `json:"test_model"`
 	Status             int     `json:"status" gorm:"default:1"`
@@ -196,7 +199,38 @@ func (channel *Channel) GetKeys() []string {
 	return keys
 }
 
+// GetNextEnabledKey 多 Key 模式下按轮询/随机策略选择启用的 Key，跳过因上游限流冷却中的 Key；
+// 所有启用的 Key 都在冷却时仍按原有逻辑选择
 func (channel *Channel) GetNextEnabledKey() (string, int, *types.NewAPIError) {
+	if !channel.ChannelInfo.IsMultiKey {
+		return channel.getNextEnabledKey(nil)
+	}
+	coolingKeys := channelcooldown.CoolingKeys(channel.Id)
+	if len(coolingKeys) == 0 {
+		return channel.getNextEnabledKey(nil)
+	}
+	return channel.getNextEnabledKey(func(idx int) bool {
+		return coolingKeys[idx]
+	})
+}
+
+// GetNextAvailableKey 与 GetNextEnabledKey 相同，但多 Key 模式下还会跳过对 modelName 熔断中的 Key；
+// 所有启用的 Key 都被跳过时仍按原有逻辑选择
+func (channel *Channel) GetNextAvailableKey(modelName string) (string, int, *types.NewAPIError) {
+	if !channel.ChannelInfo.IsMultiKey {
+		return channel.getNextEnabledKey(nil)
+	}
+	openKeys := channelbreaker.OpenKeys(channel.Id, modelName)
+	coolingKeys := channelcooldown.CoolingKeys(channel.Id)
+	if len(openKeys) == 0 && len(coolingKeys) == 0 {
+		return channel.getNextEnabledKey(nil)
+	}
+	return channel.getNextEnabledKey(func(idx int) bool {
+		return openKeys[idx] || coolingKeys[idx]
+	})
+}
+
+func (channel *Channel) getNextEnabledKey(skip func(idx int) bool) (string, int, *types.NewAPIError) {
 	// If not in multi-key mode, return the original key string directly.
 	if !channel.ChannelInfo.IsMultiKey {
 		return channel.Key, 0, nil
@@ -238,6 +272,22 @@ func (channel *Channel) GetNextEnabledKey() (string, int, *types.NewAPIError) {
 	if len(enabledIdx) == 0 {
 		return "", 0, types.NewError(errors.New("no enabled keys"), types.ErrorCodeChannelNoAvailableKey)
 	}
+	if skip != nil {
+		available := make([]int, 0, len(enabledIdx))
+		for _, idx := range enabledIdx {
+			if !skip(idx) {
+				available = append(available, idx)
+			}
+		}
+		if len(available) == 0 || len(available) == len(enabledIdx) {
+			skip = nil
+		} else {
+			enabledIdx = available
+		}
+	}
+	isSelectable := func(idx int) bool {
+		return getStatus(idx) == common.ChannelStatusEnabled && (skip == nil || !skip(idx))
+	}
 
 	switch channel.ChannelInfo.MultiKeyMode {
 	case constant.MultiKeyModeRandom:
@@ -268,7 +318,7 @@ func (channel *Channel) GetNextEnabledKey() (string, int, *types.NewAPIError) {
 		}
 		for i := 0; i < len(keys); i++ {
 			idx := (start + i) % len(keys)
-			if getStatus(idx) == common.ChannelStatusEnabled {
+			if isSelectable(idx) {
 				// update polling index for next call (point to the next position)
 				channel.ChannelInfo.MultiKeyPollingIndex = (idx + 1) % len(keys)
 				return keys[idx], idx, nil
@@ -342,6 +392,17 @@ func (channel *Channel) GetAutoBan() bool {
 	return *channel.AutoBan == 1
 }
 
+// BeforeSave 写入密钥时同步更新密钥摘要；不写入密钥（Key 为空）时保留原有摘要
+func (channel *Channel) BeforeSave(tx *gorm.DB) error {
+	if channel.Key == "" {
+		return nil
+	}
+	if hash := common.SecretLookupHash(channel.Key); hash != channel.KeyHash {
+		channel.KeyHash = hash
+	}
+	return nil
+}
+
 func (channel *Channel) Save() error {
 	return DB.Save(channel).Error
 }
@@ -376,6 +437,16 @@ func GetChannelsByTag(tag string, idSort bool, selectAll bool, sortOptions ...Ch
 	return channels, err
 }
 
+// channelKeyCondition 按密钥精确匹配渠道：加密保存的密钥每次密文都不同，改为匹配密钥摘要，
+// 尚未加密的旧数据仍按明文匹配
+func channelKeyCondition(keyword string) (string, []any) {
+	hashes := common.SecretLookupHashes(keyword)
+	if len(hashes) == 0 {
+		return commonKeyCol + " = ?", []any{keyword}
+	}
+	return "(" + commonKeyCol + " = ? OR key_hash IN ?)", []any{keyword, hashes}
+}
+
 func SearchChannels(keyword string, group string, model string, idSort bool, sortOptions ...ChannelSortOptions) ([]*Channel, error) {
 	var channels []*Channel
 	modelsCol := "`models`"
@@ -397,8 +468,10 @@ func SearchChannels(keyword string, group string, model string, idSort bool, sor
 	baseQuery := DB.Model(&Channel{}).Omit("key")
 
 	// 构造WHERE子句
-	whereClause := "(id = ? OR name LIKE ? OR " + commonKeyCol + " = ? OR " + baseURLCol + " LIKE ?) AND " + modelsCol + " LIKE ?"
-	args := []any{common.String2Int(keyword), "%" + keyword + "%", keyword, "%" + keyword + "%", "%" + model + "%"}
+	keyClause, keyArgs := channelKeyCondition(keyword)
+	whereClause := "(id = ? OR name LIKE ? OR " + keyClause + " OR " + baseURLCol + " LIKE ?) AND " + modelsCol + " LIKE ?"
+	args := append([]any{common.String2Int(keyword), "%" + keyword + "%"}, keyArgs...)
+	args = append(args, "%"+keyword+"%", "%"+model+"%")
 	baseQuery = ApplyChannelGroupFilter(baseQuery.Where(whereClause, args...), group)
 
 	// 执行查询
@@ -852,6 +925,18 @@ func EditChannelByTag(tag string, newTag *string, modelMapping *string, models *
 	return nil
 }
 
+// UpdateChannelKey 只更新渠道密钥，按列更新不经过序列化器，需要先加密
+func UpdateChannelKey(id int, key string) error {
+	encrypted, err := common.EncryptSecret(key)
+	if err != nil {
+		return err
+	}
+	return DB.Model(&Channel{}).Where("id = ?", id).Updates(map[string]any{
+		"key":      encrypted,
+		"key_hash": common.SecretLookupHash(key),
+	}).Error
+}
+
 func UpdateChannelUsedQuota(id int, quota int) {
 	if common.BatchUpdateEnabled {
 		addNewRecord(BatchUpdateTypeChannelUsedQuota, id, quota)
@@ -917,8 +1002,10 @@ func SearchTags(keyword string, group string, model string, idSort bool) ([]*str
 	baseQuery := DB.Model(&Channel{}).Omit("key")
 
 	// 构造WHERE子句
-	whereClause := "(id = ? OR name LIKE ? OR " + commonKeyCol + " = ? OR " + baseURLCol + " LIKE ?) AND " + modelsCol + " LIKE ?"
-	args := []any{common.String2Int(keyword), "%" + keyword + "%", keyword, "%" + keyword + "%", "%" + model + "%"}
+	keyClause, keyArgs := channelKeyCondition(keyword)
+	whereClause := "(id = ? OR name LIKE ? OR " + keyClause + " OR " + baseURLCol + " LIKE ?) AND " + modelsCol + " LIKE ?"
+	args := append([]any{common.String2Int(keyword), "%" + keyword + "%"}, keyArgs...)
+	args = append(args, "%"+keyword+"%", "%"+model+"%")
 	baseQuery = ApplyChannelGroupFilter(baseQuery.Where(whereClause, args...), group)
 
 	subQuery := baseQuery.
@@ -0,0 +1,109 @@
+package model
+
+import (
+	"github.com/QuantumNous/new-api/common"
+	channelbreaker "github.com/QuantumNous/new-api/pkg/channel_breaker"
+)
+
+// isChannelBreakerAvailable reports whether the channel can serve modelName
+// under the circuit breaker: a single-key channel is unavailable while its
+// breaker is open, a multi-key channel only when every enabled key is open.
+func isChannelBreakerAvailable(channel *Channel, modelName string) bool {
+	return hasUnblockedKey(channel, channelbreaker.OpenKeys(channel.Id, modelName))
+}
+
+// hasUnblockedKey reports whether the channel still has a usable key when the
+// keys in blocked are skipped. Single-key channels use index 0.
+func hasUnblockedKey(channel *Channel, blocked map[int]bool) bool {
+	if len(blocked) == 0 {
+		return true
+	}
+	if !channel.ChannelInfo.IsMultiKey {
+		return !blocked[0]
+	}
+	keySize := channel.ChannelInfo.MultiKeySize
+	if keySize <= 0 {
+		keySize = len(channel.GetKeys())
+	}
+	for i := 0; i < keySize; i++ {
+		if status, ok := channel.ChannelInfo.MultiKeyStatusList[i]; ok && status != common.ChannelStatusEnabled {
+			continue
+		}
+		if !blocked[i] {
+			return true
+		}
+	}
+	return false
+}
+
+// filterChannelsByBreaker drops channels whose circuit breaker for modelName is
+// open. Caller must hold channelSyncLock (read lock). The cached slice is never mutated.
+func filterChannelsByBreaker(channels []int, modelName string) []int {
+	if !channelbreaker.Enabled() || len(channels) == 0 {
+		return channels
+	}
+	return filterCachedChannels(channels, func(channel *Channel) bool {
+		return isChannelBreakerAvailable(channel, modelName)
+	})
+}
+
+// filterCachedChannels keeps the channels for which available returns true;
+// ids missing from the cache are kept. Caller must hold channelSyncLock (read lock).
+func filterCachedChannels(channels []int, available func(channel *Channel) bool) []int {
+	var filtered []int
+	for i, channelId := range channels {
+		channel, ok := channelsIDM[channelId]
+		keep := !ok || available(channel)
+		if filtered == nil {
+			if keep {
+				continue
+			}
+			// copy on first drop so the common case allocates nothing
+			filtered = make([]int, 0, len(channels))
+			filtered = append(filtered, channels[:i]...)
+			continue
+		}
+		if keep {
+			filtered = append(filtered, channelId)
+		}
+	}
+	if filtered == nil {
+		return channels
+	}
+	return filtered
+}
+
+// filterAbilitiesByBreaker is the DB (non-memory-cache) counterpart of
+// filterChannelsByBreaker. Channels are only loaded when some candidate has an
+// open breaker.
+func filterAbilitiesByBreaker(abilities []Ability, modelName string) []Ability {
+	if !channelbreaker.Enabled() || len(abilities) == 0 {
+		return abilities
+	}
+	suspect := make([]int, 0)
+	for _, ability := range abilities {
+		if len(channelbreaker.OpenKeys(ability.ChannelId, modelName)) > 0 {
+			suspect = append(suspect, ability.ChannelId)
+		}
+	}
+	if len(suspect) == 0 {
+		return abilities
+	}
+	var channels []*Channel
+	if err := DB.Where("id IN ?", suspect).Find(&channels).Error; err != nil {
+		return abilities
+	}
+	unavailable := make(map[int]bool, len(channels))
+	for _, channel := range channels {
+		if !isChannelBreakerAvailable(channel, modelName) {
+			unavailable[channel.Id] = true
+		}
+	}
+	filtered := make([]Ability, 0, len(abilities))
+	for _, ability := range abilities {
+		if !unavailable[ability.ChannelId] {
+			filtered = append(filtered, ability)
+		}
+	}
+	return filtered
+}
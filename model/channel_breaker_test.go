@@ -0,0 +1,48 @@
+package model
+
+import (
+	"testing"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/constant"
+	channelbreaker "github.com/QuantumNous/new-api/pkg/channel_breaker"
+	"github.com/QuantumNous/new-api/setting/operation_setting"
+	"github.com/stretchr/testify/require"
+)
+
+func TestChannelBreakerSkipsOpenKeys(t *testing.T) {
+	setting := operation_setting.GetChannelBreakerSetting()
+	saved := *setting
+	setting.Enabled = true
+	setting.ConsecutiveFailures = 1
+	t.Cleanup(func() {
+		*setting = saved
+		channelbreaker.Reset(970001)
+		channelbreaker.Reset(970002)
+	})
+
+	single := &Channel{Id: 970001, Key: "sk-single"}
+	multi := &Channel{Id: 970002, Key: "sk-a\nsk-b", ChannelInfo: ChannelInfo{
+		IsMultiKey:   true,
+		MultiKeySize: 2,
+		MultiKeyMode: constant.MultiKeyModeRandom,
+	}}
+
+	channelbreaker.Record(single.Id, "gpt-test", 0, false)
+	require.False(t, isChannelBreakerAvailable(single, "gpt-test"))
+	require.True(t, isChannelBreakerAvailable(single, "other-model"))
+
+	// 多 Key 渠道只有部分 Key 熔断时仍可用，且不会再选中熔断中的 Key
+	channelbreaker.Record(multi.Id, "gpt-test", 0, false)
+	require.True(t, isChannelBreakerAvailable(multi, "gpt-test"))
+	for i := 0; i < 10; i++ {
+		key, index, apiErr := multi.GetNextAvailableKey("gpt-test")
+		require.Nil(t, apiErr)
+		require.Equal(t, 1, index)
+		require.Equal(t, "sk-b", key)
+	}
+
+	// 被禁用的 Key 不计入可用 Key
+	multi.ChannelInfo.MultiKeyStatusList = map[int]int{1: common.ChannelStatusAutoDisabled}
+	require.False(t, isChannelBreakerAvailable(multi, "gpt-test"))
+}
@@ -3,7 +3,6 @@ package model
 import (
 	"errors"
 	"fmt"
-	"math/rand"
 	"sort"
 	"strings"
 	"sync"
@@ -13,6 +12,7 @@ import (
 	"github.com/QuantumNous/new-api/constant"
 	"github.com/QuantumNous/new-api/dto"
 	"github.com/QuantumNous/new-api/logger"
+	prommetrics "github.com/QuantumNous/new-api/pkg/prom_metrics"
 	"github.com/QuantumNous/new-api/setting/ratio_setting"
 )
 
@@ -21,6 +21,10 @@ var channelsIDM map[int]*Channel                     // all channels include dis
 // channel2advancedCustomConfig caches parsed Advanced Custom (type 58) configs so
 // path-aware selection avoids re-parsing JSON per request. Refreshed on full sync.
 var channel2advancedCustomConfig map[int]*dto.AdvancedCustomConfig
+
+// channel2priceMultiplier caches each channel's configured price multiplier for
+// the lowest_cost routing strategy. Refreshed on full sync and channel update.
+var channel2priceMultiplier map[int]float64
 var channelSyncLock sync.RWMutex
 
 func InitChannelCache() {
@@ -29,6 +33,7 @@ func InitChannelCache() {
 	}
 	newChannelId2channel := make(map[int]*Channel)
 	newChannel2advancedCustomConfig := make(map[int]*dto.AdvancedCustomConfig)
+	newChannel2priceMultiplier := make(map[int]float64)
 	var channels []*Channel
 	DB.Find(&channels)
 	for _, channel := range channels {
@@ -38,6 +43,9 @@ func InitChannelCache() {
 				newChannel2advancedCustomConfig[channel.Id] = config
 			}
 		}
+		if multiplier := channel.GetSetting().PriceMultiplier; multiplier > 0 {
+			newChannel2priceMultiplier[channel.Id] = multiplier
+		}
 	}
 	var abilities []*Ability
 	DB.Find(&abilities)
@@ -93,6 +101,7 @@ func InitChannelCache() {
 	}
 	channelsIDM = newChannelId2channel
 	channel2advancedCustomConfig = newChannel2advancedCustomConfig
+	channel2priceMultiplier = newChannel2priceMultiplier
 	channelSyncLock.Unlock()
 	common.SysLog("channels synced from database")
 }
@@ -105,7 +114,7 @@ func SyncChannelCache(frequency int) {
 	}
 }
 
-func GetRandomSatisfiedChannel(group string, model string, retry int, requestPath string) (*Channel, error) {
+func GetRandomSatisfiedChannel(group string, model string, retry int, requestPath string, stream bool) (*Channel, error) {
 	// if memory cache is disabled, get channel directly from database
 	if !common.MemoryCacheEnabled {
 		return GetChannel(group, model, retry, requestPath)
@@ -123,6 +132,11 @@ func GetRandomSatisfiedChannel(group string, model string, retry int, requestPat
 		channels = filterChannelsByRequestPath(group2model2channels[group][normalizedModel], requestPath)
 	}
 
+	// Skip channels whose circuit breaker is open for this model.
+	channels = filterChannelsByBreaker(channels, model)
+	// Steer away from channels cooling down after an upstream rate limit.
+	channels = filterChannelsByCooldown(channels)
+
 	if len(channels) == 0 {
 		return nil, nil
 	}
@@ -154,12 +168,10 @@ func GetRandomSatisfiedChannel(group string, model string, retry int, requestPat
 	targetPriority := int64(sortedUniquePriorities[retry])
 
 	// get the priority for the given retry number
-	var sumWeight = 0
 	var targetChannels []*Channel
 	for _, channelId := range channels {
 		if channel, ok := channelsIDM[channelId]; ok {
 			if channel.GetPriority() == targetPriority {
-				sumWeight += channel.GetWeight()
 				targetChannels = append(targetChannels, channel)
 			}
 		} else {
@@ -171,32 +183,11 @@ func GetRandomSatisfiedChannel(group string, model string, retry int, requestPat
 		return nil, errors.New(fmt.Sprintf("no channel found, group: %s, model: %s, priority: %d", group, model, targetPriority))
 	}
 
-	// smoothing factor and adjustment
-	smoothingFactor := 1
-	smoothingAdjustment := 0
-
-	if sumWeight == 0 {
-		// when all channels have weight 0, set sumWeight to the number of channels and set smoothing adjustment to 100
-		// each channel's effective weight = 100
-		sumWeight = len(targetChannels) * 100
-		smoothingAdjustment = 100
-	} else if sumWeight/len(targetChannels) < 10 {
-		// when the average weight is less than 10, set smoothing factor to 100
-		smoothingFactor = 100
+	if channel := pickChannelByRoutingStrategy(group, model, stream, targetChannels); channel != nil {
+		return channel, nil
 	}
-
-	// Calculate the total weight of all channels up to endIdx
-	totalWeight := sumWeight * smoothingFactor
-
-	// Generate a random value in the range [0, totalWeight)
-	randomWeight := rand.Intn(totalWeight)
-
-	// Find a channel based on its weight
-	for _, channel := range targetChannels {
-		randomWeight -= channel.GetWeight()*smoothingFactor + smoothingAdjustment
-		if randomWeight < 0 {
-			return channel, nil
-		}
+	if channel := weightedRandomChannel(targetChannels); channel != nil {
+		return channel, nil
 	}
 	// return null if no channel is not found
 	return nil, errors.New("channel not found")
@@ -304,5 +295,49 @@ func CacheUpdateChannel(channel *Channel) {
 		logger.LogDebug(nil, "CacheUpdateChannel before: id=%d, name=%s, status=%d, polling_index=%d", channel.Id, channel.Name, channel.Status, oldChannel.ChannelInfo.MultiKeyPollingIndex)
 	}
 	channelsIDM[channel.Id] = channel
+	if channel2priceMultiplier == nil {
+		channel2priceMultiplier = make(map[int]float64)
+	}
+	if multiplier := channel.GetSetting().PriceMultiplier; multiplier > 0 {
+		channel2priceMultiplier[channel.Id] = multiplier
+	} else {
+		delete(channel2priceMultiplier, channel.Id)
+	}
 	logger.LogDebug(nil, "CacheUpdateChannel after: id=%d, name=%s, status=%d, polling_index=%d", channel.Id, channel.Name, channel.Status, channel.ChannelInfo.MultiKeyPollingIndex)
 }
+
+// GetChannelStats 返回所有渠道的状态快照，供 /metrics 抓取时使用；未开启内存缓存时从数据库读取
+func GetChannelStats() []prommetrics.ChannelStat {
+	var channels []*Channel
+	if common.MemoryCacheEnabled {
+		channelSyncLock.RLock()
+		channels = make([]*Channel, 0, len(channelsIDM))
+		for _, channel := range channelsIDM {
+			channels = append(channels, channel)
+		}
+		channelSyncLock.RUnlock()
+	} else if err := DB.Select("id", "name", "type", "status", "channel_info").Find(&channels).Error; err != nil {
+		common.SysLog("failed to get channel stats: " + err.Error())
+		return nil
+	}
+
+	stats := make([]prommetrics.ChannelStat, 0, len(channels))
+	for _, channel := range channels {
+		stat := prommetrics.ChannelStat{
+			Id:     channel.Id,
+			Name:   channel.Name,
+			Type:   channel.Type,
+			Status: channel.Status,
+		}
+		if channel.ChannelInfo.IsMultiKey {
+			stat.KeyCount = channel.ChannelInfo.MultiKeySize
+			for _, status := range channel.ChannelInfo.MultiKeyStatusList {
+				if status != common.ChannelStatusEnabled {
+					stat.DisabledKeys++
+				}
+			}
+		}
+		stats = append(stats, stat)
+	}
+	return stats
+}
@@ -0,0 +1,63 @@
+package model
+
+import (
+	channelcooldown "github.com/QuantumNous/new-api/pkg/channel_cooldown"
+)
+
+// isChannelCooldownAvailable reports whether the channel has a key that is not
+// cooling down after an upstream rate limit.
+func isChannelCooldownAvailable(channel *Channel) bool {
+	return hasUnblockedKey(channel, channelcooldown.CoolingKeys(channel.Id))
+}
+
+// filterChannelsByCooldown drops channels that are cooling down. Unlike the
+// circuit breaker, when every candidate is cooling the original list is
+// returned: the cool-down only steers traffic, it never makes a model
+// unavailable. Caller must hold channelSyncLock (read lock).
+func filterChannelsByCooldown(channels []int) []int {
+	if !channelcooldown.Enabled() || len(channels) == 0 {
+		return channels
+	}
+	filtered := filterCachedChannels(channels, isChannelCooldownAvailable)
+	if len(filtered) == 0 {
+		return channels
+	}
+	return filtered
+}
+
+// filterAbilitiesByCooldown is the DB (non-memory-cache) counterpart of
+// filterChannelsByCooldown.
+func filterAbilitiesByCooldown(abilities []Ability) []Ability {
+	if !channelcooldown.Enabled() || len(abilities) == 0 {
+		return abilities
+	}
+	suspect := make([]int, 0)
+	for _, ability := range abilities {
+		if len(channelcooldown.CoolingKeys(ability.ChannelId)) > 0 {
+			suspect = append(suspect, ability.ChannelId)
+		}
+	}
+	if len(suspect) == 0 {
+		return abilities
+	}
+	var channels []*Channel
+	if err := DB.Where("id IN ?", suspect).Find(&channels).Error; err != nil {
+		return abilities
+	}
+	cooling := make(map[int]bool, len(channels))
+	for _, channel := range channels {
+		if !isChannelCooldownAvailable(channel) {
+			cooling[channel.Id] = true
+		}
+	}
+	filtered := make([]Ability, 0, len(abilities))
+	for _, ability := range abilities {
+		if !cooling[ability.ChannelId] {
+			filtered = append(filtered, ability)
+		}
+	}
+	if len(filtered) == 0 {
+		return abilities
+	}
+	return filtered
+}
@@ -0,0 +1,135 @@
+package model
+
+import (
+	"math"
+	"math/rand"
+	"time"
+
+	channelperf "github.com/QuantumNous/new-api/pkg/channel_perf"
+	"github.com/QuantumNous/new-api/setting/operation_setting"
+)
+
+// weightedRandomChannel picks a channel by weight. When all weights are 0 every
+// channel gets the same chance; small weights are scaled up so that a weight of
+// 0 still leaves a channel reachable.
+func weightedRandomChannel(channels []*Channel) *Channel {
+	if len(channels) == 0 {
+		return nil
+	}
+	sumWeight := 0
+	for _, channel := range channels {
+		sumWeight += channel.GetWeight()
+	}
+
+	// smoothing factor and adjustment
+	smoothingFactor := 1
+	smoothingAdjustment := 0
+
+	if sumWeight == 0 {
+		// when all channels have weight 0, set sumWeight to the number of channels and set smoothing adjustment to 100
+		// each channel's effective weight = 100
+		sumWeight = len(channels) * 100
+		smoothingAdjustment = 100
+	} else if sumWeight/len(channels) < 10 {
+		// when the average weight is less than 10, set smoothing factor to 100
+		smoothingFactor = 100
+	}
+
+	// Calculate the total weight of all channels up to endIdx
+	totalWeight := sumWeight * smoothingFactor
+
+	// Generate a random value in the range [0, totalWeight)
+	randomWeight := rand.Intn(totalWeight)
+
+	// Find a channel based on its weight
+	for _, channel := range channels {
+		randomWeight -= channel.GetWeight()*smoothingFactor + smoothingAdjustment
+		if randomWeight < 0 {
+			return channel
+		}
+	}
+	return nil
+}
+
+// pickChannelByRoutingStrategy 按分组 / 模型配置的路由策略，在同一优先级的候选渠道中选出得分最优的渠道，
+// 得分相同的渠道之间仍按权重随机。stream 表示请求是否为流式，按延迟选择时流式请求比较首字时间。返回 nil 表示使用默认的加权随机：
+// 策略为 weighted_random、所有渠道都缺少足够的样本，或部分渠道样本不足且命中了探索比例。
+// 调用方需持有 channelSyncLock 读锁
+func pickChannelByRoutingStrategy(group string, model string, stream bool, channels []*Channel) *Channel {
+	if len(channels) < 2 {
+		return nil
+	}
+	setting := operation_setting.GetChannelRoutingSetting()
+	strategy := operation_setting.GetChannelRoutingStrategy(group, model)
+
+	var score func(channel *Channel) (float64, bool) // 得分越低越优先，第二个返回值表示数据是否充足
+	switch strategy {
+	case operation_setting.ChannelRoutingLowestLatency, operation_setting.ChannelRoutingHighestSuccessRate:
+		window := time.Duration(setting.WindowSeconds) * time.Second
+		if window <= 0 {
+			window = 5 * time.Minute
+		}
+		minSamples := int64(setting.MinSamples)
+		if minSamples <= 0 {
+			minSamples = 1
+		}
+		score = func(channel *Channel) (float64, bool) {
+			stats := channelperf.Query(channel.Id, model, window)
+			if stats.Requests < minSamples {
+				return 0, false
+			}
+			if strategy != operation_setting.ChannelRoutingLowestLatency {
+				return -stats.SuccessRate, true
+			}
+			// 失败的请求往往很快返回，成功率不达标的渠道不能因此排在前面
+			if stats.Successes == 0 || stats.SuccessRate < setting.MinSuccessRate {
+				return math.Inf(1), true
+			}
+			if stream {
+				if stats.TtftSamples < minSamples {
+					return 0, false
+				}
+				return float64(stats.AvgTtftMs), true
+			}
+			return float64(stats.AvgLatencyMs), true
+		}
+	case operation_setting.ChannelRoutingLowestCost:
+		score = func(channel *Channel) (float64, bool) {
+			if multiplier, ok := channel2priceMultiplier[channel.Id]; ok {
+				return multiplier, true
+			}
+			return 1, true
+		}
+	case operation_setting.ChannelRoutingLeastInFlight:
+		score = func(channel *Channel) (float64, bool) {
+			return float64(channelperf.InFlight(channel.Id)), true
+		}
+	default:
+		return nil
+	}
+
+	var best []*Channel
+	bestScore := 0.0
+	sparse := 0
+	for _, channel := range channels {
+		s, ok := score(channel)
+		if !ok {
+			sparse++
+			continue
+		}
+		if len(best) == 0 || s < bestScore {
+			best = []*Channel{channel}
+			bestScore = s
+		} else if s == bestScore {
+			best = append(best, channel)
+		}
+	}
+	if len(best) == 0 {
+		return nil
+	}
+	// 部分渠道样本不足时，按探索比例回退到加权随机，避免这些渠道一直分不到流量而无法积累样本
+	if sparse > 0 && rand.Intn(100) < setting.ExplorePercent {
+		return nil
+	}
+	return weightedRandomChannel(best)
+}
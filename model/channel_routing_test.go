@@ -0,0 +1,127 @@
+package model
+
+import (
+	"testing"
+	"time"
+
+	channelperf "github.com/QuantumNous/new-api/pkg/channel_perf"
+	"github.com/QuantumNous/new-api/setting/operation_setting"
+	"github.com/stretchr/testify/require"
+)
+
+func withChannelRoutingStrategy(t *testing.T, strategy string) {
+	t.Helper()
+	setting := operation_setting.GetChannelRoutingSetting()
+	saved := *setting
+	setting.DefaultStrategy = strategy
+	setting.MinSamples = 2
+	setting.ExplorePercent = 0
+	setting.MinSuccessRate = 0.8
+	channelperf.Reset()
+	t.Cleanup(func() {
+		*setting = saved
+		channelperf.Reset()
+	})
+}
+
+func routingTestChannels(ids ...int) []*Channel {
+	channels := make([]*Channel, 0, len(ids))
+	for _, id := range ids {
+		channels = append(channels, &Channel{Id: id})
+	}
+	return channels
+}
+
+func TestPickChannelByRoutingStrategyLatencyAndSuccess(t *testing.T) {
+	withChannelRoutingStrategy(t, operation_setting.ChannelRoutingLowestLatency)
+	channels := routingTestChannels(1, 2, 3)
+
+	// 没有任何样本时回退到加权随机
+	require.Nil(t, pickChannelByRoutingStrategy("default", "gpt-test", false, channels))
+
+	for i := 0; i < 2; i++ {
+		channelperf.Record(1, "gpt-test", 400*time.Millisecond, true)
+		channelperf.Record(2, "gpt-test", 100*time.Millisecond, false)
+	}
+	for i := 0; i < 3; i++ {
+		channelperf.Record(3, "gpt-test", 500*time.Millisecond, true)
+	}
+	channelperf.Record(3, "gpt-test", 10*time.Millisecond, false)
+	// 其他模型的样本不参与比较
+	channelperf.Record(1, "other-model", time.Millisecond, true)
+
+	// 一直失败的渠道 2 与成功率不达标的渠道 3 都排在渠道 1 之后
+	picked := pickChannelByRoutingStrategy("default", "gpt-test", false, channels)
+	require.NotNil(t, picked)
+	require.Equal(t, 1, picked.Id)
+
+	// 放宽成功率要求后，渠道 3 按成功请求的平均延迟 500ms 比较，快速失败的请求不会拉低它的延迟
+	operation_setting.GetChannelRoutingSetting().MinSuccessRate = 0.5
+	picked = pickChannelByRoutingStrategy("default", "gpt-test", false, channels)
+	require.NotNil(t, picked)
+	require.Equal(t, 1, picked.Id)
+
+	// 流式请求比较首字时间
+	for i := 0; i < 2; i++ {
+		channelperf.RecordFirstToken(1, "gpt-test", 300*time.Millisecond)
+		channelperf.RecordFirstToken(3, "gpt-test", 100*time.Millisecond)
+	}
+	picked = pickChannelByRoutingStrategy("default", "gpt-test", true, channels)
+	require.NotNil(t, picked)
+	require.Equal(t, 3, picked.Id)
+
+	operation_setting.GetChannelRoutingSetting().DefaultStrategy = operation_setting.ChannelRoutingHighestSuccessRate
+	for i := 0; i < 20; i++ {
+		picked = pickChannelByRoutingStrategy("default", "gpt-test", false, channels)
+		require.NotNil(t, picked)
+		require.Equal(t, 1, picked.Id)
+	}
+}
+
+func TestPickChannelByRoutingStrategyCostAndInFlight(t *testing.T) {
+	withChannelRoutingStrategy(t, operation_setting.ChannelRoutingLowestCost)
+	channels := routingTestChannels(1, 2)
+
+	channelSyncLock.Lock()
+	saved := channel2priceMultiplier
+	channel2priceMultiplier = map[int]float64{1: 1.2, 2: 0.8}
+	channelSyncLock.Unlock()
+	t.Cleanup(func() {
+		channelSyncLock.Lock()
+		channel2priceMultiplier = saved
+		channelSyncLock.Unlock()
+	})
+
+	picked := pickChannelByRoutingStrategy("default", "gpt-test", false, channels)
+	require.NotNil(t, picked)
+	require.Equal(t, 2, picked.Id)
+
+	operation_setting.GetChannelRoutingSetting().DefaultStrategy = operation_setting.ChannelRoutingLeastInFlight
+	release := channelperf.Acquire(2)
+	picked = pickChannelByRoutingStrategy("default", "gpt-test", false, channels)
+	require.NotNil(t, picked)
+	require.Equal(t, 1, picked.Id)
+	release()
+	release()
+	require.Equal(t, int64(0), channelperf.InFlight(2))
+}
+
+func TestGetChannelRoutingStrategy(t *testing.T) {
+	setting := operation_setting.GetChannelRoutingSetting()
+	saved := *setting
+	t.Cleanup(func() { *setting = saved })
+
+	setting.DefaultStrategy = operation_setting.ChannelRoutingWeightedRandom
+	setting.GroupStrategies = map[string]string{"vip": operation_setting.ChannelRoutingLowestLatency}
+	setting.ModelStrategies = map[string]string{
+		"gpt-4o*":     operation_setting.ChannelRoutingLowestCost,
+		"gpt-4o-mini": operation_setting.ChannelRoutingLeastInFlight,
+		"broken":      "unknown",
+	}
+
+	require.Equal(t, operation_setting.ChannelRoutingLeastInFlight, operation_setting.GetChannelRoutingStrategy("vip", "gpt-4o-mini"))
+	require.Equal(t, operation_setting.ChannelRoutingLowestCost, operation_setting.GetChannelRoutingStrategy("vip", "gpt-4o-2024"))
+	require.Equal(t, operation_setting.ChannelRoutingLowestLatency, operation_setting.GetChannelRoutingStrategy("vip", "claude"))
+	require.Equal(t, operation_setting.ChannelRoutingWeightedRandom, operation_setting.GetChannelRoutingStrategy("default", "claude"))
+	require.Equal(t, operation_setting.ChannelRoutingWeightedRandom, operation_setting.GetChannelRoutingStrategy("default", "broken"))
+}
@@ -0,0 +1,186 @@
+package model
+
+import (
+	"errors"
+
+	"github.com/QuantumNous/new-api/common"
+
+	"gorm.io/gorm"
+)
+
+const (
+	FileStatusUploaded  = "uploaded"
+	FileStatusProcessed = "processed"
+	FileStatusError     = "error"
+)
+
+// File 记录通过 /v1/files 上传的文件。
+// 文件内容保存在 Storage 指定的存储后端中；当文件被转发到上游渠道后，
+// ChannelId/UpstreamFileId 记录其固定的上游，后续引用该文件的请求会路由回同一渠道。
+type File struct {
+	Id             int            `json:"-"`
+	FileId         string         `json:"id" gorm:"type:varchar(191);uniqueIndex"`
+	UserId         int            `json:"-" gorm:"index"`
+	TokenId        int            `json:"-" gorm:"index"`
+	ChannelId      int            `json:"-" gorm:"index;default:0"`
+	UpstreamFileId string         `json:"-" gorm:"type:varchar(191);default:''"`
+	Filename       string         `json:"filename" gorm:"type:varchar(255)"`
+	Purpose        string         `json:"purpose" gorm:"type:varchar(64);index"`
+	Bytes          int64          `json:"bytes" gorm:"bigint"`
+	Status         string         `json:"status" gorm:"type:varchar(32);default:'uploaded'"`
+	StatusDetails  string         `json:"status_details,omitempty" gorm:"type:text"`
+	Storage        string         `json:"-" gorm:"type:varchar(32)"`
+	StorageKey     string         `json:"-" gorm:"type:varchar(512)"`
+	CreatedAt      int64          `json:"created_at" gorm:"bigint;index"`
+	ExpiresAt      int64          `json:"expires_at,omitempty" gorm:"bigint;index;default:0"`
+	DeletedAt      gorm.DeletedAt `json:"-" gorm:"index"`
+}
+
+// GenerateFileID 生成对外暴露的 file-xxxx 格式 ID
+func GenerateFileID() string {
+	key, _ := common.GenerateRandomCharsKey(24)
+	return "file-" + key
+}
+
+func (file *File) Insert() error {
+	if file.CreatedAt == 0 {
+		file.CreatedAt = common.GetTimestamp()
+	}
+	if file.Status == "" {
+		file.Status = FileStatusUploaded
+	}
+	return DB.Create(file).Error
+}
+
+// InsertWithLimit 插入文件记录并保证用户的文件数量不超过 limit，超出时撤销插入并返回 ErrFileLimitExceeded。
+// 先插入再计数：并发上传时最后完成插入的请求一定能看到全部记录，最坏情况是多拒绝一次，不会超出上限
+func (file *File) InsertWithLimit(limit int) error {
+	if err := file.Insert(); err != nil {
+		return err
+	}
+	if limit <= 0 {
+		return nil
+	}
+	count, err := CountUserFiles(file.UserId)
+	if err == nil && count <= int64(limit) {
+		return nil
+	}
+	if deleteErr := DB.Unscoped().Delete(file).Error; deleteErr != nil {
+		return deleteErr
+	}
+	if err != nil {
+		return err
+	}
+	return ErrFileLimitExceeded
+}
+
+// IsPinned 文件是否已转发并固定到某个上游渠道
+func (file *File) IsPinned() bool {
+	return file.ChannelId != 0 && file.UpstreamFileId != ""
+}
+
+// PinToChannel 记录文件已转发到的上游渠道。
+// 使用条件更新保证并发下只有第一次固定生效，之后返回 ErrFileAlreadyPinned。
+func (file *File) PinToChannel(channelId int, upstreamFileId string) error {
+	result := DB.Model(&File{}).
+		Where("id = ? AND channel_id = ?", file.Id, 0).
+		Updates(map[string]any{
+			"channel_id":       channelId,
+			"upstream_file_id": upstreamFileId,
+		})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrFileAlreadyPinned
+	}
+	file.ChannelId = channelId
+	file.UpstreamFileId = upstreamFileId
+	return nil
+}
+
+var ErrFileAlreadyPinned = errors.New("file is already pinned to another channel")
+
+var ErrFileLimitExceeded = errors.New("file limit exceeded")
+
+func (file *File) UpdateStatus(status string, details string) error {
+	file.Status = status
+	file.StatusDetails = details
+	return DB.Model(&File{}).Where("id = ?", file.Id).Updates(map[string]any{
+		"status":         status,
+		"status_details": details,
+	}).Error
+}
+
+func (file *File) Delete() error {
+	return DB.Delete(file).Error
+}
+
+// GetUserFileById 获取用户自己的文件，不存在时返回 gorm.ErrRecordNotFound
+func GetUserFileById(userId int, fileId string) (*File, error) {
+	if fileId == "" {
+		return nil, gorm.ErrRecordNotFound
+	}
+	var file File
+	err := DB.Where("user_id = ? AND file_id = ?", userId, fileId).First(&file).Error
+	if err != nil {
+		return nil, err
+	}
+	return &file, nil
+}
+
+// GetUserFilesByIds 批量获取用户的文件，忽略不存在的 ID
+func GetUserFilesByIds(userId int, fileIds []string) ([]*File, error) {
+	var files []*File
+	if len(fileIds) == 0 {
+		return files, nil
+	}
+	err := DB.Where("user_id = ? AND file_id IN ?", userId, fileIds).Find(&files).Error
+	return files, err
+}
+
+// GetUserFiles 按 OpenAI 列表语义分页查询：after 为上一页最后一个文件 ID，order 为 asc/desc
+func GetUserFiles(userId int, purpose string, after string, limit int, order string) ([]*File, error) {
+	var files []*File
+	query := DB.Where("user_id = ?", userId)
+	if purpose != "" {
+		query = query.Where("purpose = ?", purpose)
+	}
+	desc := order != "asc"
+	if after != "" {
+		var cursor File
+		if err := DB.Select("id").Where("user_id = ? AND file_id = ?", userId, after).First(&cursor).Error; err == nil {
+			if desc {
+				query = query.Where("id < ?", cursor.Id)
+			} else {
+				query = query.Where("id > ?", cursor.Id)
+			}
+		}
+	}
+	if desc {
+		query = query.Order("id desc")
+	} else {
+		query = query.Order("id asc")
+	}
+	err := query.Limit(limit).Find(&files).Error
+	return files, err
+}
+
+func CountUserFiles(userId int) (int64, error) {
+	var count int64
+	err := DB.Model(&File{}).Where("user_id = ?", userId).Count(&count).Error
+	return count, err
+}
+
+// GetExpiredFiles 获取已过期但尚未删除的文件
+func GetExpiredFiles(now int64, limit int) ([]*File, error) {
+	var files []*File
+	err := DB.Where("expires_at > 0 AND expires_at <= ?", now).Order("id asc").Limit(limit).Find(&files).Error
+	return files, err
+}
+
+func HasExpiredFiles(now int64) bool {
+	var file File
+	err := DB.Select("id").Where("expires_at > 0 AND expires_at <= ?", now).First(&file).Error
+	return err == nil
+}
@@ -9,6 +9,7 @@ import (
 
 	"github.com/QuantumNous/new-api/common"
 	"github.com/QuantumNous/new-api/logger"
+	prommetrics "github.com/QuantumNous/new-api/pkg/prom_metrics"
 	"github.com/QuantumNous/new-api/types"
 
 	"github.com/gin-gonic/gin"
@@ -341,6 +342,8 @@ type RecordConsumeLogParams struct {
 }
 
 func RecordConsumeLog(c *gin.Context, userId int, params RecordConsumeLogParams) {
+	// 监控指标不受消费日志开关影响
+	prommetrics.RecordQuotaConsumed(params.ModelName, params.Group, params.ChannelId, params.Quota, params.PromptTokens, params.CompletionTokens)
 	if !common.LogConsumeEnabled {
 		return
 	}
@@ -568,7 +571,40 @@ func GetUserLogs(userId int, logType int, startTimestamp int64, endTimestamp int
 	} else {
 		tx = LOG_DB.Where("logs.user_id = ? and logs.type = ?", userId, logType)
 	}
+	return getUserLogs(tx, startTimestamp, endTimestamp, modelName, tokenName, startIdx, num, group, requestId, upstreamRequestId)
+}
+
+// OrganizationMemberScope 组织范围查询中的一名成员，只包含其加入组织（JoinedAt）之后的记录
+type OrganizationMemberScope struct {
+	UserId   int
+	JoinedAt int64
+}
 
+// organizationMemberScopeCondition 按成员及其加入时间构造过滤条件，没有成员时不匹配任何记录
+func organizationMemberScopeCondition(members []OrganizationMemberScope, prefix string) (string, []interface{}) {
+	if len(members) == 0 {
+		return "1 = 0", nil
+	}
+	conditions := make([]string, 0, len(members))
+	args := make([]interface{}, 0, len(members)*2)
+	for _, member := range members {
+		conditions = append(conditions, "("+prefix+"user_id = ? AND "+prefix+"created_at >= ?)")
+		args = append(args, member.UserId, member.JoinedAt)
+	}
+	return "(" + strings.Join(conditions, " OR ") + ")", args
+}
+
+// GetUsersLogs 查询组织成员加入组织之后的消费与错误日志（组织管理员查看成员日志），返回格式与 GetUserLogs 相同
+func GetUsersLogs(members []OrganizationMemberScope, logType int, startTimestamp int64, endTimestamp int64, modelName string, tokenName string, startIdx int, num int, group string, requestId string, upstreamRequestId string) (logs []*Log, total int64, err error) {
+	condition, args := organizationMemberScopeCondition(members, "logs.")
+	tx := LOG_DB.Where(condition, args...).Where("logs.type IN ?", []int{LogTypeConsume, LogTypeError})
+	if logType != LogTypeUnknown {
+		tx = tx.Where("logs.type = ?", logType)
+	}
+	return getUserLogs(tx, startTimestamp, endTimestamp, modelName, tokenName, startIdx, num, group, requestId, upstreamRequestId)
+}
+
+func getUserLogs(tx *gorm.DB, startTimestamp int64, endTimestamp int64, modelName string, tokenName string, startIdx int, num int, group string, requestId string, upstreamRequestId string) (logs []*Log, total int64, err error) {
 	if tx, err = applyExplicitLogTextFilter(tx, "logs.model_name", modelName); err != nil {
 		return nil, 0, err
 	}
@@ -616,11 +652,30 @@ type Stat struct {
 }
 
 func SumUsedQuota(logType int, startTimestamp int64, endTimestamp int64, modelName string, username string, tokenName string, channel int, group string) (stat Stat, err error) {
+	return sumUsedQuota(nil, startTimestamp, endTimestamp, modelName, username, tokenName, channel, group)
+}
+
+// SumUsersUsedQuota 统计组织成员加入组织之后的消耗（组织管理员查看成员用量）
+func SumUsersUsedQuota(members []OrganizationMemberScope, startTimestamp int64, endTimestamp int64, modelName string, tokenName string, group string) (stat Stat, err error) {
+	if members == nil {
+		members = []OrganizationMemberScope{}
+	}
+	return sumUsedQuota(members, startTimestamp, endTimestamp, modelName, "", tokenName, 0, group)
+}
+
+// sumUsedQuota members 为 nil 时不按用户过滤
+func sumUsedQuota(members []OrganizationMemberScope, startTimestamp int64, endTimestamp int64, modelName string, username string, tokenName string, channel int, group string) (stat Stat, err error) {
 	tx := LOG_DB.Table("logs").Select("COALESCE(sum(quota), 0) quota")
 
 	// 为rpm和tpm创建单独的查询
 	rpmTpmQuery := LOG_DB.Table("logs").Select("count(*) rpm, COALESCE(sum(prompt_tokens), 0) + COALESCE(sum(completion_tokens), 0) tpm")
 
+	if members != nil {
+		condition, args := organizationMemberScopeCondition(members, "")
+		tx = tx.Where(condition, args...)
+		rpmTpmQuery = rpmTpmQuery.Where(condition, args...)
+	}
+
 	if tx, err = applyExplicitLogTextFilter(tx, "username", username); err != nil {
 		return stat, err
 	}
@@ -277,6 +277,7 @@ func migrateDB() error {
 		&Redemption{},
 		&Ability{},
 		&Log{},
+		&PayloadLog{},
 		&Midjourney{},
 		&TopUp{},
 		&QuotaData{},
@@ -299,6 +300,14 @@ func migrateDB() error {
 		&SystemTaskLock{},
 		&CasbinRule{},
 		&AuthzRole{},
+		&File{},
+		&Batch{},
+		&BatchLineResult{},
+		&Organization{},
+		&OrganizationMember{},
+		&OrganizationInvitation{},
+		&ShadowLog{},
+		&TokenSpendCounter{},
 	)
 	if err != nil {
 		return err
@@ -331,6 +340,7 @@ func migrateDBFast() error {
 		{&Redemption{}, "Redemption"},
 		{&Ability{}, "Ability"},
 		{&Log{}, "Log"},
+		{&PayloadLog{}, "PayloadLog"},
 		{&Midjourney{}, "Midjourney"},
 		{&TopUp{}, "TopUp"},
 		{&QuotaData{}, "QuotaData"},
@@ -351,6 +361,14 @@ func migrateDBFast() error {
 		{&SystemInstance{}, "SystemInstance"},
 		{&SystemTask{}, "SystemTask"},
 		{&SystemTaskLock{}, "SystemTaskLock"},
+		{&File{}, "File"},
+		{&Batch{}, "Batch"},
+		{&BatchLineResult{}, "BatchLineResult"},
+		{&Organization{}, "Organization"},
+		{&OrganizationMember{}, "OrganizationMember"},
+		{&OrganizationInvitation{}, "OrganizationInvitation"},
+		{&ShadowLog{}, "ShadowLog"},
+		{&TokenSpendCounter{}, "TokenSpendCounter"},
 	}
 	// 动态计算migration数量，确保errChan缓冲区足够大
 	errChan := make(chan error, len(migrations))
@@ -392,7 +410,7 @@ func migrateLOGDB() error {
 	if common.UsingLogDatabase(common.DatabaseTypeClickHouse) {
 		return migrateClickHouseLogDB()
 	}
-	return LOG_DB.AutoMigrate(&Log{})
+	return LOG_DB.AutoMigrate(&Log{}, &PayloadLog{})
 }
 
 func migrateClickHouseLogDB() error {
@@ -400,6 +418,9 @@ func migrateClickHouseLogDB() error {
 	if err := LOG_DB.Exec(clickHouseLogCreateTableSQL(ttlDays)).Error; err != nil {
 		return err
 	}
+	if err := LOG_DB.Exec(clickHousePayloadLogCreateTableSQL()).Error; err != nil {
+		return err
+	}
 	return syncClickHouseLogTTL(ttlDays)
 }
 
@@ -0,0 +1,513 @@
+package model
+
+import (
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+
+	"gorm.io/gorm"
+)
+
+const (
+	OrganizationStatusEnabled  = 1
+	OrganizationStatusDisabled = 2
+)
+
+// 组织成员角色：owner / admin 可以管理成员并查看成员的日志与用量
+const (
+	OrganizationRoleOwner  = "owner"
+	OrganizationRoleAdmin  = "admin"
+	OrganizationRoleMember = "member"
+)
+
+var (
+	ErrOrganizationQuotaInsufficient   = errors.New("organization quota insufficient")
+	ErrOrganizationMemberQuotaExceeded = errors.New("organization member quota limit exceeded")
+	ErrUserAlreadyInOrganization       = errors.New("user already belongs to an organization")
+)
+
+// Organization 组织（团队），成员共享组织钱包与组织订阅
+type Organization struct {
+	Id          int    `json:"id"`
+	Name        string `json:"name" gorm:"type:varchar(64);uniqueIndex"`
+	Description string `json:"description" gorm:"type:varchar(255);default:''"`
+	Status      int    `json:"status" gorm:"type:int;default:1"`
+	Quota       int    `json:"quota" gorm:"type:int;default:0"`
+	UsedQuota   int    `json:"used_quota" gorm:"type:int;default:0"`
+	CreatedAt   int64  `json:"created_at" gorm:"bigint"`
+	UpdatedAt   int64  `json:"updated_at" gorm:"bigint"`
+	MemberCount int64  `json:"member_count" gorm:"-"`
+}
+
+func (o *Organization) BeforeCreate(tx *gorm.DB) error {
+	now := common.GetTimestamp()
+	o.CreatedAt = now
+	o.UpdatedAt = now
+	return nil
+}
+
+func (o *Organization) BeforeUpdate(tx *gorm.DB) error {
+	o.UpdatedAt = common.GetTimestamp()
+	return nil
+}
+
+// OrganizationMember 组织成员关系，一个用户最多属于一个组织。
+// QuotaLimit 为成员可使用的组织额度上限（0 表示不限制），UsedQuota 为成员已使用的组织额度
+type OrganizationMember struct {
+	Id             int    `json:"id"`
+	OrganizationId int    `json:"organization_id" gorm:"index"`
+	UserId         int    `json:"user_id" gorm:"uniqueIndex"`
+	Role           string `json:"role" gorm:"type:varchar(16);default:'member'"`
+	QuotaLimit     int    `json:"quota_limit" gorm:"type:int;default:0"`
+	UsedQuota      int    `json:"used_quota" gorm:"type:int;default:0"`
+	CreatedAt      int64  `json:"created_at" gorm:"bigint"`
+	Username       string `json:"username" gorm:"-"`
+	DisplayName    string `json:"display_name" gorm:"-"`
+}
+
+func (m *OrganizationMember) BeforeCreate(tx *gorm.DB) error {
+	m.CreatedAt = common.GetTimestamp()
+	return nil
+}
+
+// IsManager 是否可以管理组织成员并查看成员的日志与用量
+func (m *OrganizationMember) IsManager() bool {
+	return m.Role == OrganizationRoleOwner || m.Role == OrganizationRoleAdmin
+}
+
+func IsValidOrganizationRole(role string) bool {
+	switch role {
+	case OrganizationRoleOwner, OrganizationRoleAdmin, OrganizationRoleMember:
+		return true
+	default:
+		return false
+	}
+}
+
+func GetAllOrganizations(keyword string, startIdx int, num int) (organizations []*Organization, total int64, err error) {
+	tx := DB.Model(&Organization{})
+	if keyword = strings.TrimSpace(keyword); keyword != "" {
+		tx = tx.Where("name LIKE ?", "%"+keyword+"%")
+	}
+	if err = tx.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	if err = tx.Order("id desc").Limit(num).Offset(startIdx).Find(&organizations).Error; err != nil {
+		return nil, 0, err
+	}
+	if len(organizations) == 0 {
+		return organizations, total, nil
+	}
+	ids := make([]int, 0, len(organizations))
+	for _, organization := range organizations {
+		ids = append(ids, organization.Id)
+	}
+	var counts []struct {
+		OrganizationId int
+		Count          int64
+	}
+	if err = DB.Model(&OrganizationMember{}).Select("organization_id, count(*) as count").
+		Where("organization_id IN ?", ids).Group("organization_id").Scan(&counts).Error; err != nil {
+		return nil, 0, err
+	}
+	countMap := make(map[int]int64, len(counts))
+	for _, count := range counts {
+		countMap[count.OrganizationId] = count.Count
+	}
+	for _, organization := range organizations {
+		organization.MemberCount = countMap[organization.Id]
+	}
+	return organizations, total, nil
+}
+
+func GetOrganizationById(id int) (*Organization, error) {
+	if id <= 0 {
+		return nil, errors.New("invalid organization id")
+	}
+	var organization Organization
+	if err := DB.First(&organization, "id = ?", id).Error; err != nil {
+		return nil, err
+	}
+	return &organization, nil
+}
+
+// CreateOrganization 创建组织，ownerId 大于 0 时同时将该用户加入为组织所有者
+func CreateOrganization(organization *Organization, ownerId int) error {
+	err := DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(organization).Error; err != nil {
+			return err
+		}
+		if ownerId <= 0 {
+			return nil
+		}
+		return addOrganizationMemberTx(tx, &OrganizationMember{
+			OrganizationId: organization.Id,
+			UserId:         ownerId,
+			Role:           OrganizationRoleOwner,
+		})
+	})
+	if err == nil && ownerId > 0 {
+		InvalidateOrganizationMemberCache(ownerId)
+	}
+	return err
+}
+
+func (o *Organization) Update() error {
+	if err := DB.Model(o).Select("name", "description", "status").Updates(o).Error; err != nil {
+		return err
+	}
+	// 组织启用状态决定成员的请求是否由组织付费
+	invalidateOrganizationMembersCache(o.Id)
+	return nil
+}
+
+// DeleteOrganization 删除组织及其成员关系与待处理邀请，组织订阅随之失效
+func DeleteOrganization(id int) error {
+	userIds, err := GetOrganizationMemberUserIds(id)
+	if err != nil {
+		return err
+	}
+	err = DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("organization_id = ?", id).Delete(&OrganizationMember{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("organization_id = ?", id).Delete(&OrganizationInvitation{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Model(&UserSubscription{}).
+			Where("organization_id = ? AND status = ?", id, "active").
+			Updates(map[string]interface{}{
+				"status":     "cancelled",
+				"updated_at": common.GetTimestamp(),
+			}).Error; err != nil {
+			return err
+		}
+		return tx.Delete(&Organization{}, "id = ?", id).Error
+	})
+	if err == nil {
+		InvalidateOrganizationMemberCache(userIds...)
+	}
+	return err
+}
+
+// IncreaseOrganizationQuota 管理员调整组织钱包余额，quota 为负数时扣减
+func IncreaseOrganizationQuota(id int, quota int) error {
+	return DB.Model(&Organization{}).Where("id = ?", id).
+		Update("quota", gorm.Expr("quota + ?", quota)).Error
+}
+
+func addOrganizationMemberTx(tx *gorm.DB, member *OrganizationMember) error {
+	var count int64
+	if err := tx.Model(&OrganizationMember{}).Where("user_id = ?", member.UserId).Count(&count).Error; err != nil {
+		return err
+	}
+	if count > 0 {
+		return ErrUserAlreadyInOrganization
+	}
+	if err := tx.Model(&User{}).Where("id = ?", member.UserId).Count(&count).Error; err != nil {
+		return err
+	}
+	if count == 0 {
+		return errors.New("user not found")
+	}
+	return tx.Create(member).Error
+}
+
+func AddOrganizationMember(member *OrganizationMember) error {
+	err := DB.Transaction(func(tx *gorm.DB) error {
+		return addOrganizationMemberTx(tx, member)
+	})
+	if err == nil {
+		InvalidateOrganizationMemberCache(member.UserId)
+	}
+	return err
+}
+
+func GetOrganizationMembers(organizationId int) ([]*OrganizationMember, error) {
+	var members []*OrganizationMember
+	if err := DB.Where("organization_id = ?", organizationId).Order("id asc").Find(&members).Error; err != nil {
+		return nil, err
+	}
+	if len(members) == 0 {
+		return members, nil
+	}
+	userIds := make([]int, 0, len(members))
+	for _, member := range members {
+		userIds = append(userIds, member.UserId)
+	}
+	var users []struct {
+		Id          int
+		Username    string
+		DisplayName string
+	}
+	if err := DB.Model(&User{}).Select("id, username, display_name").Where("id IN ?", userIds).Scan(&users).Error; err != nil {
+		return nil, err
+	}
+	userMap := make(map[int]int, len(users))
+	for i, user := range users {
+		userMap[user.Id] = i
+	}
+	for _, member := range members {
+		if i, ok := userMap[member.UserId]; ok {
+			member.Username = users[i].Username
+			member.DisplayName = users[i].DisplayName
+		}
+	}
+	return members, nil
+}
+
+func GetOrganizationMember(organizationId int, userId int) (*OrganizationMember, error) {
+	var member OrganizationMember
+	if err := DB.Where("organization_id = ? AND user_id = ?", organizationId, userId).First(&member).Error; err != nil {
+		return nil, err
+	}
+	return &member, nil
+}
+
+// GetOrganizationMemberByUserId 返回用户所属组织的成员关系，不属于任何组织时返回 nil
+func GetOrganizationMemberByUserId(userId int) (*OrganizationMember, error) {
+	var member OrganizationMember
+	query := DB.Where("user_id = ?", userId).Limit(1).Find(&member)
+	if query.Error != nil {
+		return nil, query.Error
+	}
+	if query.RowsAffected == 0 {
+		return nil, nil
+	}
+	return &member, nil
+}
+
+// GetActiveOrganizationMemberByUserId 返回用户所属且已启用组织的成员关系，用于计费时选择资金来源。
+// 成员关系（包括不属于任何组织）会被缓存，成员设置了额度上限时按主键读取最新的已用额度
+func GetActiveOrganizationMemberByUserId(userId int) (*OrganizationMember, error) {
+	if entry, found := getOrganizationMemberCacheEntry(userId); found {
+		if entry.MemberId == 0 {
+			return nil, nil
+		}
+		member := &OrganizationMember{
+			Id:             entry.MemberId,
+			OrganizationId: entry.OrganizationId,
+			UserId:         userId,
+			Role:           entry.Role,
+			QuotaLimit:     entry.QuotaLimit,
+			CreatedAt:      entry.CreatedAt,
+		}
+		if member.QuotaLimit > 0 {
+			if err := DB.Model(&OrganizationMember{}).Where("id = ?", member.Id).Pluck("used_quota", &member.UsedQuota).Error; err != nil {
+				return nil, err
+			}
+		}
+		return member, nil
+	}
+	member, err := getActiveOrganizationMemberByUserIdFromDB(userId)
+	if err != nil {
+		return nil, err
+	}
+	setOrganizationMemberCache(userId, member)
+	return member, nil
+}
+
+func getActiveOrganizationMemberByUserIdFromDB(userId int) (*OrganizationMember, error) {
+	var member OrganizationMember
+	query := DB.Table("organization_members").
+		Select("organization_members.*").
+		Joins("JOIN organizations ON organizations.id = organization_members.organization_id").
+		Where("organization_members.user_id = ? AND organizations.status = ?", userId, OrganizationStatusEnabled).
+		Limit(1).
+		Find(&member)
+	if query.Error != nil {
+		return nil, query.Error
+	}
+	if query.RowsAffected == 0 {
+		return nil, nil
+	}
+	return &member, nil
+}
+
+func GetOrganizationMemberUserIds(organizationId int) ([]int, error) {
+	var userIds []int
+	err := DB.Model(&OrganizationMember{}).Where("organization_id = ?", organizationId).Pluck("user_id", &userIds).Error
+	return userIds, err
+}
+
+func (m *OrganizationMember) Update() error {
+	if err := DB.Model(m).Select("role", "quota_limit", "used_quota").Updates(m).Error; err != nil {
+		return err
+	}
+	InvalidateOrganizationMemberCache(m.UserId)
+	return nil
+}
+
+func RemoveOrganizationMember(organizationId int, userId int) error {
+	if err := DB.Where("organization_id = ? AND user_id = ?", organizationId, userId).Delete(&OrganizationMember{}).Error; err != nil {
+		return err
+	}
+	InvalidateOrganizationMemberCache(userId)
+	return nil
+}
+
+// CheckOrganizationMemberQuota 按成员当前已用额度快速校验使用 quota 后是否会超过成员额度上限，
+// 仅用于提前拒绝，额度的原子预留在预扣费时完成
+func CheckOrganizationMemberQuota(member *OrganizationMember, quota int) error {
+	if member.QuotaLimit > 0 && member.UsedQuota+quota > member.QuotaLimit {
+		return ErrOrganizationMemberQuotaExceeded
+	}
+	return nil
+}
+
+// PreConsumeOrganizationQuota 从组织钱包预扣 quota 并计入成员已用额度。
+// 组织余额不足或超过成员额度上限时不做任何扣减
+func PreConsumeOrganizationQuota(organizationId int, userId int, quota int) error {
+	if quota <= 0 {
+		return nil
+	}
+	return DB.Transaction(func(tx *gorm.DB) error {
+		if err := reserveOrganizationMemberQuotaTx(tx, organizationId, userId, quota); err != nil {
+			return err
+		}
+		res := tx.Model(&Organization{}).
+			Where("id = ? AND quota >= ?", organizationId, quota).
+			Updates(map[string]interface{}{
+				"quota":      gorm.Expr("quota - ?", quota),
+				"used_quota": gorm.Expr("used_quota + ?", quota),
+			})
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected == 0 {
+			return ErrOrganizationQuotaInsufficient
+		}
+		return nil
+	})
+}
+
+// AdjustOrganizationQuota 按差额调整组织钱包与成员已用额度（正数补扣，负数退还），结算时使用，不做余额校验
+func AdjustOrganizationQuota(organizationId int, userId int, delta int) error {
+	if delta == 0 {
+		return nil
+	}
+	return DB.Transaction(func(tx *gorm.DB) error {
+		if err := adjustOrganizationMemberUsedQuotaTx(tx, organizationId, userId, delta); err != nil {
+			return err
+		}
+		return tx.Model(&Organization{}).Where("id = ?", organizationId).
+			Updates(map[string]interface{}{
+				"quota":      gorm.Expr("quota - ?", delta),
+				"used_quota": gorm.Expr("used_quota + ?", delta),
+			}).Error
+	})
+}
+
+// ReserveOrganizationMemberQuota 在成员额度上限内原子地计入 quota，超过上限时不做任何调整，用于组织订阅追加预扣
+func ReserveOrganizationMemberQuota(organizationId int, userId int, quota int) error {
+	if quota <= 0 {
+		return nil
+	}
+	return reserveOrganizationMemberQuotaTx(DB, organizationId, userId, quota)
+}
+
+// reserveOrganizationMemberQuotaTx 以条件更新计入成员已用额度，并发请求不会同时越过成员额度上限
+func reserveOrganizationMemberQuotaTx(tx *gorm.DB, organizationId int, userId int, quota int) error {
+	res := tx.Model(&OrganizationMember{}).
+		Where("organization_id = ? AND user_id = ? AND (quota_limit = 0 OR used_quota + ? <= quota_limit)", organizationId, userId, quota).
+		Update("used_quota", gorm.Expr("used_quota + ?", quota))
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return ErrOrganizationMemberQuotaExceeded
+	}
+	return nil
+}
+
+// AdjustOrganizationMemberUsedQuota 调整成员已使用的组织额度，用于组织订阅结算与退款，不做上限校验
+func AdjustOrganizationMemberUsedQuota(organizationId int, userId int, delta int) error {
+	if delta == 0 {
+		return nil
+	}
+	return adjustOrganizationMemberUsedQuotaTx(DB, organizationId, userId, delta)
+}
+
+func adjustOrganizationMemberUsedQuotaTx(tx *gorm.DB, organizationId int, userId int, delta int) error {
+	return tx.Model(&OrganizationMember{}).
+		Where("organization_id = ? AND user_id = ?", organizationId, userId).
+		Update("used_quota", gorm.Expr("CASE WHEN used_quota + ? < 0 THEN 0 ELSE used_quota + ? END", delta, delta)).Error
+}
+
+// ---------------------------------------------------------------------------
+// 组织订阅：复用 user_subscriptions 表，user_id = 0 且 organization_id 为组织 ID
+// ---------------------------------------------------------------------------
+
+// AdminBindOrganizationSubscription 按套餐为组织开通订阅，组织订阅不会调整成员分组
+func AdminBindOrganizationSubscription(organizationId int, planId int) error {
+	if organizationId <= 0 || planId <= 0 {
+		return errors.New("invalid organizationId or planId")
+	}
+	plan, err := GetSubscriptionPlanById(planId)
+	if err != nil {
+		return err
+	}
+	nowUnix := GetDBTimestamp()
+	now := time.Unix(nowUnix, 0)
+	endUnix, err := calcPlanEndTime(now, plan)
+	if err != nil {
+		return err
+	}
+	nextReset := calcNextResetTime(now, plan, endUnix)
+	lastReset := int64(0)
+	if nextReset > 0 {
+		lastReset = now.Unix()
+	}
+	allowWalletOverflow := true
+	if plan.AllowWalletOverflow != nil {
+		allowWalletOverflow = *plan.AllowWalletOverflow
+	}
+	sub := &UserSubscription{
+		OrganizationId:      organizationId,
+		PlanId:              plan.Id,
+		AmountTotal:         plan.TotalAmount,
+		StartTime:           now.Unix(),
+		EndTime:             endUnix,
+		Status:              "active",
+		Source:              "admin",
+		LastResetTime:       lastReset,
+		NextResetTime:       nextReset,
+		AllowWalletOverflow: allowWalletOverflow,
+	}
+	return DB.Create(sub).Error
+}
+
+func GetAllOrganizationSubscriptions(organizationId int) ([]SubscriptionSummary, error) {
+	var subs []UserSubscription
+	if err := DB.Where("organization_id = ? AND user_id = 0", organizationId).
+		Order("end_time desc, id desc").
+		Find(&subs).Error; err != nil {
+		return nil, err
+	}
+	return buildSubscriptionSummaries(subs), nil
+}
+
+func HasActiveOrganizationSubscription(organizationId int) (bool, error) {
+	var count int64
+	if err := DB.Model(&UserSubscription{}).
+		Where("organization_id = ? AND user_id = 0 AND status = ? AND end_time > ?", organizationId, "active", common.GetTimestamp()).
+		Count(&count).Error; err != nil {
+		return false, err
+	}
+	return count > 0, nil
+}
+
+// OrganizationActiveSubscriptionsAllowWalletOverflow 与 UserActiveSubscriptionsAllowWalletOverflow 相同，
+// 任一活跃的组织订阅禁止回退时，订阅额度用尽后不再使用组织钱包
+func OrganizationActiveSubscriptionsAllowWalletOverflow(organizationId int) (bool, error) {
+	var strictCount int64
+	if err := DB.Model(&UserSubscription{}).
+		Where("organization_id = ? AND user_id = 0 AND status = ? AND end_time > ? AND allow_wallet_overflow = ?",
+			organizationId, "active", common.GetTimestamp(), false).
+		Count(&strictCount).Error; err != nil {
+		return false, err
+	}
+	return strictCount == 0, nil
+}
@@ -0,0 +1,122 @@
+package model
+
+import (
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/pkg/cachex"
+
+	"github.com/samber/hot"
+)
+
+const organizationMemberCacheNamespace = "new-api:organization_member:v1"
+
+// organizationMemberCacheEntry 用户在已启用组织中的成员关系缓存，MemberId 为 0 表示用户不属于任何已启用组织（负缓存）。
+// 成员已用额度变化频繁，不放入缓存
+type organizationMemberCacheEntry struct {
+	MemberId       int    `json:"member_id"`
+	OrganizationId int    `json:"organization_id"`
+	Role           string `json:"role"`
+	QuotaLimit     int    `json:"quota_limit"`
+	CreatedAt      int64  `json:"created_at"`
+}
+
+var (
+	organizationMemberCacheOnce sync.Once
+	organizationMemberCache     *cachex.HybridCache[organizationMemberCacheEntry]
+)
+
+func organizationMemberCacheTTL() time.Duration {
+	ttlSeconds := common.GetEnvOrDefault("ORGANIZATION_MEMBER_CACHE_TTL", 60)
+	if ttlSeconds <= 0 {
+		ttlSeconds = 60
+	}
+	return time.Duration(ttlSeconds) * time.Second
+}
+
+func organizationMemberCacheCapacity() int {
+	capacity := common.GetEnvOrDefault("ORGANIZATION_MEMBER_CACHE_CAP", 100000)
+	if capacity <= 0 {
+		capacity = 100000
+	}
+	return capacity
+}
+
+func getOrganizationMemberCache() *cachex.HybridCache[organizationMemberCacheEntry] {
+	organizationMemberCacheOnce.Do(func() {
+		ttl := organizationMemberCacheTTL()
+		organizationMemberCache = cachex.NewHybridCache[organizationMemberCacheEntry](cachex.HybridCacheConfig[organizationMemberCacheEntry]{
+			Namespace: cachex.Namespace(organizationMemberCacheNamespace),
+			Redis:     common.RDB,
+			RedisEnabled: func() bool {
+				return common.RedisEnabled && common.RDB != nil
+			},
+			RedisCodec: cachex.JSONCodec[organizationMemberCacheEntry]{},
+			Memory: func() *hot.HotCache[string, organizationMemberCacheEntry] {
+				return hot.NewHotCache[string, organizationMemberCacheEntry](hot.LRU, organizationMemberCacheCapacity()).
+					WithTTL(ttl).
+					WithJanitor().
+					Build()
+			},
+		})
+	})
+	return organizationMemberCache
+}
+
+func organizationMemberCacheKey(userId int) string {
+	if userId <= 0 {
+		return ""
+	}
+	return strconv.Itoa(userId)
+}
+
+func getOrganizationMemberCacheEntry(userId int) (organizationMemberCacheEntry, bool) {
+	entry, found, err := getOrganizationMemberCache().Get(organizationMemberCacheKey(userId))
+	if err != nil {
+		return organizationMemberCacheEntry{}, false
+	}
+	return entry, found
+}
+
+// setOrganizationMemberCache 缓存用户的成员关系，member 为 nil 时写入负缓存
+func setOrganizationMemberCache(userId int, member *OrganizationMember) {
+	entry := organizationMemberCacheEntry{}
+	if member != nil {
+		entry = organizationMemberCacheEntry{
+			MemberId:       member.Id,
+			OrganizationId: member.OrganizationId,
+			Role:           member.Role,
+			QuotaLimit:     member.QuotaLimit,
+			CreatedAt:      member.CreatedAt,
+		}
+	}
+	if err := getOrganizationMemberCache().SetWithTTL(organizationMemberCacheKey(userId), entry, organizationMemberCacheTTL()); err != nil {
+		common.SysLog("failed to set organization member cache: " + err.Error())
+	}
+}
+
+// InvalidateOrganizationMemberCache 清理用户的成员关系缓存，成员加入、移除或成员设置变更后调用
+func InvalidateOrganizationMemberCache(userIds ...int) {
+	if len(userIds) == 0 {
+		return
+	}
+	keys := make([]string, 0, len(userIds))
+	for _, userId := range userIds {
+		keys = append(keys, organizationMemberCacheKey(userId))
+	}
+	if _, err := getOrganizationMemberCache().DeleteMany(keys); err != nil {
+		common.SysLog("failed to invalidate organization member cache: " + err.Error())
+	}
+}
+
+// invalidateOrganizationMembersCache 清理组织全部成员的缓存，组织启用状态变化或删除时调用
+func invalidateOrganizationMembersCache(organizationId int) {
+	userIds, err := GetOrganizationMemberUserIds(organizationId)
+	if err != nil {
+		common.SysLog("failed to load organization members for cache invalidation: " + err.Error())
+		return
+	}
+	InvalidateOrganizationMemberCache(userIds...)
+}
@@ -0,0 +1,179 @@
+package model
+
+import (
+	"errors"
+
+	"github.com/QuantumNous/new-api/common"
+
+	"gorm.io/gorm"
+)
+
+var (
+	ErrOrganizationInvitationExists   = errors.New("organization invitation already exists")
+	ErrOrganizationInvitationNotFound = errors.New("organization invitation not found")
+	ErrOrganizationLastOwner          = errors.New("the last organization owner cannot leave")
+)
+
+// OrganizationInvitation 组织 owner / admin 发出的成员邀请。加入组织后用户的请求由组织付费，
+// 日志与用量对组织管理者可见，因此必须由被邀请的用户本人接受后才创建成员关系
+type OrganizationInvitation struct {
+	Id               int    `json:"id"`
+	UserId           int    `json:"user_id" gorm:"uniqueIndex:idx_organization_invitation_user"`
+	OrganizationId   int    `json:"organization_id" gorm:"uniqueIndex:idx_organization_invitation_user;index"`
+	Role             string `json:"role" gorm:"type:varchar(16);default:'member'"`
+	QuotaLimit       int    `json:"quota_limit" gorm:"type:int;default:0"`
+	InviterId        int    `json:"inviter_id"`
+	CreatedAt        int64  `json:"created_at" gorm:"bigint"`
+	OrganizationName string `json:"organization_name" gorm:"-"`
+	Username         string `json:"username" gorm:"-"`
+}
+
+func (i *OrganizationInvitation) BeforeCreate(tx *gorm.DB) error {
+	i.CreatedAt = common.GetTimestamp()
+	return nil
+}
+
+// CreateOrganizationInvitation 邀请用户加入组织，用户已属于某个组织或已有该组织的待处理邀请时返回错误
+func CreateOrganizationInvitation(invitation *OrganizationInvitation) error {
+	return DB.Transaction(func(tx *gorm.DB) error {
+		var count int64
+		if err := tx.Model(&OrganizationMember{}).Where("user_id = ?", invitation.UserId).Count(&count).Error; err != nil {
+			return err
+		}
+		if count > 0 {
+			return ErrUserAlreadyInOrganization
+		}
+		if err := tx.Model(&User{}).Where("id = ?", invitation.UserId).Count(&count).Error; err != nil {
+			return err
+		}
+		if count == 0 {
+			return errors.New("user not found")
+		}
+		if err := tx.Model(&OrganizationInvitation{}).
+			Where("organization_id = ? AND user_id = ?", invitation.OrganizationId, invitation.UserId).
+			Count(&count).Error; err != nil {
+			return err
+		}
+		if count > 0 {
+			return ErrOrganizationInvitationExists
+		}
+		return tx.Create(invitation).Error
+	})
+}
+
+// GetUserOrganizationInvitations 返回用户收到的待处理邀请，附带组织名称
+func GetUserOrganizationInvitations(userId int) ([]*OrganizationInvitation, error) {
+	var invitations []*OrganizationInvitation
+	if err := DB.Where("user_id = ?", userId).Order("id asc").Find(&invitations).Error; err != nil {
+		return nil, err
+	}
+	for _, invitation := range invitations {
+		if err := DB.Model(&Organization{}).Where("id = ?", invitation.OrganizationId).
+			Pluck("name", &invitation.OrganizationName).Error; err != nil {
+			return nil, err
+		}
+	}
+	return invitations, nil
+}
+
+// GetOrganizationInvitations 返回组织发出的待处理邀请，附带被邀请用户的用户名
+func GetOrganizationInvitations(organizationId int) ([]*OrganizationInvitation, error) {
+	var invitations []*OrganizationInvitation
+	if err := DB.Where("organization_id = ?", organizationId).Order("id asc").Find(&invitations).Error; err != nil {
+		return nil, err
+	}
+	for _, invitation := range invitations {
+		if err := DB.Model(&User{}).Where("id = ?", invitation.UserId).
+			Pluck("username", &invitation.Username).Error; err != nil {
+			return nil, err
+		}
+	}
+	return invitations, nil
+}
+
+// AcceptOrganizationInvitation 用户接受邀请并以邀请中的角色与额度上限加入组织，
+// 用户收到的其他邀请随之失效
+func AcceptOrganizationInvitation(invitationId int, userId int) (*OrganizationMember, error) {
+	var member *OrganizationMember
+	err := DB.Transaction(func(tx *gorm.DB) error {
+		var invitation OrganizationInvitation
+		query := tx.Where("id = ? AND user_id = ?", invitationId, userId).Limit(1).Find(&invitation)
+		if query.Error != nil {
+			return query.Error
+		}
+		if query.RowsAffected == 0 {
+			return ErrOrganizationInvitationNotFound
+		}
+		member = &OrganizationMember{
+			OrganizationId: invitation.OrganizationId,
+			UserId:         userId,
+			Role:           invitation.Role,
+			QuotaLimit:     invitation.QuotaLimit,
+		}
+		if err := addOrganizationMemberTx(tx, member); err != nil {
+			return err
+		}
+		return tx.Where("user_id = ?", userId).Delete(&OrganizationInvitation{}).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	InvalidateOrganizationMemberCache(userId)
+	return member, nil
+}
+
+// DeleteUserOrganizationInvitation 用户拒绝收到的邀请
+func DeleteUserOrganizationInvitation(invitationId int, userId int) error {
+	res := DB.Where("id = ? AND user_id = ?", invitationId, userId).Delete(&OrganizationInvitation{})
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return ErrOrganizationInvitationNotFound
+	}
+	return nil
+}
+
+// DeleteOrganizationInvitation 组织管理者撤销发给用户的邀请
+func DeleteOrganizationInvitation(organizationId int, userId int) error {
+	res := DB.Where("organization_id = ? AND user_id = ?", organizationId, userId).Delete(&OrganizationInvitation{})
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return ErrOrganizationInvitationNotFound
+	}
+	return nil
+}
+
+// LeaveOrganization 成员主动退出所属组织，之后的请求恢复由个人钱包付费。
+// 组织的最后一个 owner 不能退出，需要先将 owner 角色授予其他成员
+func LeaveOrganization(userId int) error {
+	err := DB.Transaction(func(tx *gorm.DB) error {
+		var member OrganizationMember
+		query := tx.Where("user_id = ?", userId).Limit(1).Find(&member)
+		if query.Error != nil {
+			return query.Error
+		}
+		if query.RowsAffected == 0 {
+			return gorm.ErrRecordNotFound
+		}
+		if member.Role == OrganizationRoleOwner {
+			var owners int64
+			if err := tx.Model(&OrganizationMember{}).
+				Where("organization_id = ? AND role = ?", member.OrganizationId, OrganizationRoleOwner).
+				Count(&owners).Error; err != nil {
+				return err
+			}
+			if owners <= 1 {
+				return ErrOrganizationLastOwner
+			}
+		}
+		return tx.Delete(&member).Error
+	})
+	if err != nil {
+		return err
+	}
+	InvalidateOrganizationMemberCache(userId)
+	return nil
+}
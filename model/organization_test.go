@@ -0,0 +1,318 @@
+package model
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+)
+
+func setupOrganizationForTest(t *testing.T, name string, quota int, userIds ...int) *Organization {
+	t.Helper()
+	for _, userId := range userIds {
+		require.NoError(t, DB.Create(&User{
+			Id:       userId,
+			Username: fmt.Sprintf("org_user_%d", userId),
+			AffCode:  fmt.Sprintf("org_aff_%d", userId),
+			Status:   common.UserStatusEnabled,
+		}).Error)
+	}
+	organization := &Organization{Name: name, Status: OrganizationStatusEnabled}
+	require.NoError(t, CreateOrganization(organization, userIds[0]))
+	require.NoError(t, IncreaseOrganizationQuota(organization.Id, quota))
+	for _, userId := range userIds[1:] {
+		require.NoError(t, AddOrganizationMember(&OrganizationMember{
+			OrganizationId: organization.Id,
+			UserId:         userId,
+			Role:           OrganizationRoleMember,
+		}))
+	}
+	return organization
+}
+
+func TestPreConsumeOrganizationQuota(t *testing.T) {
+	organization := setupOrganizationForTest(t, "org-wallet", 1000, 880001, 880002)
+
+	member, err := GetOrganizationMember(organization.Id, 880002)
+	require.NoError(t, err)
+	member.QuotaLimit = 500
+	require.NoError(t, member.Update())
+
+	require.NoError(t, PreConsumeOrganizationQuota(organization.Id, 880002, 400))
+	// 超过成员额度上限时组织钱包不扣减
+	require.ErrorIs(t, PreConsumeOrganizationQuota(organization.Id, 880002, 200), ErrOrganizationMemberQuotaExceeded)
+	// 组织余额不足时成员已用额度回滚
+	require.ErrorIs(t, PreConsumeOrganizationQuota(organization.Id, 880001, 700), ErrOrganizationQuotaInsufficient)
+
+	require.NoError(t, AdjustOrganizationQuota(organization.Id, 880002, -100))
+
+	organization, err = GetOrganizationById(organization.Id)
+	require.NoError(t, err)
+	require.Equal(t, 700, organization.Quota)
+	require.Equal(t, 300, organization.UsedQuota)
+
+	members, err := GetOrganizationMembers(organization.Id)
+	require.NoError(t, err)
+	require.Len(t, members, 2)
+	require.Equal(t, 0, members[0].UsedQuota)
+	require.Equal(t, 300, members[1].UsedQuota)
+	require.Equal(t, "org_user_880002", members[1].Username)
+
+	active, err := GetActiveOrganizationMemberByUserId(880002)
+	require.NoError(t, err)
+	require.NotNil(t, active)
+	organization.Status = OrganizationStatusDisabled
+	require.NoError(t, organization.Update())
+	active, err = GetActiveOrganizationMemberByUserId(880002)
+	require.NoError(t, err)
+	require.Nil(t, active)
+}
+
+func TestAddOrganizationMemberRejectsSecondOrganization(t *testing.T) {
+	setupOrganizationForTest(t, "org-first", 0, 880011)
+	second := setupOrganizationForTest(t, "org-second", 0, 880012)
+
+	err := AddOrganizationMember(&OrganizationMember{OrganizationId: second.Id, UserId: 880011, Role: OrganizationRoleMember})
+	require.ErrorIs(t, err, ErrUserAlreadyInOrganization)
+}
+
+func TestPreConsumeOrganizationSubscription(t *testing.T) {
+	organization := setupOrganizationForTest(t, "org-subscription", 0, 880021)
+	plan := &SubscriptionPlan{
+		Id:            880021,
+		Title:         "Org Plan",
+		DurationUnit:  SubscriptionDurationMonth,
+		DurationValue: 1,
+		Enabled:       true,
+		TotalAmount:   1000,
+	}
+	require.NoError(t, DB.Create(plan).Error)
+	require.NoError(t, AdminBindOrganizationSubscription(organization.Id, plan.Id))
+
+	hasSub, err := HasActiveOrganizationSubscription(organization.Id)
+	require.NoError(t, err)
+	require.True(t, hasSub)
+	// 组织订阅不属于任何个人
+	hasSub, err = HasActiveUserSubscription(880021)
+	require.NoError(t, err)
+	require.False(t, hasSub)
+
+	res, err := PreConsumeOrganizationSubscription("org-sub-req-1", organization.Id, 880021, 600)
+	require.NoError(t, err)
+	require.EqualValues(t, 600, res.AmountUsedAfter)
+	_, err = PreConsumeOrganizationSubscription("org-sub-req-2", organization.Id, 880021, 600)
+	require.Error(t, err)
+}
+
+func TestGetActiveOrganizationMemberByUserIdUsesCache(t *testing.T) {
+	require.NoError(t, DB.Create(&User{Id: 880031, Username: "org_user_880031", AffCode: "org_aff_880031", Status: common.UserStatusEnabled}).Error)
+
+	// 不属于任何组织的用户写入负缓存
+	active, err := GetActiveOrganizationMemberByUserId(880031)
+	require.NoError(t, err)
+	require.Nil(t, active)
+	entry, found := getOrganizationMemberCacheEntry(880031)
+	require.True(t, found)
+	require.Zero(t, entry.MemberId)
+
+	organization := &Organization{Name: "org-cache", Status: OrganizationStatusEnabled}
+	require.NoError(t, CreateOrganization(organization, 880031))
+	require.NoError(t, IncreaseOrganizationQuota(organization.Id, 1000))
+	active, err = GetActiveOrganizationMemberByUserId(880031)
+	require.NoError(t, err)
+	require.NotNil(t, active)
+	require.Equal(t, organization.Id, active.OrganizationId)
+
+	// 命中缓存时不再查询成员关系，设置了额度上限时仍读取最新的已用额度
+	active.QuotaLimit = 500
+	require.NoError(t, active.Update())
+	_, err = GetActiveOrganizationMemberByUserId(880031)
+	require.NoError(t, err)
+	require.NoError(t, PreConsumeOrganizationQuota(organization.Id, 880031, 200))
+	require.NoError(t, DB.Exec("UPDATE organizations SET status = ? WHERE id = ?", OrganizationStatusDisabled, organization.Id).Error)
+	active, err = GetActiveOrganizationMemberByUserId(880031)
+	require.NoError(t, err)
+	require.NotNil(t, active)
+	require.Equal(t, 500, active.QuotaLimit)
+	require.Equal(t, 200, active.UsedQuota)
+
+	organization.Status = OrganizationStatusDisabled
+	require.NoError(t, organization.Update())
+	active, err = GetActiveOrganizationMemberByUserId(880031)
+	require.NoError(t, err)
+	require.Nil(t, active)
+
+	organization.Status = OrganizationStatusEnabled
+	require.NoError(t, organization.Update())
+	active, err = GetActiveOrganizationMemberByUserId(880031)
+	require.NoError(t, err)
+	require.NotNil(t, active)
+
+	require.NoError(t, RemoveOrganizationMember(organization.Id, 880031))
+	active, err = GetActiveOrganizationMemberByUserId(880031)
+	require.NoError(t, err)
+	require.Nil(t, active)
+}
+
+func TestOrganizationInvitationRequiresAcceptance(t *testing.T) {
+	organization := setupOrganizationForTest(t, "org-invite", 1000, 880051)
+	other := setupOrganizationForTest(t, "org-invite-other", 1000, 880052)
+	require.NoError(t, DB.Create(&User{
+		Id:       880053,
+		Username: "org_user_880053",
+		AffCode:  "org_aff_880053",
+		Status:   common.UserStatusEnabled,
+	}).Error)
+
+	invitation := &OrganizationInvitation{OrganizationId: organization.Id, UserId: 880053, Role: OrganizationRoleMember, QuotaLimit: 300, InviterId: 880051}
+	require.NoError(t, CreateOrganizationInvitation(invitation))
+	require.ErrorIs(t, CreateOrganizationInvitation(&OrganizationInvitation{OrganizationId: organization.Id, UserId: 880053}), ErrOrganizationInvitationExists)
+	require.NoError(t, CreateOrganizationInvitation(&OrganizationInvitation{OrganizationId: other.Id, UserId: 880053}))
+	// 已属于组织的用户不能被邀请
+	require.ErrorIs(t, CreateOrganizationInvitation(&OrganizationInvitation{OrganizationId: organization.Id, UserId: 880052}), ErrUserAlreadyInOrganization)
+
+	// 接受前用户不属于组织，请求仍由个人钱包付费
+	member, err := GetActiveOrganizationMemberByUserId(880053)
+	require.NoError(t, err)
+	require.Nil(t, member)
+
+	invitations, err := GetUserOrganizationInvitations(880053)
+	require.NoError(t, err)
+	require.Len(t, invitations, 2)
+	require.Equal(t, "org-invite", invitations[0].OrganizationName)
+
+	_, err = AcceptOrganizationInvitation(invitation.Id, 880052)
+	require.ErrorIs(t, err, ErrOrganizationInvitationNotFound)
+	member, err = AcceptOrganizationInvitation(invitation.Id, 880053)
+	require.NoError(t, err)
+	require.Equal(t, 300, member.QuotaLimit)
+
+	member, err = GetActiveOrganizationMemberByUserId(880053)
+	require.NoError(t, err)
+	require.NotNil(t, member)
+	require.Equal(t, organization.Id, member.OrganizationId)
+	// 加入组织后其他邀请失效
+	invitations, err = GetUserOrganizationInvitations(880053)
+	require.NoError(t, err)
+	require.Empty(t, invitations)
+}
+
+func TestLeaveOrganization(t *testing.T) {
+	organization := setupOrganizationForTest(t, "org-leave", 1000, 880061, 880062)
+
+	require.ErrorIs(t, LeaveOrganization(880061), ErrOrganizationLastOwner)
+	require.NoError(t, LeaveOrganization(880062))
+	require.ErrorIs(t, LeaveOrganization(880062), gorm.ErrRecordNotFound)
+
+	member, err := GetActiveOrganizationMemberByUserId(880062)
+	require.NoError(t, err)
+	require.Nil(t, member)
+	userIds, err := GetOrganizationMemberUserIds(organization.Id)
+	require.NoError(t, err)
+	require.Equal(t, []int{880061}, userIds)
+}
+
+func TestOrganizationMemberQuotaReservedConcurrently(t *testing.T) {
+	organization := setupOrganizationForTest(t, "org-member-cap", 100000, 880071, 880072)
+	plan := &SubscriptionPlan{
+		Id:            880071,
+		Title:         "Org Cap Plan",
+		DurationUnit:  SubscriptionDurationMonth,
+		DurationValue: 1,
+		Enabled:       true,
+		TotalAmount:   100000,
+	}
+	require.NoError(t, DB.Create(plan).Error)
+	require.NoError(t, AdminBindOrganizationSubscription(organization.Id, plan.Id))
+
+	member, err := GetOrganizationMember(organization.Id, 880072)
+	require.NoError(t, err)
+	member.QuotaLimit = 1000
+	require.NoError(t, member.Update())
+
+	var wg sync.WaitGroup
+	var passed atomic.Int32
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			var err error
+			if i%2 == 0 {
+				_, err = PreConsumeOrganizationSubscription(fmt.Sprintf("org-cap-req-%d", i), organization.Id, 880072, 300)
+			} else {
+				err = PreConsumeOrganizationQuota(organization.Id, 880072, 300)
+			}
+			if err == nil {
+				passed.Add(1)
+			} else {
+				require.ErrorIs(t, err, ErrOrganizationMemberQuotaExceeded)
+			}
+		}(i)
+	}
+	wg.Wait()
+	require.Equal(t, int32(3), passed.Load())
+
+	member, err = GetOrganizationMember(organization.Id, 880072)
+	require.NoError(t, err)
+	require.Equal(t, 900, member.UsedQuota)
+
+	// 重放已成功的预扣请求不会重复计入成员已用额度
+	for i := 0; i < 10; i += 2 {
+		_, _ = PreConsumeOrganizationSubscription(fmt.Sprintf("org-cap-req-%d", i), organization.Id, 880072, 300)
+	}
+	member, err = GetOrganizationMember(organization.Id, 880072)
+	require.NoError(t, err)
+	require.Equal(t, 900, member.UsedQuota)
+	require.ErrorIs(t, ReserveOrganizationMemberQuota(organization.Id, 880072, 101), ErrOrganizationMemberQuotaExceeded)
+	require.NoError(t, ReserveOrganizationMemberQuota(organization.Id, 880072, 100))
+}
+
+func TestOrganizationScopeExcludesRecordsBeforeJoining(t *testing.T) {
+	truncateTables(t)
+	organization := setupOrganizationForTest(t, "org-scope", 1000, 880081, 880082)
+	require.NoError(t, DB.Model(&OrganizationMember{}).Where("user_id = ?", 880082).Update("created_at", 10000).Error)
+	members, err := GetOrganizationMembers(organization.Id)
+	require.NoError(t, err)
+	scopes := make([]OrganizationMemberScope, 0, len(members))
+	for _, member := range members {
+		scopes = append(scopes, OrganizationMemberScope{UserId: member.UserId, JoinedAt: member.CreatedAt})
+	}
+
+	logs := []*Log{
+		{UserId: 880082, Type: LogTypeConsume, CreatedAt: 5000, Quota: 100, Content: "before joining"},
+		{UserId: 880082, Type: LogTypeConsume, CreatedAt: 12000, Quota: 200, Content: "after joining"},
+		{UserId: 880082, Type: LogTypeError, CreatedAt: 12001, Content: "error after joining"},
+		{UserId: 880082, Type: LogTypeTopup, CreatedAt: 12002, Content: "personal top up"},
+		{UserId: 880099, Type: LogTypeConsume, CreatedAt: 12003, Quota: 400, Content: "not a member"},
+	}
+	require.NoError(t, LOG_DB.Create(&logs).Error)
+	require.NoError(t, DB.Create(&[]*QuotaData{
+		{UserID: 880082, Username: "org_user_880082", ModelName: "gpt-4o", CreatedAt: 3600, Count: 1, Quota: 100},
+		{UserID: 880082, Username: "org_user_880082", ModelName: "gpt-4o", CreatedAt: 10800, Count: 1, Quota: 200},
+	}).Error)
+
+	// 成员加入之前的日志、非消费/错误日志与非成员的日志都不返回
+	result, total, err := GetUsersLogs(scopes, LogTypeUnknown, 0, 0, "", "", 0, 10, "", "", "")
+	require.NoError(t, err)
+	require.EqualValues(t, 2, total)
+	contents := []string{result[0].Content, result[1].Content}
+	require.ElementsMatch(t, []string{"after joining", "error after joining"}, contents)
+
+	result, total, err = GetUsersLogs(scopes, LogTypeTopup, 0, 0, "", "", 0, 10, "", "", "")
+	require.NoError(t, err)
+	require.Zero(t, total)
+	require.Empty(t, result)
+
+	stat, err := SumUsersUsedQuota(scopes, 0, 0, "", "", "")
+	require.NoError(t, err)
+	require.Equal(t, 200, stat.Quota)
+
+	quotaData, err := GetQuotaDataByMembers(scopes, 0, 1<<31)
+	require.NoError(t, err)
+	require.Len(t, quotaData, 1)
+	require.Equal(t, 200, quotaData[0].Quota)
+}
@@ -0,0 +1,106 @@
+package model
+
+import (
+	"context"
+
+	"github.com/QuantumNous/new-api/common"
+)
+
+// PayloadLog 留存的请求/响应体，已经过脱敏。保存在日志库中，通过 request_id 与消费日志关联
+type PayloadLog struct {
+	Id                int    `json:"id" gorm:"primaryKey"`
+	CreatedAt         int64  `json:"created_at" gorm:"bigint;index"`
+	RequestId         string `json:"request_id" gorm:"type:varchar(64);index"`
+	UserId            int    `json:"user_id" gorm:"index"`
+	TokenId           int    `json:"token_id"`
+	ChannelId         int    `json:"channel_id"`
+	ModelName         string `json:"model_name" gorm:"size:128"`
+	RequestPath       string `json:"request_path" gorm:"size:255"`
+	IsStream          bool   `json:"is_stream"`
+	StatusCode        int    `json:"status_code"`
+	RequestBody       string `json:"request_body" gorm:"type:text"`
+	ResponseBody      string `json:"response_body" gorm:"type:text"`
+	RequestTruncated  bool   `json:"request_truncated"`
+	ResponseTruncated bool   `json:"response_truncated"`
+	Redactions        string `json:"redactions" gorm:"type:text"` // 各脱敏规则的命中次数，JSON
+}
+
+func (PayloadLog) TableName() string {
+	return "payload_logs"
+}
+
+func clickHousePayloadLogCreateTableSQL() string {
+	return `
+CREATE TABLE IF NOT EXISTS payload_logs (
+	id Int64 DEFAULT 0,
+	created_at Int64 DEFAULT 0,
+	request_id String DEFAULT '',
+	user_id Int32 DEFAULT 0,
+	token_id Int32 DEFAULT 0,
+	channel_id Int32 DEFAULT 0,
+	model_name String DEFAULT '',
+	request_path String DEFAULT '',
+	is_stream UInt8 DEFAULT 0,
+	status_code Int32 DEFAULT 0,
+	request_body String DEFAULT '',
+	response_body String DEFAULT '',
+	request_truncated UInt8 DEFAULT 0,
+	response_truncated UInt8 DEFAULT 0,
+	redactions String DEFAULT ''
+)
+ENGINE = MergeTree()
+PARTITION BY toYYYYMM(toDateTime(created_at))
+ORDER BY (created_at, request_id)`
+}
+
+func InsertPayloadLog(log *PayloadLog) error {
+	if log.CreatedAt == 0 {
+		log.CreatedAt = common.GetTimestamp()
+	}
+	return LOG_DB.Create(log).Error
+}
+
+// GetPayloadLogsByRequestId 按 request_id 查询留存的请求/响应体
+func GetPayloadLogsByRequestId(requestId string) ([]*PayloadLog, error) {
+	var logs []*PayloadLog
+	err := LOG_DB.Where("request_id = ?", requestId).Order("created_at asc").Find(&logs).Error
+	return logs, err
+}
+
+func CountOldPayloadLog(ctx context.Context, targetTimestamp int64) (int64, error) {
+	var total int64
+	err := LOG_DB.WithContext(ctx).Model(&PayloadLog{}).Where("created_at < ?", targetTimestamp).Count(&total).Error
+	return total, err
+}
+
+// DeleteOldPayloadLogBatch 删除一批过期的留存记录，ClickHouse 下与消费日志一样一次性删除所有匹配的行
+func DeleteOldPayloadLogBatch(ctx context.Context, targetTimestamp int64, limit int) (int64, error) {
+	if limit <= 0 {
+		limit = 100
+	}
+	if ctx.Err() != nil {
+		return 0, ctx.Err()
+	}
+	if common.UsingLogDatabase(common.DatabaseTypeClickHouse) {
+		total, err := CountOldPayloadLog(ctx, targetTimestamp)
+		if err != nil || total == 0 {
+			return 0, err
+		}
+		if err := LOG_DB.WithContext(ctx).Exec(
+			"ALTER TABLE payload_logs DELETE WHERE created_at < ? SETTINGS mutations_sync = 1",
+			targetTimestamp,
+		).Error; err != nil {
+			return 0, err
+		}
+		return total, nil
+	}
+	result := LOG_DB.WithContext(ctx).Where("created_at < ?", targetTimestamp).Limit(limit).Delete(&PayloadLog{})
+	return result.RowsAffected, result.Error
+}
+
+// HasOldPayloadLog 判断是否存在过期的留存记录
+func HasOldPayloadLog(targetTimestamp int64) bool {
+	var createdAt []int64
+	err := LOG_DB.Model(&PayloadLog{}).Where("created_at < ?", targetTimestamp).Limit(1).Pluck("created_at", &createdAt).Error
+	return err == nil && len(createdAt) > 0
+}
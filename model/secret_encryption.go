@@ -0,0 +1,320 @@
+package model
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"slices"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/dto"
+	"github.com/QuantumNous/new-api/pkg/envelope"
+
+	"github.com/tidwall/gjson"
+	"github.com/tidwall/sjson"
+	"gorm.io/gorm/schema"
+)
+
+// SecretSerializer 敏感字段的 gorm 序列化器：写入时用主密钥加密，读出时解密，
+// 内存中的结构体（包括渠道缓存）始终是明文。按 map 更新的列不会经过序列化器，需要先调用 common.EncryptSecret
+type SecretSerializer struct{}
+
+func init() {
+	schema.RegisterSerializer("secret", SecretSerializer{})
+}
+
+// Scan implements schema.SerializerInterface
+func (SecretSerializer) Scan(ctx context.Context, field *schema.Field, dst reflect.Value, dbValue interface{}) error {
+	var value string
+	switch v := dbValue.(type) {
+	case nil:
+	case []byte:
+		value = string(v)
+	case string:
+		value = v
+	default:
+		return fmt.Errorf("unsupported secret column value: %T", dbValue)
+	}
+	plain, err := common.DecryptSecret(value)
+	if err != nil {
+		return fmt.Errorf("failed to decrypt %s.%s: %w", field.Schema.Table, field.DBName, err)
+	}
+	return field.Set(ctx, dst, plain)
+}
+
+// Value implements schema.SerializerValuerInterface
+func (SecretSerializer) Value(ctx context.Context, field *schema.Field, dst reflect.Value, fieldValue interface{}) (interface{}, error) {
+	value, ok := fieldValue.(string)
+	if !ok {
+		return nil, fmt.Errorf("unsupported secret field type: %T", fieldValue)
+	}
+	return common.EncryptSecret(value)
+}
+
+// encryptedOptionKeys 加密保存的配置项：OAuth 客户端密钥与支付的签名/回调密钥
+var encryptedOptionKeys = []string{
+	"GitHubClientSecret",
+	"LinuxDOClientSecret",
+	"discord.client_secret",
+	"oidc.client_secret",
+	"EpayKey",
+	"StripeApiSecret",
+	"StripeWebhookSecret",
+	"CreemApiKey",
+	"CreemWebhookSecret",
+	"WaffoApiKey",
+	"WaffoPrivateKey",
+	"WaffoSandboxApiKey",
+	"WaffoSandboxPrivateKey",
+	"WaffoPancakePrivateKey",
+}
+
+func isEncryptedOptionKey(key string) bool {
+	return slices.Contains(encryptedOptionKeys, key)
+}
+
+func encryptOptionValue(key string, value string) (string, error) {
+	if !isEncryptedOptionKey(key) {
+		return value, nil
+	}
+	return common.EncryptSecret(value)
+}
+
+// userSettingWebhookSecretPath 用户设置 JSON 中 webhook 密钥的路径
+const userSettingWebhookSecretPath = "webhook_secret"
+
+// decodeUserSetting 解析保存的用户设置并解密 webhook 密钥，解密失败时清空密钥
+func decodeUserSetting(raw string) dto.UserSetting {
+	setting := dto.UserSetting{}
+	if raw == "" {
+		return setting
+	}
+	if err := common.Unmarshal([]byte(raw), &setting); err != nil {
+		common.SysLog("failed to unmarshal setting: " + err.Error())
+	}
+	if setting.WebhookSecret != "" {
+		plain, err := common.DecryptSecret(setting.WebhookSecret)
+		if err != nil {
+			common.SysLog("failed to decrypt user webhook secret: " + err.Error())
+		}
+		setting.WebhookSecret = plain
+	}
+	return setting
+}
+
+// encodeUserSetting 序列化用户设置，webhook 密钥加密保存
+func encodeUserSetting(setting dto.UserSetting) (string, error) {
+	secret, err := common.EncryptSecret(setting.WebhookSecret)
+	if err != nil {
+		return "", err
+	}
+	setting.WebhookSecret = secret
+	data, err := common.Marshal(setting)
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
+
+// SecretReencryptResult 一次重新加密的统计，按表记录改写的行数
+type SecretReencryptResult struct {
+	Channels       int `json:"channels"`
+	OAuthProviders int `json:"oauth_providers"`
+	Options        int `json:"options"`
+	Users          int `json:"users"`
+	Failed         int `json:"failed"`
+}
+
+func (r SecretReencryptResult) Total() int {
+	return r.Channels + r.OAuthProviders + r.Options + r.Users
+}
+
+type secretRow struct {
+	Id    int    `gorm:"column:id"`
+	Value string `gorm:"column:value"`
+	Hash  string `gorm:"column:hash"`
+}
+
+// ReencryptSecrets 分批用当前主密钥重新加密所有敏感字段：旧主密钥加密的值总是重新加密，
+// includePlaintext 为 true 时同时加密尚未加密的明文（迁移已有数据）。
+// 每一行按原值做条件更新，期间被其他请求修改过的行会跳过
+func ReencryptSecrets(ctx context.Context, batchSize int, includePlaintext bool) (SecretReencryptResult, error) {
+	result := SecretReencryptResult{}
+	if !common.SecretEncryptionEnabled() {
+		return result, fmt.Errorf("SECRET_ENCRYPTION_KEY is not configured")
+	}
+	if batchSize <= 0 {
+		batchSize = 100
+	}
+	var err error
+	if result.Channels, err = reencryptColumn(ctx, "channels", "key", commonKeyCol, "key_hash", batchSize, includePlaintext, &result.Failed); err != nil {
+		return result, err
+	}
+	if result.OAuthProviders, err = reencryptColumn(ctx, CustomOAuthProvider{}.TableName(), "client_secret", "client_secret", "", batchSize, includePlaintext, &result.Failed); err != nil {
+		return result, err
+	}
+	if result.Options, err = reencryptOptions(ctx, includePlaintext, &result.Failed); err != nil {
+		return result, err
+	}
+	if result.Users, err = reencryptUserSettings(ctx, batchSize, includePlaintext, &result.Failed); err != nil {
+		return result, err
+	}
+	return result, nil
+}
+
+// reencryptColumn 按 id 分批改写一张表的一个敏感列，column 为列名，quoted 为 SQL 中引用的列名；
+// hashColumn 不为空时同时写入当前主密钥下的检索摘要，并补齐摘要缺失的行
+func reencryptColumn(ctx context.Context, table string, column string, quoted string, hashColumn string, batchSize int, includePlaintext bool, failed *int) (int, error) {
+	updated := 0
+	lastId := 0
+	selectColumns := "id, " + quoted + " AS value"
+	if hashColumn != "" {
+		selectColumns += ", " + hashColumn + " AS hash"
+	}
+	for {
+		if err := ctx.Err(); err != nil {
+			return updated, err
+		}
+		var rows []secretRow
+		err := DB.WithContext(ctx).Table(table).Select(selectColumns).
+			Where("id > ?", lastId).Order("id asc").Limit(batchSize).Scan(&rows).Error
+		if err != nil {
+			return updated, err
+		}
+		for _, row := range rows {
+			lastId = row.Id
+			needsReencrypt := common.SecretNeedsReencrypt(row.Value, includePlaintext)
+			needsHash := hashColumn != "" && row.Hash == "" && envelope.IsEncrypted(row.Value)
+			if !needsReencrypt && !needsHash {
+				continue
+			}
+			plain, err := common.DecryptSecret(row.Value)
+			if err != nil {
+				common.SysError(fmt.Sprintf("failed to re-encrypt %s.%s of row %d: %s", table, column, row.Id, err.Error()))
+				*failed++
+				continue
+			}
+			updates := map[string]any{}
+			if needsReencrypt {
+				encrypted, err := common.EncryptSecret(plain)
+				if err != nil {
+					common.SysError(fmt.Sprintf("failed to re-encrypt %s.%s of row %d: %s", table, column, row.Id, err.Error()))
+					*failed++
+					continue
+				}
+				updates[column] = encrypted
+			}
+			if hashColumn != "" {
+				updates[hashColumn] = common.SecretLookupHash(plain)
+			}
+			tx := DB.WithContext(ctx).Table(table).Where("id = ? AND "+quoted+" = ?", row.Id, row.Value).Updates(updates)
+			if tx.Error != nil {
+				return updated, tx.Error
+			}
+			updated += int(tx.RowsAffected)
+		}
+		if len(rows) < batchSize {
+			return updated, nil
+		}
+	}
+}
+
+func reencryptOptions(ctx context.Context, includePlaintext bool, failed *int) (int, error) {
+	var options []Option
+	if err := DB.WithContext(ctx).Where(commonKeyCol+" IN ?", encryptedOptionKeys).Find(&options).Error; err != nil {
+		return 0, err
+	}
+	updated := 0
+	for _, option := range options {
+		if !common.SecretNeedsReencrypt(option.Value, includePlaintext) {
+			continue
+		}
+		encrypted, err := common.ReencryptSecret(option.Value)
+		if err != nil {
+			common.SysError(fmt.Sprintf("failed to re-encrypt option %s: %s", option.Key, err.Error()))
+			*failed++
+			continue
+		}
+		tx := DB.WithContext(ctx).Model(&Option{}).Where(commonKeyCol+" = ? AND value = ?", option.Key, option.Value).Update("value", encrypted)
+		if tx.Error != nil {
+			return updated, tx.Error
+		}
+		updated += int(tx.RowsAffected)
+	}
+	return updated, nil
+}
+
+// reencryptUserSettings 只改写设置了 webhook 密钥的用户，同时刷新用户设置缓存
+func reencryptUserSettings(ctx context.Context, batchSize int, includePlaintext bool, failed *int) (int, error) {
+	updated := 0
+	lastId := 0
+	for {
+		if err := ctx.Err(); err != nil {
+			return updated, err
+		}
+		var rows []secretRow
+		err := DB.WithContext(ctx).Table("users").Select("id, setting AS value").
+			Where("id > ? AND setting LIKE ?", lastId, "%\""+userSettingWebhookSecretPath+"\"%").
+			Order("id asc").Limit(batchSize).Scan(&rows).Error
+		if err != nil {
+			return updated, err
+		}
+		for _, row := range rows {
+			lastId = row.Id
+			secret := gjson.Get(row.Value, userSettingWebhookSecretPath).String()
+			if !common.SecretNeedsReencrypt(secret, includePlaintext) {
+				continue
+			}
+			encrypted, err := common.ReencryptSecret(secret)
+			if err != nil {
+				common.SysError(fmt.Sprintf("failed to re-encrypt webhook secret of user %d: %s", row.Id, err.Error()))
+				*failed++
+				continue
+			}
+			setting, err := sjson.Set(row.Value, userSettingWebhookSecretPath, encrypted)
+			if err != nil {
+				*failed++
+				continue
+			}
+			tx := DB.WithContext(ctx).Model(&User{}).Where("id = ? AND setting = ?", row.Id, row.Value).Update("setting", setting)
+			if tx.Error != nil {
+				return updated, tx.Error
+			}
+			if tx.RowsAffected > 0 {
+				updated++
+				_ = updateUserSettingCache(row.Id, setting)
+			}
+		}
+		if len(rows) < batchSize {
+			return updated, nil
+		}
+	}
+}
+
+// HasSecretsToRotate 判断是否还有旧主密钥加密的敏感字段或缺少检索摘要的渠道密钥，供密钥轮换任务决定是否需要执行
+func HasSecretsToRotate() bool {
+	primary := common.SecretPrimaryKeyID()
+	if primary == "" || DB == nil {
+		return false
+	}
+	current := envelope.Prefix + primary + ":%"
+	var count int64
+	if err := DB.Table("channels").Where(commonKeyCol+" LIKE ? AND "+commonKeyCol+" NOT LIKE ?", envelope.Prefix+"%", current).Limit(1).Count(&count).Error; err == nil && count > 0 {
+		return true
+	}
+	// 加密后还没有检索摘要的渠道密钥
+	if err := DB.Table("channels").Where(commonKeyCol+" LIKE ? AND (key_hash IS NULL OR key_hash = '')", envelope.Prefix+"%").Limit(1).Count(&count).Error; err == nil && count > 0 {
+		return true
+	}
+	if err := DB.Table(CustomOAuthProvider{}.TableName()).Where("client_secret LIKE ? AND client_secret NOT LIKE ?", envelope.Prefix+"%", current).Limit(1).Count(&count).Error; err == nil && count > 0 {
+		return true
+	}
+	if err := DB.Model(&Option{}).Where(commonKeyCol+" IN ? AND value LIKE ? AND value NOT LIKE ?", encryptedOptionKeys, envelope.Prefix+"%", current).Limit(1).Count(&count).Error; err == nil && count > 0 {
+		return true
+	}
+	webhookSecret := "%\"" + userSettingWebhookSecretPath + "\":\""
+	if err := DB.Table("users").Where("setting LIKE ? AND setting NOT LIKE ?", webhookSecret+envelope.Prefix+"%", webhookSecret+envelope.Prefix+primary+":%").Limit(1).Count(&count).Error; err == nil && count > 0 {
+		return true
+	}
+	return false
+}
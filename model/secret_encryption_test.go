@@ -0,0 +1,139 @@
+package model
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/dto"
+	"github.com/QuantumNous/new-api/pkg/envelope"
+
+	"github.com/stretchr/testify/require"
+)
+
+func rawChannelKey(t *testing.T, id int) string {
+	t.Helper()
+	var key string
+	require.NoError(t, DB.Table("channels").Select(commonKeyCol).Where("id = ?", id).Row().Scan(&key))
+	return key
+}
+
+func TestReencryptSecretsMigratesAndRotates(t *testing.T) {
+	truncateTables(t)
+	t.Cleanup(func() { common.SetSecretKeyring(nil) })
+	common.SetSecretKeyring(nil)
+
+	channel := &Channel{Id: 1, Name: "upstream", Key: "sk-plain-key"}
+	require.NoError(t, DB.Create(channel).Error)
+	user := &User{Id: 1, Username: "alice"}
+	require.NoError(t, DB.Create(user).Error)
+	require.NoError(t, DB.Model(&User{}).Where("id = ?", 1).Update("setting", `{"webhook_secret":"whsec-plain"}`).Error)
+	require.Equal(t, "sk-plain-key", rawChannelKey(t, 1))
+
+	oldKey := bytes.Repeat([]byte{1}, 32)
+	newKey := bytes.Repeat([]byte{2}, 32)
+	oldRing, err := envelope.NewKeyring(oldKey)
+	require.NoError(t, err)
+	common.SetSecretKeyring(oldRing)
+
+	result, err := ReencryptSecrets(context.Background(), 10, true)
+	require.NoError(t, err)
+	require.Equal(t, 1, result.Channels)
+	require.Equal(t, 1, result.Users)
+	require.Equal(t, oldRing.PrimaryID(), envelope.KeyID(rawChannelKey(t, 1)))
+
+	loaded, err := GetChannelById(1, true)
+	require.NoError(t, err)
+	require.Equal(t, "sk-plain-key", loaded.Key)
+	loadedUser, err := GetUserById(1, true)
+	require.NoError(t, err)
+	require.Equal(t, "whsec-plain", loadedUser.GetSetting().WebhookSecret)
+	require.False(t, HasSecretsToRotate())
+
+	newRing, err := envelope.NewKeyring(newKey, oldKey)
+	require.NoError(t, err)
+	common.SetSecretKeyring(newRing)
+	require.True(t, HasSecretsToRotate())
+
+	result, err = ReencryptSecrets(context.Background(), 10, false)
+	require.NoError(t, err)
+	require.Equal(t, 2, result.Total())
+	require.Equal(t, newRing.PrimaryID(), envelope.KeyID(rawChannelKey(t, 1)))
+	require.False(t, HasSecretsToRotate())
+
+	loaded, err = GetChannelById(1, true)
+	require.NoError(t, err)
+	require.Equal(t, "sk-plain-key", loaded.Key)
+}
+
+func TestEncodeUserSettingEncryptsWebhookSecret(t *testing.T) {
+	ring, err := envelope.NewKeyring(bytes.Repeat([]byte{3}, 32))
+	require.NoError(t, err)
+	common.SetSecretKeyring(ring)
+	t.Cleanup(func() { common.SetSecretKeyring(nil) })
+
+	raw, err := encodeUserSetting(dto.UserSetting{WebhookSecret: "whsec-1"})
+	require.NoError(t, err)
+	require.NotContains(t, raw, "whsec-1")
+	require.Equal(t, "whsec-1", decodeUserSetting(raw).WebhookSecret)
+}
+
+func TestSearchChannelsMatchesEncryptedKey(t *testing.T) {
+	truncateTables(t)
+	t.Cleanup(func() { common.SetSecretKeyring(nil) })
+
+	oldKey := bytes.Repeat([]byte{4}, 32)
+	newKey := bytes.Repeat([]byte{5}, 32)
+	oldRing, err := envelope.NewKeyring(oldKey)
+	require.NoError(t, err)
+	common.SetSecretKeyring(oldRing)
+
+	tag := "search-tag"
+	channel := &Channel{Id: 1, Name: "upstream", Key: "sk-search-key", Models: "gpt-4o", Group: "default", Tag: &tag}
+	require.NoError(t, DB.Create(channel).Error)
+	require.True(t, envelope.IsEncrypted(rawChannelKey(t, 1)))
+
+	assertFound := func() {
+		t.Helper()
+		channels, err := SearchChannels("sk-search-key", "", "", false)
+		require.NoError(t, err)
+		require.Len(t, channels, 1)
+		require.Equal(t, 1, channels[0].Id)
+		tags, err := SearchTags("sk-search-key", "", "", false)
+		require.NoError(t, err)
+		require.Len(t, tags, 1)
+		require.Equal(t, tag, *tags[0])
+
+		channels, err = SearchChannels("sk-other-key", "", "", false)
+		require.NoError(t, err)
+		require.Empty(t, channels)
+	}
+	assertFound()
+
+	// 轮换主密钥后，旧主密钥下的摘要仍能匹配，重新加密后改用新主密钥的摘要
+	newRing, err := envelope.NewKeyring(newKey, oldKey)
+	require.NoError(t, err)
+	common.SetSecretKeyring(newRing)
+	assertFound()
+	_, err = ReencryptSecrets(context.Background(), 10, false)
+	require.NoError(t, err)
+	onlyNewRing, err := envelope.NewKeyring(newKey)
+	require.NoError(t, err)
+	common.SetSecretKeyring(onlyNewRing)
+	assertFound()
+
+	// 加密后缺少摘要的旧数据由重新加密任务补齐
+	require.NoError(t, DB.Table("channels").Where("id = ?", 1).Update("key_hash", "").Error)
+	require.True(t, HasSecretsToRotate())
+	result, err := ReencryptSecrets(context.Background(), 10, false)
+	require.NoError(t, err)
+	require.Equal(t, 1, result.Channels)
+	require.False(t, HasSecretsToRotate())
+	assertFound()
+
+	require.NoError(t, UpdateChannelKey(1, "sk-rotated-key"))
+	channels, err := SearchChannels("sk-rotated-key", "", "", false)
+	require.NoError(t, err)
+	require.Len(t, channels, 1)
+}
@@ -0,0 +1,138 @@
+package model
+
+import (
+	"context"
+
+	"github.com/QuantumNous/new-api/common"
+)
+
+// ShadowLog 一次影子流量请求的对比记录：主请求与影子请求各自的延迟、用量、结束原因与错误
+type ShadowLog struct {
+	Id                      int      `json:"id" gorm:"primaryKey"`
+	CreatedAt               int64    `json:"created_at" gorm:"bigint;index"`
+	RequestId               string   `json:"request_id" gorm:"type:varchar(64);index"`
+	UserId                  int      `json:"user_id" gorm:"index"`
+	ModelName               string   `json:"model_name" gorm:"size:128;index"`
+	Group                   string   `json:"group" gorm:"column:group;size:64"`
+	IsStream                bool     `json:"is_stream"`
+	PrimaryChannelId        int      `json:"primary_channel_id" gorm:"index"`
+	ShadowChannelId         int      `json:"shadow_channel_id" gorm:"index"`
+	PrimaryLatencyMs        int64    `json:"primary_latency_ms"`
+	ShadowLatencyMs         int64    `json:"shadow_latency_ms"`
+	PrimaryTtftMs           int64    `json:"primary_ttft_ms"`
+	ShadowTtftMs            int64    `json:"shadow_ttft_ms"`
+	PrimaryPromptTokens     int      `json:"primary_prompt_tokens"`
+	PrimaryCompletionTokens int      `json:"primary_completion_tokens"`
+	ShadowPromptTokens      int      `json:"shadow_prompt_tokens"`
+	ShadowCompletionTokens  int      `json:"shadow_completion_tokens"`
+	PrimaryFinishReason     string   `json:"primary_finish_reason" gorm:"size:64"`
+	ShadowFinishReason      string   `json:"shadow_finish_reason" gorm:"size:64"`
+	PrimaryError            string   `json:"primary_error" gorm:"type:text"`
+	ShadowError             string   `json:"shadow_error" gorm:"type:text"`
+	ShadowStatusCode        int      `json:"shadow_status_code"`
+	ShadowQuota             int      `json:"shadow_quota"` // 影子请求按正常价格计算的渠道成本，不向用户收取
+	Similarity              *float64 `json:"similarity"`   // 两侧响应文本的相似度 0-1，未开启比较或任一侧没有文本时为空
+}
+
+func (ShadowLog) TableName() string {
+	return "shadow_logs"
+}
+
+// ShadowLogSummary 按影子渠道与模型汇总的对比数据
+type ShadowLogSummary struct {
+	ShadowChannelId         int     `json:"shadow_channel_id"`
+	ModelName               string  `json:"model_name"`
+	RequestCount            int64   `json:"request_count"`
+	PrimaryErrorCount       int64   `json:"primary_error_count"`
+	ShadowErrorCount        int64   `json:"shadow_error_count"`
+	PrimaryLatencyMs        int64   `json:"primary_latency_ms"`
+	ShadowLatencyMs         int64   `json:"shadow_latency_ms"`
+	PrimaryCompletionTokens int64   `json:"primary_completion_tokens"`
+	ShadowCompletionTokens  int64   `json:"shadow_completion_tokens"`
+	ShadowQuota             int64   `json:"shadow_quota"`
+	SimilaritySum           float64 `json:"-"`
+	SimilarityCount         int64   `json:"similarity_count"`
+	AvgPrimaryLatencyMs     int64   `json:"avg_primary_latency_ms" gorm:"-"`
+	AvgShadowLatencyMs      int64   `json:"avg_shadow_latency_ms" gorm:"-"`
+	AvgSimilarity           float64 `json:"avg_similarity" gorm:"-"`
+}
+
+func InsertShadowLog(log *ShadowLog) error {
+	if log.CreatedAt == 0 {
+		log.CreatedAt = common.GetTimestamp()
+	}
+	return DB.Create(log).Error
+}
+
+func GetShadowLogs(channelId int, modelName string, startTimestamp int64, endTimestamp int64, startIdx int, num int) (logs []*ShadowLog, total int64, err error) {
+	tx := DB.Model(&ShadowLog{})
+	if channelId != 0 {
+		tx = tx.Where("shadow_channel_id = ? OR primary_channel_id = ?", channelId, channelId)
+	}
+	if modelName != "" {
+		tx = tx.Where("model_name = ?", modelName)
+	}
+	if startTimestamp != 0 {
+		tx = tx.Where("created_at >= ?", startTimestamp)
+	}
+	if endTimestamp != 0 {
+		tx = tx.Where("created_at <= ?", endTimestamp)
+	}
+	if err = tx.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	err = tx.Order("id desc").Limit(num).Offset(startIdx).Find(&logs).Error
+	return logs, total, err
+}
+
+// GetShadowLogSummary 汇总时间范围内的影子日志，channelId 为 0 时返回所有影子渠道
+func GetShadowLogSummary(channelId int, startTimestamp int64, endTimestamp int64) ([]*ShadowLogSummary, error) {
+	tx := DB.Model(&ShadowLog{}).Select(`shadow_channel_id, model_name, COUNT(*) AS request_count,
+		SUM(CASE WHEN primary_error <> '' THEN 1 ELSE 0 END) AS primary_error_count,
+		SUM(CASE WHEN shadow_error <> '' THEN 1 ELSE 0 END) AS shadow_error_count,
+		SUM(primary_latency_ms) AS primary_latency_ms, SUM(shadow_latency_ms) AS shadow_latency_ms,
+		SUM(primary_completion_tokens) AS primary_completion_tokens, SUM(shadow_completion_tokens) AS shadow_completion_tokens,
+		SUM(shadow_quota) AS shadow_quota, COALESCE(SUM(similarity), 0) AS similarity_sum, COUNT(similarity) AS similarity_count`)
+	if channelId != 0 {
+		tx = tx.Where("shadow_channel_id = ?", channelId)
+	}
+	if startTimestamp != 0 {
+		tx = tx.Where("created_at >= ?", startTimestamp)
+	}
+	if endTimestamp != 0 {
+		tx = tx.Where("created_at <= ?", endTimestamp)
+	}
+	var summaries []*ShadowLogSummary
+	if err := tx.Group("shadow_channel_id, model_name").Order("shadow_channel_id, model_name").Scan(&summaries).Error; err != nil {
+		return nil, err
+	}
+	for _, summary := range summaries {
+		if summary.RequestCount > 0 {
+			summary.AvgPrimaryLatencyMs = summary.PrimaryLatencyMs / summary.RequestCount
+			summary.AvgShadowLatencyMs = summary.ShadowLatencyMs / summary.RequestCount
+		}
+		if summary.SimilarityCount > 0 {
+			summary.AvgSimilarity = summary.SimilaritySum / float64(summary.SimilarityCount)
+		}
+	}
+	return summaries, nil
+}
+
+// DeleteOldShadowLogBatch 删除一批指定时间之前的影子日志
+func DeleteOldShadowLogBatch(ctx context.Context, targetTimestamp int64, limit int) (int64, error) {
+	if limit <= 0 {
+		limit = 100
+	}
+	if ctx.Err() != nil {
+		return 0, ctx.Err()
+	}
+	result := DB.WithContext(ctx).Where("created_at < ?", targetTimestamp).Limit(limit).Delete(&ShadowLog{})
+	return result.RowsAffected, result.Error
+}
+
+// HasOldShadowLog 判断是否存在过期的影子日志
+func HasOldShadowLog(targetTimestamp int64) bool {
+	var createdAt []int64
+	err := DB.Model(&ShadowLog{}).Where("created_at < ?", targetTimestamp).Limit(1).Pluck("created_at", &createdAt).Error
+	return err == nil && len(createdAt) > 0
+}
@@ -276,6 +276,9 @@ type UserSubscription struct {
 	// Whether wallet fallback is allowed after this subscription's quota is exhausted (snapshot from plan)
 	AllowWalletOverflow bool `json:"allow_wallet_overflow"`
 
+	// Organization subscriptions have UserId = 0 and are shared by all members of the organization
+	OrganizationId int `json:"organization_id" gorm:"index;default:0"`
+
 	CreatedAt int64 `json:"created_at" gorm:"bigint"`
 	UpdatedAt int64 `json:"updated_at" gorm:"bigint"`
 }
@@ -999,6 +1002,17 @@ func ExpireDueSubscriptions(limit int) (int, error) {
 		return 0, nil
 	}
 	expiredCount := 0
+	// Organization subscriptions never change a user's group, so they are simply marked expired.
+	orgRes := DB.Model(&UserSubscription{}).
+		Where("user_id = 0 AND organization_id > 0 AND status = ? AND end_time > 0 AND end_time <= ?", "active", now).
+		Updates(map[string]interface{}{
+			"status":     "expired",
+			"updated_at": common.GetTimestamp(),
+		})
+	if orgRes.Error != nil {
+		return 0, orgRes.Error
+	}
+	expiredCount += int(orgRes.RowsAffected)
 	userIds := make(map[int]struct{}, len(subs))
 	for _, sub := range subs {
 		if sub.UserId > 0 {
@@ -1145,6 +1159,24 @@ func PreConsumeUserSubscription(requestId string, userId int, modelName string,
 	if userId <= 0 {
 		return nil, errors.New("invalid userId")
 	}
+	return preConsumeSubscription(requestId, userId, "user_id = ?", userId, amount, nil)
+}
+
+// PreConsumeOrganizationSubscription pre-consumes from the organization's active subscriptions on behalf of a member.
+// The amount is reserved against the member's quota limit in the same transaction, so concurrent requests cannot exceed it.
+func PreConsumeOrganizationSubscription(requestId string, organizationId int, userId int, amount int64) (*SubscriptionPreConsumeResult, error) {
+	if organizationId <= 0 || userId <= 0 {
+		return nil, errors.New("invalid organizationId or userId")
+	}
+	return preConsumeSubscription(requestId, userId, "organization_id = ?", organizationId, amount, func(tx *gorm.DB) error {
+		return reserveOrganizationMemberQuotaTx(tx, organizationId, userId, int(amount))
+	})
+}
+
+// preConsumeSubscription picks the first active subscription matched by ownerQuery that has enough quota.
+// The pre-consume record is always attributed to userId (the requesting user).
+// onConsume runs in the same transaction only when a new pre-consume record is created, not on idempotent replays.
+func preConsumeSubscription(requestId string, userId int, ownerQuery string, ownerId int, amount int64, onConsume func(tx *gorm.DB) error) (*SubscriptionPreConsumeResult, error) {
 	if strings.TrimSpace(requestId) == "" {
 		return nil, errors.New("requestId is empty")
 	}
@@ -1179,7 +1211,7 @@ func PreConsumeUserSubscription(requestId string, userId int, modelName string,
 
 		var subs []UserSubscription
 		if err := tx.Set("gorm:query_option", "FOR UPDATE").
-			Where("user_id = ? AND status = ? AND end_time > ?", userId, "active", now).
+			Where(ownerQuery+" AND status = ? AND end_time > ?", ownerId, "active", now).
 			Order("end_time asc, id asc").
 			Find(&subs).Error; err != nil {
 			return errors.New("no active subscription")
@@ -1225,6 +1257,11 @@ func PreConsumeUserSubscription(requestId string, userId int, modelName string,
 				}
 				return err
 			}
+			if onConsume != nil {
+				if err := onConsume(tx); err != nil {
+					return err
+				}
+			}
 			sub.AmountUsed += amount
 			if err := tx.Save(&sub).Error; err != nil {
 				return err
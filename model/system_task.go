@@ -16,11 +16,17 @@ const (
 	SystemTaskStatusSucceeded SystemTaskStatus = "succeeded"
 	SystemTaskStatusFailed    SystemTaskStatus = "failed"
 
-	SystemTaskTypeLogCleanup     = "log_cleanup"
-	SystemTaskTypeChannelTest    = "channel_test"
-	SystemTaskTypeModelUpdate    = "model_update"
-	SystemTaskTypeMidjourneyPoll = "midjourney_poll"
-	SystemTaskTypeAsyncTaskPoll  = "async_task_poll"
+	SystemTaskTypeLogCleanup        = "log_cleanup"
+	SystemTaskTypeChannelTest       = "channel_test"
+	SystemTaskTypeModelUpdate       = "model_update"
+	SystemTaskTypeMidjourneyPoll    = "midjourney_poll"
+	SystemTaskTypeAsyncTaskPoll     = "async_task_poll"
+	SystemTaskTypeFileCleanup       = "file_cleanup"
+	SystemTaskTypeBatchRun          = "batch_run"
+	SystemTaskTypePayloadCleanup    = "payload_cleanup"
+	SystemTaskTypeSecretRotation    = "secret_rotation"
+	SystemTaskTypeTokenKeyMigration = "token_key_migration"
+	SystemTaskTypeShadowLogCleanup  = "shadow_log_cleanup"
 )
 
 var ErrSystemTaskLockLost = errors.New("system task lock lost")
@@ -46,11 +46,18 @@ func TestMain(m *testing.M) {
 		&SubscriptionPlan{},
 		&SubscriptionOrder{},
 		&UserSubscription{},
+		&SubscriptionPreConsumeRecord{},
 		&UserOAuthBinding{},
 		&PerfMetric{},
 		&SystemInstance{},
 		&SystemTask{},
 		&SystemTaskLock{},
+		&Organization{},
+		&OrganizationMember{},
+		&OrganizationInvitation{},
+		&Option{},
+		&CustomOAuthProvider{},
+		&TokenSpendCounter{},
 	); err != nil {
 		panic("failed to migrate: " + err.Error())
 	}
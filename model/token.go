@@ -1,9 +1,15 @@
 package model
 
 import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"errors"
 	"fmt"
 	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/QuantumNous/new-api/common"
 	"github.com/QuantumNous/new-api/setting/operation_setting"
@@ -14,7 +20,8 @@ import (
 type Token struct {
 	Id                 int            `json:"id"`
 	UserId             int            `json:"user_id" gorm:"index"`
-	Key                string         `json:"key" gorm:"type:varchar(128);uniqueIndex"`
+	Key                string         `json:"key" gorm:"type:varchar(128);uniqueIndex"`            // 令牌哈希，旧版本创建且尚未使用过的令牌为明文
+	KeyPrefix          string         `json:"key_prefix" gorm:"type:varchar(16);index;default:''"` // 明文密钥的前几位，用于搜索与展示
 	Status             int            `json:"status" gorm:"default:1"`
 	Name               string         `json:"name" gorm:"index" `
 	CreatedTime        int64          `json:"created_time" gorm:"bigint"`
@@ -27,7 +34,14 @@ type Token struct {
 	AllowIps           *string        `json:"allow_ips" gorm:"default:''"`
 	UsedQuota          int            `json:"used_quota" gorm:"default:0"` // used quota
 	Group              string         `json:"group" gorm:"default:''"`
-	CrossGroupRetry    bool           `json:"cross_group_retry"` // 跨分组重试，仅auto分组有效
+	CrossGroupRetry    bool           `json:"cross_group_retry"`                    // 跨分组重试，仅auto分组有效
+	ResponseCache      bool           `json:"response_cache"`                       // 启用对话补全响应缓存
+	DailyQuotaLimit    int            `json:"daily_quota_limit" gorm:"default:0"`   // 每日消费上限，0 表示不限制
+	WeeklyQuotaLimit   int            `json:"weekly_quota_limit" gorm:"default:0"`  // 每周消费上限，0 表示不限制
+	MonthlyQuotaLimit  int            `json:"monthly_quota_limit" gorm:"default:0"` // 每月消费上限，0 表示不限制
+	RpmLimit           int            `json:"rpm_limit" gorm:"default:0"`           // 每分钟请求数上限，0 表示不限制
+	MaxRequestQuota    int            `json:"max_request_quota" gorm:"default:0"`   // 单次请求预估费用上限，0 表示不限制
+	ModelQuotaLimits   string         `json:"model_quota_limits" gorm:"type:text"`  // 按模型的周期消费上限，JSON: {"model": {"daily_quota": 1}}
 	DeletedAt          gorm.DeletedAt `gorm:"index"`
 }
 
@@ -35,10 +49,44 @@ func (token *Token) Clean() {
 	token.Key = ""
 }
 
-func MaskTokenKey(key string) string {
+// tokenKeyHashPrefix 令牌哈希的前缀。生成的密钥只包含字母和数字，带冒号的值一定是哈希
+const tokenKeyHashPrefix = "sha256:"
+
+// tokenKeyPrefixLength 保存并展示的明文密钥前缀长度
+const tokenKeyPrefixLength = 8
+
+// HashTokenKey 计算保存在数据库中的令牌哈希，空字符串返回空字符串
+func HashTokenKey(key string) string {
 	if key == "" {
 		return ""
 	}
+	sum := sha256.Sum256([]byte(key))
+	return tokenKeyHashPrefix + hex.EncodeToString(sum[:])
+}
+
+// IsHashedTokenKey 判断保存的令牌是否已经是哈希
+func IsHashedTokenKey(key string) bool {
+	return strings.HasPrefix(key, tokenKeyHashPrefix)
+}
+
+func tokenKeyPrefix(key string) string {
+	if len(key) <= tokenKeyPrefixLength {
+		return ""
+	}
+	return key[:tokenKeyPrefixLength]
+}
+
+// SetKey 设置新的明文密钥，只保留哈希与前缀，调用方需要自行把明文返回给用户
+func (token *Token) SetKey(key string) {
+	token.Key = HashTokenKey(key)
+	token.KeyPrefix = tokenKeyPrefix(key)
+}
+
+// MaskTokenKey 脱敏展示令牌。已哈希的令牌只展示保存的前缀
+func MaskTokenKey(key string) string {
+	if key == "" || IsHashedTokenKey(key) {
+		return ""
+	}
 	if len(key) <= 4 {
 		return strings.Repeat("*", len(key))
 	}
@@ -48,11 +96,102 @@ func MaskTokenKey(key string) string {
 	return key[:4] + "**********" + key[len(key)-4:]
 }
 
-func (token *Token) GetFullKey() string {
-	return token.Key
+// TokenQuotaWindows 按自然日 / 周 / 月计算的消费上限，0 表示不限制
+type TokenQuotaWindows struct {
+	DailyQuota   int `json:"daily_quota,omitempty"`
+	WeeklyQuota  int `json:"weekly_quota,omitempty"`
+	MonthlyQuota int `json:"monthly_quota,omitempty"`
+}
+
+func (w TokenQuotaWindows) IsEmpty() bool {
+	return w.DailyQuota <= 0 && w.WeeklyQuota <= 0 && w.MonthlyQuota <= 0
+}
+
+func (w TokenQuotaWindows) Validate() error {
+	if w.DailyQuota < 0 || w.WeeklyQuota < 0 || w.MonthlyQuota < 0 {
+		return errors.New("quota limit cannot be negative")
+	}
+	return nil
+}
+
+// TokenLimits 令牌的周期消费上限、按模型的子预算、单次请求费用上限与每分钟请求数上限
+type TokenLimits struct {
+	TokenQuotaWindows
+	Rpm             int                          `json:"rpm,omitempty"`
+	MaxRequestQuota int                          `json:"max_request_quota,omitempty"`
+	ModelQuotas     map[string]TokenQuotaWindows `json:"model_quotas,omitempty"`
+}
+
+func (l TokenLimits) IsEmpty() bool {
+	return l.TokenQuotaWindows.IsEmpty() && l.Rpm <= 0 && l.MaxRequestQuota <= 0 && len(l.ModelQuotas) == 0
+}
+
+// GetModelQuota 返回模型对应的子预算，精确匹配优先，其次匹配最长的 "前缀*" 规则
+func (l TokenLimits) GetModelQuota(modelName string) (TokenQuotaWindows, string, bool) {
+	if quota, ok := l.ModelQuotas[modelName]; ok {
+		return quota, modelName, true
+	}
+	matched := ""
+	for pattern := range l.ModelQuotas {
+		prefix, isWildcard := strings.CutSuffix(pattern, "*")
+		if isWildcard && strings.HasPrefix(modelName, prefix) && len(pattern) > len(matched) {
+			matched = pattern
+		}
+	}
+	if matched == "" {
+		return TokenQuotaWindows{}, "", false
+	}
+	return l.ModelQuotas[matched], matched, true
+}
+
+// GetModelQuotaLimits 解析按模型的子预算，key 为模型名，支持以 * 结尾的前缀匹配
+func (token *Token) GetModelQuotaLimits() (map[string]TokenQuotaWindows, error) {
+	if strings.TrimSpace(token.ModelQuotaLimits) == "" {
+		return nil, nil
+	}
+	var limits map[string]TokenQuotaWindows
+	if err := common.UnmarshalJsonStr(token.ModelQuotaLimits, &limits); err != nil {
+		return nil, err
+	}
+	for modelName, limit := range limits {
+		if strings.TrimSpace(modelName) == "" {
+			return nil, errors.New("model name cannot be empty")
+		}
+		if err := limit.Validate(); err != nil {
+			return nil, fmt.Errorf("model %s: %w", modelName, err)
+		}
+		if limit.IsEmpty() {
+			delete(limits, modelName)
+		}
+	}
+	return limits, nil
+}
+
+func (token *Token) GetLimits() TokenLimits {
+	limits := TokenLimits{
+		TokenQuotaWindows: TokenQuotaWindows{
+			DailyQuota:   token.DailyQuotaLimit,
+			WeeklyQuota:  token.WeeklyQuotaLimit,
+			MonthlyQuota: token.MonthlyQuotaLimit,
+		},
+		Rpm:             token.RpmLimit,
+		MaxRequestQuota: token.MaxRequestQuota,
+	}
+	modelQuotas, err := token.GetModelQuotaLimits()
+	if err != nil {
+		common.SysLog(fmt.Sprintf("failed to parse model quota limits of token %d: %s", token.Id, err.Error()))
+	}
+	limits.ModelQuotas = modelQuotas
+	return limits
 }
 
 func (token *Token) GetMaskedKey() string {
+	if IsHashedTokenKey(token.Key) {
+		if token.KeyPrefix == "" {
+			return ""
+		}
+		return token.KeyPrefix + "**********"
+	}
 	return MaskTokenKey(token.Key)
 }
 
@@ -173,7 +312,14 @@ func SearchUserTokens(userId int, keyword string, token string, offset int, limi
 		if err != nil {
 			return nil, 0, err
 		}
-		baseQuery = baseQuery.Where(commonKeyCol+" LIKE ? ESCAPE '!'", tokenPattern)
+		if strings.Contains(tokenPattern, "%") {
+			// 已哈希的令牌按前缀模糊搜索，尚未迁移的旧令牌仍按明文搜索
+			baseQuery = baseQuery.Where("(key_prefix LIKE ? ESCAPE '!') OR ("+commonKeyCol+" NOT LIKE ? AND "+commonKeyCol+" LIKE ? ESCAPE '!')",
+				tokenPattern, tokenKeyHashPrefix+"%", tokenPattern)
+		} else {
+			// 精确搜索按完整密钥的哈希或前缀匹配
+			baseQuery = baseQuery.Where("("+commonKeyCol+" IN ? OR key_prefix = ?)", []string{HashTokenKey(token), token}, token)
+		}
 	}
 
 	// 先查匹配总数（用于分页，受 maxTokens 上限保护，避免全表 COUNT）
@@ -259,7 +405,123 @@ func GetTokenById(id int) (*Token, error) {
 	return &token, err
 }
 
+// GetTokenByKey 按用户提交的明文密钥查找令牌，返回的令牌 Key 为哈希。
+// 旧版本明文保存的令牌在这里首次使用时改为保存哈希
 func GetTokenByKey(key string, fromDB bool) (token *Token, err error) {
+	if IsHashedTokenKey(key) {
+		// 哈希本身不能作为密钥使用
+		return nil, gorm.ErrRecordNotFound
+	}
+	token, err = GetTokenByKeyHash(HashTokenKey(key), fromDB)
+	if errors.Is(err, gorm.ErrRecordNotFound) && key != "" && HasLegacyTokenKeys() {
+		token, err = migrateLegacyTokenKey(key)
+	}
+	return token, err
+}
+
+// legacyTokenKeyRecheckInterval 仍有明文令牌时重新确认的间隔，其他节点完成迁移后本节点也随之停止回退查找
+const legacyTokenKeyRecheckInterval = time.Minute
+
+var (
+	legacyTokenKeysMigrated  atomic.Bool
+	legacyTokenKeysLock      sync.Mutex
+	legacyTokenKeysFound     bool
+	legacyTokenKeysCheckedAt time.Time
+)
+
+// legacyTokenKeyCondition 旧版本明文保存的令牌
+func legacyTokenKeyCondition(db *gorm.DB) *gorm.DB {
+	return db.Where(commonKeyCol+" <> '' AND "+commonKeyCol+" NOT LIKE ?", tokenKeyHashPrefix+"%")
+}
+
+// HasLegacyTokenKeys 判断是否还有旧版本明文保存的令牌。新令牌总是保存哈希，全部迁移后不再按明文回退查找，
+// 未知令牌只查询一次数据库
+func HasLegacyTokenKeys() bool {
+	if legacyTokenKeysMigrated.Load() || DB == nil {
+		return false
+	}
+	legacyTokenKeysLock.Lock()
+	defer legacyTokenKeysLock.Unlock()
+	if time.Since(legacyTokenKeysCheckedAt) < legacyTokenKeyRecheckInterval {
+		return legacyTokenKeysFound
+	}
+	var ids []int
+	if err := legacyTokenKeyCondition(DB.Unscoped().Model(&Token{})).Limit(1).Pluck("id", &ids).Error; err != nil {
+		// 查询失败时保持回退，不能让旧令牌无法使用
+		return true
+	}
+	legacyTokenKeysCheckedAt = time.Now()
+	legacyTokenKeysFound = len(ids) > 0
+	if !legacyTokenKeysFound {
+		legacyTokenKeysMigrated.Store(true)
+	}
+	return legacyTokenKeysFound
+}
+
+// MigrateLegacyTokenKeys 把剩余的明文令牌（包括已删除的）批量改为保存哈希与前缀，返回迁移的数量
+func MigrateLegacyTokenKeys(ctx context.Context, batchSize int) (int, error) {
+	migrated := 0
+	lastId := 0
+	for {
+		if err := ctx.Err(); err != nil {
+			return migrated, err
+		}
+		var tokens []Token
+		err := legacyTokenKeyCondition(DB.Unscoped().Select("id, "+commonKeyCol).Where("id > ?", lastId)).
+			Order("id").Limit(batchSize).Find(&tokens).Error
+		if err != nil {
+			return migrated, err
+		}
+		if len(tokens) == 0 {
+			break
+		}
+		for _, token := range tokens {
+			lastId = token.Id
+			key := token.Key
+			token.SetKey(key)
+			result := DB.Unscoped().Model(&Token{}).Where("id = ? AND "+commonKeyCol+" = ?", token.Id, key).
+				Updates(map[string]interface{}{"key": token.Key, "key_prefix": token.KeyPrefix})
+			if result.Error != nil {
+				return migrated, result.Error
+			}
+			if result.RowsAffected > 0 {
+				migrated++
+			}
+			if common.RedisEnabled {
+				_ = cacheDeleteToken(key)
+			}
+		}
+	}
+	legacyTokenKeysMigrated.Store(true)
+	return migrated, nil
+}
+
+// migrateLegacyTokenKey 把旧版本明文保存的令牌改为保存哈希与前缀。
+// 按原值做条件更新，并发请求同时迁移时只有一个会生效
+func migrateLegacyTokenKey(key string) (*Token, error) {
+	var token Token
+	if err := DB.Where(commonKeyCol+" = ?", key).First(&token).Error; err != nil {
+		return nil, err
+	}
+	token.SetKey(key)
+	err := DB.Model(&Token{}).Where("id = ? AND "+commonKeyCol+" = ?", token.Id, key).
+		Updates(map[string]interface{}{"key": token.Key, "key_prefix": token.KeyPrefix}).Error
+	if err != nil {
+		return nil, err
+	}
+	if shouldUpdateRedis(true, nil) {
+		gopool.Go(func() {
+			_ = cacheDeleteToken(key)
+			if err := cacheSetToken(token); err != nil {
+				common.SysLog("failed to update token cache: " + err.Error())
+			}
+		})
+	}
+	return &token, nil
+}
+
+// GetTokenByKeyHash 按保存的令牌哈希查找令牌，用于已经通过鉴权、只持有哈希的内部流程
+func GetTokenByKeyHash(hash string, fromDB bool) (token *Token, err error) {
 	defer func() {
 		// Update Redis cache asynchronously on successful DB read
 		if shouldUpdateRedis(fromDB, err) && token != nil {
@@ -272,21 +534,23 @@ func GetTokenByKey(key string, fromDB bool) (token *Token, err error) {
 	}()
 	if !fromDB && common.RedisEnabled {
 		// Try Redis first
-		token, err := cacheGetTokenByKey(key)
+		token, err := cacheGetTokenByKey(hash)
 		if err == nil {
 			return token, nil
 		}
 		// Don't return error - fall through to DB
 	}
 	fromDB = true
-	err = DB.Where(commonKeyCol+" = ?", key).First(&token).Error
+	err = DB.Where(commonKeyCol+" = ?", hash).First(&token).Error
 	return token, err
 }
 
+// Insert 保存新令牌。Key 为明文时只保存哈希与前缀
 func (token *Token) Insert() error {
-	var err error
-	err = DB.Create(token).Error
-	return err
+	if token.Key != "" && !IsHashedTokenKey(token.Key) {
+		token.SetKey(token.Key)
+	}
+	return DB.Create(token).Error
 }
 
 // Update Make sure your token's fields is completed, because this will update non-zero values
@@ -302,7 +566,9 @@ func (token *Token) Update() (err error) {
 		}
 	}()
 	err = DB.Model(token).Select("name", "status", "expired_time", "remain_quota", "unlimited_quota",
-		"model_limits_enabled", "model_limits", "allow_ips", "group", "cross_group_retry").Updates(token).Error
+		"model_limits_enabled", "model_limits", "allow_ips", "group", "cross_group_retry", "response_cache",
+		"daily_quota_limit", "weekly_quota_limit", "monthly_quota_limit", "rpm_limit",
+		"max_request_quota", "model_quota_limits").Updates(token).Error
 	return err
 }
 
@@ -480,14 +746,6 @@ func BatchDeleteTokens(ids []int, userId int) (int, error) {
 	return len(tokens), nil
 }
 
-func GetTokenKeysByIds(ids []int, userId int) ([]Token, error) {
-	var tokens []Token
-	err := DB.Select("id", commonKeyCol).
-		Where("user_id = ? AND id IN (?)", userId, ids).
-		Find(&tokens).Error
-	return tokens, err
-}
-
 // InvalidateUserTokensCache 清理指定用户所有令牌在 Redis 中的缓存，
 // 配合 InvalidateUserCache 使用，可在用户被禁用/删除时立即阻断其令牌的请求。
 // 下一次请求将从数据库重新加载令牌及用户状态，从而立即识别出被禁用的用户。
@@ -8,10 +8,16 @@ import (
 	"github.com/QuantumNous/new-api/constant"
 )
 
+// tokenCacheKey 传入的 key 为数据库中保存的令牌（哈希，或尚未迁移的明文），缓存键规则与以前一致，
+// 明文令牌迁移为哈希时删除旧的缓存
+func tokenCacheKey(key string) string {
+	return fmt.Sprintf("token:%s", common.GenerateHMAC(key))
+}
+
 func cacheSetToken(token Token) error {
-	key := common.GenerateHMAC(token.Key)
+	key := tokenCacheKey(token.Key)
 	token.Clean()
-	err := common.RedisHSetObj(fmt.Sprintf("token:%s", key), &token, time.Duration(common.RedisKeyCacheSeconds())*time.Second)
+	err := common.RedisHSetObj(key, &token, time.Duration(common.RedisKeyCacheSeconds())*time.Second)
 	if err != nil {
 		return err
 	}
@@ -19,8 +25,7 @@ func cacheSetToken(token Token) error {
 }
 
 func cacheDeleteToken(key string) error {
-	key = common.GenerateHMAC(key)
-	err := common.RedisDelKey(fmt.Sprintf("token:%s", key))
+	err := common.RedisDelKey(tokenCacheKey(key))
 	if err != nil {
 		return err
 	}
@@ -28,8 +33,7 @@ func cacheDeleteToken(key string) error {
 }
 
 func cacheIncrTokenQuota(key string, increment int64) error {
-	key = common.GenerateHMAC(key)
-	err := common.RedisHIncrBy(fmt.Sprintf("token:%s", key), constant.TokenFiledRemainQuota, increment)
+	err := common.RedisHIncrBy(tokenCacheKey(key), constant.TokenFiledRemainQuota, increment)
 	if err != nil {
 		return err
 	}
@@ -41,25 +45,31 @@ func cacheDecrTokenQuota(key string, decrement int64) error {
 }
 
 func cacheSetTokenField(key string, field string, value string) error {
-	key = common.GenerateHMAC(key)
-	err := common.RedisHSetField(fmt.Sprintf("token:%s", key), field, value)
+	err := common.RedisHSetField(tokenCacheKey(key), field, value)
 	if err != nil {
 		return err
 	}
 	return nil
 }
 
-// CacheGetTokenByKey 从缓存中获取 token，如果缓存中不存在，则从数据库中获取
-func cacheGetTokenByKey(key string) (*Token, error) {
-	hmacKey := common.GenerateHMAC(key)
+// cacheGetTokenByKey 按令牌哈希从缓存中获取 token，缓存中不保存 Key，取出后填回哈希
+func cacheGetTokenByKey(hash string) (*Token, error) {
 	if !common.RedisEnabled {
 		return nil, fmt.Errorf("redis is not enabled")
 	}
 	var token Token
-	err := common.RedisHGetObj(fmt.Sprintf("token:%s", hmacKey), &token)
+	err := common.RedisHGetObj(tokenCacheKey(hash), &token)
 	if err != nil {
 		return nil, err
 	}
-	token.Key = key
+	token.Key = hash
 	return &token, nil
 }
+
+// InvalidateTokenCache 同步删除令牌缓存，用于进程随即退出、无法等待异步清理的场景（如命令行工具）
+func InvalidateTokenCache(key string) error {
+	if !common.RedisEnabled {
+		return nil
+	}
+	return cacheDeleteToken(key)
+}
@@ -0,0 +1,40 @@
+package model
+
+import (
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// TokenSpendCounter 未启用 Redis 时令牌周期消费窗口的计数。保存在数据库中，
+// 重启后不会清零，多节点部署时共享同一份计数
+type TokenSpendCounter struct {
+	CounterKey string `json:"counter_key" gorm:"type:varchar(191);primaryKey"`
+	Value      int64  `json:"value" gorm:"default:0"`
+	ExpireAt   int64  `json:"expire_at" gorm:"bigint;index"`
+}
+
+// IncrTokenSpendCounter 原子地将 delta 计入计数并返回计入后的值。过期的计数视为 0 重新开始
+func IncrTokenSpendCounter(key string, delta int64, expireAt int64, now int64) (int64, error) {
+	var value int64
+	err := DB.Transaction(func(tx *gorm.DB) error {
+		counter := &TokenSpendCounter{CounterKey: key, Value: delta, ExpireAt: expireAt}
+		if err := tx.Clauses(clause.OnConflict{
+			Columns: []clause.Column{{Name: "counter_key"}},
+			DoUpdates: clause.Assignments(map[string]interface{}{
+				"value": gorm.Expr("CASE WHEN token_spend_counters.expire_at > ? THEN token_spend_counters.value + ? ELSE ? END",
+					now, delta, delta),
+				"expire_at": expireAt,
+			}),
+		}).Create(counter).Error; err != nil {
+			return err
+		}
+		return tx.Model(&TokenSpendCounter{}).Where("counter_key = ?", key).Pluck("value", &value).Error
+	})
+	return value, err
+}
+
+// DeleteExpiredTokenSpendCounters 清理已经结束的消费窗口的计数
+func DeleteExpiredTokenSpendCounters(now int64) (int64, error) {
+	result := DB.Where("expire_at <= ?", now).Delete(&TokenSpendCounter{})
+	return result.RowsAffected, result.Error
+}
@@ -0,0 +1,70 @@
+package model
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+)
+
+func resetLegacyTokenKeyCheck() {
+	legacyTokenKeysMigrated.Store(false)
+	legacyTokenKeysCheckedAt = time.Time{}
+}
+
+func TestGetTokenByKeyMigratesLegacyPlaintextKey(t *testing.T) {
+	truncateTables(t)
+	resetLegacyTokenKeyCheck()
+	legacyKey := "legacy1234plaintext5678"
+	require.NoError(t, DB.Create(&Token{Id: 1, UserId: 1, Key: legacyKey, Name: "legacy", Status: 1}).Error)
+
+	token, err := GetTokenByKey(legacyKey, false)
+	require.NoError(t, err)
+	require.Equal(t, 1, token.Id)
+	require.Equal(t, HashTokenKey(legacyKey), token.Key)
+
+	var stored Token
+	require.NoError(t, DB.First(&stored, 1).Error)
+	require.Equal(t, HashTokenKey(legacyKey), stored.Key)
+	require.Equal(t, "legacy12", stored.KeyPrefix)
+	require.Equal(t, "legacy12**********", stored.GetMaskedKey())
+
+	// 迁移后仍可用明文密钥鉴权，哈希本身不能当作密钥使用
+	token, err = GetTokenByKey(legacyKey, false)
+	require.NoError(t, err)
+	require.Equal(t, 1, token.Id)
+	_, err = GetTokenByKey(stored.Key, false)
+	require.ErrorIs(t, err, gorm.ErrRecordNotFound)
+
+	hashed, err := GetTokenByKeyHash(stored.Key, false)
+	require.NoError(t, err)
+	require.Equal(t, 1, hashed.Id)
+}
+
+func TestMigrateLegacyTokenKeysStopsPlaintextFallback(t *testing.T) {
+	truncateTables(t)
+	resetLegacyTokenKeyCheck()
+	require.NoError(t, DB.Create(&Token{Id: 1, UserId: 1, Key: "legacyaaaa1111", Name: "a", Status: 1}).Error)
+	require.NoError(t, DB.Create(&Token{Id: 2, UserId: 1, Key: "legacybbbb2222", Name: "b", Status: 1}).Error)
+	require.NoError(t, DB.Delete(&Token{}, 2).Error)
+	require.True(t, HasLegacyTokenKeys())
+
+	migrated, err := MigrateLegacyTokenKeys(context.Background(), 1)
+	require.NoError(t, err)
+	require.Equal(t, 2, migrated)
+	var stored []Token
+	require.NoError(t, DB.Unscoped().Order("id").Find(&stored).Error)
+	require.Equal(t, HashTokenKey("legacyaaaa1111"), stored[0].Key)
+	require.Equal(t, HashTokenKey("legacybbbb2222"), stored[1].Key)
+	require.False(t, HasLegacyTokenKeys())
+
+	// 迁移完成后不再按明文查找
+	require.NoError(t, DB.Create(&Token{Id: 3, UserId: 1, Key: "legacycccc3333", Name: "c", Status: 1}).Error)
+	_, err = GetTokenByKey("legacycccc3333", false)
+	require.ErrorIs(t, err, gorm.ErrRecordNotFound)
+	token, err := GetTokenByKey("legacyaaaa1111", false)
+	require.NoError(t, err)
+	require.Equal(t, 1, token.Id)
+}
@@ -149,6 +149,20 @@ func GetQuotaDataByUsername(username string, startTime int64, endTime int64) (qu
 	return quotaDatas, err
 }
 
+// GetQuotaDataByMembers 查询组织成员加入组织之后的用量；按小时汇总的数据以小时起点计时，
+// 成员加入当小时的用量不计入，避免包含加入之前的消耗
+func GetQuotaDataByMembers(members []OrganizationMemberScope, startTime int64, endTime int64) (quotaData []*QuotaData, err error) {
+	var quotaDatas []*QuotaData
+	condition, args := organizationMemberScopeCondition(members, "")
+	err = DB.Table("quota_data").
+		Select("user_id, username, model_name, created_at, sum(count) as count, sum(quota) as quota, sum(token_used) as token_used").
+		Where(condition, args...).
+		Where("created_at >= ? and created_at <= ?", startTime, endTime).
+		Group("user_id, username, model_name, created_at").
+		Find(&quotaDatas).Error
+	return quotaDatas, err
+}
+
 func GetQuotaDataByUserId(userId int, startTime int64, endTime int64) (quotaData []*QuotaData, err error) {
 	var quotaDatas []*QuotaData
 	// 从quota_data表中查询数据
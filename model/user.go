@@ -80,34 +80,26 @@ func (user *User) SetAccessToken(token string) {
 }
 
 func (user *User) GetSetting() dto.UserSetting {
-	setting := dto.UserSetting{}
-	if user.Setting != "" {
-		err := common.Unmarshal([]byte(user.Setting), &setting)
-		if err != nil {
-			common.SysLog("failed to unmarshal setting: " + err.Error())
-		}
-	}
-	return setting
+	return decodeUserSetting(user.Setting)
 }
 
 func (user *User) SetSetting(setting dto.UserSetting) {
-	settingBytes, err := common.Marshal(setting)
+	settingValue, err := encodeUserSetting(setting)
 	if err != nil {
 		common.SysLog("failed to marshal setting: " + err.Error())
 		return
 	}
-	user.Setting = string(settingBytes)
+	user.Setting = settingValue
 }
 
 func UpdateUserSetting(userId int, setting dto.UserSetting) error {
 	if userId == 0 {
 		return errors.New("id 为空！")
 	}
-	settingBytes, err := common.Marshal(setting)
+	settingValue, err := encodeUserSetting(setting)
 	if err != nil {
 		return err
 	}
-	settingValue := string(settingBytes)
 	if err = DB.Model(&User{}).Where("id = ?", userId).Update("setting", settingValue).Error; err != nil {
 		return err
 	}
@@ -1052,6 +1044,15 @@ func updateUserQuotaUsedQuotaAndRequestCount(id int, quota int, usedQuota int, r
 	}
 }
 
+// UpdateUserUsedQuota 只累加用户已用额度，不计入请求次数，用于同一请求内的附加扣费（如输入审核）
+func UpdateUserUsedQuota(id int, quota int) {
+	if common.BatchUpdateEnabled {
+		addNewRecord(BatchUpdateTypeUsedQuota, id, quota)
+		return
+	}
+	updateUserUsedQuota(id, quota)
+}
+
 func updateUserUsedQuota(id int, quota int) {
 	err := DB.Model(&User{}).Where("id = ?", id).Updates(
 		map[string]interface{}{
@@ -1070,6 +1071,13 @@ func updateUserRequestCount(id int, count int) {
 	}
 }
 
+// GetUserIdByUsername returns 0 when the user does not exist
+func GetUserIdByUsername(username string) (int, error) {
+	var id int
+	err := DB.Model(&User{}).Where("username = ?", username).Select("id").Limit(1).Find(&id).Error
+	return id, err
+}
+
 // GetUsernameById gets username from Redis first, falls back to DB if needed
 func GetUsernameById(id int, fromDB bool) (username string, err error) {
 	defer func() {
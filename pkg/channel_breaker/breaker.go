@@ -0,0 +1,298 @@
+// Package channelbreaker 实现按（渠道, 模型, 多 Key 下标）划分的熔断器。
+// 熔断器有 closed / open / half_open 三种状态：连续失败或窗口内失败率超过阈值时打开，
+// 打开一段时间后进入半开状态，放行少量真实请求试探，试探成功达到次数后关闭，失败则重新打开。
+// 启用 Redis 时打开状态会同步到 Redis，由各节点定期拉取，使熔断在多节点间共享。
+package channelbreaker
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/setting/operation_setting"
+)
+
+const (
+	StateClosed   = "closed"
+	StateOpen     = "open"
+	StateHalfOpen = "half_open"
+)
+
+type breakerKey struct {
+	channelId int
+	model     string
+	keyIndex  int
+}
+
+type breaker struct {
+	open                bool
+	openedAt            time.Time
+	openUntil           time.Time
+	consecutiveFailures int
+	windowStart         time.Time
+	requests            int64
+	failures            int64
+	probing             int // 半开状态下本节点正在进行的试探请求数
+	probeSuccesses      int
+}
+
+func (b *breaker) state(now time.Time) string {
+	if !b.open {
+		return StateClosed
+	}
+	if now.Before(b.openUntil) {
+		return StateOpen
+	}
+	return StateHalfOpen
+}
+
+// State 熔断器状态快照，供管理接口展示
+type State struct {
+	ChannelId           int     `json:"channel_id"`
+	Model               string  `json:"model"`
+	KeyIndex            int     `json:"key_index"`
+	State               string  `json:"state"`
+	ConsecutiveFailures int     `json:"consecutive_failures"`
+	WindowRequests      int64   `json:"window_requests"`
+	WindowFailures      int64   `json:"window_failures"`
+	ErrorRate           float64 `json:"error_rate"`
+	OpenedAt            int64   `json:"opened_at,omitempty"`
+	OpenUntil           int64   `json:"open_until,omitempty"`
+}
+
+var (
+	mu       sync.RWMutex
+	breakers = make(map[breakerKey]*breaker)
+	// openCount 记录每个渠道处于非关闭状态的熔断器数量，绝大多数渠道为 0，选择渠道时可以直接跳过
+	openCount = make(map[int]int)
+)
+
+// Enabled 是否开启了渠道熔断
+func Enabled() bool {
+	return operation_setting.GetChannelBreakerSetting().Enabled
+}
+
+// OpenKeys 返回渠道在 model 下当前不接受请求的 Key 下标：熔断打开中，或处于半开状态但试探名额已满。
+// 非多 Key 渠道的下标固定为 0
+func OpenKeys(channelId int, model string) map[int]bool {
+	if !Enabled() {
+		return nil
+	}
+	mu.RLock()
+	defer mu.RUnlock()
+	if openCount[channelId] == 0 {
+		return nil
+	}
+	maxProbes := operation_setting.GetChannelBreakerSetting().HalfOpenMaxRequests
+	if maxProbes <= 0 {
+		maxProbes = 1
+	}
+	now := time.Now()
+	var keys map[int]bool
+	for key, b := range breakers {
+		if key.channelId != channelId || key.model != model {
+			continue
+		}
+		switch b.state(now) {
+		case StateOpen:
+		case StateHalfOpen:
+			if b.probing < maxProbes {
+				continue
+			}
+		default:
+			continue
+		}
+		if keys == nil {
+			keys = make(map[int]bool)
+		}
+		keys[key.keyIndex] = true
+	}
+	return keys
+}
+
+// Begin 在向上游发起请求前调用，半开状态下占用一个试探名额，由 Record 释放
+func Begin(channelId int, model string, keyIndex int) {
+	if !Enabled() {
+		return
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if openCount[channelId] == 0 {
+		return
+	}
+	if b, ok := breakers[breakerKey{channelId: channelId, model: model, keyIndex: keyIndex}]; ok && b.state(time.Now()) == StateHalfOpen {
+		b.probing++
+	}
+}
+
+// Cancel 请求被主动取消时调用，只释放 Begin 占用的试探名额，结果不计入熔断统计
+func Cancel(channelId int, model string, keyIndex int) {
+	if !Enabled() {
+		return
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if b, ok := breakers[breakerKey{channelId: channelId, model: model, keyIndex: keyIndex}]; ok && b.probing > 0 {
+		b.probing--
+	}
+}
+
+// Record 记录一次请求结果并推进熔断器状态
+func Record(channelId int, model string, keyIndex int, success bool) {
+	if !Enabled() || channelId <= 0 {
+		return
+	}
+	setting := operation_setting.GetChannelBreakerSetting()
+	key := breakerKey{channelId: channelId, model: model, keyIndex: keyIndex}
+	now := time.Now()
+
+	mu.Lock()
+	b, ok := breakers[key]
+	if !ok {
+		b = &breaker{windowStart: now}
+		breakers[key] = b
+	}
+	var (
+		opened bool
+		closed bool
+		reason string
+	)
+	switch b.state(now) {
+	case StateOpen:
+		// 熔断打开前已发出的请求，结果不影响状态
+	case StateHalfOpen:
+		if b.probing > 0 {
+			b.probing--
+		}
+		if success {
+			b.probeSuccesses++
+			if b.probeSuccesses >= max(setting.HalfOpenSuccesses, 1) {
+				closeLocked(key, b, now)
+				closed = true
+			}
+		} else {
+			openLocked(key, b, now, setting)
+			opened = true
+			reason = "half-open probe failed"
+		}
+	default:
+		window := time.Duration(setting.WindowSeconds) * time.Second
+		if window <= 0 {
+			window = time.Minute
+		}
+		if now.Sub(b.windowStart) >= window {
+			b.windowStart = now
+			b.requests = 0
+			b.failures = 0
+		}
+		b.requests++
+		if success {
+			b.consecutiveFailures = 0
+			break
+		}
+		b.failures++
+		b.consecutiveFailures++
+		if setting.ConsecutiveFailures > 0 && b.consecutiveFailures >= setting.ConsecutiveFailures {
+			reason = fmt.Sprintf("%d consecutive failures", b.consecutiveFailures)
+		} else if setting.ErrorRateThreshold > 0 && b.requests >= int64(max(setting.MinRequests, 1)) &&
+			float64(b.failures)/float64(b.requests) >= setting.ErrorRateThreshold {
+			reason = fmt.Sprintf("error rate %.2f over %d requests", float64(b.failures)/float64(b.requests), b.requests)
+		}
+		if reason != "" {
+			openLocked(key, b, now, setting)
+			opened = true
+		}
+	}
+	openUntil := b.openUntil
+	mu.Unlock()
+
+	if opened {
+		common.SysLog(fmt.Sprintf("circuit breaker opened: channel #%d, model %s, key #%d, %s, until %s",
+			channelId, model, keyIndex, reason, openUntil.Format(time.RFC3339)))
+		publishOpen(key, openUntil)
+	} else if closed {
+		common.SysLog(fmt.Sprintf("circuit breaker closed: channel #%d, model %s, key #%d", channelId, model, keyIndex))
+		publishClose(key)
+	}
+}
+
+func openLocked(key breakerKey, b *breaker, now time.Time, setting *operation_setting.ChannelBreakerSetting) {
+	openSeconds := setting.OpenSeconds
+	if openSeconds <= 0 {
+		openSeconds = 30
+	}
+	if !b.open {
+		openCount[key.channelId]++
+	}
+	b.open = true
+	b.openedAt = now
+	b.openUntil = now.Add(time.Duration(openSeconds) * time.Second)
+	b.probing = 0
+	b.probeSuccesses = 0
+}
+
+func closeLocked(key breakerKey, b *breaker, now time.Time) {
+	if b.open {
+		if openCount[key.channelId]--; openCount[key.channelId] <= 0 {
+			delete(openCount, key.channelId)
+		}
+	}
+	*b = breaker{windowStart: now}
+}
+
+// States 返回渠道所有熔断器的状态，按模型与 Key 下标排序
+func States(channelId int) []State {
+	mu.RLock()
+	now := time.Now()
+	states := make([]State, 0)
+	for key, b := range breakers {
+		if key.channelId != channelId {
+			continue
+		}
+		state := State{
+			ChannelId:           key.channelId,
+			Model:               key.model,
+			KeyIndex:            key.keyIndex,
+			State:               b.state(now),
+			ConsecutiveFailures: b.consecutiveFailures,
+			WindowRequests:      b.requests,
+			WindowFailures:      b.failures,
+		}
+		if b.requests > 0 {
+			state.ErrorRate = float64(b.failures) / float64(b.requests)
+		}
+		if b.open {
+			state.OpenedAt = b.openedAt.Unix()
+			state.OpenUntil = b.openUntil.Unix()
+		}
+		states = append(states, state)
+	}
+	mu.RUnlock()
+
+	sort.Slice(states, func(i, j int) bool {
+		if states[i].Model != states[j].Model {
+			return states[i].Model < states[j].Model
+		}
+		return states[i].KeyIndex < states[j].KeyIndex
+	})
+	return states
+}
+
+// Reset 关闭并清空渠道的所有熔断器，返回清除的数量
+func Reset(channelId int) int {
+	mu.Lock()
+	keys := make([]breakerKey, 0)
+	for key := range breakers {
+		if key.channelId == channelId {
+			keys = append(keys, key)
+			delete(breakers, key)
+		}
+	}
+	delete(openCount, channelId)
+	mu.Unlock()
+
+	clearShared(channelId)
+	return len(keys)
+}
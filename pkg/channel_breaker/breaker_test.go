@@ -0,0 +1,114 @@
+package channelbreaker
+
+import (
+	"testing"
+	"time"
+
+	"github.com/QuantumNous/new-api/setting/operation_setting"
+	"github.com/stretchr/testify/require"
+)
+
+func setupBreaker(t *testing.T) *operation_setting.ChannelBreakerSetting {
+	t.Helper()
+	setting := operation_setting.GetChannelBreakerSetting()
+	saved := *setting
+	setting.Enabled = true
+	setting.ConsecutiveFailures = 3
+	setting.ErrorRateThreshold = 0.5
+	setting.MinRequests = 10
+	setting.WindowSeconds = 60
+	setting.OpenSeconds = 30
+	setting.HalfOpenMaxRequests = 1
+	setting.HalfOpenSuccesses = 2
+	t.Cleanup(func() {
+		*setting = saved
+		mu.Lock()
+		breakers = make(map[breakerKey]*breaker)
+		openCount = make(map[int]int)
+		mu.Unlock()
+	})
+	return setting
+}
+
+// expireOpen 将熔断器的打开时间提前，使其进入半开状态
+func expireOpen(channelId int, model string, keyIndex int) {
+	mu.Lock()
+	defer mu.Unlock()
+	breakers[breakerKey{channelId: channelId, model: model, keyIndex: keyIndex}].openUntil = time.Now().Add(-time.Second)
+}
+
+func TestBreakerConsecutiveFailuresAndHalfOpen(t *testing.T) {
+	setupBreaker(t)
+
+	Record(1, "gpt-a", 0, false)
+	Record(1, "gpt-a", 0, false)
+	require.Empty(t, OpenKeys(1, "gpt-a"))
+	Record(1, "gpt-a", 0, false)
+	require.True(t, OpenKeys(1, "gpt-a")[0])
+	// 其他模型不受影响
+	require.Empty(t, OpenKeys(1, "gpt-b"))
+
+	// 半开后放行一个试探请求，名额占满后不再放行
+	expireOpen(1, "gpt-a", 0)
+	require.Empty(t, OpenKeys(1, "gpt-a"))
+	Begin(1, "gpt-a", 0)
+	require.True(t, OpenKeys(1, "gpt-a")[0])
+
+	// 试探失败重新打开
+	Record(1, "gpt-a", 0, false)
+	states := States(1)
+	require.Len(t, states, 1)
+	require.Equal(t, StateOpen, states[0].State)
+
+	// 连续两次试探成功后关闭
+	expireOpen(1, "gpt-a", 0)
+	Begin(1, "gpt-a", 0)
+	Record(1, "gpt-a", 0, true)
+	require.Equal(t, StateHalfOpen, States(1)[0].State)
+	Begin(1, "gpt-a", 0)
+	Record(1, "gpt-a", 0, true)
+	require.Equal(t, StateClosed, States(1)[0].State)
+	require.Empty(t, OpenKeys(1, "gpt-a"))
+}
+
+func TestBreakerErrorRate(t *testing.T) {
+	setupBreaker(t)
+
+	for i := 0; i < 9; i++ {
+		Record(2, "gpt-a", 1, i%2 == 0)
+	}
+	require.Empty(t, OpenKeys(2, "gpt-a"))
+	Record(2, "gpt-a", 1, false)
+	require.Equal(t, map[int]bool{1: true}, OpenKeys(2, "gpt-a"))
+
+	require.Equal(t, 1, Reset(2))
+	require.Empty(t, OpenKeys(2, "gpt-a"))
+	require.Empty(t, States(2))
+}
+
+func TestBreakerApplyRemoteStates(t *testing.T) {
+	setupBreaker(t)
+	now := time.Now()
+	key := breakerKey{channelId: 3, model: "gpt-a", keyIndex: 0}
+
+	applyRemoteStates(map[breakerKey]time.Time{key: now.Add(time.Minute)}, now)
+	require.True(t, OpenKeys(3, "gpt-a")[0])
+
+	// 刚打开的熔断器不会因为 Redis 中暂时缺失而关闭
+	applyRemoteStates(map[breakerKey]time.Time{}, now)
+	require.True(t, OpenKeys(3, "gpt-a")[0])
+
+	// 其他节点关闭后，本地同步关闭
+	applyRemoteStates(map[breakerKey]time.Time{}, now.Add(syncGracePeriod))
+	require.Empty(t, OpenKeys(3, "gpt-a"))
+}
+
+func TestBreakerDisabled(t *testing.T) {
+	setting := setupBreaker(t)
+	setting.Enabled = false
+	for i := 0; i < 5; i++ {
+		Record(4, "gpt-a", 0, false)
+	}
+	require.Empty(t, OpenKeys(4, "gpt-a"))
+	require.Empty(t, States(4))
+}
@@ -0,0 +1,153 @@
+package channelbreaker
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/setting/operation_setting"
+)
+
+// 打开中的熔断器保存在同一个 Redis hash 中：field 为 "渠道:Key下标:模型"，value 为恢复试探的 unix 时间
+const (
+	redisOpenHashKey = "channel_breaker:open"
+	redisTimeout     = time.Second
+	syncInterval     = 2 * time.Second
+	// 本节点刚打开的熔断器在这段时间内不会因 Redis 中暂时缺失而被关闭，避免与写入竞争
+	syncGracePeriod = 5 * time.Second
+)
+
+// Init 启用 Redis 时启动后台同步，定期拉取其他节点打开或关闭的熔断器
+func Init() {
+	go func() {
+		for {
+			time.Sleep(syncInterval)
+			if Enabled() && redisEnabled() {
+				syncFromRedis()
+			}
+		}
+	}()
+}
+
+func redisEnabled() bool {
+	return common.RedisEnabled && common.RDB != nil
+}
+
+func redisField(key breakerKey) string {
+	return fmt.Sprintf("%d:%d:%s", key.channelId, key.keyIndex, key.model)
+}
+
+func parseRedisField(field string) (breakerKey, bool) {
+	parts := strings.SplitN(field, ":", 3)
+	if len(parts) != 3 {
+		return breakerKey{}, false
+	}
+	channelId, err := strconv.Atoi(parts[0])
+	if err != nil {
+		return breakerKey{}, false
+	}
+	keyIndex, err := strconv.Atoi(parts[1])
+	if err != nil {
+		return breakerKey{}, false
+	}
+	return breakerKey{channelId: channelId, model: parts[2], keyIndex: keyIndex}, true
+}
+
+func publishOpen(key breakerKey, openUntil time.Time) {
+	if !redisEnabled() {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), redisTimeout)
+	defer cancel()
+	if err := common.RDB.HSet(ctx, redisOpenHashKey, redisField(key), openUntil.Unix()).Err(); err != nil {
+		common.SysError("failed to publish circuit breaker state: " + err.Error())
+	}
+}
+
+func publishClose(key breakerKey) {
+	if !redisEnabled() {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), redisTimeout)
+	defer cancel()
+	if err := common.RDB.HDel(ctx, redisOpenHashKey, redisField(key)).Err(); err != nil {
+		common.SysError("failed to publish circuit breaker state: " + err.Error())
+	}
+}
+
+// clearShared 删除 Redis 中渠道的所有熔断记录，包括本节点没有的
+func clearShared(channelId int) {
+	if !redisEnabled() {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), redisTimeout)
+	defer cancel()
+	fields, err := common.RDB.HKeys(ctx, redisOpenHashKey).Result()
+	if err != nil {
+		common.SysError("failed to clear circuit breaker state: " + err.Error())
+		return
+	}
+	prefix := strconv.Itoa(channelId) + ":"
+	toDelete := make([]string, 0)
+	for _, field := range fields {
+		if strings.HasPrefix(field, prefix) {
+			toDelete = append(toDelete, field)
+		}
+	}
+	if len(toDelete) > 0 {
+		_ = common.RDB.HDel(ctx, redisOpenHashKey, toDelete...).Err()
+	}
+}
+
+func syncFromRedis() {
+	ctx, cancel := context.WithTimeout(context.Background(), redisTimeout)
+	defer cancel()
+	values, err := common.RDB.HGetAll(ctx, redisOpenHashKey).Result()
+	if err != nil {
+		return
+	}
+	remote := make(map[breakerKey]time.Time, len(values))
+	for field, value := range values {
+		key, ok := parseRedisField(field)
+		if !ok {
+			continue
+		}
+		until, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			continue
+		}
+		remote[key] = time.Unix(until, 0)
+	}
+	applyRemoteStates(remote, time.Now())
+}
+
+// applyRemoteStates 以 Redis 中的记录为准合并本地熔断器：
+// 其他节点打开（或重新打开）的熔断器在本地同样打开，已被其他节点关闭的在本地关闭
+func applyRemoteStates(remote map[breakerKey]time.Time, now time.Time) {
+	setting := operation_setting.GetChannelBreakerSetting()
+	mu.Lock()
+	defer mu.Unlock()
+	for key, until := range remote {
+		b, ok := breakers[key]
+		if !ok {
+			b = &breaker{windowStart: now}
+			breakers[key] = b
+		}
+		if b.open && !until.After(b.openUntil) {
+			continue
+		}
+		openLocked(key, b, now, setting)
+		b.openUntil = until
+	}
+	for key, b := range breakers {
+		if !b.open || now.Sub(b.openedAt) < syncGracePeriod {
+			continue
+		}
+		if _, ok := remote[key]; !ok {
+			closeLocked(key, b, now)
+		}
+	}
+}
@@ -0,0 +1,215 @@
+// Package channelcooldown 根据上游返回的限流响应头让渠道（多 Key 渠道为单个 Key）暂时冷却。
+// 上游返回 429 时按 Retry-After 或已用完维度的恢复时间冷却；请求成功但剩余额度过低时提前冷却，
+// 把流量引向其他渠道。冷却中的渠道与 Key 在选择渠道、轮询 Key 时被跳过，到期后自动恢复。
+// 启用 Redis 时冷却状态会同步到 Redis，由各节点定期拉取，使冷却在多节点间共享。
+package channelcooldown
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/setting/operation_setting"
+)
+
+const (
+	ReasonRateLimited  = "rate_limited"
+	ReasonLowRemaining = "low_remaining"
+)
+
+type cooldown struct {
+	reason    string
+	startedAt time.Time
+	until     time.Time
+}
+
+// State 冷却状态快照，供管理接口展示
+type State struct {
+	ChannelId int    `json:"channel_id"`
+	KeyIndex  int    `json:"key_index"`
+	Reason    string `json:"reason"`
+	StartedAt int64  `json:"started_at"`
+	Until     int64  `json:"until"`
+	Remaining int64  `json:"remaining_seconds"`
+}
+
+var (
+	mu sync.RWMutex
+	// cooldowns 渠道 -> Key 下标 -> 冷却，非多 Key 渠道的下标固定为 0；过期的记录在写入与同步时清理
+	cooldowns = make(map[int]map[int]*cooldown)
+)
+
+// Enabled 是否开启了上游限流冷却
+func Enabled() bool {
+	return operation_setting.GetChannelCooldownSetting().Enabled
+}
+
+// CoolingKeys 返回渠道当前冷却中的 Key 下标，非多 Key 渠道的下标固定为 0
+func CoolingKeys(channelId int) map[int]bool {
+	if !Enabled() {
+		return nil
+	}
+	mu.RLock()
+	defer mu.RUnlock()
+	keys := cooldowns[channelId]
+	if len(keys) == 0 {
+		return nil
+	}
+	now := time.Now()
+	var cooling map[int]bool
+	for keyIndex, cd := range keys {
+		if now.Before(cd.until) {
+			if cooling == nil {
+				cooling = make(map[int]bool, len(keys))
+			}
+			cooling[keyIndex] = true
+		}
+	}
+	return cooling
+}
+
+// Observe 根据一次上游响应的状态码与响应头决定是否冷却：429 时按 Retry-After、已用完维度的恢复时间或默认时长冷却；
+// 请求成功且开启了提前冷却时，任一维度的剩余比例过低则冷却到该维度恢复
+func Observe(channelId int, keyIndex int, statusCode int, header http.Header) {
+	if !Enabled() || channelId <= 0 {
+		return
+	}
+	setting := operation_setting.GetChannelCooldownSetting()
+	now := time.Now()
+	rl := ParseRateLimitHeaders(header, now)
+
+	if statusCode == http.StatusTooManyRequests {
+		wait := rl.RetryAfter
+		if wait <= 0 {
+			wait = rl.ExhaustedReset()
+		}
+		if wait <= 0 {
+			wait = time.Duration(setting.DefaultCooldownSeconds) * time.Second
+		}
+		set(channelId, keyIndex, clampWait(wait, setting.MaxCooldownSeconds), ReasonRateLimited, now)
+		return
+	}
+	if statusCode < 200 || statusCode >= 300 || !setting.ProactiveEnabled || setting.LowRemainingRatio <= 0 {
+		return
+	}
+	var wait time.Duration
+	var exhausted string
+	for _, dim := range rl.Dimensions {
+		ratio := dim.RemainingRatio()
+		if ratio < 0 || ratio > setting.LowRemainingRatio || dim.Reset <= wait {
+			continue
+		}
+		wait = dim.Reset
+		exhausted = dim.Name
+	}
+	if wait > 0 {
+		set(channelId, keyIndex, clampWait(wait, setting.ProactiveMaxSeconds), ReasonLowRemaining+":"+exhausted, now)
+	}
+}
+
+// Set 手动让渠道的某个 Key 冷却一段时间
+func Set(channelId int, keyIndex int, wait time.Duration, reason string) {
+	set(channelId, keyIndex, wait, reason, time.Now())
+}
+
+func set(channelId int, keyIndex int, wait time.Duration, reason string, now time.Time) {
+	if wait <= 0 {
+		return
+	}
+	until := now.Add(wait)
+	mu.Lock()
+	if !setLocked(channelId, keyIndex, reason, now, until) {
+		mu.Unlock()
+		return
+	}
+	mu.Unlock()
+
+	common.SysLog(fmt.Sprintf("channel #%d key #%d cooling down for %s (%s)", channelId, keyIndex, wait.Round(time.Millisecond), reason))
+	publishCooldown(channelId, keyIndex, reason, until)
+}
+
+// setLocked 只延长不缩短已有的冷却，返回是否有变化
+func setLocked(channelId int, keyIndex int, reason string, now time.Time, until time.Time) bool {
+	keys, ok := cooldowns[channelId]
+	if !ok {
+		keys = make(map[int]*cooldown)
+		cooldowns[channelId] = keys
+	}
+	if cd, ok := keys[keyIndex]; ok && now.Before(cd.until) {
+		if !until.After(cd.until) {
+			return false
+		}
+		cd.until = until
+		cd.reason = reason
+		return true
+	}
+	keys[keyIndex] = &cooldown{reason: reason, startedAt: now, until: until}
+	pruneLocked(now)
+	return true
+}
+
+func pruneLocked(now time.Time) {
+	for channelId, keys := range cooldowns {
+		for keyIndex, cd := range keys {
+			if !now.Before(cd.until) {
+				delete(keys, keyIndex)
+			}
+		}
+		if len(keys) == 0 {
+			delete(cooldowns, channelId)
+		}
+	}
+}
+
+// States 返回渠道当前冷却中的 Key，按 Key 下标排序
+func States(channelId int) []State {
+	mu.RLock()
+	now := time.Now()
+	states := make([]State, 0)
+	for keyIndex, cd := range cooldowns[channelId] {
+		if !now.Before(cd.until) {
+			continue
+		}
+		states = append(states, State{
+			ChannelId: channelId,
+			KeyIndex:  keyIndex,
+			Reason:    cd.reason,
+			StartedAt: cd.startedAt.Unix(),
+			Until:     cd.until.Unix(),
+			Remaining: int64(cd.until.Sub(now).Seconds() + 0.999),
+		})
+	}
+	mu.RUnlock()
+
+	sort.Slice(states, func(i, j int) bool {
+		return states[i].KeyIndex < states[j].KeyIndex
+	})
+	return states
+}
+
+// Clear 结束渠道的所有冷却，返回清除的数量
+func Clear(channelId int) int {
+	mu.Lock()
+	now := time.Now()
+	count := 0
+	for _, cd := range cooldowns[channelId] {
+		if now.Before(cd.until) {
+			count++
+		}
+	}
+	delete(cooldowns, channelId)
+	mu.Unlock()
+
+	clearShared(channelId)
+	return count
+}
+
+func clampWait(wait time.Duration, maxSeconds int) time.Duration {
+	if maxSeconds > 0 {
+		wait = min(wait, time.Duration(maxSeconds)*time.Second)
+	}
+	return wait
+}
@@ -0,0 +1,137 @@
+package channelcooldown
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/QuantumNous/new-api/setting/operation_setting"
+	"github.com/stretchr/testify/require"
+)
+
+func setupCooldown(t *testing.T) *operation_setting.ChannelCooldownSetting {
+	t.Helper()
+	setting := operation_setting.GetChannelCooldownSetting()
+	saved := *setting
+	setting.Enabled = true
+	setting.DefaultCooldownSeconds = 10
+	setting.MaxCooldownSeconds = 300
+	setting.ProactiveEnabled = true
+	setting.LowRemainingRatio = 0.05
+	setting.ProactiveMaxSeconds = 60
+	t.Cleanup(func() {
+		*setting = saved
+		mu.Lock()
+		cooldowns = make(map[int]map[int]*cooldown)
+		mu.Unlock()
+	})
+	return setting
+}
+
+func untilOf(t *testing.T, channelId int, keyIndex int) time.Duration {
+	t.Helper()
+	mu.RLock()
+	defer mu.RUnlock()
+	cd, ok := cooldowns[channelId][keyIndex]
+	require.True(t, ok)
+	return time.Until(cd.until)
+}
+
+func TestParseRateLimitHeaders(t *testing.T) {
+	now := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	header := http.Header{}
+	header.Set("Retry-After", now.Add(30*time.Second).Format(http.TimeFormat))
+	header.Set("x-ratelimit-limit-requests", "500")
+	header.Set("x-ratelimit-remaining-requests", "0")
+	header.Set("x-ratelimit-reset-requests", "6m0s")
+	header.Set("x-ratelimit-remaining-tokens", "1200")
+	header.Set("x-ratelimit-reset-tokens", "20ms")
+	header.Set("anthropic-ratelimit-input-tokens-limit", "40000")
+	header.Set("anthropic-ratelimit-input-tokens-remaining", "100")
+	header.Set("anthropic-ratelimit-input-tokens-reset", now.Add(15*time.Second).Format(time.RFC3339))
+
+	rl := ParseRateLimitHeaders(header, now)
+	require.Equal(t, 30*time.Second, rl.RetryAfter)
+	require.Len(t, rl.Dimensions, 3)
+	require.Equal(t, Dimension{Name: "requests", Limit: 500, Remaining: 0, Reset: 6 * time.Minute}, rl.Dimensions[0])
+	require.Equal(t, Dimension{Name: "tokens", Limit: -1, Remaining: 1200, Reset: 20 * time.Millisecond}, rl.Dimensions[1])
+	require.Equal(t, "input_tokens", rl.Dimensions[2].Name)
+	require.Equal(t, 15*time.Second, rl.Dimensions[2].Reset)
+	require.Equal(t, 6*time.Minute, rl.ExhaustedReset())
+
+	header = http.Header{}
+	header.Set("retry-after-ms", "1500")
+	header.Set("Retry-After", "2")
+	require.Equal(t, 1500*time.Millisecond, ParseRateLimitHeaders(header, now).RetryAfter)
+}
+
+func TestObserveRateLimited(t *testing.T) {
+	setupCooldown(t)
+
+	header := http.Header{}
+	header.Set("Retry-After", "20")
+	Observe(1, 2, http.StatusTooManyRequests, header)
+	require.Equal(t, map[int]bool{2: true}, CoolingKeys(1))
+	require.InDelta(t, 20, untilOf(t, 1, 2).Seconds(), 1)
+
+	// 没有恢复时间时按默认时长冷却，不缩短已有的冷却
+	Observe(1, 2, http.StatusTooManyRequests, http.Header{})
+	require.InDelta(t, 20, untilOf(t, 1, 2).Seconds(), 1)
+	Observe(1, 0, http.StatusTooManyRequests, http.Header{})
+	require.InDelta(t, 10, untilOf(t, 1, 0).Seconds(), 1)
+
+	// 超过上限的恢复时间被截断
+	header.Set("Retry-After", "3600")
+	Observe(3, 0, http.StatusTooManyRequests, header)
+	require.InDelta(t, 300, untilOf(t, 3, 0).Seconds(), 1)
+
+	states := States(1)
+	require.Len(t, states, 2)
+	require.Equal(t, 0, states[0].KeyIndex)
+	require.Equal(t, ReasonRateLimited, states[1].Reason)
+
+	require.Equal(t, 2, Clear(1))
+	require.Empty(t, CoolingKeys(1))
+}
+
+func TestObserveLowRemaining(t *testing.T) {
+	setting := setupCooldown(t)
+
+	header := http.Header{}
+	header.Set("x-ratelimit-limit-tokens", "100000")
+	header.Set("x-ratelimit-remaining-tokens", "90000")
+	header.Set("x-ratelimit-reset-tokens", "30s")
+	Observe(5, 0, http.StatusOK, header)
+	require.Empty(t, CoolingKeys(5))
+
+	header.Set("x-ratelimit-remaining-tokens", "2000")
+	Observe(5, 0, http.StatusOK, header)
+	require.Equal(t, map[int]bool{0: true}, CoolingKeys(5))
+	require.Equal(t, ReasonLowRemaining+":tokens", States(5)[0].Reason)
+
+	header.Set("x-ratelimit-reset-tokens", "10m")
+	Observe(6, 0, http.StatusOK, header)
+	require.InDelta(t, 60, untilOf(t, 6, 0).Seconds(), 1)
+
+	setting.ProactiveEnabled = false
+	Observe(7, 0, http.StatusOK, header)
+	require.Empty(t, CoolingKeys(7))
+
+	setting.Enabled = false
+	Observe(8, 0, http.StatusTooManyRequests, http.Header{})
+	require.Nil(t, CoolingKeys(8))
+}
+
+func TestCooldownApplyRemoteStates(t *testing.T) {
+	setupCooldown(t)
+	now := time.Now()
+
+	applyRemoteStates(map[cooldownKey]remoteCooldown{
+		{channelId: 9, keyIndex: 1}: {reason: ReasonRateLimited, until: now.Add(time.Minute)},
+	}, now)
+	require.Equal(t, map[int]bool{1: true}, CoolingKeys(9))
+
+	// 其他节点已结束的冷却在宽限期过后于本地结束
+	applyRemoteStates(map[cooldownKey]remoteCooldown{}, now.Add(syncGracePeriod))
+	require.Empty(t, CoolingKeys(9))
+}
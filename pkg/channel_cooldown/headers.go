@@ -0,0 +1,143 @@
+package channelcooldown
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Dimension 一个限流维度（请求数、tokens 等）的额度快照，缺失的数值为 -1，Reset 为 0 表示未知
+type Dimension struct {
+	Name      string
+	Limit     int64
+	Remaining int64
+	Reset     time.Duration
+}
+
+// Exhausted 剩余额度已经用完
+func (d Dimension) Exhausted() bool {
+	return d.Remaining == 0
+}
+
+// RemainingRatio 剩余额度占总额度的比例，无法计算时返回 -1
+func (d Dimension) RemainingRatio() float64 {
+	if d.Limit <= 0 || d.Remaining < 0 {
+		return -1
+	}
+	return float64(d.Remaining) / float64(d.Limit)
+}
+
+// RateLimit 从上游响应头中解析出的限流信息
+type RateLimit struct {
+	RetryAfter time.Duration
+	Dimensions []Dimension
+}
+
+// openaiDimensions OpenAI 兼容接口的 x-ratelimit-{limit,remaining,reset}-{维度}
+var openaiDimensions = []string{"requests", "tokens"}
+
+// anthropicDimensions Anthropic 的 anthropic-ratelimit-{维度}-{limit,remaining,reset}
+var anthropicDimensions = []string{"requests", "tokens", "input-tokens", "output-tokens"}
+
+// ParseRateLimitHeaders 解析 Retry-After / retry-after-ms、x-ratelimit-* 与 anthropic-ratelimit-* 响应头
+func ParseRateLimitHeaders(header http.Header, now time.Time) RateLimit {
+	var rl RateLimit
+	if header == nil {
+		return rl
+	}
+	if ms := header.Get("retry-after-ms"); ms != "" {
+		if v, err := strconv.ParseFloat(strings.TrimSpace(ms), 64); err == nil && v > 0 {
+			rl.RetryAfter = time.Duration(v * float64(time.Millisecond))
+		}
+	}
+	if rl.RetryAfter <= 0 {
+		rl.RetryAfter = parseRetryAfter(header.Get("Retry-After"), now)
+	}
+	for _, name := range openaiDimensions {
+		dim := Dimension{
+			Name:      name,
+			Limit:     parseCount(header.Get("x-ratelimit-limit-" + name)),
+			Remaining: parseCount(header.Get("x-ratelimit-remaining-" + name)),
+			Reset:     parseResetDuration(header.Get("x-ratelimit-reset-"+name), now),
+		}
+		if dim.Limit >= 0 || dim.Remaining >= 0 {
+			rl.Dimensions = append(rl.Dimensions, dim)
+		}
+	}
+	for _, name := range anthropicDimensions {
+		prefix := "anthropic-ratelimit-" + name + "-"
+		dim := Dimension{
+			Name:      strings.ReplaceAll(name, "-", "_"),
+			Limit:     parseCount(header.Get(prefix + "limit")),
+			Remaining: parseCount(header.Get(prefix + "remaining")),
+			Reset:     parseResetDuration(header.Get(prefix+"reset"), now),
+		}
+		if dim.Limit >= 0 || dim.Remaining >= 0 {
+			rl.Dimensions = append(rl.Dimensions, dim)
+		}
+	}
+	return rl
+}
+
+// ExhaustedReset 返回已用完额度的维度中最晚的恢复时间
+func (rl RateLimit) ExhaustedReset() time.Duration {
+	var wait time.Duration
+	for _, dim := range rl.Dimensions {
+		if dim.Exhausted() && dim.Reset > wait {
+			wait = dim.Reset
+		}
+	}
+	return wait
+}
+
+// parseRetryAfter Retry-After 可以是秒数或 HTTP 日期
+func parseRetryAfter(value string, now time.Time) time.Duration {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return 0
+	}
+	if seconds, err := strconv.ParseFloat(value, 64); err == nil {
+		if seconds <= 0 {
+			return 0
+		}
+		return time.Duration(seconds * float64(time.Second))
+	}
+	if at, err := http.ParseTime(value); err == nil && at.After(now) {
+		return at.Sub(now)
+	}
+	return 0
+}
+
+// parseResetDuration 恢复时间可以是 Go 风格的时长（OpenAI 的 "6m0s"、"20ms"）、秒数或 RFC 3339 时间（Anthropic）
+func parseResetDuration(value string, now time.Time) time.Duration {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return 0
+	}
+	if seconds, err := strconv.ParseFloat(value, 64); err == nil {
+		if seconds <= 0 {
+			return 0
+		}
+		return time.Duration(seconds * float64(time.Second))
+	}
+	if d, err := time.ParseDuration(value); err == nil {
+		return max(d, 0)
+	}
+	if at, err := time.Parse(time.RFC3339, value); err == nil && at.After(now) {
+		return at.Sub(now)
+	}
+	return 0
+}
+
+func parseCount(value string) int64 {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return -1
+	}
+	n, err := strconv.ParseInt(value, 10, 64)
+	if err != nil || n < 0 {
+		return -1
+	}
+	return n
+}
@@ -0,0 +1,158 @@
+package channelcooldown
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+)
+
+// 冷却中的 Key 保存在同一个 Redis hash 中：field 为 "渠道:Key下标"，value 为 "结束的 unix 毫秒:原因"
+const (
+	redisCooldownHashKey = "channel_cooldown:active"
+	redisTimeout         = time.Second
+	syncInterval         = 2 * time.Second
+	// 本节点刚开始的冷却在这段时间内不会因 Redis 中暂时缺失而被结束，避免与写入竞争
+	syncGracePeriod = 5 * time.Second
+)
+
+type remoteCooldown struct {
+	reason string
+	until  time.Time
+}
+
+type cooldownKey struct {
+	channelId int
+	keyIndex  int
+}
+
+// Init 启用 Redis 时启动后台同步，定期拉取其他节点开始或结束的冷却
+func Init() {
+	go func() {
+		for {
+			time.Sleep(syncInterval)
+			if Enabled() && redisEnabled() {
+				syncFromRedis()
+			}
+		}
+	}()
+}
+
+func redisEnabled() bool {
+	return common.RedisEnabled && common.RDB != nil
+}
+
+func redisField(channelId int, keyIndex int) string {
+	return fmt.Sprintf("%d:%d", channelId, keyIndex)
+}
+
+func parseRedisField(field string) (cooldownKey, bool) {
+	channelPart, keyPart, ok := strings.Cut(field, ":")
+	if !ok {
+		return cooldownKey{}, false
+	}
+	channelId, err := strconv.Atoi(channelPart)
+	if err != nil {
+		return cooldownKey{}, false
+	}
+	keyIndex, err := strconv.Atoi(keyPart)
+	if err != nil {
+		return cooldownKey{}, false
+	}
+	return cooldownKey{channelId: channelId, keyIndex: keyIndex}, true
+}
+
+func publishCooldown(channelId int, keyIndex int, reason string, until time.Time) {
+	if !redisEnabled() {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), redisTimeout)
+	defer cancel()
+	value := fmt.Sprintf("%d:%s", until.UnixMilli(), reason)
+	if err := common.RDB.HSet(ctx, redisCooldownHashKey, redisField(channelId, keyIndex), value).Err(); err != nil {
+		common.SysError("failed to publish channel cooldown: " + err.Error())
+	}
+}
+
+// clearShared 删除 Redis 中渠道的所有冷却记录，包括本节点没有的
+func clearShared(channelId int) {
+	if !redisEnabled() {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), redisTimeout)
+	defer cancel()
+	fields, err := common.RDB.HKeys(ctx, redisCooldownHashKey).Result()
+	if err != nil {
+		common.SysError("failed to clear channel cooldown: " + err.Error())
+		return
+	}
+	prefix := strconv.Itoa(channelId) + ":"
+	toDelete := make([]string, 0)
+	for _, field := range fields {
+		if strings.HasPrefix(field, prefix) {
+			toDelete = append(toDelete, field)
+		}
+	}
+	if len(toDelete) > 0 {
+		_ = common.RDB.HDel(ctx, redisCooldownHashKey, toDelete...).Err()
+	}
+}
+
+func syncFromRedis() {
+	ctx, cancel := context.WithTimeout(context.Background(), redisTimeout)
+	defer cancel()
+	values, err := common.RDB.HGetAll(ctx, redisCooldownHashKey).Result()
+	if err != nil {
+		return
+	}
+	now := time.Now()
+	remote := make(map[cooldownKey]remoteCooldown, len(values))
+	expired := make([]string, 0)
+	for field, value := range values {
+		key, ok := parseRedisField(field)
+		if !ok {
+			continue
+		}
+		untilPart, reason, _ := strings.Cut(value, ":")
+		untilMilli, err := strconv.ParseInt(untilPart, 10, 64)
+		if err != nil {
+			continue
+		}
+		until := time.UnixMilli(untilMilli)
+		if !now.Before(until) {
+			expired = append(expired, field)
+			continue
+		}
+		remote[key] = remoteCooldown{reason: reason, until: until}
+	}
+	if len(expired) > 0 {
+		_ = common.RDB.HDel(ctx, redisCooldownHashKey, expired...).Err()
+	}
+	applyRemoteStates(remote, now)
+}
+
+// applyRemoteStates 以 Redis 中的记录为准合并本地冷却：其他节点开始（或延长）的冷却在本地同样生效，
+// 已被其他节点结束的在本地结束
+func applyRemoteStates(remote map[cooldownKey]remoteCooldown, now time.Time) {
+	mu.Lock()
+	defer mu.Unlock()
+	for key, rc := range remote {
+		setLocked(key.channelId, key.keyIndex, rc.reason, now, rc.until)
+	}
+	for channelId, keys := range cooldowns {
+		for keyIndex, cd := range keys {
+			if now.Sub(cd.startedAt) < syncGracePeriod {
+				continue
+			}
+			if _, ok := remote[cooldownKey{channelId: channelId, keyIndex: keyIndex}]; !ok {
+				delete(keys, keyIndex)
+			}
+		}
+		if len(keys) == 0 {
+			delete(cooldowns, channelId)
+		}
+	}
+}
@@ -0,0 +1,165 @@
+// Package channelperf 按渠道、模型统计最近一段时间内每次转发尝试的延迟、首字时间与成功率，以及渠道当前的并发请求数，
+// 供渠道路由策略实时读取。与 pkg/perf_metrics 按模型、分组汇总的长期指标不同，这里的数据只保存在本机内存。
+package channelperf
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	slotSeconds = 60
+	// 最多保留一小时的分钟级数据，更长的统计窗口按一小时处理
+	maxSlots = 60
+)
+
+type windowKey struct {
+	channelId int
+	model     string
+}
+
+type slot struct {
+	ts        int64
+	requests  int64
+	successes int64
+	latencyMs int64 // 只累计成功请求的耗时
+	ttftCount int64
+	ttftMs    int64
+}
+
+type window struct {
+	mu    sync.Mutex
+	slots [maxSlots]slot
+}
+
+var (
+	windows  sync.Map // windowKey -> *window
+	inFlight sync.Map // channelId -> *atomic.Int64
+)
+
+// Stats 渠道在统计窗口内的请求情况
+type Stats struct {
+	Requests     int64
+	Successes    int64
+	AvgLatencyMs int64 // 成功请求的平均耗时，失败的请求往往很快返回，不计入延迟
+	SuccessRate  float64
+	TtftSamples  int64 // 流式请求的首字时间样本数
+	AvgTtftMs    int64
+}
+
+// Record 记录一次转发尝试的耗时与结果
+func Record(channelId int, model string, latency time.Duration, success bool) {
+	if channelId <= 0 {
+		return
+	}
+	w, s := currentSlot(channelId, model)
+	defer w.mu.Unlock()
+	s.requests++
+	if success {
+		s.successes++
+		if latency > 0 {
+			s.latencyMs += latency.Milliseconds()
+		}
+	}
+}
+
+// RecordFirstToken 记录一次流式转发尝试从发出请求到向客户端写出首字节的耗时
+func RecordFirstToken(channelId int, model string, ttft time.Duration) {
+	if channelId <= 0 || ttft <= 0 {
+		return
+	}
+	w, s := currentSlot(channelId, model)
+	defer w.mu.Unlock()
+	s.ttftCount++
+	s.ttftMs += ttft.Milliseconds()
+}
+
+// currentSlot 返回当前分钟的统计槽，调用方负责释放返回窗口的锁
+func currentSlot(channelId int, model string) (*window, *slot) {
+	now := time.Now().Unix()
+	ts := now - now%slotSeconds
+	actual, _ := windows.LoadOrStore(windowKey{channelId: channelId, model: model}, &window{})
+	w := actual.(*window)
+
+	w.mu.Lock()
+	s := &w.slots[(ts/slotSeconds)%maxSlots]
+	if s.ts != ts {
+		*s = slot{ts: ts}
+	}
+	return w, s
+}
+
+// Query 返回渠道在 model 下最近 period 内的统计
+func Query(channelId int, model string, period time.Duration) Stats {
+	actual, ok := windows.Load(windowKey{channelId: channelId, model: model})
+	if !ok {
+		return Stats{}
+	}
+	w := actual.(*window)
+	since := time.Now().Add(-period).Unix()
+
+	var stats Stats
+	var latencyMs, ttftMs int64
+	w.mu.Lock()
+	for _, s := range w.slots {
+		if (s.requests == 0 && s.ttftCount == 0) || s.ts+slotSeconds <= since {
+			continue
+		}
+		stats.Requests += s.requests
+		stats.Successes += s.successes
+		latencyMs += s.latencyMs
+		stats.TtftSamples += s.ttftCount
+		ttftMs += s.ttftMs
+	}
+	w.mu.Unlock()
+
+	if stats.Successes > 0 {
+		stats.AvgLatencyMs = latencyMs / stats.Successes
+	}
+	if stats.Requests > 0 {
+		stats.SuccessRate = float64(stats.Successes) / float64(stats.Requests)
+	}
+	if stats.TtftSamples > 0 {
+		stats.AvgTtftMs = ttftMs / stats.TtftSamples
+	}
+	return stats
+}
+
+func inFlightCounter(channelId int) *atomic.Int64 {
+	actual, _ := inFlight.LoadOrStore(channelId, &atomic.Int64{})
+	return actual.(*atomic.Int64)
+}
+
+// Acquire 将渠道的并发请求数加一，返回的 release 用于请求结束时减一，重复调用只生效一次
+func Acquire(channelId int) (release func()) {
+	counter := inFlightCounter(channelId)
+	counter.Add(1)
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			counter.Add(-1)
+		})
+	}
+}
+
+// InFlight 返回渠道在本节点当前的并发请求数
+func InFlight(channelId int) int64 {
+	actual, ok := inFlight.Load(channelId)
+	if !ok {
+		return 0
+	}
+	return actual.(*atomic.Int64).Load()
+}
+
+// Reset 清空所有统计数据，供测试使用
+func Reset() {
+	windows.Range(func(key, _ any) bool {
+		windows.Delete(key)
+		return true
+	})
+	inFlight.Range(func(key, _ any) bool {
+		inFlight.Delete(key)
+		return true
+	})
+}
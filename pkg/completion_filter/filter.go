@@ -0,0 +1,223 @@
+// Package completionfilter 在模型输出上检测敏感词。流式输出按片段送入，过滤器在片段之间保留一段滑动窗口
+// （最长敏感词的长度减一个字符），跨越片段边界的敏感词同样能被发现；窗口内的文本在下一个片段到达或输出结束时才放行。
+package completionfilter
+
+import (
+	"sort"
+	"strings"
+	"sync"
+	"unicode"
+
+	goahocorasick "github.com/anknown/ahocorasick"
+)
+
+const (
+	ActionMask     = "mask"     // 替换敏感词后继续输出
+	ActionTruncate = "truncate" // 在敏感词之前结束输出，结束原因为 content_filter
+	ActionAbort    = "abort"    // 立即中断请求
+)
+
+// DefaultMask 与提示词敏感词替换使用相同的占位文本
+const DefaultMask = "**###**"
+
+// ValidAction 判断是否为支持的动作
+func ValidAction(action string) bool {
+	return action == ActionMask || action == ActionTruncate || action == ActionAbort
+}
+
+type match struct {
+	start int
+	end   int
+	word  string
+}
+
+// Filter 一次输出的敏感词过滤器，非并发安全
+type Filter struct {
+	machine   *goahocorasick.Machine
+	holdback  int
+	action    string
+	mask      string
+	pending   []rune
+	hits      []string
+	triggered bool
+	// parent 由 Clone 创建时指向原过滤器，命中同时记录在原过滤器上
+	parent *Filter
+}
+
+// New 创建过滤器，没有有效的敏感词时返回 nil；不支持的动作按 mask 处理
+func New(words []string, action string, mask string) *Filter {
+	machine, maxLen := getOrBuildMachine(words)
+	if machine == nil {
+		return nil
+	}
+	if !ValidAction(action) {
+		action = ActionMask
+	}
+	if mask == "" {
+		mask = DefaultMask
+	}
+	return &Filter{
+		machine:  machine,
+		holdback: maxLen - 1,
+		action:   action,
+		mask:     mask,
+	}
+}
+
+// Clone 创建使用同一组敏感词与动作的新过滤器，用于分别检查同一响应中的多路输出（例如多个 choice），
+// 各路输出的窗口与截断状态相互独立，命中的敏感词同时记录在原过滤器上
+func (f *Filter) Clone() *Filter {
+	return &Filter{
+		machine:  f.machine,
+		holdback: f.holdback,
+		action:   f.action,
+		mask:     f.mask,
+		parent:   f,
+	}
+}
+
+// Action 返回命中时执行的动作
+func (f *Filter) Action() string {
+	return f.action
+}
+
+// Hits 返回命中的敏感词（小写），按命中顺序，可能重复
+func (f *Filter) Hits() []string {
+	return f.hits
+}
+
+// Triggered 是否已经因为 truncate / abort 命中而结束输出
+func (f *Filter) Triggered() bool {
+	return f.triggered
+}
+
+// Write 送入一段输出文本，返回现在可以放行的文本。命中 truncate / abort 时返回 true，
+// 放行的是敏感词之前的文本，之后送入的文本都会被丢弃
+func (f *Filter) Write(text string) (string, bool) {
+	if f.triggered {
+		return "", true
+	}
+	buf := append(f.pending, []rune(text)...)
+	f.pending = nil
+	matches := f.find(buf)
+	if len(matches) > 0 && f.action != ActionMask {
+		f.triggered = true
+		f.addHit(matches[0].word)
+		return string(buf[:matches[0].start]), true
+	}
+
+	var out strings.Builder
+	last := 0
+	for _, m := range matches {
+		out.WriteString(string(buf[last:m.start]))
+		out.WriteString(f.mask)
+		last = m.end
+		f.addHit(m.word)
+	}
+	// 末尾可能是下一个片段中敏感词的开头，先保留不放行
+	keep := max(len(buf)-f.holdback, last)
+	out.WriteString(string(buf[last:keep]))
+	if keep < len(buf) {
+		f.pending = append([]rune(nil), buf[keep:]...)
+	}
+	return out.String(), false
+}
+
+// Flush 输出结束时放行窗口中剩余的文本
+func (f *Filter) Flush() string {
+	if f.triggered || len(f.pending) == 0 {
+		return ""
+	}
+	rest := string(f.pending)
+	f.pending = nil
+	return rest
+}
+
+// Pending 窗口中是否还有尚未放行的文本
+func (f *Filter) Pending() bool {
+	return len(f.pending) > 0
+}
+
+func (f *Filter) addHit(word string) {
+	for filter := f; filter != nil; filter = filter.parent {
+		filter.hits = append(filter.hits, word)
+	}
+}
+
+// find 在 buf 中查找敏感词（不区分大小写），重叠的命中取最靠前、最长的一个
+func (f *Filter) find(buf []rune) []match {
+	if len(buf) == 0 {
+		return nil
+	}
+	lower := make([]rune, len(buf))
+	for i, r := range buf {
+		lower[i] = unicode.ToLower(r)
+	}
+	terms := f.machine.MultiPatternSearch(lower, false)
+	if len(terms) == 0 {
+		return nil
+	}
+	candidates := make([]match, 0, len(terms))
+	for _, term := range terms {
+		candidates = append(candidates, match{start: term.Pos, end: term.Pos + len(term.Word), word: string(term.Word)})
+	}
+	sort.Slice(candidates, func(i, j int) bool {
+		if candidates[i].start != candidates[j].start {
+			return candidates[i].start < candidates[j].start
+		}
+		return candidates[i].end > candidates[j].end
+	})
+	matches := make([]match, 0, len(candidates))
+	end := 0
+	for _, m := range candidates {
+		if m.start < end {
+			continue
+		}
+		matches = append(matches, m)
+		end = m.end
+	}
+	return matches
+}
+
+type cachedMachine struct {
+	machine *goahocorasick.Machine
+	maxLen  int
+}
+
+var machineCache sync.Map
+
+func getOrBuildMachine(words []string) (*goahocorasick.Machine, int) {
+	seen := make(map[string]bool, len(words))
+	normalized := make([]string, 0, len(words))
+	for _, word := range words {
+		word = strings.TrimSpace(strings.Map(unicode.ToLower, word))
+		if word != "" && !seen[word] {
+			seen[word] = true
+			normalized = append(normalized, word)
+		}
+	}
+	if len(normalized) == 0 {
+		return nil, 0
+	}
+	sort.Strings(normalized)
+	key := strings.Join(normalized, "\x00")
+	if v, ok := machineCache.Load(key); ok {
+		cached := v.(*cachedMachine)
+		return cached.machine, cached.maxLen
+	}
+
+	dict := make([][]rune, 0, len(normalized))
+	maxLen := 0
+	for _, word := range normalized {
+		runes := []rune(word)
+		maxLen = max(maxLen, len(runes))
+		dict = append(dict, runes)
+	}
+	machine := new(goahocorasick.Machine)
+	if err := machine.Build(dict); err != nil {
+		return nil, 0
+	}
+	actual, _ := machineCache.LoadOrStore(key, &cachedMachine{machine: machine, maxLen: maxLen})
+	cached := actual.(*cachedMachine)
+	return cached.machine, cached.maxLen
+}
@@ -0,0 +1,84 @@
+package completionfilter
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func writeAll(f *Filter, chunks ...string) (string, bool) {
+	var out strings.Builder
+	for _, chunk := range chunks {
+		text, stop := f.Write(chunk)
+		out.WriteString(text)
+		if stop {
+			return out.String(), true
+		}
+	}
+	out.WriteString(f.Flush())
+	return out.String(), false
+}
+
+func TestFilterMaskAcrossChunks(t *testing.T) {
+	f := New([]string{"Secret Word", "敏感词"}, ActionMask, "")
+	require.NotNil(t, f)
+
+	out, stop := writeAll(f, "this is a sec", "ret w", "ord and 敏", "感词 done")
+	require.False(t, stop)
+	require.Equal(t, "this is a **###** and **###** done", out)
+	require.Equal(t, []string{"secret word", "敏感词"}, f.Hits())
+}
+
+func TestFilterHoldsBackOnlyWindow(t *testing.T) {
+	f := New([]string{"abcd"}, ActionMask, "***")
+	text, stop := f.Write("hello ab")
+	require.False(t, stop)
+	require.Equal(t, "hello", text)
+	require.True(t, f.Pending())
+	text, _ = f.Write("cdef")
+	require.Equal(t, " ***", text)
+	require.Equal(t, "ef", f.Flush())
+	require.False(t, f.Pending())
+}
+
+func TestFilterTruncate(t *testing.T) {
+	f := New([]string{"forbidden"}, ActionTruncate, "")
+	out, stop := writeAll(f, "safe text forb", "idden tail", "more")
+	require.True(t, stop)
+	require.Equal(t, "safe text ", out)
+	require.True(t, f.Triggered())
+	text, stop := f.Write("after")
+	require.True(t, stop)
+	require.Empty(t, text)
+	require.Empty(t, f.Flush())
+}
+
+func TestFilterOverlappingWordsAndEmpty(t *testing.T) {
+	require.Nil(t, New([]string{" ", ""}, ActionMask, ""))
+
+	f := New([]string{"bad", "badword"}, "unknown", "#")
+	require.Equal(t, ActionMask, f.Action())
+	out, _ := writeAll(f, "a BADWORD b")
+	require.Equal(t, "a # b", out)
+}
+
+func TestFilterCloneKeepsSeparateWindows(t *testing.T) {
+	f := New([]string{"forbidden"}, ActionTruncate, "")
+	first, second := f.Clone(), f.Clone()
+
+	text, stop := first.Write("safe text forb")
+	require.False(t, stop)
+	require.Equal(t, "safe t", text)
+	// 另一路输出不会接上第一路窗口中的文本
+	text, stop = second.Write("idden")
+	require.False(t, stop)
+	require.Equal(t, "", text)
+
+	text, stop = first.Write("idden")
+	require.True(t, stop)
+	require.Equal(t, "ext ", text)
+	require.False(t, second.Triggered())
+	require.Equal(t, []string{"forbidden"}, f.Hits())
+	require.Empty(t, second.Hits())
+}
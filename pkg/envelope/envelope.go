@@ -0,0 +1,222 @@
+// Package envelope 实现敏感字段的信封加密：每个值使用随机生成的数据密钥以 AES-256-GCM 加密，
+// 数据密钥再由主密钥加密后与密文保存在一起。密文中带有主密钥的标识，轮换主密钥时旧密钥仍可用于解密
+package envelope
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Prefix 加密值的前缀，格式为 enc:v1:<主密钥标识>:<加密的数据密钥>:<密文>
+const Prefix = "enc:v1:"
+
+const keySize = 32
+
+var ErrUnknownKey = errors.New("value is encrypted with an unknown master key")
+
+type masterKey struct {
+	id   string
+	aead cipher.AEAD
+	// lookupKey 由主密钥派生，只用于计算可检索的确定性摘要
+	lookupKey []byte
+}
+
+// Keyring 一个主密钥与若干只用于解密的旧主密钥
+type Keyring struct {
+	primary *masterKey
+	keys    map[string]*masterKey
+}
+
+// NewKeyring 创建密钥环，primary 用于加密，previous 只用于解密轮换前写入的值
+func NewKeyring(primary []byte, previous ...[]byte) (*Keyring, error) {
+	k := &Keyring{keys: make(map[string]*masterKey)}
+	mk, err := newMasterKey(primary)
+	if err != nil {
+		return nil, err
+	}
+	k.primary = mk
+	k.keys[mk.id] = mk
+	for _, raw := range previous {
+		old, err := newMasterKey(raw)
+		if err != nil {
+			return nil, err
+		}
+		if _, ok := k.keys[old.id]; !ok {
+			k.keys[old.id] = old
+		}
+	}
+	return k, nil
+}
+
+func newMasterKey(raw []byte) (*masterKey, error) {
+	if len(raw) != keySize {
+		return nil, fmt.Errorf("master key must be %d bytes, got %d", keySize, len(raw))
+	}
+	aead, err := newAEAD(raw)
+	if err != nil {
+		return nil, err
+	}
+	sum := sha256.Sum256(raw)
+	mac := hmac.New(sha256.New, raw)
+	mac.Write([]byte("envelope lookup hash"))
+	return &masterKey{id: hex.EncodeToString(sum[:4]), aead: aead, lookupKey: mac.Sum(nil)}, nil
+}
+
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// ParseKey 解析 base64 或 64 位十六进制表示的 32 字节主密钥
+func ParseKey(s string) ([]byte, error) {
+	s = strings.TrimSpace(s)
+	if len(s) == keySize*2 {
+		if raw, err := hex.DecodeString(s); err == nil {
+			return raw, nil
+		}
+	}
+	for _, encoding := range []*base64.Encoding{base64.StdEncoding, base64.RawStdEncoding, base64.URLEncoding, base64.RawURLEncoding} {
+		if raw, err := encoding.DecodeString(s); err == nil && len(raw) == keySize {
+			return raw, nil
+		}
+	}
+	return nil, fmt.Errorf("master key must be %d bytes encoded as base64 or hex", keySize)
+}
+
+// PrimaryID 返回当前主密钥的标识
+func (k *Keyring) PrimaryID() string {
+	return k.primary.id
+}
+
+// Encrypt 加密一个值，空字符串不加密
+func (k *Keyring) Encrypt(plaintext string) (string, error) {
+	if plaintext == "" {
+		return "", nil
+	}
+	dataKey := make([]byte, keySize)
+	if _, err := rand.Read(dataKey); err != nil {
+		return "", err
+	}
+	wrapped, err := seal(k.primary.aead, dataKey)
+	if err != nil {
+		return "", err
+	}
+	dataAEAD, err := newAEAD(dataKey)
+	if err != nil {
+		return "", err
+	}
+	ciphertext, err := seal(dataAEAD, []byte(plaintext))
+	if err != nil {
+		return "", err
+	}
+	return Prefix + k.primary.id + ":" + base64.RawURLEncoding.EncodeToString(wrapped) + ":" + base64.RawURLEncoding.EncodeToString(ciphertext), nil
+}
+
+// LookupHash 用当前主密钥计算值的确定性摘要，用于按值检索加密字段，空字符串返回空字符串
+func (k *Keyring) LookupHash(value string) string {
+	if value == "" {
+		return ""
+	}
+	return lookupHash(k.primary, value)
+}
+
+// LookupHashes 用所有主密钥计算值的摘要，轮换期间旧主密钥写入的摘要也能匹配
+func (k *Keyring) LookupHashes(value string) []string {
+	if value == "" {
+		return nil
+	}
+	hashes := make([]string, 0, len(k.keys))
+	hashes = append(hashes, lookupHash(k.primary, value))
+	for id, mk := range k.keys {
+		if id != k.primary.id {
+			hashes = append(hashes, lookupHash(mk, value))
+		}
+	}
+	return hashes
+}
+
+func lookupHash(mk *masterKey, value string) string {
+	mac := hmac.New(sha256.New, mk.lookupKey)
+	mac.Write([]byte(value))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// Decrypt 解密一个值，未加密的值原样返回
+func (k *Keyring) Decrypt(value string) (string, error) {
+	if !IsEncrypted(value) {
+		return value, nil
+	}
+	parts := strings.Split(strings.TrimPrefix(value, Prefix), ":")
+	if len(parts) != 3 {
+		return "", errors.New("malformed encrypted value")
+	}
+	mk, ok := k.keys[parts[0]]
+	if !ok {
+		return "", fmt.Errorf("%w: %s", ErrUnknownKey, parts[0])
+	}
+	wrapped, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return "", errors.New("malformed encrypted value")
+	}
+	ciphertext, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return "", errors.New("malformed encrypted value")
+	}
+	dataKey, err := open(mk.aead, wrapped)
+	if err != nil {
+		return "", err
+	}
+	dataAEAD, err := newAEAD(dataKey)
+	if err != nil {
+		return "", err
+	}
+	plaintext, err := open(dataAEAD, ciphertext)
+	if err != nil {
+		return "", err
+	}
+	return string(plaintext), nil
+}
+
+// IsEncrypted 判断值是否为加密格式
+func IsEncrypted(value string) bool {
+	return strings.HasPrefix(value, Prefix)
+}
+
+// KeyID 返回加密值使用的主密钥标识，未加密时返回空字符串
+func KeyID(value string) string {
+	if !IsEncrypted(value) {
+		return ""
+	}
+	id, _, _ := strings.Cut(strings.TrimPrefix(value, Prefix), ":")
+	return id
+}
+
+func seal(aead cipher.AEAD, plaintext []byte) ([]byte, error) {
+	nonce := make([]byte, aead.NonceSize(), aead.NonceSize()+len(plaintext)+aead.Overhead())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	return aead.Seal(nonce, nonce, plaintext, nil), nil
+}
+
+func open(aead cipher.AEAD, data []byte) ([]byte, error) {
+	if len(data) < aead.NonceSize() {
+		return nil, errors.New("malformed encrypted value")
+	}
+	plaintext, err := aead.Open(nil, data[:aead.NonceSize()], data[aead.NonceSize():], nil)
+	if err != nil {
+		return nil, errors.New("failed to decrypt value: wrong master key or corrupted data")
+	}
+	return plaintext, nil
+}
@@ -0,0 +1,78 @@
+package envelope
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestEncryptDecryptAndRotate(t *testing.T) {
+	oldKey := bytes.Repeat([]byte{1}, 32)
+	newKey := bytes.Repeat([]byte{2}, 32)
+
+	oldRing, err := NewKeyring(oldKey)
+	require.NoError(t, err)
+	encrypted, err := oldRing.Encrypt("sk-upstream-secret")
+	require.NoError(t, err)
+	require.True(t, IsEncrypted(encrypted))
+	require.Equal(t, oldRing.PrimaryID(), KeyID(encrypted))
+	require.NotContains(t, encrypted, "sk-upstream-secret")
+
+	again, err := oldRing.Encrypt("sk-upstream-secret")
+	require.NoError(t, err)
+	require.NotEqual(t, encrypted, again)
+
+	plain, err := oldRing.Decrypt("plain value")
+	require.NoError(t, err)
+	require.Equal(t, "plain value", plain)
+
+	rotated, err := NewKeyring(newKey, oldKey)
+	require.NoError(t, err)
+	plain, err = rotated.Decrypt(encrypted)
+	require.NoError(t, err)
+	require.Equal(t, "sk-upstream-secret", plain)
+
+	newOnly, err := NewKeyring(newKey)
+	require.NoError(t, err)
+	_, err = newOnly.Decrypt(encrypted)
+	require.True(t, errors.Is(err, ErrUnknownKey))
+
+	empty, err := newOnly.Encrypt("")
+	require.NoError(t, err)
+	require.Empty(t, empty)
+}
+
+func TestParseKey(t *testing.T) {
+	raw := bytes.Repeat([]byte{7}, 32)
+	parsed, err := ParseKey(base64.StdEncoding.EncodeToString(raw))
+	require.NoError(t, err)
+	require.Equal(t, raw, parsed)
+
+	parsed, err = ParseKey("0707070707070707070707070707070707070707070707070707070707070707")
+	require.NoError(t, err)
+	require.Equal(t, raw, parsed)
+
+	_, err = ParseKey("too-short")
+	require.Error(t, err)
+}
+
+func TestLookupHash(t *testing.T) {
+	oldRing, err := NewKeyring(bytes.Repeat([]byte{1}, 32))
+	require.NoError(t, err)
+	newRing, err := NewKeyring(bytes.Repeat([]byte{2}, 32), bytes.Repeat([]byte{1}, 32))
+	require.NoError(t, err)
+
+	hash := oldRing.LookupHash("sk-upstream-secret")
+	require.Equal(t, hash, oldRing.LookupHash("sk-upstream-secret"))
+	require.NotContains(t, hash, "sk-upstream-secret")
+	require.NotEqual(t, hash, oldRing.LookupHash("sk-other-secret"))
+	require.Empty(t, oldRing.LookupHash(""))
+
+	hashes := newRing.LookupHashes("sk-upstream-secret")
+	require.Len(t, hashes, 2)
+	require.Equal(t, newRing.LookupHash("sk-upstream-secret"), hashes[0])
+	require.Contains(t, hashes, hash)
+}
@@ -0,0 +1,473 @@
+// Package hftokenizer 加载 HuggingFace tokenizer.json 格式的 BPE 词表（包括由 SentencePiece 转换而来的词表），
+// 只实现本地计数所需的部分：normalizer、pre_tokenizer 与 BPE 合并，不处理解码与特殊 token。
+// 许可允许随二进制分发的词表嵌入在 vocab 目录中，其他模型的词表由部署方自行提供
+package hftokenizer
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"strings"
+	"sync"
+
+	"github.com/dlclark/regexp2"
+	"golang.org/x/text/unicode/norm"
+)
+
+// gpt2SplitPattern ByteLevel pre_tokenizer 开启 use_regex 时使用的切分规则
+const gpt2SplitPattern = `'s|'t|'re|'ve|'m|'ll|'d| ?\p{L}+| ?\p{N}+| ?[^\s\p{L}\p{N}]+|\s+(?!\S)|\s+`
+
+const (
+	// maxWordRunes 单个预切分片段参与 BPE 合并的最大字符数，超长片段分段计数，避免合并退化为平方复杂度
+	maxWordRunes = 256
+	// maxCacheSize 片段计数缓存上限，超过后清空
+	maxCacheSize = 16384
+)
+
+type pair struct {
+	left, right string
+}
+
+type preTokenizer func(pieces []string) []string
+
+type splitMode int
+
+const (
+	splitIsolated    splitMode = iota // 匹配部分与未匹配部分各自成为片段
+	splitRemoved                      // 丢弃匹配部分
+	splitMatchesOnly                  // 只保留匹配部分
+)
+
+// Tokenizer 基于 tokenizer.json 的 BPE 分词器，只用于计数
+type Tokenizer struct {
+	name          string
+	vocab         map[string]int
+	ranks         map[pair]int
+	byteLevel     bool
+	byteFallback  bool
+	ignoreMerges  bool
+	normalizers   []func(string) string
+	preTokenizers []preTokenizer
+
+	cacheLock sync.Mutex
+	cache     map[string]int
+}
+
+type patternSpec struct {
+	String *string `json:"String"`
+	Regex  *string `json:"Regex"`
+}
+
+type component struct {
+	Type             string       `json:"type"`
+	Normalizers      []*component `json:"normalizers"`
+	Pretokenizers    []*component `json:"pretokenizers"`
+	Prepend          string       `json:"prepend"`
+	Pattern          *patternSpec `json:"pattern"`
+	Content          string       `json:"content"`
+	Behavior         string       `json:"behavior"`
+	UseRegex         *bool        `json:"use_regex"`
+	AddPrefixSpace   *bool        `json:"add_prefix_space"`
+	Replacement      string       `json:"replacement"`
+	PrependScheme    string       `json:"prepend_scheme"`
+	IndividualDigits bool         `json:"individual_digits"`
+}
+
+type tokenizerFile struct {
+	Normalizer   *component `json:"normalizer"`
+	PreTokenizer *component `json:"pre_tokenizer"`
+	Model        struct {
+		Type         string            `json:"type"`
+		Vocab        map[string]int    `json:"vocab"`
+		Merges       []json.RawMessage `json:"merges"`
+		ByteFallback bool              `json:"byte_fallback"`
+		IgnoreMerges bool              `json:"ignore_merges"`
+	} `json:"model"`
+}
+
+// Load 解析 tokenizer.json 内容，支持 gzip 压缩
+func Load(name string, data []byte) (*Tokenizer, error) {
+	if len(data) > 2 && data[0] == 0x1f && data[1] == 0x8b {
+		reader, err := gzip.NewReader(bytes.NewReader(data))
+		if err != nil {
+			return nil, fmt.Errorf("tokenizer %s: %w", name, err)
+		}
+		data, err = io.ReadAll(reader)
+		_ = reader.Close()
+		if err != nil {
+			return nil, fmt.Errorf("tokenizer %s: %w", name, err)
+		}
+	}
+
+	var file tokenizerFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("tokenizer %s: %w", name, err)
+	}
+	if file.Model.Type != "" && file.Model.Type != "BPE" {
+		return nil, fmt.Errorf("tokenizer %s: unsupported model type %s", name, file.Model.Type)
+	}
+	if len(file.Model.Vocab) == 0 {
+		return nil, fmt.Errorf("tokenizer %s: empty vocab", name)
+	}
+
+	t := &Tokenizer{
+		name:         name,
+		vocab:        file.Model.Vocab,
+		ranks:        make(map[pair]int, len(file.Model.Merges)),
+		byteFallback: file.Model.ByteFallback,
+		ignoreMerges: file.Model.IgnoreMerges,
+		cache:        make(map[string]int),
+	}
+	for rank, raw := range file.Model.Merges {
+		p, err := parseMerge(raw)
+		if err != nil {
+			return nil, fmt.Errorf("tokenizer %s: merge %d: %w", name, rank, err)
+		}
+		if _, exists := t.ranks[p]; !exists {
+			t.ranks[p] = rank
+		}
+	}
+	if file.Normalizer != nil {
+		if err := t.addNormalizer(file.Normalizer); err != nil {
+			return nil, fmt.Errorf("tokenizer %s: %w", name, err)
+		}
+	}
+	if file.PreTokenizer != nil {
+		if err := t.addPreTokenizer(file.PreTokenizer); err != nil {
+			return nil, fmt.Errorf("tokenizer %s: %w", name, err)
+		}
+	} else {
+		// SentencePiece 转换的词表（如 Llama 2）没有 pre_tokenizer，按 ▁ 切分成词，避免整段文本参与合并
+		t.preTokenizers = append(t.preTokenizers, splitBefore("▁"))
+	}
+	return t, nil
+}
+
+// parseMerge 兼容 "a b" 与 ["a", "b"] 两种 merges 格式
+func parseMerge(raw json.RawMessage) (pair, error) {
+	var text string
+	if err := json.Unmarshal(raw, &text); err == nil {
+		left, right, ok := strings.Cut(text, " ")
+		if !ok {
+			return pair{}, fmt.Errorf("invalid merge %q", text)
+		}
+		return pair{left: left, right: right}, nil
+	}
+	var parts []string
+	if err := json.Unmarshal(raw, &parts); err != nil {
+		return pair{}, err
+	}
+	if len(parts) != 2 {
+		return pair{}, errors.New("merge must have two parts")
+	}
+	return pair{left: parts[0], right: parts[1]}, nil
+}
+
+func (t *Tokenizer) addNormalizer(c *component) error {
+	switch c.Type {
+	case "Sequence":
+		for _, child := range c.Normalizers {
+			if err := t.addNormalizer(child); err != nil {
+				return err
+			}
+		}
+	case "Prepend":
+		prepend := c.Prepend
+		t.normalizers = append(t.normalizers, func(s string) string {
+			if s == "" {
+				return s
+			}
+			return prepend + s
+		})
+	case "Replace":
+		if c.Pattern == nil {
+			return errors.New("replace normalizer without pattern")
+		}
+		content := c.Content
+		if c.Pattern.String != nil {
+			old := *c.Pattern.String
+			t.normalizers = append(t.normalizers, func(s string) string {
+				return strings.ReplaceAll(s, old, content)
+			})
+		} else if c.Pattern.Regex != nil {
+			re, err := regexp2.Compile(*c.Pattern.Regex, regexp2.None)
+			if err != nil {
+				return err
+			}
+			t.normalizers = append(t.normalizers, func(s string) string {
+				replaced, err := re.Replace(s, content, -1, -1)
+				if err != nil {
+					return s
+				}
+				return replaced
+			})
+		}
+	case "Lowercase":
+		t.normalizers = append(t.normalizers, strings.ToLower)
+	case "NFC":
+		t.normalizers = append(t.normalizers, norm.NFC.String)
+	case "NFKC":
+		t.normalizers = append(t.normalizers, norm.NFKC.String)
+	case "NFD":
+		t.normalizers = append(t.normalizers, norm.NFD.String)
+	case "NFKD":
+		t.normalizers = append(t.normalizers, norm.NFKD.String)
+	default:
+		// Strip、StripAccents 等对计数影响很小，忽略
+	}
+	return nil
+}
+
+func (t *Tokenizer) addPreTokenizer(c *component) error {
+	switch c.Type {
+	case "Sequence":
+		for _, child := range c.Pretokenizers {
+			if err := t.addPreTokenizer(child); err != nil {
+				return err
+			}
+		}
+	case "Split":
+		if c.Pattern == nil {
+			return errors.New("split pre_tokenizer without pattern")
+		}
+		var re *regexp2.Regexp
+		var err error
+		if c.Pattern.Regex != nil {
+			re, err = regexp2.Compile(*c.Pattern.Regex, regexp2.None)
+		} else if c.Pattern.String != nil {
+			re, err = regexp2.Compile(regexp2.Escape(*c.Pattern.String), regexp2.None)
+		} else {
+			return errors.New("split pre_tokenizer without pattern")
+		}
+		if err != nil {
+			return err
+		}
+		mode := splitIsolated
+		if c.Behavior == "Removed" {
+			mode = splitRemoved
+		}
+		t.preTokenizers = append(t.preTokenizers, splitRegex(re, mode))
+	case "ByteLevel":
+		t.byteLevel = true
+		if c.AddPrefixSpace != nil && *c.AddPrefixSpace {
+			t.preTokenizers = append(t.preTokenizers, func(pieces []string) []string {
+				if len(pieces) > 0 && !strings.HasPrefix(pieces[0], " ") {
+					pieces[0] = " " + pieces[0]
+				}
+				return pieces
+			})
+		}
+		if c.UseRegex == nil || *c.UseRegex {
+			t.preTokenizers = append(t.preTokenizers, splitRegex(regexp2.MustCompile(gpt2SplitPattern, regexp2.None), splitIsolated))
+		}
+	case "Metaspace":
+		replacement := c.Replacement
+		if replacement == "" {
+			replacement = "▁"
+		}
+		prefix := c.PrependScheme == "always" || c.PrependScheme == "first" ||
+			(c.PrependScheme == "" && (c.AddPrefixSpace == nil || *c.AddPrefixSpace))
+		t.preTokenizers = append(t.preTokenizers, func(pieces []string) []string {
+			for i := range pieces {
+				pieces[i] = strings.ReplaceAll(pieces[i], " ", replacement)
+			}
+			if prefix && len(pieces) > 0 && !strings.HasPrefix(pieces[0], replacement) {
+				pieces[0] = replacement + pieces[0]
+			}
+			return pieces
+		}, splitBefore(replacement))
+	case "Digits":
+		pattern := `\p{N}+`
+		if c.IndividualDigits {
+			pattern = `\p{N}`
+		}
+		t.preTokenizers = append(t.preTokenizers, splitRegex(regexp2.MustCompile(pattern, regexp2.None), splitIsolated))
+	case "Whitespace":
+		t.preTokenizers = append(t.preTokenizers, splitRegex(regexp2.MustCompile(`\w+|[^\w\s]+`, regexp2.None), splitMatchesOnly))
+	case "WhitespaceSplit":
+		t.preTokenizers = append(t.preTokenizers, func(pieces []string) []string {
+			var out []string
+			for _, piece := range pieces {
+				out = append(out, strings.Fields(piece)...)
+			}
+			return out
+		})
+	case "Punctuation":
+		t.preTokenizers = append(t.preTokenizers, splitRegex(regexp2.MustCompile(`\p{P}`, regexp2.None), splitIsolated))
+	default:
+		return fmt.Errorf("unsupported pre_tokenizer %s", c.Type)
+	}
+	return nil
+}
+
+// splitRegex 按正则切分片段，MergedWithPrevious 等其余切分行为按 Isolated 近似处理
+func splitRegex(re *regexp2.Regexp, mode splitMode) preTokenizer {
+	return func(pieces []string) []string {
+		out := make([]string, 0, len(pieces))
+		for _, piece := range pieces {
+			runes := []rune(piece)
+			last := 0
+			match, err := re.FindStringMatch(piece)
+			for err == nil && match != nil {
+				// regexp2 的 Index 与 Length 以 rune 为单位
+				start := match.Index
+				end := match.Index + match.Length
+				if start > last && mode != splitMatchesOnly {
+					out = append(out, string(runes[last:start]))
+				}
+				if end > start && mode != splitRemoved {
+					out = append(out, string(runes[start:end]))
+				}
+				last = end
+				match, err = re.FindNextMatch(match)
+			}
+			if last < len(runes) && mode != splitMatchesOnly {
+				out = append(out, string(runes[last:]))
+			}
+		}
+		return out
+	}
+}
+
+// splitBefore 在每段连续分隔符之前切分，分隔符归属到后一个片段
+func splitBefore(sep string) preTokenizer {
+	return func(pieces []string) []string {
+		out := make([]string, 0, len(pieces))
+		for _, piece := range pieces {
+			start := 0
+			for i := 1; i < len(piece); i++ {
+				if strings.HasPrefix(piece[i:], sep) && !strings.HasSuffix(piece[:i], sep) {
+					out = append(out, piece[start:i])
+					start = i
+				}
+			}
+			if start < len(piece) {
+				out = append(out, piece[start:])
+			}
+		}
+		return out
+	}
+}
+
+// Name 返回分词器名称
+func (t *Tokenizer) Name() string {
+	return t.name
+}
+
+// Count 返回文本的 token 数
+func (t *Tokenizer) Count(text string) int {
+	if text == "" {
+		return 0
+	}
+	for _, normalize := range t.normalizers {
+		text = normalize(text)
+	}
+	pieces := []string{text}
+	for _, split := range t.preTokenizers {
+		pieces = split(pieces)
+	}
+	total := 0
+	for _, piece := range pieces {
+		total += t.countPiece(piece)
+	}
+	return total
+}
+
+func (t *Tokenizer) countPiece(piece string) int {
+	if piece == "" {
+		return 0
+	}
+	t.cacheLock.Lock()
+	if count, ok := t.cache[piece]; ok {
+		t.cacheLock.Unlock()
+		return count
+	}
+	t.cacheLock.Unlock()
+
+	word := piece
+	if t.byteLevel {
+		word = byteLevelEncode(piece)
+	}
+	count := 0
+	if _, ok := t.vocab[word]; ok && t.ignoreMerges {
+		count = 1
+	} else {
+		runes := []rune(word)
+		for start := 0; start < len(runes); start += maxWordRunes {
+			end := min(start+maxWordRunes, len(runes))
+			count += t.countWord(runes[start:end])
+		}
+	}
+
+	t.cacheLock.Lock()
+	if len(t.cache) >= maxCacheSize {
+		t.cache = make(map[string]int)
+	}
+	t.cache[piece] = count
+	t.cacheLock.Unlock()
+	return count
+}
+
+// countWord 对单个词执行 BPE 合并：每轮合并排名最靠前的相邻符号对，直到无法合并
+func (t *Tokenizer) countWord(runes []rune) int {
+	symbols := make([]string, len(runes))
+	for i, r := range runes {
+		symbols[i] = string(r)
+	}
+	for len(symbols) > 1 {
+		best := -1
+		bestRank := math.MaxInt
+		for i := 0; i < len(symbols)-1; i++ {
+			if rank, ok := t.ranks[pair{left: symbols[i], right: symbols[i+1]}]; ok && rank < bestRank {
+				best = i
+				bestRank = rank
+			}
+		}
+		if best < 0 {
+			break
+		}
+		symbols[best] += symbols[best+1]
+		symbols = append(symbols[:best+1], symbols[best+2:]...)
+	}
+
+	count := 0
+	for _, symbol := range symbols {
+		if _, ok := t.vocab[symbol]; !ok && t.byteFallback {
+			// 不在词表中的字符回退为 <0xXX> 字节 token
+			count += len(symbol)
+			continue
+		}
+		count++
+	}
+	return count
+}
+
+var byteLevelAlphabet = buildByteLevelAlphabet()
+
+// buildByteLevelAlphabet 与 GPT-2 bytes_to_unicode 一致：可见字节映射为自身，其余字节映射到 256 之后的码位
+func buildByteLevelAlphabet() [256]rune {
+	var alphabet [256]rune
+	next := rune(256)
+	for b := 0; b < 256; b++ {
+		if (b >= '!' && b <= '~') || (b >= 0xA1 && b <= 0xAC) || (b >= 0xAE && b <= 0xFF) {
+			alphabet[b] = rune(b)
+		} else {
+			alphabet[b] = next
+			next++
+		}
+	}
+	return alphabet
+}
+
+func byteLevelEncode(s string) string {
+	var builder strings.Builder
+	builder.Grow(len(s) * 2)
+	for i := 0; i < len(s); i++ {
+		builder.WriteRune(byteLevelAlphabet[s[i]])
+	}
+	return builder.String()
+}
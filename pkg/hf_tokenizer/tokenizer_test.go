@@ -0,0 +1,91 @@
+package hftokenizer
+
+import (
+	"bytes"
+	"compress/gzip"
+	"testing"
+	"testing/fstest"
+
+	"github.com/stretchr/testify/require"
+)
+
+const byteLevelVocab = `{
+  "normalizer": null,
+  "pre_tokenizer": {"type": "ByteLevel", "add_prefix_space": false, "use_regex": true},
+  "model": {
+    "type": "BPE",
+    "vocab": {"h": 0, "e": 1, "l": 2, "o": 3, "w": 4, "r": 5, "d": 6, "Ġ": 7, "he": 8, "ll": 9, "llo": 10, "hello": 11, "Ġw": 12, "or": 13, "Ġwor": 14, "ld": 15},
+    "merges": ["h e", "l l", "ll o", "he llo", "Ġ w", "o r", "Ġw or", "l d"]
+  }
+}`
+
+const sentencePieceVocab = `{
+  "normalizer": {"type": "Sequence", "normalizers": [
+    {"type": "Prepend", "prepend": "▁"},
+    {"type": "Replace", "pattern": {"String": " "}, "content": "▁"}
+  ]},
+  "pre_tokenizer": null,
+  "model": {
+    "type": "BPE",
+    "byte_fallback": true,
+    "vocab": {"▁": 0, "a": 1, "b": 2, "▁a": 3, "▁ab": 4},
+    "merges": [["▁", "a"], ["▁a", "b"]]
+  }
+}`
+
+func TestByteLevelBPE(t *testing.T) {
+	tk, err := Load("tiny", []byte(byteLevelVocab))
+	require.NoError(t, err)
+	require.Equal(t, "tiny", tk.Name())
+
+	// hello -> [hello]，" world" -> [Ġwor, ld]
+	require.Equal(t, 3, tk.Count("hello world"))
+	// 第二次命中缓存，结果一致
+	require.Equal(t, 3, tk.Count("hello world"))
+	require.Equal(t, 0, tk.Count(""))
+}
+
+func TestSentencePieceByteFallback(t *testing.T) {
+	tk, err := Load("sp", []byte(sentencePieceVocab))
+	require.NoError(t, err)
+
+	// ▁ab ▁ab ▁é，é 不在词表中，按 UTF-8 字节回退为两个 token
+	require.Equal(t, 5, tk.Count("ab ab é"))
+}
+
+func TestLoadFSWithGzip(t *testing.T) {
+	var compressed bytes.Buffer
+	writer := gzip.NewWriter(&compressed)
+	_, err := writer.Write([]byte(byteLevelVocab))
+	require.NoError(t, err)
+	require.NoError(t, writer.Close())
+
+	fsys := fstest.MapFS{
+		"tiny.json.gz": {Data: compressed.Bytes()},
+		"sp.json":      {Data: []byte(sentencePieceVocab)},
+		"broken.json":  {Data: []byte(`{"model": {"type": "Unigram"}}`)},
+		"README.md":    {Data: []byte("ignored")},
+	}
+	tokenizers, errs := LoadFS(fsys, ".")
+	require.Len(t, errs, 1)
+	require.Len(t, tokenizers, 2)
+	require.Equal(t, 3, tokenizers["tiny"].Count("hello world"))
+}
+
+func TestLoadEmbedded(t *testing.T) {
+	tokenizers, errs := LoadEmbedded()
+	require.Empty(t, errs)
+
+	// 期望值取自 llama.cpp 的词表测试样例
+	cases := map[string][]int{
+		"qwen": {2, 7, 12, 7},
+	}
+	texts := []string{"Hello world", " this is 🦙.cpp", "w048 7tuijk dsdfhu", "3333333"}
+	for name, want := range cases {
+		tk, ok := tokenizers[name]
+		require.True(t, ok, name)
+		for i, text := range texts {
+			require.Equal(t, want[i], tk.Count(text), "%s %q", name, text)
+		}
+	}
+}
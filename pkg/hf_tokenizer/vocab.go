@@ -0,0 +1,62 @@
+package hftokenizer
+
+import (
+	"embed"
+	"fmt"
+	"io/fs"
+	"path"
+	"strings"
+)
+
+// embeddedVocab 编译时嵌入的词表，文件名（去掉 .json / .json.gz 后缀）即分词器名称，来源见 vocab/README.md
+//
+//go:embed vocab/*.json.gz
+var embeddedVocab embed.FS
+
+// VocabName 根据文件名返回分词器名称（去掉 .json / .json.gz 后缀），不是词表文件时返回 false
+func VocabName(fileName string) (string, bool) {
+	base := path.Base(fileName)
+	for _, suffix := range []string{".json.gz", ".json"} {
+		if strings.HasSuffix(base, suffix) {
+			name := strings.TrimSuffix(base, suffix)
+			return name, name != ""
+		}
+	}
+	return "", false
+}
+
+// LoadFS 加载 fsys 中 dir 目录下的所有词表，单个文件加载失败不影响其他文件
+func LoadFS(fsys fs.FS, dir string) (map[string]*Tokenizer, []error) {
+	tokenizers := make(map[string]*Tokenizer)
+	entries, err := fs.ReadDir(fsys, dir)
+	if err != nil {
+		return tokenizers, []error{err}
+	}
+	var errs []error
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+		name, ok := VocabName(entry.Name())
+		if !ok {
+			continue
+		}
+		data, err := fs.ReadFile(fsys, path.Join(dir, entry.Name()))
+		if err != nil {
+			errs = append(errs, fmt.Errorf("tokenizer %s: %w", name, err))
+			continue
+		}
+		t, err := Load(name, data)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		tokenizers[name] = t
+	}
+	return tokenizers, errs
+}
+
+// LoadEmbedded 加载编译时嵌入的词表
+func LoadEmbedded() (map[string]*Tokenizer, []error) {
+	return LoadFS(embeddedVocab, "vocab")
+}
@@ -0,0 +1,93 @@
+package prommetrics
+
+import (
+	"sync/atomic"
+
+	"github.com/QuantumNous/new-api/common"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// ChannelStat 渠道缓存中单个渠道的状态，由 model 层在抓取时提供
+type ChannelStat struct {
+	Id           int
+	Name         string
+	Type         int
+	Status       int
+	KeyCount     int // 多 Key 渠道的 Key 总数，单 Key 渠道为 0
+	DisabledKeys int // 多 Key 渠道中已禁用的 Key 数量
+}
+
+var channelStatsProvider atomic.Value // func() []ChannelStat
+
+// SetChannelStatsProvider 设置抓取时读取渠道状态的函数，避免本包依赖 model
+func SetChannelStatsProvider(provider func() []ChannelStat) {
+	channelStatsProvider.Store(provider)
+}
+
+var (
+	channelsDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "channel", "count"),
+		"Number of channels by status.",
+		[]string{"status"}, nil,
+	)
+	channelStatusDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "channel", "status"),
+		"Channel status: 1 enabled, 2 manually disabled, 3 auto disabled.",
+		[]string{"channel_id", "channel_name", "channel_type"}, nil,
+	)
+	channelKeysDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "channel", "keys"),
+		"Number of keys of multi-key channels by state.",
+		[]string{"channel_id", "channel_name", "state"}, nil,
+	)
+)
+
+func channelStatusLabel(status int) string {
+	switch status {
+	case common.ChannelStatusEnabled:
+		return "enabled"
+	case common.ChannelStatusManuallyDisabled:
+		return "manually_disabled"
+	case common.ChannelStatusAutoDisabled:
+		return "auto_disabled"
+	default:
+		return "unknown"
+	}
+}
+
+// channelCollector 在每次抓取时读取渠道缓存生成 gauge，不需要在渠道状态变化时主动更新
+type channelCollector struct{}
+
+func (channelCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- channelsDesc
+	ch <- channelStatusDesc
+	ch <- channelKeysDesc
+}
+
+func (channelCollector) Collect(ch chan<- prometheus.Metric) {
+	provider, _ := channelStatsProvider.Load().(func() []ChannelStat)
+	if provider == nil {
+		return
+	}
+	counts := map[string]int{
+		"enabled":           0,
+		"manually_disabled": 0,
+		"auto_disabled":     0,
+	}
+	for _, stat := range provider() {
+		counts[channelStatusLabel(stat.Status)]++
+		id := channelLabel(stat.Id)
+		ch <- prometheus.MustNewConstMetric(channelStatusDesc, prometheus.GaugeValue, float64(stat.Status),
+			id, stat.Name, channelLabel(stat.Type))
+		if stat.KeyCount > 0 {
+			ch <- prometheus.MustNewConstMetric(channelKeysDesc, prometheus.GaugeValue, float64(stat.KeyCount-stat.DisabledKeys),
+				id, stat.Name, "enabled")
+			ch <- prometheus.MustNewConstMetric(channelKeysDesc, prometheus.GaugeValue, float64(stat.DisabledKeys),
+				id, stat.Name, "disabled")
+		}
+	}
+	for status, count := range counts {
+		ch <- prometheus.MustNewConstMetric(channelsDesc, prometheus.GaugeValue, float64(count), status)
+	}
+}
@@ -0,0 +1,144 @@
+package prommetrics
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "newapi"
+
+// registry 使用独立的 Registry，避免依赖库注册到默认 Registry 的指标混入
+var registry = prometheus.NewRegistry()
+
+var (
+	relayRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "relay",
+		Name:      "requests_total",
+		Help:      "Total number of relay requests by final status code.",
+	}, []string{"model", "group", "channel_id", "status_code"})
+
+	relayDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Subsystem: "relay",
+		Name:      "request_duration_seconds",
+		Help:      "End-to-end relay request latency, including retries.",
+		Buckets:   []float64{0.1, 0.25, 0.5, 1, 2.5, 5, 10, 20, 30, 60, 120, 300},
+	}, []string{"model", "group", "channel_id"})
+
+	relayFirstToken = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Subsystem: "relay",
+		Name:      "first_token_seconds",
+		Help:      "Time to first streamed response chunk.",
+		Buckets:   []float64{0.1, 0.25, 0.5, 1, 2, 3, 5, 10, 20, 30, 60},
+	}, []string{"model", "group", "channel_id"})
+
+	relayRetries = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "relay",
+		Name:      "retries_total",
+		Help:      "Total number of relay retries on another channel.",
+	}, []string{"model", "group"})
+
+	upstreamResponses = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "upstream",
+		Name:      "responses_total",
+		Help:      "Upstream attempts by channel and status code, one per retry attempt.",
+	}, []string{"channel_id", "model", "status_code"})
+
+	quotaConsumed = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "billing",
+		Name:      "quota_consumed_total",
+		Help:      "Total quota consumed.",
+	}, []string{"model", "group", "channel_id"})
+
+	tokensConsumed = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "billing",
+		Name:      "tokens_total",
+		Help:      "Total billed tokens by type (prompt/completion).",
+	}, []string{"model", "group", "type"})
+)
+
+func init() {
+	registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		relayRequests,
+		relayDuration,
+		relayFirstToken,
+		relayRetries,
+		upstreamResponses,
+		quotaConsumed,
+		tokensConsumed,
+		channelCollector{},
+	)
+}
+
+// Handler 返回 /metrics 的 HTTP handler
+func Handler() http.Handler {
+	return promhttp.HandlerFor(registry, promhttp.HandlerOpts{})
+}
+
+func groupLabel(group string) string {
+	if group == "" {
+		return "default"
+	}
+	return group
+}
+
+func channelLabel(channelId int) string {
+	return strconv.Itoa(channelId)
+}
+
+// RecordRelayRequest 记录一次完整的 relay 请求（含重试），firstToken 为 0 表示非流式或未返回内容
+func RecordRelayRequest(model string, group string, channelId int, statusCode int, duration time.Duration, firstToken time.Duration, retries int) {
+	if !common.MetricsEnabled {
+		return
+	}
+	group = groupLabel(group)
+	channel := channelLabel(channelId)
+	relayRequests.WithLabelValues(model, group, channel, strconv.Itoa(statusCode)).Inc()
+	relayDuration.WithLabelValues(model, group, channel).Observe(duration.Seconds())
+	if firstToken > 0 {
+		relayFirstToken.WithLabelValues(model, group, channel).Observe(firstToken.Seconds())
+	}
+	if retries > 0 {
+		relayRetries.WithLabelValues(model, group).Add(float64(retries))
+	}
+}
+
+// RecordUpstreamResponse 记录单次上游尝试的结果
+func RecordUpstreamResponse(channelId int, model string, statusCode int) {
+	if !common.MetricsEnabled {
+		return
+	}
+	upstreamResponses.WithLabelValues(channelLabel(channelId), model, strconv.Itoa(statusCode)).Inc()
+}
+
+// RecordQuotaConsumed 记录一次扣费
+func RecordQuotaConsumed(model string, group string, channelId int, quota int, promptTokens int, completionTokens int) {
+	if !common.MetricsEnabled {
+		return
+	}
+	group = groupLabel(group)
+	if quota > 0 {
+		quotaConsumed.WithLabelValues(model, group, channelLabel(channelId)).Add(float64(quota))
+	}
+	if promptTokens > 0 {
+		tokensConsumed.WithLabelValues(model, group, "prompt").Add(float64(promptTokens))
+	}
+	if completionTokens > 0 {
+		tokensConsumed.WithLabelValues(model, group, "completion").Add(float64(completionTokens))
+	}
+}
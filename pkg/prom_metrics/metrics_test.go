@@ -0,0 +1,43 @@
+package prommetrics
+
+import (
+	"testing"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRecordRelayRequest(t *testing.T) {
+	common.MetricsEnabled = true
+	t.Cleanup(func() { common.MetricsEnabled = false })
+
+	RecordRelayRequest("gpt-test", "", 7, 200, time.Second, 0, 2)
+	require.Equal(t, float64(1), testutil.ToFloat64(relayRequests.WithLabelValues("gpt-test", "default", "7", "200")))
+	require.Equal(t, float64(2), testutil.ToFloat64(relayRetries.WithLabelValues("gpt-test", "default")))
+
+	RecordQuotaConsumed("gpt-test", "vip", 7, 1500, 10, 20)
+	require.Equal(t, float64(1500), testutil.ToFloat64(quotaConsumed.WithLabelValues("gpt-test", "vip", "7")))
+	require.Equal(t, float64(20), testutil.ToFloat64(tokensConsumed.WithLabelValues("gpt-test", "vip", "completion")))
+}
+
+func TestRecordDisabled(t *testing.T) {
+	common.MetricsEnabled = false
+	RecordUpstreamResponse(9, "gpt-disabled", 500)
+	require.Equal(t, 0, testutil.CollectAndCount(upstreamResponses, "newapi_upstream_responses_total"))
+}
+
+func TestChannelCollector(t *testing.T) {
+	SetChannelStatsProvider(func() []ChannelStat {
+		return []ChannelStat{
+			{Id: 1, Name: "a", Type: 1, Status: common.ChannelStatusEnabled, KeyCount: 3, DisabledKeys: 1},
+			{Id: 2, Name: "b", Type: 1, Status: common.ChannelStatusAutoDisabled},
+		}
+	})
+	t.Cleanup(func() { SetChannelStatsProvider(nil) })
+
+	// 3 个状态计数 + 2 个渠道状态 + 2 个 Key 状态
+	require.Equal(t, 7, testutil.CollectAndCount(channelCollector{}))
+}
@@ -0,0 +1,172 @@
+package redact
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+var placeholderPattern = regexp.MustCompile(`\[[A-Z0-9_]+_[0-9]+\]`)
+
+// Pseudonymizer 把识别结果替换为 [EMAIL_1] 形式的占位符，同一个值在一次请求中始终使用同一个占位符，
+// 并保留占位符与原值的对应关系，用于在响应中还原
+type Pseudonymizer struct {
+	redactor *Redactor
+
+	mu            sync.Mutex
+	byValue       map[string]string
+	byPlaceholder map[string]string
+	counters      map[string]int
+	counts        map[string]int
+	maxLen        int
+}
+
+func NewPseudonymizer(redactor *Redactor) *Pseudonymizer {
+	return &Pseudonymizer{
+		redactor:      redactor,
+		byValue:       make(map[string]string),
+		byPlaceholder: make(map[string]string),
+		counters:      make(map[string]int),
+		counts:        make(map[string]int),
+	}
+}
+
+// Pseudonymize 替换文本中的识别结果
+func (p *Pseudonymizer) Pseudonymize(s string) string {
+	matches := p.redactor.FindAll(s)
+	if len(matches) == 0 {
+		return s
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	var sb strings.Builder
+	sb.Grow(len(s))
+	last := 0
+	for _, m := range matches {
+		sb.WriteString(s[last:m.Start])
+		sb.WriteString(p.placeholderLocked(m.Rule.Name, s[m.Start:m.End]))
+		last = m.End
+		p.counts[m.Rule.Name]++
+	}
+	sb.WriteString(s[last:])
+	return sb.String()
+}
+
+func (p *Pseudonymizer) placeholderLocked(name string, value string) string {
+	if placeholder, ok := p.byValue[value]; ok {
+		return placeholder
+	}
+	label := placeholderLabel(name)
+	p.counters[label]++
+	placeholder := "[" + label + "_" + strconv.Itoa(p.counters[label]) + "]"
+	p.byValue[value] = placeholder
+	p.byPlaceholder[placeholder] = value
+	if len(placeholder) > p.maxLen {
+		p.maxLen = len(placeholder)
+	}
+	return placeholder
+}
+
+// placeholderLabel 规则名转为大写，字母与数字以外的字符换成下划线
+func placeholderLabel(name string) string {
+	label := []byte(strings.ToUpper(name))
+	for i, c := range label {
+		if (c < 'A' || c > 'Z') && (c < '0' || c > '9') {
+			label[i] = '_'
+		}
+	}
+	if len(label) == 0 {
+		return "PII"
+	}
+	return string(label)
+}
+
+// Restore 把文本中本次生成的占位符还原为原值，未知的占位符保持不变
+func (p *Pseudonymizer) Restore(s string) string {
+	if !strings.Contains(s, "[") {
+		return s
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if len(p.byPlaceholder) == 0 {
+		return s
+	}
+	return placeholderPattern.ReplaceAllStringFunc(s, func(placeholder string) string {
+		if value, ok := p.byPlaceholder[placeholder]; ok {
+			return value
+		}
+		return placeholder
+	})
+}
+
+// Counts 返回各规则的替换次数
+func (p *Pseudonymizer) Counts() map[string]int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	counts := make(map[string]int, len(p.counts))
+	for name, count := range p.counts {
+		counts[name] = count
+	}
+	return counts
+}
+
+// Replaced 判断是否替换过任何内容
+func (p *Pseudonymizer) Replaced() bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return len(p.byPlaceholder) > 0
+}
+
+func (p *Pseudonymizer) maxPlaceholderLen() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.maxLen
+}
+
+// StreamRestorer 在流式输出中还原占位符。占位符可能被拆在相邻的片段中，
+// 末尾疑似未写完的占位符会暂时保留，直到下一段文本或 Flush
+type StreamRestorer struct {
+	p       *Pseudonymizer
+	pending string
+}
+
+func (p *Pseudonymizer) NewStreamRestorer() *StreamRestorer {
+	return &StreamRestorer{p: p}
+}
+
+// Write 返回可以立即输出的还原后的文本
+func (r *StreamRestorer) Write(text string) string {
+	text = r.pending + text
+	r.pending = ""
+	if i := strings.LastIndexByte(text, '['); i >= 0 && isPlaceholderPrefix(text[i:], r.p.maxPlaceholderLen()) {
+		text, r.pending = text[:i], text[i:]
+	}
+	return r.p.Restore(text)
+}
+
+// Flush 返回保留的文本
+func (r *StreamRestorer) Flush() string {
+	text := r.pending
+	r.pending = ""
+	return r.p.Restore(text)
+}
+
+// Pending 判断是否有保留的文本
+func (r *StreamRestorer) Pending() bool {
+	return r.pending != ""
+}
+
+// isPlaceholderPrefix 判断 s 是否可能是一个尚未写完的占位符
+func isPlaceholderPrefix(s string, maxLen int) bool {
+	if len(s) >= maxLen {
+		return false
+	}
+	for i := 1; i < len(s); i++ {
+		c := s[i]
+		if (c < 'A' || c > 'Z') && (c < '0' || c > '9') && c != '_' {
+			return false
+		}
+	}
+	return true
+}
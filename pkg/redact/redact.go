@@ -0,0 +1,161 @@
+// Package redact 识别文本中的密钥与个人信息（API Key、邮箱、手机号、身份证号、银行卡号），
+// 并按规则替换。内置规则之外可以追加管理员配置的正则规则，规则按顺序匹配，先匹配的规则优先
+package redact
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// Rule 一条识别规则，Validate 非空时匹配结果还需要通过校验（例如银行卡号的 Luhn 校验）
+type Rule struct {
+	Name        string
+	Pattern     *regexp.Regexp
+	Replacement string
+	Validate    func(match string) bool
+}
+
+var builtinRules = []Rule{
+	{Name: "api_key", Pattern: regexp.MustCompile(`\b(?:sk|pk|rk|ak)-[A-Za-z0-9_\-]{16,}`)},
+	{Name: "api_key", Pattern: regexp.MustCompile(`\bAKIA[0-9A-Z]{16}\b`)},
+	{Name: "api_key", Pattern: regexp.MustCompile(`\bAIza[0-9A-Za-z_\-]{35}\b`)},
+	{Name: "api_key", Pattern: regexp.MustCompile(`(?i)\bbearer\s+[A-Za-z0-9._~+/\-]{16,}=*`)},
+	{Name: "email", Pattern: regexp.MustCompile(`[A-Za-z0-9._%+\-]+@[A-Za-z0-9.\-]+\.[A-Za-z]{2,}`)},
+	{Name: "id_card", Pattern: regexp.MustCompile(`\b[1-9]\d{5}(?:18|19|20)\d{2}(?:0[1-9]|1[0-2])(?:0[1-9]|[12]\d|3[01])\d{3}[\dXx]\b`), Validate: validChineseIdCard},
+	{Name: "bank_card", Pattern: regexp.MustCompile(`\b\d{4}(?:[ \-]?\d{4}){2}[ \-]?\d{1,7}\b`), Validate: validLuhn},
+	{Name: "phone", Pattern: regexp.MustCompile(`(?:\+?86[ \-]?)?\b1[3-9]\d{9}\b`)},
+}
+
+// Builtin 返回内置规则
+func Builtin() []Rule {
+	return builtinRules
+}
+
+// Compile 编译一条自定义规则，replacement 为空时使用默认的 [REDACTED:name]
+func Compile(name string, pattern string, replacement string) (Rule, error) {
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return Rule{}, fmt.Errorf("invalid redaction pattern %q: %w", pattern, err)
+	}
+	if name == "" {
+		name = "custom"
+	}
+	return Rule{Name: name, Pattern: re, Replacement: replacement}, nil
+}
+
+// Match 一处识别结果，Start/End 为字节下标
+type Match struct {
+	Rule  *Rule
+	Start int
+	End   int
+}
+
+// Redactor 按顺序应用一组规则
+type Redactor struct {
+	rules []Rule
+}
+
+func New(rules ...Rule) *Redactor {
+	return &Redactor{rules: rules}
+}
+
+// Empty 判断是否没有任何规则
+func (r *Redactor) Empty() bool {
+	return r == nil || len(r.rules) == 0
+}
+
+// FindAll 返回文本中所有互不重叠的识别结果，按位置排序。多条规则命中同一位置时靠前的规则优先
+func (r *Redactor) FindAll(s string) []Match {
+	if r.Empty() || s == "" {
+		return nil
+	}
+	var matches []Match
+	for i := range r.rules {
+		rule := &r.rules[i]
+		for _, loc := range rule.Pattern.FindAllStringIndex(s, -1) {
+			if loc[0] == loc[1] || overlaps(matches, loc[0], loc[1]) {
+				continue
+			}
+			if rule.Validate != nil && !rule.Validate(s[loc[0]:loc[1]]) {
+				continue
+			}
+			matches = append(matches, Match{Rule: rule, Start: loc[0], End: loc[1]})
+		}
+	}
+	sort.Slice(matches, func(i, j int) bool { return matches[i].Start < matches[j].Start })
+	return matches
+}
+
+// Redact 替换所有识别结果，返回替换后的文本与各规则的命中次数
+func (r *Redactor) Redact(s string) (string, map[string]int) {
+	matches := r.FindAll(s)
+	if len(matches) == 0 {
+		return s, nil
+	}
+	counts := make(map[string]int)
+	var sb strings.Builder
+	sb.Grow(len(s))
+	last := 0
+	for _, m := range matches {
+		sb.WriteString(s[last:m.Start])
+		sb.WriteString(m.Rule.replacement())
+		last = m.End
+		counts[m.Rule.Name]++
+	}
+	sb.WriteString(s[last:])
+	return sb.String(), counts
+}
+
+func (rule *Rule) replacement() string {
+	if rule.Replacement != "" {
+		return rule.Replacement
+	}
+	return "[REDACTED:" + rule.Name + "]"
+}
+
+func overlaps(matches []Match, start int, end int) bool {
+	for _, m := range matches {
+		if start < m.End && m.Start < end {
+			return true
+		}
+	}
+	return false
+}
+
+// validLuhn 银行卡号的 Luhn 校验
+func validLuhn(match string) bool {
+	sum, count := 0, 0
+	double := false
+	for i := len(match) - 1; i >= 0; i-- {
+		c := match[i]
+		if c < '0' || c > '9' {
+			continue
+		}
+		d := int(c - '0')
+		if double {
+			d *= 2
+			if d > 9 {
+				d -= 9
+			}
+		}
+		sum += d
+		count++
+		double = !double
+	}
+	return count >= 13 && count <= 19 && sum%10 == 0
+}
+
+// validChineseIdCard 校验 18 位身份证号的校验码
+func validChineseIdCard(match string) bool {
+	if len(match) != 18 {
+		return false
+	}
+	weights := []int{7, 9, 10, 5, 8, 4, 2, 1, 6, 3, 7, 9, 10, 5, 8, 4, 2}
+	sum := 0
+	for i := 0; i < 17; i++ {
+		sum += int(match[i]-'0') * weights[i]
+	}
+	return strings.EqualFold(match[17:], string("10X98765432"[sum%11]))
+}
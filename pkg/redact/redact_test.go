@@ -0,0 +1,49 @@
+package redact
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestRedactBuiltin(t *testing.T) {
+	r := New(Builtin()...)
+	input := `{"content":"mail alice@example.com, call 13812345678, key sk-abcdefghijklmnop1234, id 11010519491231002X, card 4111 1111 1111 1111, order 4111111111111112"}`
+	out, counts := r.Redact(input)
+	require.Equal(t, `{"content":"mail [REDACTED:email], call [REDACTED:phone], key [REDACTED:api_key], id [REDACTED:id_card], card [REDACTED:bank_card], order 4111111111111112"}`, out)
+	require.Equal(t, map[string]int{"email": 1, "phone": 1, "api_key": 1, "id_card": 1, "bank_card": 1}, counts)
+}
+
+func TestRedactCustomRuleAndNoMatch(t *testing.T) {
+	rule, err := Compile("employee_id", `EMP-\d{6}`, "EMP-******")
+	require.NoError(t, err)
+	r := New(rule)
+	out, counts := r.Redact("assigned to EMP-123456")
+	require.Equal(t, "assigned to EMP-******", out)
+	require.Equal(t, 1, counts["employee_id"])
+
+	out, counts = r.Redact("nothing here")
+	require.Equal(t, "nothing here", out)
+	require.Nil(t, counts)
+
+	_, err = Compile("bad", `(`, "")
+	require.Error(t, err)
+}
+
+func TestPseudonymizeAndRestore(t *testing.T) {
+	p := NewPseudonymizer(New(Builtin()...))
+	out := p.Pseudonymize("mail alice@example.com or bob@example.com, again alice@example.com, call 13812345678")
+	require.Equal(t, "mail [EMAIL_1] or [EMAIL_2], again [EMAIL_1], call [PHONE_1]", out)
+	require.Equal(t, map[string]int{"email": 3, "phone": 1}, p.Counts())
+	require.Equal(t, "reply to alice@example.com, not [EMAIL_9]", p.Restore("reply to [EMAIL_1], not [EMAIL_9]"))
+
+	r := p.NewStreamRestorer()
+	var sb strings.Builder
+	for _, chunk := range []string{"sent to [EMA", "IL_2] and [", "PHONE_1", "] [EM"} {
+		sb.WriteString(r.Write(chunk))
+	}
+	require.True(t, r.Pending())
+	sb.WriteString(r.Flush())
+	require.Equal(t, "sent to bob@example.com and 13812345678 [EM", sb.String())
+}
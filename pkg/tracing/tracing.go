@@ -0,0 +1,131 @@
+// Package tracing 封装 OpenTelemetry 链路追踪：OTLP 导出、span 创建与 W3C traceparent 透传。
+// 未开启 OTEL_TRACING_ENABLED 时使用全局 noop provider，所有调用开销可以忽略。
+package tracing
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/QuantumNous/new-api/common"
+
+	"github.com/gin-gonic/gin"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const tracerName = "github.com/QuantumNous/new-api"
+
+// span 属性名
+const (
+	AttrRequestId = attribute.Key("newapi.request_id")
+	AttrChannelId = attribute.Key("newapi.channel_id")
+	AttrModel     = attribute.Key("newapi.model")
+	AttrGroup     = attribute.Key("newapi.group")
+	AttrUserId    = attribute.Key("newapi.user_id")
+	AttrRetry     = attribute.Key("newapi.retry")
+)
+
+// Init 初始化全局 TracerProvider，返回的函数用于退出时 flush 未导出的 span。
+// endpoint、headers、采样率等均通过标准 OTEL_* 环境变量配置。
+func Init(ctx context.Context) (func(context.Context) error, error) {
+	if !common.TracingEnabled {
+		return func(context.Context) error { return nil }, nil
+	}
+	exporter, err := otlptracehttp.New(ctx)
+	if err != nil {
+		return nil, err
+	}
+	res, err := resource.New(ctx,
+		resource.WithAttributes(
+			semconv.ServiceName("new-api"),
+			semconv.ServiceVersion(common.Version),
+		),
+		resource.WithFromEnv(),
+		resource.WithTelemetrySDK(),
+	)
+	if err != nil {
+		return nil, err
+	}
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(res),
+	)
+	otel.SetTracerProvider(provider)
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(
+		propagation.TraceContext{},
+		propagation.Baggage{},
+	))
+	return provider.Shutdown, nil
+}
+
+// Start 以 ctx 中的 span 为父级创建子 span
+func Start(ctx context.Context, name string, attrs ...attribute.KeyValue) (context.Context, trace.Span) {
+	return otel.Tracer(tracerName).Start(ctx, name, trace.WithAttributes(attrs...))
+}
+
+// StartServer 从入站请求头中提取上游调用方的 traceparent，并创建 server span
+func StartServer(ctx context.Context, header http.Header, name string, attrs ...attribute.KeyValue) (context.Context, trace.Span) {
+	ctx = otel.GetTextMapPropagator().Extract(ctx, propagation.HeaderCarrier(header))
+	return otel.Tracer(tracerName).Start(ctx, name,
+		trace.WithSpanKind(trace.SpanKindServer),
+		trace.WithAttributes(attrs...),
+	)
+}
+
+// StartClient 创建出站请求的 client span
+func StartClient(ctx context.Context, name string, attrs ...attribute.KeyValue) (context.Context, trace.Span) {
+	return otel.Tracer(tracerName).Start(ctx, name,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(attrs...),
+	)
+}
+
+// End 结束 span，err 不为空时记录错误并标记状态
+func End(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+// InjectHeaders 将 ctx 中的 trace context 以 W3C traceparent/tracestate 写入出站请求头
+func InjectHeaders(ctx context.Context, header http.Header) {
+	otel.GetTextMapPropagator().Inject(ctx, propagation.HeaderCarrier(header))
+}
+
+// RelayAttributes 生成 relay 各阶段 span 的公共属性
+func RelayAttributes(requestId string, channelId int, model string, group string) []attribute.KeyValue {
+	attrs := []attribute.KeyValue{
+		AttrRequestId.String(requestId),
+		AttrModel.String(model),
+		AttrGroup.String(group),
+	}
+	if channelId > 0 {
+		attrs = append(attrs, AttrChannelId.Int(channelId))
+	}
+	return attrs
+}
+
+// StartGin 以 c.Request 的 context 为父级创建子 span 并写回 c.Request，
+// 使后续阶段创建的 span 挂在其下；返回的 end 会结束 span 并恢复父 context
+func StartGin(c *gin.Context, name string, attrs ...attribute.KeyValue) (trace.Span, func(error)) {
+	if c.Request == nil {
+		_, span := Start(context.Background(), name, attrs...)
+		return span, func(err error) { End(span, err) }
+	}
+	parent := c.Request.Context()
+	ctx, span := Start(parent, name, attrs...)
+	c.Request = c.Request.WithContext(ctx)
+	return span, func(err error) {
+		End(span, err)
+		c.Request = c.Request.WithContext(parent)
+	}
+}
@@ -0,0 +1,65 @@
+package tracing
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func setupTestProvider(t *testing.T) *tracetest.SpanRecorder {
+	t.Helper()
+	recorder := tracetest.NewSpanRecorder()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+	prevProvider := otel.GetTracerProvider()
+	prevPropagator := otel.GetTextMapPropagator()
+	otel.SetTracerProvider(provider)
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	t.Cleanup(func() {
+		otel.SetTracerProvider(prevProvider)
+		otel.SetTextMapPropagator(prevPropagator)
+	})
+	return recorder
+}
+
+func TestStartGinNestsAndRestoresContext(t *testing.T) {
+	recorder := setupTestProvider(t)
+	gin.SetMode(gin.TestMode)
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	c.Request = httptest.NewRequest(http.MethodPost, "/v1/chat/completions", nil)
+	parent := c.Request.Context()
+
+	outer, endOuter := StartGin(c, "relay.attempt", AttrChannelId.Int(1))
+	_, endInner := StartGin(c, "relay.do_request")
+	endInner(nil)
+	require.Equal(t, outer.SpanContext(), trace.SpanContextFromContext(c.Request.Context()))
+	endOuter(nil)
+	require.Equal(t, parent, c.Request.Context())
+
+	spans := recorder.Ended()
+	require.Len(t, spans, 2)
+	require.Equal(t, "relay.do_request", spans[0].Name())
+	require.Equal(t, outer.SpanContext().SpanID(), spans[0].Parent().SpanID())
+}
+
+func TestInjectHeadersPropagatesTraceparent(t *testing.T) {
+	setupTestProvider(t)
+	incoming := http.Header{}
+	incoming.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+
+	ctx, span := StartServer(t.Context(), incoming, "POST /v1/chat/completions")
+	defer span.End()
+	require.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", span.SpanContext().TraceID().String())
+
+	outgoing := http.Header{}
+	InjectHeaders(ctx, outgoing)
+	require.Contains(t, outgoing.Get("traceparent"), "4bf92f3577b34da6a3ce929d0e0e4736")
+	require.Contains(t, outgoing.Get("traceparent"), span.SpanContext().SpanID().String())
+}
@@ -13,6 +13,8 @@ import (
 
 	common2 "github.com/QuantumNous/new-api/common"
 	"github.com/QuantumNous/new-api/logger"
+	channelcooldown "github.com/QuantumNous/new-api/pkg/channel_cooldown"
+	"github.com/QuantumNous/new-api/pkg/tracing"
 	"github.com/QuantumNous/new-api/relay/common"
 	"github.com/QuantumNous/new-api/relay/constant"
 	"github.com/QuantumNous/new-api/relay/helper"
@@ -23,6 +25,7 @@ import (
 	"github.com/bytedance/gopkg/util/gopool"
 	"github.com/gin-gonic/gin"
 	"github.com/gorilla/websocket"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
 )
 
 // applyUpstreamContentLength populates req.ContentLength when the upstream
@@ -386,6 +389,9 @@ func DoWssRequest(a Adaptor, c *gin.Context, info *common.RelayInfo, requestBody
 		targetHeader.Set(key, value)
 	}
 	targetHeader.Set("Content-Type", c.Request.Header.Get("Content-Type"))
+	if info.ChannelSetting.PropagateTraceContext {
+		tracing.InjectHeaders(c.Request.Context(), targetHeader)
+	}
 	targetConn, _, err := websocket.DefaultDialer.Dial(fullRequestURL, targetHeader)
 	if err != nil {
 		return nil, fmt.Errorf("dial failed to %s: %w", fullRequestURL, err)
@@ -514,18 +520,38 @@ func doRequest(c *gin.Context, req *http.Request, info *common.RelayInfo) (*http
 		}
 	}
 
+	spanCtx, span := tracing.StartClient(c.Request.Context(), "relay.upstream_request", append(info.TraceAttributes(),
+		semconv.HTTPRequestMethodKey.String(req.Method),
+		semconv.ServerAddress(req.URL.Hostname()),
+	)...)
+	if info.ChannelSetting.PropagateTraceContext {
+		tracing.InjectHeaders(spanCtx, req.Header)
+	}
 	resp, err := client.Do(req)
 	if err != nil {
+		tracing.End(span, err)
 		logger.LogError(c, "do request failed: "+err.Error())
 		return nil, types.NewError(err, types.ErrorCodeDoRequestFailed, types.ErrOptionWithHideErrMsg("upstream error: do request failed"))
 	}
 	if resp == nil {
+		tracing.End(span, errors.New("resp is nil"))
 		return nil, errors.New("resp is nil")
 	}
+	span.SetAttributes(semconv.HTTPResponseStatusCode(resp.StatusCode))
+	tracing.End(span, nil)
 
 	if upID := resp.Header.Get(common2.RequestIdKey); upID != "" {
 		c.Set(common2.UpstreamRequestIdKey, upID)
 	}
+	if info.ChannelMeta != nil {
+		channelcooldown.Observe(info.ChannelId, info.ChannelMultiKeyIndex, resp.StatusCode, resp.Header)
+	}
+	if apiErr := helper.RestorePIIResponse(info, resp); apiErr != nil {
+		return nil, apiErr
+	}
+	if apiErr := helper.ModerateResponse(c, info, resp); apiErr != nil {
+		return nil, apiErr
+	}
 
 	_ = req.Body.Close()
 	_ = c.Request.Body.Close()
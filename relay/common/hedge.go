@@ -0,0 +1,142 @@
+package common
+
+import (
+	"maps"
+	"slices"
+	"sync/atomic"
+	"time"
+)
+
+// 对冲请求中的两次尝试
+const (
+	HedgeRolePrimary int32 = 1
+	HedgeRoleBackup  int32 = 2
+)
+
+// HedgeRace 对冲请求的竞速状态，由主尝试与备用尝试共享。先向客户端写出首字节的一方胜出，
+// 另一方被取消，不向用户计费
+type HedgeRace struct {
+	PrimaryChannelId int
+	Threshold        time.Duration
+
+	backupChannelId atomic.Int64
+	winner          atomic.Int32
+	claimed         chan struct{}
+	abandonedQuota  atomic.Int64
+	abandonedTokens atomic.Int64
+}
+
+func NewHedgeRace(primaryChannelId int, threshold time.Duration) *HedgeRace {
+	return &HedgeRace{
+		PrimaryChannelId: primaryChannelId,
+		Threshold:        threshold,
+		claimed:          make(chan struct{}),
+	}
+}
+
+// Claim 尝试以 role 的身份胜出，已经胜出的一方重复调用也返回 true
+func (r *HedgeRace) Claim(role int32) bool {
+	if r.winner.CompareAndSwap(0, role) {
+		close(r.claimed)
+		return true
+	}
+	return r.winner.Load() == role
+}
+
+// Winner 返回胜出的一方，尚未决出时为 0
+func (r *HedgeRace) Winner() int32 {
+	return r.winner.Load()
+}
+
+// Claimed 在决出胜者时关闭
+func (r *HedgeRace) Claimed() <-chan struct{} {
+	return r.claimed
+}
+
+func (r *HedgeRace) SetBackupChannelId(channelId int) {
+	r.backupChannelId.Store(int64(channelId))
+}
+
+func (r *HedgeRace) BackupChannelId() int {
+	return int(r.backupChannelId.Load())
+}
+
+// AddAbandonedCost 记录被放弃的一方在上游已经产生的消耗
+func (r *HedgeRace) AddAbandonedCost(quota int, tokens int) {
+	r.abandonedQuota.Add(int64(quota))
+	r.abandonedTokens.Add(int64(tokens))
+}
+
+// LogInfo 返回写入消费日志的对冲信息，没有发出备用请求时返回 nil
+func (r *HedgeRace) LogInfo() map[string]interface{} {
+	if r == nil || r.BackupChannelId() == 0 {
+		return nil
+	}
+	winner := "none"
+	switch r.Winner() {
+	case HedgeRolePrimary:
+		winner = "primary"
+	case HedgeRoleBackup:
+		winner = "backup"
+	}
+	return map[string]interface{}{
+		"primary_channel":  r.PrimaryChannelId,
+		"backup_channel":   r.BackupChannelId(),
+		"threshold_ms":     r.Threshold.Milliseconds(),
+		"winner":           winner,
+		"abandoned_quota":  r.abandonedQuota.Load(),
+		"abandoned_tokens": r.abandonedTokens.Load(),
+	}
+}
+
+// HedgeAttempt 对冲请求中的一次尝试
+type HedgeAttempt struct {
+	Race *HedgeRace
+	Role int32
+}
+
+// Abandoned 判断本次尝试是否已被另一方抢先，被放弃的尝试不结算、不记录消费日志
+func (a *HedgeAttempt) Abandoned() bool {
+	if a == nil {
+		return false
+	}
+	winner := a.Race.Winner()
+	return winner != 0 && winner != a.Role
+}
+
+// CloneForAttempt 复制一份可以与原请求并发使用的 RelayInfo，用于同一请求的另一次转发尝试，转发过程中会被修改的字段各自独立，
+// 计费会话仍然共享，对冲请求由胜出的一方结算
+func (info *RelayInfo) CloneForAttempt() *RelayInfo {
+	clone := *info
+	clone.RequestHeaders = maps.Clone(info.RequestHeaders)
+	clone.RuntimeHeadersOverride = maps.Clone(info.RuntimeHeadersOverride)
+	clone.ParamOverrideAudit = slices.Clone(info.ParamOverrideAudit)
+	clone.RequestConversionChain = slices.Clone(info.RequestConversionChain)
+	clone.StreamStatus = nil
+	clone.CompletionFilter = nil
+	clone.PIIRedaction = nil
+	if info.ClaudeConvertInfo != nil {
+		convertInfo := *info.ClaudeConvertInfo
+		if convertInfo.Usage != nil {
+			usage := *convertInfo.Usage
+			convertInfo.Usage = &usage
+		}
+		clone.ClaudeConvertInfo = &convertInfo
+	}
+	if info.ResponsesUsageInfo != nil {
+		tools := make(map[string]*BuildInToolInfo, len(info.ResponsesUsageInfo.BuiltInTools))
+		for name, tool := range info.ResponsesUsageInfo.BuiltInTools {
+			if tool != nil {
+				toolCopy := *tool
+				tool = &toolCopy
+			}
+			tools[name] = tool
+		}
+		clone.ResponsesUsageInfo = &ResponsesUsageInfo{BuiltInTools: tools}
+	}
+	if info.ChannelMeta != nil {
+		channelMeta := *info.ChannelMeta
+		clone.ChannelMeta = &channelMeta
+	}
+	return &clone
+}
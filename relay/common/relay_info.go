@@ -12,6 +12,9 @@ import (
 	"github.com/QuantumNous/new-api/constant"
 	"github.com/QuantumNous/new-api/dto"
 	"github.com/QuantumNous/new-api/pkg/billingexpr"
+	completionfilter "github.com/QuantumNous/new-api/pkg/completion_filter"
+	"github.com/QuantumNous/new-api/pkg/redact"
+	"github.com/QuantumNous/new-api/pkg/tracing"
 	relayconstant "github.com/QuantumNous/new-api/relay/constant"
 	"github.com/QuantumNous/new-api/setting/model_setting"
 	"github.com/QuantumNous/new-api/types"
@@ -19,6 +22,7 @@ import (
 	"github.com/gin-gonic/gin"
 	"github.com/gorilla/websocket"
 	"github.com/tidwall/gjson"
+	"go.opentelemetry.io/otel/attribute"
 )
 
 type ThinkingContentInfo struct {
@@ -103,6 +107,7 @@ type RelayInfo struct {
 	UsePrice               bool
 	RelayMode              int
 	OriginModelName        string
+	FallbackFromModel      string // 跨模型回退时客户端原本请求的模型，OriginModelName 为实际提供服务的模型
 	RequestURLPath         string
 	RequestHeaders         map[string]string
 	ShouldIncludeUsage     bool
@@ -122,6 +127,7 @@ type RelayInfo struct {
 	SendResponseCount      int
 	ReceivedResponseCount  int
 	FinalPreConsumedQuota  int // 最终预消耗的配额
+	ModerationQuota        int // 输入审核调用的费用，已预留在计费会话中，结算时计入实际消耗
 	// ForcePreConsume 为 true 时禁用 BillingSession 的信任额度旁路，
 	// 强制预扣全额。用于异步任务（视频/音乐生成等），因为请求返回后任务仍在运行，
 	// 必须在提交前锁定全额。
@@ -130,8 +136,10 @@ type RelayInfo struct {
 	// 免费模型时为 nil。
 	Billing BillingSettler
 	// BillingSource indicates whether this request is billed from wallet quota or subscription.
-	// "" or "wallet" => wallet; "subscription" => subscription
+	// "" or "wallet" => wallet; "subscription" => subscription; "organization_wallet" => organization wallet
 	BillingSource string
+	// OrganizationId is set when the request is billed to the user's organization (wallet or subscription)
+	OrganizationId int
 	// SubscriptionId is the user_subscriptions.id used when BillingSource == "subscription"
 	SubscriptionId int
 	// SubscriptionPreConsumed is the amount pre-consumed on subscription item (quota units or 1)
@@ -179,6 +187,16 @@ type RelayInfo struct {
 
 	StreamStatus *StreamStatus
 
+	// Hedge 非空表示本次尝试属于对冲请求，被放弃的一方不结算
+	Hedge *HedgeAttempt
+
+	// Shadow 非空表示本次请求是影子流量，不向用户计费，用量记录在这里用于对比
+	Shadow *ShadowAttempt
+	// CompletionFilter 非空表示本次尝试检查了输出中的敏感词，命中情况记录在消费日志中
+	CompletionFilter *completionfilter.Filter
+	// PIIRedaction 非空表示本次尝试对提示词做了脱敏，保存占位符与原值的对应关系
+	PIIRedaction *redact.Pseudonymizer
+
 	ThinkingContentInfo
 	TokenCountMeta
 	*ClaudeConvertInfo
@@ -667,6 +685,15 @@ func (info *RelayInfo) HasSendResponse() bool {
 	return info.FirstResponseTime.After(info.StartTime)
 }
 
+// TraceAttributes 返回 relay 各阶段 span 的公共属性
+func (info *RelayInfo) TraceAttributes() []attribute.KeyValue {
+	channelId := 0
+	if info.ChannelMeta != nil {
+		channelId = info.ChannelId
+	}
+	return tracing.RelayAttributes(info.RequestId, channelId, info.OriginModelName, info.UsingGroup)
+}
+
 type TaskRelayInfo struct {
 	Action       string
 	OriginTaskID string
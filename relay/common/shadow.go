@@ -0,0 +1,9 @@
+package common
+
+import "github.com/QuantumNous/new-api/dto"
+
+// ShadowAttempt 影子流量请求的结算结果：响应不会返回给客户端，用量只计入影子渠道的成本
+type ShadowAttempt struct {
+	Usage *dto.Usage
+	Quota int
+}
@@ -52,6 +52,8 @@ const (
 	RelayModeGemini
 
 	RelayModeResponsesCompact
+
+	RelayModeBatches
 )
 
 func Path2RelayMode(path string) int {
@@ -84,6 +86,8 @@ func Path2RelayMode(path string) int {
 		relayMode = RelayModeAudioTranslation
 	} else if strings.HasPrefix(path, "/v1/rerank") {
 		relayMode = RelayModeRerank
+	} else if strings.HasPrefix(path, "/v1/batches") {
+		relayMode = RelayModeBatches
 	} else if strings.HasPrefix(path, "/v1/realtime") {
 		relayMode = RelayModeRealtime
 	} else if strings.HasPrefix(path, "/v1beta/models") || strings.HasPrefix(path, "/v1/models") {
@@ -94,6 +98,11 @@ func Path2RelayMode(path string) int {
 	return relayMode
 }
 
+// IsCountTokensPath 判断是否为 Anthropic / Gemini 的 token 计数接口
+func IsCountTokensPath(path string) bool {
+	return strings.HasSuffix(path, "/messages/count_tokens") || strings.HasSuffix(path, ":countTokens")
+}
+
 func Path2RelayModeMidjourney(path string) int {
 	relayMode := RelayModeUnknown
 	if strings.HasSuffix(path, "/mj/submit/action") {
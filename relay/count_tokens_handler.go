@@ -0,0 +1,122 @@
+package relay
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/constant"
+	"github.com/QuantumNous/new-api/dto"
+	"github.com/QuantumNous/new-api/logger"
+	"github.com/QuantumNous/new-api/relay/channel"
+	relaycommon "github.com/QuantumNous/new-api/relay/common"
+	"github.com/QuantumNous/new-api/relay/helper"
+	"github.com/QuantumNous/new-api/service"
+	"github.com/QuantumNous/new-api/setting/model_setting"
+	"github.com/QuantumNous/new-api/types"
+
+	"github.com/gin-gonic/gin"
+	"github.com/tidwall/sjson"
+)
+
+// countTokensAdaptor 复用渠道适配器的请求头、代理等设置，只替换请求地址
+type countTokensAdaptor struct {
+	channel.Adaptor
+	requestURL string
+}
+
+func (a *countTokensAdaptor) GetRequestURL(*relaycommon.RelayInfo) (string, error) {
+	return a.requestURL, nil
+}
+
+// CountTokensHelper 处理 Anthropic /v1/messages/count_tokens 与 Gemini models/{model}:countTokens。
+// 渠道原生支持时转发到上游，上游不支持或不可用时在本地估算；该接口不预扣也不结算额度
+func CountTokensHelper(c *gin.Context, info *relaycommon.RelayInfo) *types.NewAPIError {
+	info.InitChannelMeta(c)
+
+	if err := helper.ModelMappedHelper(c, info, info.Request); err != nil {
+		return types.NewError(err, types.ErrorCodeChannelModelMappedError, types.ErrOptionWithSkipRetry())
+	}
+
+	if requestURL, ok := nativeCountTokensURL(info); ok {
+		forwarded, err := forwardCountTokens(c, info, requestURL)
+		if forwarded {
+			return nil
+		}
+		if err != nil {
+			logger.LogWarn(c, "upstream count tokens unavailable, falling back to local estimate: "+err.Error())
+		}
+	}
+
+	meta := info.Request.GetTokenCountMeta()
+	tokens, err := service.CountRequestTokens(c, meta, info)
+	if err != nil {
+		return types.NewError(err, types.ErrorCodeCountTokenFailed, types.ErrOptionWithSkipRetry())
+	}
+	common.SetContextKey(c, constant.ContextKeyLocalCountTokens, true)
+	if info.RelayFormat == types.RelayFormatGemini {
+		c.JSON(http.StatusOK, dto.GeminiCountTokensResponse{TotalTokens: tokens})
+	} else {
+		c.JSON(http.StatusOK, dto.ClaudeCountTokensResponse{InputTokens: tokens})
+	}
+	return nil
+}
+
+// nativeCountTokensURL 返回上游原生计数接口的地址，仅 Anthropic 与 Gemini 官方格式的渠道支持
+func nativeCountTokensURL(info *relaycommon.RelayInfo) (string, bool) {
+	switch {
+	case info.RelayFormat == types.RelayFormatClaude && info.ApiType == constant.APITypeAnthropic:
+		return fmt.Sprintf("%s/v1/messages/count_tokens", info.ChannelBaseUrl), true
+	case info.RelayFormat == types.RelayFormatGemini && info.ApiType == constant.APITypeGemini:
+		version := model_setting.GetGeminiVersionSetting(info.UpstreamModelName)
+		return fmt.Sprintf("%s/%s/models/%s:countTokens", info.ChannelBaseUrl, version, info.UpstreamModelName), true
+	}
+	return "", false
+}
+
+// forwardCountTokens 将原始请求体转发到上游计数接口。上游返回 404/405/501 或 5xx 时视为不支持，
+// 返回 false 由调用方回退到本地估算；其余响应原样返回给客户端
+func forwardCountTokens(c *gin.Context, info *relaycommon.RelayInfo, requestURL string) (bool, error) {
+	storage, err := common.GetBodyStorage(c)
+	if err != nil {
+		return false, err
+	}
+	body, err := storage.Bytes()
+	if err != nil {
+		return false, err
+	}
+	if info.RelayFormat == types.RelayFormatClaude {
+		body, err = sjson.SetBytes(body, "model", info.UpstreamModelName)
+		if err != nil {
+			return false, err
+		}
+	}
+
+	adaptor := GetAdaptor(info.ApiType)
+	if adaptor == nil {
+		return false, fmt.Errorf("invalid api type: %d", info.ApiType)
+	}
+	adaptor.Init(info)
+	info.UpstreamRequestBodySize = int64(len(body))
+	resp, err := channel.DoApiRequest(&countTokensAdaptor{Adaptor: adaptor, requestURL: requestURL}, c, info, bytes.NewReader(body))
+	if err != nil {
+		return false, err
+	}
+	defer service.CloseResponseBodyGracefully(resp)
+
+	switch resp.StatusCode {
+	case http.StatusNotFound, http.StatusMethodNotAllowed, http.StatusNotImplemented:
+		return false, fmt.Errorf("upstream returned status %d", resp.StatusCode)
+	}
+	if resp.StatusCode >= http.StatusInternalServerError {
+		return false, fmt.Errorf("upstream returned status %d", resp.StatusCode)
+	}
+	responseBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return false, err
+	}
+	service.IOCopyBytesGracefully(c, resp, responseBody)
+	return true, nil
+}
@@ -0,0 +1,39 @@
+package relay
+
+import (
+	"testing"
+
+	"github.com/QuantumNous/new-api/constant"
+	relaycommon "github.com/QuantumNous/new-api/relay/common"
+	"github.com/QuantumNous/new-api/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNativeCountTokensURL(t *testing.T) {
+	tests := []struct {
+		name   string
+		format types.RelayFormat
+		api    int
+		want   string
+		wantOk bool
+	}{
+		{name: "anthropic", format: types.RelayFormatClaude, api: constant.APITypeAnthropic, want: "https://up.example/v1/messages/count_tokens", wantOk: true},
+		{name: "gemini", format: types.RelayFormatGemini, api: constant.APITypeGemini, want: "https://up.example/v1beta/models/gemini-test:countTokens", wantOk: true},
+		{name: "claude format on openai channel", format: types.RelayFormatClaude, api: constant.APITypeOpenAI},
+		{name: "gemini format on anthropic channel", format: types.RelayFormatGemini, api: constant.APITypeAnthropic},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			info := &relaycommon.RelayInfo{RelayFormat: tt.format}
+			info.ChannelMeta = &relaycommon.ChannelMeta{
+				ApiType:           tt.api,
+				ChannelBaseUrl:    "https://up.example",
+				UpstreamModelName: "gemini-test",
+			}
+			got, ok := nativeCountTokensURL(info)
+			assert.Equal(t, tt.wantOk, ok)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
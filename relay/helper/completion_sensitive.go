@@ -0,0 +1,459 @@
+package helper
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/QuantumNous/new-api/constant"
+	"github.com/QuantumNous/new-api/dto"
+	"github.com/QuantumNous/new-api/logger"
+	completionfilter "github.com/QuantumNous/new-api/pkg/completion_filter"
+	relaycommon "github.com/QuantumNous/new-api/relay/common"
+	"github.com/QuantumNous/new-api/setting/operation_setting"
+	"github.com/QuantumNous/new-api/types"
+
+	"github.com/gin-gonic/gin"
+	"github.com/tidwall/gjson"
+	"github.com/tidwall/sjson"
+)
+
+var errCompletionSensitive = errors.New("sensitive words detected in completion")
+
+// newCompletionFilter 按请求使用的分组创建输出敏感词过滤器并记录在 info 上，未开启时返回 nil
+func newCompletionFilter(info *relaycommon.RelayInfo) *completionfilter.Filter {
+	if info == nil {
+		return nil
+	}
+	action, words, ok := operation_setting.ResolveCompletionSensitivePolicy(info.UsingGroup)
+	if !ok {
+		return nil
+	}
+	filter := completionfilter.New(words, action, operation_setting.GetCompletionSensitiveSetting().Mask)
+	info.CompletionFilter = filter
+	return filter
+}
+
+func completionSensitiveError() *types.NewAPIError {
+	return types.NewErrorWithStatusCode(errCompletionSensitive, types.ErrorCodeSensitiveWordsDetected, http.StatusBadRequest, types.ErrOptionWithSkipRetry())
+}
+
+// streamModerator 检查上游 SSE 片段中的文本：文本字段按过滤器的结果改写后交给原来的处理函数。
+// 每路输出（choice、candidate 等）使用各自的过滤器，窗口中保留的文本在下一个不带文本的片段之前、
+// 该路输出结束时或流结束时，用这路输出最近的文本片段作为模板补发
+type streamModerator struct {
+	c    *gin.Context
+	info *relaycommon.RelayInfo
+	// filter 汇总各路输出命中的敏感词，记录在 info 上
+	filter  *completionfilter.Filter
+	outputs map[string]*moderatedOutput
+	order   []string
+	aborted bool
+}
+
+// moderatedOutput 一路输出的过滤状态
+type moderatedOutput struct {
+	filter *completionfilter.Filter
+	// template 这路输出最近的文本片段，templatePaths 为片段中的全部文本路径，其中第 templateIndex 个属于这路输出
+	template      string
+	templatePaths []string
+	templateIndex int
+	// emitted 已放行的文本，用于改写 Responses 流中汇总完整文本的事件
+	emitted strings.Builder
+}
+
+func newStreamModerator(c *gin.Context, info *relaycommon.RelayInfo) *streamModerator {
+	filter := newCompletionFilter(info)
+	if filter == nil {
+		return nil
+	}
+	return &streamModerator{c: c, info: info, filter: filter, outputs: make(map[string]*moderatedOutput)}
+}
+
+func (m *streamModerator) output(key string) *moderatedOutput {
+	out, ok := m.outputs[key]
+	if !ok {
+		out = &moderatedOutput{filter: m.filter.Clone()}
+		m.outputs[key] = out
+		m.order = append(m.order, key)
+	}
+	return out
+}
+
+func (m *streamModerator) handle(data string, sr *StreamResult, dataHandler func(data string, sr *StreamResult)) {
+	if m.aborted {
+		return
+	}
+	paths := streamTextPaths(data)
+	if len(paths) == 0 {
+		m.flush(sr, dataHandler)
+		if sr.IsStopped() {
+			return
+		}
+		for _, path := range responsesDoneTextPaths(data) {
+			if out, ok := m.outputs[streamTextKey(data, path)]; ok && len(out.filter.Hits()) > 0 {
+				data = setJSONValue(data, path, out.emitted.String())
+			}
+		}
+		dataHandler(m.markFiltered(data), sr)
+		return
+	}
+
+	texts := make([]string, len(paths))
+	outputs := make([]*moderatedOutput, len(paths))
+	// fresh 表示片段中有尚未截断的输出，stopped 表示本片段命中了 truncate / abort
+	fresh, stopped := false, false
+	for i, path := range paths {
+		out := m.output(streamTextKey(data, path))
+		outputs[i] = out
+		if out.filter.Triggered() {
+			// 已经截断的输出丢弃之后的文本
+			continue
+		}
+		fresh = true
+		text, stop := out.filter.Write(gjson.Get(data, path).String())
+		if stop {
+			if out.filter.Action() == completionfilter.ActionAbort {
+				m.abort(sr)
+				return
+			}
+			stopped = true
+		}
+		texts[i] = text
+		out.emitted.WriteString(text)
+		out.template, out.templatePaths, out.templateIndex = data, paths, i
+	}
+	// 结束的输出在它的最后一个文本字段中补发窗口中的文本
+	flushed := make(map[*moderatedOutput]bool, len(outputs))
+	for i := len(paths) - 1; i >= 0; i-- {
+		out := outputs[i]
+		if flushed[out] || !streamOutputFinished(data, paths[i]) {
+			continue
+		}
+		flushed[out] = true
+		rest := out.filter.Flush()
+		texts[i] += rest
+		out.emitted.WriteString(rest)
+	}
+	// 所有输出都已截断：纯文本片段直接丢弃，带结束原因或用量的片段清空文本后继续处理
+	if !fresh && !chunkHasFinish(data) && !chunkHasUsage(data) {
+		return
+	}
+	if stopped {
+		m.logHit()
+	}
+	dataHandler(m.markFiltered(setTextPaths(data, paths, texts)), sr)
+}
+
+// flush 补发各路输出窗口中剩余的文本
+func (m *streamModerator) flush(sr *StreamResult, dataHandler func(data string, sr *StreamResult)) {
+	if m.aborted {
+		return
+	}
+	for _, key := range m.order {
+		out := m.outputs[key]
+		if !out.filter.Pending() || out.template == "" {
+			continue
+		}
+		texts := make([]string, len(out.templatePaths))
+		texts[out.templateIndex] = out.filter.Flush()
+		out.emitted.WriteString(texts[out.templateIndex])
+		dataHandler(setTextPaths(out.template, out.templatePaths, texts), sr)
+		if sr.IsStopped() {
+			return
+		}
+	}
+}
+
+// markFiltered 把已截断输出的结束原因改为内容过滤，OpenAI 的片段只改写被截断的 choice
+func (m *streamModerator) markFiltered(data string) string {
+	triggered := false
+	for _, out := range m.outputs {
+		if out.filter.Triggered() {
+			triggered = true
+			break
+		}
+	}
+	if !triggered {
+		return data
+	}
+	choices := gjson.Get(data, "choices")
+	if !choices.IsArray() {
+		return markContentFiltered(data)
+	}
+	choices.ForEach(func(key, choice gjson.Result) bool {
+		out, ok := m.outputs[outputKey("choices", key.String(), choice)]
+		if ok && out.filter.Triggered() && choice.Get("finish_reason").String() != "" {
+			data = setJSONValue(data, "choices."+key.String()+".finish_reason", constant.FinishReasonContentFilter)
+		}
+		return true
+	})
+	return data
+}
+
+// abort 丢弃当前片段，向客户端发送错误事件后结束流
+func (m *streamModerator) abort(sr *StreamResult) {
+	m.aborted = true
+	m.logHit()
+	apiErr := completionSensitiveError()
+	if m.info.RelayFormat == types.RelayFormatClaude {
+		_ = ClaudeData(m.c, dto.ClaudeResponse{Type: "error", Error: apiErr.ToClaudeError()})
+	} else {
+		_ = ObjectData(m.c, gin.H{"error": apiErr.ToOpenAIError()})
+	}
+	sr.Stop(errCompletionSensitive)
+}
+
+func (m *streamModerator) logHit() {
+	logger.LogWarn(m.c, fmt.Sprintf("completion sensitive words detected (%s): %s", m.filter.Action(), strings.Join(m.filter.Hits(), ", ")))
+}
+
+// streamTextPaths 返回流式片段中输出文本字段的路径，支持 OpenAI Chat Completions / Completions、
+// Claude Messages、Gemini 与 OpenAI Responses
+func streamTextPaths(data string) []string {
+	var paths []string
+	gjson.Get(data, "choices").ForEach(func(key, choice gjson.Result) bool {
+		if content := choice.Get("delta.content"); content.Type == gjson.String {
+			paths = append(paths, "choices."+key.String()+".delta.content")
+		} else if text := choice.Get("text"); text.Type == gjson.String {
+			paths = append(paths, "choices."+key.String()+".text")
+		}
+		return true
+	})
+	if len(paths) > 0 {
+		return paths
+	}
+	switch gjson.Get(data, "type").String() {
+	case "content_block_delta":
+		if gjson.Get(data, "delta.type").String() == "text_delta" {
+			return []string{"delta.text"}
+		}
+		return nil
+	case "response.output_text.delta":
+		return []string{"delta"}
+	}
+	return geminiTextPaths(data, "candidates")
+}
+
+// streamTextKey 返回文本字段所属的输出：OpenAI 的 choice、Gemini 的 candidate、Claude 的内容块或
+// Responses 的输出内容。同一输出的文本在各片段中依次拼接，不同输出需要分别处理
+func streamTextKey(data string, path string) string {
+	segments := strings.Split(path, ".")
+	switch segments[0] {
+	case "choices", "candidates":
+		return outputKey(segments[0], segments[1], gjson.Get(data, segments[0]+"."+segments[1]))
+	case "item":
+		// response.output_item.done：item.content.<content_index>.text
+		return fmt.Sprintf("response:%d:%s", gjson.Get(data, "output_index").Int(), segments[2])
+	case "response":
+		// response.completed 等：response.output.<output_index>.content.<content_index>.text
+		return fmt.Sprintf("response:%s:%s", segments[2], segments[4])
+	}
+	if gjson.Get(data, "type").String() == "content_block_delta" {
+		return "block:" + gjson.Get(data, "index").String()
+	}
+	// Responses 的 output_text.delta、output_text.done 与 content_part.done
+	return fmt.Sprintf("response:%d:%d", gjson.Get(data, "output_index").Int(), gjson.Get(data, "content_index").Int())
+}
+
+// outputKey choice / candidate 带有 index 字段时按 index 区分，否则按在数组中的位置区分
+func outputKey(kind string, position string, output gjson.Result) string {
+	if index := output.Get("index"); index.Exists() {
+		return kind + ":" + index.String()
+	}
+	return kind + ":" + position
+}
+
+// streamOutputFinished 文本字段所属的 choice / candidate 是否在本片段中结束
+func streamOutputFinished(data string, path string) bool {
+	segments := strings.Split(path, ".")
+	switch segments[0] {
+	case "choices":
+		return gjson.Get(data, "choices."+segments[1]+".finish_reason").String() != ""
+	case "candidates":
+		return gjson.Get(data, "candidates."+segments[1]+".finishReason").Exists()
+	}
+	return false
+}
+
+func geminiTextPaths(data string, candidatesPath string) []string {
+	var paths []string
+	gjson.Get(data, candidatesPath).ForEach(func(candidateKey, candidate gjson.Result) bool {
+		candidate.Get("content.parts").ForEach(func(partKey, part gjson.Result) bool {
+			if text := part.Get("text"); text.Type == gjson.String && !part.Get("thought").Bool() {
+				paths = append(paths, candidatesPath+"."+candidateKey.String()+".content.parts."+partKey.String()+".text")
+			}
+			return true
+		})
+		return true
+	})
+	return paths
+}
+
+// setTextPaths 把各路径的文本替换为 texts 中对应的值，texts 较短时其余路径置为空字符串
+func setTextPaths(data string, paths []string, texts []string) string {
+	for i, path := range paths {
+		text := ""
+		if i < len(texts) {
+			text = texts[i]
+		}
+		data = setJSONValue(data, path, text)
+	}
+	return data
+}
+
+// setJSONValue 设置失败时保留原内容
+func setJSONValue(data string, path string, value any) string {
+	if next, err := sjson.Set(data, path, value); err == nil {
+		return next
+	}
+	return data
+}
+
+func chunkHasFinish(data string) bool {
+	finished := false
+	gjson.Get(data, "choices.#.finish_reason").ForEach(func(_, reason gjson.Result) bool {
+		finished = reason.String() != ""
+		return !finished
+	})
+	return finished || len(gjson.Get(data, "candidates.#.finishReason").Array()) > 0
+}
+
+func chunkHasUsage(data string) bool {
+	usage := gjson.Get(data, "usage")
+	return (usage.Exists() && usage.Type != gjson.Null) || gjson.Get(data, "usageMetadata").Exists()
+}
+
+// markContentFiltered 把片段或响应中的结束原因改为内容过滤：OpenAI 为 content_filter，
+// Claude 为 refusal，Gemini 为 SAFETY
+func markContentFiltered(data string) string {
+	result := gjson.Parse(data)
+	result.Get("choices").ForEach(func(key, choice gjson.Result) bool {
+		if reason := choice.Get("finish_reason"); reason.Exists() && reason.String() != "" {
+			data = setJSONValue(data, "choices."+key.String()+".finish_reason", constant.FinishReasonContentFilter)
+		}
+		return true
+	})
+	result.Get("candidates").ForEach(func(key, candidate gjson.Result) bool {
+		if candidate.Get("finishReason").Exists() {
+			data = setJSONValue(data, "candidates."+key.String()+".finishReason", "SAFETY")
+		}
+		return true
+	})
+	switch result.Get("type").String() {
+	case "message_delta":
+		data = setJSONValue(data, "delta.stop_reason", "refusal")
+	case "message":
+		if result.Get("stop_reason").Exists() {
+			data = setJSONValue(data, "stop_reason", "refusal")
+		}
+	}
+	return data
+}
+
+// responsesDoneTextPaths 返回 Responses 流中汇总完整文本的事件（output_text.done、content_part.done、
+// output_item.done、response.completed 等）里的文本路径，这些文本需要与已放行的增量保持一致
+func responsesDoneTextPaths(data string) []string {
+	switch gjson.Get(data, "type").String() {
+	case "response.output_text.done":
+		return []string{"text"}
+	case "response.content_part.done":
+		if gjson.Get(data, "part.type").String() == "output_text" {
+			return []string{"part.text"}
+		}
+	case "response.output_item.done":
+		return outputTextPaths(data, "item.content")
+	case "response.completed", "response.incomplete", "response.failed":
+		var paths []string
+		gjson.Get(data, "response.output").ForEach(func(key, _ gjson.Result) bool {
+			paths = append(paths, outputTextPaths(data, "response.output."+key.String()+".content")...)
+			return true
+		})
+		return paths
+	}
+	return nil
+}
+
+func outputTextPaths(data string, contentPath string) []string {
+	var paths []string
+	gjson.Get(data, contentPath).ForEach(func(key, part gjson.Result) bool {
+		if part.Get("type").String() == "output_text" {
+			paths = append(paths, contentPath+"."+key.String()+".text")
+		}
+		return true
+	})
+	return paths
+}
+
+// responseTextPaths 返回非流式响应中输出文本字段的路径
+func responseTextPaths(data string) []string {
+	var paths []string
+	gjson.Get(data, "choices").ForEach(func(key, choice gjson.Result) bool {
+		if content := choice.Get("message.content"); content.Type == gjson.String {
+			paths = append(paths, "choices."+key.String()+".message.content")
+		} else if text := choice.Get("text"); text.Type == gjson.String {
+			paths = append(paths, "choices."+key.String()+".text")
+		}
+		return true
+	})
+	if gjson.Get(data, "type").String() == "message" {
+		gjson.Get(data, "content").ForEach(func(key, block gjson.Result) bool {
+			if block.Get("type").String() == "text" {
+				paths = append(paths, "content."+key.String()+".text")
+			}
+			return true
+		})
+	}
+	gjson.Get(data, "output").ForEach(func(key, _ gjson.Result) bool {
+		paths = append(paths, outputTextPaths(data, "output."+key.String()+".content")...)
+		return true
+	})
+	return append(paths, geminiTextPaths(data, "candidates")...)
+}
+
+// ModerateResponse 检查非流式响应中的输出文本，按分组策略替换敏感词、截断输出或返回错误。
+// 只处理成功的 JSON 响应，响应体被读出后替换为检查后的内容
+func ModerateResponse(c *gin.Context, info *relaycommon.RelayInfo, resp *http.Response) *types.NewAPIError {
+	if info == nil || info.IsStream || resp == nil || resp.StatusCode != http.StatusOK || resp.Body == nil {
+		return nil
+	}
+	if !strings.Contains(resp.Header.Get("Content-Type"), "json") {
+		return nil
+	}
+	filter := newCompletionFilter(info)
+	if filter == nil {
+		return nil
+	}
+	body, err := io.ReadAll(resp.Body)
+	_ = resp.Body.Close()
+	if err != nil {
+		return types.NewOpenAIError(err, types.ErrorCodeReadResponseBodyFailed, http.StatusInternalServerError)
+	}
+	data := string(body)
+	paths := responseTextPaths(data)
+	texts := make([]string, len(paths))
+	for i, path := range paths {
+		text, stop := filter.Write(gjson.Get(data, path).String())
+		texts[i] = text + filter.Flush()
+		if stop && filter.Action() == completionfilter.ActionAbort {
+			logger.LogWarn(c, fmt.Sprintf("completion sensitive words detected (%s): %s", filter.Action(), strings.Join(filter.Hits(), ", ")))
+			return completionSensitiveError()
+		}
+	}
+	if len(filter.Hits()) > 0 {
+		logger.LogWarn(c, fmt.Sprintf("completion sensitive words detected (%s): %s", filter.Action(), strings.Join(filter.Hits(), ", ")))
+		data = setTextPaths(data, paths, texts)
+		if filter.Triggered() {
+			data = markContentFiltered(data)
+		}
+		body = []byte(data)
+	}
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+	resp.ContentLength = int64(len(body))
+	resp.Header.Set("Content-Length", strconv.Itoa(len(body)))
+	return nil
+}
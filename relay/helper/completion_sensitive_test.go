@@ -0,0 +1,147 @@
+package helper
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	completionfilter "github.com/QuantumNous/new-api/pkg/completion_filter"
+	relaycommon "github.com/QuantumNous/new-api/relay/common"
+	"github.com/QuantumNous/new-api/setting/operation_setting"
+	"github.com/QuantumNous/new-api/types"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/require"
+	"github.com/tidwall/gjson"
+)
+
+func setupCompletionSensitive(t *testing.T, action string) *relaycommon.RelayInfo {
+	t.Helper()
+	setting := operation_setting.GetCompletionSensitiveSetting()
+	saved := setting.GroupPolicies
+	setting.GroupPolicies = map[string]operation_setting.CompletionSensitivePolicy{
+		"moderated": {Enabled: true, Action: action, ExtraWords: []string{"forbidden"}},
+	}
+	t.Cleanup(func() {
+		setting.GroupPolicies = saved
+	})
+	return &relaycommon.RelayInfo{UsingGroup: "moderated", ChannelMeta: &relaycommon.ChannelMeta{}}
+}
+
+func runModerator(t *testing.T, info *relaycommon.RelayInfo, chunks ...string) (*gin.Context, []string, *httptest.ResponseRecorder) {
+	t.Helper()
+	recorder := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(recorder)
+	c.Request = httptest.NewRequest(http.MethodPost, "/v1/chat/completions", nil)
+	moderator := newStreamModerator(c, info)
+	require.NotNil(t, moderator)
+
+	var handled []string
+	handler := func(data string, sr *StreamResult) {
+		handled = append(handled, data)
+	}
+	sr := newStreamResult(relaycommon.NewStreamStatus())
+	for _, chunk := range chunks {
+		sr.reset()
+		moderator.handle(chunk, sr, handler)
+		if sr.IsStopped() {
+			return c, handled, recorder
+		}
+	}
+	moderator.flush(sr, handler)
+	return c, handled, recorder
+}
+
+func joinDeltas(chunks []string) string {
+	var sb strings.Builder
+	for _, chunk := range chunks {
+		sb.WriteString(gjson.Get(chunk, "choices.0.delta.content").String())
+	}
+	return sb.String()
+}
+
+func TestStreamModeratorMask(t *testing.T) {
+	info := setupCompletionSensitive(t, completionfilter.ActionMask)
+	_, handled, _ := runModerator(t, info,
+		`{"choices":[{"delta":{"content":"this is forb"}}]}`,
+		`{"choices":[{"delta":{"content":"idden text"}}]}`,
+		`{"choices":[{"delta":{},"finish_reason":"stop"}]}`,
+	)
+	require.Equal(t, "this is **###** text", joinDeltas(handled))
+	require.Equal(t, "stop", gjson.Get(handled[len(handled)-1], "choices.0.finish_reason").String())
+	require.Equal(t, []string{"forbidden"}, info.CompletionFilter.Hits())
+}
+
+func TestStreamModeratorTruncate(t *testing.T) {
+	info := setupCompletionSensitive(t, completionfilter.ActionTruncate)
+	_, handled, _ := runModerator(t, info,
+		`{"choices":[{"delta":{"content":"safe forbid"}}]}`,
+		`{"choices":[{"delta":{"content":"den tail"}}]}`,
+		`{"choices":[{"delta":{"content":"more"}}]}`,
+		`{"choices":[{"delta":{},"finish_reason":"stop"}],"usage":null}`,
+		`{"choices":[],"usage":{"prompt_tokens":1,"completion_tokens":2}}`,
+	)
+	require.Equal(t, "safe ", joinDeltas(handled))
+	require.Equal(t, "content_filter", gjson.Get(handled[len(handled)-2], "choices.0.finish_reason").String())
+	require.True(t, gjson.Get(handled[len(handled)-1], "usage").Exists())
+}
+
+func TestStreamModeratorFiltersChoicesSeparately(t *testing.T) {
+	info := setupCompletionSensitive(t, completionfilter.ActionTruncate)
+	_, handled, _ := runModerator(t, info,
+		`{"choices":[{"index":0,"delta":{"content":"hello forb"}}]}`,
+		`{"choices":[{"index":1,"delta":{"content":"idden fruit"}}]}`,
+		`{"choices":[{"index":0,"delta":{"content":"idden"}}]}`,
+		`{"choices":[{"index":1,"delta":{"content":" more"}}]}`,
+		`{"choices":[{"index":0,"delta":{},"finish_reason":"stop"}]}`,
+		`{"choices":[{"index":1,"delta":{},"finish_reason":"stop"}]}`,
+	)
+	texts := map[int64]string{}
+	reasons := map[int64]string{}
+	for _, chunk := range handled {
+		choice := gjson.Get(chunk, "choices.0")
+		texts[choice.Get("index").Int()] += choice.Get("delta.content").String()
+		if reason := choice.Get("finish_reason").String(); reason != "" {
+			reasons[choice.Get("index").Int()] = reason
+		}
+	}
+	// 两个 choice 的文本不会拼在一起误判，截断一个 choice 不影响另一个
+	require.Equal(t, "hello ", texts[0])
+	require.Equal(t, "idden fruit more", texts[1])
+	require.Equal(t, map[int64]string{0: "content_filter", 1: "stop"}, reasons)
+	require.Equal(t, []string{"forbidden"}, info.CompletionFilter.Hits())
+}
+
+func TestStreamModeratorAbortClaude(t *testing.T) {
+	info := setupCompletionSensitive(t, completionfilter.ActionAbort)
+	info.RelayFormat = types.RelayFormatClaude
+	_, handled, recorder := runModerator(t, info,
+		`{"type":"content_block_delta","index":0,"delta":{"type":"text_delta","text":"hello "}}`,
+		`{"type":"content_block_delta","index":0,"delta":{"type":"text_delta","text":"forbidden"}}`,
+		`{"type":"message_stop"}`,
+	)
+	// 窗口中尚未放行的文本随中断一起丢弃
+	require.Len(t, handled, 1)
+	require.Empty(t, gjson.Get(handled[0], "delta.text").String())
+	require.Contains(t, recorder.Body.String(), "event: error")
+}
+
+func TestModerateResponseTruncatesClaude(t *testing.T) {
+	info := setupCompletionSensitive(t, completionfilter.ActionTruncate)
+	body := `{"type":"message","content":[{"type":"text","text":"ok then forbidden words"}],"stop_reason":"end_turn"}`
+	resp := &http.Response{
+		StatusCode: http.StatusOK,
+		Header:     http.Header{"Content-Type": []string{"application/json"}},
+		Body:       io.NopCloser(strings.NewReader(body)),
+	}
+	recorder := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(recorder)
+	require.Nil(t, ModerateResponse(c, info, resp))
+
+	moderated, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	require.Equal(t, "ok then ", gjson.GetBytes(moderated, "content.0.text").String())
+	require.Equal(t, "refusal", gjson.GetBytes(moderated, "stop_reason").String())
+	require.EqualValues(t, len(moderated), resp.ContentLength)
+}
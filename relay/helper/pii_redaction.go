@@ -0,0 +1,310 @@
+package helper
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"maps"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/dto"
+	"github.com/QuantumNous/new-api/pkg/redact"
+	relaycommon "github.com/QuantumNous/new-api/relay/common"
+	"github.com/QuantumNous/new-api/setting/operation_setting"
+	"github.com/QuantumNous/new-api/types"
+
+	"github.com/tidwall/gjson"
+)
+
+var piiRedactorCache struct {
+	sync.Mutex
+	key      string
+	redactor *redact.Redactor
+}
+
+// piiRedactor 按当前配置构建识别器，配置不变时复用已编译的规则
+func piiRedactor() *redact.Redactor {
+	setting := operation_setting.GetPIIRedactionSetting()
+	var keyBuilder strings.Builder
+	keyBuilder.WriteString(strings.Join(setting.Detectors, ","))
+	for _, rule := range setting.CustomRules {
+		fmt.Fprintf(&keyBuilder, "\x00%s\x00%s", rule.Name, rule.Pattern)
+	}
+	key := keyBuilder.String()
+
+	piiRedactorCache.Lock()
+	defer piiRedactorCache.Unlock()
+	if piiRedactorCache.redactor != nil && piiRedactorCache.key == key {
+		return piiRedactorCache.redactor
+	}
+	rules := make([]redact.Rule, 0, len(setting.CustomRules)+len(redact.Builtin()))
+	for _, rule := range setting.CustomRules {
+		compiled, err := redact.Compile(rule.Name, rule.Pattern, "")
+		if err != nil {
+			common.SysError(err.Error())
+			continue
+		}
+		rules = append(rules, compiled)
+	}
+	for _, rule := range redact.Builtin() {
+		if len(setting.Detectors) == 0 || slices.Contains(setting.Detectors, rule.Name) {
+			rules = append(rules, rule)
+		}
+	}
+	piiRedactorCache.key = key
+	piiRedactorCache.redactor = redact.New(rules...)
+	return piiRedactorCache.redactor
+}
+
+// newPIIRedaction 按分组与渠道判断本次尝试是否需要脱敏，需要时创建占位符映射并记录在 info 上。
+// 每次尝试都会重新判断，重试到未开启脱敏的渠道时清除上一次的映射
+func newPIIRedaction(info *relaycommon.RelayInfo) *redact.Pseudonymizer {
+	info.PIIRedaction = nil
+	if !operation_setting.ShouldRedactPII(info.UsingGroup, info.ChannelId) {
+		return nil
+	}
+	redactor := piiRedactor()
+	if redactor.Empty() {
+		return nil
+	}
+	return redact.NewPseudonymizer(redactor)
+}
+
+func finishPIIRedaction(info *relaycommon.RelayInfo, p *redact.Pseudonymizer) {
+	if p != nil && p.Replaced() {
+		info.PIIRedaction = p
+	}
+}
+
+// RedactModerationInput 把送审文本中的识别结果替换为占位符。审核服务同样是第三方，
+// 分组开启了脱敏时送审内容也要脱敏；占位符只用于本次审核，不需要还原
+func RedactModerationInput(info *relaycommon.RelayInfo, text string) string {
+	if !operation_setting.ShouldRedactPII(info.UsingGroup, 0) {
+		return text
+	}
+	redactor := piiRedactor()
+	if redactor.Empty() {
+		return text
+	}
+	return redact.NewPseudonymizer(redactor).Pseudonymize(text)
+}
+
+// RedactOpenAIRequest 把 OpenAI 请求中消息与 prompt 的文本替换为占位符。
+// 请求中的内容可能与原始请求共享，替换时复制被修改的部分，不影响重试时使用的原始请求
+func RedactOpenAIRequest(info *relaycommon.RelayInfo, request *dto.GeneralOpenAIRequest) {
+	p := newPIIRedaction(info)
+	if p == nil {
+		return
+	}
+	messages := slices.Clone(request.Messages)
+	for i := range messages {
+		switch content := messages[i].Content.(type) {
+		case string:
+			messages[i].SetStringContent(p.Pseudonymize(content))
+		case []dto.MediaContent:
+			parts := slices.Clone(content)
+			for j := range parts {
+				if parts[j].Type == dto.ContentTypeText {
+					parts[j].Text = p.Pseudonymize(parts[j].Text)
+				}
+			}
+			messages[i].SetMediaContent(parts)
+		case []any:
+			messages[i].Content = redactContent(p, content)
+		}
+	}
+	request.Messages = messages
+	if request.Prompt != nil {
+		request.Prompt = redactContent(p, request.Prompt)
+	}
+	finishPIIRedaction(info, p)
+}
+
+// RedactClaudeRequest 把 Claude 请求中 system 与消息的文本替换为占位符
+func RedactClaudeRequest(info *relaycommon.RelayInfo, request *dto.ClaudeRequest) {
+	p := newPIIRedaction(info)
+	if p == nil {
+		return
+	}
+	if request.System != nil {
+		request.System = redactContent(p, request.System)
+	}
+	messages := slices.Clone(request.Messages)
+	for i := range messages {
+		messages[i].Content = redactContent(p, messages[i].Content)
+	}
+	request.Messages = messages
+	if request.Prompt != "" {
+		request.Prompt = p.Pseudonymize(request.Prompt)
+	}
+	finishPIIRedaction(info, p)
+}
+
+// RedactGeminiRequest 把 Gemini 请求中 contents 与 systemInstruction 的文本替换为占位符
+func RedactGeminiRequest(info *relaycommon.RelayInfo, request *dto.GeminiChatRequest) {
+	p := newPIIRedaction(info)
+	if p == nil {
+		return
+	}
+	contents := slices.Clone(request.Contents)
+	for i := range contents {
+		contents[i].Parts = redactGeminiParts(p, contents[i].Parts)
+	}
+	request.Contents = contents
+	if request.SystemInstructions != nil {
+		system := *request.SystemInstructions
+		system.Parts = redactGeminiParts(p, system.Parts)
+		request.SystemInstructions = &system
+	}
+	finishPIIRedaction(info, p)
+}
+
+func redactGeminiParts(p *redact.Pseudonymizer, parts []dto.GeminiPart) []dto.GeminiPart {
+	parts = slices.Clone(parts)
+	for i := range parts {
+		if parts[i].Text != "" && !parts[i].Thought {
+			parts[i].Text = p.Pseudonymize(parts[i].Text)
+		}
+	}
+	return parts
+}
+
+// redactContent 替换 JSON 解码得到的消息内容：字符串直接替换，数组中的字符串与 {"text": ...} 内容块中的文本逐个替换，
+// 内容块里嵌套的 content（如 Claude 的 tool_result）递归处理
+func redactContent(p *redact.Pseudonymizer, content any) any {
+	switch value := content.(type) {
+	case string:
+		return p.Pseudonymize(value)
+	case []any:
+		items := make([]any, len(value))
+		for i, item := range value {
+			items[i] = redactContent(p, item)
+		}
+		return items
+	case map[string]any:
+		block := maps.Clone(value)
+		if text, ok := block["text"].(string); ok {
+			block["text"] = p.Pseudonymize(text)
+		}
+		if nested, ok := block["content"]; ok {
+			block["content"] = redactContent(p, nested)
+		}
+		return block
+	}
+	return content
+}
+
+// streamRestorer 在上游 SSE 片段交给后续处理之前还原文本中的占位符。每路输出（choice、candidate 等）
+// 使用各自的还原器，被拆开的占位符保留到这路输出的下一个片段，在不带文本的片段之前、该路输出结束时或流结束时补发
+type streamRestorer struct {
+	info    *relaycommon.RelayInfo
+	outputs map[string]*restoredOutput
+	order   []string
+}
+
+// restoredOutput 一路输出的还原状态，template 等字段的含义与 moderatedOutput 相同
+type restoredOutput struct {
+	restorer      *redact.StreamRestorer
+	template      string
+	templatePaths []string
+	templateIndex int
+}
+
+// newStreamRestorer 本次尝试没有替换内容或未开启还原时返回 nil
+func newStreamRestorer(info *relaycommon.RelayInfo) *streamRestorer {
+	if info == nil || info.PIIRedaction == nil || !operation_setting.GetPIIRedactionSetting().Restore {
+		return nil
+	}
+	return &streamRestorer{info: info, outputs: make(map[string]*restoredOutput)}
+}
+
+func (r *streamRestorer) output(key string) *restoredOutput {
+	out, ok := r.outputs[key]
+	if !ok {
+		out = &restoredOutput{restorer: r.info.PIIRedaction.NewStreamRestorer()}
+		r.outputs[key] = out
+		r.order = append(r.order, key)
+	}
+	return out
+}
+
+func (r *streamRestorer) handle(data string, sr *StreamResult, next func(data string, sr *StreamResult)) {
+	paths := streamTextPaths(data)
+	if len(paths) == 0 {
+		r.flush(sr, next)
+		if sr.IsStopped() {
+			return
+		}
+		// Responses 流中汇总完整文本的事件直接整体还原
+		for _, path := range responsesDoneTextPaths(data) {
+			data = setJSONValue(data, path, r.info.PIIRedaction.Restore(gjson.Get(data, path).String()))
+		}
+		next(data, sr)
+		return
+	}
+	texts := make([]string, len(paths))
+	outputs := make([]*restoredOutput, len(paths))
+	for i, path := range paths {
+		out := r.output(streamTextKey(data, path))
+		outputs[i] = out
+		texts[i] = out.restorer.Write(gjson.Get(data, path).String())
+		out.template, out.templatePaths, out.templateIndex = data, paths, i
+	}
+	flushed := make(map[*restoredOutput]bool, len(outputs))
+	for i := len(paths) - 1; i >= 0; i-- {
+		if flushed[outputs[i]] || !streamOutputFinished(data, paths[i]) {
+			continue
+		}
+		flushed[outputs[i]] = true
+		texts[i] += outputs[i].restorer.Flush()
+	}
+	next(setTextPaths(data, paths, texts), sr)
+}
+
+// flush 补发各路输出保留的文本
+func (r *streamRestorer) flush(sr *StreamResult, next func(data string, sr *StreamResult)) {
+	for _, key := range r.order {
+		out := r.outputs[key]
+		if !out.restorer.Pending() || out.template == "" {
+			continue
+		}
+		texts := make([]string, len(out.templatePaths))
+		texts[out.templateIndex] = out.restorer.Flush()
+		next(setTextPaths(out.template, out.templatePaths, texts), sr)
+		if sr.IsStopped() {
+			return
+		}
+	}
+}
+
+// RestorePIIResponse 在非流式响应的输出文本中还原占位符，只处理成功的 JSON 响应
+func RestorePIIResponse(info *relaycommon.RelayInfo, resp *http.Response) *types.NewAPIError {
+	if info == nil || info.IsStream || resp == nil || resp.StatusCode != http.StatusOK || resp.Body == nil {
+		return nil
+	}
+	if info.PIIRedaction == nil || !operation_setting.GetPIIRedactionSetting().Restore {
+		return nil
+	}
+	if !strings.Contains(resp.Header.Get("Content-Type"), "json") {
+		return nil
+	}
+	body, err := io.ReadAll(resp.Body)
+	_ = resp.Body.Close()
+	if err != nil {
+		return types.NewOpenAIError(err, types.ErrorCodeReadResponseBodyFailed, http.StatusInternalServerError)
+	}
+	data := string(body)
+	for _, path := range responseTextPaths(data) {
+		data = setJSONValue(data, path, info.PIIRedaction.Restore(gjson.Get(data, path).String()))
+	}
+	body = []byte(data)
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+	resp.ContentLength = int64(len(body))
+	resp.Header.Set("Content-Length", strconv.Itoa(len(body)))
+	return nil
+}
@@ -0,0 +1,118 @@
+package helper
+
+import (
+	"testing"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/dto"
+	relaycommon "github.com/QuantumNous/new-api/relay/common"
+	"github.com/QuantumNous/new-api/setting/operation_setting"
+	"github.com/stretchr/testify/require"
+	"github.com/tidwall/gjson"
+)
+
+func setupPIIRedaction(t *testing.T) *relaycommon.RelayInfo {
+	t.Helper()
+	setting := operation_setting.GetPIIRedactionSetting()
+	saved := *setting
+	t.Cleanup(func() { *setting = saved })
+	setting.Enabled = true
+	setting.Groups = []string{"compliance"}
+	setting.ChannelIds = []int{}
+	setting.Detectors = []string{}
+	setting.CustomRules = []operation_setting.PIIRedactionRule{{Name: "employee_id", Pattern: `EMP-\d{6}`}}
+	setting.Restore = true
+	return &relaycommon.RelayInfo{UsingGroup: "compliance", ChannelMeta: &relaycommon.ChannelMeta{ChannelId: 7}}
+}
+
+func TestRedactOpenAIRequestKeepsOriginal(t *testing.T) {
+	info := setupPIIRedaction(t)
+	var original dto.GeneralOpenAIRequest
+	require.NoError(t, common.Unmarshal([]byte(`{"model":"gpt-4o","messages":[
+		{"role":"system","content":"contact alice@example.com"},
+		{"role":"user","content":[{"type":"text","text":"I am EMP-123456, mail alice@example.com"},{"type":"image_url","image_url":{"url":"https://example.com/a.png"}}]}
+	]}`), &original))
+
+	request := original
+	RedactOpenAIRequest(info, &request)
+	require.NotNil(t, info.PIIRedaction)
+	require.Equal(t, "contact [EMAIL_1]", request.Messages[0].StringContent())
+	require.Equal(t, "I am [EMPLOYEE_ID_1], mail [EMAIL_1]", request.Messages[1].StringContent())
+	require.Equal(t, "I am EMP-123456, mail alice@example.com", original.Messages[1].StringContent())
+	require.Equal(t, map[string]int{"email": 2, "employee_id": 1}, info.PIIRedaction.Counts())
+
+	// 重试到未开启脱敏的分组时清除映射
+	info.UsingGroup = "default"
+	request = original
+	RedactOpenAIRequest(info, &request)
+	require.Nil(t, info.PIIRedaction)
+}
+
+func TestRedactGeminiRequest(t *testing.T) {
+	info := setupPIIRedaction(t)
+	request := &dto.GeminiChatRequest{
+		Contents:           []dto.GeminiChatContent{{Role: "user", Parts: []dto.GeminiPart{{Text: "call 13812345678"}}}},
+		SystemInstructions: &dto.GeminiChatContent{Parts: []dto.GeminiPart{{Text: "key sk-abcdefghijklmnop1234"}}},
+	}
+	RedactGeminiRequest(info, request)
+	require.Equal(t, "call [PHONE_1]", request.Contents[0].Parts[0].Text)
+	require.Equal(t, "key [API_KEY_1]", request.SystemInstructions.Parts[0].Text)
+}
+
+func TestRedactModerationInput(t *testing.T) {
+	info := setupPIIRedaction(t)
+	require.Equal(t, "I am [EMPLOYEE_ID_1], mail [EMAIL_1]", RedactModerationInput(info, "I am EMP-123456, mail alice@example.com"))
+
+	info.UsingGroup = "default"
+	require.Equal(t, "mail alice@example.com", RedactModerationInput(info, "mail alice@example.com"))
+}
+
+func TestStreamRestorerJoinsSplitPlaceholders(t *testing.T) {
+	info := setupPIIRedaction(t)
+	request := &dto.ClaudeRequest{Messages: []dto.ClaudeMessage{{Role: "user", Content: "write to alice@example.com"}}}
+	RedactClaudeRequest(info, request)
+	require.Equal(t, "write to [EMAIL_1]", request.Messages[0].Content)
+
+	restorer := newStreamRestorer(info)
+	require.NotNil(t, restorer)
+	var handled []string
+	next := func(data string, sr *StreamResult) {
+		handled = append(handled, data)
+	}
+	sr := newStreamResult(relaycommon.NewStreamStatus())
+	for _, chunk := range []string{
+		`{"choices":[{"delta":{"content":"Sent to [EMA"}}]}`,
+		`{"choices":[{"delta":{"content":"IL_1] and [EMAIL"}}]}`,
+		`{"choices":[{"delta":{},"finish_reason":"stop"}]}`,
+	} {
+		restorer.handle(chunk, sr, next)
+	}
+	require.Equal(t, "Sent to alice@example.com and [EMAIL", joinDeltas(handled))
+	require.Equal(t, "stop", gjson.Get(handled[len(handled)-1], "choices.0.finish_reason").String())
+}
+
+func TestStreamRestorerKeepsChoicesSeparate(t *testing.T) {
+	info := setupPIIRedaction(t)
+	request := &dto.ClaudeRequest{Messages: []dto.ClaudeMessage{{Role: "user", Content: "write to alice@example.com"}}}
+	RedactClaudeRequest(info, request)
+
+	restorer := newStreamRestorer(info)
+	require.NotNil(t, restorer)
+	texts := map[int64]string{}
+	next := func(data string, sr *StreamResult) {
+		choice := gjson.Get(data, "choices.0")
+		texts[choice.Get("index").Int()] += choice.Get("delta.content").String()
+	}
+	sr := newStreamResult(relaycommon.NewStreamStatus())
+	for _, chunk := range []string{
+		`{"choices":[{"index":0,"delta":{"content":"to [EMA"}}]}`,
+		`{"choices":[{"index":1,"delta":{"content":"IL_1] ok"}}]}`,
+		`{"choices":[{"index":0,"delta":{"content":"IL_1]"},"finish_reason":"stop"}]}`,
+		`{"choices":[{"index":1,"delta":{},"finish_reason":"stop"}]}`,
+	} {
+		restorer.handle(chunk, sr, next)
+	}
+	// 一个 choice 中被拆开的占位符不会与另一个 choice 的文本拼接
+	require.Equal(t, "to alice@example.com", texts[0])
+	require.Equal(t, "IL_1] ok", texts[1])
+}
@@ -5,6 +5,7 @@ import (
 	"strings"
 
 	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/constant"
 	"github.com/QuantumNous/new-api/logger"
 	"github.com/QuantumNous/new-api/model"
 	"github.com/QuantumNous/new-api/pkg/billingexpr"
@@ -61,6 +62,16 @@ func HandleGroupRatio(ctx *gin.Context, relayInfo *relaycommon.RelayInfo) types.
 		groupRatioInfo.GroupRatio = ratio_setting.GetGroupRatio(relayInfo.UsingGroup)
 	}
 
+	// batch discount, only set when the request is executed for a /v1/batches job
+	if discount, ok := common.GetContextKeyType[float64](ctx, constant.ContextKeyBatchDiscountRatio); ok {
+		groupRatioInfo.GroupRatio *= discount
+	}
+
+	// response cache hit ratio, only set when the response is replayed from the response cache
+	if hitRatio, ok := common.GetContextKeyType[float64](ctx, constant.ContextKeyResponseCacheHitRatio); ok {
+		groupRatioInfo.GroupRatio *= hitRatio
+	}
+
 	return groupRatioInfo
 }
 
@@ -193,15 +193,46 @@ func StreamScannerHandler(c *gin.Context, resp *http.Response, info *relaycommon
 			common.SafeSendBool(stopChan, true)
 		}()
 		sr := newStreamResult(info.StreamStatus)
+		// 片段依次经过占位符还原、输出敏感词检查，再交给原来的处理函数
+		handle := dataHandler
+		moderator := newStreamModerator(c, info)
+		if moderator != nil {
+			handle = func(data string, sr *StreamResult) {
+				moderator.handle(data, sr, dataHandler)
+			}
+		}
+		restorer := newStreamRestorer(info)
+		moderated := handle
+		if restorer != nil {
+			handle = func(data string, sr *StreamResult) {
+				restorer.handle(data, sr, moderated)
+			}
+		}
 		for data := range dataChan {
 			sr.reset()
 			writeMutex.Lock()
-			dataHandler(data, sr)
+			handle(data, sr)
 			writeMutex.Unlock()
 			if sr.IsStopped() {
 				return
 			}
 		}
+		// 流正常结束时补发还原器与输出敏感词窗口中剩余的文本
+		if restorer != nil {
+			sr.reset()
+			writeMutex.Lock()
+			restorer.flush(sr, moderated)
+			writeMutex.Unlock()
+			if sr.IsStopped() {
+				return
+			}
+		}
+		if moderator != nil {
+			sr.reset()
+			writeMutex.Lock()
+			moderator.flush(sr, dataHandler)
+			writeMutex.Unlock()
+		}
 	})
 
 	// Scanner goroutine with improved error handling
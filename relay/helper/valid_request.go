@@ -29,6 +29,8 @@ func GetAndValidateRequest(c *gin.Context, format types.RelayFormat) (request dt
 			request, err = GetAndValidateGeminiEmbeddingRequest(c)
 		} else if strings.Contains(c.Request.URL.Path, ":batchEmbedContents") {
 			request, err = GetAndValidateGeminiBatchEmbeddingRequest(c)
+		} else if strings.HasSuffix(c.Request.URL.Path, ":countTokens") {
+			request, err = GetAndValidateGeminiCountTokensRequest(c)
 		} else {
 			request, err = GetAndValidateGeminiRequest(c)
 		}
@@ -332,6 +334,23 @@ func GetAndValidateGeminiRequest(c *gin.Context) (*dto.GeminiChatRequest, error)
 	return request, nil
 }
 
+// GetAndValidateGeminiCountTokensRequest 解析 countTokens 请求，统一转换为 GeminiChatRequest 用于计数
+func GetAndValidateGeminiCountTokensRequest(c *gin.Context) (*dto.GeminiChatRequest, error) {
+	countRequest := &dto.GeminiCountTokensRequest{}
+	err := common.UnmarshalBodyReusable(c, countRequest)
+	if err != nil {
+		return nil, err
+	}
+	request := countRequest.GenerateContentRequest
+	if request == nil {
+		request = &dto.GeminiChatRequest{Contents: countRequest.Contents}
+	}
+	if len(request.Contents) == 0 {
+		return nil, errors.New("contents is required")
+	}
+	return request, nil
+}
+
 func GetAndValidateGeminiEmbeddingRequest(c *gin.Context) (*dto.GeminiEmbeddingRequest, error) {
 	request := &dto.GeminiEmbeddingRequest{}
 	err := common.UnmarshalBodyReusable(c, request)
@@ -0,0 +1,41 @@
+package relay
+
+import (
+	"io"
+	"net/http"
+
+	"github.com/QuantumNous/new-api/pkg/tracing"
+	"github.com/QuantumNous/new-api/relay/channel"
+	relaycommon "github.com/QuantumNous/new-api/relay/common"
+	"github.com/QuantumNous/new-api/types"
+
+	"github.com/gin-gonic/gin"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// doRequestWithTracing 以 span 包裹 adaptor.DoRequest，耗时包含参数转换后的上游请求直到收到响应头
+func doRequestWithTracing(c *gin.Context, adaptor channel.Adaptor, info *relaycommon.RelayInfo, requestBody io.Reader) (any, error) {
+	span, endSpan := tracing.StartGin(c, "relay.do_request", info.TraceAttributes()...)
+	resp, err := adaptor.DoRequest(c, info, requestBody)
+	if httpResp, ok := resp.(*http.Response); ok && httpResp != nil {
+		span.SetAttributes(semconv.HTTPResponseStatusCode(httpResp.StatusCode))
+	}
+	endSpan(err)
+	return resp, err
+}
+
+// doResponseWithTracing 以 span 包裹 adaptor.DoResponse，流式请求时耗时包含整个流的转发与后处理
+func doResponseWithTracing(c *gin.Context, adaptor channel.Adaptor, resp *http.Response, info *relaycommon.RelayInfo) (any, *types.NewAPIError) {
+	span, endSpan := tracing.StartGin(c, "relay.do_response", info.TraceAttributes()...)
+	usage, apiErr := adaptor.DoResponse(c, resp, info)
+	if info.IsStream && info.HasSendResponse() {
+		span.AddEvent("first_response", trace.WithTimestamp(info.FirstResponseTime))
+	}
+	if apiErr != nil {
+		endSpan(apiErr)
+	} else {
+		endSpan(nil)
+	}
+	return usage, apiErr
+}
@@ -160,6 +160,37 @@ func SetApiRouter(router *gin.Engine) {
 			subscriptionRoute.POST("/creem/pay", middleware.CriticalRateLimit(), controller.SubscriptionRequestCreemPay)
 			subscriptionRoute.POST("/waffo-pancake/pay", middleware.CriticalRateLimit(), controller.SubscriptionRequestWaffoPancakePay)
 		}
+		organizationRoute := apiRouter.Group("/organization")
+		organizationRoute.Use(middleware.UserAuth())
+		{
+			organizationRoute.GET("/self", controller.GetOrganizationSelf)
+			organizationRoute.GET("/self/members", controller.GetOrganizationSelfMembers)
+			organizationRoute.POST("/self/members", controller.AddOrganizationSelfMember)
+			organizationRoute.PUT("/self/members", controller.UpdateOrganizationSelfMember)
+			organizationRoute.DELETE("/self/members/:user_id", controller.RemoveOrganizationSelfMember)
+			organizationRoute.GET("/self/member_invitations", controller.GetOrganizationSelfMemberInvitations)
+			organizationRoute.DELETE("/self/member_invitations/:user_id", controller.RevokeOrganizationSelfMemberInvitation)
+			organizationRoute.GET("/self/invitations", controller.GetOrganizationSelfInvitations)
+			organizationRoute.POST("/self/invitations/:id/accept", controller.AcceptOrganizationSelfInvitation)
+			organizationRoute.DELETE("/self/invitations/:id", controller.DeclineOrganizationSelfInvitation)
+			organizationRoute.POST("/self/leave", controller.LeaveOrganizationSelf)
+		}
+		organizationAdminRoute := apiRouter.Group("/organization/admin")
+		organizationAdminRoute.Use(middleware.AdminAuth())
+		{
+			organizationAdminRoute.GET("/", controller.GetAllOrganizations)
+			organizationAdminRoute.GET("/:id", controller.GetOrganization)
+			organizationAdminRoute.POST("/", controller.CreateOrganization)
+			organizationAdminRoute.PUT("/", controller.UpdateOrganization)
+			organizationAdminRoute.DELETE("/:id", controller.DeleteOrganization)
+			organizationAdminRoute.POST("/:id/quota", controller.AdjustOrganizationQuota)
+			organizationAdminRoute.POST("/:id/subscriptions", controller.AdminBindOrganizationSubscription)
+			organizationAdminRoute.GET("/:id/members", controller.GetOrganizationMembers)
+			organizationAdminRoute.POST("/:id/members", controller.AddOrganizationMember)
+			organizationAdminRoute.PUT("/:id/members", controller.UpdateOrganizationMember)
+			organizationAdminRoute.DELETE("/:id/members/:user_id", controller.RemoveOrganizationMember)
+		}
+
 		subscriptionAdminRoute := apiRouter.Group("/subscription/admin")
 		subscriptionAdminRoute.Use(middleware.AdminAuth())
 		{
@@ -181,6 +212,14 @@ func SetApiRouter(router *gin.Engine) {
 		apiRouter.GET("/subscription/epay/notify", controller.SubscriptionEpayNotify)
 		apiRouter.GET("/subscription/epay/return", controller.SubscriptionEpayReturn)
 		apiRouter.POST("/subscription/epay/return", anonymousRequestBodyLimit, controller.SubscriptionEpayReturn)
+
+		configRoute := apiRouter.Group("/config")
+		configRoute.Use(middleware.RootAuth())
+		{
+			configRoute.GET("/export", controller.ExportConfigDocument)
+			configRoute.POST("/diff", controller.DiffConfigDocument)
+			configRoute.POST("/apply", controller.ApplyConfigDocument)
+		}
 		optionRoute := apiRouter.Group("/option")
 		optionRoute.Use(middleware.RootAuth())
 		{
@@ -189,6 +228,7 @@ func SetApiRouter(router *gin.Engine) {
 			optionRoute.POST("/payment_compliance", controller.ConfirmPaymentCompliance)
 			optionRoute.GET("/channel_affinity_cache", controller.GetChannelAffinityCacheStats)
 			optionRoute.DELETE("/channel_affinity_cache", controller.ClearChannelAffinityCache)
+			optionRoute.DELETE("/response_cache", controller.ClearResponseCache)
 			optionRoute.POST("/rest_model_ratio", controller.ResetModelRatio)
 			optionRoute.POST("/migrate_console_setting", controller.MigrateConsoleSetting) // 用于迁移检测的旧键，下个版本会删除
 			optionRoute.GET("/waffo-pancake/catalog", controller.ListWaffoPancakeCatalog)
@@ -233,12 +273,10 @@ func SetApiRouter(router *gin.Engine) {
 			tokenRoute.GET("/", controller.GetAllTokens)
 			tokenRoute.GET("/search", middleware.SearchRateLimit(), controller.SearchTokens)
 			tokenRoute.GET("/:id", controller.GetToken)
-			tokenRoute.POST("/:id/key", middleware.CriticalRateLimit(), middleware.DisableCache(), controller.GetTokenKey)
 			tokenRoute.POST("/", controller.AddToken)
 			tokenRoute.PUT("/", controller.UpdateToken)
 			tokenRoute.DELETE("/:id", controller.DeleteToken)
 			tokenRoute.POST("/batch", controller.DeleteTokenBatch)
-			tokenRoute.POST("/batch/keys", middleware.CriticalRateLimit(), middleware.DisableCache(), controller.GetTokenKeysBatch)
 		}
 
 		usageRoute := apiRouter.Group("/usage")
@@ -271,9 +309,17 @@ func SetApiRouter(router *gin.Engine) {
 		logRoute.GET("/self/stat", middleware.UserAuth(), controller.GetLogsSelfStat)
 		logRoute.GET("/channel_affinity_usage_cache", middleware.AdminAuth(), controller.GetChannelAffinityUsageCacheStats)
 		logRoute.GET("/search", middleware.AdminAuth(), controller.SearchAllLogs)
+		logRoute.GET("/payload", middleware.AdminAuth(), controller.GetPayloadLogs)
 		logRoute.GET("/self", middleware.UserAuth(), controller.GetUserLogs)
 		logRoute.GET("/self/search", middleware.UserAuth(), middleware.SearchRateLimit(), controller.SearchUserLogs)
 
+		shadowLogRoute := apiRouter.Group("/shadow_log")
+		shadowLogRoute.Use(middleware.AdminAuth())
+		{
+			shadowLogRoute.GET("/", controller.GetShadowLogs)
+			shadowLogRoute.GET("/summary", controller.GetShadowLogSummary)
+		}
+
 		systemTaskRoute := apiRouter.Group("/system-task")
 		systemTaskRoute.Use(middleware.RootAuth())
 		{
@@ -9,11 +9,22 @@ import (
 
 // registerAuthzRoutes mounts the authorization API under its own /authz
 // namespace. GET /authz/catalog returns the permission schema (resources,
-// actions, and role baselines) used by the client permission editor.
+// actions, and role baselines) used by the client permission editor. Custom
+// role definitions and assignments are root-only.
 func registerAuthzRoutes(apiRouter *gin.RouterGroup) {
 	authzRoute := apiRouter.Group("/authz")
 	authzRoute.Use(middleware.AdminAuth())
 	{
 		authzRoute.GET("/catalog", controller.GetPermissionCatalog)
+		authzRoute.GET("/explain", controller.ExplainPermission)
+		authzRoute.GET("/roles", controller.ListAuthzRoles)
+		authzRoute.GET("/users/:id/roles", controller.GetUserAuthzRoles)
+
+		rootRoute := authzRoute.Group("")
+		rootRoute.Use(middleware.RootAuth())
+		rootRoute.POST("/roles", controller.CreateAuthzRole)
+		rootRoute.PUT("/roles/:key", controller.UpdateAuthzRole)
+		rootRoute.DELETE("/roles/:key", controller.DeleteAuthzRole)
+		rootRoute.PUT("/users/:id/roles", controller.SetUserAuthzRoles)
 	}
 }
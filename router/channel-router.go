@@ -13,7 +13,9 @@ type permissionRoute struct {
 	method     string
 	path       string
 	permission authz.Permission
-	handler    gin.HandlerFunc
+	// target 标签范围授权定位目标渠道的方式，需与 handler 实际绑定的请求结构一致
+	target  middleware.ChannelTarget
+	handler gin.HandlerFunc
 }
 
 func registerChannelRoutes(apiRouter *gin.RouterGroup) {
@@ -30,50 +32,54 @@ func registerChannelRoutes(apiRouter *gin.RouterGroup) {
 
 	for _, route := range channelPermissionRoutes {
 		channelRoute.Handle(route.method, route.path,
-			middleware.RequirePermission(route.permission),
+			middleware.RequireChannelPermission(route.permission, route.target),
 			route.handler,
 		)
 	}
 }
 
 var channelPermissionRoutes = []permissionRoute{
-	{method: http.MethodGet, path: "/", permission: authz.ChannelRead, handler: controller.GetAllChannels},
-	{method: http.MethodGet, path: "/search", permission: authz.ChannelRead, handler: controller.SearchChannels},
-	{method: http.MethodGet, path: "/models", permission: authz.ChannelRead, handler: controller.ChannelListModels},
-	{method: http.MethodGet, path: "/models_enabled", permission: authz.ChannelRead, handler: controller.EnabledListModels},
-	{method: http.MethodGet, path: "/ops", permission: authz.ChannelRead, handler: controller.GetChannelOps},
-	{method: http.MethodGet, path: "/:id", permission: authz.ChannelRead, handler: controller.GetChannel},
-	{method: http.MethodGet, path: "/test", permission: authz.ChannelOperate, handler: controller.TestAllChannels},
-	{method: http.MethodGet, path: "/test/:id", permission: authz.ChannelOperate, handler: controller.TestChannel},
-	{method: http.MethodGet, path: "/update_balance", permission: authz.ChannelOperate, handler: controller.UpdateAllChannelsBalance},
-	{method: http.MethodGet, path: "/update_balance/:id", permission: authz.ChannelOperate, handler: controller.UpdateChannelBalance},
-	{method: http.MethodPost, path: "/", permission: authz.ChannelSensitiveWrite, handler: controller.AddChannel},
-	{method: http.MethodPut, path: "/", permission: authz.ChannelWrite, handler: controller.UpdateChannel},
-	{method: http.MethodPost, path: "/status/batch", permission: authz.ChannelOperate, handler: controller.BatchUpdateChannelStatus},
-	{method: http.MethodPost, path: "/:id/status", permission: authz.ChannelOperate, handler: controller.UpdateChannelStatus},
-	{method: http.MethodDelete, path: "/disabled", permission: authz.ChannelSensitiveWrite, handler: controller.DeleteDisabledChannel},
-	{method: http.MethodPost, path: "/tag/disabled", permission: authz.ChannelOperate, handler: controller.DisableTagChannels},
-	{method: http.MethodPost, path: "/tag/enabled", permission: authz.ChannelOperate, handler: controller.EnableTagChannels},
-	{method: http.MethodPut, path: "/tag", permission: authz.ChannelWrite, handler: controller.EditTagChannels},
-	{method: http.MethodDelete, path: "/:id", permission: authz.ChannelSensitiveWrite, handler: controller.DeleteChannel},
-	{method: http.MethodPost, path: "/batch", permission: authz.ChannelSensitiveWrite, handler: controller.DeleteChannelBatch},
-	{method: http.MethodPost, path: "/fix", permission: authz.ChannelOperate, handler: controller.FixChannelsAbilities},
-	{method: http.MethodGet, path: "/fetch_models/:id", permission: authz.ChannelOperate, handler: controller.FetchUpstreamModels},
-	{method: http.MethodPost, path: "/fetch_models", permission: authz.ChannelSensitiveWrite, handler: controller.FetchModels},
-	{method: http.MethodPost, path: "/:id/codex/refresh", permission: authz.ChannelSensitiveWrite, handler: controller.RefreshCodexChannelCredential},
-	{method: http.MethodGet, path: "/:id/codex/usage", permission: authz.ChannelRead, handler: controller.GetCodexChannelUsage},
-	{method: http.MethodGet, path: "/:id/codex/usage/reset-credits", permission: authz.ChannelRead, handler: controller.GetCodexChannelRateLimitResetCredits},
-	{method: http.MethodPost, path: "/:id/codex/usage/reset", permission: authz.ChannelOperate, handler: controller.ResetCodexChannelUsage},
-	{method: http.MethodPost, path: "/ollama/pull", permission: authz.ChannelSensitiveWrite, handler: controller.OllamaPullModel},
-	{method: http.MethodPost, path: "/ollama/pull/stream", permission: authz.ChannelSensitiveWrite, handler: controller.OllamaPullModelStream},
-	{method: http.MethodDelete, path: "/ollama/delete", permission: authz.ChannelSensitiveWrite, handler: controller.OllamaDeleteModel},
-	{method: http.MethodGet, path: "/ollama/version/:id", permission: authz.ChannelSensitiveWrite, handler: controller.OllamaVersion},
-	{method: http.MethodPost, path: "/batch/tag", permission: authz.ChannelWrite, handler: controller.BatchSetChannelTag},
-	{method: http.MethodGet, path: "/tag/models", permission: authz.ChannelRead, handler: controller.GetTagModels},
-	{method: http.MethodPost, path: "/copy/:id", permission: authz.ChannelSensitiveWrite, handler: controller.CopyChannel},
-	{method: http.MethodPost, path: "/multi_key/manage", permission: authz.ChannelOperate, handler: controller.ManageMultiKeys},
-	{method: http.MethodPost, path: "/upstream_updates/apply", permission: authz.ChannelWrite, handler: controller.ApplyChannelUpstreamModelUpdates},
-	{method: http.MethodPost, path: "/upstream_updates/apply_all", permission: authz.ChannelWrite, handler: controller.ApplyAllChannelUpstreamModelUpdates},
-	{method: http.MethodPost, path: "/upstream_updates/detect", permission: authz.ChannelOperate, handler: controller.DetectChannelUpstreamModelUpdates},
-	{method: http.MethodPost, path: "/upstream_updates/detect_all", permission: authz.ChannelOperate, handler: controller.DetectAllChannelUpstreamModelUpdates},
+	{method: http.MethodGet, path: "/", permission: authz.ChannelRead, target: middleware.ChannelTargetNone, handler: controller.GetAllChannels},
+	{method: http.MethodGet, path: "/search", permission: authz.ChannelRead, target: middleware.ChannelTargetNone, handler: controller.SearchChannels},
+	{method: http.MethodGet, path: "/models", permission: authz.ChannelRead, target: middleware.ChannelTargetNone, handler: controller.ChannelListModels},
+	{method: http.MethodGet, path: "/models_enabled", permission: authz.ChannelRead, target: middleware.ChannelTargetNone, handler: controller.EnabledListModels},
+	{method: http.MethodGet, path: "/ops", permission: authz.ChannelRead, target: middleware.ChannelTargetNone, handler: controller.GetChannelOps},
+	{method: http.MethodGet, path: "/:id", permission: authz.ChannelRead, target: middleware.ChannelTargetPath, handler: controller.GetChannel},
+	{method: http.MethodGet, path: "/:id/breakers", permission: authz.ChannelRead, target: middleware.ChannelTargetPath, handler: controller.GetChannelBreakers},
+	{method: http.MethodDelete, path: "/:id/breakers", permission: authz.ChannelOperate, target: middleware.ChannelTargetPath, handler: controller.ResetChannelBreakers},
+	{method: http.MethodGet, path: "/:id/cooldowns", permission: authz.ChannelRead, target: middleware.ChannelTargetPath, handler: controller.GetChannelCooldowns},
+	{method: http.MethodDelete, path: "/:id/cooldowns", permission: authz.ChannelOperate, target: middleware.ChannelTargetPath, handler: controller.ClearChannelCooldowns},
+	{method: http.MethodGet, path: "/test", permission: authz.ChannelOperate, target: middleware.ChannelTargetNone, handler: controller.TestAllChannels},
+	{method: http.MethodGet, path: "/test/:id", permission: authz.ChannelOperate, target: middleware.ChannelTargetPath, handler: controller.TestChannel},
+	{method: http.MethodGet, path: "/update_balance", permission: authz.ChannelOperate, target: middleware.ChannelTargetNone, handler: controller.UpdateAllChannelsBalance},
+	{method: http.MethodGet, path: "/update_balance/:id", permission: authz.ChannelOperate, target: middleware.ChannelTargetPath, handler: controller.UpdateChannelBalance},
+	{method: http.MethodPost, path: "/", permission: authz.ChannelSensitiveWrite, target: middleware.ChannelTargetNewChannel, handler: controller.AddChannel},
+	{method: http.MethodPut, path: "/", permission: authz.ChannelWrite, target: middleware.ChannelTargetBody, handler: controller.UpdateChannel},
+	{method: http.MethodPost, path: "/status/batch", permission: authz.ChannelOperate, target: middleware.ChannelTargetBody, handler: controller.BatchUpdateChannelStatus},
+	{method: http.MethodPost, path: "/:id/status", permission: authz.ChannelOperate, target: middleware.ChannelTargetPath, handler: controller.UpdateChannelStatus},
+	{method: http.MethodDelete, path: "/disabled", permission: authz.ChannelSensitiveWrite, target: middleware.ChannelTargetNone, handler: controller.DeleteDisabledChannel},
+	{method: http.MethodPost, path: "/tag/disabled", permission: authz.ChannelOperate, target: middleware.ChannelTargetBody, handler: controller.DisableTagChannels},
+	{method: http.MethodPost, path: "/tag/enabled", permission: authz.ChannelOperate, target: middleware.ChannelTargetBody, handler: controller.EnableTagChannels},
+	{method: http.MethodPut, path: "/tag", permission: authz.ChannelWrite, target: middleware.ChannelTargetBody, handler: controller.EditTagChannels},
+	{method: http.MethodDelete, path: "/:id", permission: authz.ChannelSensitiveWrite, target: middleware.ChannelTargetPath, handler: controller.DeleteChannel},
+	{method: http.MethodPost, path: "/batch", permission: authz.ChannelSensitiveWrite, target: middleware.ChannelTargetBody, handler: controller.DeleteChannelBatch},
+	{method: http.MethodPost, path: "/fix", permission: authz.ChannelOperate, target: middleware.ChannelTargetNone, handler: controller.FixChannelsAbilities},
+	{method: http.MethodGet, path: "/fetch_models/:id", permission: authz.ChannelOperate, target: middleware.ChannelTargetPath, handler: controller.FetchUpstreamModels},
+	{method: http.MethodPost, path: "/fetch_models", permission: authz.ChannelSensitiveWrite, target: middleware.ChannelTargetNone, handler: controller.FetchModels},
+	{method: http.MethodPost, path: "/:id/codex/refresh", permission: authz.ChannelSensitiveWrite, target: middleware.ChannelTargetPath, handler: controller.RefreshCodexChannelCredential},
+	{method: http.MethodGet, path: "/:id/codex/usage", permission: authz.ChannelRead, target: middleware.ChannelTargetPath, handler: controller.GetCodexChannelUsage},
+	{method: http.MethodGet, path: "/:id/codex/usage/reset-credits", permission: authz.ChannelRead, target: middleware.ChannelTargetPath, handler: controller.GetCodexChannelRateLimitResetCredits},
+	{method: http.MethodPost, path: "/:id/codex/usage/reset", permission: authz.ChannelOperate, target: middleware.ChannelTargetPath, handler: controller.ResetCodexChannelUsage},
+	{method: http.MethodPost, path: "/ollama/pull", permission: authz.ChannelSensitiveWrite, target: middleware.ChannelTargetBody, handler: controller.OllamaPullModel},
+	{method: http.MethodPost, path: "/ollama/pull/stream", permission: authz.ChannelSensitiveWrite, target: middleware.ChannelTargetBody, handler: controller.OllamaPullModelStream},
+	{method: http.MethodDelete, path: "/ollama/delete", permission: authz.ChannelSensitiveWrite, target: middleware.ChannelTargetBody, handler: controller.OllamaDeleteModel},
+	{method: http.MethodGet, path: "/ollama/version/:id", permission: authz.ChannelSensitiveWrite, target: middleware.ChannelTargetPath, handler: controller.OllamaVersion},
+	{method: http.MethodPost, path: "/batch/tag", permission: authz.ChannelWrite, target: middleware.ChannelTargetBody, handler: controller.BatchSetChannelTag},
+	{method: http.MethodGet, path: "/tag/models", permission: authz.ChannelRead, target: middleware.ChannelTargetQuery, handler: controller.GetTagModels},
+	{method: http.MethodPost, path: "/copy/:id", permission: authz.ChannelSensitiveWrite, target: middleware.ChannelTargetPath, handler: controller.CopyChannel},
+	{method: http.MethodPost, path: "/multi_key/manage", permission: authz.ChannelOperate, target: middleware.ChannelTargetBody, handler: controller.ManageMultiKeys},
+	{method: http.MethodPost, path: "/upstream_updates/apply", permission: authz.ChannelWrite, target: middleware.ChannelTargetBody, handler: controller.ApplyChannelUpstreamModelUpdates},
+	{method: http.MethodPost, path: "/upstream_updates/apply_all", permission: authz.ChannelWrite, target: middleware.ChannelTargetNone, handler: controller.ApplyAllChannelUpstreamModelUpdates},
+	{method: http.MethodPost, path: "/upstream_updates/detect", permission: authz.ChannelOperate, target: middleware.ChannelTargetBody, handler: controller.DetectChannelUpstreamModelUpdates},
+	{method: http.MethodPost, path: "/upstream_updates/detect_all", permission: authz.ChannelOperate, target: middleware.ChannelTargetNone, handler: controller.DetectAllChannelUpstreamModelUpdates},
 }
@@ -0,0 +1,24 @@
+package router
+
+import (
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/middleware"
+	"github.com/QuantumNous/new-api/model"
+	prommetrics "github.com/QuantumNous/new-api/pkg/prom_metrics"
+
+	"github.com/gin-gonic/gin"
+)
+
+func SetMetricsRouter(router *gin.Engine) {
+	if !common.MetricsEnabled {
+		return
+	}
+	if common.MetricsToken == "" {
+		// 不允许无鉴权暴露指标（包含渠道名称等信息）
+		common.MetricsEnabled = false
+		common.SysError("METRICS_ENABLED is set but METRICS_TOKEN is empty, /metrics is disabled")
+		return
+	}
+	prommetrics.SetChannelStatsProvider(model.GetChannelStats)
+	router.GET("/metrics", middleware.RouteTag("metrics"), middleware.MetricsAuth(), gin.WrapH(prommetrics.Handler()))
+}
@@ -3,18 +3,22 @@ package authz
 import "github.com/QuantumNous/new-api/common"
 
 // resolveSubjectRoles returns the role keys assigned to a subject. The mapping
-// is derived from the caller's system role.
+// is derived from the caller's system role; admins with enabled custom roles
+// assigned are authorized by those roles instead of the admin baseline.
 var resolveSubjectRoles = func(userID int, systemRole int) []string {
 	switch {
 	case systemRole >= common.RoleRootUser:
 		return []string{BuiltInRoleRoot}
 	case systemRole >= common.RoleAdminUser:
-		return []string{BuiltInRoleAdmin}
+		if roles := enabledUserRoles(userID); len(roles) > 0 {
+			return roles
+		}
+		return []string{managedRoleKey}
 	default:
 		return nil
 	}
 }
 
 // managedRoleKey is the role whose baseline per-user overrides are expressed
-// relative to.
+// relative to when the user has no custom roles assigned.
 const managedRoleKey = BuiltInRoleAdmin
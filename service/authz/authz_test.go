@@ -227,3 +227,74 @@ func TestCapabilitiesUseCatalogShape(t *testing.T) {
 	assert.False(t, capabilities[ResourceChannel][ActionSensitiveWrite])
 	assert.False(t, capabilities[ResourceChannel][ActionSecretView])
 }
+
+func TestCustomRoleReplacesAdminBaseline(t *testing.T) {
+	db := newAuthzTestDB(t)
+	require.NoError(t, Init(db))
+
+	_, err := CreateRole(RoleInput{
+		Key:     "channel-maintainer",
+		Name:    "Channel Maintainer",
+		Enabled: true,
+		Grants:  PermissionsMap{ResourceChannel: {ActionRead: true}},
+		ScopedGrants: []ScopedGrant{
+			{Resource: ResourceChannel, Action: ActionWrite, Scope: "tag:team-a"},
+		},
+	})
+	require.NoError(t, err)
+	_, err = CreateRole(RoleInput{Key: "channel-maintainer", Name: "dup"})
+	assert.ErrorIs(t, err, ErrRoleExists)
+	_, err = CreateRole(RoleInput{Key: BuiltInRoleAdmin})
+	assert.ErrorIs(t, err, ErrBuiltInRole)
+	_, err = CreateRole(RoleInput{Key: "bad-scope", ScopedGrants: []ScopedGrant{
+		{Resource: ResourceChannel, Action: ActionWrite, Scope: "group:x"},
+	}})
+	assert.Error(t, err)
+
+	require.NoError(t, SetUserRoles(11, []string{"channel-maintainer"}))
+	assert.Equal(t, []string{"channel-maintainer"}, UserRoles(11))
+
+	// 自定义角色替代 admin 基线
+	assert.True(t, Can(11, common.RoleAdminUser, ChannelRead))
+	assert.False(t, Can(11, common.RoleAdminUser, ChannelOperate))
+	assert.False(t, Can(11, common.RoleAdminUser, ChannelWrite))
+	assert.True(t, HasScopedGrant(11, common.RoleAdminUser, ChannelWrite))
+	assert.True(t, CanOnChannel(11, common.RoleAdminUser, ChannelWrite, "team-a"))
+	assert.False(t, CanOnChannel(11, common.RoleAdminUser, ChannelWrite, "team-a", "team-b"))
+	assert.False(t, CanOnChannel(11, common.RoleAdminUser, ChannelWrite, ""))
+	// 普通用户即使被分配角色也没有权限
+	assert.False(t, Can(11, common.RoleCommonUser, ChannelRead))
+
+	decision := Explain(11, common.RoleAdminUser, ChannelWrite, ChannelTagScopes("team-a")...)
+	assert.True(t, decision.Allowed)
+	assert.Equal(t, ReasonScopedRoleGrant, decision.Reason)
+	assert.Equal(t, RoleSubject("channel-maintainer"), decision.Subject)
+	assert.Equal(t, "channel@tag:team-a", decision.Object)
+	assert.Equal(t, ReasonNoGrant, Explain(11, common.RoleAdminUser, ChannelOperate).Reason)
+	assert.Equal(t, ReasonNoRole, Explain(11, common.RoleCommonUser, ChannelRead).Reason)
+	assert.Equal(t, ReasonSuperuser, Explain(1, common.RoleRootUser, ChannelSecretView).Reason)
+
+	// 用户级覆盖相对于自定义角色基线计算
+	require.NoError(t, SetUserPermissions(11, PermissionsMap{ResourceChannel: {ActionRead: true, ActionOperate: true}}))
+	assert.Equal(t, PermissionsMap{ResourceChannel: {ActionOperate: true}}, ExplicitUserOverrides(11))
+	assert.Equal(t, ReasonUserAllow, Explain(11, common.RoleAdminUser, ChannelOperate).Reason)
+
+	// 停用角色后回退到 admin 基线
+	_, err = UpdateRole("channel-maintainer", RoleInput{Name: "Channel Maintainer", Enabled: false})
+	require.NoError(t, err)
+	assert.True(t, Can(11, common.RoleAdminUser, ChannelWrite))
+	assert.False(t, HasScopedGrant(11, common.RoleAdminUser, ChannelWrite))
+
+	roles := Roles()
+	require.Len(t, roles, 3)
+	assert.Equal(t, "channel-maintainer", roles[2].Key)
+	assert.False(t, roles[2].Enabled)
+	assert.Empty(t, roles[2].ScopedGrants)
+
+	require.NoError(t, DeleteRole("channel-maintainer"))
+	assert.Empty(t, UserRoles(11))
+	var count int64
+	require.NoError(t, db.Model(&model.CasbinRule{}).Where("v0 = ? OR v1 = ?", RoleSubject("channel-maintainer"), RoleSubject("channel-maintainer")).Count(&count).Error)
+	assert.Equal(t, int64(0), count)
+	assert.ErrorIs(t, DeleteRole("channel-maintainer"), ErrRoleNotFound)
+}
@@ -0,0 +1,384 @@
+package authz
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/QuantumNous/new-api/model"
+	"gorm.io/gorm"
+)
+
+var (
+	ErrRoleNotFound   = errors.New("role not found")
+	ErrRoleExists     = errors.New("role already exists")
+	ErrBuiltInRole    = errors.New("built-in roles cannot be modified")
+	ErrInvalidRoleKey = errors.New("role key must be 1-64 lowercase letters, digits, '-' or '_'")
+)
+
+var roleKeyPattern = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]{0,63}$`)
+
+var (
+	customRolesMu sync.RWMutex
+	customRoles   = map[string]model.AuthzRole{}
+)
+
+// RoleInput is the editable definition of a custom role. Grants are
+// resource-wide allows; ScopedGrants only cover matching resource instances.
+type RoleInput struct {
+	Key          string         `json:"key"`
+	Name         string         `json:"name"`
+	Description  string         `json:"description"`
+	Enabled      bool           `json:"enabled"`
+	Sort         int            `json:"sort"`
+	Grants       PermissionsMap `json:"grants"`
+	ScopedGrants []ScopedGrant  `json:"scoped_grants"`
+}
+
+// loadCustomRoles refreshes the in-memory copy of custom role metadata. Grants
+// and assignments live in the enforcer; this cache only answers whether a role
+// exists and is enabled.
+func loadCustomRoles(db *gorm.DB) error {
+	if db == nil {
+		return nil
+	}
+	var rows []model.AuthzRole
+	if err := db.Where("built_in = ?", false).Order("sort asc, id asc").Find(&rows).Error; err != nil {
+		return err
+	}
+	roles := make(map[string]model.AuthzRole, len(rows))
+	for _, row := range rows {
+		roles[row.Key] = row
+	}
+	customRolesMu.Lock()
+	customRoles = roles
+	customRolesMu.Unlock()
+	return nil
+}
+
+func customRole(key string) (model.AuthzRole, bool) {
+	customRolesMu.RLock()
+	defer customRolesMu.RUnlock()
+	role, ok := customRoles[key]
+	return role, ok
+}
+
+func sortedCustomRoles() []model.AuthzRole {
+	customRolesMu.RLock()
+	roles := make([]model.AuthzRole, 0, len(customRoles))
+	for _, role := range customRoles {
+		roles = append(roles, role)
+	}
+	customRolesMu.RUnlock()
+	sort.Slice(roles, func(i, j int) bool {
+		if roles[i].Sort != roles[j].Sort {
+			return roles[i].Sort < roles[j].Sort
+		}
+		return roles[i].Id < roles[j].Id
+	})
+	return roles
+}
+
+// customRoleCondition uses a map condition so gorm quotes the reserved "key"
+// column for every supported database.
+func customRoleCondition(key string) map[string]interface{} {
+	return map[string]interface{}{"key": key, "built_in": false}
+}
+
+func currentPolicyDB() (*gorm.DB, error) {
+	enforcerMu.RLock()
+	defer enforcerMu.RUnlock()
+	if policyDB == nil {
+		return nil, fmt.Errorf("authz enforcer is not initialized")
+	}
+	return policyDB, nil
+}
+
+// CreateRole stores a new custom role together with its grants.
+func CreateRole(input RoleInput) (*model.AuthzRole, error) {
+	rules, err := validateRoleInput(&input)
+	if err != nil {
+		return nil, err
+	}
+	if !roleKeyPattern.MatchString(input.Key) {
+		return nil, ErrInvalidRoleKey
+	}
+	if _, ok := roleSpec(input.Key); ok {
+		return nil, ErrBuiltInRole
+	}
+	db, err := currentPolicyDB()
+	if err != nil {
+		return nil, err
+	}
+
+	role := model.AuthzRole{
+		Key:         input.Key,
+		Name:        input.Name,
+		Description: input.Description,
+		Enabled:     input.Enabled,
+		Sort:        input.Sort,
+	}
+	err = db.Transaction(func(tx *gorm.DB) error {
+		var count int64
+		if err := tx.Model(&model.AuthzRole{}).Where(map[string]interface{}{"key": input.Key}).Count(&count).Error; err != nil {
+			return err
+		}
+		if count > 0 {
+			return ErrRoleExists
+		}
+		if err := tx.Create(&role).Error; err != nil {
+			return err
+		}
+		return replaceRolePoliciesInTx(tx, input.Key, rules)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &role, ReloadPolicy()
+}
+
+// UpdateRole replaces the metadata and grants of a custom role. The key is
+// immutable because assignments reference it.
+func UpdateRole(key string, input RoleInput) (*model.AuthzRole, error) {
+	if _, ok := roleSpec(key); ok {
+		return nil, ErrBuiltInRole
+	}
+	input.Key = key
+	rules, err := validateRoleInput(&input)
+	if err != nil {
+		return nil, err
+	}
+	db, err := currentPolicyDB()
+	if err != nil {
+		return nil, err
+	}
+
+	var role model.AuthzRole
+	err = db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where(customRoleCondition(key)).First(&role).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return ErrRoleNotFound
+			}
+			return err
+		}
+		role.Name = input.Name
+		role.Description = input.Description
+		role.Enabled = input.Enabled
+		role.Sort = input.Sort
+		if err := tx.Select("name", "description", "enabled", "sort").Save(&role).Error; err != nil {
+			return err
+		}
+		return replaceRolePoliciesInTx(tx, key, rules)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &role, ReloadPolicy()
+}
+
+// DeleteRole removes a custom role, its grants and all assignments of it.
+func DeleteRole(key string) error {
+	if _, ok := roleSpec(key); ok {
+		return ErrBuiltInRole
+	}
+	db, err := currentPolicyDB()
+	if err != nil {
+		return err
+	}
+	err = db.Transaction(func(tx *gorm.DB) error {
+		result := tx.Where(customRoleCondition(key)).Delete(&model.AuthzRole{})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return ErrRoleNotFound
+		}
+		if err := tx.Where("ptype = ? AND v0 = ?", "p", RoleSubject(key)).Delete(&model.CasbinRule{}).Error; err != nil {
+			return err
+		}
+		return tx.Where("ptype = ? AND v1 = ?", "g", RoleSubject(key)).Delete(&model.CasbinRule{}).Error
+	})
+	if err != nil {
+		return err
+	}
+	return ReloadPolicy()
+}
+
+// SetUserRoles replaces the custom roles assigned to a user. An admin with at
+// least one enabled custom role is authorized by those roles instead of the
+// built-in admin baseline; root is unaffected.
+func SetUserRoles(userID int, roleKeys []string) error {
+	keys := make([]string, 0, len(roleKeys))
+	seen := make(map[string]bool, len(roleKeys))
+	for _, key := range roleKeys {
+		key = strings.TrimSpace(key)
+		if key == "" || seen[key] {
+			continue
+		}
+		if _, ok := customRole(key); !ok {
+			return fmt.Errorf("%w: %s", ErrRoleNotFound, key)
+		}
+		seen[key] = true
+		keys = append(keys, key)
+	}
+	db, err := currentPolicyDB()
+	if err != nil {
+		return err
+	}
+	err = db.Transaction(func(tx *gorm.DB) error {
+		if err := clearUserRolesInTx(tx, userID); err != nil {
+			return err
+		}
+		if len(keys) == 0 {
+			return nil
+		}
+		rules := make([]model.CasbinRule, 0, len(keys))
+		for _, key := range keys {
+			rules = append(rules, newRule("g", []string{UserSubject(userID), RoleSubject(key)}))
+		}
+		return tx.Create(&rules).Error
+	})
+	if err != nil {
+		return err
+	}
+	return ReloadPolicy()
+}
+
+// UserRoles returns the custom role keys assigned to a user, including
+// disabled ones.
+func UserRoles(userID int) []string {
+	e := currentEnforcer()
+	if e == nil {
+		return []string{}
+	}
+	policies, err := e.GetFilteredGroupingPolicy(0, UserSubject(userID))
+	if err != nil {
+		return []string{}
+	}
+	keys := make([]string, 0, len(policies))
+	for _, policy := range policies {
+		if len(policy) >= 2 && strings.HasPrefix(policy[1], "role:") {
+			keys = append(keys, strings.TrimPrefix(policy[1], "role:"))
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// enabledUserRoles returns the assigned custom roles that still exist and are
+// enabled.
+func enabledUserRoles(userID int) []string {
+	keys := UserRoles(userID)
+	enabled := keys[:0]
+	for _, key := range keys {
+		if role, ok := customRole(key); ok && role.Enabled {
+			enabled = append(enabled, key)
+		}
+	}
+	return enabled
+}
+
+func clearUserRolesInTx(tx *gorm.DB, userID int) error {
+	return tx.Where("ptype = ? AND v0 = ?", "g", UserSubject(userID)).Delete(&model.CasbinRule{}).Error
+}
+
+// validateRoleInput normalizes the input and converts its grants to policy rows.
+func validateRoleInput(input *RoleInput) ([]model.CasbinRule, error) {
+	input.Key = strings.TrimSpace(input.Key)
+	input.Name = strings.TrimSpace(input.Name)
+	if input.Name == "" {
+		input.Name = input.Key
+	}
+	subject := RoleSubject(input.Key)
+	rules := make([]model.CasbinRule, 0)
+	for resource, actions := range input.Grants {
+		for action, allowed := range actions {
+			if !allowed {
+				continue
+			}
+			if !isKnownPermission(Permission{Resource: resource, Action: action}) {
+				return nil, fmt.Errorf("unknown permission %s.%s", resource, action)
+			}
+			rules = append(rules, newRule("p", []string{subject, resource, action, EffectAllow}))
+		}
+	}
+	for _, grant := range input.ScopedGrants {
+		if !isKnownPermission(Permission{Resource: grant.Resource, Action: grant.Action}) {
+			return nil, fmt.Errorf("unknown permission %s.%s", grant.Resource, grant.Action)
+		}
+		scope, ok := ParseScope(grant.Scope)
+		if !ok || !resourceSupportsScope(grant.Resource, scope.Type) {
+			return nil, fmt.Errorf("invalid scope %q for resource %s", grant.Scope, grant.Resource)
+		}
+		rules = append(rules, newRule("p", []string{subject, scopedObject(grant.Resource, scope), grant.Action, EffectAllow}))
+	}
+	return rules, nil
+}
+
+func replaceRolePoliciesInTx(tx *gorm.DB, key string, rules []model.CasbinRule) error {
+	if err := tx.Where("ptype = ? AND v0 = ?", "p", RoleSubject(key)).Delete(&model.CasbinRule{}).Error; err != nil {
+		return err
+	}
+	if len(rules) == 0 {
+		return nil
+	}
+	seen := make(map[string]bool, len(rules))
+	unique := rules[:0]
+	for _, rule := range rules {
+		id := rule.V1 + "\x00" + rule.V2
+		if seen[id] {
+			continue
+		}
+		seen[id] = true
+		unique = append(unique, rule)
+	}
+	return tx.Create(&unique).Error
+}
+
+// customRoleGrants reads a custom role's grants back from the enforcer.
+func customRoleGrants(key string) (PermissionsMap, []ScopedGrant) {
+	grants := make(PermissionsMap, len(registry))
+	for _, resource := range registry {
+		actions := make(map[string]bool, len(resource.Actions))
+		for _, action := range resource.Actions {
+			actions[action.Action] = false
+		}
+		grants[resource.Resource] = actions
+	}
+	scoped := make([]ScopedGrant, 0)
+	e := currentEnforcer()
+	if e == nil {
+		return grants, scoped
+	}
+	policies, err := e.GetFilteredPolicy(0, RoleSubject(key))
+	if err != nil {
+		return grants, scoped
+	}
+	for _, policy := range policies {
+		if len(policy) < 3 || policyEffect(policy) != EffectAllow {
+			continue
+		}
+		resource, scope, isScoped := splitScopedObject(policy[1])
+		if !isKnownPermission(Permission{Resource: resource, Action: policy[2]}) {
+			continue
+		}
+		if isScoped {
+			scoped = append(scoped, ScopedGrant{Resource: resource, Action: policy[2], Scope: scope.String()})
+			continue
+		}
+		grants[resource][policy[2]] = true
+	}
+	sort.Slice(scoped, func(i, j int) bool {
+		if scoped[i].Resource != scoped[j].Resource {
+			return scoped[i].Resource < scoped[j].Resource
+		}
+		if scoped[i].Action != scoped[j].Action {
+			return scoped[i].Action < scoped[j].Action
+		}
+		return scoped[i].Scope < scoped[j].Scope
+	})
+	return grants, scoped
+}
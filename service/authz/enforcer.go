@@ -14,6 +14,7 @@ import (
 var (
 	enforcerMu sync.RWMutex
 	enforcer   *casbin.SyncedEnforcer
+	policyDB   *gorm.DB
 )
 
 const modelText = `
@@ -23,6 +24,9 @@ r = sub, obj, act
 [policy_definition]
 p = sub, obj, act, eft
 
+[role_definition]
+g = _, _
+
 [policy_effect]
 e = some(where (p.eft == allow))
 
@@ -52,8 +56,13 @@ func Init(db *gorm.DB) error {
 
 	enforcerMu.Lock()
 	enforcer = e
+	policyDB = db
 	enforcerMu.Unlock()
 
+	if err := loadCustomRoles(db); err != nil {
+		return err
+	}
+
 	if !common.IsMasterNode {
 		return nil
 	}
@@ -72,7 +81,10 @@ func ReloadPolicy() error {
 	if enforcer == nil {
 		return fmt.Errorf("authz enforcer is not initialized")
 	}
-	return enforcer.LoadPolicy()
+	if err := enforcer.LoadPolicy(); err != nil {
+		return err
+	}
+	return loadCustomRoles(policyDB)
 }
 
 // StartPolicySync periodically reloads the authorization policy from the database.
@@ -30,7 +30,7 @@ func SetUserPermissions(userID int, permissions PermissionsMap) error {
 		if _, err := e.RemoveFilteredPolicy(0, UserSubject(userID), resource); err != nil {
 			return err
 		}
-		for _, policy := range userOverridePolicies(e, resource, actions) {
+		for _, policy := range userOverridePolicies(e, userID, resource, actions) {
 			if _, err := e.AddPolicy(UserSubject(userID), policy.Resource, policy.Action, policy.Effect); err != nil {
 				return err
 			}
@@ -52,7 +52,7 @@ func SetUserPermissionsInTx(tx *gorm.DB, userID int, permissions PermissionsMap)
 		if err := tx.Where("ptype = ? AND v0 = ? AND v1 = ?", "p", UserSubject(userID), resource).Delete(&model.CasbinRule{}).Error; err != nil {
 			return err
 		}
-		policies := userOverridePolicies(e, resource, actions)
+		policies := userOverridePolicies(e, userID, resource, actions)
 		if len(policies) == 0 {
 			continue
 		}
@@ -90,12 +90,24 @@ func ClearUserPermissionsInTx(tx *gorm.DB, userID int) error {
 	return nil
 }
 
+// ClearUserAuthorization removes the user's overrides and custom role
+// assignments.
 func ClearUserAuthorization(userID int) error {
-	return ClearUserPermissions(userID)
+	if err := ClearUserPermissions(userID); err != nil {
+		return err
+	}
+	e := currentEnforcer()
+	if _, err := e.RemoveFilteredGroupingPolicy(0, UserSubject(userID)); err != nil {
+		return err
+	}
+	return nil
 }
 
 func ClearUserAuthorizationInTx(tx *gorm.DB, userID int) error {
-	return ClearUserPermissionsInTx(tx, userID)
+	if err := ClearUserPermissionsInTx(tx, userID); err != nil {
+		return err
+	}
+	return clearUserRolesInTx(tx, userID)
 }
 
 // ExplicitUserPermissions returns the effective permission matrix for the
@@ -133,9 +145,11 @@ func ExplicitUserOverrides(userID int) PermissionsMap {
 	return result
 }
 
-// userOverridePolicies returns the override entries that differ from the managed
-// role baseline; entries matching the baseline are omitted.
-func userOverridePolicies(e *casbin.SyncedEnforcer, resource string, actions map[string]bool) []overridePolicy {
+// userOverridePolicies returns the override entries that differ from the
+// user's role baseline (the managed role, or the assigned custom roles); entries
+// matching the baseline are omitted.
+func userOverridePolicies(e *casbin.SyncedEnforcer, userID int, resource string, actions map[string]bool) []overridePolicy {
+	roles := resolveSubjectRoles(userID, common.RoleAdminUser)
 	overrides := make([]overridePolicy, 0, len(actions))
 	for _, action := range catalogActions(resource) {
 		desired, ok := actions[action.Action]
@@ -143,7 +157,7 @@ func userOverridePolicies(e *casbin.SyncedEnforcer, resource string, actions map
 			continue
 		}
 		permission := Permission{Resource: resource, Action: action.Action}
-		if desired == roleBaselineAllows(e, managedRoleKey, permission) {
+		if desired == rolesBaselineAllows(e, roles, permission) {
 			continue
 		}
 		effect := EffectDeny
@@ -161,3 +175,12 @@ func userOverridePolicies(e *casbin.SyncedEnforcer, resource string, actions map
 	})
 	return overrides
 }
+
+func rolesBaselineAllows(e *casbin.SyncedEnforcer, roles []string, permission Permission) bool {
+	for _, role := range roles {
+		if roleBaselineAllows(e, role, permission) {
+			return true
+		}
+	}
+	return false
+}
@@ -9,11 +9,13 @@ type ActionDefinition struct {
 	DefaultRoles   []string `json:"-"`
 }
 
-// ResourceDefinition describes a resource and the actions it exposes.
+// ResourceDefinition describes a resource and the actions it exposes. Scopes
+// lists the instance scope types (see Scope) custom roles may be granted on.
 type ResourceDefinition struct {
 	Resource string             `json:"resource"`
 	LabelKey string             `json:"label_key"`
 	Actions  []ActionDefinition `json:"actions"`
+	Scopes   []string           `json:"scopes,omitempty"`
 }
 
 var registry []ResourceDefinition
@@ -31,6 +33,7 @@ func Catalog() []ResourceDefinition {
 			Resource: resource.Resource,
 			LabelKey: resource.LabelKey,
 			Actions:  append([]ActionDefinition(nil), resource.Actions...),
+			Scopes:   append([]string(nil), resource.Scopes...),
 		})
 	}
 	return result
@@ -1,34 +1,132 @@
 package authz
 
-import "github.com/casbin/casbin/v2"
+import (
+	"strings"
+
+	"github.com/casbin/casbin/v2"
+)
+
+const (
+	ReasonNoRole            = "no_role"
+	ReasonSuperuser         = "superuser"
+	ReasonUnknownPermission = "unknown_permission"
+	ReasonNotInitialized    = "not_initialized"
+	ReasonUserDeny          = "user_deny"
+	ReasonUserAllow         = "user_allow"
+	ReasonRoleGrant         = "role_grant"
+	ReasonScopedRoleGrant   = "scoped_role_grant"
+	ReasonNoGrant           = "no_grant"
+)
+
+// Decision is the outcome of an authorization check together with the reason
+// it was reached. Subject and Object identify the policy entry that decided
+// the outcome, if any.
+type Decision struct {
+	Allowed bool     `json:"allowed"`
+	Reason  string   `json:"reason"`
+	Roles   []string `json:"roles"`
+	Subject string   `json:"subject,omitempty"`
+	Object  string   `json:"object,omitempty"`
+}
 
 // Can reports whether the subject may perform the permission. A superuser role
 // short-circuits to allow. Otherwise a per-user override wins, then the union of
 // the subject's role baselines applies.
 func Can(userID int, systemRole int, permission Permission) bool {
+	return Explain(userID, systemRole, permission).Allowed
+}
+
+// CanOn reports whether the subject may perform the permission on a resource
+// instance described by scopes. Resource-wide grants cover every instance;
+// scoped role grants only cover instances carrying a matching scope.
+func CanOn(userID int, systemRole int, permission Permission, scopes ...Scope) bool {
+	return Explain(userID, systemRole, permission, scopes...).Allowed
+}
+
+// Explain evaluates a permission the same way Can and CanOn do and reports
+// which rule decided it.
+func Explain(userID int, systemRole int, permission Permission, scopes ...Scope) Decision {
 	roles := resolveSubjectRoles(userID, systemRole)
+	decision := Decision{Roles: roles}
 	if len(roles) == 0 {
-		return false
+		decision.Reason = ReasonNoRole
+		return decision
 	}
 	for _, role := range roles {
 		if isSuperuserRole(role) {
-			return true
+			decision.Allowed = true
+			decision.Reason = ReasonSuperuser
+			decision.Subject = RoleSubject(role)
+			return decision
 		}
 	}
 	if !isKnownPermission(permission) {
-		return false
+		decision.Reason = ReasonUnknownPermission
+		return decision
 	}
 
 	e := currentEnforcer()
 	if e == nil {
-		return false
+		decision.Reason = ReasonNotInitialized
+		return decision
 	}
-	if effect, ok := explicitSubjectEffect(e, UserSubject(userID), permission); ok {
-		return effect == EffectAllow
+	if effect, ok := explicitSubjectEffect(e, UserSubject(userID), permission.Resource, permission.Action); ok {
+		decision.Subject = UserSubject(userID)
+		decision.Object = permission.Resource
+		decision.Allowed = effect == EffectAllow
+		decision.Reason = ReasonUserDeny
+		if decision.Allowed {
+			decision.Reason = ReasonUserAllow
+		}
+		return decision
 	}
 	for _, role := range roles {
-		if roleBaselineAllows(e, role, permission) {
-			return true
+		if roleObjectAllows(e, role, permission.Resource, permission.Action) {
+			decision.Allowed = true
+			decision.Reason = ReasonRoleGrant
+			decision.Subject = RoleSubject(role)
+			decision.Object = permission.Resource
+			return decision
+		}
+	}
+	for _, scope := range scopes {
+		object := scopedObject(permission.Resource, scope)
+		for _, role := range roles {
+			if roleObjectAllows(e, role, object, permission.Action) {
+				decision.Allowed = true
+				decision.Reason = ReasonScopedRoleGrant
+				decision.Subject = RoleSubject(role)
+				decision.Object = object
+				return decision
+			}
+		}
+	}
+	decision.Reason = ReasonNoGrant
+	return decision
+}
+
+// HasScopedGrant reports whether any of the subject's roles grants the
+// permission on some scoped subset of the resource. Callers use it to decide
+// whether resolving the target instance is worthwhile before calling CanOn.
+func HasScopedGrant(userID int, systemRole int, permission Permission) bool {
+	e := currentEnforcer()
+	if e == nil {
+		return false
+	}
+	if effect, ok := explicitSubjectEffect(e, UserSubject(userID), permission.Resource, permission.Action); ok && effect == EffectDeny {
+		return false
+	}
+	prefix := permission.Resource + scopeSeparator
+	for _, role := range resolveSubjectRoles(userID, systemRole) {
+		policies, err := e.GetFilteredPolicy(0, RoleSubject(role))
+		if err != nil {
+			continue
+		}
+		for _, policy := range policies {
+			if len(policy) >= 3 && strings.HasPrefix(policy[1], prefix) &&
+				policy[2] == permission.Action && policyEffect(policy) == EffectAllow {
+				return true
+			}
 		}
 	}
 	return false
@@ -51,12 +149,16 @@ func Capabilities(userID int, systemRole int) PermissionsMap {
 }
 
 func roleBaselineAllows(e *casbin.SyncedEnforcer, roleKey string, permission Permission) bool {
-	effect, ok := explicitSubjectEffect(e, RoleSubject(roleKey), permission)
+	return roleObjectAllows(e, roleKey, permission.Resource, permission.Action)
+}
+
+func roleObjectAllows(e *casbin.SyncedEnforcer, roleKey string, object string, action string) bool {
+	effect, ok := explicitSubjectEffect(e, RoleSubject(roleKey), object, action)
 	return ok && effect == EffectAllow
 }
 
-func explicitSubjectEffect(e *casbin.SyncedEnforcer, subject string, permission Permission) (string, bool) {
-	policies, err := e.GetFilteredPolicy(0, subject, permission.Resource, permission.Action)
+func explicitSubjectEffect(e *casbin.SyncedEnforcer, subject string, object string, action string) (string, bool) {
+	policies, err := e.GetFilteredPolicy(0, subject, object, action)
 	if err != nil {
 		return "", false
 	}
@@ -8,6 +8,9 @@ const (
 	ActionWrite          = "write"
 	ActionSensitiveWrite = "sensitive_write"
 	ActionSecretView     = "secret_view"
+
+	// ScopeTypeTag scopes a channel grant to channels carrying the given tag.
+	ScopeTypeTag = "tag"
 )
 
 var (
@@ -18,10 +21,41 @@ var (
 	ChannelSecretView     = Permission{Resource: ResourceChannel, Action: ActionSecretView}
 )
 
+// ChannelTagScopes returns the instance scopes of a channel with the given
+// tags; untagged channels have no scope and only match resource-wide grants.
+func ChannelTagScopes(tags ...string) []Scope {
+	scopes := make([]Scope, 0, len(tags))
+	for _, tag := range tags {
+		if tag != "" {
+			scopes = append(scopes, Scope{Type: ScopeTypeTag, Value: tag})
+		}
+	}
+	return scopes
+}
+
+// CanOnChannel reports whether the subject may perform the permission on
+// channels with every one of the given tags. Resource-wide grants cover all
+// channels; an empty tag only matches resource-wide grants.
+func CanOnChannel(userID int, systemRole int, permission Permission, tags ...string) bool {
+	if Can(userID, systemRole, permission) {
+		return true
+	}
+	if len(tags) == 0 {
+		return false
+	}
+	for _, tag := range tags {
+		if tag == "" || !CanOn(userID, systemRole, permission, ChannelTagScopes(tag)...) {
+			return false
+		}
+	}
+	return true
+}
+
 func init() {
 	RegisterResource(ResourceDefinition{
 		Resource: ResourceChannel,
 		LabelKey: "Channel Management",
+		Scopes:   []string{ScopeTypeTag},
 		Actions: []ActionDefinition{
 			{
 				Action:         ActionRead,
@@ -37,23 +37,42 @@ var builtInRoles = []RoleSpec{
 
 // RoleDescriptor exposes a role together with its baseline grant matrix.
 type RoleDescriptor struct {
-	Key       string         `json:"key"`
-	Name      string         `json:"name"`
-	BuiltIn   bool           `json:"built_in"`
-	Superuser bool           `json:"superuser"`
-	Grants    PermissionsMap `json:"grants"`
+	Key          string         `json:"key"`
+	Name         string         `json:"name"`
+	Description  string         `json:"description"`
+	BuiltIn      bool           `json:"built_in"`
+	Superuser    bool           `json:"superuser"`
+	Enabled      bool           `json:"enabled"`
+	Grants       PermissionsMap `json:"grants"`
+	ScopedGrants []ScopedGrant  `json:"scoped_grants"`
 }
 
-// Roles returns the role descriptors with their baseline grants.
+// Roles returns the built-in roles followed by the custom roles, each with its
+// baseline grants.
 func Roles() []RoleDescriptor {
-	result := make([]RoleDescriptor, 0, len(builtInRoles))
+	custom := sortedCustomRoles()
+	result := make([]RoleDescriptor, 0, len(builtInRoles)+len(custom))
 	for _, spec := range builtInRoles {
 		result = append(result, RoleDescriptor{
-			Key:       spec.Key,
-			Name:      spec.Name,
-			BuiltIn:   spec.BuiltIn,
-			Superuser: spec.Superuser,
-			Grants:    roleGrants(spec),
+			Key:          spec.Key,
+			Name:         spec.Name,
+			Description:  spec.Description,
+			BuiltIn:      spec.BuiltIn,
+			Superuser:    spec.Superuser,
+			Enabled:      true,
+			Grants:       roleGrants(spec),
+			ScopedGrants: []ScopedGrant{},
+		})
+	}
+	for _, role := range custom {
+		grants, scoped := customRoleGrants(role.Key)
+		result = append(result, RoleDescriptor{
+			Key:          role.Key,
+			Name:         role.Name,
+			Description:  role.Description,
+			Enabled:      role.Enabled,
+			Grants:       grants,
+			ScopedGrants: scoped,
 		})
 	}
 	return result
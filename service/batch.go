@@ -0,0 +1,352 @@
+package service
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/dto"
+	"github.com/QuantumNous/new-api/logger"
+	"github.com/QuantumNous/new-api/model"
+	"github.com/QuantumNous/new-api/types"
+
+	"github.com/tidwall/gjson"
+)
+
+const (
+	BatchFilePurposeOutput = "batch_output"
+	// 单行最大长度，与 OpenAI 对单个 batch 请求体的限制保持同一量级
+	batchMaxLineBytes = 16 << 20
+)
+
+// BatchEndpointRelayFormats 支持的 batch endpoint 及其本地执行时使用的 RelayFormat
+var BatchEndpointRelayFormats = map[string]types.RelayFormat{
+	"/v1/chat/completions": types.RelayFormatOpenAI,
+	"/v1/completions":      types.RelayFormatOpenAI,
+	"/v1/embeddings":       types.RelayFormatEmbedding,
+	"/v1/responses":        types.RelayFormatOpenAIResponses,
+	"/v1/moderations":      types.RelayFormatOpenAI,
+}
+
+var (
+	ErrBatchLineTooLong     = errors.New("batch input line is too long")
+	ErrBatchTooManyRequests = errors.New("batch exceeds the maximum number of requests")
+)
+
+func int64PtrOrNil(v int64) *int64 {
+	if v == 0 {
+		return nil
+	}
+	return &v
+}
+
+func stringPtrOrNil(v string) *string {
+	if v == "" {
+		return nil
+	}
+	return &v
+}
+
+func ToOpenAIBatch(b *model.Batch) *dto.OpenAIBatch {
+	resp := &dto.OpenAIBatch{
+		Id:               b.BatchId,
+		Object:           "batch",
+		Endpoint:         b.Endpoint,
+		InputFileId:      b.InputFileId,
+		CompletionWindow: b.CompletionWindow,
+		Status:           b.Status,
+		OutputFileId:     stringPtrOrNil(b.OutputFileId),
+		ErrorFileId:      stringPtrOrNil(b.ErrorFileId),
+		CreatedAt:        b.CreatedAt,
+		InProgressAt:     int64PtrOrNil(b.InProgressAt),
+		ExpiresAt:        int64PtrOrNil(b.ExpiresAt),
+		FinalizingAt:     int64PtrOrNil(b.FinalizingAt),
+		CompletedAt:      int64PtrOrNil(b.CompletedAt),
+		FailedAt:         int64PtrOrNil(b.FailedAt),
+		ExpiredAt:        int64PtrOrNil(b.ExpiredAt),
+		CancellingAt:     int64PtrOrNil(b.CancellingAt),
+		CancelledAt:      int64PtrOrNil(b.CancelledAt),
+		RequestCounts: dto.OpenAIBatchRequestCounts{
+			Total:     b.TotalCount,
+			Completed: b.CompletedCount,
+			Failed:    b.FailedCount,
+		},
+	}
+	if b.Errors != "" {
+		var errs []dto.OpenAIBatchError
+		if err := common.UnmarshalJsonStr(b.Errors, &errs); err == nil && len(errs) > 0 {
+			resp.Errors = &dto.OpenAIBatchErrors{Object: "list", Data: errs}
+		}
+	}
+	if b.Metadata != "" {
+		_ = common.UnmarshalJsonStr(b.Metadata, &resp.Metadata)
+	}
+	return resp
+}
+
+// SetBatchErrors 记录批处理级别的错误（校验失败等）
+func SetBatchErrors(b *model.Batch, errs []dto.OpenAIBatchError) {
+	if len(errs) == 0 {
+		b.Errors = ""
+		return
+	}
+	data, err := common.Marshal(errs)
+	if err != nil {
+		return
+	}
+	b.Errors = string(data)
+}
+
+// ReadBatchInputLines 逐行读取 JSONL，跳过空行，line 从 1 开始计数
+func ReadBatchInputLines(reader io.Reader, fn func(line int, data []byte) error) error {
+	br := bufio.NewReaderSize(reader, 64<<10)
+	line := 0
+	for {
+		data, err := readBatchLine(br)
+		if len(data) > 0 || err == nil {
+			line++
+			if trimmed := bytes.TrimSpace(data); len(trimmed) > 0 {
+				if fnErr := fn(line, trimmed); fnErr != nil {
+					return fnErr
+				}
+			}
+		}
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+func readBatchLine(br *bufio.Reader) ([]byte, error) {
+	var buf []byte
+	for {
+		chunk, isPrefix, err := br.ReadLine()
+		buf = append(buf, chunk...)
+		if len(buf) > batchMaxLineBytes {
+			return nil, ErrBatchLineTooLong
+		}
+		if err != nil || !isPrefix {
+			return buf, err
+		}
+	}
+}
+
+// ParseBatchInputLine 解析并校验单行输入
+func ParseBatchInputLine(data []byte, endpoint string) (*dto.OpenAIBatchInputLine, error) {
+	var input dto.OpenAIBatchInputLine
+	if err := common.Unmarshal(data, &input); err != nil {
+		return nil, fmt.Errorf("invalid JSON line: %w", err)
+	}
+	if input.CustomId == "" {
+		return nil, errors.New("missing custom_id")
+	}
+	if !strings.EqualFold(input.Method, http.MethodPost) {
+		return nil, fmt.Errorf("unsupported method %q, only POST is supported", input.Method)
+	}
+	if input.Url != endpoint {
+		return nil, fmt.Errorf("url %q does not match the batch endpoint %q", input.Url, endpoint)
+	}
+	if len(input.Body) == 0 || !gjson.ValidBytes(input.Body) || !gjson.ParseBytes(input.Body).IsObject() {
+		return nil, errors.New("body must be a JSON object")
+	}
+	if gjson.GetBytes(input.Body, "stream").Bool() {
+		return nil, errors.New("streaming is not supported in batch requests")
+	}
+	if gjson.GetBytes(input.Body, "model").String() == "" {
+		return nil, errors.New("missing model in body")
+	}
+	return &input, nil
+}
+
+// ValidateBatchInputFile 校验输入文件，返回请求总数；校验失败时返回逐行错误
+func ValidateBatchInputFile(ctx context.Context, file *model.File, endpoint string, maxRequests int) (int, []dto.OpenAIBatchError, error) {
+	content, err := OpenFileContent(ctx, file)
+	if err != nil {
+		return 0, nil, err
+	}
+	defer content.Close()
+
+	total := 0
+	var lineErrors []dto.OpenAIBatchError
+	customIds := make(map[string]struct{})
+	err = ReadBatchInputLines(content, func(line int, data []byte) error {
+		total++
+		lineNo := line
+		input, parseErr := ParseBatchInputLine(data, endpoint)
+		if parseErr == nil {
+			if _, ok := customIds[input.CustomId]; ok {
+				parseErr = fmt.Errorf("duplicate custom_id %q", input.CustomId)
+			} else {
+				customIds[input.CustomId] = struct{}{}
+			}
+		}
+		if parseErr != nil && len(lineErrors) < 100 {
+			lineErrors = append(lineErrors, dto.OpenAIBatchError{
+				Code:    "invalid_request",
+				Message: parseErr.Error(),
+				Line:    &lineNo,
+			})
+		}
+		if maxRequests > 0 && total > maxRequests {
+			return fmt.Errorf("%w (%d)", ErrBatchTooManyRequests, maxRequests)
+		}
+		return nil
+	})
+	if err != nil {
+		if errors.Is(err, ErrBatchLineTooLong) || errors.Is(err, ErrBatchTooManyRequests) {
+			return total, append(lineErrors, dto.OpenAIBatchError{Code: "invalid_request", Message: err.Error()}), nil
+		}
+		return total, nil, err
+	}
+	if total == 0 {
+		lineErrors = append(lineErrors, dto.OpenAIBatchError{Code: "empty_file", Message: "The input file is empty"})
+	}
+	return total, lineErrors, nil
+}
+
+// SaveBatchResultFile 将输出/错误结果保存为用户可下载的文件
+func SaveBatchResultFile(b *model.Batch, reader io.Reader, filename string) (*model.File, error) {
+	storage, err := common.GetDefaultFileStorage()
+	if err != nil {
+		return nil, err
+	}
+	key, size, err := storage.Put(reader, 1<<40)
+	if err != nil {
+		return nil, err
+	}
+	file := &model.File{
+		FileId:     model.GenerateFileID(),
+		UserId:     b.UserId,
+		TokenId:    b.TokenId,
+		Filename:   filename,
+		Purpose:    BatchFilePurposeOutput,
+		Bytes:      size,
+		Status:     model.FileStatusProcessed,
+		Storage:    storage.Name(),
+		StorageKey: key,
+	}
+	if err := file.Insert(); err != nil {
+		_ = storage.Delete(key)
+		return nil, err
+	}
+	return file, nil
+}
+
+// IsBatchCapableChannel 判断渠道是否支持整体转发 OpenAI Batch API
+func IsBatchCapableChannel(channel *model.Channel) bool {
+	return IsFileCapableChannel(channel)
+}
+
+func doBatchUpstreamJSON(ctx context.Context, channel *model.Channel, method string, path string, payload any) (*dto.OpenAIBatch, error) {
+	var body io.Reader
+	contentType := ""
+	if payload != nil {
+		data, err := common.Marshal(payload)
+		if err != nil {
+			return nil, err
+		}
+		body = bytes.NewReader(data)
+		contentType = "application/json"
+	}
+	resp, err := DoFileUpstreamRequest(ctx, channel, method, path, body, contentType)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("upstream returned status %d: %s", resp.StatusCode, string(respBody))
+	}
+	var upstream dto.OpenAIBatch
+	if err := common.Unmarshal(respBody, &upstream); err != nil {
+		return nil, err
+	}
+	return &upstream, nil
+}
+
+// CreateUpstreamBatch 在上游渠道创建批处理，inputFileId 为上游文件 ID
+func CreateUpstreamBatch(ctx context.Context, channel *model.Channel, inputFileId string, b *model.Batch) (*dto.OpenAIBatch, error) {
+	return doBatchUpstreamJSON(ctx, channel, http.MethodPost, "/v1/batches", dto.OpenAIBatchRequest{
+		InputFileId:      inputFileId,
+		Endpoint:         b.Endpoint,
+		CompletionWindow: b.CompletionWindow,
+	})
+}
+
+func GetUpstreamBatch(ctx context.Context, channel *model.Channel, upstreamBatchId string) (*dto.OpenAIBatch, error) {
+	return doBatchUpstreamJSON(ctx, channel, http.MethodGet, "/v1/batches/"+upstreamBatchId, nil)
+}
+
+func CancelUpstreamBatch(ctx context.Context, channel *model.Channel, upstreamBatchId string) (*dto.OpenAIBatch, error) {
+	return doBatchUpstreamJSON(ctx, channel, http.MethodPost, "/v1/batches/"+upstreamBatchId+"/cancel", nil)
+}
+
+// AppendBatchSegment 将结果分段的存储 key 追加到 JSON 列表中
+func AppendBatchSegment(segments string, key string) string {
+	keys := ParseBatchSegments(segments)
+	keys = append(keys, key)
+	data, err := common.Marshal(keys)
+	if err != nil {
+		return segments
+	}
+	return string(data)
+}
+
+func ParseBatchSegments(segments string) []string {
+	var keys []string
+	if segments == "" {
+		return keys
+	}
+	_ = common.UnmarshalJsonStr(segments, &keys)
+	return keys
+}
+
+// OpenBatchSegments 按顺序打开所有结果分段，返回拼接后的 reader，调用方负责 close
+func OpenBatchSegments(segments string) (io.Reader, func(), error) {
+	storage, err := common.GetDefaultFileStorage()
+	if err != nil {
+		return nil, nil, err
+	}
+	var closers []io.Closer
+	closeAll := func() {
+		for _, closer := range closers {
+			_ = closer.Close()
+		}
+	}
+	var readers []io.Reader
+	for _, key := range ParseBatchSegments(segments) {
+		reader, err := storage.Open(key)
+		if err != nil {
+			closeAll()
+			return nil, nil, err
+		}
+		closers = append(closers, reader)
+		readers = append(readers, reader)
+	}
+	return io.MultiReader(readers...), closeAll, nil
+}
+
+// DeleteBatchSegments 删除已合并的结果分段
+func DeleteBatchSegments(ctx context.Context, segments string) {
+	storage, err := common.GetDefaultFileStorage()
+	if err != nil {
+		return
+	}
+	for _, key := range ParseBatchSegments(segments) {
+		if err := storage.Delete(key); err != nil {
+			logger.LogWarn(ctx, fmt.Sprintf("failed to delete batch segment %s: %s", key, err.Error()))
+		}
+	}
+}
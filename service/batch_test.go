@@ -0,0 +1,51 @@
+package service
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestReadBatchInputLinesSkipsBlankLines(t *testing.T) {
+	input := "{\"a\":1}\n\n  \n{\"b\":2}\r\n{\"c\":3}"
+	var lines []int
+	var data []string
+	err := ReadBatchInputLines(strings.NewReader(input), func(line int, d []byte) error {
+		lines = append(lines, line)
+		data = append(data, string(d))
+		return nil
+	})
+	require.NoError(t, err)
+	require.Equal(t, []int{1, 4, 5}, lines)
+	require.Equal(t, []string{`{"a":1}`, `{"b":2}`, `{"c":3}`}, data)
+}
+
+func TestParseBatchInputLine(t *testing.T) {
+	const endpoint = "/v1/chat/completions"
+	valid := `{"custom_id":"req-1","method":"POST","url":"/v1/chat/completions","body":{"model":"gpt-4o-mini","messages":[]}}`
+	input, err := ParseBatchInputLine([]byte(valid), endpoint)
+	require.NoError(t, err)
+	require.Equal(t, "req-1", input.CustomId)
+
+	invalid := map[string]string{
+		"missing custom_id": `{"method":"POST","url":"/v1/chat/completions","body":{"model":"m"}}`,
+		"wrong method":      `{"custom_id":"a","method":"GET","url":"/v1/chat/completions","body":{"model":"m"}}`,
+		"wrong url":         `{"custom_id":"a","method":"POST","url":"/v1/embeddings","body":{"model":"m"}}`,
+		"body not object":   `{"custom_id":"a","method":"POST","url":"/v1/chat/completions","body":"x"}`,
+		"stream":            `{"custom_id":"a","method":"POST","url":"/v1/chat/completions","body":{"model":"m","stream":true}}`,
+		"missing model":     `{"custom_id":"a","method":"POST","url":"/v1/chat/completions","body":{}}`,
+		"invalid json":      `{"custom_id":`,
+	}
+	for name, line := range invalid {
+		_, err := ParseBatchInputLine([]byte(line), endpoint)
+		require.Error(t, err, name)
+	}
+}
+
+func TestBatchSegments(t *testing.T) {
+	segments := AppendBatchSegment("", "a")
+	segments = AppendBatchSegment(segments, "b")
+	require.Equal(t, []string{"a", "b"}, ParseBatchSegments(segments))
+	require.Empty(t, ParseBatchSegments(""))
+}
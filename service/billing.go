@@ -4,21 +4,29 @@ import (
 	"fmt"
 
 	"github.com/QuantumNous/new-api/logger"
+	"github.com/QuantumNous/new-api/pkg/tracing"
 	relaycommon "github.com/QuantumNous/new-api/relay/common"
 	"github.com/QuantumNous/new-api/types"
 	"github.com/gin-gonic/gin"
+	"go.opentelemetry.io/otel/attribute"
 )
 
 const (
-	BillingSourceWallet       = "wallet"
-	BillingSourceSubscription = "subscription"
+	BillingSourceWallet             = "wallet"
+	BillingSourceSubscription       = "subscription"
+	BillingSourceOrganizationWallet = "organization_wallet"
 )
 
 // PreConsumeBilling 根据用户计费偏好创建 BillingSession 并执行预扣费。
 // 会话存储在 relayInfo.Billing 上，供后续 Settle / Refund 使用。
+// 预扣费前会先校验令牌的单次费用上限、每分钟请求数与周期消费上限。
 func PreConsumeBilling(c *gin.Context, preConsumedQuota int, relayInfo *relaycommon.RelayInfo) *types.NewAPIError {
+	if apiErr := CheckTokenLimits(c, relayInfo.TokenId, relayInfo.OriginModelName, preConsumedQuota); apiErr != nil {
+		return apiErr
+	}
 	session, apiErr := NewBillingSession(c, relayInfo, preConsumedQuota)
 	if apiErr != nil {
+		ReleaseTokenSpendReservation(c)
 		return apiErr
 	}
 	relayInfo.Billing = session
@@ -31,7 +39,18 @@ func PreConsumeBilling(c *gin.Context, preConsumedQuota int, relayInfo *relaycom
 
 // SettleBilling 执行计费结算。如果 RelayInfo 上有 BillingSession 则通过 session 结算，
 // 否则回退到旧的 PostConsumeQuota 路径（兼容按次计费等场景）。
-func SettleBilling(ctx *gin.Context, relayInfo *relaycommon.RelayInfo, actualQuota int) error {
+func SettleBilling(ctx *gin.Context, relayInfo *relaycommon.RelayInfo, actualQuota int) (err error) {
+	// 输入审核的费用在审核时预留，随请求一起结算
+	actualQuota += relayInfo.ModerationQuota
+	span, endSpan := tracing.StartGin(ctx, "relay.settle", relayInfo.TraceAttributes()...)
+	span.SetAttributes(attribute.Int("newapi.quota", actualQuota))
+	defer func() {
+		// 结算失败时额度调整可能只完成了一部分，但请求已经产生了实际消耗，
+		// 同样按实际消耗修正消费窗口中的预留，避免预留一直占用窗口
+		RecordTokenSpend(ctx, relayInfo.TokenId, relayInfo.OriginModelName, actualQuota)
+		endSpan(err)
+	}()
+
 	if relayInfo.Billing != nil {
 		preConsumed := relayInfo.Billing.GetPreConsumedQuota()
 		delta := actualQuota - preConsumed
@@ -62,7 +81,7 @@ func SettleBilling(ctx *gin.Context, relayInfo *relaycommon.RelayInfo, actualQuo
 		if actualQuota != 0 {
 			if relayInfo.BillingSource == BillingSourceSubscription {
 				checkAndSendSubscriptionQuotaNotify(relayInfo)
-			} else {
+			} else if relayInfo.BillingSource != BillingSourceOrganizationWallet {
 				checkAndSendQuotaNotify(relayInfo, actualQuota-preConsumed, preConsumed)
 			}
 		}
@@ -1,6 +1,7 @@
 package service
 
 import (
+	"errors"
 	"fmt"
 	"net/http"
 	"strings"
@@ -80,6 +81,8 @@ func (s *BillingSession) Settle(actualQuota int) error {
 
 // Refund 退还所有预扣费，幂等安全，异步执行。
 func (s *BillingSession) Refund(c *gin.Context) {
+	// 令牌消费窗口的预留与资金来源的预扣相互独立，未结算的请求总是释放
+	ReleaseTokenSpendReservation(c)
 	s.mu.Lock()
 	if s.settled || s.refunded || !s.needsRefundLocked() {
 		s.mu.Unlock()
@@ -111,6 +114,8 @@ func (s *BillingSession) Refund(c *gin.Context) {
 		if extraReserved > 0 && funding.Source() == BillingSourceSubscription && subscriptionId > 0 {
 			if err := model.PostConsumeUserSubscriptionDelta(subscriptionId, -int64(extraReserved)); err != nil {
 				common.SysLog("error refunding subscription extra reserved quota: " + err.Error())
+			} else if sub, ok := funding.(*SubscriptionFunding); ok {
+				sub.adjustMemberUsed(-extraReserved)
 			}
 		}
 		// 2) 退还令牌额度
@@ -213,6 +218,9 @@ func (s *BillingSession) preConsume(c *gin.Context, quota int) *types.NewAPIErro
 			}
 			s.tokenConsumed = 0
 		}
+		if errors.Is(err, model.ErrOrganizationQuotaInsufficient) || errors.Is(err, model.ErrOrganizationMemberQuotaExceeded) {
+			return organizationQuotaError(err)
+		}
 		// TODO: model 层应定义哨兵错误（如 ErrNoActiveSubscription），用 errors.Is 替代字符串匹配
 		errMsg := err.Error()
 		if strings.Contains(errMsg, "no active subscription") || strings.Contains(errMsg, "subscription quota insufficient") {
@@ -237,8 +245,26 @@ func (s *BillingSession) reserveFunding(delta int) error {
 		}
 		funding.consumed += delta
 		return nil
+	case *OrganizationWalletFunding:
+		if err := model.PreConsumeOrganizationQuota(funding.organizationId, funding.userId, delta); err != nil {
+			if errors.Is(err, model.ErrOrganizationQuotaInsufficient) || errors.Is(err, model.ErrOrganizationMemberQuotaExceeded) {
+				return organizationQuotaError(err)
+			}
+			return types.NewError(err, types.ErrorCodeUpdateDataError, types.ErrOptionWithSkipRetry())
+		}
+		funding.consumed += delta
+		return nil
 	case *SubscriptionFunding:
+		if funding.organizationId > 0 {
+			if err := model.ReserveOrganizationMemberQuota(funding.organizationId, funding.userId, delta); err != nil {
+				if errors.Is(err, model.ErrOrganizationMemberQuotaExceeded) {
+					return organizationQuotaError(err)
+				}
+				return types.NewError(err, types.ErrorCodeUpdateDataError, types.ErrOptionWithSkipRetry())
+			}
+		}
 		if err := model.PostConsumeUserSubscriptionDelta(funding.subscriptionId, int64(delta)); err != nil {
+			funding.adjustMemberUsed(-delta)
 			return types.NewErrorWithStatusCode(
 				fmt.Errorf("订阅额度不足或未配置订阅: %s", err.Error()),
 				types.ErrorCodeInsufficientUserQuota,
@@ -261,9 +287,17 @@ func (s *BillingSession) rollbackFundingReserve(delta int) {
 		} else {
 			funding.consumed -= delta
 		}
+	case *OrganizationWalletFunding:
+		if err := model.AdjustOrganizationQuota(funding.organizationId, funding.userId, -delta); err != nil {
+			common.SysLog("error rolling back organization wallet funding reserve: " + err.Error())
+		} else {
+			funding.consumed -= delta
+		}
 	case *SubscriptionFunding:
 		if err := model.PostConsumeUserSubscriptionDelta(funding.subscriptionId, -int64(delta)); err != nil {
 			common.SysLog("error rolling back subscription funding reserve: " + err.Error())
+		} else {
+			funding.adjustMemberUsed(-delta)
 		}
 	}
 }
@@ -344,6 +378,15 @@ func NewBillingSession(c *gin.Context, relayInfo *relaycommon.RelayInfo, preCons
 		return nil, types.NewError(fmt.Errorf("relayInfo is nil"), types.ErrorCodeInvalidRequest, types.ErrOptionWithSkipRetry())
 	}
 
+	// 组织成员的请求由组织付费，不使用个人钱包与订阅
+	member, err := model.GetActiveOrganizationMemberByUserId(relayInfo.UserId)
+	if err != nil {
+		return nil, types.NewError(err, types.ErrorCodeQueryDataError, types.ErrOptionWithSkipRetry())
+	}
+	if member != nil {
+		return newOrganizationBillingSession(c, relayInfo, member, preConsumedQuota)
+	}
+
 	pref := common.NormalizeBillingPreference(relayInfo.UserSetting.BillingPreference)
 
 	// 钱包路径需要先检查用户额度
@@ -440,3 +483,71 @@ func NewBillingSession(c *gin.Context, relayInfo *relaycommon.RelayInfo, preCons
 		return session, nil
 	}
 }
+
+// newOrganizationBillingSession 组织成员的计费会话：优先使用组织订阅，
+// 订阅额度不足且订阅允许回退时使用组织钱包；预扣前校验成员额度上限
+func newOrganizationBillingSession(c *gin.Context, relayInfo *relaycommon.RelayInfo, member *model.OrganizationMember, preConsumedQuota int) (*BillingSession, *types.NewAPIError) {
+	if err := model.CheckOrganizationMemberQuota(member, preConsumedQuota); err != nil {
+		return nil, organizationQuotaError(err)
+	}
+	organizationId := member.OrganizationId
+	relayInfo.OrganizationId = organizationId
+
+	tryWallet := func() (*BillingSession, *types.NewAPIError) {
+		session := &BillingSession{
+			relayInfo: relayInfo,
+			funding:   &OrganizationWalletFunding{organizationId: organizationId, userId: relayInfo.UserId},
+		}
+		if apiErr := session.preConsume(c, preConsumedQuota); apiErr != nil {
+			return nil, apiErr
+		}
+		return session, nil
+	}
+
+	hasSub, err := model.HasActiveOrganizationSubscription(organizationId)
+	if err != nil {
+		return nil, types.NewError(err, types.ErrorCodeQueryDataError, types.ErrOptionWithSkipRetry())
+	}
+	if !hasSub {
+		return tryWallet()
+	}
+	subConsume := int64(preConsumedQuota)
+	if subConsume <= 0 {
+		subConsume = 1
+	}
+	session := &BillingSession{
+		relayInfo: relayInfo,
+		funding: &SubscriptionFunding{
+			requestId:      relayInfo.RequestId,
+			userId:         relayInfo.UserId,
+			organizationId: organizationId,
+			modelName:      relayInfo.OriginModelName,
+			amount:         subConsume,
+		},
+	}
+	apiErr := session.preConsume(c, int(subConsume))
+	if apiErr == nil {
+		return session, nil
+	}
+	if apiErr.GetErrorCode() != types.ErrorCodeInsufficientUserQuota {
+		return nil, apiErr
+	}
+	allowOverflow, err := model.OrganizationActiveSubscriptionsAllowWalletOverflow(organizationId)
+	if err != nil {
+		return nil, types.NewError(err, types.ErrorCodeQueryDataError, types.ErrOptionWithSkipRetry())
+	}
+	if !allowOverflow {
+		return nil, apiErr
+	}
+	return tryWallet()
+}
+
+func organizationQuotaError(err error) *types.NewAPIError {
+	message := "组织额度不足"
+	if errors.Is(err, model.ErrOrganizationMemberQuotaExceeded) {
+		message = "组织成员额度已达上限"
+	}
+	return types.NewErrorWithStatusCode(fmt.Errorf("%s: %s", message, err.Error()),
+		types.ErrorCodeInsufficientUserQuota, http.StatusForbidden,
+		types.ErrOptionWithSkipRetry(), types.ErrOptionWithNoRecordErrorLog())
+}
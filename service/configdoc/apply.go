@@ -0,0 +1,578 @@
+package configdoc
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/model"
+	"github.com/QuantumNous/new-api/setting/operation_setting"
+	"github.com/samber/lo"
+	"gorm.io/gorm"
+)
+
+const (
+	KindOption           = "option"
+	KindSetting          = "setting"
+	KindChannel          = "channel"
+	KindSubscriptionPlan = "subscription_plan"
+
+	ActionCreate = "create"
+	ActionUpdate = "update"
+	ActionDelete = "delete"
+)
+
+// ApplyOptions 导入参数。Prune 为 true 时删除文档中不存在的渠道、停用文档中不存在的套餐；
+// 配置项只会被覆盖，不会删除
+type ApplyOptions struct {
+	DryRun     bool
+	Prune      bool
+	Passphrase string
+}
+
+// Change 一个对象的变更，Fields 为发生变化的字段，密钥只报告字段名不报告取值
+type Change struct {
+	Kind   string   `json:"kind"`
+	Name   string   `json:"name"`
+	Action string   `json:"action"`
+	Fields []string `json:"fields,omitempty"`
+}
+
+// Report 导入结果。存在 Errors 时不会写入任何变更
+type Report struct {
+	DryRun   bool     `json:"dry_run"`
+	Created  int      `json:"created"`
+	Updated  int      `json:"updated"`
+	Deleted  int      `json:"deleted"`
+	Changes  []Change `json:"changes"`
+	Warnings []string `json:"warnings,omitempty"`
+	Errors   []string `json:"errors,omitempty"`
+}
+
+func (r *Report) add(change Change) {
+	switch change.Action {
+	case ActionCreate:
+		r.Created++
+	case ActionUpdate:
+		r.Updated++
+	case ActionDelete:
+		r.Deleted++
+	}
+	r.Changes = append(r.Changes, change)
+}
+
+func (r *Report) errorf(format string, args ...any) {
+	r.Errors = append(r.Errors, fmt.Sprintf(format, args...))
+}
+
+func (r *Report) HasErrors() bool {
+	return len(r.Errors) > 0
+}
+
+type channelUpdate struct {
+	channel *model.Channel
+	fields  []string
+}
+
+type planUpdate struct {
+	id     int
+	values map[string]interface{}
+}
+
+// changeSet 计算出的待写入变更
+type changeSet struct {
+	options        map[string]string
+	createChannels []*model.Channel
+	updateChannels []channelUpdate
+	deleteChannels []*model.Channel
+	createPlans    []*model.SubscriptionPlan
+	updatePlans    []planUpdate
+}
+
+func (s *changeSet) empty() bool {
+	return len(s.options) == 0 && len(s.createChannels) == 0 && len(s.updateChannels) == 0 &&
+		len(s.deleteChannels) == 0 && len(s.createPlans) == 0 && len(s.updatePlans) == 0
+}
+
+// Apply 将配置文档与当前实例比较并写入差异。DryRun 时只返回差异。
+// 同一份文档重复导入不会产生变更；校验失败时返回带 Errors 的报告，不写入任何内容
+func Apply(doc *Document, opts ApplyOptions) (*Report, error) {
+	report := &Report{DryRun: opts.DryRun, Changes: make([]Change, 0)}
+	codec := newSecretCodec(opts.Passphrase)
+	set := &changeSet{options: make(map[string]string)}
+
+	diffOptions(doc, codec, set, report)
+	if err := diffChannels(doc, opts, codec, set, report); err != nil {
+		return nil, err
+	}
+	if err := diffPlans(doc, opts, set, report); err != nil {
+		return nil, err
+	}
+	if opts.DryRun || report.HasErrors() || set.empty() {
+		return report, nil
+	}
+	if err := set.commit(); err != nil {
+		return nil, err
+	}
+	return report, nil
+}
+
+func diffOptions(doc *Document, codec *secretCodec, set *changeSet, report *Report) {
+	current := snapshotOptions()
+	type entry struct {
+		kind  string
+		key   string
+		value any
+	}
+	entries := make([]entry, 0, len(doc.Options))
+	for key, value := range doc.Options {
+		entries = append(entries, entry{kind: KindOption, key: key, value: value})
+	}
+	for section, fields := range doc.Settings {
+		for field, value := range fields {
+			entries = append(entries, entry{kind: KindSetting, key: section + "." + field, value: value})
+		}
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].key < entries[j].key
+	})
+
+	for _, e := range entries {
+		if isPaymentComplianceOptionKey(e.key) {
+			report.Warnings = append(report.Warnings, fmt.Sprintf("option %s is skipped: payment compliance must be confirmed in the console", e.key))
+			continue
+		}
+		value, err := importValue(e.value)
+		if err != nil {
+			report.errorf("option %s: %v", e.key, err)
+			continue
+		}
+		if isSensitiveOptionKey(e.key) {
+			if value, err = codec.reveal(value); err != nil {
+				report.errorf("option %s: %v", e.key, err)
+				continue
+			}
+		}
+		if err := validateOption(e.key, value); err != nil {
+			report.errorf("option %s: %v", e.key, err)
+			continue
+		}
+		existing, ok := current[e.key]
+		if ok && sameValue(existing, value) {
+			continue
+		}
+		action := ActionUpdate
+		if !ok {
+			action = ActionCreate
+		}
+		set.options[e.key] = value
+		report.add(Change{Kind: e.kind, Name: e.key, Action: action})
+	}
+}
+
+func diffChannels(doc *Document, opts ApplyOptions, codec *secretCodec, set *changeSet, report *Report) error {
+	var existing []*model.Channel
+	if err := model.DB.Order("id asc").Find(&existing).Error; err != nil {
+		return err
+	}
+	byName := make(map[string][]*model.Channel, len(existing))
+	for _, channel := range existing {
+		byName[channel.Name] = append(byName[channel.Name], channel)
+	}
+
+	seen := make(map[string]bool, len(doc.Channels))
+	for _, desired := range doc.Channels {
+		desired.Name = strings.TrimSpace(desired.Name)
+		if desired.Name == "" {
+			report.errorf("channel without name")
+			continue
+		}
+		if seen[desired.Name] {
+			report.errorf("channel %s: duplicated in document", desired.Name)
+			continue
+		}
+		seen[desired.Name] = true
+		normalizeChannel(&desired)
+		key, err := codec.reveal(desired.Key)
+		if err != nil {
+			report.errorf("channel %s: %v", desired.Name, err)
+			continue
+		}
+		desired.Key = key
+
+		matches := byName[desired.Name]
+		switch len(matches) {
+		case 0:
+			if desired.Key == "" {
+				report.errorf("channel %s: key is required to create a channel", desired.Name)
+				continue
+			}
+			channel := &model.Channel{CreatedTime: common.GetTimestamp()}
+			applyChannel(channel, desired, channelFields(desired))
+			set.createChannels = append(set.createChannels, channel)
+			report.add(Change{Kind: KindChannel, Name: desired.Name, Action: ActionCreate})
+		case 1:
+			current := matches[0]
+			fields, names := diffStruct(channelFromModel(current), desired, "Key")
+			if desired.Key != "" && desired.Key != current.Key {
+				if current.ChannelInfo.IsMultiKey {
+					report.errorf("channel %s: keys of multi-key channels must be edited in the channel page", desired.Name)
+					continue
+				}
+				fields = append(fields, "Key")
+				names = append(names, "key")
+			}
+			if len(fields) == 0 {
+				continue
+			}
+			channel := *current
+			applyChannel(&channel, desired, fields)
+			set.updateChannels = append(set.updateChannels, channelUpdate{channel: &channel, fields: fields})
+			report.add(Change{Kind: KindChannel, Name: desired.Name, Action: ActionUpdate, Fields: names})
+		default:
+			report.errorf("channel %s: %d channels share this name, rename them before importing", desired.Name, len(matches))
+		}
+	}
+
+	if opts.Prune {
+		for _, channel := range existing {
+			if seen[channel.Name] {
+				continue
+			}
+			set.deleteChannels = append(set.deleteChannels, channel)
+			report.add(Change{Kind: KindChannel, Name: channel.Name, Action: ActionDelete})
+		}
+	}
+	return nil
+}
+
+// normalizeChannel 补全手写文档中省略的字段，与新建渠道时的默认值一致
+func normalizeChannel(channel *Channel) {
+	if channel.Status == 0 {
+		channel.Status = common.ChannelStatusEnabled
+	}
+	if channel.Group == "" {
+		channel.Group = "default"
+	}
+	if channel.AutoBan == nil {
+		channel.AutoBan = lo.ToPtr(1)
+	}
+}
+
+// channelFields 新建渠道时写入的全部字段
+func channelFields(channel Channel) []string {
+	t := reflect.TypeOf(channel)
+	fields := make([]string, 0, t.NumField())
+	for i := 0; i < t.NumField(); i++ {
+		fields = append(fields, t.Field(i).Name)
+	}
+	return fields
+}
+
+// applyChannel 将文档中的字段写入渠道，字段名与 model.Channel 一致
+func applyChannel(channel *model.Channel, desired Channel, fields []string) {
+	for _, field := range fields {
+		switch field {
+		case "Name":
+			channel.Name = desired.Name
+		case "Type":
+			channel.Type = desired.Type
+		case "Key":
+			channel.Key = desired.Key
+		case "Status":
+			channel.Status = desired.Status
+		case "Group":
+			channel.Group = desired.Group
+		case "Models":
+			channel.Models = desired.Models
+		case "Tag":
+			channel.Tag = nil
+			if desired.Tag != "" {
+				channel.Tag = lo.ToPtr(desired.Tag)
+			}
+		case "Priority":
+			channel.Priority = lo.ToPtr(desired.Priority)
+		case "Weight":
+			channel.Weight = lo.ToPtr(desired.Weight)
+		case "AutoBan":
+			channel.AutoBan = lo.ToPtr(lo.FromPtr(desired.AutoBan))
+		case "BaseURL":
+			channel.BaseURL = lo.ToPtr(desired.BaseURL)
+		case "TestModel":
+			channel.TestModel = lo.ToPtr(desired.TestModel)
+		case "OpenAIOrganization":
+			channel.OpenAIOrganization = lo.ToPtr(desired.OpenAIOrganization)
+		case "ModelMapping":
+			channel.ModelMapping = lo.ToPtr(desired.ModelMapping)
+		case "StatusCodeMapping":
+			channel.StatusCodeMapping = lo.ToPtr(desired.StatusCodeMapping)
+		case "ParamOverride":
+			channel.ParamOverride = lo.ToPtr(desired.ParamOverride)
+		case "HeaderOverride":
+			channel.HeaderOverride = lo.ToPtr(desired.HeaderOverride)
+		case "Setting":
+			channel.Setting = lo.ToPtr(desired.Setting)
+		case "OtherSettings":
+			channel.OtherSettings = desired.OtherSettings
+		case "Other":
+			channel.Other = desired.Other
+		case "Remark":
+			channel.Remark = lo.ToPtr(desired.Remark)
+		}
+	}
+}
+
+func diffPlans(doc *Document, opts ApplyOptions, set *changeSet, report *Report) error {
+	if len(doc.SubscriptionPlans) == 0 && !opts.Prune {
+		return nil
+	}
+	var existing []*model.SubscriptionPlan
+	if err := model.DB.Order("id asc").Find(&existing).Error; err != nil {
+		return err
+	}
+	byTitle := make(map[string][]*model.SubscriptionPlan, len(existing))
+	for _, plan := range existing {
+		byTitle[plan.Title] = append(byTitle[plan.Title], plan)
+	}
+	groups := effectiveGroups(set.options)
+
+	changed := false
+	seen := make(map[string]bool, len(doc.SubscriptionPlans))
+	for _, desired := range doc.SubscriptionPlans {
+		desired.Title = strings.TrimSpace(desired.Title)
+		if desired.Title == "" {
+			report.errorf("subscription plan without title")
+			continue
+		}
+		if seen[desired.Title] {
+			report.errorf("subscription plan %s: duplicated in document", desired.Title)
+			continue
+		}
+		seen[desired.Title] = true
+		if err := normalizePlan(&desired, groups); err != nil {
+			report.errorf("subscription plan %s: %v", desired.Title, err)
+			continue
+		}
+
+		matches := byTitle[desired.Title]
+		switch len(matches) {
+		case 0:
+			set.createPlans = append(set.createPlans, planToModel(desired))
+			report.add(Change{Kind: KindSubscriptionPlan, Name: desired.Title, Action: ActionCreate})
+			changed = true
+		case 1:
+			current := planFromModel(matches[0])
+			// 未设置的可选开关沿用现有值，与套餐编辑接口一致
+			if desired.AllowBalancePay == nil {
+				desired.AllowBalancePay = current.AllowBalancePay
+			}
+			if desired.AllowWalletOverflow == nil {
+				desired.AllowWalletOverflow = current.AllowWalletOverflow
+			}
+			_, names := diffStruct(current, desired)
+			if len(names) == 0 {
+				continue
+			}
+			values := make(map[string]interface{}, len(names)+1)
+			desiredValue := reflect.ValueOf(desired)
+			for _, name := range names {
+				field := desiredValue.FieldByIndex(planFieldIndex[name])
+				if field.Kind() == reflect.Ptr {
+					if field.IsNil() {
+						values[name] = nil
+						continue
+					}
+					field = field.Elem()
+				}
+				values[name] = field.Interface()
+			}
+			values["updated_at"] = common.GetTimestamp()
+			set.updatePlans = append(set.updatePlans, planUpdate{id: matches[0].Id, values: values})
+			report.add(Change{Kind: KindSubscriptionPlan, Name: desired.Title, Action: ActionUpdate, Fields: names})
+			changed = true
+		default:
+			report.errorf("subscription plan %s: %d plans share this title, rename them before importing", desired.Title, len(matches))
+		}
+	}
+
+	// 套餐可能已被用户购买，清理时只停用不删除
+	if opts.Prune {
+		for _, plan := range existing {
+			if seen[plan.Title] || !plan.Enabled {
+				continue
+			}
+			set.updatePlans = append(set.updatePlans, planUpdate{id: plan.Id, values: map[string]interface{}{
+				"enabled":    false,
+				"updated_at": common.GetTimestamp(),
+			}})
+			report.add(Change{Kind: KindSubscriptionPlan, Name: plan.Title, Action: ActionUpdate, Fields: []string{"enabled"}})
+			changed = true
+		}
+	}
+	if changed && !operation_setting.IsPaymentComplianceConfirmed() {
+		report.errorf("subscription plans cannot be changed before payment compliance is confirmed")
+	}
+	return nil
+}
+
+// planFieldIndex 套餐文档字段的 JSON 名称（即数据库列名）到结构体字段的映射
+var planFieldIndex = func() map[string][]int {
+	t := reflect.TypeOf(SubscriptionPlan{})
+	index := make(map[string][]int, t.NumField())
+	for i := 0; i < t.NumField(); i++ {
+		index[jsonFieldName(t.Field(i))] = t.Field(i).Index
+	}
+	return index
+}()
+
+// normalizePlan 校验并补全套餐，规则与套餐编辑接口一致
+func normalizePlan(plan *SubscriptionPlan, groups map[string]float64) error {
+	if plan.PriceAmount < 0 || plan.PriceAmount > 9999 {
+		return fmt.Errorf("price must be between 0 and 9999")
+	}
+	if plan.DurationUnit == "" {
+		plan.DurationUnit = model.SubscriptionDurationMonth
+	}
+	if plan.DurationValue <= 0 && plan.DurationUnit != model.SubscriptionDurationCustom {
+		plan.DurationValue = 1
+	}
+	if plan.MaxPurchasePerUser < 0 {
+		return fmt.Errorf("max_purchase_per_user must not be negative")
+	}
+	if plan.TotalAmount < 0 {
+		return fmt.Errorf("total_amount must not be negative")
+	}
+	plan.UpgradeGroup = strings.TrimSpace(plan.UpgradeGroup)
+	if _, ok := groups[plan.UpgradeGroup]; plan.UpgradeGroup != "" && !ok {
+		return fmt.Errorf("upgrade group %s does not exist", plan.UpgradeGroup)
+	}
+	plan.DowngradeGroup = strings.TrimSpace(plan.DowngradeGroup)
+	if _, ok := groups[plan.DowngradeGroup]; plan.DowngradeGroup != "" && !ok {
+		return fmt.Errorf("downgrade group %s does not exist", plan.DowngradeGroup)
+	}
+	plan.QuotaResetPeriod = model.NormalizeResetPeriod(plan.QuotaResetPeriod)
+	if plan.QuotaResetPeriod == model.SubscriptionResetCustom && plan.QuotaResetCustomSeconds <= 0 {
+		return fmt.Errorf("custom quota reset period must be greater than 0 seconds")
+	}
+	if plan.Enabled == nil {
+		plan.Enabled = lo.ToPtr(true)
+	}
+	return nil
+}
+
+func planToModel(plan SubscriptionPlan) *model.SubscriptionPlan {
+	return &model.SubscriptionPlan{
+		Title:                   plan.Title,
+		Subtitle:                plan.Subtitle,
+		PriceAmount:             plan.PriceAmount,
+		Currency:                "USD",
+		DurationUnit:            plan.DurationUnit,
+		DurationValue:           plan.DurationValue,
+		CustomSeconds:           plan.CustomSeconds,
+		Enabled:                 lo.FromPtr(plan.Enabled),
+		SortOrder:               plan.SortOrder,
+		AllowBalancePay:         plan.AllowBalancePay,
+		AllowWalletOverflow:     plan.AllowWalletOverflow,
+		StripePriceId:           plan.StripePriceId,
+		CreemProductId:          plan.CreemProductId,
+		WaffoPancakeProductId:   plan.WaffoPancakeProductId,
+		MaxPurchasePerUser:      plan.MaxPurchasePerUser,
+		UpgradeGroup:            plan.UpgradeGroup,
+		DowngradeGroup:          plan.DowngradeGroup,
+		TotalAmount:             plan.TotalAmount,
+		QuotaResetPeriod:        plan.QuotaResetPeriod,
+		QuotaResetCustomSeconds: plan.QuotaResetCustomSeconds,
+	}
+}
+
+// diffStruct 比较两个同类型结构体，返回不同的字段名及其 JSON 名称
+func diffStruct(current, desired any, skip ...string) ([]string, []string) {
+	currentValue := reflect.ValueOf(current)
+	desiredValue := reflect.ValueOf(desired)
+	t := currentValue.Type()
+	var fields, names []string
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if lo.Contains(skip, field.Name) {
+			continue
+		}
+		if reflect.DeepEqual(currentValue.Field(i).Interface(), desiredValue.Field(i).Interface()) {
+			continue
+		}
+		fields = append(fields, field.Name)
+		names = append(names, jsonFieldName(field))
+	}
+	return fields, names
+}
+
+func jsonFieldName(field reflect.StructField) string {
+	name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+	if name == "" {
+		return field.Name
+	}
+	return name
+}
+
+// commit 在一个事务中写入渠道与套餐变更，随后写入配置项并刷新缓存
+func (s *changeSet) commit() error {
+	err := model.DB.Transaction(func(tx *gorm.DB) error {
+		for _, channel := range s.createChannels {
+			if err := tx.Create(channel).Error; err != nil {
+				return err
+			}
+			if err := channel.AddAbilities(tx); err != nil {
+				return err
+			}
+		}
+		for _, update := range s.updateChannels {
+			fields := update.fields
+			if lo.Contains(fields, "Key") {
+				// KeyHash 由 BeforeSave 根据新密钥计算，需要一并写入，否则按密钥搜索仍匹配旧密钥
+				fields = append(append([]string{}, fields...), "KeyHash")
+			}
+			if err := tx.Model(update.channel).Select(fields).Updates(update.channel).Error; err != nil {
+				return err
+			}
+			if err := update.channel.UpdateAbilities(tx); err != nil {
+				return err
+			}
+		}
+		for _, channel := range s.deleteChannels {
+			if err := tx.Delete(channel).Error; err != nil {
+				return err
+			}
+			if err := tx.Where("channel_id = ?", channel.Id).Delete(&model.Ability{}).Error; err != nil {
+				return err
+			}
+		}
+		for _, plan := range s.createPlans {
+			if err := tx.Create(plan).Error; err != nil {
+				return err
+			}
+		}
+		for _, update := range s.updatePlans {
+			if err := tx.Model(&model.SubscriptionPlan{}).Where("id = ?", update.id).Updates(update.values).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if err := model.UpdateOptionsBulk(s.options); err != nil {
+		return err
+	}
+	if len(s.createChannels) > 0 || len(s.updateChannels) > 0 || len(s.deleteChannels) > 0 {
+		model.InitChannelCache()
+	}
+	for _, plan := range s.createPlans {
+		model.InvalidateSubscriptionPlanCache(plan.Id)
+	}
+	for _, update := range s.updatePlans {
+		model.InvalidateSubscriptionPlanCache(update.id)
+	}
+	return nil
+}
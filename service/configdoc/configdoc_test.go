@@ -0,0 +1,199 @@
+package configdoc
+
+import (
+	"bytes"
+	"os"
+	"testing"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/model"
+	"github.com/QuantumNous/new-api/pkg/envelope"
+	"github.com/glebarez/sqlite"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+)
+
+func TestMain(m *testing.M) {
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	if err != nil {
+		panic("failed to open test db: " + err.Error())
+	}
+	sqlDB, err := db.DB()
+	if err != nil {
+		panic("failed to get sql.DB: " + err.Error())
+	}
+	sqlDB.SetMaxOpenConns(1)
+
+	model.DB = db
+	model.LOG_DB = db
+	common.SetDatabaseTypes(common.DatabaseTypeSQLite, common.DatabaseTypeSQLite)
+	common.RedisEnabled = false
+
+	if err := db.AutoMigrate(&model.Channel{}, &model.Ability{}, &model.Option{}, &model.SubscriptionPlan{}); err != nil {
+		panic("failed to migrate: " + err.Error())
+	}
+	os.Exit(m.Run())
+}
+
+func resetState(t *testing.T) {
+	t.Helper()
+	for _, table := range []any{&model.Channel{}, &model.Ability{}, &model.Option{}, &model.SubscriptionPlan{}} {
+		require.NoError(t, model.DB.Session(&gorm.Session{AllowGlobalUpdate: true}).Delete(table).Error)
+	}
+	common.OptionMapRWMutex.Lock()
+	common.OptionMap = map[string]string{
+		"GroupRatio": `{"default":1,"vip":1}`,
+		"SMTPToken":  "smtp-secret",
+	}
+	common.OptionMapRWMutex.Unlock()
+}
+
+func seedChannel(t *testing.T, name, key, models string) {
+	t.Helper()
+	channel := &model.Channel{Name: name, Key: key, Type: 1, Status: common.ChannelStatusEnabled, Group: "default", Models: models}
+	require.NoError(t, channel.Insert())
+}
+
+func TestExportApplyIsIdempotent(t *testing.T) {
+	resetState(t)
+	seedChannel(t, "openai", "sk-1", "gpt-4o")
+
+	doc, err := Export(ExportOptions{Secrets: SecretOmit})
+	require.NoError(t, err)
+	require.Len(t, doc.Channels, 1)
+	require.Empty(t, doc.Channels[0].Key)
+	require.NotContains(t, doc.Options, "SMTPToken")
+	require.Equal(t, map[string]any{"default": float64(1), "vip": float64(1)}, doc.Options["GroupRatio"])
+
+	data, err := Marshal(doc, FormatYAML)
+	require.NoError(t, err)
+	parsed, err := Parse(data)
+	require.NoError(t, err)
+
+	report, err := Apply(parsed, ApplyOptions{})
+	require.NoError(t, err)
+	require.Empty(t, report.Errors)
+	require.Empty(t, report.Changes)
+}
+
+func TestDiffThenApply(t *testing.T) {
+	resetState(t)
+	seedChannel(t, "openai", "sk-1", "gpt-4o")
+	seedChannel(t, "legacy", "sk-2", "gpt-3.5-turbo")
+
+	doc, err := Parse([]byte(`
+version: 1
+options:
+  GroupRatio: {default: 1, vip: 1.5}
+channels:
+  - name: openai
+    type: 1
+    models: gpt-4o,gpt-4o-mini
+    tag: prod
+  - name: claude
+    type: 14
+    key: sk-ant
+    models: claude-sonnet-4-5
+`))
+	require.NoError(t, err)
+
+	report, err := Apply(doc, ApplyOptions{DryRun: true, Prune: true})
+	require.NoError(t, err)
+	require.Empty(t, report.Errors)
+	require.Equal(t, 1, report.Created)
+	require.Equal(t, 2, report.Updated)
+	require.Equal(t, 1, report.Deleted)
+	var channelCount int64
+	require.NoError(t, model.DB.Model(&model.Channel{}).Count(&channelCount).Error)
+	require.EqualValues(t, 2, channelCount)
+
+	report, err = Apply(doc, ApplyOptions{Prune: true})
+	require.NoError(t, err)
+	require.Empty(t, report.Errors)
+	require.Len(t, report.Changes, 4)
+
+	var channels []model.Channel
+	require.NoError(t, model.DB.Order("name asc").Find(&channels).Error)
+	require.Len(t, channels, 2)
+	require.Equal(t, "claude", channels[0].Name)
+	require.Equal(t, "openai", channels[1].Name)
+	require.Equal(t, "sk-1", channels[1].Key)
+	require.Equal(t, "prod", channels[1].GetTag())
+	var abilityCount int64
+	require.NoError(t, model.DB.Model(&model.Ability{}).Where("channel_id = ?", channels[1].Id).Count(&abilityCount).Error)
+	require.EqualValues(t, 2, abilityCount)
+
+	report, err = Apply(doc, ApplyOptions{Prune: true})
+	require.NoError(t, err)
+	require.Empty(t, report.Changes)
+}
+
+func TestApplyRejectsInvalidDocument(t *testing.T) {
+	resetState(t)
+
+	doc, err := Parse([]byte(`{"version": 1, "options": {"GroupRatio": "not json"}, "channels": [{"name": "new", "type": 1}]}`))
+	require.NoError(t, err)
+	report, err := Apply(doc, ApplyOptions{})
+	require.NoError(t, err)
+	require.Len(t, report.Errors, 2)
+
+	var channelCount int64
+	require.NoError(t, model.DB.Model(&model.Channel{}).Count(&channelCount).Error)
+	require.Zero(t, channelCount)
+
+	_, err = Parse([]byte(`{"version": 2}`))
+	require.Error(t, err)
+}
+
+func TestEncryptedSecretsRoundTrip(t *testing.T) {
+	resetState(t)
+	seedChannel(t, "openai", "sk-1", "gpt-4o")
+
+	_, err := Export(ExportOptions{Secrets: SecretEncrypt})
+	require.ErrorIs(t, err, ErrPassphraseRequired)
+
+	doc, err := Export(ExportOptions{Secrets: SecretEncrypt, Passphrase: "correct horse"})
+	require.NoError(t, err)
+	require.True(t, isEncryptedSecret(doc.Channels[0].Key))
+	require.True(t, isEncryptedSecret(doc.Options["SMTPToken"].(string)))
+
+	report, err := Apply(doc, ApplyOptions{DryRun: true, Passphrase: "wrong"})
+	require.NoError(t, err)
+	require.NotEmpty(t, report.Errors)
+
+	report, err = Apply(doc, ApplyOptions{DryRun: true, Passphrase: "correct horse"})
+	require.NoError(t, err)
+	require.Empty(t, report.Errors)
+	require.Empty(t, report.Changes)
+}
+
+func TestApplyKeyChangeKeepsKeySearchable(t *testing.T) {
+	resetState(t)
+	keyring, err := envelope.NewKeyring(bytes.Repeat([]byte{7}, 32))
+	require.NoError(t, err)
+	common.SetSecretKeyring(keyring)
+	t.Cleanup(func() { common.SetSecretKeyring(nil) })
+	seedChannel(t, "openai", "sk-old", "gpt-4o")
+
+	doc, err := Parse([]byte(`
+version: 1
+channels:
+  - name: openai
+    type: 1
+    key: sk-new
+    models: gpt-4o
+`))
+	require.NoError(t, err)
+	report, err := Apply(doc, ApplyOptions{})
+	require.NoError(t, err)
+	require.Empty(t, report.Errors)
+
+	// 加密保存的密钥只能通过摘要检索（见 model.SearchChannels），导入后应能按新密钥搜到渠道，旧密钥不再匹配
+	countByKey := func(key string) int64 {
+		var count int64
+		require.NoError(t, model.DB.Model(&model.Channel{}).Where("key_hash IN ?", common.SecretLookupHashes(key)).Count(&count).Error)
+		return count
+	}
+	require.EqualValues(t, 1, countByKey("sk-new"))
+	require.Zero(t, countByKey("sk-old"))
+}
@@ -0,0 +1,167 @@
+package configdoc
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strconv"
+
+	"github.com/QuantumNous/new-api/common"
+	"gopkg.in/yaml.v3"
+)
+
+// Version 当前配置文档格式版本，格式不兼容变更时递增
+const Version = 1
+
+const (
+	FormatJSON = "json"
+	FormatYAML = "yaml"
+)
+
+// Document 一个实例的声明式配置。
+// Options 为传统配置项（不含 "."），Settings 为 config.GlobalConfig 注册的配置模块，按模块名分组；
+// 取值为 JSON 对象 / 数组的配置项导出为结构化数据，便于在 YAML 中阅读和审查
+type Document struct {
+	Version           int                       `json:"version" yaml:"version"`
+	ExportedAt        int64                     `json:"exported_at,omitempty" yaml:"exported_at,omitempty"`
+	Options           map[string]any            `json:"options,omitempty" yaml:"options,omitempty"`
+	Settings          map[string]map[string]any `json:"settings,omitempty" yaml:"settings,omitempty"`
+	Channels          []Channel                 `json:"channels,omitempty" yaml:"channels,omitempty"`
+	SubscriptionPlans []SubscriptionPlan        `json:"subscription_plans,omitempty" yaml:"subscription_plans,omitempty"`
+}
+
+// Channel 渠道配置，以名称作为标识。Key 为空表示导出时省略了密钥，导入时保留现有密钥
+type Channel struct {
+	Name               string `json:"name" yaml:"name"`
+	Type               int    `json:"type" yaml:"type"`
+	Key                string `json:"key,omitempty" yaml:"key,omitempty"`
+	Status             int    `json:"status" yaml:"status"`
+	Group              string `json:"group" yaml:"group"`
+	Models             string `json:"models" yaml:"models"`
+	Tag                string `json:"tag,omitempty" yaml:"tag,omitempty"`
+	Priority           int64  `json:"priority" yaml:"priority"`
+	Weight             uint   `json:"weight" yaml:"weight"`
+	AutoBan            *int   `json:"auto_ban,omitempty" yaml:"auto_ban,omitempty"`
+	BaseURL            string `json:"base_url,omitempty" yaml:"base_url,omitempty"`
+	TestModel          string `json:"test_model,omitempty" yaml:"test_model,omitempty"`
+	OpenAIOrganization string `json:"openai_organization,omitempty" yaml:"openai_organization,omitempty"`
+	ModelMapping       string `json:"model_mapping,omitempty" yaml:"model_mapping,omitempty"`
+	StatusCodeMapping  string `json:"status_code_mapping,omitempty" yaml:"status_code_mapping,omitempty"`
+	ParamOverride      string `json:"param_override,omitempty" yaml:"param_override,omitempty"`
+	HeaderOverride     string `json:"header_override,omitempty" yaml:"header_override,omitempty"`
+	Setting            string `json:"setting,omitempty" yaml:"setting,omitempty"`
+	OtherSettings      string `json:"settings,omitempty" yaml:"settings,omitempty"`
+	Other              string `json:"other,omitempty" yaml:"other,omitempty"`
+	Remark             string `json:"remark,omitempty" yaml:"remark,omitempty"`
+}
+
+// SubscriptionPlan 订阅套餐配置，以标题作为标识
+type SubscriptionPlan struct {
+	Title                   string  `json:"title" yaml:"title"`
+	Subtitle                string  `json:"subtitle,omitempty" yaml:"subtitle,omitempty"`
+	PriceAmount             float64 `json:"price_amount" yaml:"price_amount"`
+	DurationUnit            string  `json:"duration_unit" yaml:"duration_unit"`
+	DurationValue           int     `json:"duration_value" yaml:"duration_value"`
+	CustomSeconds           int64   `json:"custom_seconds,omitempty" yaml:"custom_seconds,omitempty"`
+	Enabled                 *bool   `json:"enabled,omitempty" yaml:"enabled,omitempty"`
+	SortOrder               int     `json:"sort_order" yaml:"sort_order"`
+	AllowBalancePay         *bool   `json:"allow_balance_pay,omitempty" yaml:"allow_balance_pay,omitempty"`
+	AllowWalletOverflow     *bool   `json:"allow_wallet_overflow,omitempty" yaml:"allow_wallet_overflow,omitempty"`
+	StripePriceId           string  `json:"stripe_price_id,omitempty" yaml:"stripe_price_id,omitempty"`
+	CreemProductId          string  `json:"creem_product_id,omitempty" yaml:"creem_product_id,omitempty"`
+	WaffoPancakeProductId   string  `json:"waffo_pancake_product_id,omitempty" yaml:"waffo_pancake_product_id,omitempty"`
+	MaxPurchasePerUser      int     `json:"max_purchase_per_user" yaml:"max_purchase_per_user"`
+	UpgradeGroup            string  `json:"upgrade_group,omitempty" yaml:"upgrade_group,omitempty"`
+	DowngradeGroup          string  `json:"downgrade_group,omitempty" yaml:"downgrade_group,omitempty"`
+	TotalAmount             int64   `json:"total_amount" yaml:"total_amount"`
+	QuotaResetPeriod        string  `json:"quota_reset_period,omitempty" yaml:"quota_reset_period,omitempty"`
+	QuotaResetCustomSeconds int64   `json:"quota_reset_custom_seconds,omitempty" yaml:"quota_reset_custom_seconds,omitempty"`
+}
+
+// Parse 解析 JSON 或 YAML 格式的配置文档（YAML 是 JSON 的超集，统一按 YAML 解析）
+func Parse(data []byte) (*Document, error) {
+	var doc Document
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	decoder.KnownFields(true)
+	if err := decoder.Decode(&doc); err != nil {
+		return nil, fmt.Errorf("invalid config document: %w", err)
+	}
+	if doc.Version != Version {
+		return nil, fmt.Errorf("unsupported config document version %d, expected %d", doc.Version, Version)
+	}
+	return &doc, nil
+}
+
+// Marshal 按指定格式序列化配置文档
+func Marshal(doc *Document, format string) ([]byte, error) {
+	switch format {
+	case FormatYAML:
+		var buf bytes.Buffer
+		encoder := yaml.NewEncoder(&buf)
+		encoder.SetIndent(2)
+		if err := encoder.Encode(doc); err != nil {
+			return nil, err
+		}
+		if err := encoder.Close(); err != nil {
+			return nil, err
+		}
+		return buf.Bytes(), nil
+	case FormatJSON, "":
+		return json.MarshalIndent(doc, "", "  ")
+	default:
+		return nil, fmt.Errorf("unsupported format %q", format)
+	}
+}
+
+// exportValue 将配置项的字符串值转换为文档中的值：JSON 对象 / 数组解码为结构化数据，其余保持字符串
+func exportValue(value string) any {
+	trimmed := bytes.TrimSpace([]byte(value))
+	if len(trimmed) == 0 || (trimmed[0] != '{' && trimmed[0] != '[') {
+		return value
+	}
+	var decoded any
+	if err := common.Unmarshal(trimmed, &decoded); err != nil {
+		return value
+	}
+	return decoded
+}
+
+// importValue 将文档中的值还原为配置项字符串
+func importValue(value any) (string, error) {
+	switch v := value.(type) {
+	case nil:
+		return "", nil
+	case string:
+		return v, nil
+	case bool:
+		return strconv.FormatBool(v), nil
+	case int:
+		return strconv.Itoa(v), nil
+	case int64:
+		return strconv.FormatInt(v, 10), nil
+	case uint64:
+		return strconv.FormatUint(v, 10), nil
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64), nil
+	default:
+		data, err := common.Marshal(v)
+		if err != nil {
+			return "", err
+		}
+		return string(data), nil
+	}
+}
+
+// sameValue 比较两个配置项字符串，JSON 值按语义比较，忽略格式和键顺序差异
+func sameValue(a, b string) bool {
+	if a == b {
+		return true
+	}
+	var decodedA, decodedB any
+	if common.UnmarshalJsonStr(a, &decodedA) != nil || common.UnmarshalJsonStr(b, &decodedB) != nil {
+		return false
+	}
+	normalizedA, errA := common.Marshal(decodedA)
+	normalizedB, errB := common.Marshal(decodedB)
+	return errA == nil && errB == nil && bytes.Equal(normalizedA, normalizedB)
+}
@@ -0,0 +1,162 @@
+package configdoc
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/model"
+	"github.com/samber/lo"
+)
+
+// ExportOptions 导出参数，Secrets 为 encrypt 时需要提供 Passphrase
+type ExportOptions struct {
+	Secrets    SecretMode
+	Passphrase string
+}
+
+// isSensitiveOptionKey 与系统设置接口保持一致，这些配置项不会明文返回给前端
+func isSensitiveOptionKey(key string) bool {
+	return strings.HasSuffix(key, "Token") ||
+		strings.HasSuffix(key, "Secret") ||
+		strings.HasSuffix(key, "Key") ||
+		strings.HasSuffix(key, "secret") ||
+		strings.HasSuffix(key, "api_key")
+}
+
+// isPaymentComplianceOptionKey 合规确认只能由站长在界面上完成，不参与导入导出
+func isPaymentComplianceOptionKey(key string) bool {
+	return strings.HasPrefix(key, "payment_setting.compliance_")
+}
+
+// splitSettingKey 拆分 config.GlobalConfig 配置项 "模块名.字段"，传统配置项不含 "."
+func splitSettingKey(key string) (string, string, bool) {
+	section, field, ok := strings.Cut(key, ".")
+	return section, field, ok && section != "" && field != ""
+}
+
+// Export 导出当前实例的完整配置
+func Export(opts ExportOptions) (*Document, error) {
+	codec := newSecretCodec(opts.Passphrase)
+	if opts.Secrets == SecretEncrypt && opts.Passphrase == "" {
+		return nil, ErrPassphraseRequired
+	}
+	doc := &Document{
+		Version:    Version,
+		ExportedAt: common.GetTimestamp(),
+		Options:    make(map[string]any),
+		Settings:   make(map[string]map[string]any),
+	}
+
+	for key, value := range snapshotOptions() {
+		if isPaymentComplianceOptionKey(key) {
+			continue
+		}
+		if isSensitiveOptionKey(key) {
+			if value == "" {
+				continue
+			}
+			exported, ok, err := codec.export(value, opts.Secrets)
+			if err != nil {
+				return nil, err
+			}
+			if !ok {
+				continue
+			}
+			value = exported
+		}
+		if section, field, ok := splitSettingKey(key); ok {
+			if doc.Settings[section] == nil {
+				doc.Settings[section] = make(map[string]any)
+			}
+			doc.Settings[section][field] = exportValue(value)
+			continue
+		}
+		doc.Options[key] = exportValue(value)
+	}
+
+	var channels []*model.Channel
+	if err := model.DB.Order("id asc").Find(&channels).Error; err != nil {
+		return nil, err
+	}
+	for _, channel := range channels {
+		exported := channelFromModel(channel)
+		key, ok, err := codec.export(channel.Key, opts.Secrets)
+		if err != nil {
+			return nil, fmt.Errorf("channel %s: %w", channel.Name, err)
+		}
+		if ok {
+			exported.Key = key
+		}
+		doc.Channels = append(doc.Channels, exported)
+	}
+
+	var plans []*model.SubscriptionPlan
+	if err := model.DB.Order("sort_order desc, id asc").Find(&plans).Error; err != nil {
+		return nil, err
+	}
+	for _, plan := range plans {
+		doc.SubscriptionPlans = append(doc.SubscriptionPlans, planFromModel(plan))
+	}
+	return doc, nil
+}
+
+func snapshotOptions() map[string]string {
+	common.OptionMapRWMutex.RLock()
+	defer common.OptionMapRWMutex.RUnlock()
+	options := make(map[string]string, len(common.OptionMap))
+	for key, value := range common.OptionMap {
+		options[key] = value
+	}
+	return options
+}
+
+// channelFromModel 转换为文档中的渠道，不包含密钥
+func channelFromModel(channel *model.Channel) Channel {
+	return Channel{
+		Name:               channel.Name,
+		Type:               channel.Type,
+		Status:             channel.Status,
+		Group:              channel.Group,
+		Models:             channel.Models,
+		Tag:                channel.GetTag(),
+		Priority:           channel.GetPriority(),
+		Weight:             uint(channel.GetWeight()),
+		AutoBan:            lo.ToPtr(lo.FromPtr(channel.AutoBan)),
+		BaseURL:            lo.FromPtr(channel.BaseURL),
+		TestModel:          lo.FromPtr(channel.TestModel),
+		OpenAIOrganization: lo.FromPtr(channel.OpenAIOrganization),
+		ModelMapping:       channel.GetModelMapping(),
+		StatusCodeMapping:  channel.GetStatusCodeMapping(),
+		ParamOverride:      lo.FromPtr(channel.ParamOverride),
+		HeaderOverride:     lo.FromPtr(channel.HeaderOverride),
+		Setting:            lo.FromPtr(channel.Setting),
+		OtherSettings:      channel.OtherSettings,
+		Other:              channel.Other,
+		Remark:             lo.FromPtr(channel.Remark),
+	}
+}
+
+func planFromModel(plan *model.SubscriptionPlan) SubscriptionPlan {
+	return SubscriptionPlan{
+		Title:                   plan.Title,
+		Subtitle:                plan.Subtitle,
+		PriceAmount:             plan.PriceAmount,
+		DurationUnit:            plan.DurationUnit,
+		DurationValue:           plan.DurationValue,
+		CustomSeconds:           plan.CustomSeconds,
+		Enabled:                 lo.ToPtr(plan.Enabled),
+		SortOrder:               plan.SortOrder,
+		AllowBalancePay:         plan.AllowBalancePay,
+		AllowWalletOverflow:     plan.AllowWalletOverflow,
+		StripePriceId:           plan.StripePriceId,
+		CreemProductId:          plan.CreemProductId,
+		WaffoPancakeProductId:   plan.WaffoPancakeProductId,
+		MaxPurchasePerUser:      plan.MaxPurchasePerUser,
+		UpgradeGroup:            plan.UpgradeGroup,
+		DowngradeGroup:          plan.DowngradeGroup,
+		TotalAmount:             plan.TotalAmount,
+		QuotaResetPeriod:        plan.QuotaResetPeriod,
+		QuotaResetCustomSeconds: plan.QuotaResetCustomSeconds,
+	}
+}
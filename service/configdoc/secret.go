@@ -0,0 +1,150 @@
+package configdoc
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+
+	"golang.org/x/crypto/scrypt"
+)
+
+// SecretMode 导出时渠道密钥与敏感配置项的处理方式
+type SecretMode string
+
+const (
+	SecretOmit    SecretMode = "omit"
+	SecretPlain   SecretMode = "plain"
+	SecretEncrypt SecretMode = "encrypt"
+)
+
+// encryptedPrefix 加密值前缀，格式为 cfgenc:v1:base64(salt | nonce | ciphertext)。
+// 与数据库静态加密（pkg/envelope）的 enc:v1: 前缀区分，避免两种密文被混用
+const encryptedPrefix = "cfgenc:v1:"
+
+const (
+	secretSaltSize = 16
+	secretKeySize  = 32
+)
+
+var ErrPassphraseRequired = errors.New("a passphrase is required to encrypt or decrypt secrets")
+
+func ParseSecretMode(mode string) (SecretMode, error) {
+	switch SecretMode(strings.TrimSpace(mode)) {
+	case "", SecretOmit:
+		return SecretOmit, nil
+	case SecretPlain:
+		return SecretPlain, nil
+	case SecretEncrypt:
+		return SecretEncrypt, nil
+	default:
+		return "", fmt.Errorf("unsupported secret mode %q", mode)
+	}
+}
+
+func isEncryptedSecret(value string) bool {
+	return strings.HasPrefix(value, encryptedPrefix)
+}
+
+// secretCodec 加解密文档中的密钥。同一次导出共用一个盐，派生密钥按盐缓存，避免每个值都执行一次 scrypt
+type secretCodec struct {
+	passphrase string
+	salt       []byte
+	keys       map[string]cipher.AEAD
+}
+
+func newSecretCodec(passphrase string) *secretCodec {
+	return &secretCodec{passphrase: passphrase, keys: make(map[string]cipher.AEAD)}
+}
+
+func (s *secretCodec) aead(salt []byte) (cipher.AEAD, error) {
+	if s.passphrase == "" {
+		return nil, ErrPassphraseRequired
+	}
+	if gcm, ok := s.keys[string(salt)]; ok {
+		return gcm, nil
+	}
+	key, err := scrypt.Key([]byte(s.passphrase), salt, 1<<15, 8, 1, secretKeySize)
+	if err != nil {
+		return nil, err
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	s.keys[string(salt)] = gcm
+	return gcm, nil
+}
+
+// encrypt 使用口令派生的密钥以 AES-GCM 加密，每个值使用独立的 nonce
+func (s *secretCodec) encrypt(plaintext string) (string, error) {
+	if s.salt == nil {
+		salt := make([]byte, secretSaltSize)
+		if _, err := rand.Read(salt); err != nil {
+			return "", err
+		}
+		s.salt = salt
+	}
+	gcm, err := s.aead(s.salt)
+	if err != nil {
+		return "", err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	payload := append(append([]byte{}, s.salt...), nonce...)
+	payload = gcm.Seal(payload, nonce, []byte(plaintext), nil)
+	return encryptedPrefix + base64.StdEncoding.EncodeToString(payload), nil
+}
+
+func (s *secretCodec) decrypt(value string) (string, error) {
+	payload, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(value, encryptedPrefix))
+	if err != nil {
+		return "", fmt.Errorf("invalid encrypted secret: %w", err)
+	}
+	if len(payload) < secretSaltSize {
+		return "", errors.New("invalid encrypted secret: payload too short")
+	}
+	gcm, err := s.aead(payload[:secretSaltSize])
+	if err != nil {
+		return "", err
+	}
+	payload = payload[secretSaltSize:]
+	if len(payload) < gcm.NonceSize() {
+		return "", errors.New("invalid encrypted secret: payload too short")
+	}
+	plaintext, err := gcm.Open(nil, payload[:gcm.NonceSize()], payload[gcm.NonceSize():], nil)
+	if err != nil {
+		return "", errors.New("failed to decrypt secret: wrong passphrase or corrupted value")
+	}
+	return string(plaintext), nil
+}
+
+// export 按导出模式处理密钥，返回 false 表示省略
+func (s *secretCodec) export(value string, mode SecretMode) (string, bool, error) {
+	switch mode {
+	case SecretPlain:
+		return value, true, nil
+	case SecretEncrypt:
+		encrypted, err := s.encrypt(value)
+		return encrypted, err == nil, err
+	default:
+		return "", false, nil
+	}
+}
+
+// reveal 解密文档中的加密值，明文原样返回
+func (s *secretCodec) reveal(value string) (string, error) {
+	if !isEncryptedSecret(value) {
+		return value, nil
+	}
+	return s.decrypt(value)
+}
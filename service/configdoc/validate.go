@@ -0,0 +1,70 @@
+package configdoc
+
+import (
+	"fmt"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/setting"
+	"github.com/QuantumNous/new-api/setting/console_setting"
+	"github.com/QuantumNous/new-api/setting/operation_setting"
+	"github.com/QuantumNous/new-api/setting/ratio_setting"
+)
+
+// ratioOptionKeys 取值为 模型 -> 数值 映射的倍率配置项
+var ratioOptionKeys = map[string]bool{
+	"ModelRatio":           true,
+	"ModelPrice":           true,
+	"CompletionRatio":      true,
+	"CacheRatio":           true,
+	"CreateCacheRatio":     true,
+	"ImageRatio":           true,
+	"AudioRatio":           true,
+	"AudioCompletionRatio": true,
+}
+
+var consoleSettingTypes = map[string]string{
+	"console_setting.api_info":           "ApiInfo",
+	"console_setting.announcements":      "Announcements",
+	"console_setting.faq":                "FAQ",
+	"console_setting.uptime_kuma_groups": "UptimeKumaGroups",
+}
+
+// validateOption 导入前校验配置项，与系统设置接口的校验规则保持一致
+func validateOption(key, value string) error {
+	switch key {
+	case "GroupRatio":
+		return ratio_setting.CheckGroupRatio(value)
+	case "ModelRequestRateLimitGroup":
+		return setting.CheckModelRequestRateLimitGroup(value)
+	case "AutomaticDisableStatusCodes", "AutomaticRetryStatusCodes":
+		_, err := operation_setting.ParseHTTPStatusCodeRanges(value)
+		return err
+	case "theme.frontend":
+		if value != "default" && value != "classic" {
+			return fmt.Errorf("invalid theme %q, expected default or classic", value)
+		}
+		return nil
+	}
+	if ratioOptionKeys[key] {
+		ratios := make(map[string]float64)
+		if err := common.UnmarshalJsonStr(value, &ratios); err != nil {
+			return fmt.Errorf("invalid ratio map: %w", err)
+		}
+		return nil
+	}
+	if settingType, ok := consoleSettingTypes[key]; ok {
+		return console_setting.ValidateConsoleSettings(value, settingType)
+	}
+	return nil
+}
+
+// effectiveGroups 返回导入后生效的分组：文档中包含 GroupRatio 时以文档为准
+func effectiveGroups(options map[string]string) map[string]float64 {
+	if raw, ok := options["GroupRatio"]; ok {
+		groups := make(map[string]float64)
+		if err := common.UnmarshalJsonStr(raw, &groups); err == nil {
+			return groups
+		}
+	}
+	return ratio_setting.GetGroupRatioCopy()
+}
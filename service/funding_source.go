@@ -1,8 +1,10 @@
 package service
 
 import (
+	"fmt"
 	"time"
 
+	"github.com/QuantumNous/new-api/common"
 	"github.com/QuantumNous/new-api/model"
 )
 
@@ -12,7 +14,7 @@ import (
 
 // FundingSource 抽象了预扣费的资金来源。
 type FundingSource interface {
-	// Source 返回资金来源标识："wallet" 或 "subscription"
+	// Source 返回资金来源标识："wallet"、"subscription" 或 "organization_wallet"
 	Source() string
 	// PreConsume 从该资金来源预扣 amount 额度
 	PreConsume(amount int) error
@@ -70,6 +72,7 @@ func (w *WalletFunding) Refund() error {
 type SubscriptionFunding struct {
 	requestId      string
 	userId         int
+	organizationId int // 大于 0 时从组织订阅扣费，并计入成员已用额度
 	modelName      string
 	amount         int64 // 预扣的订阅额度（subConsume）
 	subscriptionId int
@@ -85,10 +88,17 @@ func (s *SubscriptionFunding) Source() string { return BillingSourceSubscription
 
 func (s *SubscriptionFunding) PreConsume(_ int) error {
 	// amount 参数被忽略，使用内部 s.amount（已在构造时根据 preConsumedQuota 计算）
-	res, err := model.PreConsumeUserSubscription(s.requestId, s.userId, s.modelName, 0, s.amount)
+	var res *model.SubscriptionPreConsumeResult
+	var err error
+	if s.organizationId > 0 {
+		res, err = model.PreConsumeOrganizationSubscription(s.requestId, s.organizationId, s.userId, s.amount)
+	} else {
+		res, err = model.PreConsumeUserSubscription(s.requestId, s.userId, s.modelName, 0, s.amount)
+	}
 	if err != nil {
 		return err
 	}
+	// 组织订阅的成员已用额度已在预扣事务中按上限原子计入
 	s.subscriptionId = res.UserSubscriptionId
 	s.preConsumed = res.PreConsumed
 	s.AmountTotal = res.AmountTotal
@@ -105,15 +115,72 @@ func (s *SubscriptionFunding) Settle(delta int) error {
 	if delta == 0 {
 		return nil
 	}
-	return model.PostConsumeUserSubscriptionDelta(s.subscriptionId, int64(delta))
+	if err := model.PostConsumeUserSubscriptionDelta(s.subscriptionId, int64(delta)); err != nil {
+		return err
+	}
+	s.adjustMemberUsed(delta)
+	return nil
 }
 
 func (s *SubscriptionFunding) Refund() error {
 	if s.preConsumed <= 0 {
 		return nil
 	}
-	return refundWithRetry(func() error {
+	if err := refundWithRetry(func() error {
 		return model.RefundSubscriptionPreConsume(s.requestId)
+	}); err != nil {
+		return err
+	}
+	s.adjustMemberUsed(-int(s.preConsumed))
+	return nil
+}
+
+// adjustMemberUsed 组织订阅结算或退款时同步成员已用额度，失败只记录日志，不影响订阅扣费
+func (s *SubscriptionFunding) adjustMemberUsed(delta int) {
+	if s.organizationId <= 0 || delta == 0 {
+		return
+	}
+	if err := model.AdjustOrganizationMemberUsedQuota(s.organizationId, s.userId, delta); err != nil {
+		common.SysLog(fmt.Sprintf("error adjusting organization member used quota (organizationId=%d, userId=%d, delta=%d): %s",
+			s.organizationId, s.userId, delta, err.Error()))
+	}
+}
+
+// ---------------------------------------------------------------------------
+// OrganizationWalletFunding — 组织钱包资金来源实现
+// ---------------------------------------------------------------------------
+
+// OrganizationWalletFunding 从用户所属组织的共享钱包扣费，同时累计成员已用额度，
+// 预扣时校验组织余额与成员额度上限
+type OrganizationWalletFunding struct {
+	organizationId int
+	userId         int
+	consumed       int
+}
+
+func (o *OrganizationWalletFunding) Source() string { return BillingSourceOrganizationWallet }
+
+func (o *OrganizationWalletFunding) PreConsume(amount int) error {
+	if amount <= 0 {
+		return nil
+	}
+	if err := model.PreConsumeOrganizationQuota(o.organizationId, o.userId, amount); err != nil {
+		return err
+	}
+	o.consumed = amount
+	return nil
+}
+
+func (o *OrganizationWalletFunding) Settle(delta int) error {
+	return model.AdjustOrganizationQuota(o.organizationId, o.userId, delta)
+}
+
+func (o *OrganizationWalletFunding) Refund() error {
+	if o.consumed <= 0 {
+		return nil
+	}
+	return refundWithRetry(func() error {
+		return model.AdjustOrganizationQuota(o.organizationId, o.userId, -o.consumed)
 	})
 }
 
@@ -0,0 +1,26 @@
+package service
+
+import (
+	"fmt"
+
+	"github.com/QuantumNous/new-api/dto"
+	"github.com/QuantumNous/new-api/logger"
+	"github.com/QuantumNous/new-api/model"
+	relaycommon "github.com/QuantumNous/new-api/relay/common"
+
+	"github.com/gin-gonic/gin"
+)
+
+// recordAbandonedHedgeAttempt 对冲请求中被放弃的一方不向用户计费，也不写消费日志；
+// 上游已经返回用量时，按正常价格计入渠道已用额度，并附在胜出请求的日志中
+func recordAbandonedHedgeAttempt(ctx *gin.Context, relayInfo *relaycommon.RelayInfo, usage *dto.Usage) {
+	if usage == nil || usage.TotalTokens == 0 {
+		logger.LogInfo(ctx, fmt.Sprintf("对冲请求：渠道 #%d 已被放弃，上游未返回计费信息", relayInfo.ChannelId))
+		return
+	}
+	summary := calculateTextQuotaSummary(ctx, relayInfo, usage)
+	model.UpdateChannelUsedQuota(relayInfo.ChannelId, summary.Quota)
+	relayInfo.Hedge.Race.AddAbandonedCost(summary.Quota, summary.TotalTokens)
+	logger.LogInfo(ctx, fmt.Sprintf("对冲请求：渠道 #%d 已被放弃，上游已产生 %d tokens（%s），不向用户计费",
+		relayInfo.ChannelId, summary.TotalTokens, logger.FormatQuota(summary.Quota)))
+}
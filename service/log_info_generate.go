@@ -2,6 +2,7 @@ package service
 
 import (
 	"encoding/base64"
+	"slices"
 	"strings"
 
 	"github.com/QuantumNous/new-api/common"
@@ -51,12 +52,26 @@ func GenerateTextOtherInfo(ctx *gin.Context, relayInfo *relaycommon.RelayInfo, m
 		other["is_model_mapped"] = true
 		other["upstream_model_name"] = relayInfo.UpstreamModelName
 	}
+	if relayInfo.FallbackFromModel != "" {
+		other["fallback_from"] = relayInfo.FallbackFromModel
+	}
 
 	isSystemPromptOverwritten := common.GetContextKeyBool(ctx, constant.ContextKeySystemPromptOverride)
 	if isSystemPromptOverwritten {
 		other["is_system_prompt_overwritten"] = true
 	}
 
+	if batchId := common.GetContextKeyString(ctx, constant.ContextKeyBatchId); batchId != "" {
+		other["batch_id"] = batchId
+		discount, _ := common.GetContextKeyType[float64](ctx, constant.ContextKeyBatchDiscountRatio)
+		other["batch_discount_ratio"] = discount
+	}
+
+	if hitRatio, ok := common.GetContextKeyType[float64](ctx, constant.ContextKeyResponseCacheHitRatio); ok {
+		other["response_cache_hit"] = true
+		other["response_cache_hit_ratio"] = hitRatio
+	}
+
 	adminInfo := make(map[string]interface{})
 	adminInfo["use_channel"] = ctx.GetStringSlice("use_channel")
 	isMultiKey := common.GetContextKeyBool(ctx, constant.ContextKeyChannelIsMultiKey)
@@ -71,8 +86,31 @@ func GenerateTextOtherInfo(ctx *gin.Context, relayInfo *relaycommon.RelayInfo, m
 	}
 
 	AppendChannelAffinityAdminInfo(ctx, adminInfo)
+	if IsPayloadCaptured(ctx) {
+		adminInfo["payload_captured"] = true
+	}
+	if relayInfo.Hedge != nil {
+		if hedgeInfo := relayInfo.Hedge.Race.LogInfo(); hedgeInfo != nil {
+			adminInfo["hedge"] = hedgeInfo
+		}
+	}
+
+	if filter := relayInfo.CompletionFilter; filter != nil && len(filter.Hits()) > 0 {
+		other["completion_sensitive"] = map[string]interface{}{
+			"action": filter.Action(),
+			"hits":   len(filter.Hits()),
+		}
+		adminInfo["completion_sensitive_words"] = slices.Compact(slices.Sorted(slices.Values(filter.Hits())))
+	}
+	if relayInfo.PIIRedaction != nil {
+		// 只记录各类信息的替换次数，不记录原值
+		other["pii_redaction"] = relayInfo.PIIRedaction.Counts()
+	}
 
 	other["admin_info"] = adminInfo
+	if tokenizerName := common.GetContextKeyString(ctx, constant.ContextKeyTokenizer); tokenizerName != "" {
+		other["tokenizer"] = tokenizerName
+	}
 	appendRequestPath(ctx, relayInfo, other)
 	appendRequestConversionChain(relayInfo, other)
 	appendFinalRequestFormat(relayInfo, other)
@@ -127,6 +165,9 @@ func appendBillingInfo(relayInfo *relaycommon.RelayInfo, other map[string]interf
 	if relayInfo.UserSetting.BillingPreference != "" {
 		other["billing_preference"] = relayInfo.UserSetting.BillingPreference
 	}
+	if relayInfo.OrganizationId != 0 {
+		other["organization_id"] = relayInfo.OrganizationId
+	}
 	if relayInfo.BillingSource == "subscription" {
 		if relayInfo.SubscriptionId != 0 {
 			other["subscription_id"] = relayInfo.SubscriptionId
@@ -0,0 +1,415 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/constant"
+	"github.com/QuantumNous/new-api/logger"
+	"github.com/QuantumNous/new-api/model"
+	"github.com/QuantumNous/new-api/pkg/cachex"
+	relaycommon "github.com/QuantumNous/new-api/relay/common"
+	"github.com/QuantumNous/new-api/setting/operation_setting"
+	"github.com/QuantumNous/new-api/setting/ratio_setting"
+	"github.com/QuantumNous/new-api/types"
+
+	"github.com/gin-gonic/gin"
+	"github.com/samber/hot"
+)
+
+const moderationCacheNamespace = "new-api:moderation:v1"
+
+// ModerationVerdict 一次审核的结论，Categories 为判定违规的类别，按名称排序
+type ModerationVerdict struct {
+	Flagged    bool     `json:"flagged"`
+	Categories []string `json:"categories"`
+}
+
+// moderationResult 审核服务返回的原始结果，字段与 OpenAI moderations 接口的单条结果相同
+type moderationResult struct {
+	Flagged        bool               `json:"flagged"`
+	Categories     map[string]bool    `json:"categories"`
+	CategoryScores map[string]float64 `json:"category_scores"`
+}
+
+// llamaGuardCategories Llama Guard 3 的危害类别编号
+var llamaGuardCategories = map[string]string{
+	"S1":  "violent_crimes",
+	"S2":  "non_violent_crimes",
+	"S3":  "sex_related_crimes",
+	"S4":  "child_sexual_exploitation",
+	"S5":  "defamation",
+	"S6":  "specialized_advice",
+	"S7":  "privacy",
+	"S8":  "intellectual_property",
+	"S9":  "indiscriminate_weapons",
+	"S10": "hate",
+	"S11": "suicide_self_harm",
+	"S12": "sexual_content",
+	"S13": "elections",
+	"S14": "code_interpreter_abuse",
+}
+
+var (
+	moderationCacheOnce sync.Once
+	moderationCache     *cachex.HybridCache[ModerationVerdict]
+)
+
+func getModerationCache() *cachex.HybridCache[ModerationVerdict] {
+	moderationCacheOnce.Do(func() {
+		moderationCache = cachex.NewHybridCache[ModerationVerdict](cachex.HybridCacheConfig[ModerationVerdict]{
+			Namespace: cachex.Namespace(moderationCacheNamespace),
+			Redis:     common.RDB,
+			RedisEnabled: func() bool {
+				return common.RedisEnabled && common.RDB != nil
+			},
+			RedisCodec: cachex.JSONCodec[ModerationVerdict]{},
+			Memory: func() *hot.HotCache[string, ModerationVerdict] {
+				return hot.NewHotCache[string, ModerationVerdict](hot.LRU, 10000).
+					WithJanitor().
+					Build()
+			},
+		})
+	})
+	return moderationCache
+}
+
+// ShouldModeratePrompt 判断请求是否需要在转发前审核提示词
+func ShouldModeratePrompt(info *relaycommon.RelayInfo) bool {
+	return info != nil && operation_setting.ShouldModerateGroup(info.UsingGroup)
+}
+
+// ModeratePrompt 把提示词送到配置的审核服务，违规时返回带有违规类别的错误；
+// 审核服务不可用时按配置放行或拒绝。实际发生的审核调用按配置向用户计费
+func ModeratePrompt(c *gin.Context, info *relaycommon.RelayInfo, text string) *types.NewAPIError {
+	if !ShouldModeratePrompt(info) || strings.TrimSpace(text) == "" {
+		return nil
+	}
+	setting := operation_setting.GetModerationSetting()
+	if setting.MaxInputChars > 0 {
+		if runes := []rune(text); len(runes) > setting.MaxInputChars {
+			text = string(runes[:setting.MaxInputChars])
+		}
+	}
+
+	cacheKey := moderationCacheKey(setting, text)
+	verdict, found := ModerationVerdict{}, false
+	if setting.CacheSeconds > 0 {
+		if cached, ok, err := getModerationCache().Get(cacheKey); err == nil && ok {
+			verdict, found = cached, true
+		}
+	}
+	if !found {
+		result, channelId, err := requestModeration(c, setting, info, text)
+		if err != nil {
+			logger.LogError(c, "prompt moderation failed: "+err.Error())
+			if setting.FailOpen {
+				return nil
+			}
+			return types.NewErrorWithStatusCode(errors.New("moderation service unavailable"), types.ErrorCodeModerationUnavailable,
+				http.StatusServiceUnavailable, types.ErrOptionWithSkipRetry())
+		}
+		verdict = evaluateModeration(result, setting.CategoryThresholds)
+		if setting.CacheSeconds > 0 {
+			_ = getModerationCache().SetWithTTL(cacheKey, verdict, time.Duration(setting.CacheSeconds)*time.Second)
+		}
+		if apiErr := chargeModeration(c, info, setting, channelId); apiErr != nil {
+			return apiErr
+		}
+	}
+
+	if !verdict.Flagged {
+		return nil
+	}
+	logger.LogWarn(c, fmt.Sprintf("prompt flagged by moderation: %s", strings.Join(verdict.Categories, ", ")))
+	metadata, _ := common.Marshal(map[string]any{"categories": verdict.Categories})
+	return types.WithOpenAIError(types.OpenAIError{
+		Message:  fmt.Sprintf("prompt flagged by moderation: %s", strings.Join(verdict.Categories, ", ")),
+		Type:     string(types.ErrorCodePromptFlagged),
+		Code:     types.ErrorCodePromptFlagged,
+		Metadata: metadata,
+	}, http.StatusBadRequest, types.ErrOptionWithSkipRetry())
+}
+
+func moderationCacheKey(setting *operation_setting.ModerationSetting, text string) string {
+	sum := sha256.Sum256([]byte(setting.Backend + "\x00" + setting.Model + "\x00" + setting.WebhookURL + "\x00" + text))
+	return hex.EncodeToString(sum[:])
+}
+
+// evaluateModeration 按类别阈值重新判定：配置了阈值的类别以分数为准，其余类别以审核服务的判定为准；
+// 审核服务没有给出任何类别时使用整体的 flagged
+func evaluateModeration(result *moderationResult, thresholds map[string]float64) ModerationVerdict {
+	flagged := make(map[string]bool)
+	for category, hit := range result.Categories {
+		if _, ok := thresholds[category]; !ok && hit {
+			flagged[category] = true
+		}
+	}
+	for category, threshold := range thresholds {
+		if score, ok := result.CategoryScores[category]; ok && score >= threshold {
+			flagged[category] = true
+		} else if !ok && result.Categories[category] {
+			flagged[category] = true
+		}
+	}
+	verdict := ModerationVerdict{Categories: make([]string, 0, len(flagged))}
+	for category := range flagged {
+		verdict.Categories = append(verdict.Categories, category)
+	}
+	sort.Strings(verdict.Categories)
+	verdict.Flagged = len(verdict.Categories) > 0
+	if len(result.Categories) == 0 && len(result.CategoryScores) == 0 && result.Flagged {
+		verdict.Flagged = true
+	}
+	return verdict
+}
+
+// requestModeration 调用配置的审核服务，返回结果与所用渠道（webhook 为 0）
+func requestModeration(c *gin.Context, setting *operation_setting.ModerationSetting, info *relaycommon.RelayInfo, text string) (*moderationResult, int, error) {
+	timeout := time.Duration(setting.TimeoutSeconds) * time.Second
+	if timeout <= 0 {
+		timeout = 5 * time.Second
+	}
+	ctx, cancel := context.WithTimeout(c.Request.Context(), timeout)
+	defer cancel()
+
+	switch setting.Backend {
+	case operation_setting.ModerationBackendWebhook:
+		if setting.WebhookURL == "" {
+			return nil, 0, errors.New("moderation webhook url is empty")
+		}
+		body, err := common.Marshal(map[string]any{
+			"input":   text,
+			"model":   info.OriginModelName,
+			"group":   info.UsingGroup,
+			"user_id": info.UserId,
+		})
+		if err != nil {
+			return nil, 0, err
+		}
+		respBody, err := postModeration(ctx, GetHttpClient(), setting.WebhookURL, setting.WebhookToken, body)
+		if err != nil {
+			return nil, 0, err
+		}
+		result, err := parseModerationResult(respBody)
+		return result, 0, err
+	case operation_setting.ModerationBackendOpenAI, operation_setting.ModerationBackendLlamaGuard:
+		channel, err := model.CacheGetChannel(setting.ChannelId)
+		if err != nil {
+			return nil, 0, fmt.Errorf("moderation channel #%d: %w", setting.ChannelId, err)
+		}
+		key, _, apiErr := channel.GetNextEnabledKey()
+		if apiErr != nil {
+			return nil, 0, apiErr
+		}
+		client, err := GetHttpClientWithProxy(channel.GetSetting().Proxy)
+		if err != nil {
+			return nil, 0, err
+		}
+		baseURL := channel.GetBaseURL()
+		if baseURL == "" && channel.Type >= 0 && channel.Type < len(constant.ChannelBaseURLs) {
+			baseURL = constant.ChannelBaseURLs[channel.Type]
+		}
+		baseURL = strings.TrimSuffix(baseURL, "/")
+
+		if setting.Backend == operation_setting.ModerationBackendOpenAI {
+			body, err := common.Marshal(map[string]any{"model": setting.Model, "input": text})
+			if err != nil {
+				return nil, channel.Id, err
+			}
+			respBody, err := postModeration(ctx, client, baseURL+"/v1/moderations", key, body)
+			if err != nil {
+				return nil, channel.Id, err
+			}
+			result, err := parseModerationResult(respBody)
+			return result, channel.Id, err
+		}
+		body, err := common.Marshal(map[string]any{
+			"model":       setting.Model,
+			"messages":    []map[string]string{{"role": "user", "content": text}},
+			"max_tokens":  32,
+			"temperature": 0,
+		})
+		if err != nil {
+			return nil, channel.Id, err
+		}
+		respBody, err := postModeration(ctx, client, baseURL+"/v1/chat/completions", key, body)
+		if err != nil {
+			return nil, channel.Id, err
+		}
+		result, err := parseLlamaGuardResult(respBody)
+		return result, channel.Id, err
+	}
+	return nil, 0, fmt.Errorf("unknown moderation backend: %s", setting.Backend)
+}
+
+func postModeration(ctx context.Context, client *http.Client, url string, token string, body []byte) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	respBody, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("moderation service returned status %d", resp.StatusCode)
+	}
+	return respBody, nil
+}
+
+// parseModerationResult 解析 OpenAI moderations 响应（取 results 的第一条），也接受直接返回单条结果的 webhook
+func parseModerationResult(body []byte) (*moderationResult, error) {
+	var wrapped struct {
+		Results []moderationResult `json:"results"`
+	}
+	if err := common.Unmarshal(body, &wrapped); err != nil {
+		return nil, fmt.Errorf("invalid moderation response: %w", err)
+	}
+	if len(wrapped.Results) > 0 {
+		return &wrapped.Results[0], nil
+	}
+	var result moderationResult
+	if err := common.Unmarshal(body, &result); err != nil {
+		return nil, fmt.Errorf("invalid moderation response: %w", err)
+	}
+	return &result, nil
+}
+
+// parseLlamaGuardResult Llama Guard 的输出第一行为 safe / unsafe，unsafe 时第二行为逗号分隔的类别编号
+func parseLlamaGuardResult(body []byte) (*moderationResult, error) {
+	var resp struct {
+		Choices []struct {
+			Message struct {
+				Content string `json:"content"`
+			} `json:"message"`
+		} `json:"choices"`
+	}
+	if err := common.Unmarshal(body, &resp); err != nil {
+		return nil, fmt.Errorf("invalid llama guard response: %w", err)
+	}
+	if len(resp.Choices) == 0 {
+		return nil, errors.New("empty llama guard response")
+	}
+	lines := strings.Split(strings.TrimSpace(resp.Choices[0].Message.Content), "\n")
+	switch strings.ToLower(strings.TrimSpace(lines[0])) {
+	case "safe":
+		return &moderationResult{}, nil
+	case "unsafe":
+	default:
+		return nil, fmt.Errorf("unexpected llama guard verdict: %s", lines[0])
+	}
+	result := &moderationResult{Flagged: true, Categories: map[string]bool{}, CategoryScores: map[string]float64{}}
+	if len(lines) > 1 {
+		for _, code := range strings.Split(lines[1], ",") {
+			code = strings.ToUpper(strings.TrimSpace(code))
+			if code == "" {
+				continue
+			}
+			name := code
+			if mapped, ok := llamaGuardCategories[code]; ok {
+				name = mapped
+			}
+			result.Categories[name] = true
+			result.CategoryScores[name] = 1
+		}
+	}
+	return result, nil
+}
+
+// moderationQuota 按审核模型的价格计算审核调用的费用：按次计费的模型直接使用价格，否则按预估的提示词 tokens 乘模型倍率
+func moderationQuota(info *relaycommon.RelayInfo, modelName string) int {
+	if modelName == "" {
+		return 0
+	}
+	groupRatio := info.PriceData.GroupRatioInfo.GroupRatio
+	if price, ok := ratio_setting.GetModelPrice(modelName, false); ok {
+		return int(price * common.QuotaPerUnit * groupRatio)
+	}
+	ratio, ok, _ := ratio_setting.GetModelRatio(modelName)
+	if !ok {
+		return 0
+	}
+	return int(float64(info.GetEstimatePromptTokens()) * ratio * groupRatio)
+}
+
+// chargeModeration 审核渠道的用量始终计入渠道，开启向用户计费时把审核费用预留在请求的计费会话中，
+// 与请求一起结算，同样受组织 / 订阅资金来源与令牌限额约束。请求失败或被拒绝时审核费用仍会结算
+func chargeModeration(c *gin.Context, info *relaycommon.RelayInfo, setting *operation_setting.ModerationSetting, channelId int) *types.NewAPIError {
+	if setting.Backend == operation_setting.ModerationBackendWebhook {
+		return nil
+	}
+	quota := moderationQuota(info, setting.Model)
+	if quota <= 0 {
+		return nil
+	}
+	if channelId > 0 {
+		model.UpdateChannelUsedQuota(channelId, quota)
+	}
+	if !setting.BillUser {
+		return nil
+	}
+	if info.Billing == nil {
+		// 免费模型没有计费会话，按审核费用创建
+		if apiErr := PreConsumeBilling(c, quota, info); apiErr != nil {
+			return apiErr
+		}
+	} else {
+		target := info.Billing.GetPreConsumedQuota() + quota
+		ReleaseTokenSpendReservation(c)
+		if apiErr := CheckTokenLimits(c, info.TokenId, info.OriginModelName, target); apiErr != nil {
+			return apiErr
+		}
+		if err := info.Billing.Reserve(target); err != nil {
+			ReleaseTokenSpendReservation(c)
+			var apiErr *types.NewAPIError
+			if errors.As(err, &apiErr) {
+				return apiErr
+			}
+			return types.NewError(err, types.ErrorCodeUpdateDataError, types.ErrOptionWithSkipRetry())
+		}
+	}
+	info.ModerationQuota += quota
+	// 请求次数在结算转发的请求时统计，这里只累加已用额度
+	model.UpdateUserUsedQuota(info.UserId, quota)
+	model.RecordConsumeLog(c, info.UserId, model.RecordConsumeLogParams{
+		ChannelId:    channelId,
+		PromptTokens: info.GetEstimatePromptTokens(),
+		ModelName:    setting.Model,
+		TokenName:    c.GetString("token_name"),
+		Quota:        quota,
+		Content:      "Prompt moderation charged",
+		TokenId:      info.TokenId,
+		Group:        info.UsingGroup,
+		Other: map[string]any{
+			"moderation":       true,
+			"moderation_model": setting.Model,
+			"request_model":    info.OriginModelName,
+			"group_ratio":      info.PriceData.GroupRatioInfo.GroupRatio,
+		},
+	})
+	return nil
+}
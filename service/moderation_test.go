@@ -0,0 +1,178 @@
+package service
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/model"
+	relaycommon "github.com/QuantumNous/new-api/relay/common"
+	"github.com/QuantumNous/new-api/setting/operation_setting"
+	"github.com/QuantumNous/new-api/setting/ratio_setting"
+	"github.com/QuantumNous/new-api/types"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEvaluateModerationThresholds(t *testing.T) {
+	result := &moderationResult{
+		Flagged:        true,
+		Categories:     map[string]bool{"violence": true, "harassment": true, "hate": false},
+		CategoryScores: map[string]float64{"violence": 0.4, "harassment": 0.9, "hate": 0.7},
+	}
+	verdict := evaluateModeration(result, map[string]float64{"violence": 0.5, "hate": 0.6})
+	require.True(t, verdict.Flagged)
+	require.Equal(t, []string{"harassment", "hate"}, verdict.Categories)
+
+	verdict = evaluateModeration(result, map[string]float64{"violence": 0.5, "harassment": 0.95})
+	require.False(t, verdict.Flagged)
+
+	verdict = evaluateModeration(&moderationResult{Flagged: true}, nil)
+	require.True(t, verdict.Flagged)
+	require.Empty(t, verdict.Categories)
+}
+
+func TestParseLlamaGuardResult(t *testing.T) {
+	result, err := parseLlamaGuardResult([]byte(`{"choices":[{"message":{"content":"safe"}}]}`))
+	require.NoError(t, err)
+	require.False(t, evaluateModeration(result, nil).Flagged)
+
+	result, err = parseLlamaGuardResult([]byte(`{"choices":[{"message":{"content":"\n\nunsafe\nS1,S10"}}]}`))
+	require.NoError(t, err)
+	require.Equal(t, []string{"hate", "violent_crimes"}, evaluateModeration(result, nil).Categories)
+
+	_, err = parseLlamaGuardResult([]byte(`{"choices":[{"message":{"content":"maybe"}}]}`))
+	require.Error(t, err)
+}
+
+func setupWebhookModeration(t *testing.T, handler http.HandlerFunc) *operation_setting.ModerationSetting {
+	t.Helper()
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+	setting := operation_setting.GetModerationSetting()
+	saved := *setting
+	t.Cleanup(func() { *setting = saved })
+	setting.Enabled = true
+	setting.Backend = operation_setting.ModerationBackendWebhook
+	setting.WebhookURL = server.URL
+	setting.WebhookToken = "secret"
+	setting.Groups = []string{"guarded"}
+	setting.CacheSeconds = 0
+	return setting
+}
+
+func newModerationContext() *gin.Context {
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	c.Request = httptest.NewRequest(http.MethodPost, "/v1/chat/completions", nil)
+	return c
+}
+
+func TestModeratePromptWebhookRejectsWithCategories(t *testing.T) {
+	setupWebhookModeration(t, func(w http.ResponseWriter, r *http.Request) {
+		require.Equal(t, "Bearer secret", r.Header.Get("Authorization"))
+		body, _ := io.ReadAll(r.Body)
+		var payload map[string]any
+		require.NoError(t, common.Unmarshal(body, &payload))
+		require.Equal(t, "bad prompt", payload["input"])
+		_, _ = w.Write([]byte(`{"flagged":true,"categories":{"violence":true}}`))
+	})
+
+	info := &relaycommon.RelayInfo{UsingGroup: "guarded"}
+	apiErr := ModeratePrompt(newModerationContext(), info, "bad prompt")
+	require.NotNil(t, apiErr)
+	require.Equal(t, types.ErrorCodePromptFlagged, apiErr.GetErrorCode())
+	require.Equal(t, http.StatusBadRequest, apiErr.StatusCode)
+	require.JSONEq(t, `{"categories":["violence"]}`, string(apiErr.ToOpenAIError().Metadata))
+
+	// 未启用审核的分组直接放行
+	require.Nil(t, ModeratePrompt(newModerationContext(), &relaycommon.RelayInfo{UsingGroup: "default"}, "bad prompt"))
+}
+
+func TestModeratePromptFailOpenAndClosed(t *testing.T) {
+	setting := setupWebhookModeration(t, func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	})
+	info := &relaycommon.RelayInfo{UsingGroup: "guarded"}
+
+	setting.FailOpen = true
+	require.Nil(t, ModeratePrompt(newModerationContext(), info, "hello"))
+
+	setting.FailOpen = false
+	apiErr := ModeratePrompt(newModerationContext(), info, "hello")
+	require.NotNil(t, apiErr)
+	require.Equal(t, types.ErrorCodeModerationUnavailable, apiErr.GetErrorCode())
+	require.Equal(t, http.StatusServiceUnavailable, apiErr.StatusCode)
+}
+
+// reservingBilling 记录预留与结算额度的计费会话
+type reservingBilling struct {
+	preConsumed int
+	settled     int
+}
+
+func (b *reservingBilling) Settle(actualQuota int) error {
+	b.settled = actualQuota
+	return nil
+}
+func (b *reservingBilling) Refund(*gin.Context)      {}
+func (b *reservingBilling) NeedsRefund() bool        { return false }
+func (b *reservingBilling) GetPreConsumedQuota() int { return b.preConsumed }
+func (b *reservingBilling) Reserve(targetQuota int) error {
+	b.preConsumed = max(b.preConsumed, targetQuota)
+	return nil
+}
+
+func TestChargeModerationReservesInBillingSession(t *testing.T) {
+	const tokenId = 900010
+	modelRatio := ratio_setting.ModelRatio2JSONString()
+	t.Cleanup(func() {
+		_ = ratio_setting.UpdateModelRatioByJSONString(modelRatio)
+	})
+	require.NoError(t, ratio_setting.UpdateModelRatioByJSONString(`{"gpt-4o":1,"moderation-test":1}`))
+
+	limits := model.TokenLimits{
+		TokenQuotaWindows: model.TokenQuotaWindows{DailyQuota: 1000},
+	}
+	c := newTokenLimitTestContext(limits)
+	c.Request = httptest.NewRequest(http.MethodPost, "/v1/chat/completions", nil)
+	require.Nil(t, CheckTokenLimits(c, tokenId, "gpt-4o", 800))
+
+	user := &model.User{Id: 900010, Username: "moderation-user", AffCode: "moderation-aff", Status: common.UserStatusEnabled}
+	require.NoError(t, model.DB.Create(user).Error)
+	t.Cleanup(func() {
+		model.DB.Delete(&model.User{}, user.Id)
+	})
+
+	billing := &reservingBilling{preConsumed: 800}
+	info := &relaycommon.RelayInfo{UserId: user.Id, TokenId: tokenId, OriginModelName: "gpt-4o", Billing: billing}
+	info.PriceData.GroupRatioInfo.GroupRatio = 1
+	info.SetEstimatePromptTokens(100)
+	setting := &operation_setting.ModerationSetting{
+		Backend:  operation_setting.ModerationBackendOpenAI,
+		Model:    "moderation-test",
+		BillUser: true,
+	}
+
+	// 审核费用预留在请求的计费会话中
+	require.Nil(t, chargeModeration(c, info, setting, 0))
+	require.Equal(t, 900, billing.preConsumed)
+	require.Equal(t, 100, info.ModerationQuota)
+	// 审核费用计入已用额度，但不单独计为一次请求
+	var stored model.User
+	require.NoError(t, model.DB.Select("used_quota", "request_count").First(&stored, user.Id).Error)
+	require.Equal(t, 100, stored.UsedQuota)
+	require.Zero(t, stored.RequestCount)
+
+	// 审核费用同样受令牌消费窗口约束
+	info.SetEstimatePromptTokens(200)
+	apiErr := chargeModeration(c, info, setting, 0)
+	require.NotNil(t, apiErr)
+	require.Equal(t, types.ErrorCodeTokenSpendLimitExceeded, apiErr.GetErrorCode())
+	require.Equal(t, 100, info.ModerationQuota)
+
+	// 结算时审核费用计入实际消耗
+	require.NoError(t, SettleBilling(c, info, 500))
+	require.Equal(t, 600, billing.settled)
+}
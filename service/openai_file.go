@@ -0,0 +1,371 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/textproto"
+	"regexp"
+	"strings"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/constant"
+	"github.com/QuantumNous/new-api/dto"
+	"github.com/QuantumNous/new-api/logger"
+	"github.com/QuantumNous/new-api/model"
+	"github.com/QuantumNous/new-api/setting/operation_setting"
+
+	"github.com/gin-gonic/gin"
+)
+
+var ErrNoFileCapableChannel = errors.New("no available channel supports the files api")
+
+// fileIdPattern 匹配请求体中引用文件的字段，例如 {"file_id": "file-xxx"}、{"input_file_id": "file-xxx"}
+var fileIdPattern = regexp.MustCompile(`"(?:file_id|input_file_id)"\s*:\s*"([^"]+)"`)
+
+func ToOpenAIFile(file *model.File) *dto.OpenAIFile {
+	return &dto.OpenAIFile{
+		Id:            file.FileId,
+		Object:        "file",
+		Bytes:         file.Bytes,
+		CreatedAt:     file.CreatedAt,
+		ExpiresAt:     file.ExpiresAt,
+		Filename:      file.Filename,
+		Purpose:       file.Purpose,
+		Status:        file.Status,
+		StatusDetails: file.StatusDetails,
+	}
+}
+
+// IsFileCapableChannel 判断渠道是否支持 OpenAI Files API
+func IsFileCapableChannel(channel *model.Channel) bool {
+	if channel == nil {
+		return false
+	}
+	return channel.Type == constant.ChannelTypeOpenAI
+}
+
+func getFileChannelBaseURL(channel *model.Channel) string {
+	baseURL := strings.TrimRight(channel.GetBaseURL(), "/")
+	if baseURL == "" {
+		baseURL = "https://api.openai.com"
+	}
+	return baseURL
+}
+
+// DoFileUpstreamRequest 向渠道发起 Files API 相关请求，path 形如 /v1/files/{id}
+func DoFileUpstreamRequest(ctx context.Context, channel *model.Channel, method string, path string, body io.Reader, contentType string) (*http.Response, error) {
+	key, _, apiErr := channel.GetNextEnabledKey()
+	if apiErr != nil {
+		return nil, apiErr
+	}
+	req, err := http.NewRequestWithContext(ctx, method, getFileChannelBaseURL(channel)+path, body)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", "Bearer "+key)
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	if channel.OpenAIOrganization != nil && *channel.OpenAIOrganization != "" {
+		req.Header.Set("OpenAI-Organization", *channel.OpenAIOrganization)
+	}
+	client, err := GetHttpClientWithProxy(channel.GetSetting().Proxy)
+	if err != nil {
+		return nil, err
+	}
+	return client.Do(req)
+}
+
+// SelectFileChannel 为文件选择一个支持 Files API 的上游渠道
+func SelectFileChannel(c *gin.Context, group string) (*model.Channel, error) {
+	routeModel := operation_setting.GetFileSetting().RouteModel
+	if routeModel == "" {
+		return nil, ErrNoFileCapableChannel
+	}
+	for retry := 0; retry <= common.RetryTimes; retry++ {
+		channel, _, err := CacheGetRandomSatisfiedChannel(&RetryParam{
+			Ctx:         c,
+			TokenGroup:  group,
+			ModelName:   routeModel,
+			RequestPath: "/v1/files",
+			Retry:       common.GetPointer(retry),
+		})
+		if err != nil {
+			return nil, err
+		}
+		if channel == nil {
+			break
+		}
+		if IsFileCapableChannel(channel) {
+			return channel, nil
+		}
+	}
+	return nil, ErrNoFileCapableChannel
+}
+
+// UploadFileToChannel 将本地保存的文件流式上传到上游渠道，返回上游文件 ID
+func UploadFileToChannel(ctx context.Context, channel *model.Channel, file *model.File) (string, error) {
+	storage, err := common.GetFileStorage(file.Storage)
+	if err != nil {
+		return "", err
+	}
+	reader, err := storage.Open(file.StorageKey)
+	if err != nil {
+		return "", err
+	}
+	defer reader.Close()
+
+	pipeReader, pipeWriter := io.Pipe()
+	writer := multipart.NewWriter(pipeWriter)
+	go func() {
+		err := writer.WriteField("purpose", file.Purpose)
+		if err == nil {
+			header := make(textproto.MIMEHeader)
+			header.Set("Content-Disposition", multipart.FileContentDisposition("file", file.Filename))
+			header.Set("Content-Type", "application/octet-stream")
+			var part io.Writer
+			part, err = writer.CreatePart(header)
+			if err == nil {
+				_, err = io.Copy(part, reader)
+			}
+		}
+		if err == nil {
+			err = writer.Close()
+		}
+		pipeWriter.CloseWithError(err)
+	}()
+
+	resp, err := DoFileUpstreamRequest(ctx, channel, http.MethodPost, "/v1/files", pipeReader, writer.FormDataContentType())
+	// 确保上传协程在请求失败时退出
+	pipeReader.Close()
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return "", err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("upstream returned status %d: %s", resp.StatusCode, string(respBody))
+	}
+	var upstreamFile dto.OpenAIFile
+	if err := common.Unmarshal(respBody, &upstreamFile); err != nil {
+		return "", err
+	}
+	if upstreamFile.Id == "" {
+		return "", errors.New("upstream returned empty file id")
+	}
+	return upstreamFile.Id, nil
+}
+
+// ForwardNewFile 上传时立即将尚未入库的文件转发到上游，对外使用上游文件 ID，
+// 这样后续请求体中引用该文件时无需改写 ID，只需路由回同一渠道
+func ForwardNewFile(c *gin.Context, file *model.File, group string) error {
+	channel, err := SelectFileChannel(c, group)
+	if err != nil {
+		return err
+	}
+	upstreamFileId, err := UploadFileToChannel(c.Request.Context(), channel, file)
+	if err != nil {
+		return err
+	}
+	file.ChannelId = channel.Id
+	file.UpstreamFileId = upstreamFileId
+	file.FileId = upstreamFileId
+	return nil
+}
+
+// PinFileToChannel 将已入库的文件转发到上游并固定渠道；已固定的文件直接返回其渠道
+func PinFileToChannel(c *gin.Context, file *model.File, group string) (*model.Channel, error) {
+	if file.IsPinned() {
+		return model.CacheGetChannel(file.ChannelId)
+	}
+	channel, err := SelectFileChannel(c, group)
+	if err != nil {
+		return nil, err
+	}
+	upstreamFileId, err := UploadFileToChannel(c.Request.Context(), channel, file)
+	if err != nil {
+		return nil, err
+	}
+	if err := file.PinToChannel(channel.Id, upstreamFileId); err != nil {
+		// 并发下已被其他请求固定，删除本次多余的上游文件并使用已固定的渠道
+		deleteUpstreamFile(c.Request.Context(), channel, upstreamFileId)
+		if !errors.Is(err, model.ErrFileAlreadyPinned) {
+			return nil, err
+		}
+		latest, err := model.GetUserFileById(file.UserId, file.FileId)
+		if err != nil {
+			return nil, err
+		}
+		*file = *latest
+		return model.CacheGetChannel(file.ChannelId)
+	}
+	return channel, nil
+}
+
+// OpenFileContent 打开文件内容：优先读取本地存储，本地不存在时从固定的上游渠道获取
+func OpenFileContent(ctx context.Context, file *model.File) (io.ReadCloser, error) {
+	if file.StorageKey != "" {
+		storage, err := common.GetFileStorage(file.Storage)
+		if err != nil {
+			return nil, err
+		}
+		return storage.Open(file.StorageKey)
+	}
+	if !file.IsPinned() {
+		return nil, errors.New("file content is not available")
+	}
+	channel, err := model.CacheGetChannel(file.ChannelId)
+	if err != nil {
+		return nil, err
+	}
+	return OpenUpstreamFileContent(ctx, channel, file.UpstreamFileId)
+}
+
+// OpenUpstreamFileContent 下载上游文件内容
+func OpenUpstreamFileContent(ctx context.Context, channel *model.Channel, upstreamFileId string) (io.ReadCloser, error) {
+	resp, err := DoFileUpstreamRequest(ctx, channel, http.MethodGet, "/v1/files/"+upstreamFileId+"/content", nil, "")
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, fmt.Errorf("upstream returned status %d", resp.StatusCode)
+	}
+	return resp.Body, nil
+}
+
+func deleteUpstreamFile(ctx context.Context, channel *model.Channel, upstreamFileId string) {
+	resp, err := DoFileUpstreamRequest(ctx, channel, http.MethodDelete, "/v1/files/"+upstreamFileId, nil, "")
+	if err != nil {
+		logger.LogWarn(ctx, fmt.Sprintf("failed to delete upstream file %s on channel #%d: %s", upstreamFileId, channel.Id, err.Error()))
+		return
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusNotFound {
+		logger.LogWarn(ctx, fmt.Sprintf("failed to delete upstream file %s on channel #%d: status %d", upstreamFileId, channel.Id, resp.StatusCode))
+	}
+}
+
+// DeleteFile 删除文件记录、本地存储以及上游副本（上游删除失败不影响本地删除）
+func DeleteFile(ctx context.Context, file *model.File) error {
+	if file.IsPinned() {
+		if channel, err := model.CacheGetChannel(file.ChannelId); err == nil {
+			deleteUpstreamFile(ctx, channel, file.UpstreamFileId)
+		}
+	}
+	if file.StorageKey != "" {
+		if storage, err := common.GetFileStorage(file.Storage); err == nil {
+			if err := storage.Delete(file.StorageKey); err != nil {
+				logger.LogWarn(ctx, fmt.Sprintf("failed to delete stored file %s: %s", file.FileId, err.Error()))
+			}
+		}
+	}
+	return file.Delete()
+}
+
+// requestFileIdMarker 请求体引用文件时一定包含的片段，用于在解析前快速排除大多数请求
+var requestFileIdMarker = []byte(`file_id"`)
+
+// ExtractRequestFileIds 从请求体中提取引用的文件 ID
+func ExtractRequestFileIds(body []byte) []string {
+	if len(body) == 0 || !bytes.Contains(body, requestFileIdMarker) {
+		return nil
+	}
+	matches := fileIdPattern.FindAllSubmatch(body, -1)
+	ids := make([]string, 0, len(matches))
+	seen := make(map[string]struct{}, len(matches))
+	for _, match := range matches {
+		id := string(match[1])
+		if _, ok := seen[id]; ok {
+			continue
+		}
+		seen[id] = struct{}{}
+		ids = append(ids, id)
+	}
+	return ids
+}
+
+// RequestFileRoute 请求引用的本站文件对渠道选择的约束
+type RequestFileRoute struct {
+	FileId string
+	// ChannelId 文件固定的上游渠道，为 0 表示文件只保存在本站，上游渠道无法识别
+	ChannelId int
+	// ConflictFileId 固定到其他渠道的另一个文件，不为空时任何渠道都无法同时识别两个文件
+	ConflictFileId string
+}
+
+// GetRequestFileRoute 若请求引用了通过 /v1/files 上传的文件，返回路由约束：
+// 只保存在本站的文件优先返回（请求无法被上游处理），否则返回已固定文件的渠道，
+// 文件固定在不同渠道时同时返回冲突的文件。
+// 未引用本站文件或文件接口未启用时返回 nil
+func GetRequestFileRoute(c *gin.Context) *RequestFileRoute {
+	if !operation_setting.GetFileSetting().Enabled {
+		return nil
+	}
+	if !strings.HasPrefix(c.Request.Header.Get("Content-Type"), "application/json") {
+		return nil
+	}
+	storage, err := common.GetBodyStorage(c)
+	if err != nil {
+		return nil
+	}
+	body, err := storage.Bytes()
+	if err != nil {
+		return nil
+	}
+	fileIds := ExtractRequestFileIds(body)
+	if len(fileIds) == 0 {
+		return nil
+	}
+	files, err := model.GetUserFilesByIds(c.GetInt("id"), fileIds)
+	if err != nil {
+		return nil
+	}
+	var route *RequestFileRoute
+	for _, file := range files {
+		// 只有上传时转发的文件对外使用上游文件 ID；批处理固定到上游的输入文件仍使用本站 ID，上游同样无法识别
+		if !file.IsPinned() || file.UpstreamFileId != file.FileId {
+			return &RequestFileRoute{FileId: file.FileId}
+		}
+		if route == nil {
+			route = &RequestFileRoute{FileId: file.FileId, ChannelId: file.ChannelId}
+		} else if route.ConflictFileId == "" && file.ChannelId != route.ChannelId {
+			route.ConflictFileId = file.FileId
+		}
+	}
+	return route
+}
+
+// CleanupExpiredFiles 删除已过期的文件，返回删除数量
+func CleanupExpiredFiles(ctx context.Context, batchSize int) (int, error) {
+	deleted := 0
+	for {
+		if ctx.Err() != nil {
+			return deleted, ctx.Err()
+		}
+		files, err := model.GetExpiredFiles(common.GetTimestamp(), batchSize)
+		if err != nil {
+			return deleted, err
+		}
+		if len(files) == 0 {
+			return deleted, nil
+		}
+		for _, file := range files {
+			if err := DeleteFile(ctx, file); err != nil {
+				return deleted, err
+			}
+			deleted++
+		}
+		if len(files) < batchSize {
+			return deleted, nil
+		}
+	}
+}
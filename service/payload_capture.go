@@ -0,0 +1,234 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/constant"
+	"github.com/QuantumNous/new-api/model"
+	"github.com/QuantumNous/new-api/pkg/redact"
+	relaycommon "github.com/QuantumNous/new-api/relay/common"
+	"github.com/QuantumNous/new-api/setting/operation_setting"
+	"github.com/QuantumNous/new-api/types"
+
+	"github.com/bytedance/gopkg/util/gopool"
+	"github.com/gin-gonic/gin"
+)
+
+// PayloadCapture 一次请求的请求/响应体留存，响应体在写给客户端的同时保留一份，
+// 流式响应按行重组为完整的文本
+type PayloadCapture struct {
+	origin           gin.ResponseWriter
+	writer           *payloadCaptureWriter
+	request          []byte
+	requestTruncated bool
+	subject          bool
+}
+
+// StartPayloadCapture 请求开启了留存时开始捕获请求/响应体，未开启时返回 nil
+func StartPayloadCapture(c *gin.Context, info *relaycommon.RelayInfo) *PayloadCapture {
+	if !operation_setting.ShouldStartPayloadCapture(info.UserId, info.TokenId) {
+		return nil
+	}
+	setting := operation_setting.GetPayloadCaptureSetting()
+	capture := &PayloadCapture{
+		origin:  c.Writer,
+		subject: operation_setting.IsPayloadCaptureSubject(info.UserId, info.TokenId),
+	}
+	if storage, err := common.GetBodyStorage(c); err == nil {
+		if body, err := storage.Bytes(); err == nil {
+			capture.request, capture.requestTruncated = truncatePayload(body, setting.MaxRequestBytes)
+		}
+	}
+	capture.writer = &payloadCaptureWriter{ResponseWriter: c.Writer, limit: setting.MaxResponseBytes}
+	c.Writer = capture.writer
+	common.SetContextKey(c, constant.ContextKeyPayloadCapture, capture)
+	return capture
+}
+
+// IsPayloadCaptured 判断当前请求的请求/响应体是否会被留存，用于在消费日志中标记
+func IsPayloadCaptured(c *gin.Context) bool {
+	capture, ok := common.GetContextKeyType[*PayloadCapture](c, constant.ContextKeyPayloadCapture)
+	if !ok || capture == nil {
+		return false
+	}
+	return capture.subject || operation_setting.IsPayloadCaptureChannel(common.GetContextKeyInt(c, constant.ContextKeyChannelId))
+}
+
+// Finish 恢复响应写入器，请求命中留存条件时脱敏后异步写入日志库
+func (p *PayloadCapture) Finish(c *gin.Context, info *relaycommon.RelayInfo, apiErr *types.NewAPIError) {
+	c.Writer = p.origin
+	if !IsPayloadCaptured(c) {
+		return
+	}
+	payloadLog := &model.PayloadLog{
+		RequestId:        c.GetString(common.RequestIdKey),
+		UserId:           info.UserId,
+		TokenId:          info.TokenId,
+		ChannelId:        common.GetContextKeyInt(c, constant.ContextKeyChannelId),
+		ModelName:        info.OriginModelName,
+		RequestPath:      c.Request.URL.Path,
+		IsStream:         info.IsStream,
+		StatusCode:       p.writer.Status(),
+		RequestTruncated: p.requestTruncated,
+	}
+	var response string
+	if p.writer.Size() <= 0 && apiErr != nil {
+		// 错误响应在留存结束后才写出，这里按 OpenAI 格式记录错误内容
+		body, _ := common.Marshal(gin.H{"error": apiErr.ToOpenAIError()})
+		response = string(body)
+		payloadLog.StatusCode = apiErr.StatusCode
+	} else {
+		response, payloadLog.ResponseTruncated = p.writer.payload()
+	}
+
+	redactor := payloadRedactor()
+	counts := make(map[string]int)
+	payloadLog.RequestBody = redactPayload(redactor, string(p.request), counts)
+	payloadLog.ResponseBody = redactPayload(redactor, response, counts)
+	if len(counts) > 0 {
+		redactions, _ := common.Marshal(counts)
+		payloadLog.Redactions = string(redactions)
+	}
+	gopool.Go(func() {
+		if err := model.InsertPayloadLog(payloadLog); err != nil {
+			common.SysError(fmt.Sprintf("failed to record payload log: %s", err.Error()))
+		}
+	})
+}
+
+// CleanupExpiredPayloadLogs 分批删除超过保留天数的留存记录
+func CleanupExpiredPayloadLogs(ctx context.Context, retentionDays int, batchSize int) (int64, error) {
+	if retentionDays <= 0 {
+		return 0, nil
+	}
+	target := common.GetTimestamp() - int64(retentionDays)*86400
+	var deleted int64
+	for {
+		rows, err := model.DeleteOldPayloadLogBatch(ctx, target, batchSize)
+		deleted += rows
+		if err != nil || rows < int64(batchSize) {
+			return deleted, err
+		}
+	}
+}
+
+func redactPayload(redactor *redact.Redactor, payload string, counts map[string]int) string {
+	redacted, hits := redactor.Redact(payload)
+	for name, count := range hits {
+		counts[name] += count
+	}
+	return redacted
+}
+
+func truncatePayload(body []byte, limit int) ([]byte, bool) {
+	if limit > 0 && len(body) > limit {
+		return bytes.Clone(body[:limit]), true
+	}
+	return bytes.Clone(body), false
+}
+
+var payloadRedactorCache struct {
+	sync.Mutex
+	key      string
+	redactor *redact.Redactor
+}
+
+// payloadRedactor 按当前配置构建脱敏器，配置不变时复用已编译的规则
+func payloadRedactor() *redact.Redactor {
+	setting := operation_setting.GetPayloadCaptureSetting()
+	var keyBuilder strings.Builder
+	fmt.Fprintf(&keyBuilder, "%t", setting.RedactBuiltin)
+	for _, rule := range setting.RedactRules {
+		fmt.Fprintf(&keyBuilder, "\x00%s\x00%s\x00%s", rule.Name, rule.Pattern, rule.Replacement)
+	}
+	key := keyBuilder.String()
+
+	payloadRedactorCache.Lock()
+	defer payloadRedactorCache.Unlock()
+	if payloadRedactorCache.redactor != nil && payloadRedactorCache.key == key {
+		return payloadRedactorCache.redactor
+	}
+	rules := make([]redact.Rule, 0, len(setting.RedactRules)+len(redact.Builtin()))
+	for _, rule := range setting.RedactRules {
+		compiled, err := redact.Compile(rule.Name, rule.Pattern, rule.Replacement)
+		if err != nil {
+			common.SysError(err.Error())
+			continue
+		}
+		rules = append(rules, compiled)
+	}
+	if setting.RedactBuiltin {
+		rules = append(rules, redact.Builtin()...)
+	}
+	payloadRedactorCache.key = key
+	payloadRedactorCache.redactor = redact.New(rules...)
+	return payloadRedactorCache.redactor
+}
+
+// payloadCaptureWriter 在写给客户端的同时保留响应体：普通响应保留不超过上限的原始内容，
+// SSE 响应逐行重组文本，避免保存大量重复的事件外壳
+type payloadCaptureWriter struct {
+	gin.ResponseWriter
+	body      bytes.Buffer
+	limit     int
+	truncated bool
+	started   bool
+	stream    *ResponseDigestBuilder
+}
+
+func (w *payloadCaptureWriter) Write(data []byte) (int, error) {
+	n, err := w.ResponseWriter.Write(data)
+	w.keep(data[:n])
+	return n, err
+}
+
+func (w *payloadCaptureWriter) WriteString(s string) (int, error) {
+	n, err := w.ResponseWriter.WriteString(s)
+	w.keep([]byte(s[:n]))
+	return n, err
+}
+
+func (w *payloadCaptureWriter) keep(data []byte) {
+	if !w.started {
+		w.started = true
+		if strings.Contains(w.Header().Get("Content-Type"), "text/event-stream") {
+			w.stream = NewResponseDigestBuilder(w.limit)
+		}
+	}
+	if w.stream != nil {
+		_, _ = w.stream.Write(data)
+		return
+	}
+	remaining := len(data)
+	if w.limit > 0 {
+		remaining = min(remaining, w.limit-w.body.Len())
+	}
+	if remaining < len(data) {
+		w.truncated = true
+	}
+	if remaining > 0 {
+		w.body.Write(data[:remaining])
+	}
+}
+
+// payload 返回保留的响应体，SSE 响应重组为 {"content","finish_reason","usage"}
+func (w *payloadCaptureWriter) payload() (string, bool) {
+	if w.stream == nil {
+		return w.body.String(), w.truncated
+	}
+	digest := w.stream.Digest()
+	body, _ := common.Marshal(map[string]any{
+		"content":       digest.Text,
+		"finish_reason": digest.FinishReason,
+		"usage": map[string]int{
+			"prompt_tokens":     digest.PromptTokens,
+			"completion_tokens": digest.CompletionTokens,
+		},
+	})
+	return string(body), w.stream.Truncated()
+}
@@ -0,0 +1,44 @@
+package service
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPayloadCaptureWriterReassemblesStream(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	recorder := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(recorder)
+	writer := &payloadCaptureWriter{ResponseWriter: c.Writer, limit: 1024}
+
+	writer.Header().Set("Content-Type", "text/event-stream")
+	_, _ = writer.WriteString("data: {\"choices\":[{\"delta\":{\"content\":\"mail me at \"}}]}\n\n")
+	_, _ = writer.Write([]byte("data: {\"choices\":[{\"delta\":{\"content\":\"bob@example.com\"},\"finish_reason\":\"stop\"}]}\n\ndata: [DONE]\n\n"))
+
+	payload, truncated := writer.payload()
+	require.False(t, truncated)
+	require.JSONEq(t, `{"content":"mail me at bob@example.com","finish_reason":"stop","usage":{"prompt_tokens":0,"completion_tokens":0}}`, payload)
+	require.Contains(t, recorder.Body.String(), "data: [DONE]")
+
+	counts := make(map[string]int)
+	require.Contains(t, redactPayload(payloadRedactor(), payload, counts), "[REDACTED:email]")
+	require.Equal(t, 1, counts["email"])
+}
+
+func TestPayloadCaptureWriterTruncates(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	recorder := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(recorder)
+	writer := &payloadCaptureWriter{ResponseWriter: c.Writer, limit: 8}
+
+	writer.Header().Set("Content-Type", "application/json")
+	_, _ = writer.WriteString(`{"id":"chatcmpl-1"}`)
+
+	payload, truncated := writer.payload()
+	require.True(t, truncated)
+	require.Equal(t, `{"id":"c`, payload)
+	require.Equal(t, `{"id":"chatcmpl-1"}`, recorder.Body.String())
+}
@@ -4,7 +4,6 @@ import (
 	"errors"
 	"fmt"
 	"math"
-	"strings"
 	"time"
 
 	"github.com/QuantumNous/new-api/common"
@@ -95,7 +94,7 @@ func PreWssConsumeQuota(ctx *gin.Context, relayInfo *relaycommon.RelayInfo, usag
 		return err
 	}
 
-	token, err := model.GetTokenByKey(strings.TrimPrefix(relayInfo.TokenKey, "sk-"), false)
+	token, err := model.GetTokenByKeyHash(relayInfo.TokenKey, false)
 	if err != nil {
 		return err
 	}
@@ -277,6 +276,14 @@ func CalcOpenRouterCacheCreateTokens(usage dto.Usage, priceData types.PriceData)
 }
 
 func PostAudioConsumeQuota(ctx *gin.Context, relayInfo *relaycommon.RelayInfo, usage *dto.Usage, extraContent string) {
+	if relayInfo.Hedge.Abandoned() {
+		recordAbandonedHedgeAttempt(ctx, relayInfo, usage)
+		return
+	}
+	if relayInfo.Shadow != nil {
+		recordShadowAttempt(ctx, relayInfo, usage)
+		return
+	}
 
 	var tieredUsedVars map[string]bool
 	if snap := relayInfo.TieredBillingSnapshot; snap != nil {
@@ -389,7 +396,7 @@ func PreConsumeTokenQuota(relayInfo *relaycommon.RelayInfo, quota int) error {
 	//if relayInfo.TokenUnlimited {
 	//	return nil
 	//}
-	token, err := model.GetTokenByKey(relayInfo.TokenKey, false)
+	token, err := model.GetTokenByKeyHash(relayInfo.TokenKey, false)
 	if err != nil {
 		return err
 	}
@@ -416,6 +423,15 @@ func PostConsumeQuota(relayInfo *relaycommon.RelayInfo, quota int, preConsumedQu
 				return err
 			}
 			relayInfo.SubscriptionPostDelta += delta
+			if relayInfo.OrganizationId > 0 {
+				if err := model.AdjustOrganizationMemberUsedQuota(relayInfo.OrganizationId, relayInfo.UserId, quota); err != nil {
+					return err
+				}
+			}
+		}
+	} else if relayInfo != nil && relayInfo.BillingSource == BillingSourceOrganizationWallet {
+		if err := model.AdjustOrganizationQuota(relayInfo.OrganizationId, relayInfo.UserId, quota); err != nil {
+			return err
 		}
 	} else {
 		// Wallet
@@ -440,7 +456,7 @@ func PostConsumeQuota(relayInfo *relaycommon.RelayInfo, quota int, preConsumedQu
 		}
 	}
 
-	if sendEmail {
+	if sendEmail && relayInfo.BillingSource != BillingSourceOrganizationWallet {
 		if (quota + preConsumedQuota) != 0 {
 			checkAndSendQuotaNotify(relayInfo, quota, preConsumedQuota)
 		}
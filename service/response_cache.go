@@ -0,0 +1,266 @@
+package service
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/constant"
+	"github.com/QuantumNous/new-api/dto"
+	"github.com/QuantumNous/new-api/logger"
+	"github.com/QuantumNous/new-api/pkg/cachex"
+	relaycommon "github.com/QuantumNous/new-api/relay/common"
+	relayconstant "github.com/QuantumNous/new-api/relay/constant"
+	"github.com/QuantumNous/new-api/relay/helper"
+	"github.com/QuantumNous/new-api/setting/operation_setting"
+	"github.com/QuantumNous/new-api/types"
+
+	"github.com/bytedance/gopkg/util/gopool"
+	"github.com/gin-gonic/gin"
+	"github.com/samber/hot"
+)
+
+const (
+	responseCacheNamespace = "new-api:response_cache:v1"
+
+	// ResponseCacheHeader 响应头，标识本次响应是否来自响应缓存（hit / miss）
+	ResponseCacheHeader = "X-New-Api-Cache"
+)
+
+// 不影响模型输出的字段，计算缓存键时忽略
+var responseCacheIgnoredFields = []string{"user", "metadata", "store"}
+
+// ResponseCacheEntry 缓存的一次完整响应，流式响应保存原始 SSE 数据
+type ResponseCacheEntry struct {
+	Stream      bool      `json:"stream"`
+	ContentType string    `json:"content_type"`
+	Body        string    `json:"body"`
+	Usage       dto.Usage `json:"usage"`
+	CreatedAt   int64     `json:"created_at"`
+}
+
+var (
+	responseCacheOnce sync.Once
+	responseCache     *cachex.HybridCache[ResponseCacheEntry]
+)
+
+func getResponseCache() *cachex.HybridCache[ResponseCacheEntry] {
+	responseCacheOnce.Do(func() {
+		setting := operation_setting.GetResponseCacheSetting()
+		capacity := setting.MaxEntries
+		if capacity <= 0 {
+			capacity = 10000
+		}
+		responseCache = cachex.NewHybridCache[ResponseCacheEntry](cachex.HybridCacheConfig[ResponseCacheEntry]{
+			Namespace: cachex.Namespace(responseCacheNamespace),
+			Redis:     common.RDB,
+			RedisEnabled: func() bool {
+				return common.RedisEnabled && common.RDB != nil
+			},
+			RedisCodec: cachex.JSONCodec[ResponseCacheEntry]{},
+			Memory: func() *hot.HotCache[string, ResponseCacheEntry] {
+				return hot.NewHotCache[string, ResponseCacheEntry](hot.LRU, capacity).
+					WithJanitor().
+					Build()
+			},
+		})
+	})
+	return responseCache
+}
+
+func responseCacheTTL() time.Duration {
+	ttl := operation_setting.GetResponseCacheSetting().TTLSeconds
+	if ttl <= 0 {
+		ttl = 3600
+	}
+	return time.Duration(ttl) * time.Second
+}
+
+// isResponseCacheEligible 仅对显式启用的令牌或分组下的 OpenAI 格式对话补全请求生效
+func isResponseCacheEligible(c *gin.Context, info *relaycommon.RelayInfo, request *dto.GeneralOpenAIRequest) bool {
+	setting := operation_setting.GetResponseCacheSetting()
+	if !setting.Enabled {
+		return false
+	}
+	if info.RelayMode != relayconstant.RelayModeChatCompletions || info.RelayFormat != types.RelayFormatOpenAI {
+		return false
+	}
+	if !common.GetContextKeyBool(c, constant.ContextKeyTokenResponseCache) && !operation_setting.IsResponseCacheGroupEnabled(info.UsingGroup) {
+		return false
+	}
+	// 客户端可以通过 Cache-Control: no-cache / no-store 跳过缓存
+	cacheControl := strings.ToLower(c.GetHeader("Cache-Control"))
+	if strings.Contains(cacheControl, "no-cache") || strings.Contains(cacheControl, "no-store") {
+		return false
+	}
+	if setting.OnlyDeterministic && (request.Temperature == nil || *request.Temperature != 0) {
+		return false
+	}
+	return true
+}
+
+// BuildResponseCacheKey 计算请求的归一化缓存键：请求体按字段排序重新序列化后取 sha256，
+// 并按用户隔离，避免不同用户之间互相读取响应
+func BuildResponseCacheKey(userId int, modelName string, request *dto.GeneralOpenAIRequest) (string, error) {
+	raw, err := common.Marshal(request)
+	if err != nil {
+		return "", err
+	}
+	var fields map[string]any
+	if err := common.Unmarshal(raw, &fields); err != nil {
+		return "", err
+	}
+	for _, field := range responseCacheIgnoredFields {
+		delete(fields, field)
+	}
+	fields["model"] = modelName
+	// encoding/json 对 map 按 key 排序输出，保证相同语义的请求得到相同的序列化结果
+	normalized, err := json.Marshal(fields)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(normalized)
+	return fmt.Sprintf("%d:%s", userId, hex.EncodeToString(sum[:])), nil
+}
+
+// LookupResponseCache 判断请求是否使用响应缓存并查询缓存。
+// 可缓存时在上下文记录缓存键；命中时记录命中计费倍率并返回缓存内容
+func LookupResponseCache(c *gin.Context, info *relaycommon.RelayInfo) *ResponseCacheEntry {
+	request, ok := info.Request.(*dto.GeneralOpenAIRequest)
+	if !ok || !isResponseCacheEligible(c, info, request) {
+		return nil
+	}
+	key, err := BuildResponseCacheKey(info.UserId, info.OriginModelName, request)
+	if err != nil {
+		logger.LogWarn(c, "failed to build response cache key: "+err.Error())
+		return nil
+	}
+	common.SetContextKey(c, constant.ContextKeyResponseCacheKey, key)
+
+	entry, found, err := getResponseCache().Get(key)
+	if err != nil {
+		logger.LogWarn(c, "failed to get response cache: "+err.Error())
+		return nil
+	}
+	if !found {
+		return nil
+	}
+	common.SetContextKey(c, constant.ContextKeyResponseCacheHitRatio, operation_setting.GetResponseCacheHitBillingRatio())
+	return &entry
+}
+
+// ReplayResponseCache 将缓存的响应原样写回客户端，并按缓存中的用量结算
+func ReplayResponseCache(c *gin.Context, info *relaycommon.RelayInfo, entry *ResponseCacheEntry) {
+	info.InitChannelMeta(c)
+	c.Header(ResponseCacheHeader, "hit")
+	if entry.Stream {
+		helper.SetEventStreamHeaders(c)
+	} else if entry.ContentType != "" {
+		c.Header("Content-Type", entry.ContentType)
+	}
+	c.Status(http.StatusOK)
+	_, _ = c.Writer.WriteString(entry.Body)
+	c.Writer.Flush()
+	info.IsStream = entry.Stream
+	info.SetFirstResponseTime()
+
+	usage := entry.Usage
+	PostTextConsumeQuota(c, info, &usage, []string{"命中响应缓存"})
+}
+
+// RememberResponseCacheUsage 记录上游返回的用量，供写入响应缓存时使用
+func RememberResponseCacheUsage(c *gin.Context, usage *dto.Usage) {
+	if usage == nil || common.GetContextKeyString(c, constant.ContextKeyResponseCacheKey) == "" {
+		return
+	}
+	common.SetContextKey(c, constant.ContextKeyResponseCacheUsage, *usage)
+}
+
+// responseCacheWriter 复制一份写往客户端的响应，超过上限后放弃缓存
+type responseCacheWriter struct {
+	gin.ResponseWriter
+	body     bytes.Buffer
+	maxSize  int
+	overflow bool
+}
+
+func (w *responseCacheWriter) Write(b []byte) (int, error) {
+	if !w.overflow {
+		if w.body.Len()+len(b) > w.maxSize {
+			w.overflow = true
+			w.body.Reset()
+		} else {
+			w.body.Write(b)
+		}
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *responseCacheWriter) WriteString(s string) (int, error) {
+	return w.Write([]byte(s))
+}
+
+// ResponseCapture 未命中缓存时捕获本次响应，请求成功后写入缓存
+type ResponseCapture struct {
+	key    string
+	writer *responseCacheWriter
+	origin gin.ResponseWriter
+}
+
+// StartResponseCapture 对可缓存的请求开始捕获响应，不可缓存时返回 nil
+func StartResponseCapture(c *gin.Context) *ResponseCapture {
+	key := common.GetContextKeyString(c, constant.ContextKeyResponseCacheKey)
+	if key == "" {
+		return nil
+	}
+	maxSize := operation_setting.GetResponseCacheSetting().MaxBodyBytes
+	if maxSize <= 0 {
+		maxSize = 1 << 20
+	}
+	capture := &ResponseCapture{
+		key:    key,
+		origin: c.Writer,
+		writer: &responseCacheWriter{ResponseWriter: c.Writer, maxSize: maxSize},
+	}
+	c.Header(ResponseCacheHeader, "miss")
+	c.Writer = capture.writer
+	return capture
+}
+
+// Finish 恢复原始 writer，请求成功且响应完整时写入缓存
+func (capture *ResponseCapture) Finish(c *gin.Context, info *relaycommon.RelayInfo, success bool) {
+	c.Writer = capture.origin
+	w := capture.writer
+	if !success || w.overflow || w.body.Len() == 0 || w.Status() != http.StatusOK {
+		return
+	}
+	usage, ok := common.GetContextKeyType[dto.Usage](c, constant.ContextKeyResponseCacheUsage)
+	if !ok || usage.TotalTokens == 0 {
+		return
+	}
+	entry := ResponseCacheEntry{
+		Stream:      info.IsStream,
+		ContentType: w.Header().Get("Content-Type"),
+		Body:        w.body.String(),
+		Usage:       usage,
+		CreatedAt:   common.GetTimestamp(),
+	}
+	key := capture.key
+	gopool.Go(func() {
+		if err := getResponseCache().SetWithTTL(key, entry, responseCacheTTL()); err != nil {
+			common.SysError("failed to save response cache: " + err.Error())
+		}
+	})
+}
+
+// PurgeResponseCache 清空响应缓存
+func PurgeResponseCache() error {
+	return getResponseCache().Purge()
+}
@@ -0,0 +1,46 @@
+package service
+
+import (
+	"testing"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/dto"
+	"github.com/stretchr/testify/require"
+)
+
+func mustParseChatRequest(t *testing.T, body string) *dto.GeneralOpenAIRequest {
+	t.Helper()
+	var req dto.GeneralOpenAIRequest
+	require.NoError(t, common.Unmarshal([]byte(body), &req))
+	return &req
+}
+
+func TestBuildResponseCacheKeyNormalizesRequest(t *testing.T) {
+	a := mustParseChatRequest(t, `{"model":"gpt-4o","temperature":0,"messages":[{"role":"user","content":"hi"}],"user":"alice"}`)
+	b := mustParseChatRequest(t, `{"messages":[{"content":"hi","role":"user"}],"user":"bob","temperature":0,"model":"gpt-4o","metadata":{"k":"v"}}`)
+
+	keyA, err := BuildResponseCacheKey(1, "gpt-4o", a)
+	require.NoError(t, err)
+	keyB, err := BuildResponseCacheKey(1, "gpt-4o", b)
+	require.NoError(t, err)
+	require.Equal(t, keyA, keyB)
+
+	otherUser, err := BuildResponseCacheKey(2, "gpt-4o", a)
+	require.NoError(t, err)
+	require.NotEqual(t, keyA, otherUser)
+}
+
+func TestBuildResponseCacheKeyDistinguishesSamplingAndStream(t *testing.T) {
+	base := `{"model":"gpt-4o","messages":[{"role":"user","content":"hi"}]`
+	plain := mustParseChatRequest(t, base+`,"temperature":0}`)
+	sampled := mustParseChatRequest(t, base+`,"temperature":0,"top_p":0.5}`)
+	stream := mustParseChatRequest(t, base+`,"temperature":0,"stream":true}`)
+
+	keys := map[string]bool{}
+	for _, req := range []*dto.GeneralOpenAIRequest{plain, sampled, stream} {
+		key, err := BuildResponseCacheKey(1, "gpt-4o", req)
+		require.NoError(t, err)
+		keys[key] = true
+	}
+	require.Len(t, keys, 3)
+}
@@ -0,0 +1,277 @@
+package service
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+
+	"github.com/QuantumNous/new-api/common"
+)
+
+// responseDigestMaxLine 单行 SSE 数据的上限，超过时丢弃该行
+const responseDigestMaxLine = 4 << 20
+
+// ResponseDigest 从响应体中提取的文本、结束原因与用量，支持 OpenAI Chat Completions / Completions / Responses、
+// Claude Messages 与 Gemini 的流式与非流式响应
+type ResponseDigest struct {
+	Text             string
+	FinishReason     string
+	PromptTokens     int
+	CompletionTokens int
+}
+
+type responseDigestUsage struct {
+	PromptTokens     int `json:"prompt_tokens"`
+	CompletionTokens int `json:"completion_tokens"`
+	InputTokens      int `json:"input_tokens"`
+	OutputTokens     int `json:"output_tokens"`
+}
+
+type responseDigestEvent struct {
+	Type    string `json:"type"`
+	Choices []struct {
+		Text    string `json:"text"`
+		Message *struct {
+			Content any `json:"content"`
+		} `json:"message"`
+		Delta *struct {
+			Content any `json:"content"`
+		} `json:"delta"`
+		FinishReason *string `json:"finish_reason"`
+	} `json:"choices"`
+	Usage *responseDigestUsage `json:"usage"`
+	// Claude Messages；Responses 流式事件的 delta 是字符串
+	Content    any             `json:"content"`
+	StopReason *string         `json:"stop_reason"`
+	Delta      json.RawMessage `json:"delta"`
+	Message    *struct {
+		Usage *responseDigestUsage `json:"usage"`
+	} `json:"message"`
+	// OpenAI Responses
+	Output   []map[string]any `json:"output"`
+	Status   string           `json:"status"`
+	Response *struct {
+		Status string               `json:"status"`
+		Usage  *responseDigestUsage `json:"usage"`
+	} `json:"response"`
+	// Gemini
+	Candidates []struct {
+		Content *struct {
+			Parts []struct {
+				Text string `json:"text"`
+			} `json:"parts"`
+		} `json:"content"`
+		FinishReason string `json:"finishReason"`
+	} `json:"candidates"`
+	UsageMetadata *struct {
+		PromptTokenCount     int `json:"promptTokenCount"`
+		CandidatesTokenCount int `json:"candidatesTokenCount"`
+	} `json:"usageMetadata"`
+}
+
+type responseDigestDelta struct {
+	Type       string  `json:"type"`
+	Text       string  `json:"text"`
+	StopReason *string `json:"stop_reason"`
+}
+
+// ResponseDigestBuilder 逐块接收响应体并按行解析 SSE 事件，文本超过上限的部分被丢弃
+type ResponseDigestBuilder struct {
+	digest    ResponseDigest
+	text      strings.Builder
+	textLimit int
+	truncated bool
+	pending   []byte
+}
+
+// NewResponseDigestBuilder textLimit 为保留文本的字节上限，0 表示不限制
+func NewResponseDigestBuilder(textLimit int) *ResponseDigestBuilder {
+	return &ResponseDigestBuilder{textLimit: textLimit}
+}
+
+// Write 接收一段 SSE 响应体，完整的行立即解析，不完整的行留到下一次
+func (b *ResponseDigestBuilder) Write(p []byte) (int, error) {
+	data := p
+	for len(data) > 0 {
+		idx := bytes.IndexByte(data, '\n')
+		if idx < 0 {
+			if len(b.pending)+len(data) <= responseDigestMaxLine {
+				b.pending = append(b.pending, data...)
+			} else {
+				b.pending = b.pending[:0]
+			}
+			break
+		}
+		line := data[:idx]
+		if len(b.pending) > 0 {
+			line = append(b.pending, line...)
+			b.pending = b.pending[:0]
+		}
+		b.applyLine(line)
+		data = data[idx+1:]
+	}
+	return len(p), nil
+}
+
+// Digest 解析剩余的不完整行并返回结果
+func (b *ResponseDigestBuilder) Digest() ResponseDigest {
+	if len(b.pending) > 0 {
+		b.applyLine(b.pending)
+		b.pending = nil
+	}
+	b.digest.Text = b.text.String()
+	return b.digest
+}
+
+// Truncated 判断文本是否因为超过上限被截断
+func (b *ResponseDigestBuilder) Truncated() bool {
+	return b.truncated
+}
+
+func (b *ResponseDigestBuilder) applyLine(line []byte) {
+	data, ok := bytes.CutPrefix(bytes.TrimSpace(line), []byte("data:"))
+	if !ok {
+		return
+	}
+	data = bytes.TrimSpace(data)
+	if len(data) == 0 || data[0] != '{' {
+		return
+	}
+	b.applyEvent(data)
+}
+
+func (b *ResponseDigestBuilder) writeText(s string) {
+	if s == "" {
+		return
+	}
+	if b.textLimit > 0 {
+		remaining := b.textLimit - b.text.Len()
+		if remaining <= 0 {
+			b.truncated = true
+			return
+		}
+		if len(s) > remaining {
+			s = s[:remaining]
+			b.truncated = true
+		}
+	}
+	b.text.WriteString(s)
+}
+
+func (b *ResponseDigestBuilder) setFinishReason(reason string) {
+	if reason != "" {
+		b.digest.FinishReason = reason
+	}
+}
+
+func (b *ResponseDigestBuilder) applyEvent(data []byte) {
+	var event responseDigestEvent
+	if err := common.Unmarshal(data, &event); err != nil {
+		return
+	}
+	for _, choice := range event.Choices {
+		b.writeText(choice.Text)
+		if choice.Message != nil {
+			b.writeText(digestContentText(choice.Message.Content))
+		}
+		if choice.Delta != nil {
+			b.writeText(digestContentText(choice.Delta.Content))
+		}
+		if choice.FinishReason != nil {
+			b.setFinishReason(*choice.FinishReason)
+		}
+	}
+	b.writeText(digestContentText(event.Content))
+	if event.StopReason != nil {
+		b.setFinishReason(*event.StopReason)
+	}
+	if len(event.Delta) > 0 {
+		var text string
+		var delta responseDigestDelta
+		if common.Unmarshal(event.Delta, &text) == nil {
+			if event.Type == "response.output_text.delta" {
+				b.writeText(text)
+			}
+		} else if common.Unmarshal(event.Delta, &delta) == nil {
+			if delta.Type == "text_delta" {
+				b.writeText(delta.Text)
+			}
+			if delta.StopReason != nil {
+				b.setFinishReason(*delta.StopReason)
+			}
+		}
+	}
+	if event.Message != nil {
+		b.applyUsage(event.Message.Usage)
+	}
+	for _, item := range event.Output {
+		b.writeText(digestContentText(item["content"]))
+	}
+	if event.Status != "" && len(event.Output) > 0 {
+		b.setFinishReason(event.Status)
+	}
+	if event.Response != nil {
+		b.setFinishReason(event.Response.Status)
+		b.applyUsage(event.Response.Usage)
+	}
+	for _, candidate := range event.Candidates {
+		if candidate.Content != nil {
+			for _, part := range candidate.Content.Parts {
+				b.writeText(part.Text)
+			}
+		}
+		b.setFinishReason(candidate.FinishReason)
+	}
+	if event.UsageMetadata != nil {
+		b.applyUsage(&responseDigestUsage{
+			PromptTokens:     event.UsageMetadata.PromptTokenCount,
+			CompletionTokens: event.UsageMetadata.CandidatesTokenCount,
+		})
+	}
+	b.applyUsage(event.Usage)
+}
+
+// applyUsage 流式响应中用量可能分多次给出（Claude 的 message_start 与 message_delta），非零值覆盖已有值
+func (b *ResponseDigestBuilder) applyUsage(usage *responseDigestUsage) {
+	if usage == nil {
+		return
+	}
+	if prompt := max(usage.PromptTokens, usage.InputTokens); prompt > 0 {
+		b.digest.PromptTokens = prompt
+	}
+	if completion := max(usage.CompletionTokens, usage.OutputTokens); completion > 0 {
+		b.digest.CompletionTokens = completion
+	}
+}
+
+// ParseResponseDigest 解析完整的响应体，无法识别的内容被忽略
+func ParseResponseDigest(body []byte) ResponseDigest {
+	builder := NewResponseDigestBuilder(0)
+	if trimmed := bytes.TrimSpace(body); len(trimmed) > 0 && trimmed[0] == '{' {
+		builder.applyEvent(trimmed)
+	} else {
+		_, _ = builder.Write(body)
+	}
+	return builder.Digest()
+}
+
+// digestContentText 提取字符串或内容块数组中的文本
+func digestContentText(content any) string {
+	switch v := content.(type) {
+	case string:
+		return v
+	case []any:
+		var sb strings.Builder
+		for _, item := range v {
+			part, ok := item.(map[string]any)
+			if !ok {
+				continue
+			}
+			if text, ok := part["text"].(string); ok {
+				sb.WriteString(text)
+			}
+		}
+		return sb.String()
+	}
+	return ""
+}
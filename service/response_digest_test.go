@@ -0,0 +1,56 @@
+package service
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseResponseDigestOpenAI(t *testing.T) {
+	resp := ParseResponseDigest([]byte(`{"choices":[{"message":{"role":"assistant","content":"Hello there"},"finish_reason":"stop"}],"usage":{"prompt_tokens":12,"completion_tokens":3,"total_tokens":15}}`))
+	require.Equal(t, ResponseDigest{Text: "Hello there", FinishReason: "stop", PromptTokens: 12, CompletionTokens: 3}, resp)
+
+	stream := "data: {\"choices\":[{\"delta\":{\"role\":\"assistant\",\"content\":\"\"},\"finish_reason\":null}]}\n\n" +
+		": PING\n\n" +
+		"data: {\"choices\":[{\"delta\":{\"content\":\"Hel\"},\"finish_reason\":null}]}\n\n" +
+		"data: {\"choices\":[{\"delta\":{\"content\":\"lo\"},\"finish_reason\":\"length\"}]}\n\n" +
+		"data: {\"choices\":[],\"usage\":{\"prompt_tokens\":5,\"completion_tokens\":2}}\n\n" +
+		"data: [DONE]\n\n"
+	resp = ParseResponseDigest([]byte(stream))
+	require.Equal(t, ResponseDigest{Text: "Hello", FinishReason: "length", PromptTokens: 5, CompletionTokens: 2}, resp)
+}
+
+func TestParseResponseDigestClaude(t *testing.T) {
+	resp := ParseResponseDigest([]byte(`{"type":"message","content":[{"type":"text","text":"Hi"},{"type":"tool_use","name":"x"}],"stop_reason":"end_turn","usage":{"input_tokens":9,"output_tokens":4}}`))
+	require.Equal(t, ResponseDigest{Text: "Hi", FinishReason: "end_turn", PromptTokens: 9, CompletionTokens: 4}, resp)
+
+	stream := "event: message_start\n" +
+		"data: {\"type\":\"message_start\",\"message\":{\"content\":[],\"usage\":{\"input_tokens\":20,\"output_tokens\":1}}}\n\n" +
+		"event: content_block_delta\n" +
+		"data: {\"type\":\"content_block_delta\",\"index\":0,\"delta\":{\"type\":\"text_delta\",\"text\":\"Bon\"}}\n\n" +
+		"data: {\"type\":\"content_block_delta\",\"index\":0,\"delta\":{\"type\":\"text_delta\",\"text\":\"jour\"}}\n\n" +
+		"data: {\"type\":\"message_delta\",\"delta\":{\"stop_reason\":\"max_tokens\"},\"usage\":{\"output_tokens\":7}}\n\n"
+	resp = ParseResponseDigest([]byte(stream))
+	require.Equal(t, ResponseDigest{Text: "Bonjour", FinishReason: "max_tokens", PromptTokens: 20, CompletionTokens: 7}, resp)
+}
+
+func TestParseResponseDigestResponsesAndGemini(t *testing.T) {
+	stream := "event: response.output_text.delta\n" +
+		"data: {\"type\":\"response.output_text.delta\",\"delta\":\"Hi \"}\n\n" +
+		"data: {\"type\":\"response.output_text.delta\",\"delta\":\"you\"}\n\n" +
+		"data: {\"type\":\"response.completed\",\"response\":{\"status\":\"completed\",\"output\":[{\"type\":\"message\",\"content\":[{\"type\":\"output_text\",\"text\":\"Hi you\"}]}],\"usage\":{\"input_tokens\":6,\"output_tokens\":2}}}\n\n"
+	require.Equal(t, ResponseDigest{Text: "Hi you", FinishReason: "completed", PromptTokens: 6, CompletionTokens: 2}, ParseResponseDigest([]byte(stream)))
+
+	gemini := `{"candidates":[{"content":{"parts":[{"text":"Ciao"}],"role":"model"},"finishReason":"STOP"}],"usageMetadata":{"promptTokenCount":3,"candidatesTokenCount":1}}`
+	require.Equal(t, ResponseDigest{Text: "Ciao", FinishReason: "STOP", PromptTokens: 3, CompletionTokens: 1}, ParseResponseDigest([]byte(gemini)))
+}
+
+func TestResponseDigestBuilderSplitChunksAndLimit(t *testing.T) {
+	builder := NewResponseDigestBuilder(4)
+	stream := "data: {\"choices\":[{\"delta\":{\"content\":\"Hel\"}}]}\n\ndata: {\"choices\":[{\"delta\":{\"content\":\"lo!\"},\"finish_reason\":\"stop\"}]}\n\n"
+	for i := 0; i < len(stream); i += 7 {
+		_, _ = builder.Write([]byte(stream[i:min(i+7, len(stream))]))
+	}
+	require.Equal(t, ResponseDigest{Text: "Hell", FinishReason: "stop"}, builder.Digest())
+	require.True(t, builder.Truncated())
+}
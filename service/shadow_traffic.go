@@ -0,0 +1,78 @@
+package service
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/constant"
+	"github.com/QuantumNous/new-api/dto"
+	"github.com/QuantumNous/new-api/logger"
+	"github.com/QuantumNous/new-api/model"
+	relaycommon "github.com/QuantumNous/new-api/relay/common"
+
+	"github.com/gin-gonic/gin"
+)
+
+// recordShadowAttempt 影子请求不向用户计费，也不写消费日志；上游返回的用量按正常价格计入影子渠道的已用额度，
+// 并保存在 relayInfo.Shadow 中写入影子日志
+func recordShadowAttempt(ctx *gin.Context, relayInfo *relaycommon.RelayInfo, usage *dto.Usage) {
+	if usage == nil {
+		return
+	}
+	summary := calculateTextQuotaSummary(ctx, relayInfo, usage)
+	model.UpdateChannelUsedQuota(relayInfo.ChannelId, summary.Quota)
+	relayInfo.Shadow.Usage = usage
+	relayInfo.Shadow.Quota = summary.Quota
+	logger.LogDebug(ctx, fmt.Sprintf("影子请求：渠道 #%d 产生 %d tokens（%s），不向用户计费",
+		relayInfo.ChannelId, summary.TotalTokens, logger.FormatQuota(summary.Quota)))
+}
+
+// RememberShadowPrimaryUsage 请求被抽中复制影子流量时，记录主请求上游返回的用量用于对比
+func RememberShadowPrimaryUsage(c *gin.Context, usage *dto.Usage) {
+	if usage == nil {
+		return
+	}
+	if holder, ok := common.GetContextKeyType[*dto.Usage](c, constant.ContextKeyShadowPrimaryUsage); ok && holder != nil {
+		*holder = *usage
+	}
+}
+
+// TextSimilarity 计算两段文本的相似度（字符三元组的 Jaccard 系数），忽略大小写与空白差异，返回 0-1
+func TextSimilarity(a, b string) float64 {
+	a, b = normalizeSimilarityText(a), normalizeSimilarityText(b)
+	if a == b {
+		return 1
+	}
+	setA, setB := characterTrigrams(a), characterTrigrams(b)
+	if len(setA) == 0 || len(setB) == 0 {
+		return 0
+	}
+	intersection := 0
+	for gram := range setA {
+		if _, ok := setB[gram]; ok {
+			intersection++
+		}
+	}
+	return float64(intersection) / float64(len(setA)+len(setB)-intersection)
+}
+
+func normalizeSimilarityText(s string) string {
+	return strings.Join(strings.FieldsFunc(strings.ToLower(s), unicode.IsSpace), " ")
+}
+
+func characterTrigrams(s string) map[string]struct{} {
+	runes := []rune(s)
+	grams := make(map[string]struct{})
+	if len(runes) < 3 {
+		if len(runes) > 0 {
+			grams[s] = struct{}{}
+		}
+		return grams
+	}
+	for i := 0; i+3 <= len(runes); i++ {
+		grams[string(runes[i:i+3])] = struct{}{}
+	}
+	return grams
+}
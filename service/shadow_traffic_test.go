@@ -0,0 +1,16 @@
+package service
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestTextSimilarity(t *testing.T) {
+	require.Equal(t, 1.0, TextSimilarity("Hello  World", "hello world"))
+	require.Equal(t, 0.0, TextSimilarity("abcdef", "uvwxyz"))
+	require.Equal(t, 0.0, TextSimilarity("", "abc"))
+	similarity := TextSimilarity("the quick brown fox", "the quick brown dog")
+	require.Greater(t, similarity, 0.5)
+	require.Less(t, similarity, 1.0)
+}
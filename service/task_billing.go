@@ -4,6 +4,7 @@ import (
 	"context"
 	"fmt"
 	"strings"
+	"time"
 
 	"github.com/QuantumNous/new-api/common"
 	"github.com/QuantumNous/new-api/constant"
@@ -86,8 +87,18 @@ func taskIsSubscription(task *model.Task) bool {
 
 // taskAdjustFunding 调整任务的资金来源（钱包或订阅），delta > 0 表示扣费，delta < 0 表示退还。
 func taskAdjustFunding(task *model.Task, delta int) error {
+	organizationId := task.PrivateData.OrganizationId
 	if taskIsSubscription(task) {
-		return model.PostConsumeUserSubscriptionDelta(task.PrivateData.SubscriptionId, int64(delta))
+		if err := model.PostConsumeUserSubscriptionDelta(task.PrivateData.SubscriptionId, int64(delta)); err != nil {
+			return err
+		}
+		if organizationId > 0 {
+			return model.AdjustOrganizationMemberUsedQuota(organizationId, task.UserId, delta)
+		}
+		return nil
+	}
+	if task.PrivateData.BillingSource == BillingSourceOrganizationWallet && organizationId > 0 {
+		return model.AdjustOrganizationQuota(organizationId, task.UserId, delta)
 	}
 	if delta > 0 {
 		return model.DecreaseUserQuota(task.UserId, delta, false)
@@ -161,8 +172,9 @@ func RefundTaskQuota(ctx context.Context, task *model.Task, reason string) {
 		return
 	}
 
-	// 2. 退还令牌额度
+	// 2. 退还令牌额度，并从令牌的消费窗口中扣除
 	taskAdjustTokenQuota(ctx, task, -quota)
+	AdjustTokenSpend(ctx, task.PrivateData.TokenId, taskModelName(task), -quota, time.Unix(task.SubmitTime, 0))
 
 	// 3. 记录日志
 	other := taskBillingOther(task)
@@ -211,8 +223,9 @@ func RecalculateTaskQuota(ctx context.Context, task *model.Task, actualQuota int
 		return
 	}
 
-	// 调整令牌额度
+	// 调整令牌额度与消费窗口
 	taskAdjustTokenQuota(ctx, task, quotaDelta)
+	AdjustTokenSpend(ctx, task.PrivateData.TokenId, taskModelName(task), quotaDelta, time.Unix(task.SubmitTime, 0))
 
 	task.Quota = actualQuota
 
@@ -46,6 +46,7 @@ func TestMain(m *testing.M) {
 		&model.UserSubscription{},
 		&model.SystemTask{},
 		&model.SystemTaskLock{},
+		&model.TokenSpendCounter{},
 	); err != nil {
 		panic("failed to migrate: " + err.Error())
 	}
@@ -223,6 +224,32 @@ func TestRefundTaskQuota_Wallet(t *testing.T) {
 	assert.Equal(t, "test-model", log.ModelName)
 }
 
+func TestRefundTaskQuota_ReleasesTokenSpendWindow(t *testing.T) {
+	truncate(t)
+	ctx := context.Background()
+
+	const userID, tokenID, channelID = 9, 900009, 9
+	const preConsumed = 3000
+
+	seedUser(t, userID, 10000)
+	seedToken(t, tokenID, userID, "sk-spend-key", 5000)
+	require.NoError(t, model.DB.Model(&model.Token{}).Where("id = ?", tokenID).Update("daily_quota_limit", 10000).Error)
+	seedChannel(t, channelID)
+
+	// 提交时结算计入了令牌的日消费窗口
+	task := makeTask(userID, channelID, preConsumed, tokenID, BillingSourceWallet, 0)
+	task.SubmitTime = time.Now().Unix()
+	window := tokenSpendWindows(model.TokenLimits{TokenQuotaWindows: model.TokenQuotaWindows{DailyQuota: 10000}}, "test-model", time.Now())[0]
+	_, err := tokenSpendCounter.Incr(window.key(tokenID), preConsumed, window.Reset)
+	require.NoError(t, err)
+
+	RefundTaskQuota(ctx, task, "task failed: upstream error")
+
+	used, err := tokenSpendCounter.Incr(window.key(tokenID), 0, window.Reset)
+	require.NoError(t, err)
+	assert.Zero(t, used)
+}
+
 func TestRefundTaskQuota_Subscription(t *testing.T) {
 	truncate(t)
 	ctx := context.Background()
@@ -320,12 +320,22 @@ func usageSemanticFromUsage(relayInfo *relaycommon.RelayInfo, usage *dto.Usage)
 }
 
 func PostTextConsumeQuota(ctx *gin.Context, relayInfo *relaycommon.RelayInfo, usage *dto.Usage, extraContent []string) {
+	if relayInfo.Hedge.Abandoned() {
+		recordAbandonedHedgeAttempt(ctx, relayInfo, usage)
+		return
+	}
+	if relayInfo.Shadow != nil {
+		recordShadowAttempt(ctx, relayInfo, usage)
+		return
+	}
 	originUsage := usage
 	if usage == nil {
 		extraContent = append(extraContent, "上游无计费信息")
 	}
 	if originUsage != nil {
 		ObserveChannelAffinityUsageCacheByRelayFormat(ctx, usage, relayInfo.GetFinalRequestRelayFormat())
+		RememberResponseCacheUsage(ctx, usage)
+		RememberShadowPrimaryUsage(ctx, usage)
 	}
 
 	adminRejectReason := common.GetContextKeyString(ctx, constant.ContextKeyAdminRejectReason)
@@ -181,7 +181,12 @@ func EstimateRequestToken(c *gin.Context, meta *types.TokenCountMeta, info *rela
 	if !constant.CountToken {
 		return 0, nil
 	}
+	return CountRequestTokens(c, meta, info)
+}
 
+// CountRequestTokens 在本地估算请求的输入 token 数（文本、工具定义与图片等媒体），
+// 不受 CountToken 开关影响，供 count_tokens 接口直接返回给客户端
+func CountRequestTokens(c *gin.Context, meta *types.TokenCountMeta, info *relaycommon.RelayInfo) (int, error) {
 	if meta == nil {
 		return 0, errors.New("token count meta is nil")
 	}
@@ -220,7 +225,9 @@ func EstimateRequestToken(c *gin.Context, meta *types.TokenCountMeta, info *rela
 	if meta.TokenType == types.TokenTypeTextNumber {
 		tkm += utf8.RuneCountInString(meta.CombineText)
 	} else {
-		tkm += CountTextToken(meta.CombineText, model)
+		textTokenizer := GetTokenizerForModel(model)
+		common.SetContextKey(c, constant.ContextKeyTokenizer, textTokenizer.Name())
+		tkm += textTokenizer.Count(meta.CombineText)
 	}
 
 	if info.RelayFormat == types.RelayFormatOpenAI {
@@ -391,16 +398,10 @@ func CountAudioTokenOutput(audioBase64 string, audioFormat string) (int, error)
 	return int(duration / 60 * 200 / 0.24), nil
 }
 
-// CountTextToken 统计文本的token数量，仅OpenAI模型使用tokenizer，其余模型使用估算
+// CountTextToken 统计文本的token数量，分词器的选择见 GetTokenizerForModel
 func CountTextToken(text string, model string) int {
 	if text == "" {
 		return 0
 	}
-	if common.IsOpenAITextModel(model) {
-		tokenEncoder := getTokenEncoder(model)
-		return getTokenNum(tokenEncoder, text)
-	} else {
-		// 非openai模型，使用tiktoken-go计算没有意义，使用估算节省资源
-		return EstimateTokenByModel(model, text)
-	}
+	return GetTokenizerForModel(model).Count(text)
 }
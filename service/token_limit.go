@@ -0,0 +1,327 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/constant"
+	"github.com/QuantumNous/new-api/logger"
+	"github.com/QuantumNous/new-api/model"
+	"github.com/QuantumNous/new-api/types"
+
+	"github.com/bytedance/gopkg/util/gopool"
+	"github.com/gin-gonic/gin"
+)
+
+// 令牌消费窗口按服务器本地时区的自然日 / 自然周（周一开始）/ 自然月计算，到期自动重置；
+// 计数在启用 Redis 时存放于 Redis，否则保存在数据库中，均为多节点共享
+const (
+	tokenSpendKeyPrefix = "token_spend"
+	tokenRpmKeyPrefix   = "token_rpm"
+)
+
+type tokenSpendWindow struct {
+	Name  string
+	Model string // 按模型的子预算时为匹配到的模型规则，否则为空
+	Limit int
+	Start time.Time
+	Reset time.Time
+}
+
+func (w tokenSpendWindow) key(tokenId int) string {
+	if w.Model != "" {
+		return fmt.Sprintf("%s:%d:model:%s:%s:%d", tokenSpendKeyPrefix, tokenId, w.Model, w.Name, w.Start.Unix())
+	}
+	return fmt.Sprintf("%s:%d:%s:%d", tokenSpendKeyPrefix, tokenId, w.Name, w.Start.Unix())
+}
+
+func (w tokenSpendWindow) label() string {
+	if w.Model != "" {
+		return fmt.Sprintf("%s spend limit for model %s", w.Name, w.Model)
+	}
+	return w.Name + " spend limit"
+}
+
+// quotaWindows 返回 now 所在的各个已配置上限的消费窗口
+func quotaWindows(modelPattern string, quota model.TokenQuotaWindows, now time.Time) []tokenSpendWindow {
+	day := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+	windows := make([]tokenSpendWindow, 0, 3)
+	if quota.DailyQuota > 0 {
+		windows = append(windows, tokenSpendWindow{Name: "daily", Model: modelPattern, Limit: quota.DailyQuota, Start: day, Reset: day.AddDate(0, 0, 1)})
+	}
+	if quota.WeeklyQuota > 0 {
+		// time.Weekday 以周日为 0，这里以周一作为一周的开始
+		offset := (int(now.Weekday()) + 6) % 7
+		week := day.AddDate(0, 0, -offset)
+		windows = append(windows, tokenSpendWindow{Name: "weekly", Model: modelPattern, Limit: quota.WeeklyQuota, Start: week, Reset: week.AddDate(0, 0, 7)})
+	}
+	if quota.MonthlyQuota > 0 {
+		month := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, now.Location())
+		windows = append(windows, tokenSpendWindow{Name: "monthly", Model: modelPattern, Limit: quota.MonthlyQuota, Start: month, Reset: month.AddDate(0, 1, 0)})
+	}
+	return windows
+}
+
+// tokenSpendWindows 返回令牌整体以及当前模型子预算的所有消费窗口
+func tokenSpendWindows(limits model.TokenLimits, modelName string, now time.Time) []tokenSpendWindow {
+	windows := quotaWindows("", limits.TokenQuotaWindows, now)
+	if modelQuota, pattern, ok := limits.GetModelQuota(modelName); ok {
+		windows = append(windows, quotaWindows(pattern, modelQuota, now)...)
+	}
+	return windows
+}
+
+func getTokenLimits(c *gin.Context) (model.TokenLimits, bool) {
+	limits, ok := common.GetContextKeyType[model.TokenLimits](c, constant.ContextKeyTokenLimits)
+	if !ok || limits.IsEmpty() {
+		return model.TokenLimits{}, false
+	}
+	return limits, true
+}
+
+// tokenSpendReservation 预扣费时在各消费窗口中预留的额度，结算时按实际消耗修正，请求失败时释放
+type tokenSpendReservation struct {
+	TokenId int
+	Quota   int
+	Windows []tokenSpendWindow
+}
+
+// CheckTokenLimits 在预扣费前校验令牌的单次请求费用上限、每分钟请求数与周期消费上限（含按模型的子预算）。
+// preConsumedQuota 为 relay/helper/price.go 计算出的预估额度，校验通过时原子地计入各消费窗口作为预留，
+// 并发请求不会同时通过同一个剩余额度；预留由 RecordTokenSpend 按实际消耗修正，或由 ReleaseTokenSpendReservation 释放。
+// 超过单次费用上限返回 403，其余超限返回 429，错误信息中包含超限的窗口与重置时间
+func CheckTokenLimits(c *gin.Context, tokenId int, modelName string, preConsumedQuota int) *types.NewAPIError {
+	limits, ok := getTokenLimits(c)
+	if !ok || tokenId <= 0 {
+		return nil
+	}
+	now := time.Now()
+
+	if limits.MaxRequestQuota > 0 && preConsumedQuota > limits.MaxRequestQuota {
+		return types.NewErrorWithStatusCode(
+			fmt.Errorf("estimated request cost %s exceeds the token's per-request limit %s",
+				logger.FormatQuota(preConsumedQuota), logger.FormatQuota(limits.MaxRequestQuota)),
+			types.ErrorCodeTokenRequestCostExceeded, http.StatusForbidden,
+			types.ErrOptionWithSkipRetry(), types.ErrOptionWithNoRecordErrorLog())
+	}
+
+	// 同一请求重新预留（例如切换到备选模型）时先释放之前的预留
+	ReleaseTokenSpendReservation(c)
+	reserve := int64(preConsumedQuota)
+	reserved := make([]tokenSpendWindow, 0, 4)
+	for _, window := range tokenSpendWindows(limits, modelName, now) {
+		used, err := tokenSpendCounter.Incr(window.key(tokenId), reserve, window.Reset)
+		if err != nil {
+			logger.LogWarn(c, fmt.Sprintf("failed to check token %s: %s", window.label(), err.Error()))
+			continue
+		}
+		// used 已包含本次预留，used-reserve 为其他请求已消耗与预留的额度
+		if used-reserve >= int64(window.Limit) || used > int64(window.Limit) {
+			releaseTokenSpendWindows(c, tokenId, append(reserved, window), -reserve)
+			return tokenLimitError(c, types.ErrorCodeTokenSpendLimitExceeded, window.Reset,
+				fmt.Sprintf("token %s exceeded: used %s of %s", window.label(),
+					logger.FormatQuota(int(used-reserve)), logger.FormatQuota(window.Limit)))
+		}
+		reserved = append(reserved, window)
+	}
+
+	// 每分钟请求数放在消费窗口之后计数，被其他限制拒绝的请求不占用次数；
+	// 同一请求重新校验（例如切换到备选模型）时不重复计数
+	if limits.Rpm > 0 && !common.GetContextKeyBool(c, constant.ContextKeyTokenRpmCounted) {
+		minute := now.Truncate(time.Minute)
+		reset := minute.Add(time.Minute)
+		key := fmt.Sprintf("%s:%d:%d", tokenRpmKeyPrefix, tokenId, minute.Unix())
+		count, err := tokenRpmCounter.Incr(key, 1, reset)
+		if err != nil {
+			// 计数存储异常时放行，避免影响正常请求
+			logger.LogWarn(c, "failed to check token rpm limit: "+err.Error())
+		} else if count > int64(limits.Rpm) {
+			// 被拒绝的请求不计入次数，也不保留消费窗口中的预留
+			_, _ = tokenRpmCounter.Incr(key, -1, reset)
+			releaseTokenSpendWindows(c, tokenId, reserved, -reserve)
+			return tokenLimitError(c, types.ErrorCodeTokenRateLimitExceeded, reset,
+				fmt.Sprintf("token rate limit exceeded: at most %d requests per minute", limits.Rpm))
+		} else {
+			common.SetContextKey(c, constant.ContextKeyTokenRpmCounted, true)
+		}
+	}
+
+	if reserve > 0 && len(reserved) > 0 {
+		common.SetContextKey(c, constant.ContextKeyTokenSpendReservation, &tokenSpendReservation{
+			TokenId: tokenId,
+			Quota:   preConsumedQuota,
+			Windows: reserved,
+		})
+	}
+	return nil
+}
+
+// releaseTokenSpendWindows 将 delta 计入各消费窗口，用于修正或撤销预留
+func releaseTokenSpendWindows(c *gin.Context, tokenId int, windows []tokenSpendWindow, delta int64) {
+	if delta == 0 {
+		return
+	}
+	for _, window := range windows {
+		if _, err := tokenSpendCounter.Incr(window.key(tokenId), delta, window.Reset); err != nil {
+			logger.LogWarn(c, fmt.Sprintf("failed to adjust token %s: %s", window.label(), err.Error()))
+		}
+	}
+}
+
+// takeTokenSpendReservation 取出并清除请求上的预留，保证每个预留只被修正或释放一次
+func takeTokenSpendReservation(c *gin.Context) *tokenSpendReservation {
+	if c == nil {
+		return nil
+	}
+	reservation, ok := common.GetContextKeyType[*tokenSpendReservation](c, constant.ContextKeyTokenSpendReservation)
+	if !ok || reservation == nil {
+		return nil
+	}
+	common.SetContextKey(c, constant.ContextKeyTokenSpendReservation, (*tokenSpendReservation)(nil))
+	return reservation
+}
+
+// ReleaseTokenSpendReservation 请求失败、预扣费退还时释放 CheckTokenLimits 在消费窗口中的预留
+func ReleaseTokenSpendReservation(c *gin.Context) {
+	if reservation := takeTokenSpendReservation(c); reservation != nil {
+		releaseTokenSpendWindows(c, reservation.TokenId, reservation.Windows, -int64(reservation.Quota))
+	}
+}
+
+func tokenLimitError(c *gin.Context, code types.ErrorCode, reset time.Time, message string) *types.NewAPIError {
+	retryAfter := int(time.Until(reset).Seconds()) + 1
+	c.Header("Retry-After", strconv.Itoa(retryAfter))
+	return types.NewErrorWithStatusCode(
+		fmt.Errorf("%s, resets at %s", message, reset.Format(time.RFC3339)),
+		code, http.StatusTooManyRequests,
+		types.ErrOptionWithSkipRetry(), types.ErrOptionWithNoRecordErrorLog())
+}
+
+// RecordTokenSpend 结算后将实际消耗计入令牌的各个消费窗口：有预留时按实际消耗与预留的差额修正预留所在的窗口，
+// 否则直接计入当前窗口
+func RecordTokenSpend(c *gin.Context, tokenId int, modelName string, quota int) {
+	if reservation := takeTokenSpendReservation(c); reservation != nil {
+		releaseTokenSpendWindows(c, reservation.TokenId, reservation.Windows, int64(quota-reservation.Quota))
+		return
+	}
+	limits, ok := getTokenLimits(c)
+	if !ok || tokenId <= 0 || quota == 0 {
+		return
+	}
+	for _, window := range tokenSpendWindows(limits, modelName, time.Now()) {
+		if _, err := tokenSpendCounter.Incr(window.key(tokenId), int64(quota), window.Reset); err != nil {
+			logger.LogWarn(c, fmt.Sprintf("failed to record token %s: %s", window.label(), err.Error()))
+		}
+	}
+}
+
+// AdjustTokenSpend 异步任务在请求结束后退款或差额结算时修正令牌消费窗口。请求上下文已不存在，
+// 限额从令牌读取，delta 计入 spentAt（任务提交时间）所在的窗口，已经结束的窗口不再调整
+func AdjustTokenSpend(ctx context.Context, tokenId int, modelName string, delta int, spentAt time.Time) {
+	if tokenId <= 0 || delta == 0 {
+		return
+	}
+	token, err := model.GetTokenById(tokenId)
+	if err != nil {
+		logger.LogWarn(ctx, fmt.Sprintf("failed to load token %d to adjust spend windows: %s", tokenId, err.Error()))
+		return
+	}
+	limits := token.GetLimits()
+	now := time.Now()
+	for _, window := range tokenSpendWindows(limits, modelName, spentAt) {
+		if !window.Reset.After(now) {
+			continue
+		}
+		if _, err := tokenSpendCounter.Incr(window.key(tokenId), int64(delta), window.Reset); err != nil {
+			logger.LogWarn(ctx, fmt.Sprintf("failed to adjust token %s: %s", window.label(), err.Error()))
+		}
+	}
+}
+
+// windowCounter 带过期时间的计数器，过期时间取窗口结束时刻。启用 Redis 时计数存放于 Redis；
+// 否则 persistent 的计数保存在数据库中（重启不清零、多节点共享），其余保存在本机内存
+type windowCounter struct {
+	persistent bool
+	mu         sync.Mutex
+	values     map[string]windowCounterValue
+	lastSweep  time.Time
+}
+
+type windowCounterValue struct {
+	value    int64
+	expireAt time.Time
+}
+
+var (
+	// tokenSpendCounter 周期消费窗口的计数，窗口长达一个月，不能因为重启或请求落在其他节点而清零
+	tokenSpendCounter = &windowCounter{persistent: true, values: make(map[string]windowCounterValue)}
+	// tokenRpmCounter 每分钟请求数的计数，与模型请求限流一致，未启用 Redis 时按节点计数
+	tokenRpmCounter = &windowCounter{values: make(map[string]windowCounterValue)}
+)
+
+const tokenLimitRedisTimeout = 2 * time.Second
+
+func (w *windowCounter) Incr(key string, delta int64, expireAt time.Time) (int64, error) {
+	if common.RedisEnabled && common.RDB != nil {
+		ctx, cancel := context.WithTimeout(context.Background(), tokenLimitRedisTimeout)
+		defer cancel()
+		pipe := common.RDB.TxPipeline()
+		incr := pipe.IncrBy(ctx, key, delta)
+		pipe.ExpireAt(ctx, key, expireAt)
+		if _, err := pipe.Exec(ctx); err != nil {
+			return 0, err
+		}
+		return incr.Val(), nil
+	}
+
+	now := time.Now()
+	if w.persistent {
+		w.mu.Lock()
+		w.sweepPersistentLocked(now)
+		w.mu.Unlock()
+		return model.IncrTokenSpendCounter(key, delta, expireAt.Unix(), now.Unix())
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.sweepLocked(now)
+	v := w.values[key]
+	if !v.expireAt.After(now) {
+		v = windowCounterValue{}
+	}
+	v.value += delta
+	v.expireAt = expireAt
+	w.values[key] = v
+	return v.value, nil
+}
+
+// sweepLocked 每分钟最多清理一次过期的内存计数
+func (w *windowCounter) sweepLocked(now time.Time) {
+	if now.Sub(w.lastSweep) < time.Minute {
+		return
+	}
+	w.lastSweep = now
+	for key, v := range w.values {
+		if !v.expireAt.After(now) {
+			delete(w.values, key)
+		}
+	}
+}
+
+// sweepPersistentLocked 每小时最多清理一次数据库中已结束窗口的计数
+func (w *windowCounter) sweepPersistentLocked(now time.Time) {
+	if now.Sub(w.lastSweep) < time.Hour {
+		return
+	}
+	w.lastSweep = now
+	gopool.Go(func() {
+		if _, err := model.DeleteExpiredTokenSpendCounters(now.Unix()); err != nil {
+			common.SysLog("failed to delete expired token spend counters: " + err.Error())
+		}
+	})
+}
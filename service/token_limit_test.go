@@ -0,0 +1,220 @@
+package service
+
+import (
+	"errors"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/constant"
+	"github.com/QuantumNous/new-api/model"
+	relaycommon "github.com/QuantumNous/new-api/relay/common"
+	"github.com/QuantumNous/new-api/types"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTokenSpendWindows(t *testing.T) {
+	loc := time.FixedZone("UTC+8", 8*3600)
+	// 2026-10-18 是周日，所在周从 2026-10-12（周一）开始
+	now := time.Date(2026, 10, 18, 15, 30, 0, 0, loc)
+	windows := tokenSpendWindows(model.TokenLimits{
+		TokenQuotaWindows: model.TokenQuotaWindows{DailyQuota: 1, WeeklyQuota: 2, MonthlyQuota: 3},
+	}, "gpt-4o", now)
+	require.Len(t, windows, 3)
+
+	require.Equal(t, "daily", windows[0].Name)
+	require.Equal(t, time.Date(2026, 10, 18, 0, 0, 0, 0, loc), windows[0].Start)
+	require.Equal(t, time.Date(2026, 10, 19, 0, 0, 0, 0, loc), windows[0].Reset)
+
+	require.Equal(t, "weekly", windows[1].Name)
+	require.Equal(t, time.Date(2026, 10, 12, 0, 0, 0, 0, loc), windows[1].Start)
+	require.Equal(t, time.Date(2026, 10, 19, 0, 0, 0, 0, loc), windows[1].Reset)
+
+	require.Equal(t, "monthly", windows[2].Name)
+	require.Equal(t, time.Date(2026, 10, 1, 0, 0, 0, 0, loc), windows[2].Start)
+	require.Equal(t, time.Date(2026, 11, 1, 0, 0, 0, 0, loc), windows[2].Reset)
+
+	require.Empty(t, tokenSpendWindows(model.TokenLimits{Rpm: 10}, "gpt-4o", now))
+}
+
+func newTokenLimitTestContext(limits model.TokenLimits) *gin.Context {
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	common.SetContextKey(c, constant.ContextKeyTokenLimits, limits)
+	return c
+}
+
+func TestCheckTokenLimitsSpendWindow(t *testing.T) {
+	const tokenId = 900001
+	c := newTokenLimitTestContext(model.TokenLimits{
+		TokenQuotaWindows: model.TokenQuotaWindows{DailyQuota: 1000},
+	})
+
+	require.Nil(t, CheckTokenLimits(c, tokenId, "gpt-4o", 500))
+	RecordTokenSpend(c, tokenId, "gpt-4o", 800)
+	require.Nil(t, CheckTokenLimits(c, tokenId, "gpt-4o", 0))
+
+	apiErr := CheckTokenLimits(c, tokenId, "gpt-4o", 500)
+	require.NotNil(t, apiErr)
+	require.Equal(t, types.ErrorCodeTokenSpendLimitExceeded, apiErr.GetErrorCode())
+	require.Contains(t, apiErr.Error(), "daily")
+	require.Contains(t, apiErr.Error(), "resets at")
+	require.NotEmpty(t, c.Writer.Header().Get("Retry-After"))
+}
+
+func TestCheckTokenLimitsReservesConcurrently(t *testing.T) {
+	const tokenId = 900005
+	limits := model.TokenLimits{
+		TokenQuotaWindows: model.TokenQuotaWindows{DailyQuota: 1000},
+	}
+
+	var wg sync.WaitGroup
+	var passed atomic.Int32
+	contexts := make([]*gin.Context, 20)
+	for i := range contexts {
+		contexts[i] = newTokenLimitTestContext(limits)
+		wg.Add(1)
+		go func(c *gin.Context) {
+			defer wg.Done()
+			if CheckTokenLimits(c, tokenId, "gpt-4o", 300) == nil {
+				passed.Add(1)
+			}
+		}(contexts[i])
+	}
+	wg.Wait()
+	// 并发请求不能同时通过同一份剩余额度
+	require.Equal(t, int32(3), passed.Load())
+
+	// 结算按实际消耗修正预留，失败的请求释放预留
+	settled := 0
+	for _, c := range contexts {
+		if _, ok := common.GetContextKeyType[*tokenSpendReservation](c, constant.ContextKeyTokenSpendReservation); !ok {
+			continue
+		}
+		if settled == 0 {
+			RecordTokenSpend(c, tokenId, "gpt-4o", 100)
+		} else {
+			ReleaseTokenSpendReservation(c)
+		}
+		settled++
+		// 重复释放不影响计数
+		ReleaseTokenSpendReservation(c)
+	}
+	require.Equal(t, 3, settled)
+
+	c := newTokenLimitTestContext(limits)
+	require.Nil(t, CheckTokenLimits(c, tokenId, "gpt-4o", 900))
+	require.NotNil(t, CheckTokenLimits(newTokenLimitTestContext(limits), tokenId, "gpt-4o", 1))
+}
+
+func TestCheckTokenLimitsRpm(t *testing.T) {
+	const tokenId = 900002
+	limits := model.TokenLimits{Rpm: 2}
+
+	c := newTokenLimitTestContext(limits)
+	require.Nil(t, CheckTokenLimits(c, tokenId, "gpt-4o", 0))
+	// 同一请求切换到备选模型后重新校验，不重复计数
+	require.Nil(t, CheckTokenLimits(c, tokenId, "gpt-4o-mini", 0))
+	require.Nil(t, CheckTokenLimits(newTokenLimitTestContext(limits), tokenId, "gpt-4o", 0))
+	apiErr := CheckTokenLimits(newTokenLimitTestContext(limits), tokenId, "gpt-4o", 0)
+	require.NotNil(t, apiErr)
+	require.Equal(t, types.ErrorCodeTokenRateLimitExceeded, apiErr.GetErrorCode())
+}
+
+func TestCheckTokenLimitsModelQuota(t *testing.T) {
+	const tokenId = 900003
+	c := newTokenLimitTestContext(model.TokenLimits{
+		ModelQuotas: map[string]model.TokenQuotaWindows{
+			"claude-opus*": {DailyQuota: 1000},
+		},
+	})
+
+	RecordTokenSpend(c, tokenId, "claude-opus-4-1", 800)
+	// 未配置子预算的模型不受影响
+	require.Nil(t, CheckTokenLimits(c, tokenId, "gpt-4o-mini", 5000))
+
+	apiErr := CheckTokenLimits(c, tokenId, "claude-opus-4", 500)
+	require.NotNil(t, apiErr)
+	require.Equal(t, types.ErrorCodeTokenSpendLimitExceeded, apiErr.GetErrorCode())
+	require.Contains(t, apiErr.Error(), "claude-opus*")
+}
+
+func TestCheckTokenLimitsMaxRequestQuota(t *testing.T) {
+	const tokenId = 900004
+	c := newTokenLimitTestContext(model.TokenLimits{MaxRequestQuota: 1000})
+
+	require.Nil(t, CheckTokenLimits(c, tokenId, "gpt-4o", 1000))
+	apiErr := CheckTokenLimits(c, tokenId, "gpt-4o", 1001)
+	require.NotNil(t, apiErr)
+	require.Equal(t, types.ErrorCodeTokenRequestCostExceeded, apiErr.GetErrorCode())
+	require.Equal(t, 403, apiErr.StatusCode)
+}
+
+func TestCheckTokenLimitsRejectedRequestKeepsRpm(t *testing.T) {
+	const tokenId = 900006
+	limits := model.TokenLimits{
+		Rpm: 1,
+		ModelQuotas: map[string]model.TokenQuotaWindows{
+			"gpt-4o": {DailyQuota: 100},
+		},
+	}
+
+	// 超出子预算被拒绝的请求不占用每分钟请求数
+	apiErr := CheckTokenLimits(newTokenLimitTestContext(limits), tokenId, "gpt-4o", 500)
+	require.NotNil(t, apiErr)
+	require.Equal(t, types.ErrorCodeTokenSpendLimitExceeded, apiErr.GetErrorCode())
+
+	require.Nil(t, CheckTokenLimits(newTokenLimitTestContext(limits), tokenId, "gpt-4o", 50))
+
+	// 超出每分钟请求数被拒绝的请求同样不保留消费窗口中的预留
+	apiErr = CheckTokenLimits(newTokenLimitTestContext(limits), tokenId, "gpt-4o", 40)
+	require.NotNil(t, apiErr)
+	require.Equal(t, types.ErrorCodeTokenRateLimitExceeded, apiErr.GetErrorCode())
+	used, err := tokenSpendCounter.Incr(tokenSpendWindows(limits, "gpt-4o", time.Now())[0].key(tokenId), 0, time.Now().Add(time.Hour))
+	require.NoError(t, err)
+	require.EqualValues(t, 50, used)
+}
+
+func TestTokenSpendCounterPersistsWithoutRedis(t *testing.T) {
+	const tokenId = 900007
+	limits := model.TokenLimits{
+		TokenQuotaWindows: model.TokenQuotaWindows{DailyQuota: 1000},
+	}
+	require.Nil(t, CheckTokenLimits(newTokenLimitTestContext(limits), tokenId, "gpt-4o", 600))
+
+	// 计数保存在数据库中，新的进程（或其他节点）看到同样的已用额度
+	restarted := &windowCounter{persistent: true, values: make(map[string]windowCounterValue)}
+	window := tokenSpendWindows(limits, "gpt-4o", time.Now())[0]
+	used, err := restarted.Incr(window.key(tokenId), 0, window.Reset)
+	require.NoError(t, err)
+	require.EqualValues(t, 600, used)
+	require.NotNil(t, CheckTokenLimits(newTokenLimitTestContext(limits), tokenId, "gpt-4o", 600))
+}
+
+// failingSettleBilling 结算总是失败的计费会话
+type failingSettleBilling struct{}
+
+func (failingSettleBilling) Settle(int) error         { return errors.New("settle failed") }
+func (failingSettleBilling) Refund(*gin.Context)      {}
+func (failingSettleBilling) NeedsRefund() bool        { return true }
+func (failingSettleBilling) GetPreConsumedQuota() int { return 800 }
+func (failingSettleBilling) Reserve(int) error        { return nil }
+
+func TestSettleBillingFailureReconcilesReservation(t *testing.T) {
+	const tokenId = 900008
+	limits := model.TokenLimits{
+		TokenQuotaWindows: model.TokenQuotaWindows{DailyQuota: 1000},
+	}
+	c := newTokenLimitTestContext(limits)
+	c.Request = httptest.NewRequest("POST", "/v1/chat/completions", nil)
+	require.Nil(t, CheckTokenLimits(c, tokenId, "gpt-4o", 800))
+
+	info := &relaycommon.RelayInfo{TokenId: tokenId, OriginModelName: "gpt-4o", Billing: failingSettleBilling{}}
+	require.Error(t, SettleBilling(c, info, 100))
+
+	// 预留按实际消耗修正为 100，不再占用 800
+	require.Nil(t, CheckTokenLimits(newTokenLimitTestContext(limits), tokenId, "gpt-4o", 850))
+}
@@ -21,6 +21,7 @@ func InitTokenEncoders() {
 	common.SysLog("initializing token encoders")
 	defaultTokenEncoder = codec.NewCl100kBase()
 	common.SysLog("token encoders initialized")
+	go loadVocabTokenizers()
 }
 
 func getTokenEncoder(model string) tokenizer.Codec {
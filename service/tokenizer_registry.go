@@ -0,0 +1,123 @@
+package service
+
+import (
+	"math"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/QuantumNous/new-api/common"
+	hftokenizer "github.com/QuantumNous/new-api/pkg/hf_tokenizer"
+	"github.com/QuantumNous/new-api/setting/model_setting"
+	"github.com/tiktoken-go/tokenizer"
+)
+
+// TextTokenizer 本地 token 计数器
+type TextTokenizer interface {
+	Name() string
+	Count(text string) int
+}
+
+var (
+	tokenizerRegistry     = make(map[string]TextTokenizer)
+	tokenizerRegistryLock sync.RWMutex
+)
+
+// RegisterTokenizer 注册分词器，同名时覆盖。模型通过 model_setting 中的关键词映射到分词器名称
+func RegisterTokenizer(t TextTokenizer) {
+	tokenizerRegistryLock.Lock()
+	defer tokenizerRegistryLock.Unlock()
+	tokenizerRegistry[t.Name()] = t
+}
+
+func getRegisteredTokenizer(name string) (TextTokenizer, bool) {
+	tokenizerRegistryLock.RLock()
+	defer tokenizerRegistryLock.RUnlock()
+	t, ok := tokenizerRegistry[name]
+	return t, ok
+}
+
+// estimatorTokenizer 闭源模型没有公开词表，使用 EstimateToken 的厂商字符权重估算，
+// 再乘以模型系列的校准系数（见 model_setting 的 estimator_factors）
+type estimatorTokenizer struct {
+	provider Provider
+	factor   float64
+}
+
+func (e estimatorTokenizer) Name() string {
+	return "estimate-" + string(e.provider)
+}
+
+func (e estimatorTokenizer) Count(text string) int {
+	if text == "" {
+		return 0
+	}
+	count := EstimateToken(e.provider, text)
+	if e.factor > 0 && e.factor != 1 {
+		count = int(math.Ceil(float64(count) * e.factor))
+	}
+	return count
+}
+
+// tiktokenTokenizer OpenAI 模型使用的 tiktoken 编码
+type tiktokenTokenizer struct {
+	codec tokenizer.Codec
+}
+
+func (t tiktokenTokenizer) Name() string {
+	return "tiktoken-" + t.codec.GetName()
+}
+
+func (t tiktokenTokenizer) Count(text string) int {
+	return getTokenNum(t.codec, text)
+}
+
+func init() {
+	for _, provider := range []Provider{OpenAI, Claude, Gemini} {
+		RegisterTokenizer(estimatorTokenizer{provider: provider})
+	}
+}
+
+// GetTokenizerForModel 返回模型使用的分词器：优先使用配置映射且已加载的分词器，
+// 其次 OpenAI 模型使用 tiktoken，其余模型按厂商估算并乘以模型系列的校准系数
+func GetTokenizerForModel(model string) TextTokenizer {
+	if name := model_setting.GetModelTokenizerName(model); name != "" {
+		if t, ok := getRegisteredTokenizer(name); ok {
+			return t
+		}
+	}
+	if common.IsOpenAITextModel(model) {
+		return tiktokenTokenizer{codec: getTokenEncoder(model)}
+	}
+	// 非openai模型，使用tiktoken-go计算没有意义，使用估算节省资源
+	factor := model_setting.GetModelEstimatorFactor(model)
+	lowerModel := strings.ToLower(model)
+	switch {
+	case strings.Contains(lowerModel, "gemini"):
+		return estimatorTokenizer{provider: Gemini, factor: factor}
+	case strings.Contains(lowerModel, "claude"):
+		return estimatorTokenizer{provider: Claude, factor: factor}
+	default:
+		return estimatorTokenizer{provider: OpenAI, factor: factor}
+	}
+}
+
+// loadVocabTokenizers 加载内置词表以及 TOKENIZER_VOCAB_DIR 目录下的词表，同名时目录中的词表覆盖内置词表。
+// 词表较大，在后台加载，加载完成前相关模型使用估算
+func loadVocabTokenizers() {
+	loaded, errs := hftokenizer.LoadEmbedded()
+	if dir := os.Getenv("TOKENIZER_VOCAB_DIR"); dir != "" {
+		fromDir, dirErrs := hftokenizer.LoadFS(os.DirFS(dir), ".")
+		errs = append(errs, dirErrs...)
+		for name, t := range fromDir {
+			loaded[name] = t
+		}
+	}
+	for _, err := range errs {
+		common.SysError("failed to load tokenizer vocab: " + err.Error())
+	}
+	for _, t := range loaded {
+		RegisterTokenizer(t)
+		common.SysLog("tokenizer loaded: " + t.Name())
+	}
+}
@@ -0,0 +1,99 @@
+package service
+
+import (
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/QuantumNous/new-api/setting/model_setting"
+	"github.com/stretchr/testify/require"
+)
+
+type fixedTokenizer struct {
+	name string
+}
+
+func (f fixedTokenizer) Name() string          { return f.name }
+func (f fixedTokenizer) Count(text string) int { return len(text) }
+
+func TestGetTokenizerForModel(t *testing.T) {
+	settings := model_setting.GetTokenizerSettings()
+	saved := settings.ModelTokenizers
+	settings.ModelTokenizers = map[string]string{
+		"qwen":   "test-qwen",
+		"qwen3":  "test-qwen3",
+		"llama3": "test-missing",
+	}
+	t.Cleanup(func() {
+		settings.ModelTokenizers = saved
+		tokenizerRegistryLock.Lock()
+		delete(tokenizerRegistry, "test-qwen")
+		delete(tokenizerRegistry, "test-qwen3")
+		tokenizerRegistryLock.Unlock()
+	})
+	RegisterTokenizer(fixedTokenizer{name: "test-qwen"})
+	RegisterTokenizer(fixedTokenizer{name: "test-qwen3"})
+
+	require.Equal(t, "test-qwen", GetTokenizerForModel("Qwen/Qwen2.5-72B-Instruct").Name())
+	// 最长关键词优先
+	require.Equal(t, "test-qwen3", GetTokenizerForModel("qwen3-235b-a22b").Name())
+	// 分词器未加载时回退到估算
+	require.Equal(t, "estimate-openai", GetTokenizerForModel("llama3-70b").Name())
+	require.Equal(t, "estimate-claude", GetTokenizerForModel("claude-sonnet-4").Name())
+	require.Equal(t, "estimate-gemini", GetTokenizerForModel("gemini-2.5-pro").Name())
+	require.Equal(t, 5, CountTextToken("hello", "qwen-max"))
+}
+
+func TestEstimatorFactor(t *testing.T) {
+	settings := model_setting.GetTokenizerSettings()
+	saved := settings.EstimatorFactors
+	settings.EstimatorFactors = map[string]float64{
+		"claude":          1,
+		"claude-opus-4-7": 1.5,
+		"gemini":          0.5,
+		"broken":          -1,
+	}
+	t.Cleanup(func() {
+		settings.EstimatorFactors = saved
+	})
+
+	text := "hello world, 你好世界"
+	claude := EstimateToken(Claude, text)
+	require.Equal(t, claude, GetTokenizerForModel("claude-sonnet-4").Count(text))
+	// 最长关键词优先
+	require.Equal(t, int(math.Ceil(float64(claude)*1.5)), GetTokenizerForModel("claude-opus-4-7").Count(text))
+	require.Equal(t, int(math.Ceil(float64(EstimateToken(Gemini, text))*0.5)), GetTokenizerForModel("gemini-2.5-pro").Count(text))
+	// 无效系数按 1 处理
+	require.Equal(t, EstimateToken(OpenAI, text), GetTokenizerForModel("broken-model").Count(text))
+}
+
+// TestDefaultEstimatorFactors 默认校准系数下的估算与真实词表计数的相对误差不超过各系列的上限。
+// 参考计数由 testdata/tokenizer_calibration 中的样本经对应词表计得：Gemini 使用 Gemma 词表，
+// Llama 与 DeepSeek 使用 llama.cpp 提供的词表（与 pkg/hf_tokenizer/vocab 相同的转换方式）
+func TestDefaultEstimatorFactors(t *testing.T) {
+	samples := make(map[string]string)
+	for _, name := range []string{"en", "zh", "code"} {
+		data, err := os.ReadFile(filepath.Join("testdata", "tokenizer_calibration", name+".txt"))
+		require.NoError(t, err)
+		samples[name] = string(data)
+	}
+
+	cases := []struct {
+		model     string
+		reference map[string]int
+		bound     float64
+	}{
+		{model: "gemini-2.5-pro", reference: map[string]int{"en": 331, "zh": 288, "code": 731}, bound: 0.11},
+		{model: "llama-3.3-70b-instruct", reference: map[string]int{"en": 322, "zh": 335, "code": 625}, bound: 0.15},
+		{model: "llama-2-70b-chat", reference: map[string]int{"en": 361, "zh": 585, "code": 917}, bound: 0.33},
+		{model: "deepseek-chat", reference: map[string]int{"en": 328, "zh": 279, "code": 733}, bound: 0.22},
+	}
+	for _, tc := range cases {
+		tk := GetTokenizerForModel(tc.model)
+		for name, want := range tc.reference {
+			got := tk.Count(samples[name])
+			require.LessOrEqual(t, math.Abs(float64(got-want))/float64(want), tc.bound, "%s %s: got %d, want %d", tc.model, name, got, want)
+		}
+	}
+}
@@ -23,7 +23,9 @@ func ResponseText2Usage(c *gin.Context, responseText string, modeName string, pr
 	common.SetContextKey(c, constant.ContextKeyLocalCountTokens, true)
 	usage := &dto.Usage{}
 	usage.PromptTokens = promptTokens
-	usage.CompletionTokens = EstimateTokenByModel(modeName, responseText)
+	textTokenizer := GetTokenizerForModel(modeName)
+	common.SetContextKey(c, constant.ContextKeyTokenizer, textTokenizer.Name())
+	usage.CompletionTokens = textTokenizer.Count(responseText)
 	usage.TotalTokens = usage.PromptTokens + usage.CompletionTokens
 	return usage
 }
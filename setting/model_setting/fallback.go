@@ -0,0 +1,59 @@
+package model_setting
+
+import (
+	"strings"
+
+	"github.com/QuantumNous/new-api/setting/config"
+)
+
+// ModelFallbackSettings 跨模型回退配置：某个模型的所有渠道都失败后，依次改用配置的备选模型，
+// 按实际提供服务的模型计费
+type ModelFallbackSettings struct {
+	Enabled bool                `json:"enabled"`
+	Chains  map[string][]string `json:"chains"` // 模型 -> 按顺序尝试的备选模型，支持 "claude-*" 形式的前缀匹配
+}
+
+// 默认配置
+var modelFallbackSettings = ModelFallbackSettings{
+	Enabled: false,
+	Chains:  map[string][]string{},
+}
+
+func init() {
+	// 注册到全局配置管理器
+	config.GlobalConfig.Register("model_fallback", &modelFallbackSettings)
+}
+
+func GetModelFallbackSettings() *ModelFallbackSettings {
+	return &modelFallbackSettings
+}
+
+// GetModelFallbackChain 返回模型的备选模型列表：精确匹配优先，其次是最长前缀匹配，
+// 结果中去掉重复项与模型自身
+func GetModelFallbackChain(model string) []string {
+	if !modelFallbackSettings.Enabled || model == "" {
+		return nil
+	}
+	chain, ok := modelFallbackSettings.Chains[model]
+	if !ok {
+		longest := -1
+		for pattern, models := range modelFallbackSettings.Chains {
+			prefix, isPrefix := strings.CutSuffix(pattern, "*")
+			if isPrefix && strings.HasPrefix(model, prefix) && len(prefix) > longest {
+				longest = len(prefix)
+				chain = models
+			}
+		}
+	}
+	result := make([]string, 0, len(chain))
+	seen := map[string]bool{model: true}
+	for _, fallback := range chain {
+		fallback = strings.TrimSpace(fallback)
+		if fallback == "" || seen[fallback] {
+			continue
+		}
+		seen[fallback] = true
+		result = append(result, fallback)
+	}
+	return result
+}
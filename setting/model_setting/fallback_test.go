@@ -0,0 +1,38 @@
+package model_setting
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestGetModelFallbackChain(t *testing.T) {
+	saved := modelFallbackSettings
+	t.Cleanup(func() { modelFallbackSettings = saved })
+
+	modelFallbackSettings = ModelFallbackSettings{
+		Enabled: true,
+		Chains: map[string][]string{
+			"claude-sonnet-4": {"gpt-4o", " gemini-2.5-pro ", "gpt-4o", "claude-sonnet-4"},
+			"claude-*":        {"gpt-4o-mini"},
+			"claude-opus-*":   {"gpt-4.1"},
+		},
+	}
+
+	cases := map[string][]string{
+		"claude-sonnet-4":   {"gpt-4o", "gemini-2.5-pro"},
+		"claude-haiku-3":    {"gpt-4o-mini"},
+		"claude-opus-4-1":   {"gpt-4.1"},
+		"gpt-4o":            {},
+		"claude-sonnet-4-x": {"gpt-4o-mini"},
+	}
+	for model, expected := range cases {
+		if got := GetModelFallbackChain(model); !slices.Equal(got, expected) {
+			t.Fatalf("fallback chain of %s: expected %v, got %v", model, expected, got)
+		}
+	}
+
+	modelFallbackSettings.Enabled = false
+	if got := GetModelFallbackChain("claude-sonnet-4"); len(got) != 0 {
+		t.Fatalf("expected no fallback when disabled, got %v", got)
+	}
+}
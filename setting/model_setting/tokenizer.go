@@ -0,0 +1,87 @@
+package model_setting
+
+import (
+	"strings"
+
+	"github.com/QuantumNous/new-api/setting/config"
+)
+
+// TokenizerSettings 本地 token 计数使用的分词器配置
+type TokenizerSettings struct {
+	// ModelTokenizers 模型关键词 -> 分词器名称，按模型名是否包含关键词匹配（不区分大小写），
+	// 多个关键词同时命中时取最长的关键词；分词器词表未加载时回退到内置估算
+	ModelTokenizers map[string]string `json:"model_tokenizers"`
+	// EstimatorFactors 模型关键词 -> 估算校准系数，只作用于没有词表、按厂商字符权重估算的模型，
+	// 匹配规则与 ModelTokenizers 相同，未命中时系数为 1
+	EstimatorFactors map[string]float64 `json:"estimator_factors"`
+}
+
+// 默认配置。qwen 对应内置词表（pkg/hf_tokenizer/vocab），llama3、llama2 与 deepseek 的词表需要放入 TOKENIZER_VOCAB_DIR。
+// 校准系数用 service/testdata/tokenizer_calibration 中的中英文与代码样本，按各系列真实词表（Gemini 使用同源的 Gemma 词表）
+// 的计数取使最大相对误差最小的值，误差上限见 TestDefaultEstimatorFactors；Claude 没有公开词表，不设默认系数
+var defaultTokenizerSettings = TokenizerSettings{
+	ModelTokenizers: map[string]string{
+		"qwen":     "qwen",
+		"qwq":      "qwen",
+		"deepseek": "deepseek",
+		"llama-3":  "llama3",
+		"llama3":   "llama3",
+		"llama-2":  "llama2",
+		"llama2":   "llama2",
+	},
+	EstimatorFactors: map[string]float64{
+		"gemini":   0.89,
+		"llama":    0.85,
+		"llama-2":  1.10,
+		"llama2":   1.10,
+		"deepseek": 0.92,
+	},
+}
+
+// 全局实例
+var tokenizerSettings = defaultTokenizerSettings
+
+func init() {
+	// 注册到全局配置管理器
+	config.GlobalConfig.Register("tokenizer", &tokenizerSettings)
+}
+
+// GetTokenizerSettings 获取分词器配置
+func GetTokenizerSettings() *TokenizerSettings {
+	return &tokenizerSettings
+}
+
+// GetModelTokenizerName 返回模型配置的分词器名称，未配置时返回空字符串
+func GetModelTokenizerName(model string) string {
+	name, _ := matchModelKeyword(model, tokenizerSettings.ModelTokenizers)
+	return name
+}
+
+// GetModelEstimatorFactor 返回模型的估算校准系数，未配置或配置无效时返回 1
+func GetModelEstimatorFactor(model string) float64 {
+	factor, ok := matchModelKeyword(model, tokenizerSettings.EstimatorFactors)
+	if !ok || factor <= 0 {
+		return 1
+	}
+	return factor
+}
+
+// matchModelKeyword 按模型名是否包含关键词匹配（不区分大小写），多个关键词同时命中时取最长的关键词
+func matchModelKeyword[T any](model string, values map[string]T) (T, bool) {
+	model = strings.ToLower(model)
+	var value T
+	matched := ""
+	found := false
+	for keyword, v := range values {
+		keyword = strings.ToLower(keyword)
+		if keyword == "" || !strings.Contains(model, keyword) {
+			continue
+		}
+		if !found || len(keyword) > len(matched) || (len(keyword) == len(matched) && keyword < matched) {
+			matched = keyword
+			value = v
+			found = true
+		}
+	}
+	return value, found
+}
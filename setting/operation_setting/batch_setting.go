@@ -0,0 +1,40 @@
+package operation_setting
+
+import "github.com/QuantumNous/new-api/setting/config"
+
+// BatchSetting /v1/batches 批处理接口相关配置
+type BatchSetting struct {
+	Enabled             bool    `json:"enabled"`                // 是否启用批处理接口
+	DiscountRatio       float64 `json:"discount_ratio"`         // 批处理计费折扣倍率，叠加在分组倍率上
+	ForwardUpstream     bool    `json:"forward_upstream"`       // 是否优先转发到支持 batch 的上游渠道，否则在本地逐条执行
+	Concurrency         int     `json:"concurrency"`            // 本地执行时的并发数
+	MaxRequestsPerBatch int     `json:"max_requests_per_batch"` // 单个批处理最多请求数
+}
+
+// 默认配置
+var batchSetting = BatchSetting{
+	Enabled:             true,
+	DiscountRatio:       0.5,
+	ForwardUpstream:     false,
+	Concurrency:         2,
+	MaxRequestsPerBatch: 50000,
+}
+
+func init() {
+	// 注册到全局配置管理器
+	config.GlobalConfig.Register("batch_setting", &batchSetting)
+}
+
+// GetBatchSetting 获取批处理配置
+func GetBatchSetting() *BatchSetting {
+	return &batchSetting
+}
+
+// GetBatchDiscountRatio 获取批处理折扣倍率，非法值按不打折处理
+func GetBatchDiscountRatio() float64 {
+	ratio := batchSetting.DiscountRatio
+	if ratio < 0 {
+		return 1
+	}
+	return ratio
+}
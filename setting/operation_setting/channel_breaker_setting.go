@@ -0,0 +1,40 @@
+package operation_setting
+
+import "github.com/QuantumNous/new-api/setting/config"
+
+// ChannelBreakerSetting 渠道熔断配置，熔断按（渠道, 模型, 多 Key 下标）独立统计，
+// 某个模型在某个渠道上连续失败或失败率过高时只摘除该组合，不影响渠道上的其他模型
+type ChannelBreakerSetting struct {
+	Enabled             bool    `json:"enabled"`
+	ConsecutiveFailures int     `json:"consecutive_failures"`   // 连续失败达到该次数时熔断，0 表示不按连续失败熔断
+	ErrorRateThreshold  float64 `json:"error_rate_threshold"`   // 统计窗口内失败率达到该值时熔断（0-1），0 表示不按失败率熔断
+	MinRequests         int     `json:"min_requests"`           // 统计窗口内至少有这么多次请求才按失败率判断
+	WindowSeconds       int     `json:"window_seconds"`         // 失败率统计窗口
+	OpenSeconds         int     `json:"open_seconds"`           // 熔断持续时间，到期后进入半开状态，放行少量真实请求试探
+	HalfOpenMaxRequests int     `json:"half_open_max_requests"` // 半开状态下单节点同时放行的试探请求数
+	HalfOpenSuccesses   int     `json:"half_open_successes"`    // 半开状态下连续成功这么多次后恢复
+	KeepAutoBan         bool    `json:"keep_auto_ban"`          // 开启熔断后是否仍按状态码、关键词自动禁用整个渠道
+}
+
+// 默认配置
+var channelBreakerSetting = ChannelBreakerSetting{
+	Enabled:             false,
+	ConsecutiveFailures: 5,
+	ErrorRateThreshold:  0.5,
+	MinRequests:         20,
+	WindowSeconds:       60,
+	OpenSeconds:         30,
+	HalfOpenMaxRequests: 1,
+	HalfOpenSuccesses:   2,
+	KeepAutoBan:         false,
+}
+
+func init() {
+	// 注册到全局配置管理器
+	config.GlobalConfig.Register("channel_breaker_setting", &channelBreakerSetting)
+}
+
+// GetChannelBreakerSetting 获取渠道熔断配置
+func GetChannelBreakerSetting() *ChannelBreakerSetting {
+	return &channelBreakerSetting
+}
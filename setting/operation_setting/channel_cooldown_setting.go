@@ -0,0 +1,36 @@
+package operation_setting
+
+import "github.com/QuantumNous/new-api/setting/config"
+
+// ChannelCooldownSetting 上游限流冷却配置，根据上游返回的 Retry-After、x-ratelimit-*、anthropic-ratelimit-* 响应头
+// 让渠道（多 Key 渠道为单个 Key）暂时退出轮询，到期后自动恢复
+type ChannelCooldownSetting struct {
+	Enabled                bool    `json:"enabled"`
+	DefaultCooldownSeconds int     `json:"default_cooldown_seconds"` // 上游返回 429 但没有给出恢复时间时的冷却时长
+	MaxCooldownSeconds     int     `json:"max_cooldown_seconds"`     // 单次冷却的上限，避免异常的响应头让渠道长时间不可用
+	ProactiveEnabled       bool    `json:"proactive_enabled"`        // 请求成功但剩余额度过低时提前冷却，把流量引向其他渠道
+	LowRemainingRatio      float64 `json:"low_remaining_ratio"`      // 剩余额度占总额度的比例不超过该值时视为额度过低（0-1）
+	ProactiveMaxSeconds    int     `json:"proactive_max_seconds"`    // 提前冷却的上限，通常应比 429 冷却更短
+	KeepAutoBan            bool    `json:"keep_auto_ban"`            // 开启冷却后 429 是否仍按状态码自动禁用整个渠道
+}
+
+// 默认配置
+var channelCooldownSetting = ChannelCooldownSetting{
+	Enabled:                false,
+	DefaultCooldownSeconds: 10,
+	MaxCooldownSeconds:     300,
+	ProactiveEnabled:       true,
+	LowRemainingRatio:      0.05,
+	ProactiveMaxSeconds:    60,
+	KeepAutoBan:            false,
+}
+
+func init() {
+	// 注册到全局配置管理器
+	config.GlobalConfig.Register("channel_cooldown_setting", &channelCooldownSetting)
+}
+
+// GetChannelCooldownSetting 获取上游限流冷却配置
+func GetChannelCooldownSetting() *ChannelCooldownSetting {
+	return &channelCooldownSetting
+}
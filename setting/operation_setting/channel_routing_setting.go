@@ -0,0 +1,86 @@
+package operation_setting
+
+import (
+	"strings"
+
+	"github.com/QuantumNous/new-api/setting/config"
+)
+
+// 渠道路由策略，作用于同一优先级内的候选渠道
+const (
+	ChannelRoutingWeightedRandom     = "weighted_random"      // 按权重随机（默认）
+	ChannelRoutingLowestLatency      = "lowest_latency"       // 最近窗口内成功请求的平均延迟最低，流式请求比较首字时间
+	ChannelRoutingHighestSuccessRate = "highest_success_rate" // 最近窗口内成功率最高
+	ChannelRoutingLowestCost         = "lowest_cost"          // 渠道价格倍率最低
+	ChannelRoutingLeastInFlight      = "least_in_flight"      // 本节点当前并发请求数最少
+)
+
+// ChannelRoutingSetting 渠道路由策略配置，模型策略优先于分组策略，均未命中时使用默认策略
+type ChannelRoutingSetting struct {
+	DefaultStrategy string            `json:"default_strategy"`
+	GroupStrategies map[string]string `json:"group_strategies"` // 分组 -> 策略
+	ModelStrategies map[string]string `json:"model_strategies"` // 模型 -> 策略，支持 "gpt-4o*" 形式的前缀匹配
+	WindowSeconds   int               `json:"window_seconds"`   // 延迟、成功率的统计窗口
+	MinSamples      int               `json:"min_samples"`      // 渠道在窗口内至少有这么多次请求才参与延迟、成功率比较
+	ExplorePercent  int               `json:"explore_percent"`  // 部分渠道样本不足时，按该比例回退到加权随机，让这些渠道积累样本
+	MinSuccessRate  float64           `json:"min_success_rate"` // 按延迟选择时，成功率低于该值的渠道排在所有达标渠道之后
+}
+
+// 默认配置
+var channelRoutingSetting = ChannelRoutingSetting{
+	DefaultStrategy: ChannelRoutingWeightedRandom,
+	GroupStrategies: map[string]string{},
+	ModelStrategies: map[string]string{},
+	WindowSeconds:   300,
+	MinSamples:      10,
+	ExplorePercent:  10,
+	MinSuccessRate:  0.8,
+}
+
+func init() {
+	// 注册到全局配置管理器
+	config.GlobalConfig.Register("channel_routing_setting", &channelRoutingSetting)
+}
+
+// GetChannelRoutingSetting 获取渠道路由策略配置
+func GetChannelRoutingSetting() *ChannelRoutingSetting {
+	return &channelRoutingSetting
+}
+
+// IsValidChannelRoutingStrategy 判断是否为支持的路由策略
+func IsValidChannelRoutingStrategy(strategy string) bool {
+	switch strategy {
+	case ChannelRoutingWeightedRandom, ChannelRoutingLowestLatency, ChannelRoutingHighestSuccessRate,
+		ChannelRoutingLowestCost, ChannelRoutingLeastInFlight:
+		return true
+	}
+	return false
+}
+
+// GetChannelRoutingStrategy 返回分组与模型对应的路由策略：模型精确匹配、最长前缀匹配、分组、默认策略依次生效，
+// 未知的策略按加权随机处理
+func GetChannelRoutingStrategy(group string, model string) string {
+	strategy := ""
+	if s, ok := channelRoutingSetting.ModelStrategies[model]; ok {
+		strategy = s
+	} else {
+		longest := -1
+		for pattern, s := range channelRoutingSetting.ModelStrategies {
+			prefix, ok := strings.CutSuffix(pattern, "*")
+			if ok && strings.HasPrefix(model, prefix) && len(prefix) > longest {
+				longest = len(prefix)
+				strategy = s
+			}
+		}
+	}
+	if strategy == "" {
+		strategy = channelRoutingSetting.GroupStrategies[group]
+	}
+	if strategy == "" {
+		strategy = channelRoutingSetting.DefaultStrategy
+	}
+	if !IsValidChannelRoutingStrategy(strategy) {
+		return ChannelRoutingWeightedRandom
+	}
+	return strategy
+}
@@ -0,0 +1,63 @@
+package operation_setting
+
+import (
+	"github.com/QuantumNous/new-api/setting"
+	"github.com/QuantumNous/new-api/setting/config"
+)
+
+// CompletionSensitivePolicy 分组的输出敏感词策略，配置后完全覆盖该分组的全局开关与默认动作
+type CompletionSensitivePolicy struct {
+	Enabled    bool     `json:"enabled"`
+	Action     string   `json:"action"`      // mask / truncate / abort，为空时使用默认动作
+	ExtraWords []string `json:"extra_words"` // 在全局敏感词之外追加的词
+}
+
+// CompletionSensitiveSetting 输出敏感词检查配置，全局开关为 CheckSensitiveOnCompletionEnabled，敏感词与提示词检查共用
+type CompletionSensitiveSetting struct {
+	Action        string                               `json:"action"`         // 默认动作，为空时按"检测到敏感词时停止生成"选择 truncate 或 mask
+	Mask          string                               `json:"mask"`           // mask 动作的替换文本
+	GroupPolicies map[string]CompletionSensitivePolicy `json:"group_policies"` // 按分组覆盖
+}
+
+// 默认配置
+var completionSensitiveSetting = CompletionSensitiveSetting{
+	Action:        "",
+	Mask:          "**###**",
+	GroupPolicies: map[string]CompletionSensitivePolicy{},
+}
+
+func init() {
+	// 注册到全局配置管理器
+	config.GlobalConfig.Register("completion_sensitive_setting", &completionSensitiveSetting)
+}
+
+// GetCompletionSensitiveSetting 获取输出敏感词检查配置
+func GetCompletionSensitiveSetting() *CompletionSensitiveSetting {
+	return &completionSensitiveSetting
+}
+
+// ResolveCompletionSensitivePolicy 返回分组生效的输出敏感词策略：动作与敏感词，未开启时返回 false
+func ResolveCompletionSensitivePolicy(group string) (action string, words []string, ok bool) {
+	action = completionSensitiveSetting.Action
+	if action == "" {
+		action = "mask"
+		if setting.StopOnSensitiveEnabled {
+			action = "truncate"
+		}
+	}
+	words = setting.SensitiveWords
+	policy, found := completionSensitiveSetting.GroupPolicies[group]
+	if !found {
+		return action, words, setting.ShouldCheckCompletionSensitive() && len(words) > 0
+	}
+	if !policy.Enabled {
+		return "", nil, false
+	}
+	if policy.Action != "" {
+		action = policy.Action
+	}
+	if len(policy.ExtraWords) > 0 {
+		words = append(append(make([]string, 0, len(words)+len(policy.ExtraWords)), words...), policy.ExtraWords...)
+	}
+	return action, words, len(words) > 0
+}
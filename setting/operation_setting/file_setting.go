@@ -0,0 +1,57 @@
+package operation_setting
+
+import "github.com/QuantumNous/new-api/setting/config"
+
+// FileSetting /v1/files 文件接口相关配置
+type FileSetting struct {
+	Enabled         bool     `json:"enabled"`            // 是否启用文件接口
+	MaxFileSizeMB   int      `json:"max_file_size_mb"`   // 单个文件最大大小（MB）
+	MaxFilesPerUser int      `json:"max_files_per_user"` // 每用户最多保留的文件数量，0 表示不限制
+	ForwardUpstream bool     `json:"forward_upstream"`   // 上传时是否立即转发到上游渠道并固定；分组内没有支持文件接口的渠道时文件只保存在本站。关闭后文件只能用于批处理，模型请求中引用会被拒绝
+	RouteModel      string   `json:"route_model"`        // 选择上游渠道时使用的模型名
+	AllowedPurposes []string `json:"allowed_purposes"`   // 允许的 purpose，为空表示不限制
+}
+
+// 默认配置
+var fileSetting = FileSetting{
+	Enabled:         false,
+	MaxFileSizeMB:   512,
+	MaxFilesPerUser: 1000,
+	ForwardUpstream: true,
+	RouteModel:      "gpt-4o-mini",
+	AllowedPurposes: []string{"assistants", "batch", "fine-tune", "vision", "user_data", "evals"},
+}
+
+func init() {
+	// 注册到全局配置管理器
+	config.GlobalConfig.Register("file_setting", &fileSetting)
+}
+
+// GetFileSetting 获取文件接口配置
+func GetFileSetting() *FileSetting {
+	return &fileSetting
+}
+
+// GetMaxFileSizeBytes 获取单个文件最大字节数
+func (s *FileSetting) GetMaxFileSizeBytes() int64 {
+	if s.MaxFileSizeMB <= 0 {
+		return 512 << 20
+	}
+	return int64(s.MaxFileSizeMB) << 20
+}
+
+// IsPurposeAllowed 判断 purpose 是否允许上传
+func (s *FileSetting) IsPurposeAllowed(purpose string) bool {
+	if purpose == "" {
+		return false
+	}
+	if len(s.AllowedPurposes) == 0 {
+		return true
+	}
+	for _, p := range s.AllowedPurposes {
+		if p == purpose {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,75 @@
+package operation_setting
+
+import (
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/QuantumNous/new-api/setting/config"
+)
+
+// HedgeSetting 对冲请求配置：首个渠道在阈值内没有返回首字节时，向另一个渠道发出相同请求，
+// 先返回的一方继续输出，另一方被取消。需要按分组或模型单独启用
+type HedgeSetting struct {
+	Enabled        bool     `json:"enabled"`          // 总开关
+	EnabledGroups  []string `json:"enabled_groups"`   // 对这些分组下的请求启用
+	EnabledModels  []string `json:"enabled_models"`   // 对这些模型启用，支持 "gpt-4o*" 形式的前缀匹配
+	StreamOnly     bool     `json:"stream_only"`      // 仅对流式请求启用
+	ThresholdMs    int      `json:"threshold_ms"`     // 首字节等待阈值，超过后发出备用请求
+	TtftMultiplier float64  `json:"ttft_multiplier"`  // 大于 0 时按主渠道最近平均首字时间的倍数计算阈值，样本不足时使用 ThresholdMs
+	MinSamples     int      `json:"min_samples"`      // 主渠道在窗口内至少有这么多次首字时间样本才按倍数计算
+	WindowSeconds  int      `json:"window_seconds"`   // 首字时间统计窗口
+	MinThresholdMs int      `json:"min_threshold_ms"` // 按倍数计算时阈值的下限
+	MaxThresholdMs int      `json:"max_threshold_ms"` // 按倍数计算时阈值的上限，0 表示不限制
+}
+
+// 默认配置
+var hedgeSetting = HedgeSetting{
+	Enabled:        false,
+	EnabledGroups:  []string{},
+	EnabledModels:  []string{},
+	StreamOnly:     true,
+	ThresholdMs:    3000,
+	TtftMultiplier: 0,
+	MinSamples:     20,
+	WindowSeconds:  600,
+	MinThresholdMs: 500,
+	MaxThresholdMs: 10000,
+}
+
+func init() {
+	// 注册到全局配置管理器
+	config.GlobalConfig.Register("hedge_setting", &hedgeSetting)
+}
+
+// GetHedgeSetting 获取对冲请求配置
+func GetHedgeSetting() *HedgeSetting {
+	return &hedgeSetting
+}
+
+// IsHedgeEnabled 判断分组、模型是否启用了对冲请求，分组或模型任一命中即启用
+func IsHedgeEnabled(group string, model string) bool {
+	if !hedgeSetting.Enabled {
+		return false
+	}
+	if slices.Contains(hedgeSetting.EnabledGroups, group) {
+		return true
+	}
+	for _, pattern := range hedgeSetting.EnabledModels {
+		if pattern == model {
+			return true
+		}
+		if prefix, ok := strings.CutSuffix(pattern, "*"); ok && strings.HasPrefix(model, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// GetHedgeWindow 获取首字时间统计窗口
+func GetHedgeWindow() time.Duration {
+	if hedgeSetting.WindowSeconds <= 0 {
+		return 10 * time.Minute
+	}
+	return time.Duration(hedgeSetting.WindowSeconds) * time.Second
+}
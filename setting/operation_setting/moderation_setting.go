@@ -0,0 +1,62 @@
+package operation_setting
+
+import (
+	"slices"
+
+	"github.com/QuantumNous/new-api/setting/config"
+)
+
+const (
+	ModerationBackendOpenAI     = "openai"      // 渠道的 /v1/moderations 接口
+	ModerationBackendLlamaGuard = "llama_guard" // 通过渠道的 /v1/chat/completions 调用 Llama Guard 模型
+	ModerationBackendWebhook    = "webhook"     // 通用 HTTP 回调，响应格式与 OpenAI moderations 的单条结果相同
+)
+
+// ModerationSetting 转发前的提示词审核配置，审核不通过的请求直接拒绝，不会发往上游
+type ModerationSetting struct {
+	Enabled            bool               `json:"enabled"`
+	Backend            string             `json:"backend"`             // openai / llama_guard / webhook
+	ChannelId          int                `json:"channel_id"`          // openai / llama_guard 使用的渠道，请求使用渠道的地址与密钥
+	Model              string             `json:"model"`               // 审核模型，如 omni-moderation-latest、llama-guard-3-8b
+	WebhookURL         string             `json:"webhook_url"`         // webhook 地址
+	WebhookToken       string             `json:"webhook_token"`       // 非空时以 Bearer 方式放在 Authorization 请求头中
+	Groups             []string           `json:"groups"`              // 启用审核的分组，为空表示所有分组
+	CategoryThresholds map[string]float64 `json:"category_thresholds"` // 类别分数达到阈值即拒绝，未配置的类别以审核服务的判定为准
+	FailOpen           bool               `json:"fail_open"`           // 审核服务出错或超时时放行请求，否则拒绝
+	TimeoutSeconds     int                `json:"timeout_seconds"`     // 单次审核调用的超时时间
+	MaxInputChars      int                `json:"max_input_chars"`     // 送审文本的最大字符数，超出部分截掉
+	CacheSeconds       int                `json:"cache_seconds"`       // 相同文本的审核结果缓存时间，0 表示不缓存
+	BillUser           bool               `json:"bill_user"`           // 按审核模型的价格向用户收取审核调用的费用，否则由平台承担
+}
+
+// 默认配置
+var moderationSetting = ModerationSetting{
+	Enabled:            false,
+	Backend:            ModerationBackendOpenAI,
+	Model:              "omni-moderation-latest",
+	Groups:             []string{},
+	CategoryThresholds: map[string]float64{},
+	FailOpen:           true,
+	TimeoutSeconds:     5,
+	MaxInputChars:      32000,
+	CacheSeconds:       600,
+	BillUser:           false,
+}
+
+func init() {
+	// 注册到全局配置管理器
+	config.GlobalConfig.Register("moderation_setting", &moderationSetting)
+}
+
+// GetModerationSetting 获取提示词审核配置
+func GetModerationSetting() *ModerationSetting {
+	return &moderationSetting
+}
+
+// ShouldModerateGroup 判断分组的请求是否需要在转发前审核
+func ShouldModerateGroup(group string) bool {
+	if !moderationSetting.Enabled {
+		return false
+	}
+	return len(moderationSetting.Groups) == 0 || slices.Contains(moderationSetting.Groups, group)
+}
@@ -0,0 +1,70 @@
+package operation_setting
+
+import (
+	"slices"
+
+	"github.com/QuantumNous/new-api/setting/config"
+)
+
+// PayloadRedactRule 管理员自定义的脱敏规则
+type PayloadRedactRule struct {
+	Name        string `json:"name"`
+	Pattern     string `json:"pattern"`     // 正则表达式
+	Replacement string `json:"replacement"` // 为空时替换为 [REDACTED:name]
+}
+
+// PayloadCaptureSetting 请求/响应体留存配置：只对指定的用户、令牌或渠道开启，保存前按规则脱敏，
+// 用于处理计费争议与问题排查
+type PayloadCaptureSetting struct {
+	Enabled          bool                `json:"enabled"`            // 总开关
+	UserIds          []int               `json:"user_ids"`           // 留存这些用户的请求
+	TokenIds         []int               `json:"token_ids"`          // 留存这些令牌的请求
+	ChannelIds       []int               `json:"channel_ids"`        // 留存最终由这些渠道处理的请求
+	MaxRequestBytes  int                 `json:"max_request_bytes"`  // 请求体保存上限，超过部分截断
+	MaxResponseBytes int                 `json:"max_response_bytes"` // 响应体保存上限，流式响应按重组后的内容计算
+	RedactBuiltin    bool                `json:"redact_builtin"`     // 使用内置规则脱敏：API Key、邮箱、手机号、身份证号、银行卡号
+	RedactRules      []PayloadRedactRule `json:"redact_rules"`       // 自定义脱敏规则，在内置规则之前匹配
+	RetentionDays    int                 `json:"retention_days"`     // 保留天数，由系统任务定期清理，0 表示不清理
+}
+
+// 默认配置
+var payloadCaptureSetting = PayloadCaptureSetting{
+	Enabled:          false,
+	UserIds:          []int{},
+	TokenIds:         []int{},
+	ChannelIds:       []int{},
+	MaxRequestBytes:  64 << 10,
+	MaxResponseBytes: 64 << 10,
+	RedactBuiltin:    true,
+	RedactRules:      []PayloadRedactRule{},
+	RetentionDays:    7,
+}
+
+func init() {
+	// 注册到全局配置管理器
+	config.GlobalConfig.Register("payload_capture_setting", &payloadCaptureSetting)
+}
+
+// GetPayloadCaptureSetting 获取请求/响应体留存配置
+func GetPayloadCaptureSetting() *PayloadCaptureSetting {
+	return &payloadCaptureSetting
+}
+
+// ShouldStartPayloadCapture 判断请求是否需要先行捕获请求/响应体：用户或令牌命中时一定保存；
+// 配置了渠道时渠道要到转发结束才能确定，也需要先捕获
+func ShouldStartPayloadCapture(userId int, tokenId int) bool {
+	if !payloadCaptureSetting.Enabled {
+		return false
+	}
+	return IsPayloadCaptureSubject(userId, tokenId) || len(payloadCaptureSetting.ChannelIds) > 0
+}
+
+// IsPayloadCaptureSubject 判断用户或令牌是否开启了留存
+func IsPayloadCaptureSubject(userId int, tokenId int) bool {
+	return slices.Contains(payloadCaptureSetting.UserIds, userId) || slices.Contains(payloadCaptureSetting.TokenIds, tokenId)
+}
+
+// IsPayloadCaptureChannel 判断渠道是否开启了留存
+func IsPayloadCaptureChannel(channelId int) bool {
+	return slices.Contains(payloadCaptureSetting.ChannelIds, channelId)
+}
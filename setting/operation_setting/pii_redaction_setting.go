@@ -0,0 +1,55 @@
+package operation_setting
+
+import (
+	"slices"
+
+	"github.com/QuantumNous/new-api/setting/config"
+)
+
+// PIIRedactionRule 管理员自定义的识别规则，命中的内容替换为以规则名命名的占位符
+type PIIRedactionRule struct {
+	Name    string `json:"name"`
+	Pattern string `json:"pattern"` // 正则表达式
+}
+
+// PIIRedactionSetting 提示词脱敏配置：转发前把提示词中的个人信息与密钥替换为占位符，
+// 可选在响应中把占位符还原为原值。分组与渠道任一命中即开启，都为空时对所有请求开启
+type PIIRedactionSetting struct {
+	Enabled     bool               `json:"enabled"`      // 总开关
+	Detectors   []string           `json:"detectors"`    // 启用的内置检测器：api_key、email、phone、id_card、bank_card，为空表示全部
+	CustomRules []PIIRedactionRule `json:"custom_rules"` // 自定义规则，在内置检测器之前匹配
+	Groups      []string           `json:"groups"`       // 对这些分组的请求脱敏
+	ChannelIds  []int              `json:"channel_ids"`  // 对发往这些渠道的请求脱敏
+	Restore     bool               `json:"restore"`      // 在响应（包括流式输出）中还原占位符
+}
+
+// 默认配置
+var piiRedactionSetting = PIIRedactionSetting{
+	Enabled:     false,
+	Detectors:   []string{},
+	CustomRules: []PIIRedactionRule{},
+	Groups:      []string{},
+	ChannelIds:  []int{},
+	Restore:     true,
+}
+
+func init() {
+	// 注册到全局配置管理器
+	config.GlobalConfig.Register("pii_redaction_setting", &piiRedactionSetting)
+}
+
+// GetPIIRedactionSetting 获取提示词脱敏配置
+func GetPIIRedactionSetting() *PIIRedactionSetting {
+	return &piiRedactionSetting
+}
+
+// ShouldRedactPII 判断发往渠道的分组请求是否需要脱敏
+func ShouldRedactPII(group string, channelId int) bool {
+	if !piiRedactionSetting.Enabled {
+		return false
+	}
+	if len(piiRedactionSetting.Groups) == 0 && len(piiRedactionSetting.ChannelIds) == 0 {
+		return true
+	}
+	return slices.Contains(piiRedactionSetting.Groups, group) || slices.Contains(piiRedactionSetting.ChannelIds, channelId)
+}
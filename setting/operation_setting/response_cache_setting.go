@@ -0,0 +1,53 @@
+package operation_setting
+
+import (
+	"slices"
+
+	"github.com/QuantumNous/new-api/setting/config"
+)
+
+// ResponseCacheSetting 对话补全响应缓存配置，相同请求在 TTL 内直接回放缓存的响应
+type ResponseCacheSetting struct {
+	Enabled           bool     `json:"enabled"`            // 总开关，开启后仍需令牌或分组单独启用
+	EnabledGroups     []string `json:"enabled_groups"`     // 对这些分组下的所有请求启用缓存
+	TTLSeconds        int      `json:"ttl_seconds"`        // 缓存有效期
+	MaxEntries        int      `json:"max_entries"`        // 未启用 Redis 时内存缓存的最大条目数
+	MaxBodyBytes      int      `json:"max_body_bytes"`     // 超过该大小的响应不缓存
+	OnlyDeterministic bool     `json:"only_deterministic"` // 仅缓存 temperature=0 的请求
+	HitBillingRatio   float64  `json:"hit_billing_ratio"`  // 命中缓存时的计费倍率，叠加在分组倍率上，可以为 0
+}
+
+// 默认配置
+var responseCacheSetting = ResponseCacheSetting{
+	Enabled:           false,
+	EnabledGroups:     []string{},
+	TTLSeconds:        3600,
+	MaxEntries:        10000,
+	MaxBodyBytes:      1 << 20,
+	OnlyDeterministic: true,
+	HitBillingRatio:   0,
+}
+
+func init() {
+	// 注册到全局配置管理器
+	config.GlobalConfig.Register("response_cache_setting", &responseCacheSetting)
+}
+
+// GetResponseCacheSetting 获取响应缓存配置
+func GetResponseCacheSetting() *ResponseCacheSetting {
+	return &responseCacheSetting
+}
+
+// IsResponseCacheGroupEnabled 判断分组是否整体启用了响应缓存
+func IsResponseCacheGroupEnabled(group string) bool {
+	return slices.Contains(responseCacheSetting.EnabledGroups, group)
+}
+
+// GetResponseCacheHitBillingRatio 获取命中缓存时的计费倍率，非法值按原价处理
+func GetResponseCacheHitBillingRatio() float64 {
+	ratio := responseCacheSetting.HitBillingRatio
+	if ratio < 0 {
+		return 1
+	}
+	return ratio
+}
@@ -0,0 +1,92 @@
+package operation_setting
+
+import (
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/QuantumNous/new-api/setting/config"
+)
+
+// ShadowTrafficRule 一条影子流量规则：按比例把命中的请求异步复制一份发往 ChannelId，
+// 影子请求的响应不会返回给客户端
+type ShadowTrafficRule struct {
+	ChannelId int      `json:"channel_id"` // 影子渠道，可以是未启用的渠道
+	Models    []string `json:"models"`     // 生效的模型，支持 "gpt-4o*" 形式的前缀匹配，为空表示所有模型
+	Groups    []string `json:"groups"`     // 生效的分组，为空表示所有分组
+	Percent   float64  `json:"percent"`    // 复制比例，0-100
+}
+
+// ShadowTrafficSetting 影子流量配置：用于在切换生产流量前评估新渠道，影子请求不扣用户额度，
+// 只计入影子渠道的已用额度，对比数据写入影子日志
+type ShadowTrafficSetting struct {
+	Enabled          bool                `json:"enabled"`           // 总开关
+	Rules            []ShadowTrafficRule `json:"rules"`             // 按顺序匹配，使用第一条命中的规则
+	CompareResponses bool                `json:"compare_responses"` // 计算两侧响应文本的相似度
+	TimeoutSeconds   int                 `json:"timeout_seconds"`   // 影子请求超时时间
+	MaxConcurrent    int                 `json:"max_concurrent"`    // 单个节点同时进行的影子请求上限，超过时不再复制
+	MaxCaptureBytes  int                 `json:"max_capture_bytes"` // 每一侧用于比较而保留的响应体上限
+	RetentionDays    int                 `json:"retention_days"`    // 影子日志保留天数，0 表示不清理
+}
+
+// 默认配置
+var shadowTrafficSetting = ShadowTrafficSetting{
+	Enabled:          false,
+	Rules:            []ShadowTrafficRule{},
+	CompareResponses: true,
+	TimeoutSeconds:   300,
+	MaxConcurrent:    20,
+	MaxCaptureBytes:  1 << 20,
+	RetentionDays:    30,
+}
+
+func init() {
+	// 注册到全局配置管理器
+	config.GlobalConfig.Register("shadow_traffic_setting", &shadowTrafficSetting)
+}
+
+// GetShadowTrafficSetting 获取影子流量配置
+func GetShadowTrafficSetting() *ShadowTrafficSetting {
+	return &shadowTrafficSetting
+}
+
+// MatchShadowTrafficRule 返回分组、模型命中的第一条影子流量规则，未启用或未命中时返回 nil
+func MatchShadowTrafficRule(group string, model string) *ShadowTrafficRule {
+	if !shadowTrafficSetting.Enabled {
+		return nil
+	}
+	for i := range shadowTrafficSetting.Rules {
+		rule := &shadowTrafficSetting.Rules[i]
+		if rule.ChannelId <= 0 || rule.Percent <= 0 {
+			continue
+		}
+		if len(rule.Groups) > 0 && !slices.Contains(rule.Groups, group) {
+			continue
+		}
+		if len(rule.Models) > 0 && !matchShadowModel(rule.Models, model) {
+			continue
+		}
+		return rule
+	}
+	return nil
+}
+
+func matchShadowModel(patterns []string, model string) bool {
+	for _, pattern := range patterns {
+		if pattern == model {
+			return true
+		}
+		if prefix, ok := strings.CutSuffix(pattern, "*"); ok && strings.HasPrefix(model, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// GetShadowTrafficTimeout 获取影子请求超时时间
+func GetShadowTrafficTimeout() time.Duration {
+	if shadowTrafficSetting.TimeoutSeconds <= 0 {
+		return 5 * time.Minute
+	}
+	return time.Duration(shadowTrafficSetting.TimeoutSeconds) * time.Second
+}
@@ -40,6 +40,8 @@ type ErrorCode string
 const (
 	ErrorCodeInvalidRequest         ErrorCode = "invalid_request"
 	ErrorCodeSensitiveWordsDetected ErrorCode = "sensitive_words_detected"
+	ErrorCodePromptFlagged          ErrorCode = "prompt_flagged"
+	ErrorCodeModerationUnavailable  ErrorCode = "moderation_unavailable"
 	ErrorCodeViolationFeeGrokCSAM   ErrorCode = "violation_fee.grok.csam"
 
 	// new api error
@@ -85,6 +87,9 @@ const (
 	// quota error
 	ErrorCodeInsufficientUserQuota      ErrorCode = "insufficient_user_quota"
 	ErrorCodePreConsumeTokenQuotaFailed ErrorCode = "pre_consume_token_quota_failed"
+	ErrorCodeTokenSpendLimitExceeded    ErrorCode = "token_spend_limit_exceeded"
+	ErrorCodeTokenRateLimitExceeded     ErrorCode = "token_rate_limit_exceeded"
+	ErrorCodeTokenRequestCostExceeded   ErrorCode = "token_request_cost_exceeded"
 )
 
 type NewAPIError struct {
@@ -21,6 +21,7 @@ import React, { useContext, useEffect, useMemo, useRef, useState } from 'react';
 import { Link, useNavigate } from 'react-router-dom';
 import {
   API,
+  copy,
   getLogo,
   showError,
   showInfo,
@@ -40,6 +41,7 @@ import {
   Divider,
   Form,
   Icon,
+  Input,
   Modal,
 } from '@douyinfe/semi-ui';
 import Title from '@douyinfe/semi-ui/lib/es/typography/title';
@@ -239,10 +241,35 @@ const RegisterForm = () => {
           `/api/user/register?turnstile=${turnstileToken}`,
           inputs,
         );
-        const { success, message } = res.data;
+        const { success, message, data } = res.data;
         if (success) {
-          navigate('/login');
           showSuccess('注册成功！');
+          if (data?.token_key) {
+            // 默认令牌的完整密钥只在注册时返回一次
+            const tokenKey = `sk-${data.token_key}`;
+            Modal.info({
+              title: t('默认令牌已创建'),
+              content: (
+                <div>
+                  <Text type='tertiary'>
+                    {t('请立即复制保存，完整密钥只显示一次，遗失后无法找回')}
+                  </Text>
+                  <Input readOnly value={tokenKey} style={{ marginTop: 12 }} />
+                </div>
+              ),
+              okText: t('复制并继续'),
+              maskClosable: false,
+              onOk: async () => {
+                if (await copy(tokenKey)) {
+                  showSuccess(t('已复制到剪贴板！'));
+                }
+                navigate('/login');
+              },
+              onCancel: () => navigate('/login'),
+            });
+          } else {
+            navigate('/login');
+          }
         } else {
           showError(message);
         }
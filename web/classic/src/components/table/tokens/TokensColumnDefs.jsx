@@ -123,14 +123,12 @@ const renderTokenKey = (
   record,
   showKeys,
   resolvedTokenKeys,
-  loadingTokenKeys,
   toggleTokenVisibility,
   copyTokenKey,
   copyTokenConnectionString,
   t,
 ) => {
   const revealed = !!showKeys[record.id];
-  const loading = !!loadingTokenKeys[record.id];
   const keyValue =
     revealed && resolvedTokenKeys[record.id]
       ? resolvedTokenKeys[record.id]
@@ -150,7 +148,6 @@ const renderTokenKey = (
               size='small'
               type='tertiary'
               icon={revealed ? <IconEyeClosed /> : <IconEyeOpened />}
-              loading={loading}
               aria-label='toggle token visibility'
               onClick={async (e) => {
                 e.stopPropagation();
@@ -179,7 +176,6 @@ const renderTokenKey = (
                 size='small'
                 type='tertiary'
                 icon={<IconCopy />}
-                loading={loading}
                 aria-label='copy token key'
                 onClick={async (e) => {
                   e.stopPropagation();
@@ -470,7 +466,6 @@ export const getTokensColumns = ({
   t,
   showKeys,
   resolvedTokenKeys,
-  loadingTokenKeys,
   toggleTokenVisibility,
   copyTokenKey,
   copyTokenConnectionString,
@@ -512,7 +507,6 @@ export const getTokensColumns = ({
           record,
           showKeys,
           resolvedTokenKeys,
-          loadingTokenKeys,
           toggleTokenVisibility,
           copyTokenKey,
           copyTokenConnectionString,
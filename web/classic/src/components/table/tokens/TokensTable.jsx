@@ -40,7 +40,6 @@ const TokensTable = (tokensData) => {
     handleRow,
     showKeys,
     resolvedTokenKeys,
-    loadingTokenKeys,
     toggleTokenVisibility,
     copyTokenKey,
     copyTokenConnectionString,
@@ -59,7 +58,6 @@ const TokensTable = (tokensData) => {
       t,
       showKeys,
       resolvedTokenKeys,
-      loadingTokenKeys,
       toggleTokenVisibility,
       copyTokenKey,
       copyTokenConnectionString,
@@ -74,7 +72,6 @@ const TokensTable = (tokensData) => {
     t,
     showKeys,
     resolvedTokenKeys,
-    loadingTokenKeys,
     toggleTokenVisibility,
     copyTokenKey,
     copyTokenConnectionString,
@@ -114,7 +111,6 @@ const TokensTable = (tokensData) => {
         onPageChange: handlePageChange,
       }}
       hidePagination={true}
-      loading={loading}
       rowSelection={rowSelection}
       onRow={handleRow}
       empty={
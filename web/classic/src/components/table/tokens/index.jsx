@@ -39,6 +39,7 @@ import TokensFilters from './TokensFilters';
 import TokensDescription from './TokensDescription';
 import EditTokenModal from './modals/EditTokenModal';
 import CCSwitchModal from './modals/CCSwitchModal';
+import CreatedTokenModal from './modals/CreatedTokenModal';
 import { useTokensData } from '../../../hooks/tokens/useTokensData';
 import { useIsMobile } from '../../../hooks/common/useIsMobile';
 import { createCardProPagination } from '../../../helpers/utils';
@@ -352,6 +353,10 @@ function TokensPage() {
     editingToken,
     closeEdit,
     refresh,
+    createdTokens,
+    showCreatedTokens,
+    closeCreatedTokens,
+    copyText,
 
     // Actions state
     selectedKeys,
@@ -382,6 +387,13 @@ function TokensPage() {
         editingToken={editingToken}
         visiable={showEdit}
         handleClose={closeEdit}
+        onCreated={showCreatedTokens}
+      />
+
+      <CreatedTokenModal
+        tokens={createdTokens}
+        onClose={closeCreatedTokens}
+        copyText={copyText}
       />
 
       <CCSwitchModal
@@ -0,0 +1,88 @@
+/*
+Copyright (C) 2025 QuantumNous
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU Affero General Public License as
+published by the Free Software Foundation, either version 3 of the
+License, or (at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+GNU Affero General Public License for more details.
+
+You should have received a copy of the GNU Affero General Public License
+along with this program. If not, see <https://www.gnu.org/licenses/>.
+
+For commercial licensing, please contact support@quantumnous.com
+*/
+import React from 'react';
+import { Banner, Button, Input, Modal, Typography } from '@douyinfe/semi-ui';
+import { IconCopy } from '@douyinfe/semi-icons';
+import { useTranslation } from 'react-i18next';
+
+// 展示刚创建的令牌。服务端只保存哈希，这里是唯一能复制完整密钥的地方
+const CreatedTokenModal = ({ tokens, onClose, copyText }) => {
+  const { t } = useTranslation();
+  const visible = tokens.length > 0;
+
+  const copyAll = () => {
+    const content = tokens
+      .map((token) =>
+        tokens.length > 1
+          ? `${token.name}    sk-${token.key}`
+          : `sk-${token.key}`,
+      )
+      .join('\n');
+    copyText(content);
+  };
+
+  return (
+    <Modal
+      title={t('令牌已创建')}
+      visible={visible}
+      onCancel={onClose}
+      onOk={onClose}
+      okText={t('我已保存')}
+      cancelButtonProps={{ style: { display: 'none' } }}
+      maskClosable={false}
+      width={520}
+    >
+      <div style={{ display: 'flex', flexDirection: 'column', gap: 12 }}>
+        <Banner
+          type='warning'
+          closeIcon={null}
+          description={t('请立即复制保存，完整密钥只显示一次，遗失后无法找回')}
+        />
+        {tokens.map((token) => (
+          <div key={token.id}>
+            {tokens.length > 1 && (
+              <Typography.Text type='tertiary' size='small'>
+                {token.name}
+              </Typography.Text>
+            )}
+            <Input
+              readOnly
+              value={`sk-${token.key}`}
+              suffix={
+                <Button
+                  theme='borderless'
+                  size='small'
+                  type='tertiary'
+                  icon={<IconCopy />}
+                  aria-label='copy token key'
+                  onClick={() => copyText(`sk-${token.key}`)}
+                />
+              }
+            />
+          </div>
+        ))}
+        {tokens.length > 1 && (
+          <Button onClick={copyAll}>{t('复制全部')}</Button>
+        )}
+      </div>
+    </Modal>
+  );
+};
+
+export default CreatedTokenModal;
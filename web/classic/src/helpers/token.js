@@ -19,52 +19,72 @@ For commercial licensing, please contact support@quantumnous.com
 
 import { API } from './api';
 
-/**
- * 按需获取单个令牌的真实 key
- * @param {number|string} tokenId
- * @returns {Promise<string>} 返回不带 sk- 前缀的真实 token key
- */
-export async function fetchTokenKey(tokenId) {
-  const response = await API.post(`/api/token/${tokenId}/key`);
-  const { success, data, message } = response.data || {};
-  if (!success || !data?.key) {
-    throw new Error(message || 'Failed to fetch token key');
+const CHAT_TOKEN_KEYS_STORAGE = 'chat-token-keys';
+
+function getCurrentUserId() {
+  return JSON.parse(localStorage.getItem('user') || '{}')?.id;
+}
+
+function readChatTokenKeys(userId) {
+  try {
+    // 旧版本把完整密钥长期保存在 localStorage 中，读取时顺带清理
+    localStorage.removeItem(CHAT_TOKEN_KEYS_STORAGE);
+    const stored = JSON.parse(
+      sessionStorage.getItem(CHAT_TOKEN_KEYS_STORAGE) || 'null',
+    );
+    if (!stored || stored.userId !== userId || !stored.keys) {
+      return {};
+    }
+    return stored.keys;
+  } catch (error) {
+    return {};
   }
-  return data.key;
 }
 
 /**
- * 批量获取多个令牌的真实 key
- * @param {number[]} tokenIds
- * @returns {Promise<Record<number, string>>} 返回 {id: key} map，key 不带 sk- 前缀
+ * 在当前标签页会话中记住新建令牌的完整密钥，供聊天链接使用。
+ * 令牌只保存哈希，完整密钥仅在创建时返回一次；只写入 sessionStorage，关闭标签页后即清除
+ * @param {{ id: number, key: string }[]} created key 不带 sk- 前缀
  */
-export async function fetchTokenKeysBatch(tokenIds) {
-  const response = await API.post('/api/token/batch/keys', { ids: tokenIds });
-  const { success, data, message } = response.data || {};
-  if (!success || !data?.keys) {
-    throw new Error(message || 'Failed to fetch token keys');
+export function rememberChatTokenKeys(created) {
+  const userId = getCurrentUserId();
+  if (!userId || !Array.isArray(created) || created.length === 0) {
+    return;
+  }
+  const keys = readChatTokenKeys(userId);
+  for (const item of created) {
+    if (item?.id && item?.key) {
+      keys[item.id] = item.key;
+    }
+  }
+  try {
+    sessionStorage.setItem(
+      CHAT_TOKEN_KEYS_STORAGE,
+      JSON.stringify({ userId, keys }),
+    );
+  } catch (error) {
+    console.error('Failed to remember token keys:', error);
   }
-  return data.keys;
 }
 
 /**
- * 获取可用的 token keys
- * @returns {Promise<string[]>} 返回 active 状态的不带 sk- 前缀的真实 token key 数组
+ * 获取聊天链接可用的 token keys：只有在当前会话中创建时记住了完整密钥、且仍处于启用状态的令牌可用
+ * @returns {Promise<string[]>} 返回不带 sk- 前缀的 token key 数组
  */
 export async function fetchTokenKeys() {
   try {
-    const response = await API.get('/api/token/?p=1&size=10');
+    const keys = readChatTokenKeys(getCurrentUserId());
+    if (Object.keys(keys).length === 0) {
+      return [];
+    }
+    const response = await API.get('/api/token/?p=1&size=100');
     const { success, data } = response.data;
     if (!success) throw new Error('Failed to fetch token keys');
 
     const tokenItems = Array.isArray(data) ? data : data.items || [];
-    const activeTokens = tokenItems.filter((token) => token.status === 1);
-    const keyResults = await Promise.allSettled(
-      activeTokens.map((token) => fetchTokenKey(token.id)),
-    );
-    return keyResults
-      .filter((result) => result.status === 'fulfilled' && result.value)
-      .map((result) => result.value);
+    return tokenItems
+      .filter((token) => token.status === 1 && keys[token.id])
+      .map((token) => keys[token.id]);
   } catch (error) {
     console.error('Error fetching token keys:', error);
     return [];
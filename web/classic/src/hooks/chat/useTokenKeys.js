@@ -30,7 +30,9 @@ export function useTokenKeys(id) {
     const loadAllData = async () => {
       const fetchedKeys = await fetchTokenKeys();
       if (fetchedKeys.length === 0) {
-        showError('当前没有可用的启用令牌，请确认是否有令牌处于启用状态！');
+        showError(
+          '当前没有可用于聊天的令牌：完整密钥仅在创建时显示一次，请在此浏览器中新建令牌后再试！',
+        );
         setTimeout(() => {
           window.location.href = '/console/token';
         }, 1500); // 延迟 1.5 秒后跳转
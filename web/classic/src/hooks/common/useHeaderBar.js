@@ -144,6 +144,9 @@ export const useHeaderBar = ({ onMobileMenuToggle, drawerOpen }) => {
     showSuccess(t('注销成功!'));
     userDispatch({ type: 'logout' });
     localStorage.removeItem('user');
+    // 聊天链接使用的令牌密钥
+    sessionStorage.removeItem('chat-token-keys');
+    localStorage.removeItem('chat-token-keys');
     navigate('/login');
   }, [navigate, t, userDispatch]);
 
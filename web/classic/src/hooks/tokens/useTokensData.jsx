@@ -17,7 +17,7 @@ along with this program. If not, see <https://www.gnu.org/licenses/>.
 For commercial licensing, please contact support@quantumnous.com
 */
 
-import { useState, useEffect, useRef } from 'react';
+import { useState, useEffect } from 'react';
 import { useTranslation } from 'react-i18next';
 import { Modal } from '@douyinfe/semi-ui';
 import {
@@ -30,10 +30,9 @@ import {
 import { ITEMS_PER_PAGE } from '../../constants';
 import { useTableCompactMode } from '../common/useTableCompactMode';
 import {
-  fetchTokenKey as fetchTokenKeyById,
-  fetchTokenKeysBatch,
   getServerAddress,
   encodeChannelConnectionString,
+  rememberChatTokenKeys,
 } from '../../helpers/token';
 
 export const useTokensData = (openFluentNotification, openCCSwitchModal) => {
@@ -61,9 +60,9 @@ export const useTokensData = (openFluentNotification, openCCSwitchModal) => {
   // UI state
   const [compactMode, setCompactMode] = useTableCompactMode('tokens');
   const [showKeys, setShowKeys] = useState({});
+  // 令牌只保存哈希，完整密钥只在创建时返回一次，这里只保存本次创建的令牌
   const [resolvedTokenKeys, setResolvedTokenKeys] = useState({});
-  const [loadingTokenKeys, setLoadingTokenKeys] = useState({});
-  const keyRequestsRef = useRef({});
+  const [createdTokens, setCreatedTokens] = useState([]);
 
   // Form state
   const [formApi, setFormApi] = useState(null);
@@ -138,48 +137,33 @@ export const useTokensData = (openFluentNotification, openCCSwitchModal) => {
     const tokenId =
       typeof tokenOrId === 'object' ? tokenOrId?.id : Number(tokenOrId);
 
-    if (!tokenId) {
-      const error = new Error(t('令牌不存在'));
-      if (!suppressError) {
-        showError(error.message);
-      }
-      throw error;
-    }
-
-    if (resolvedTokenKeys[tokenId]) {
+    if (tokenId && resolvedTokenKeys[tokenId]) {
       return resolvedTokenKeys[tokenId];
     }
-
-    if (keyRequestsRef.current[tokenId]) {
-      return keyRequestsRef.current[tokenId];
+    const error = new Error(
+      tokenId
+        ? t('完整密钥仅在创建时显示一次，如已遗失请重新创建令牌')
+        : t('令牌不存在'),
+    );
+    if (!suppressError) {
+      showError(error.message);
     }
+    throw error;
+  };
 
-    const request = (async () => {
-      setLoadingTokenKeys((prev) => ({ ...prev, [tokenId]: true }));
-      try {
-        const fullKey = await fetchTokenKeyById(tokenId);
-        setResolvedTokenKeys((prev) => ({ ...prev, [tokenId]: fullKey }));
-        return fullKey;
-      } catch (error) {
-        const normalizedError = new Error(
-          error?.message || t('获取令牌密钥失败'),
-        );
-        if (!suppressError) {
-          showError(normalizedError.message);
-        }
-        throw normalizedError;
-      } finally {
-        delete keyRequestsRef.current[tokenId];
-        setLoadingTokenKeys((prev) => {
-          const next = { ...prev };
-          delete next[tokenId];
-          return next;
-        });
-      }
-    })();
+  // 展示刚创建的令牌，created 为 [{ id, name, key }]，key 不带 sk- 前缀
+  const showCreatedTokens = (created) => {
+    const keys = {};
+    for (const item of created) {
+      keys[item.id] = item.key;
+    }
+    setResolvedTokenKeys((prev) => ({ ...prev, ...keys }));
+    rememberChatTokenKeys(created);
+    setCreatedTokens(created);
+  };
 
-    keyRequestsRef.current[tokenId] = request;
-    return request;
+  const closeCreatedTokens = () => {
+    setCreatedTokens([]);
   };
 
   const toggleTokenVisibility = async (record) => {
@@ -193,19 +177,29 @@ export const useTokensData = (openFluentNotification, openCCSwitchModal) => {
       return;
     }
 
-    const fullKey = await fetchTokenKey(record);
-    if (fullKey) {
+    try {
+      await fetchTokenKey(record);
       setShowKeys((prev) => ({ ...prev, [tokenId]: true }));
-    }
+    } catch (_) {}
   };
 
   const copyTokenKey = async (record) => {
-    const fullKey = await fetchTokenKey(record);
+    let fullKey;
+    try {
+      fullKey = await fetchTokenKey(record);
+    } catch (_) {
+      return;
+    }
     await copyText(`sk-${fullKey}`);
   };
 
   const copyTokenConnectionString = async (record) => {
-    const fullKey = await fetchTokenKey(record);
+    let fullKey;
+    try {
+      fullKey = await fetchTokenKey(record);
+    } catch (_) {
+      return;
+    }
     const serverUrl = getServerAddress();
     const connStr = encodeChannelConnectionString(`sk-${fullKey}`, serverUrl);
     await copyText(connStr);
@@ -213,7 +207,12 @@ export const useTokensData = (openFluentNotification, openCCSwitchModal) => {
 
   // Open link function for chat integrations
   const onOpenLink = async (type, url, record) => {
-    const fullKey = await fetchTokenKey(record);
+    let fullKey;
+    try {
+      fullKey = await fetchTokenKey(record);
+    } catch (_) {
+      return;
+    }
     if (url && url.startsWith('ccswitch')) {
       openCCSwitchModal(fullKey);
       return;
@@ -420,22 +419,26 @@ export const useTokensData = (openFluentNotification, openCCSwitchModal) => {
       return;
     }
     try {
-      const ids = selectedKeys.map((token) => token.id);
-      const keysMap = await fetchTokenKeysBatch(ids);
-
-      setResolvedTokenKeys((prev) => ({ ...prev, ...keysMap }));
-
       let content = '';
+      let skipped = 0;
       for (const token of selectedKeys) {
-        const fullKey = keysMap[token.id];
-        if (!fullKey) continue;
+        const fullKey = resolvedTokenKeys[token.id];
+        if (!fullKey) {
+          skipped++;
+          continue;
+        }
         if (copyType === 'name+key') {
           content += `${token.name}    sk-${fullKey}\n`;
         } else {
           content += `sk-${fullKey}\n`;
         }
       }
-      await copyText(content);
+      if (skipped > 0) {
+        showError(t('完整密钥仅在创建时显示一次，如已遗失请重新创建令牌'));
+      }
+      if (content) {
+        await copyText(content);
+      }
     } catch (error) {
       showError(error?.message || t('复制令牌失败'));
     }
@@ -488,7 +491,7 @@ export const useTokensData = (openFluentNotification, openCCSwitchModal) => {
     showKeys,
     setShowKeys,
     resolvedTokenKeys,
-    loadingTokenKeys,
+    createdTokens,
 
     // Form state
     formApi,
@@ -501,6 +504,8 @@ export const useTokensData = (openFluentNotification, openCCSwitchModal) => {
     refresh,
     copyText,
     fetchTokenKey,
+    showCreatedTokens,
+    closeCreatedTokens,
     toggleTokenVisibility,
     copyTokenKey,
     copyTokenConnectionString,
@@ -50,6 +50,7 @@ import {
   saveAffiliateCode,
 } from '@/features/auth/lib/storage'
 import { useStatus } from '@/hooks/use-status'
+import { copyToClipboard } from '@/lib/copy-to-clipboard'
 import { cn } from '@/lib/utils'
 
 export function SignUpForm({
@@ -63,6 +64,8 @@ export function SignUpForm({
   const [wechatCode, setWeChatCode] = useState('')
   const [isWeChatDialogOpen, setIsWeChatDialogOpen] = useState(false)
   const [isWeChatSubmitting, setIsWeChatSubmitting] = useState(false)
+  // The default API key is only returned by the register request
+  const [defaultTokenKey, setDefaultTokenKey] = useState('')
   const legalConsentErrorMessage = t('Please agree to the legal terms first')
 
   const { status } = useStatus()
@@ -168,7 +171,13 @@ export function SignUpForm({
 
       if (res?.success) {
         toast.success(t('Account created! Please sign in'))
-        redirectToLogin()
+        const tokenKey = (res.data as { token_key?: string } | undefined)
+          ?.token_key
+        if (tokenKey) {
+          setDefaultTokenKey(`sk-${tokenKey}`)
+        } else {
+          redirectToLogin()
+        }
       } else {
         toast.error(res?.message || t('Failed to create account'))
       }
@@ -377,6 +386,41 @@ export function SignUpForm({
         )}
       </form>
 
+      <Dialog
+        open={Boolean(defaultTokenKey)}
+        onOpenChange={(open) => {
+          if (!open) {
+            setDefaultTokenKey('')
+            redirectToLogin()
+          }
+        }}
+        title={t('API key created')}
+        description={t(
+          'Copy the key now. It will not be shown again, and it cannot be recovered if you lose it.'
+        )}
+        contentClassName='max-w-md'
+        headerClassName='text-left'
+        contentHeight='auto'
+        footer={
+          <Button
+            type='button'
+            onClick={async () => {
+              const ok = await copyToClipboard(defaultTokenKey)
+              if (ok) toast.success(t('Copied'))
+            }}
+          >
+            {t('Copy API key')}
+          </Button>
+        }
+      >
+        <Input
+          readOnly
+          value={defaultTokenKey}
+          onFocus={(event) => event.target.select()}
+          className='font-mono text-xs'
+        />
+      </Dialog>
+
       {hasWeChatLogin && (
         <Dialog
           open={isWeChatDialogOpen}
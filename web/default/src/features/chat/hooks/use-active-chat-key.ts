@@ -18,28 +18,82 @@ For commercial licensing, please contact support@quantumnous.com
 */
 import { useQuery } from '@tanstack/react-query'
 
-import { fetchTokenKey, getApiKeys } from '@/features/keys/api'
+import { getApiKeys } from '@/features/keys/api'
 import { API_KEY_STATUS } from '@/features/keys/constants'
 import { useAuthStore } from '@/stores/auth-store'
 
+const CHAT_KEYS_STORAGE = 'chat-token-keys'
+
+type StoredChatKeys = {
+  userId: number
+  keys: Record<number, string>
+}
+
+function readStoredChatKeys(userId: number): Record<number, string> {
+  try {
+    // Older versions kept full keys in localStorage indefinitely
+    localStorage.removeItem(CHAT_KEYS_STORAGE)
+    const raw = sessionStorage.getItem(CHAT_KEYS_STORAGE)
+    if (!raw) return {}
+    const stored = JSON.parse(raw) as StoredChatKeys
+    if (stored.userId !== userId || !stored.keys) return {}
+    return stored.keys
+  } catch {
+    return {}
+  }
+}
+
+/**
+ * Remember the full keys of API keys created in this tab so chat links can
+ * use them. The server only stores a hash and returns the full key once, when
+ * the key is created. Keys are kept in sessionStorage only, so they are gone
+ * once the tab is closed. Keys are stored with the `sk-` prefix.
+ */
+export function rememberChatKeys(created: { id: number; key: string }[]) {
+  const userId = useAuthStore.getState().auth.user?.id
+  if (!userId || created.length === 0) return
+  const keys = readStoredChatKeys(userId)
+  for (const item of created) {
+    if (item.id && item.key) keys[item.id] = `sk-${item.key}`
+  }
+  try {
+    sessionStorage.setItem(
+      CHAT_KEYS_STORAGE,
+      JSON.stringify({ userId, keys } satisfies StoredChatKeys)
+    )
+  } catch {
+    /* empty */
+  }
+}
+
 export async function fetchActiveChatKey() {
-  const result = await getApiKeys({ p: 1, size: 50 })
+  const userId = useAuthStore.getState().auth.user?.id
+  if (!userId) {
+    throw new Error('Please log in first.')
+  }
+  const keys = readStoredChatKeys(userId)
+  if (Object.keys(keys).length === 0) {
+    throw new Error(
+      'No API key is available for chat. Full keys are only shown once, so create a new API key in this session first.'
+    )
+  }
+
+  const result = await getApiKeys({ p: 1, size: 100 })
   if (!result.success) {
     throw new Error(result.message || 'Failed to load API keys')
   }
 
   const items = result.data?.items ?? []
-  const active = items.find((item) => item.status === API_KEY_STATUS.ENABLED)
+  const active = items.find(
+    (item) => item.status === API_KEY_STATUS.ENABLED && keys[item.id]
+  )
   if (!active) {
-    throw new Error('No enabled API keys found. Create or enable one first.')
-  }
-
-  const keyResult = await fetchTokenKey(active.id)
-  if (!keyResult.success || !keyResult.data?.key) {
-    throw new Error(keyResult.message || 'Failed to load API key')
+    throw new Error(
+      'No enabled API key created in this session was found. Create or enable one first.'
+    )
   }
 
-  return `sk-${keyResult.data.key}`
+  return keys[active.id]
 }
 
 /**
@@ -46,7 +46,7 @@ import {
   CardStaggerItem,
 } from '@/components/page-transition'
 import { Button } from '@/components/ui/button'
-import { fetchTokenKey, getApiKeys } from '@/features/keys/api'
+import { getApiKeys } from '@/features/keys/api'
 import type { ApiKey } from '@/features/keys/types'
 import { useCopyToClipboard } from '@/hooks/use-copy-to-clipboard'
 import { getUserModels } from '@/lib/api'
@@ -108,7 +108,6 @@ interface RequestExample {
   endpoint: string
   model: string
   keyName: string
-  keyId?: number
   displayKey: string
   ready: boolean
 }
@@ -288,25 +287,22 @@ function RequestPreview(props: {
   })
   const previewLines = previewCurl.split('\n')
   const handleCopyRequest = async () => {
-    if (!props.example.keyId || isCopying) return
+    if (isCopying) return
 
     setIsCopying(true)
     try {
-      const result = await fetchTokenKey(props.example.keyId)
-      const key = result.success && result.data?.key ? result.data.key : ''
-      if (!key) {
-        toast.error(result.message || t('Failed to copy to clipboard'))
-        return
-      }
-
+      // The full key is only shown when it is created, so the copied command
+      // reads it from an environment variable
       const realCurl = buildCurlCommand({
         endpoint: props.example.endpoint,
-        apiKey: `sk-${key}`,
+        apiKey: '$NEW_API_KEY',
         model: props.example.model,
       })
       const copied = await copyToClipboard(realCurl)
       if (copied) {
-        toast.success(t('Copied to clipboard'))
+        toast.success(
+          t('Copied. Set NEW_API_KEY to your API key before running it.')
+        )
       } else {
         toast.error(t('Failed to copy to clipboard'))
       }
@@ -590,7 +586,6 @@ export function OverviewDashboard() {
       endpoint,
       model,
       keyName,
-      keyId: preferredKey?.id,
       displayKey: preferredKey
         ? formatDisplayKey(`sk-${preferredKey.key}`)
         : 'sk-...',
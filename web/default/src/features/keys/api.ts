@@ -98,21 +98,3 @@ export async function updateApiKeyStatus(
   const res = await api.put('/api/token/?status_only=true', { id, status })
   return res.data
 }
-
-// Fetch the real (unmasked) key for a token by ID
-export async function fetchTokenKey(
-  id: number
-): Promise<{ success: boolean; message?: string; data?: { key: string } }> {
-  const res = await api.post(`/api/token/${id}/key`)
-  return res.data
-}
-
-// Batch fetch real (unmasked) keys for multiple tokens
-export async function fetchTokenKeysBatch(ids: number[]): Promise<{
-  success: boolean
-  message?: string
-  data?: { keys: Record<number, string> }
-}> {
-  const res = await api.post('/api/token/batch/keys', { ids })
-  return res.data
-}
@@ -16,10 +16,9 @@ along with this program. If not, see <https://www.gnu.org/licenses/>.
 
 For commercial licensing, please contact support@quantumnous.com
 */
-import { Check, Copy, Loader2 } from 'lucide-react'
+import { Check, Copy } from 'lucide-react'
 import { useState, useCallback } from 'react'
 import { useTranslation } from 'react-i18next'
-import { toast } from 'sonner'
 
 import { BadgeCell } from '@/components/data-table'
 import { StatusBadge } from '@/components/status-badge'
@@ -36,51 +35,31 @@ import {
 } from '@/components/ui/tooltip'
 import { copyToClipboard } from '@/lib/copy-to-clipboard'
 
+import { ERROR_MESSAGES } from '../constants'
 import { type ApiKey } from '../types'
 import { useApiKeys } from './api-keys-provider'
 
 export function ApiKeyCell({ apiKey }: { apiKey: ApiKey }) {
   const { t } = useTranslation()
-  const {
-    resolveRealKey,
-    resolvedKeys,
-    loadingKeys,
-    copiedKeyId,
-    markKeyCopied,
-  } = useApiKeys()
+  const { resolveRealKey, resolvedKeys, copiedKeyId, markKeyCopied } =
+    useApiKeys()
   const [popoverOpen, setPopoverOpen] = useState(false)
 
-  const isLoading = !!loadingKeys[apiKey.id]
+  // Only keys created in this session are known in full
   const resolvedFullKey = resolvedKeys[apiKey.id]
   const isCopied = copiedKeyId === apiKey.id
   const maskedKey = `sk-${apiKey.key}`
 
-  const handlePopoverOpen = useCallback(
-    (open: boolean) => {
-      setPopoverOpen(open)
-      if (open && !resolvedFullKey) {
-        resolveRealKey(apiKey.id)
-      }
-    },
-    [resolvedFullKey, resolveRealKey, apiKey.id]
-  )
-
   const handleCopy = useCallback(async () => {
-    const realKey = resolvedFullKey
-    if (!realKey) {
-      void resolveRealKey(apiKey.id)
-      toast.info(t('API key is loading, please try again in a moment'))
-      return
-    }
-    if (realKey) {
-      const ok = await copyToClipboard(realKey)
-      if (ok) markKeyCopied(apiKey.id)
-    }
-  }, [resolvedFullKey, resolveRealKey, apiKey.id, markKeyCopied, t])
+    const realKey = resolveRealKey(apiKey.id)
+    if (!realKey) return
+    const ok = await copyToClipboard(realKey)
+    if (ok) markKeyCopied(apiKey.id)
+  }, [resolveRealKey, apiKey.id, markKeyCopied])
 
   return (
     <div className='flex max-w-full min-w-0 items-center'>
-      <Popover open={popoverOpen} onOpenChange={handlePopoverOpen}>
+      <Popover open={popoverOpen} onOpenChange={setPopoverOpen}>
         <PopoverTrigger
           render={
             <Button
@@ -97,22 +76,20 @@ export function ApiKeyCell({ apiKey }: { apiKey: ApiKey }) {
           align='start'
         >
           <div className='space-y-2'>
-            <p className='text-muted-foreground text-xs'>{t('Full API Key')}</p>
-            {isLoading ? (
-              <div className='flex items-center gap-2 py-2'>
-                <Loader2 className='size-3.5 animate-spin' />
-                <span className='text-muted-foreground text-xs'>
-                  {t('Loading...')}
-                </span>
-              </div>
-            ) : (
-              <input
-                readOnly
-                value={resolvedFullKey || maskedKey}
-                autoFocus
-                onFocus={(e) => e.target.select()}
-                className='bg-muted/50 w-full min-w-[280px] rounded-md border px-3 py-2 font-mono text-xs outline-none'
-              />
+            <p className='text-muted-foreground text-xs'>
+              {resolvedFullKey ? t('Full API Key') : t('API Key')}
+            </p>
+            <input
+              readOnly
+              value={resolvedFullKey || maskedKey}
+              autoFocus
+              onFocus={(e) => e.target.select()}
+              className='bg-muted/50 w-full min-w-[280px] rounded-md border px-3 py-2 font-mono text-xs outline-none'
+            />
+            {!resolvedFullKey && (
+              <p className='text-muted-foreground max-w-[280px] text-xs'>
+                {t(ERROR_MESSAGES.KEY_NOT_REVEALABLE)}
+              </p>
             )}
           </div>
         </PopoverContent>
@@ -125,30 +102,21 @@ export function ApiKeyCell({ apiKey }: { apiKey: ApiKey }) {
               size='icon'
               className='size-7 shrink-0'
               onClick={handleCopy}
-              onFocus={() => {
-                if (!resolvedFullKey) void resolveRealKey(apiKey.id)
-              }}
-              onPointerEnter={() => {
-                if (!resolvedFullKey) void resolveRealKey(apiKey.id)
-              }}
-              disabled={isLoading}
             />
           }
         >
-          {isLoading ? (
-            <Loader2 className='size-3.5 animate-spin' />
-          ) : isCopied ? (
+          {isCopied ? (
             <Check className='size-3.5 text-green-600' />
           ) : (
             <Copy className='size-3.5' />
           )}
         </TooltipTrigger>
         <TooltipContent>
-          {isLoading
-            ? t('Loading...')
-            : isCopied
-              ? t('Copied!')
-              : t('Copy API key')}
+          {isCopied
+            ? t('Copied!')
+            : resolvedFullKey
+              ? t('Copy API key')
+              : t(ERROR_MESSAGES.KEY_NOT_REVEALABLE)}
         </TooltipContent>
       </Tooltip>
     </div>
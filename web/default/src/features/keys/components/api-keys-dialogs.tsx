@@ -19,10 +19,11 @@ For commercial licensing, please contact support@quantumnous.com
 import { ApiKeysDeleteDialog } from './api-keys-delete-dialog'
 import { ApiKeysMutateDrawer } from './api-keys-mutate-drawer'
 import { useApiKeys } from './api-keys-provider'
+import { ApiKeyCreatedDialog } from './dialogs/api-key-created-dialog'
 import { CCSwitchDialog } from './dialogs/cc-switch-dialog'
 
 export function ApiKeysDialogs() {
-  const { open, setOpen, currentRow, resolvedKey } = useApiKeys()
+  const { open, setOpen, currentRow, resolvedKey, createdKeys } = useApiKeys()
 
   return (
     <>
@@ -37,6 +38,11 @@ export function ApiKeysDialogs() {
         onOpenChange={(isOpen) => !isOpen && setOpen(null)}
         tokenKey={resolvedKey}
       />
+      <ApiKeyCreatedDialog
+        open={open === 'created'}
+        onOpenChange={(isOpen) => !isOpen && setOpen(null)}
+        keys={createdKeys}
+      />
     </>
   )
 }
@@ -81,7 +81,7 @@ import {
   ApiKeyGroupCombobox,
   type ApiKeyGroupOption,
 } from './api-key-group-combobox'
-import { useApiKeys } from './api-keys-provider'
+import { type CreatedApiKey, useApiKeys } from './api-keys-provider'
 
 type ApiKeyMutateDrawerProps = {
   open: boolean
@@ -96,7 +96,7 @@ export function ApiKeysMutateDrawer({
 }: ApiKeyMutateDrawerProps) {
   const { t } = useTranslation()
   const isUpdate = !!currentRow
-  const { triggerRefresh } = useApiKeys()
+  const { triggerRefresh, showCreatedKeys } = useApiKeys()
   const { status } = useStatus()
   const [isSubmitting, setIsSubmitting] = useState(false)
   const [advancedOpen, setAdvancedOpen] = useState(false)
@@ -188,6 +188,8 @@ export function ApiKeysMutateDrawer({
         // Create mode - handle batch creation
         const count = data.tokenCount || 1
         let successCount = 0
+        // The full key is only returned by the create request
+        const created: CreatedApiKey[] = []
 
         for (let i = 0; i < count; i++) {
           const result = await createApiKey({
@@ -199,6 +201,13 @@ export function ApiKeysMutateDrawer({
           })
           if (result.success) {
             successCount++
+            if (result.data?.key) {
+              created.push({
+                id: result.data.id,
+                name: result.data.name,
+                key: result.data.key,
+              })
+            }
           } else {
             toast.error(result.message || t(ERROR_MESSAGES.CREATE_FAILED))
             break
@@ -213,6 +222,7 @@ export function ApiKeysMutateDrawer({
           )
           onOpenChange(false)
           triggerRefresh()
+          if (created.length > 0) showCreatedKeys(created)
         }
       }
     } catch (_error) {
@@ -20,12 +20,21 @@ import React, { useState, useCallback, useRef, useEffect } from 'react'
 import { useTranslation } from 'react-i18next'
 import { toast } from 'sonner'
 
+import { rememberChatKeys } from '@/features/chat/hooks/use-active-chat-key'
 import useDialogState from '@/hooks/use-dialog'
 
-import { fetchTokenKey, fetchTokenKeysBatch } from '../api'
 import { ERROR_MESSAGES } from '../constants'
 import { type ApiKey, type ApiKeysDialogType } from '../types'
 
+// A key created in this session. The server only stores a hash, so the full
+// key is returned once by the create request and kept in memory here (and
+// remembered in sessionStorage for chat links while this tab stays open).
+export type CreatedApiKey = {
+  id: number
+  name: string
+  key: string
+}
+
 type ApiKeysContextType = {
   open: ApiKeysDialogType | null
   setOpen: (str: ApiKeysDialogType | null) => void
@@ -35,10 +44,11 @@ type ApiKeysContextType = {
   triggerRefresh: () => void
   resolvedKey: string
   setResolvedKey: React.Dispatch<React.SetStateAction<string>>
-  resolveRealKey: (id: number) => Promise<string | null>
-  resolveRealKeysBatch: (ids: number[]) => Promise<Record<number, string>>
+  resolveRealKey: (id: number) => string | null
+  resolveRealKeysBatch: (ids: number[]) => Record<number, string>
   resolvedKeys: Record<number, string>
-  loadingKeys: Record<number, boolean>
+  createdKeys: CreatedApiKey[]
+  showCreatedKeys: (keys: CreatedApiKey[]) => void
   copiedKeyId: number | null
   markKeyCopied: (id: number) => void
 }
@@ -53,8 +63,7 @@ export function ApiKeysProvider({ children }: { children: React.ReactNode }) {
   const [resolvedKey, setResolvedKey] = useState('')
 
   const [resolvedKeys, setResolvedKeys] = useState<Record<number, string>>({})
-  const [loadingKeys, setLoadingKeys] = useState<Record<number, boolean>>({})
-  const pendingRequests = useRef<Record<number, Promise<string | null>>>({})
+  const [createdKeys, setCreatedKeys] = useState<CreatedApiKey[]>([])
 
   const [copiedKeyId, setCopiedKeyId] = useState<number | null>(null)
   const copiedTimerRef = useRef<ReturnType<typeof setTimeout>>(undefined)
@@ -73,83 +82,39 @@ export function ApiKeysProvider({ children }: { children: React.ReactNode }) {
     setRefreshTrigger((prev) => prev + 1)
   }, [])
 
+  const showCreatedKeys = useCallback(
+    (keys: CreatedApiKey[]) => {
+      const newKeys: Record<number, string> = {}
+      for (const item of keys) newKeys[item.id] = `sk-${item.key}`
+      setResolvedKeys((prev) => ({ ...prev, ...newKeys }))
+      rememberChatKeys(keys)
+      setCreatedKeys(keys)
+      setOpen('created')
+    },
+    [setOpen]
+  )
+
+  // Only keys created in this session can be resolved; existing keys cannot
+  // be read back from the server.
   const resolveRealKey = useCallback(
-    async (id: number): Promise<string | null> => {
+    (id: number): string | null => {
       if (resolvedKeys[id]) return resolvedKeys[id]
-      if (id in pendingRequests.current) return pendingRequests.current[id]
-
-      const request = (async () => {
-        setLoadingKeys((prev) => ({ ...prev, [id]: true }))
-        try {
-          const res = await fetchTokenKey(id)
-          if (res.success && res.data?.key) {
-            const fullKey = `sk-${res.data.key}`
-            setResolvedKeys((prev) => ({ ...prev, [id]: fullKey }))
-            return fullKey
-          }
-          toast.error(res.message || t(ERROR_MESSAGES.UNEXPECTED))
-          return null
-        } catch {
-          toast.error(t(ERROR_MESSAGES.UNEXPECTED))
-          return null
-        } finally {
-          delete pendingRequests.current[id]
-          setLoadingKeys((prev) => {
-            const next = { ...prev }
-            delete next[id]
-            return next
-          })
-        }
-      })()
-
-      pendingRequests.current[id] = request
-      return request
+      toast.error(t(ERROR_MESSAGES.KEY_NOT_REVEALABLE))
+      return null
     },
     [resolvedKeys, t]
   )
 
   const resolveRealKeysBatch = useCallback(
-    async (ids: number[]): Promise<Record<number, string>> => {
-      const uncachedIds = ids.filter((id) => !resolvedKeys[id])
-      if (uncachedIds.length === 0) {
-        const result: Record<number, string> = {}
-        for (const id of ids) result[id] = resolvedKeys[id]
-        return result
-      }
-
-      for (const id of uncachedIds) {
-        setLoadingKeys((prev) => ({ ...prev, [id]: true }))
+    (ids: number[]): Record<number, string> => {
+      const result: Record<number, string> = {}
+      for (const id of ids) {
+        if (resolvedKeys[id]) result[id] = resolvedKeys[id]
       }
-
-      try {
-        const res = await fetchTokenKeysBatch(uncachedIds)
-        if (res.success && res.data?.keys) {
-          const newKeys: Record<number, string> = {}
-          for (const [idStr, key] of Object.entries(res.data.keys)) {
-            newKeys[Number(idStr)] = `sk-${key}`
-          }
-          setResolvedKeys((prev) => ({ ...prev, ...newKeys }))
-
-          const result: Record<number, string> = { ...newKeys }
-          for (const id of ids) {
-            if (resolvedKeys[id]) result[id] = resolvedKeys[id]
-          }
-          return result
-        }
-        toast.error(res.message || t(ERROR_MESSAGES.UNEXPECTED))
-        return {}
-      } catch {
-        toast.error(t(ERROR_MESSAGES.UNEXPECTED))
-        return {}
-      } finally {
-        for (const id of uncachedIds) {
-          setLoadingKeys((prev) => {
-            const next = { ...prev }
-            delete next[id]
-            return next
-          })
-        }
+      if (Object.keys(result).length < ids.length) {
+        toast.error(t(ERROR_MESSAGES.KEY_NOT_REVEALABLE))
       }
+      return result
     },
     [resolvedKeys, t]
   )
@@ -168,7 +133,8 @@ export function ApiKeysProvider({ children }: { children: React.ReactNode }) {
         resolveRealKey,
         resolveRealKeysBatch,
         resolvedKeys,
-        loadingKeys,
+        createdKeys,
+        showCreatedKeys,
         copiedKeyId,
         markKeyCopied,
       }}
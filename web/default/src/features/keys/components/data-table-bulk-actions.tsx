@@ -54,7 +54,7 @@ export function DataTableBulkActions<TData>({
     setIsCopying(true)
     try {
       const ids = selectedRows.map((row) => (row.original as ApiKey).id)
-      const keysMap = await resolveRealKeysBatch(ids)
+      const keysMap = resolveRealKeysBatch(ids)
 
       const lines: string[] = []
       for (const row of selectedRows) {
@@ -0,0 +1,122 @@
+/*
+Copyright (C) 2023-2026 QuantumNous
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU Affero General Public License as
+published by the Free Software Foundation, either version 3 of the
+License, or (at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+GNU Affero General Public License for more details.
+
+You should have received a copy of the GNU Affero General Public License
+along with this program. If not, see <https://www.gnu.org/licenses/>.
+
+For commercial licensing, please contact support@quantumnous.com
+*/
+import { Check, Copy } from 'lucide-react'
+import { useState } from 'react'
+import { useTranslation } from 'react-i18next'
+import { toast } from 'sonner'
+
+import { Dialog } from '@/components/dialog'
+import { Alert, AlertDescription } from '@/components/ui/alert'
+import { Button } from '@/components/ui/button'
+import { copyToClipboard } from '@/lib/copy-to-clipboard'
+
+import { type CreatedApiKey } from '../api-keys-provider'
+
+type ApiKeyCreatedDialogProps = {
+  open: boolean
+  onOpenChange: (open: boolean) => void
+  keys: CreatedApiKey[]
+}
+
+/**
+ * Shows newly created keys. The server keeps only a hash, so this is the
+ * only time the full key can be copied.
+ */
+export function ApiKeyCreatedDialog(props: ApiKeyCreatedDialogProps) {
+  const { t } = useTranslation()
+  const [copiedId, setCopiedId] = useState<number | 'all' | null>(null)
+
+  const handleCopy = async (text: string, id: number | 'all') => {
+    const ok = await copyToClipboard(text)
+    if (ok) {
+      setCopiedId(id)
+      toast.success(t('Copied'))
+    } else {
+      toast.error(t('Failed to copy to clipboard'))
+    }
+  }
+
+  const allKeys = props.keys
+    .map((item) =>
+      props.keys.length > 1 ? `${item.name}\tsk-${item.key}` : `sk-${item.key}`
+    )
+    .join('\n')
+
+  return (
+    <Dialog
+      open={props.open}
+      onOpenChange={props.onOpenChange}
+      title={t('API key created')}
+      contentClassName='sm:max-w-lg'
+      footer={
+        <>
+          {props.keys.length > 1 && (
+            <Button
+              variant='outline'
+              onClick={() => void handleCopy(allKeys, 'all')}
+            >
+              {copiedId === 'all' ? t('Copied!') : t('Copy all')}
+            </Button>
+          )}
+          <Button onClick={() => props.onOpenChange(false)}>{t('Done')}</Button>
+        </>
+      }
+    >
+      <div className='space-y-4'>
+        <Alert>
+          <AlertDescription>
+            {t(
+              'Copy the key now. It will not be shown again, and it cannot be recovered if you lose it.'
+            )}
+          </AlertDescription>
+        </Alert>
+        <div className='max-h-[320px] space-y-2 overflow-y-auto'>
+          {props.keys.map((item) => (
+            <div key={item.id} className='space-y-1'>
+              {props.keys.length > 1 && (
+                <p className='text-muted-foreground text-xs'>{item.name}</p>
+              )}
+              <div className='flex items-center gap-2'>
+                <input
+                  readOnly
+                  value={`sk-${item.key}`}
+                  onFocus={(e) => e.target.select()}
+                  className='bg-muted/50 w-full min-w-0 rounded-md border px-3 py-2 font-mono text-xs outline-none'
+                />
+                <Button
+                  variant='ghost'
+                  size='icon'
+                  className='size-8 shrink-0'
+                  aria-label={t('Copy API key')}
+                  onClick={() => void handleCopy(`sk-${item.key}`, item.id)}
+                >
+                  {copiedId === item.id ? (
+                    <Check className='size-4 text-green-600' />
+                  ) : (
+                    <Copy className='size-4' />
+                  )}
+                </Button>
+              </div>
+            </div>
+          ))}
+        </div>
+      </div>
+    </Dialog>
+  )
+}
@@ -85,6 +85,8 @@ export const ERROR_MESSAGES = {
   DELETE_FAILED: 'Failed to delete API key',
   BATCH_DELETE_FAILED: 'Failed to delete API keys',
   STATUS_UPDATE_FAILED: 'Failed to update API key status',
+  KEY_NOT_REVEALABLE:
+    'The full API key is only shown once when it is created. Create a new key if you have lost it.',
 } as const
 
 // ============================================================================
@@ -97,6 +97,9 @@ export const useAuthStore = create<AuthState>()((set) => {
         set((state) => {
           if (typeof window !== 'undefined') {
             window.localStorage.removeItem('user')
+            // Full keys remembered for web chat links
+            window.sessionStorage.removeItem('chat-token-keys')
+            window.localStorage.removeItem('chat-token-keys')
           }
           return {
             ...state,